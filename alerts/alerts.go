@@ -11,6 +11,7 @@ import (
 
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/webhooks"
+	"go.uber.org/zap"
 )
 
 const (
@@ -31,14 +32,42 @@ const (
 	webhookModule        = "alerts"
 	webhookEventDismiss  = "dismiss"
 	webhookEventRegister = "register"
+
+	// DefaultRetention is the default amount of time dismissed alerts are
+	// kept in the store before they are pruned.
+	DefaultRetention = 30 * 24 * time.Hour
 )
 
+// ErrInvalidSeverity is returned when an unknown severity is parsed.
+var ErrInvalidSeverity = errors.New("invalid severity")
+
 type (
 	Alerter interface {
 		RegisterAlert(_ context.Context, a Alert) error
 		DismissAlerts(_ context.Context, ids ...types.Hash256) error
 	}
 
+	// A Store persists alerts, both active and dismissed ones, so they
+	// survive restarts and can be inspected later on.
+	Store interface {
+		ActiveAlerts(ctx context.Context) ([]Alert, error)
+		AlertHistory(ctx context.Context, opts AlertsOpts) ([]Alert, error)
+		AddAlert(ctx context.Context, a Alert) error
+		MarkAlertsDismissed(ctx context.Context, dismissedAt time.Time, ids ...types.Hash256) error
+		PruneAlerts(ctx context.Context, dismissedBefore time.Time) (int64, error)
+	}
+
+	// AlertsOpts contains the options for fetching alerts. Module filters
+	// alerts by their origin, e.g. 'autopilot' matches the alerts of all
+	// autopilots. A negative limit returns all alerts.
+	AlertsOpts struct {
+		Severity  Severity
+		Module    string
+		Dismissed bool
+		Offset    int
+		Limit     int
+	}
+
 	// Severity indicates the severity of an alert.
 	Severity uint8
 
@@ -52,16 +81,31 @@ type (
 		Message string `json:"message"`
 		// Data is a map of arbitrary data that can be used to provide
 		// additional context to the alert.
-		Data      map[string]any `json:"data,omitempty"`
-		Timestamp time.Time      `json:"timestamp"`
+		Data map[string]any `json:"data,omitempty"`
+		// Timestamp is the time the alert was first registered.
+		Timestamp time.Time `json:"timestamp"`
+		// Count is the number of times the alert was registered since it
+		// was first registered, LastSeen is the time of the most recent
+		// registration.
+		Count    int       `json:"count"`
+		LastSeen time.Time `json:"lastSeen"`
+		// DismissedAt is the time the alert was dismissed, it's only set
+		// for alerts fetched from the alert history.
+		DismissedAt *time.Time `json:"dismissedAt,omitempty"`
 	}
 
 	// A Manager manages the host's alerts.
 	Manager struct {
+		persistMu sync.Mutex
+
 		mu sync.Mutex
 		// alerts is a map of alert IDs to their current alert.
 		alerts             map[types.Hash256]Alert
 		webhookBroadcaster webhooks.Broadcaster
+
+		store     Store
+		retention time.Duration
+		logger    *zap.SugaredLogger
 	}
 )
 
@@ -88,7 +132,12 @@ func (s Severity) MarshalJSON() ([]byte, error) {
 
 // UnmarshalJSON implements the json.Unmarshaler interface.
 func (s *Severity) UnmarshalJSON(b []byte) error {
-	status := strings.Trim(string(b), `"`)
+	return s.UnmarshalText([]byte(strings.Trim(string(b), `"`)))
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *Severity) UnmarshalText(b []byte) error {
+	status := string(b)
 	switch status {
 	case severityInfoStr:
 		*s = SeverityInfo
@@ -99,12 +148,14 @@ func (s *Severity) UnmarshalJSON(b []byte) error {
 	case severityCriticalStr:
 		*s = SeverityCritical
 	default:
-		return fmt.Errorf("unrecognized severity: %v", status)
+		return fmt.Errorf("%w: %v", ErrInvalidSeverity, status)
 	}
 	return nil
 }
 
-// RegisterAlert implements the Alerter interface.
+// RegisterAlert implements the Alerter interface. Registering an alert that is
+// already active updates it and increments its counter, webhooks are only
+// notified about new alerts and alerts whose severity increased.
 func (m *Manager) RegisterAlert(ctx context.Context, alert Alert) error {
 	if alert.ID == (types.Hash256{}) {
 		return errors.New("cannot register alert with zero id")
@@ -118,43 +169,100 @@ func (m *Manager) RegisterAlert(ctx context.Context, alert Alert) error {
 		return errors.New("caannot register alert without origin")
 	}
 
+	// aggregate repeated registrations of the same alert
 	m.mu.Lock()
+	existing, exists := m.alerts[alert.ID]
+	alert.Count = 1
+	alert.LastSeen = alert.Timestamp
+	if exists {
+		alert.Count = existing.Count + 1
+		if existing.Timestamp.Before(alert.Timestamp) {
+			alert.Timestamp = existing.Timestamp
+		}
+		if existing.LastSeen.After(alert.LastSeen) {
+			alert.LastSeen = existing.LastSeen
+		}
+	}
 	m.alerts[alert.ID] = alert
 	wb := m.webhookBroadcaster
 	m.mu.Unlock()
 
+	// persist the alert, failing to do so doesn't prevent it from being
+	// active
+	m.persistAlert(ctx, alert.ID)
+
+	if exists && alert.Severity <= existing.Severity {
+		return nil // don't fire webhook to avoid spam
+	}
 	return wb.BroadcastAction(ctx, webhooks.Event{
-		Module:  webhookModule,
-		Event:   webhookEventRegister,
-		Payload: alert,
+		Module:   webhookModule,
+		Event:    webhookEventRegister,
+		Severity: alert.Severity.String(),
+		Payload:  alert,
 	})
 }
 
+// persistAlert persists the current version of the alert with the given id.
+// Persisting is serialized so a stale version can't overwrite a newer one.
+func (m *Manager) persistAlert(ctx context.Context, id types.Hash256) {
+	m.persistMu.Lock()
+	defer m.persistMu.Unlock()
+
+	m.mu.Lock()
+	alert, exists := m.alerts[id]
+	store := m.store
+	logger := m.logger
+	m.mu.Unlock()
+	if store == nil || !exists {
+		return
+	}
+	if err := store.AddAlert(ctx, alert); err != nil {
+		logger.Errorf("failed to persist alert %v: %v", id, err)
+	}
+}
+
 // DismissAlerts implements the Alerter interface.
 func (m *Manager) DismissAlerts(ctx context.Context, ids ...types.Hash256) error {
 	var dismissed []types.Hash256
+	var severity Severity
 	m.mu.Lock()
 	for _, id := range ids {
-		_, exists := m.alerts[id]
+		a, exists := m.alerts[id]
 		if !exists {
 			continue
 		}
 		delete(m.alerts, id)
 		dismissed = append(dismissed, id)
+		if a.Severity > severity {
+			severity = a.Severity
+		}
 	}
 	if len(m.alerts) == 0 {
 		m.alerts = make(map[types.Hash256]Alert) // reclaim memory
 	}
 	wb := m.webhookBroadcaster
+	store, retention := m.store, m.retention
 	m.mu.Unlock()
 
 	if len(dismissed) == 0 {
 		return nil // don't fire webhook to avoid spam
 	}
+
+	// mark the alerts as dismissed in the store and prune the ones that
+	// were dismissed before the retention window
+	if store != nil {
+		now := time.Now()
+		if err := store.MarkAlertsDismissed(ctx, now, dismissed...); err != nil {
+			return fmt.Errorf("failed to mark alerts as dismissed: %w", err)
+		} else if _, err := store.PruneAlerts(ctx, now.Add(-retention)); err != nil {
+			return fmt.Errorf("failed to prune alerts: %w", err)
+		}
+	}
 	return wb.BroadcastAction(ctx, webhooks.Event{
-		Module:  webhookModule,
-		Event:   webhookEventDismiss,
-		Payload: dismissed,
+		Module:   webhookModule,
+		Event:    webhookEventDismiss,
+		Severity: severity.String(),
+		Payload:  dismissed,
 	})
 }
 
@@ -173,6 +281,96 @@ func (m *Manager) Active() []Alert {
 	return alerts
 }
 
+// Alerts returns the alerts matching the given options, sorted by timestamp
+// from newest to oldest. Dismissed alerts are only returned if requested and
+// the manager has a store.
+func (m *Manager) Alerts(ctx context.Context, opts AlertsOpts) ([]Alert, error) {
+	if opts.Offset < 0 {
+		return nil, errors.New("offset can not be negative")
+	}
+
+	m.mu.Lock()
+	store := m.store
+	m.mu.Unlock()
+	if opts.Dismissed && store != nil {
+		return store.AlertHistory(ctx, opts)
+	}
+
+	alerts := make([]Alert, 0)
+	for _, a := range m.Active() {
+		if opts.Matches(a) {
+			alerts = append(alerts, a)
+		}
+	}
+	if opts.Offset >= len(alerts) {
+		return []Alert{}, nil
+	}
+	alerts = alerts[opts.Offset:]
+	if opts.Limit >= 0 && opts.Limit < len(alerts) {
+		alerts = alerts[:opts.Limit]
+	}
+	return alerts, nil
+}
+
+// Matches returns true if the given alert matches the severity and module
+// filters of the options.
+func (opts AlertsOpts) Matches(a Alert) bool {
+	if opts.Severity != 0 && a.Severity != opts.Severity {
+		return false
+	}
+	if opts.Module != "" {
+		origin, _ := a.Data["origin"].(string)
+		if origin != opts.Module && !strings.HasPrefix(origin, opts.Module+".") {
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterStore registers a store the manager persists alerts in. The active
+// alerts in the store are restored, dismissed alerts are kept in the store
+// for the given retention before they are pruned. Alerts that fail to be
+// persisted remain active and the error is logged with the given logger.
+func (m *Manager) RegisterStore(store Store, retention time.Duration, logger *zap.SugaredLogger) error {
+	if retention == 0 {
+		retention = DefaultRetention
+	}
+
+	m.mu.Lock()
+	if m.store != nil {
+		panic("store already registered") // developer error
+	}
+	m.store = store
+	m.retention = retention
+	m.logger = logger
+	m.mu.Unlock()
+
+	// persist the alerts that were registered before the store
+	ctx := context.Background()
+	for _, a := range m.Active() {
+		if err := store.AddAlert(ctx, a); err != nil {
+			return fmt.Errorf("failed to persist alert: %w", err)
+		}
+	}
+
+	// restore the active alerts and prune old ones
+	active, err := store.ActiveAlerts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch active alerts: %w", err)
+	} else if _, err := store.PruneAlerts(ctx, time.Now().Add(-retention)); err != nil {
+		return fmt.Errorf("failed to prune alerts: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range active {
+		if _, exists := m.alerts[a.ID]; !exists {
+			m.alerts[a.ID] = a
+		}
+	}
+	return nil
+}
+
 func (m *Manager) RegisterWebhookBroadcaster(b webhooks.Broadcaster) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
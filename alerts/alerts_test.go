@@ -3,7 +3,9 @@ package alerts
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"sync"
@@ -72,7 +74,7 @@ func TestWebhooks(t *testing.T) {
 		Module: webhookModule,
 		URL:    fmt.Sprintf("http://%v/events", srv.Listener.Addr().String()),
 	}
-	if hookID := wh.String(); hookID != fmt.Sprintf("%v.%v.%v", wh.URL, wh.Module, "") {
+	if hookID := wh.String(); hookID != fmt.Sprintf("%v.%v.%v.%v.%v", wh.URL, wh.Module, "", "", "") {
 		t.Fatalf("wrong result for wh.String(): %v != %v", wh.String(), hookID)
 	}
 	err = mgr.Register(wh)
@@ -169,3 +171,454 @@ func TestWebhooks(t *testing.T) {
 		t.Fatalf("wrong number of hooks listed: %v != 1", store.listed)
 	}
 }
+
+func TestWebhookSubscribers(t *testing.T) {
+	mgr, err := webhooks.NewManager(zap.NewNop().Sugar(), &testWebhookStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts := NewManager()
+	alerts.RegisterWebhookBroadcaster(mgr)
+
+	// subscribe to the manager's events
+	events, unsubscribe := mgr.Subscribe()
+
+	// raise and dismiss an alert
+	if err := alerts.RegisterAlert(context.Background(), Alert{
+		ID:        types.Hash256{1},
+		Message:   "test",
+		Severity:  SeverityWarning,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"origin": "foo",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	} else if err := alerts.DismissAlerts(context.Background(), types.Hash256{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the subscriber received both events
+	for _, expected := range []string{webhookEventRegister, webhookEventDismiss} {
+		select {
+		case event := <-events:
+			if event.Module != webhookModule || event.Event != expected {
+				t.Fatal("unexpected event", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("missing event", expected)
+		}
+	}
+
+	// assert the channel is closed after unsubscribing
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Fatal("expected channel to be closed")
+	}
+	unsubscribe() // no-op
+
+	// assert closing the manager closes the channels of all subscribers
+	events, _ = mgr.Subscribe()
+	if err := mgr.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := <-events; ok {
+		t.Fatal("expected channel to be closed")
+	}
+}
+
+func TestWebhookFiltersAndSignatures(t *testing.T) {
+	mgr, err := webhooks.NewManager(zap.NewNop().Sugar(), &testWebhookStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+	alerts := NewManager()
+	alerts.RegisterWebhookBroadcaster(mgr)
+
+	type delivery struct {
+		event webhooks.Event
+		key   string
+		valid bool
+	}
+	const secret = "foo"
+	deliveries := make(chan delivery, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var event webhooks.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Error(err)
+			return
+		}
+		deliveries <- delivery{
+			event: event,
+			key:   r.Header.Get(webhooks.HeaderIdempotencyKey),
+			valid: webhooks.VerifySignature(secret, r.Header.Get(webhooks.HeaderTimestamp), body, r.Header.Get(webhooks.HeaderSignature)),
+		}
+	}))
+	defer srv.Close()
+
+	// assert malformed patterns are rejected
+	if err := mgr.Register(webhooks.Webhook{Module: "[", URL: srv.URL}); !errors.Is(err, webhooks.ErrInvalidPattern) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// register a signed hook that only matches dismissals
+	if err := mgr.Register(webhooks.Webhook{
+		Module: "al*",
+		Event:  "dis*",
+		URL:    srv.URL,
+		Secret: secret,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ping := <-deliveries
+	if ping.event.Event != webhooks.WebhookEventPing || !ping.valid || ping.key == "" {
+		t.Fatal("unexpected ping", ping)
+	}
+
+	// raise and dismiss an alert
+	if err := alerts.RegisterAlert(context.Background(), Alert{
+		ID:        types.Hash256{1},
+		Message:   "test",
+		Severity:  SeverityWarning,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"origin": "foo",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	} else if err := alerts.DismissAlerts(context.Background(), types.Hash256{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert only the dismissal was delivered and that it was signed
+	select {
+	case d := <-deliveries:
+		if d.event.Event != webhookEventDismiss {
+			t.Fatal("unexpected event", d.event)
+		} else if !d.valid {
+			t.Fatal("invalid signature")
+		} else if d.key == "" || d.key == ping.key {
+			t.Fatal("unexpected idempotency key", d.key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("missing delivery")
+	}
+	select {
+	case d := <-deliveries:
+		t.Fatal("unexpected delivery", d.event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// assert a tampered body doesn't verify
+	timestamp := "1"
+	if !webhooks.VerifySignature(secret, timestamp, []byte("foo"), webhooks.Sign(secret, timestamp, []byte("foo"))) {
+		t.Fatal("expected signature to verify")
+	} else if webhooks.VerifySignature(secret, timestamp, []byte("bar"), webhooks.Sign(secret, timestamp, []byte("foo"))) {
+		t.Fatal("expected signature not to verify")
+	}
+}
+
+type testAlertStore struct {
+	mu     sync.Mutex
+	alerts map[types.Hash256]Alert
+	err    error // returned by AddAlert if set
+}
+
+func (s *testAlertStore) ActiveAlerts(_ context.Context) (active []Alert, _ error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.alerts {
+		if a.DismissedAt == nil {
+			active = append(active, a)
+		}
+	}
+	return
+}
+
+func (s *testAlertStore) AlertHistory(_ context.Context, opts AlertsOpts) (history []Alert, _ error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.alerts {
+		if opts.Matches(a) {
+			history = append(history, a)
+		}
+	}
+	return
+}
+
+func (s *testAlertStore) AddAlert(_ context.Context, a Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.alerts[a.ID] = a
+	return nil
+}
+
+func (s *testAlertStore) MarkAlertsDismissed(_ context.Context, dismissedAt time.Time, ids ...types.Hash256) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if a, ok := s.alerts[id]; ok {
+			a.DismissedAt = &dismissedAt
+			s.alerts[id] = a
+		}
+	}
+	return nil
+}
+
+func (s *testAlertStore) PruneAlerts(_ context.Context, dismissedBefore time.Time) (pruned int64, _ error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, a := range s.alerts {
+		if a.DismissedAt != nil && a.DismissedAt.Before(dismissedBefore) {
+			delete(s.alerts, id)
+			pruned++
+		}
+	}
+	return
+}
+
+func TestAlertStore(t *testing.T) {
+	newAlert := func(id byte, severity Severity, origin string) Alert {
+		return Alert{
+			ID:        types.Hash256{id},
+			Severity:  severity,
+			Message:   "test",
+			Data:      map[string]any{"origin": origin},
+			Timestamp: time.Now().Add(time.Duration(id) * time.Second),
+		}
+	}
+
+	// register an alert before the store is registered and restore one from
+	// the store
+	store := &testAlertStore{alerts: make(map[types.Hash256]Alert)}
+	store.alerts[types.Hash256{1}] = newAlert(1, SeverityInfo, "bus")
+	mgr := NewManager()
+	if err := mgr.RegisterAlert(context.Background(), newAlert(2, SeverityCritical, "autopilot.autopilot")); err != nil {
+		t.Fatal(err)
+	} else if err := mgr.RegisterStore(store, time.Hour, zap.NewNop().Sugar()); err != nil {
+		t.Fatal(err)
+	} else if len(mgr.Active()) != 2 {
+		t.Fatal("unexpected number of active alerts", len(mgr.Active()))
+	} else if len(store.alerts) != 2 {
+		t.Fatal("unexpected number of persisted alerts", len(store.alerts))
+	}
+
+	// assert new alerts are persisted and active alerts can be filtered
+	if err := mgr.RegisterAlert(context.Background(), newAlert(3, SeverityCritical, "worker.worker")); err != nil {
+		t.Fatal(err)
+	} else if len(store.alerts) != 3 {
+		t.Fatal("alert wasn't persisted")
+	}
+
+	// assert an alert that fails to be persisted is still active
+	store.mu.Lock()
+	store.err = errors.New("failed")
+	store.mu.Unlock()
+	if err := mgr.RegisterAlert(context.Background(), newAlert(4, SeverityWarning, "bus")); err != nil {
+		t.Fatal(err)
+	} else if len(mgr.Active()) != 4 {
+		t.Fatal("unexpected number of active alerts", len(mgr.Active()))
+	} else if _, exists := store.alerts[types.Hash256{4}]; exists {
+		t.Fatal("alert shouldn't be persisted")
+	}
+	store.mu.Lock()
+	store.err = nil
+	store.mu.Unlock()
+	if err := mgr.DismissAlerts(context.Background(), types.Hash256{4}); err != nil {
+		t.Fatal(err)
+	}
+	if as, err := mgr.Alerts(context.Background(), AlertsOpts{Severity: SeverityCritical, Limit: -1}); err != nil {
+		t.Fatal(err)
+	} else if len(as) != 2 || as[0].ID != (types.Hash256{3}) || as[1].ID != (types.Hash256{2}) {
+		t.Fatal("unexpected alerts", as)
+	} else if as, err := mgr.Alerts(context.Background(), AlertsOpts{Module: "autopilot", Limit: -1}); err != nil {
+		t.Fatal(err)
+	} else if len(as) != 1 || as[0].ID != (types.Hash256{2}) {
+		t.Fatal("unexpected alerts", as)
+	} else if as, err := mgr.Alerts(context.Background(), AlertsOpts{Offset: 1, Limit: 1}); err != nil {
+		t.Fatal(err)
+	} else if len(as) != 1 || as[0].ID != (types.Hash256{2}) {
+		t.Fatal("unexpected alerts", as)
+	}
+
+	// assert dismissed alerts are kept in the history
+	if err := mgr.DismissAlerts(context.Background(), types.Hash256{1}); err != nil {
+		t.Fatal(err)
+	} else if as, err := mgr.Alerts(context.Background(), AlertsOpts{Limit: -1}); err != nil {
+		t.Fatal(err)
+	} else if len(as) != 2 {
+		t.Fatal("unexpected number of active alerts", len(as))
+	} else if as, err := mgr.Alerts(context.Background(), AlertsOpts{Dismissed: true, Limit: -1}); err != nil {
+		t.Fatal(err)
+	} else if len(as) != 3 {
+		t.Fatal("unexpected number of alerts", len(as))
+	} else if store.alerts[types.Hash256{1}].DismissedAt == nil {
+		t.Fatal("alert wasn't marked as dismissed")
+	}
+
+	// assert alerts dismissed before the retention window are pruned
+	dismissedAt := time.Now().Add(-2 * time.Hour)
+	store.alerts[types.Hash256{1}] = Alert{ID: types.Hash256{1}, DismissedAt: &dismissedAt}
+	if err := mgr.DismissAlerts(context.Background(), types.Hash256{2}); err != nil {
+		t.Fatal(err)
+	} else if _, exists := store.alerts[types.Hash256{1}]; exists {
+		t.Fatal("alert wasn't pruned")
+	} else if _, exists := store.alerts[types.Hash256{2}]; !exists {
+		t.Fatal("alert was pruned")
+	}
+}
+
+func TestAlertAggregation(t *testing.T) {
+	mgr, err := webhooks.NewManager(zap.NewNop().Sugar(), &testWebhookStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+	alerts := NewManager()
+	alerts.RegisterWebhookBroadcaster(mgr)
+
+	deliveries := make(chan webhooks.Event, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhooks.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Error(err)
+			return
+		}
+		deliveries <- event
+	}))
+	defer srv.Close()
+
+	// assert unknown severities are rejected
+	if err := mgr.Register(webhooks.Webhook{Module: webhookModule, URL: srv.URL, MinSeverity: "foo"}); !errors.Is(err, webhooks.ErrInvalidMinSeverity) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// register a hook that only receives critical events
+	if err := mgr.Register(webhooks.Webhook{Module: webhookModule, URL: srv.URL, MinSeverity: "critical"}); err != nil {
+		t.Fatal(err)
+	} else if ping := <-deliveries; ping.Event != webhooks.WebhookEventPing {
+		t.Fatal("unexpected ping", ping)
+	}
+	events, unsubscribe := mgr.Subscribe()
+	defer unsubscribe()
+
+	// register the same alert a couple of times
+	start := time.Now().Round(time.Second)
+	register := func(severity Severity, ts time.Time) {
+		t.Helper()
+		if err := alerts.RegisterAlert(context.Background(), Alert{
+			ID:        types.Hash256{1},
+			Message:   "test",
+			Severity:  severity,
+			Timestamp: ts,
+			Data:      map[string]any{"origin": "foo"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	register(SeverityWarning, start)
+	register(SeverityWarning, start.Add(time.Minute))
+	register(SeverityWarning, start.Add(2*time.Minute))
+
+	// assert the alert was aggregated
+	active := alerts.Active()
+	if len(active) != 1 {
+		t.Fatal("unexpected number of alerts", len(active))
+	} else if active[0].Count != 3 {
+		t.Fatal("unexpected count", active[0].Count)
+	} else if !active[0].Timestamp.Equal(start) || !active[0].LastSeen.Equal(start.Add(2*time.Minute)) {
+		t.Fatal("unexpected timestamps", active[0].Timestamp, active[0].LastSeen)
+	}
+
+	// assert only the first registration was broadcast
+	if event := <-events; event.Event != webhookEventRegister || event.Severity != severityWarningStr {
+		t.Fatal("unexpected event", event)
+	}
+	select {
+	case event := <-events:
+		t.Fatal("unexpected event", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// escalate the alert and dismiss it
+	register(SeverityCritical, start.Add(3*time.Minute))
+	if err := alerts.DismissAlerts(context.Background(), types.Hash256{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the escalation and dismissal were delivered to the hook
+	for _, expected := range []string{webhookEventRegister, webhookEventDismiss} {
+		select {
+		case event := <-deliveries:
+			if event.Event != expected || event.Severity != severityCriticalStr {
+				t.Fatal("unexpected event", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("missing delivery", expected)
+		}
+	}
+	select {
+	case event := <-deliveries:
+		t.Fatal("unexpected delivery", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAlertAggregationConcurrent(t *testing.T) {
+	store := &testAlertStore{alerts: make(map[types.Hash256]Alert)}
+	alerts := NewManager()
+	if err := alerts.RegisterStore(store, time.Hour, zap.NewNop().Sugar()); err != nil {
+		t.Fatal(err)
+	}
+
+	// register the same alert from multiple goroutines
+	const threads, registrations = 10, 50
+	start := time.Now().Round(time.Second)
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < registrations; j++ {
+				if err := alerts.RegisterAlert(context.Background(), Alert{
+					ID:        types.Hash256{1},
+					Message:   "test",
+					Severity:  SeverityWarning,
+					Timestamp: start.Add(time.Duration(i*registrations+j) * time.Second),
+					Data:      map[string]any{"origin": "foo"},
+				}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// assert no registration was lost
+	lastSeen := start.Add((threads*registrations - 1) * time.Second)
+	active := alerts.Active()
+	if len(active) != 1 {
+		t.Fatal("unexpected number of alerts", len(active))
+	} else if active[0].Count != threads*registrations {
+		t.Fatal("unexpected count", active[0].Count)
+	} else if !active[0].Timestamp.Equal(start) || !active[0].LastSeen.Equal(lastSeen) {
+		t.Fatal("unexpected timestamps", active[0].Timestamp, active[0].LastSeen)
+	}
+
+	// assert the persisted alert is the most recent version
+	store.mu.Lock()
+	persisted := store.alerts[types.Hash256{1}]
+	store.mu.Unlock()
+	if persisted.Count != threads*registrations {
+		t.Fatal("unexpected persisted count", persisted.Count)
+	}
+}
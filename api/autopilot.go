@@ -3,11 +3,13 @@ package api
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/object"
 )
 
 const (
@@ -23,9 +25,44 @@ var (
 	// ErrAutopilotNotFound is returned when an autopilot can't be found.
 	ErrAutopilotNotFound = errors.New("couldn't find autopilot")
 
+	// ErrAutopilotProfileNotFound is returned when an autopilot config
+	// profile can't be found.
+	ErrAutopilotProfileNotFound = errors.New("couldn't find autopilot profile")
+
 	// ErrMaxDowntimeHoursTooHigh is returned if the autopilot config is updated
 	// with a value that exceeds the maximum of 99 years.
 	ErrMaxDowntimeHoursTooHigh = errors.New("MaxDowntimeHours is too high, exceeds max value of 99 years")
+
+	// ErrMaxHostsPerTagValueZero is returned if the autopilot config is
+	// updated with a host limit of zero for a tag.
+	ErrMaxHostsPerTagValueZero = errors.New("MaxHostsPerTagValue must be greater than 0")
+
+	// ErrInvalidSLAAlertThreshold is returned if the autopilot config is
+	// updated with an SLA alert threshold outside of the range [0, 1].
+	ErrInvalidSLAAlertThreshold = errors.New("SLA alert threshold must be between 0 and 1")
+
+	// ErrInvalidRebalanceThreshold is returned if the autopilot config is
+	// updated with a rebalance threshold that is neither zero nor greater
+	// than 1.
+	ErrInvalidRebalanceThreshold = errors.New("rebalance threshold must be 0 or greater than 1")
+
+	// ErrInvalidEndHeightBuckets is returned if the autopilot config is
+	// updated with more end height buckets than there are blocks in the
+	// period.
+	ErrInvalidEndHeightBuckets = errors.New("number of end height buckets can't exceed the period")
+
+	// ErrInvalidIPFilterPrefix is returned if the autopilot config is updated
+	// with an IP filter prefix that exceeds the length of the address.
+	ErrInvalidIPFilterPrefix = errors.New("IP filter prefix exceeds the address length")
+
+	// ErrInvalidHostScoreWeight is returned if the autopilot config is
+	// updated with a negative host score weight.
+	ErrInvalidHostScoreWeight = errors.New("host score weights must not be negative")
+
+	// ErrInvalidDefragThreshold is returned if the autopilot config is
+	// updated with a defrag threshold that doesn't exceed the number of
+	// outputs the wallet is consolidated into.
+	ErrInvalidDefragThreshold = errors.New("defrag threshold must exceed the number of defrag outputs")
 )
 
 type (
@@ -34,6 +71,17 @@ type (
 		ID            string          `json:"id"`
 		Config        AutopilotConfig `json:"config"`
 		CurrentPeriod uint64          `json:"currentPeriod"`
+
+		// Profile is the name of the config profile that was last activated,
+		// it is reset when the config is updated directly.
+		Profile string `json:"profile,omitempty"`
+	}
+
+	// AutopilotProfile is a named autopilot config that can be activated on
+	// an autopilot, e.g. "cheap-archive" or "performance".
+	AutopilotProfile struct {
+		Name   string          `json:"name"`
+		Config AutopilotConfig `json:"config"`
 	}
 
 	// AutopilotConfig contains all autopilot configuration.
@@ -41,6 +89,10 @@ type (
 		Contracts ContractsConfig `json:"contracts"`
 		Hosts     HostsConfig     `json:"hosts"`
 		Wallet    WalletConfig    `json:"wallet"`
+		SLA       SLAConfig       `json:"sla"`
+		Rebalance RebalanceConfig `json:"rebalance"`
+
+		RestoreDrill RestoreDrillConfig `json:"restoreDrill"`
 	}
 
 	// ContractsConfig contains all contract settings used in the autopilot.
@@ -53,18 +105,110 @@ type (
 		Download    uint64         `json:"download"`
 		Upload      uint64         `json:"upload"`
 		Storage     uint64         `json:"storage"`
+
+		// TargetCapacity, if set, is the amount of usable storage in bytes
+		// the contract set should be able to hold, the autopilot then
+		// derives the number of contracts from the remaining storage of the
+		// hosts instead of using Amount.
+		TargetCapacity uint64 `json:"targetCapacity,omitempty"`
+
+		// EndHeightBuckets, if greater than one, ladders the end heights of
+		// the contracts across the period. Every host is assigned to one of
+		// the buckets and its contracts end that bucket's share of the period
+		// later, spreading out renewals, fees and proof windows over time.
+		EndHeightBuckets uint64 `json:"endHeightBuckets,omitempty"`
 	}
 
 	// HostsConfig contains all hosts settings used in the autopilot.
 	HostsConfig struct {
-		AllowRedundantIPs bool                        `json:"allowRedundantIPs"`
-		MaxDowntimeHours  uint64                      `json:"maxDowntimeHours"`
-		ScoreOverrides    map[types.PublicKey]float64 `json:"scoreOverrides"`
+		AllowRedundantIPs   bool                        `json:"allowRedundantIPs"`
+		MaxDowntimeHours    uint64                      `json:"maxDowntimeHours"`
+		MaxHostsPerTagValue map[string]uint64           `json:"maxHostsPerTagValue,omitempty"`
+		ScoreOverrides      map[types.PublicKey]float64 `json:"scoreOverrides"`
+		ScoreWeights        HostScoreWeights            `json:"scoreWeights"`
+		IPFilter            IPFilterConfig              `json:"ipFilter"`
+
+		// MissedProofPenaltyHours is the number of hours a host's score is
+		// penalized after it failed to submit a storage proof for one of our
+		// contracts, it defaults to 30 days.
+		MissedProofPenaltyHours uint64 `json:"missedProofPenaltyHours,omitempty"`
+
+		// InteractionsHalfLifeHours is the number of hours after which an
+		// interaction with a host counts half as much towards its interactions
+		// score, it defaults to 7 days. That way hosts recover from failed
+		// interactions once they fixed their issues.
+		InteractionsHalfLifeHours uint64 `json:"interactionsHalfLifeHours,omitempty"`
+
+		// PreferredHosts are hosts that are always included in the contract
+		// set as long as they are reachable and not gouging, they bypass the
+		// scoring and redundancy checks and are never truncated from the set.
+		// This is useful for users that run their own hosts.
+		PreferredHosts []types.PublicKey `json:"preferredHosts,omitempty"`
+	}
+
+	// IPFilterConfig configures how the autopilot enforces IP diversity when
+	// AllowRedundantIPs is disabled. Two hosts share a subnet if the given
+	// number of leading bits of their IPs match. Zero values fall back to the
+	// defaults of a /24 for IPv4, a /32 for IPv6 and a single host per subnet.
+	IPFilterConfig struct {
+		IPv4Prefix        uint8  `json:"ipv4Prefix,omitempty"`
+		IPv6Prefix        uint8  `json:"ipv6Prefix,omitempty"`
+		MaxHostsPerSubnet uint64 `json:"maxHostsPerSubnet,omitempty"`
+	}
+
+	// HostScoreWeights contains the weights of the individual components of
+	// a host's score. Every component is raised to the power of its weight
+	// before the components are multiplied. Weights that are omitted default
+	// to 1, a weight of 0 disables the component.
+	HostScoreWeights struct {
+		Age              *float64 `json:"age,omitempty"`
+		Collateral       *float64 `json:"collateral,omitempty"`
+		Interactions     *float64 `json:"interactions,omitempty"`
+		Performance      *float64 `json:"performance,omitempty"`
+		Prices           *float64 `json:"prices,omitempty"`
+		StorageRemaining *float64 `json:"storageRemaining,omitempty"`
+		Uptime           *float64 `json:"uptime,omitempty"`
+		Version          *float64 `json:"version,omitempty"`
+	}
+
+	// SLAConfig contains all storage SLA settings used in the autopilot.
+	SLAConfig struct {
+		// AlertThreshold is the SLA score below which the autopilot registers
+		// an alert, a threshold of zero disables the alert.
+		AlertThreshold float64 `json:"alertThreshold"`
+	}
+
+	// RebalanceConfig contains the settings of the rebalancer, which moves
+	// slabs off of hosts that store a disproportionate share of the data.
+	RebalanceConfig struct {
+		// Threshold is the factor by which a contract's size has to exceed
+		// the average size of the contracts in the set for its host to be
+		// considered overloaded, a threshold of zero disables rebalancing.
+		Threshold float64 `json:"threshold"`
+
+		// MaxSlabs is the maximum number of slabs the rebalancer migrates
+		// every autopilot iteration.
+		MaxSlabs uint64 `json:"maxSlabs"`
+	}
+
+	// RestoreDrillConfig contains the settings of the restore drill, which
+	// periodically downloads random objects to prove they are restorable.
+	RestoreDrillConfig struct {
+		// Objects is the number of random objects that are downloaded and
+		// verified every drill, zero disables the drill. The drill runs in
+		// the background at most once every few hours.
+		Objects uint64 `json:"objects"`
 	}
 
 	// WalletConfig contains all wallet settings used in the autopilot.
 	WalletConfig struct {
+		// DefragThreshold is the number of spendable outputs above which the
+		// wallet's smallest outputs are consolidated, zero disables it.
 		DefragThreshold uint64 `json:"defragThreshold"`
+
+		// DefragOutputs is the number of outputs the smallest outputs are
+		// consolidated into, if zero it defaults to the number of contracts.
+		DefragOutputs uint64 `json:"defragOutputs"`
 	}
 )
 
@@ -81,6 +225,104 @@ type (
 		Triggered bool `json:"triggered"`
 	}
 
+	// ContractRootsDiff is the response type for the
+	// /contract/:id/roots/reconcile endpoint, it contains the roots the host
+	// is missing and the roots the host stores that we don't know about.
+	ContractRootsDiff struct {
+		Missing []types.Hash256 `json:"missing"`
+		Unknown []types.Hash256 `json:"unknown"`
+	}
+
+	// SLAResponse is the response type for the /sla endpoint, it contains the
+	// overall storage SLA score and the components it was computed from.
+	SLAResponse struct {
+		Score      float64             `json:"score"`
+		Breakdown  SLAScoreBreakdown   `json:"breakdown"`
+		Contracts  SLAContracts        `json:"contracts"`
+		HostUptime SLAHostUptime       `json:"hostUptime"`
+		SlabHealth SlabHealthHistogram `json:"slabHealth"`
+		Migrations SLAMigrations       `json:"migrations"`
+	}
+
+	// SLAScoreBreakdown contains the scores of the individual components of
+	// the SLA score, all scores are in the range [0, 1].
+	SLAScoreBreakdown struct {
+		Contracts  float64 `json:"contracts"`
+		HostUptime float64 `json:"hostUptime"`
+		SlabHealth float64 `json:"slabHealth"`
+		Migrations float64 `json:"migrations"`
+	}
+
+	// SLAContracts contains the number of contracts in the contract set and
+	// the number of contracts the autopilot is configured to form.
+	SLAContracts struct {
+		Active uint64 `json:"active"`
+		Target uint64 `json:"target"`
+	}
+
+	// SLAHostUptime contains the uptime distribution of the hosts in the
+	// contract set, uptimes are expressed as ratios in the range [0, 1].
+	SLAHostUptime struct {
+		Min float64 `json:"min"`
+		P10 float64 `json:"p10"`
+		P50 float64 `json:"p50"`
+		P90 float64 `json:"p90"`
+	}
+
+	// SLAMigrations contains the number of successful and failed slab
+	// migrations within the recent migration window.
+	SLAMigrations struct {
+		Succeeded uint64     `json:"succeeded"`
+		Failed    uint64     `json:"failed"`
+		Window    DurationMS `json:"window"`
+	}
+
+	// MigrationsResponse is the response type for the /migrations endpoint,
+	// it contains the outcome of the slab migrations performed by the
+	// migrator within the recent migration window.
+	MigrationsResponse struct {
+		Migrating bool       `json:"migrating"`
+		Succeeded uint64     `json:"succeeded"`
+		Failed    uint64     `json:"failed"`
+		Window    DurationMS `json:"window"`
+
+		// Recent contains the outcome of the most recent migrations, most
+		// recent first.
+		Recent []MigrationOutcome `json:"recent"`
+	}
+
+	// MigrationOutcome describes the outcome of migrating a single slab.
+	MigrationOutcome struct {
+		Key            object.EncryptionKey `json:"key"`
+		Bucket         string               `json:"bucket"`
+		Health         float64              `json:"health"`
+		ShardsMigrated int                  `json:"shardsMigrated"`
+		Duration       DurationMS           `json:"duration"`
+		Error          string               `json:"error,omitempty"`
+		Timestamp      TimeRFC3339          `json:"timestamp"`
+	}
+
+	// RestoreDrillResponse is the response type for the /restoredrill
+	// endpoint, it contains the outcome of the restores performed by the
+	// restore drill within the recent window.
+	RestoreDrillResponse struct {
+		Succeeded   uint64     `json:"succeeded"`
+		Failed      uint64     `json:"failed"`
+		SuccessRate float64    `json:"successRate"`
+		Window      DurationMS `json:"window"`
+
+		// Latency contains the distribution of the time it took to restore
+		// the objects that were restored successfully.
+		Latency RestoreDrillLatency `json:"latency"`
+	}
+
+	// RestoreDrillLatency contains the distribution of restore latencies.
+	RestoreDrillLatency struct {
+		P50 DurationMS `json:"p50"`
+		P90 DurationMS `json:"p90"`
+		Max DurationMS `json:"max"`
+	}
+
 	// AutopilotStateResponse is the response type for the /autopilot/state
 	// endpoint.
 	AutopilotStateResponse struct {
@@ -94,6 +336,35 @@ type (
 		StartTime time.Time `json:"startTime"`
 		BuildState
 	}
+
+	// AutopilotStatusResponse is the response type for the /autopilot/status
+	// endpoint.
+	AutopilotStatusResponse struct {
+		Loops  map[string]AutopilotLoopStatus `json:"loops"`
+		Budget *AutopilotBudget               `json:"budget,omitempty"`
+	}
+
+	// AutopilotBudget describes how much of the allowance was spent in the
+	// current period as of the most recent contract maintenance.
+	AutopilotBudget struct {
+		Allowance types.Currency `json:"allowance"`
+		Spent     types.Currency `json:"spent"`
+		Remaining types.Currency `json:"remaining"`
+		Period    uint64         `json:"period"`
+		UpdatedAt TimeRFC3339    `json:"updatedAt"`
+	}
+
+	// AutopilotLoopStatus describes the most recent run of one of the
+	// autopilot's loops along with the time of its next scheduled run.
+	AutopilotLoopStatus struct {
+		Running      bool              `json:"running"`
+		LastStart    TimeRFC3339       `json:"lastStart"`
+		LastEnd      TimeRFC3339       `json:"lastEnd"`
+		LastDuration DurationMS        `json:"lastDuration"`
+		LastError    string            `json:"lastError,omitempty"`
+		Changes      map[string]uint64 `json:"changes,omitempty"`
+		NextRun      TimeRFC3339       `json:"nextRun"`
+	}
 )
 
 type (
@@ -112,6 +383,37 @@ type (
 		UnusableReasons  []string             `json:"unusableReasons"`
 	}
 
+	// HostScoreResponse is the response type for the
+	// /hosts/:hostkey/score endpoint.
+	HostScoreResponse struct {
+		HostKey         types.PublicKey    `json:"hostKey"`
+		Score           float64            `json:"score"`
+		MinScore        float64            `json:"minScore"`
+		Breakdown       HostScoreBreakdown `json:"breakdown"`
+		Usable          bool               `json:"usable"`
+		UnusableReasons []string           `json:"unusableReasons"`
+	}
+
+	// AutopilotPlanRequest is the request type for the /plan endpoint. If a
+	// profile is given its config is evaluated, otherwise the given config is
+	// evaluated and if neither is set the current config is used.
+	AutopilotPlanRequest struct {
+		Profile string           `json:"profile,omitempty"`
+		Config  *AutopilotConfig `json:"config,omitempty"`
+	}
+
+	// AutopilotPlanResponse is the response type for the /plan endpoint. It
+	// estimates the impact of applying a config without changing anything.
+	AutopilotPlanResponse struct {
+		Profile          string                            `json:"profile,omitempty"`
+		MinScore         float64                           `json:"minScore"`
+		UsableHosts      uint64                            `json:"usableHosts"`
+		UnusableHosts    uint64                            `json:"unusableHosts"`
+		KeptContracts    []types.FileContractID            `json:"keptContracts"`
+		DroppedContracts map[types.FileContractID][]string `json:"droppedContracts"`
+		MissingContracts uint64                            `json:"missingContracts"`
+	}
+
 	HostGougingBreakdown struct {
 		V2 GougingChecks `json:"v2"`
 		V3 GougingChecks `json:"v3"`
@@ -132,11 +434,23 @@ type (
 		Uptime           float64 `json:"uptime"`
 		Version          float64 `json:"version"`
 		Prices           float64 `json:"prices"`
+
+		// Manual is the factor by which the operator adjusted the host's
+		// score through the host's score modifier.
+		Manual float64 `json:"manual"`
+
+		// MissedProofs is the penalty applied to hosts that recently failed
+		// to submit a storage proof for one of our contracts.
+		MissedProofs float64 `json:"missedProofs"`
+
+		// Performance reflects the upload and download speeds and latencies
+		// the workers observed when transferring data to and from the host.
+		Performance float64 `json:"performance"`
 	}
 )
 
 func (sb HostScoreBreakdown) String() string {
-	return fmt.Sprintf("Age: %v, Col: %v, Int: %v, SR: %v, UT: %v, V: %v, Pr: %v", sb.Age, sb.Collateral, sb.Interactions, sb.StorageRemaining, sb.Uptime, sb.Version, sb.Prices)
+	return fmt.Sprintf("Age: %v, Col: %v, Int: %v, SR: %v, UT: %v, V: %v, Pr: %v, M: %v, MP: %v, Perf: %v", sb.Age, sb.Collateral, sb.Interactions, sb.StorageRemaining, sb.Uptime, sb.Version, sb.Prices, sb.Manual, sb.MissedProofs, sb.Performance)
 }
 
 func (hgb HostGougingBreakdown) Gouging() bool {
@@ -184,13 +498,57 @@ func (hgb HostGougingBreakdown) Reasons() string {
 	return strings.Join(reasons, ";")
 }
 
+// Outputs returns the number of outputs the wallet's smallest outputs are
+// consolidated into, it defaults to the given number of contracts.
+func (w WalletConfig) Outputs(contracts uint64) uint64 {
+	if w.DefragOutputs == 0 {
+		return contracts
+	}
+	return w.DefragOutputs
+}
+
 func (sb HostScoreBreakdown) Score() float64 {
-	return sb.Age * sb.Collateral * sb.Interactions * sb.StorageRemaining * sb.Uptime * sb.Version * sb.Prices
+	return sb.Age * sb.Collateral * sb.Interactions * sb.StorageRemaining * sb.Uptime * sb.Version * sb.Prices * sb.Manual * sb.MissedProofs * sb.Performance
 }
 
 func (c AutopilotConfig) Validate() error {
 	if c.Hosts.MaxDowntimeHours > 99*365*24 {
 		return ErrMaxDowntimeHoursTooHigh
 	}
+	if c.SLA.AlertThreshold < 0 || c.SLA.AlertThreshold > 1 {
+		return ErrInvalidSLAAlertThreshold
+	}
+	if c.Rebalance.Threshold != 0 && c.Rebalance.Threshold <= 1 {
+		return ErrInvalidRebalanceThreshold
+	}
+	if c.Contracts.EndHeightBuckets > c.Contracts.Period {
+		return ErrInvalidEndHeightBuckets
+	}
+	if c.Hosts.IPFilter.IPv4Prefix > 32 || c.Hosts.IPFilter.IPv6Prefix > 128 {
+		return ErrInvalidIPFilterPrefix
+	}
+	if err := c.Hosts.ScoreWeights.Validate(); err != nil {
+		return err
+	}
+	if c.Wallet.DefragThreshold > 0 && c.Wallet.DefragThreshold <= c.Wallet.Outputs(c.Contracts.Amount) {
+		return ErrInvalidDefragThreshold
+	}
+	for key, limit := range c.Hosts.MaxHostsPerTagValue {
+		if limit == 0 {
+			return fmt.Errorf("%w, tag '%s'", ErrMaxHostsPerTagValueZero, key)
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if any of the weights is negative.
+func (w HostScoreWeights) Validate() error {
+	for _, weight := range []*float64{w.Age, w.Collateral, w.Interactions, w.Performance, w.Prices, w.StorageRemaining, w.Uptime, w.Version} {
+		if weight == nil {
+			continue
+		} else if *weight < 0 || math.IsNaN(*weight) || math.IsInf(*weight, 0) {
+			return ErrInvalidHostScoreWeight
+		}
+	}
 	return nil
 }
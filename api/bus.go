@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -29,6 +31,15 @@ const (
 	UsabilityFilterModeUnusable = "unusable"
 
 	DefaultBucketName = "default"
+
+	// IdempotencyKeyHeader is the header used to pass an idempotency key to
+	// mutating bus endpoints. Replaying a request with the same key returns the
+	// original response instead of applying the request a second time.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader is set on responses that were replayed for a
+	// request carrying an idempotency key that was processed before.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
 )
 
 var (
@@ -56,10 +67,46 @@ var (
 	// from the database.
 	ErrContractSetNotFound = errors.New("couldn't find contract set")
 
+	// ErrDatabaseBusy is returned when database maintenance is requested
+	// while the database is handling a heavy write load.
+	ErrDatabaseBusy = errors.New("database is busy, try again later")
+
+	// ErrDatabaseMaintenanceRunning is returned when database maintenance is
+	// requested while it is already running.
+	ErrDatabaseMaintenanceRunning = errors.New("database maintenance is already running")
+
 	// ErrHostNotFound is returned when a host can't be retrieved from the
 	// database.
 	ErrHostNotFound = errors.New("host doesn't exist in hostdb")
 
+	// ErrIdempotencyKeyInUse is returned when a request carries an idempotency
+	// key that belongs to a request that is still being processed.
+	ErrIdempotencyKeyInUse = errors.New("a request with this idempotency key is still being processed")
+
+	// ErrIdempotencyKeyMismatch is returned when a request carries an
+	// idempotency key that was used before for a different request.
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key was used for a different request")
+
+	// ErrIdempotentResponseNotFound is returned when no response was recorded
+	// for an idempotency key or the recorded response has expired.
+	ErrIdempotentResponseNotFound = errors.New("idempotent response not found")
+
+	// ErrInvalidBlocklistEntry is returned when a blocklist entry is neither
+	// an address, a wildcard domain of the form '*.domain' nor a CIDR range.
+	ErrInvalidBlocklistEntry = errors.New("blocklist entry must be an address, a wildcard domain or a CIDR range")
+
+	// ErrInvalidHostTag is returned when a host tag is not of the form
+	// 'key:value'.
+	ErrInvalidHostTag = errors.New("host tag must be of the form 'key:value'")
+
+	// ErrInvalidHostScoreModifier is returned when a host's score modifier
+	// would result in a negative score.
+	ErrInvalidHostScoreModifier = errors.New("host score modifier must be at least -1")
+
+	// ErrInvalidObjectTTL is returned when a bucket policy has a negative
+	// object TTL.
+	ErrInvalidObjectTTL = errors.New("object TTL can't be negative")
+
 	// ErrMultipartUploadNotFound is returned if the specified multipart upload
 	// wasn't found.
 	ErrMultipartUploadNotFound = errors.New("multipart upload not found")
@@ -91,6 +138,18 @@ type BusStateResponse struct {
 	BuildState
 }
 
+// DatabaseMaintenanceStatus is the response type for the /system/database
+// endpoint.
+type DatabaseMaintenanceStatus struct {
+	Running    bool      `json:"running"`
+	Step       string    `json:"step,omitempty"`
+	Completed  int       `json:"completed"`
+	Total      int       `json:"total"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Error      string    `json:"error,omitempty"`
+}
+
 // ConsensusState holds the current blockheight and whether we are synced or not.
 type ConsensusState struct {
 	BlockHeight   uint64    `json:"blockHeight"`
@@ -98,9 +157,18 @@ type ConsensusState struct {
 	Synced        bool      `json:"synced"`
 }
 
+// ConsensusEvent is the response type for the /consensus/events endpoint, it
+// describes the consensus state after the chain tip changed. Reorg is set if
+// the block the subscriber knew about is no longer part of the chain.
+type ConsensusEvent struct {
+	ConsensusState
+	BlockID types.BlockID `json:"blockID"`
+	Reorg   bool          `json:"reorg"`
+}
+
 // ConsensusNetwork holds the name of the network.
 type ConsensusNetwork struct {
-	Name string
+	Name string `json:"name"`
 }
 
 // ContractsIDAddRequest is the request type for the /contract/:id endpoint.
@@ -170,6 +238,23 @@ type ContractPrunableData struct {
 	ContractSize
 }
 
+// ContractSectorDeletions contains the roots of the sectors that are queued
+// for deletion from a contract.
+type ContractSectorDeletions struct {
+	ContractID types.FileContractID `json:"contractID"`
+	Roots      []types.Hash256      `json:"roots"`
+}
+
+// IdempotentResponse is the recorded response to a request that carried an
+// idempotency key.
+type IdempotentResponse struct {
+	Fingerprint types.Hash256 `json:"fingerprint"`
+	Status      int           `json:"status"`
+	Header      http.Header   `json:"header"`
+	Body        []byte        `json:"body"`
+	Expiry      time.Time     `json:"expiry"`
+}
+
 type HostsScanRequest struct {
 	Scans []hostdb.HostScan `json:"scans"`
 }
@@ -213,6 +298,13 @@ type WalletSignRequest struct {
 	CoveredFields types.CoveredFields `json:"coveredFields"`
 }
 
+// WalletConsolidateRequest is the request type for the /wallet/consolidate
+// endpoint.
+type WalletConsolidateRequest struct {
+	MaxInputs int `json:"maxInputs"`
+	Outputs   int `json:"outputs"`
+}
+
 // WalletRedistributeRequest is the request type for the /wallet/redistribute
 // endpoint.
 type WalletRedistributeRequest struct {
@@ -295,8 +387,8 @@ type PackedSlab struct {
 }
 
 type UploadedPackedSlab struct {
-	BufferID uint
-	Shards   []object.Sector
+	BufferID uint            `json:"bufferID"`
+	Shards   []object.Sector `json:"shards"`
 }
 
 // UpdateSlabRequest is the request type for the /slab endpoint.
@@ -313,20 +405,198 @@ type UnhealthySlabsResponse struct {
 type UnhealthySlab struct {
 	Key    object.EncryptionKey `json:"key"`
 	Health float64              `json:"health"`
+	Bucket string               `json:"bucket,omitempty"`
+}
+
+// SlabsHealthResponse is the response type for the /slabs/health endpoint.
+type SlabsHealthResponse struct {
+	ContractSet string       `json:"contractSet"`
+	Slabs       []SlabHealth `json:"slabs"`
+}
+
+// SlabHealth describes the health of a slab with regards to a contract set,
+// good shards are the shards that are stored on contracts in that set.
+type SlabHealth struct {
+	Key         object.EncryptionKey `json:"key"`
+	Health      float64              `json:"health"`
+	GoodShards  int                  `json:"goodShards"`
+	MinShards   uint8                `json:"minShards"`
+	TotalShards uint8                `json:"totalShards"`
+}
+
+// ContractSlab is a slab with at least one sector stored on a contract, the
+// bucket is the bucket of the first object that references the slab.
+type ContractSlab struct {
+	Key    object.EncryptionKey `json:"key"`
+	Bucket string               `json:"bucket,omitempty"`
 }
 
 // UpdateAllowlistRequest is the request type for /hosts/allowlist endpoint.
+// Setting Clear together with Add replaces the allowlist atomically, when
+// DryRun is set the allowlist is not updated and the impact of the update is
+// returned instead.
 type UpdateAllowlistRequest struct {
 	Add    []types.PublicKey `json:"add"`
 	Remove []types.PublicKey `json:"remove"`
 	Clear  bool              `json:"clear"`
+	DryRun bool              `json:"dryRun,omitempty"`
+}
+
+// UpdateHostTagsRequest is the request type for /host/:hostkey/tags endpoint.
+type UpdateHostTagsRequest struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+	Clear  bool     `json:"clear"`
+}
+
+// UpdateHostNotesRequest is the request type for /host/:hostkey/notes
+// endpoint.
+type UpdateHostNotesRequest struct {
+	Notes         string  `json:"notes"`
+	ScoreModifier float64 `json:"scoreModifier"`
+}
+
+// Validate returns an error if the score modifier is invalid.
+func (r UpdateHostNotesRequest) Validate() error {
+	if r.ScoreModifier < -1 {
+		return fmt.Errorf("%w, got %v", ErrInvalidHostScoreModifier, r.ScoreModifier)
+	}
+	return nil
+}
+
+// Validate returns an error if any of the tags to add is invalid.
+func (r UpdateHostTagsRequest) Validate() error {
+	for _, tag := range r.Add {
+		if key, value, ok := strings.Cut(tag, ":"); !ok || key == "" || value == "" {
+			return fmt.Errorf("%w, got '%s'", ErrInvalidHostTag, tag)
+		}
+	}
+	return nil
 }
 
 // UpdateBlocklistRequest is the request type for /hosts/blocklist endpoint.
+// Setting Clear together with Add replaces the blocklist atomically, when
+// DryRun is set the blocklist is not updated and the impact of the update is
+// returned instead.
 type UpdateBlocklistRequest struct {
 	Add    []string `json:"add"`
 	Remove []string `json:"remove"`
 	Clear  bool     `json:"clear"`
+	DryRun bool     `json:"dryRun,omitempty"`
+}
+
+// Validate returns an error if any of the entries to add is not a valid
+// blocklist entry.
+func (r UpdateBlocklistRequest) Validate() error {
+	for _, entry := range r.Add {
+		if err := ValidateBlocklistEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateBlocklistEntry returns an error if the given entry is neither an
+// address, a wildcard domain of the form '*.domain' nor a CIDR range.
+func ValidateBlocklistEntry(entry string) error {
+	if _, ok := BlocklistRange(entry); ok {
+		return nil
+	} else if domain, ok := BlocklistWildcard(entry); ok && domain != "" && !strings.ContainsAny(domain, "*/") {
+		return nil
+	} else if entry != "" && !strings.ContainsAny(entry, "*/") {
+		return nil
+	}
+	return fmt.Errorf("%w, got '%s'", ErrInvalidBlocklistEntry, entry)
+}
+
+// BlocklistRange returns the IP range of the given blocklist entry if it is in
+// CIDR notation.
+func BlocklistRange(entry string) (*net.IPNet, bool) {
+	if !strings.Contains(entry, "/") {
+		return nil, false
+	}
+	_, ipnet, err := net.ParseCIDR(entry)
+	return ipnet, err == nil
+}
+
+// BlocklistWildcard returns the domain of the given blocklist entry if it is a
+// wildcard entry of the form '*.domain', such an entry blocks all subdomains
+// of the domain but not the domain itself.
+func BlocklistWildcard(entry string) (string, bool) {
+	return strings.CutPrefix(entry, "*.")
+}
+
+// HostListUpdateImpact is the response type for the /hosts/allowlist and
+// /hosts/blocklist endpoints when performing a dry run. It contains the number
+// of hosts that would change from allowed to blocked or vice versa and the
+// number of active contracts with those hosts.
+type HostListUpdateImpact struct {
+	Hosts     uint64 `json:"hosts"`
+	Contracts uint64 `json:"contracts"`
+}
+
+// KeyEscrowObject contains everything that is needed to recreate an object:
+// its encryption key, the slabs it consists of and its metadata.
+type KeyEscrowObject struct {
+	Bucket   string             `json:"bucket"`
+	Path     string             `json:"path"`
+	ETag     string             `json:"eTag,omitempty"`
+	MimeType string             `json:"mimeType,omitempty"`
+	ModTime  time.Time          `json:"modTime"`
+	Metadata ObjectUserMetadata `json:"metadata,omitempty"`
+
+	object.Object
+}
+
+// KeyEscrowExportRequest is the request type for the /system/keys/export
+// endpoint. The response is an age file that contains the encryption keys of
+// all objects, encrypted under the given passphrase.
+type KeyEscrowExportRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+// KeyEscrowImportRequest is the request type for the /system/keys/import
+// endpoint, the bundle is an age file as returned by the /system/keys/export
+// endpoint. Objects that no longer exist are recreated in the given contract
+// set, which defaults to the default contract set.
+type KeyEscrowImportRequest struct {
+	Passphrase  string `json:"passphrase"`
+	Bundle      []byte `json:"bundle"`
+	ContractSet string `json:"contractSet,omitempty"`
+}
+
+// KeyEscrowImportResponse is the response type for the /system/keys/import
+// endpoint. Restored is the number of objects whose key was restored from the
+// bundle, Recreated is the number of objects that no longer existed and were
+// recreated from the bundle and Unmatched is the number of objects in the
+// bundle that were changed since the bundle was exported, or that reference a
+// buffered slab that no longer exists.
+type KeyEscrowImportResponse struct {
+	Objects   uint64 `json:"objects"`
+	Restored  uint64 `json:"restored"`
+	Recreated uint64 `json:"recreated"`
+	Unmatched uint64 `json:"unmatched"`
+}
+
+// MaintenanceRequest is the request type for the /maintenance endpoint, a zero
+// duration enables the maintenance mode until it's disabled.
+type MaintenanceRequest struct {
+	Enabled  bool       `json:"enabled"`
+	Duration DurationMS `json:"duration"`
+	Reason   string     `json:"reason,omitempty"`
+}
+
+// MaintenanceResponse is the response type for the /maintenance endpoint.
+type MaintenanceResponse struct {
+	MaintenanceSettings
+	Active bool `json:"active"`
+}
+
+// HostAliasGroup contains hosts that are likely the same physical host
+// announced under different keys.
+type HostAliasGroup struct {
+	Group    types.Hash256     `json:"group"`
+	HostKeys []types.PublicKey `json:"hostKeys"`
 }
 
 // AccountsUpdateBalanceRequest is the request type for /accounts/:id/update
@@ -364,19 +634,26 @@ type PackedSlabsRequestPOST struct {
 
 // UploadParams contains the metadata needed by a worker to upload an object.
 type UploadParams struct {
-	CurrentHeight uint64
-	ContractSet   string
-	UploadPacking bool
+	CurrentHeight uint64              `json:"currentHeight"`
+	ContractSet   string              `json:"contractSet"`
+	Maintenance   MaintenanceSettings `json:"maintenance"`
+	UploadPacking bool                `json:"uploadPacking"`
 	GougingParams
 }
 
 // GougingParams contains the metadata needed by a worker to perform gouging
-// checks.
+// checks and to choose the hosts to download from.
 type GougingParams struct {
-	ConsensusState     ConsensusState
-	GougingSettings    GougingSettings
-	RedundancySettings RedundancySettings
-	TransactionFee     types.Currency
+	ConsensusState     ConsensusState     `json:"consensusState"`
+	DownloadSettings   DownloadSettings   `json:"downloadSettings"`
+	GougingSettings    GougingSettings    `json:"gougingSettings"`
+	RedundancySettings RedundancySettings `json:"redundancySettings"`
+	TransactionFee     types.Currency     `json:"transactionFee"`
+
+	// SettingsVersion is incremented by the bus every time a setting that
+	// makes up the gouging or upload params is updated or deleted, it allows
+	// for telling which settings were applied.
+	SettingsVersion uint64 `json:"settingsVersion"`
 }
 
 // Option types.
@@ -390,6 +667,25 @@ type (
 		Limit       int
 		Offset      int
 	}
+	ContractSpendingMetricsOptions struct {
+		From time.Time
+		To   time.Time
+	}
+	UploadStatsMetricsOptions struct {
+		From   time.Time
+		To     time.Time
+		Worker string
+	}
+	HostMetricsOptions struct {
+		From    time.Time
+		To      time.Time
+		HostKey types.PublicKey
+		Worker  string
+	}
+	AffectedObjectsOptions struct {
+		Offset int
+		Limit  int
+	}
 	SearchHostOptions struct {
 		AddressContains string
 		FilterMode      string
@@ -397,6 +693,12 @@ type (
 		Limit           int
 		Offset          int
 	}
+	SlabsHealthOptions struct {
+		ContractSet   string
+		UnhealthyOnly bool
+		Offset        int
+		Limit         int
+	}
 )
 
 func DefaultSearchHostOptions() SearchHostOptions {
@@ -427,17 +729,79 @@ func (opts HostsForScanningOptions) Apply(values url.Values) {
 	}
 }
 
+func (opts AffectedObjectsOptions) Apply(values url.Values) {
+	if opts.Offset != 0 {
+		values.Set("offset", fmt.Sprint(opts.Offset))
+	}
+	if opts.Limit != 0 {
+		values.Set("limit", fmt.Sprint(opts.Limit))
+	}
+}
+
+func (opts ContractSpendingMetricsOptions) Apply(values url.Values) {
+	if !opts.From.IsZero() {
+		values.Set("from", opts.From.Format(time.RFC3339))
+	}
+	if !opts.To.IsZero() {
+		values.Set("to", opts.To.Format(time.RFC3339))
+	}
+}
+
+func (opts UploadStatsMetricsOptions) Apply(values url.Values) {
+	if !opts.From.IsZero() {
+		values.Set("from", opts.From.Format(time.RFC3339))
+	}
+	if !opts.To.IsZero() {
+		values.Set("to", opts.To.Format(time.RFC3339))
+	}
+	if opts.Worker != "" {
+		values.Set("worker", opts.Worker)
+	}
+}
+
+func (opts HostMetricsOptions) Apply(values url.Values) {
+	if !opts.From.IsZero() {
+		values.Set("from", opts.From.Format(time.RFC3339))
+	}
+	if !opts.To.IsZero() {
+		values.Set("to", opts.To.Format(time.RFC3339))
+	}
+	if opts.HostKey != (types.PublicKey{}) {
+		values.Set("hostKey", opts.HostKey.String())
+	}
+	if opts.Worker != "" {
+		values.Set("worker", opts.Worker)
+	}
+}
+
+func (opts SlabsHealthOptions) Apply(values url.Values) {
+	if opts.ContractSet != "" {
+		values.Set("contractSet", opts.ContractSet)
+	}
+	if opts.UnhealthyOnly {
+		values.Set("unhealthy", "true")
+	}
+	if opts.Offset != 0 {
+		values.Set("offset", fmt.Sprint(opts.Offset))
+	}
+	if opts.Limit != 0 {
+		values.Set("limit", fmt.Sprint(opts.Limit))
+	}
+}
+
 // Types related to multipart uploads.
 type (
 	CreateMultipartOptions struct {
 		Key      object.EncryptionKey
 		MimeType string
+		Metadata ObjectUserMetadata
 	}
 	MultipartCreateRequest struct {
 		Bucket   string               `json:"bucket"`
 		Path     string               `json:"path"`
 		Key      object.EncryptionKey `json:"key"`
 		MimeType string               `json:"mimeType"`
+		Metadata ObjectUserMetadata   `json:"metadata,omitempty"`
 	}
 	MultipartCreateResponse struct {
 		UploadID string `json:"uploadID"`
@@ -448,10 +812,10 @@ type (
 		UploadID string `json:"uploadID"`
 	}
 	MultipartCompleteRequest struct {
-		Bucket   string `json:"bucket"`
-		Path     string `json:"path"`
-		UploadID string `json:"uploadID"`
-		Parts    []MultipartCompletedPart
+		Bucket   string                   `json:"bucket"`
+		Path     string                   `json:"path"`
+		UploadID string                   `json:"uploadID"`
+		Parts    []MultipartCompletedPart `json:"parts"`
 	}
 	MultipartCompletedPart struct {
 		PartNumber int    `json:"partNumber"`
@@ -474,11 +838,13 @@ type (
 	MultipartListUploadsRequest struct {
 		Bucket         string `json:"bucket"`
 		Prefix         string `json:"prefix"`
+		Delimiter      string `json:"delimiter,omitempty"`
 		PathMarker     string `json:"pathMarker"`
 		UploadIDMarker string `json:"uploadIDMarker"`
 		Limit          int    `json:"limit"`
 	}
 	MultipartListUploadsResponse struct {
+		CommonPrefixes     []string          `json:"commonPrefixes,omitempty"`
 		HasMore            bool              `json:"hasMore"`
 		NextPathMarker     string            `json:"nextMarker"`
 		NextUploadIDMarker string            `json:"nextUploadIDMarker"`
@@ -519,6 +885,49 @@ type WalletResponse struct {
 	Unconfirmed types.Currency `json:"unconfirmed"`
 }
 
+// UploadStatsMetric is a snapshot of the upload stats of a worker. The version
+// of the worker is recorded so the performance can be compared across
+// upgrades.
+type UploadStatsMetric struct {
+	Timestamp              TimeRFC3339 `json:"timestamp"`
+	Worker                 string      `json:"worker"`
+	Version                string      `json:"version"`
+	AvgSlabUploadSpeedMBPS float64     `json:"avgSlabUploadSpeedMBPS"`
+	AvgOverdrivePct        float64     `json:"avgOverdrivePct"`
+	HealthyUploaders       uint64      `json:"healthyUploaders"`
+	NumUploaders           uint64      `json:"numUploaders"`
+}
+
+// HostMetric is a snapshot of the performance of a host as observed by a
+// worker.
+type HostMetric struct {
+	Timestamp TimeRFC3339     `json:"timestamp"`
+	Worker    string          `json:"worker"`
+	HostKey   types.PublicKey `json:"hostKey"`
+	hostdb.HostPerformance
+}
+
+// WalletBalanceResponse is the response type for the /wallet/balance endpoint.
+type WalletBalanceResponse struct {
+	Spendable   types.Currency `json:"spendable"`
+	Confirmed   types.Currency `json:"confirmed"`
+	Unconfirmed types.Currency `json:"unconfirmed"`
+}
+
+// WalletSendRequest is the request type for the /wallet/send endpoint. If
+// DryRun is set the fee is estimated but no transaction is sent.
+type WalletSendRequest struct {
+	Address types.Address  `json:"address"`
+	Amount  types.Currency `json:"amount"`
+	DryRun  bool           `json:"dryRun"`
+}
+
+// WalletSendResponse is the response type for the /wallet/send endpoint.
+type WalletSendResponse struct {
+	TransactionID types.TransactionID `json:"transactionID"`
+	Fee           types.Currency      `json:"fee"`
+}
+
 type (
 	Bucket struct {
 		CreatedAt time.Time    `json:"createdAt"`
@@ -528,6 +937,45 @@ type (
 
 	BucketPolicy struct {
 		PublicReadAccess bool `json:"publicReadAccess"`
+
+		// RedundancySettings, if set, override the default redundancy
+		// settings for objects uploaded to the bucket.
+		RedundancySettings *RedundancySettings `json:"redundancySettings,omitempty"`
+
+		// GougingOverrides, if set, override parts of the default gouging
+		// settings when uploading objects to the bucket or migrating the
+		// bucket's slabs.
+		GougingOverrides *GougingOverrides `json:"gougingOverrides,omitempty"`
+
+		// MaxObjectSize, if set, is the maximum size in bytes of a single
+		// object or multipart upload part uploaded to the bucket.
+		MaxObjectSize uint64 `json:"maxObjectSize,omitempty"`
+
+		// MaxStoredBytes, if set, is the maximum total size in bytes of the
+		// objects stored in the bucket.
+		MaxStoredBytes uint64 `json:"maxStoredBytes,omitempty"`
+
+		// ObjectTTL, if set, turns the bucket into a scratch namespace.
+		// Objects uploaded to it expire after the TTL unless they are
+		// promoted, expired objects and stale multipart uploads are garbage
+		// collected by the bus.
+		ObjectTTL DurationMS `json:"objectTTL,omitempty"`
+	}
+
+	// BucketStats is the response type for the /buckets/:name/stats endpoint.
+	BucketStats struct {
+		NumObjects       uint64 `json:"numObjects"`
+		TotalObjectsSize uint64 `json:"totalObjectsSize"`
+	}
+
+	// GougingOverrides contains optional overrides for the gouging settings,
+	// every field that is set replaces the corresponding gouging setting.
+	GougingOverrides struct {
+		MaxRPCPrice      *types.Currency `json:"maxRPCPrice,omitempty"`
+		MaxContractPrice *types.Currency `json:"maxContractPrice,omitempty"`
+		MaxDownloadPrice *types.Currency `json:"maxDownloadPrice,omitempty"`
+		MaxUploadPrice   *types.Currency `json:"maxUploadPrice,omitempty"`
+		MaxStoragePrice  *types.Currency `json:"maxStoragePrice,omitempty"`
 	}
 
 	BucketCreateRequest struct {
@@ -558,10 +1006,67 @@ type AddPartialSlabResponse struct {
 	Slabs                        []object.PartialSlab `json:"slabs"`
 }
 
+// Apply returns the given gouging params with the bucket policy's overrides
+// applied.
+func (bp BucketPolicy) Apply(gp GougingParams) GougingParams {
+	if bp.RedundancySettings != nil {
+		gp.RedundancySettings = *bp.RedundancySettings
+	}
+	if bp.GougingOverrides != nil {
+		gp.GougingSettings = bp.GougingOverrides.Apply(gp.GougingSettings)
+	}
+	return gp
+}
+
+// Validate returns an error if the bucket policy is not considered valid.
+func (bp BucketPolicy) Validate() error {
+	if bp.RedundancySettings != nil {
+		if err := bp.RedundancySettings.Validate(); err != nil {
+			return fmt.Errorf("invalid redundancy settings: %w", err)
+		}
+	}
+	if bp.ObjectTTL < 0 {
+		return fmt.Errorf("%w, got %v", ErrInvalidObjectTTL, time.Duration(bp.ObjectTTL))
+	}
+	return nil
+}
+
+// Apply returns the given gouging settings with the overrides applied.
+func (o GougingOverrides) Apply(gs GougingSettings) GougingSettings {
+	for _, override := range []struct {
+		src *types.Currency
+		dst *types.Currency
+	}{
+		{o.MaxRPCPrice, &gs.MaxRPCPrice},
+		{o.MaxContractPrice, &gs.MaxContractPrice},
+		{o.MaxDownloadPrice, &gs.MaxDownloadPrice},
+		{o.MaxUploadPrice, &gs.MaxUploadPrice},
+		{o.MaxStoragePrice, &gs.MaxStoragePrice},
+	} {
+		if override.src != nil {
+			*override.dst = *override.src
+		}
+	}
+	return gs
+}
+
 func FormatETag(ETag string) string {
 	return fmt.Sprintf("\"%s\"", ETag)
 }
 
+// MultipartETag returns the ETag of an object that was uploaded in the given
+// number of parts. Like in S3 it's suffixed with the number of parts, which
+// tells it apart from the ETag of an object that was uploaded in one go.
+func MultipartETag(hash string, numParts int) string {
+	return fmt.Sprintf("%s-%d", hash, numParts)
+}
+
+// IsMultipartETag returns true if the given ETag belongs to an object that was
+// uploaded in multiple parts, such ETags aren't the hash of the object's data.
+func IsMultipartETag(eTag string) bool {
+	return strings.Contains(eTag, "-")
+}
+
 func ObjectPathEscape(path string) string {
 	return url.PathEscape(strings.TrimPrefix(path, "/"))
 }
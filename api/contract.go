@@ -48,6 +48,13 @@ type (
 		SectorRoots types.Currency `json:"sectorRoots"`
 	}
 
+	// ContractSpendingMetric is the spending of a contract within the hour
+	// starting at the given timestamp.
+	ContractSpendingMetric struct {
+		Timestamp TimeRFC3339 `json:"timestamp"`
+		ContractSpending
+	}
+
 	ContractSpendingRecord struct {
 		ContractSpending
 		ContractID     types.FileContractID `json:"contractID"`
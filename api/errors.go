@@ -0,0 +1,289 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// errorCodes maps the exported sentinel errors to the stable codes they are
+// identified by in error responses.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	// autopilot
+	{ErrAutopilotNotFound, "autopilot_not_found"},
+	{ErrAutopilotProfileNotFound, "autopilot_profile_not_found"},
+	{ErrMaxDowntimeHoursTooHigh, "max_downtime_hours_too_high"},
+	{ErrMaxHostsPerTagValueZero, "max_hosts_per_tag_value_zero"},
+	{ErrInvalidSLAAlertThreshold, "invalid_sla_alert_threshold"},
+	{ErrInvalidRebalanceThreshold, "invalid_rebalance_threshold"},
+	{ErrInvalidEndHeightBuckets, "invalid_end_height_buckets"},
+	{ErrInvalidIPFilterPrefix, "invalid_ip_filter_prefix"},
+	{ErrInvalidHostScoreWeight, "invalid_host_score_weight"},
+	{ErrInvalidDefragThreshold, "invalid_defrag_threshold"},
+
+	// bus
+	{ErrBucketExists, "bucket_exists"},
+	{ErrBucketNotEmpty, "bucket_not_empty"},
+	{ErrBucketNotFound, "bucket_not_found"},
+	{ErrRequiresSyncSetRecently, "requires_sync_set_recently"},
+	{ErrContractNotFound, "contract_not_found"},
+	{ErrContractSetNotFound, "contract_set_not_found"},
+	{ErrDatabaseBusy, "database_busy"},
+	{ErrDatabaseMaintenanceRunning, "database_maintenance_running"},
+	{ErrHostNotFound, "host_not_found"},
+	{ErrIdempotencyKeyInUse, "idempotency_key_in_use"},
+	{ErrIdempotencyKeyMismatch, "idempotency_key_mismatch"},
+	{ErrInvalidBlocklistEntry, "invalid_blocklist_entry"},
+	{ErrInvalidHostTag, "invalid_host_tag"},
+	{ErrInvalidHostScoreModifier, "invalid_host_score_modifier"},
+	{ErrInvalidObjectTTL, "invalid_object_ttl"},
+	{ErrMultipartUploadNotFound, "multipart_upload_not_found"},
+	{ErrPartNotFound, "part_not_found"},
+	{ErrUploadAlreadyExists, "upload_already_exists"},
+	{ErrUnknownUpload, "unknown_upload"},
+	{ErrSettingNotFound, "setting_not_found"},
+
+	// objects
+	{ErrObjectNotFound, "object_not_found"},
+	{ErrObjectExists, "object_exists"},
+	{ErrInvalidObjectSortParameters, "invalid_object_sort_parameters"},
+	{ErrInvalidMarker, "invalid_marker"},
+	{ErrObjectUserMetadataTooLarge, "object_user_metadata_too_large"},
+	{ErrObjectCorrupted, "object_corrupted"},
+	{ErrPartialObjectNotFound, "partial_object_not_found"},
+	{ErrPartialObjectConflict, "partial_object_conflict"},
+
+	// worker
+	{ErrConsensusNotSynced, "consensus_not_synced"},
+	{ErrContractSetNotSpecified, "contract_set_not_specified"},
+	{ErrObjectTrailerMismatch, "object_trailer_mismatch"},
+	{ErrObjectTooLarge, "object_too_large"},
+	{ErrBucketQuotaExceeded, "bucket_quota_exceeded"},
+	{ErrTooManyHostKeys, "too_many_host_keys"},
+	{ErrHostNotDenied, "host_not_denied"},
+	{ErrUploadStagingDisabled, "upload_staging_disabled"},
+	{ErrUploadFundsExhausted, "upload_funds_exhausted"},
+	{ErrMaintenanceMode, "maintenance_mode"},
+}
+
+// Error is the error envelope returned by the bus, worker and autopilot APIs
+// to clients that accept JSON error responses. The code is stable across
+// releases, unlike the message, and identifies the sentinel error in the api
+// package that caused the error.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string { return e.Message }
+
+// Is returns true if the target is the sentinel error identified by the
+// error's code, that way errors.Is works for errors returned by the APIs.
+func (e *Error) Is(target error) bool {
+	if t, ok := target.(*Error); ok {
+		return e.Code == t.Code
+	}
+	return e.Code != "" && e.Code == ErrorCode(target)
+}
+
+// ErrorCode returns the code of the sentinel error the given error wraps, if
+// it doesn't wrap any sentinel error an empty string is returned.
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	for _, ec := range errorCodes {
+		if errors.Is(err, ec.err) {
+			return ec.code
+		}
+	}
+	return ""
+}
+
+// ParseError converts an error returned by an API client into an error that
+// can be matched against the sentinel errors in the api package using
+// errors.Is. Both JSON error envelopes and plain text errors are supported,
+// the latter are identified by the message of the sentinel error they wrap.
+func ParseError(err error) error {
+	if err == nil || ErrorCode(err) != "" {
+		return err
+	}
+
+	// try decoding the envelope
+	msg := err.Error()
+	var apiErr Error
+	if json.Unmarshal([]byte(msg), &apiErr) == nil && apiErr.Code != "" {
+		return &apiErr
+	}
+
+	// fall back to matching the message, some messages contain others so
+	// the longest match wins
+	var match string
+	var matchLen int
+	for _, ec := range errorCodes {
+		if m := ec.err.Error(); len(m) > matchLen && strings.Contains(msg, m) {
+			match, matchLen = ec.code, len(m)
+		}
+	}
+	if match == "" {
+		return err
+	}
+	return &Error{Code: match, Message: msg}
+}
+
+// ReadError reads the error from the body of a failed response. JSON error
+// envelopes are decoded into an *Error, all other responses are returned as
+// plain text errors.
+func ReadError(resp *http.Response) error {
+	b, _ := io.ReadAll(resp.Body)
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var apiErr Error
+		if json.Unmarshal(b, &apiErr) == nil && apiErr.Code != "" {
+			return &apiErr
+		}
+	}
+	return errors.New(string(b))
+}
+
+// errorEnvelopeTransport is an http.RoundTripper that requests JSON error
+// envelopes for JSON requests that don't specify which responses they accept.
+type errorEnvelopeTransport struct {
+	http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t errorEnvelopeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept") == "" && strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept", "application/json")
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+var requestErrorEnvelopesOnce sync.Once
+
+// RequestErrorEnvelopes wraps the transport of the default HTTP client, which
+// is used by the jape clients of the bus, worker and autopilot, so that their
+// requests receive JSON error envelopes. The errors returned by those clients
+// are then identified by their code when passed to ParseError. It is meant to
+// be called from an init function since the default client isn't safe to
+// modify while it's in use.
+func RequestErrorEnvelopes() {
+	requestErrorEnvelopesOnce.Do(func() {
+		rt := http.DefaultClient.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		http.DefaultClient.Transport = errorEnvelopeTransport{rt}
+	})
+}
+
+// errorCodeForStatus returns the code used for errors that don't wrap any of
+// the sentinel errors, it's derived from the status code of the response.
+func errorCodeForStatus(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "unknown_error"
+	}
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
+
+// WithErrorEnvelope wraps the given handler and rewrites plain text error
+// responses into the JSON error envelope for requests that accept JSON. Other
+// requests receive the plain text error for backwards compatibility.
+func WithErrorEnvelope(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.Contains(req.Header.Get("Accept"), "application/json") {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		ew := &errorEnvelopeWriter{ResponseWriter: w}
+		h.ServeHTTP(ew, req)
+		if ew.status == 0 {
+			return
+		}
+
+		msg := strings.TrimSpace(ew.buf.String())
+		code := errorCodeForStatus(ew.status)
+		if c := ErrorCode(ParseError(errors.New(msg))); c != "" {
+			code = c
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(ew.status)
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.Encode(Error{Code: code, Message: msg})
+	})
+}
+
+// errorEnvelopeWriter buffers plain text error responses so they can be
+// rewritten into the JSON error envelope, all other responses are passed
+// through.
+type errorEnvelopeWriter struct {
+	http.ResponseWriter
+
+	wroteHeader bool
+	status      int
+	buf         bytes.Buffer
+}
+
+func (w *errorEnvelopeWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status >= http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.status = status
+		w.Header().Del("Content-Length")
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorEnvelopeWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.status != 0 {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (w *errorEnvelopeWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.status == 0 {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer, it allows http.ResponseController to
+// access the underlying connection.
+func (w *errorEnvelopeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack implements http.Hijacker, it allows upgrading connections to
+// websockets.
+func (w *errorEnvelopeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer doesn't support hijacking")
+	}
+	return h.Hijack()
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.sia.tech/jape"
+)
+
+func TestErrorCode(t *testing.T) {
+	// assert every sentinel error has a unique code
+	seen := make(map[string]struct{})
+	for _, ec := range errorCodes {
+		if _, ok := seen[ec.code]; ok {
+			t.Fatal("duplicate code", ec.code)
+		}
+		seen[ec.code] = struct{}{}
+		if code := ErrorCode(ec.err); code != ec.code {
+			t.Fatalf("expected code %v, got %v", ec.code, code)
+		}
+	}
+
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{nil, ""},
+		{errors.New("foo"), ""},
+		{fmt.Errorf("failed to fetch object: %w", ErrObjectNotFound), "object_not_found"},
+		{fmt.Errorf("upload failed: %w", ErrUploadFundsExhausted), "upload_funds_exhausted"},
+		{fmt.Errorf("%w: %w", ErrMaintenanceMode, errors.New("foo")), "maintenance_mode"},
+		{&Error{Code: "foo", Message: "bar"}, "foo"},
+		{fmt.Errorf("wrapped: %w", &Error{Code: "bucket_not_found"}), "bucket_not_found"},
+	}
+	for _, test := range tests {
+		if code := ErrorCode(test.err); code != test.code {
+			t.Fatalf("%v: expected code %q, got %q", test.err, test.code, code)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	// assert nil is returned as is
+	if ParseError(nil) != nil {
+		t.Fatal("expected nil")
+	}
+
+	// assert errors that are not recognised are returned as is
+	err := errors.New("foo")
+	if ParseError(err) != err {
+		t.Fatal("unexpected error")
+	}
+
+	// assert envelopes are decoded
+	b, _ := json.Marshal(Error{Code: "bucket_not_found", Message: "failed to fetch bucket"})
+	if err := ParseError(errors.New(string(b))); !errors.Is(err, ErrBucketNotFound) {
+		t.Fatal("expected ErrBucketNotFound", err)
+	} else if err.Error() != "failed to fetch bucket" {
+		t.Fatal("unexpected message", err)
+	}
+
+	// assert plain text errors are matched by their message
+	if err := ParseError(fmt.Errorf("failed to fetch object: %v", ErrObjectNotFound)); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatal("expected ErrObjectNotFound", err)
+	}
+
+	// assert the longest message wins if several sentinel errors match
+	if err := ParseError(errors.New(ErrPartialObjectNotFound.Error())); !errors.Is(err, ErrPartialObjectNotFound) || errors.Is(err, ErrObjectNotFound) {
+		t.Fatal("expected ErrPartialObjectNotFound", err)
+	}
+
+	// assert errors that already wrap a sentinel are returned as is
+	err = fmt.Errorf("foo: %w", ErrHostNotFound)
+	if ParseError(err) != err {
+		t.Fatal("unexpected error")
+	}
+}
+
+func TestWithErrorEnvelope(t *testing.T) {
+	h := WithErrorEnvelope(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/ok":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"foo":"bar"}`))
+		case "/sentinel":
+			http.Error(w, fmt.Sprintf("couldn't fetch object: %v", ErrObjectNotFound), http.StatusNotFound)
+		case "/unknown":
+			http.Error(w, "something went wrong", http.StatusInternalServerError)
+		}
+	}))
+
+	do := func(path string, acceptJSON bool) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptJSON {
+			req.Header.Set("Accept", "application/json")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	envelope := func(rec *httptest.ResponseRecorder) (e Error) {
+		t.Helper()
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatal("unexpected content type", ct)
+		} else if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	// assert successful responses are passed through
+	for _, acceptJSON := range []bool{false, true} {
+		if rec := do("/ok", acceptJSON); rec.Code != http.StatusOK || rec.Body.String() != `{"foo":"bar"}` {
+			t.Fatal("unexpected response", rec.Code, rec.Body.String())
+		}
+	}
+
+	// assert plain text errors are returned to clients that don't accept JSON
+	if rec := do("/sentinel", false); rec.Code != http.StatusNotFound || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatal("unexpected response", rec.Code, rec.Header())
+	} else if msg := strings.TrimSpace(rec.Body.String()); msg != "couldn't fetch object: object not found" {
+		t.Fatal("unexpected message", msg)
+	}
+
+	// assert errors are wrapped in an envelope for clients that accept JSON
+	if rec := do("/sentinel", true); rec.Code != http.StatusNotFound {
+		t.Fatal("unexpected status", rec.Code)
+	} else if e := envelope(rec); e.Code != "object_not_found" || e.Message != "couldn't fetch object: object not found" {
+		t.Fatal("unexpected envelope", e)
+	}
+
+	// assert errors that don't wrap a sentinel error get a code derived from
+	// the status code
+	if rec := do("/unknown", true); rec.Code != http.StatusInternalServerError {
+		t.Fatal("unexpected status", rec.Code)
+	} else if e := envelope(rec); e.Code != "internal_server_error" || e.Message != "something went wrong" {
+		t.Fatal("unexpected envelope", e)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", "application/json")
+	rec.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(rec).Encode(Error{Code: "maintenance_mode", Message: "paused"})
+	if err := ReadError(rec.Result()); !errors.Is(err, ErrMaintenanceMode) {
+		t.Fatal("expected ErrMaintenanceMode", err)
+	}
+
+	rec = httptest.NewRecorder()
+	http.Error(rec, "foo", http.StatusBadRequest)
+	if err := ReadError(rec.Result()); err.Error() != "foo\n" || ErrorCode(err) != "" {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+func TestRequestErrorEnvelopes(t *testing.T) {
+	srv := httptest.NewServer(WithErrorEnvelope(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, fmt.Sprintf("%v: <foo> & <bar>", ErrObjectNotFound), http.StatusNotFound)
+	})))
+	defer srv.Close()
+
+	// assert the jape client receives plain text errors by default
+	c := jape.Client{BaseURL: srv.URL}
+	if err := c.GET("/", nil); err == nil {
+		t.Fatal("expected error")
+	} else if json.Unmarshal([]byte(err.Error()), new(Error)) == nil {
+		t.Fatal("unexpected envelope", err)
+	}
+
+	// assert it receives envelopes once requested
+	RequestErrorEnvelopes()
+	err := c.GET("/", nil)
+	var e Error
+	if err == nil {
+		t.Fatal("expected error")
+	} else if json.Unmarshal([]byte(err.Error()), &e) != nil {
+		t.Fatal("expected envelope", err)
+	} else if e.Code != "object_not_found" || e.Message != "object not found: <foo> & <bar>" {
+		t.Fatal("unexpected envelope", e)
+	} else if !errors.Is(ParseError(err), ErrObjectNotFound) {
+		t.Fatal("expected ErrObjectNotFound", err)
+	}
+}
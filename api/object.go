@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"go.sia.tech/core/types"
@@ -18,21 +19,71 @@ const (
 	ObjectsRenameModeMulti  = "multi"
 )
 
+const (
+	// ObjectUserMetadataPrefix is the prefix of the headers that carry an
+	// object's user metadata.
+	ObjectUserMetadataPrefix = "X-Sia-Meta-"
+
+	// ObjectUserMetadataMaxSize is the maximum combined size in bytes of the
+	// keys and values of an object's user metadata.
+	ObjectUserMetadataMaxSize = 2048
+)
+
+const (
+	ObjectSortByName    = "name"
+	ObjectSortBySize    = "size"
+	ObjectSortByModTime = "modTime"
+
+	ObjectSortDirAsc  = "asc"
+	ObjectSortDirDesc = "desc"
+)
+
 var (
 	// ErrObjectNotFound is returned when an object can't be retrieved from the
 	// database.
 	ErrObjectNotFound = errors.New("object not found")
 
+	// ErrObjectExists is returned when an object is renamed to a path that is
+	// already taken by another object.
+	ErrObjectExists = errors.New("object already exists")
+
+	// ErrInvalidObjectSortParameters is returned when objects are listed
+	// with an unknown sort field or direction.
+	ErrInvalidObjectSortParameters = errors.New("invalid sort parameters")
+
+	// ErrInvalidMarker is returned when objects are listed with a marker
+	// that isn't a continuation token returned by a previous listing.
+	ErrInvalidMarker = errors.New("invalid marker")
+
+	// ErrObjectUserMetadataTooLarge is returned when the user metadata of an
+	// object exceeds ObjectUserMetadataMaxSize.
+	ErrObjectUserMetadataTooLarge = errors.New("user metadata too large")
+
 	// ErrObjectCorrupted is returned if we were unable to retrieve the object
 	// from the database.
 	ErrObjectCorrupted = errors.New("object corrupted")
+
+	// ErrPartialObjectNotFound is returned when there is no partial object
+	// for the given bucket and path.
+	ErrPartialObjectNotFound = errors.New("partial object not found")
+
+	// ErrPartialObjectConflict is returned when slabs are added to a partial
+	// object at an offset that doesn't match the number of slabs it contains.
+	ErrPartialObjectConflict = errors.New("partial object conflict")
 )
 
 type (
+	// ObjectUserMetadata contains arbitrary key-value pairs that are stored
+	// alongside an object.
+	ObjectUserMetadata map[string]string
+
 	// Object wraps an object.Object with its metadata.
 	Object struct {
 		ObjectMetadata
 		object.Object
+
+		// Metadata is the object's user metadata.
+		Metadata ObjectUserMetadata `json:"metadata,omitempty"`
 	}
 
 	// ObjectMetadata contains various metadata about an object.
@@ -43,6 +94,10 @@ type (
 		ModTime  time.Time `json:"modTime"`
 		Name     string    `json:"name"`
 		Size     int64     `json:"size"`
+
+		// ExpiresAt is set for objects in a scratch bucket that weren't
+		// promoted yet.
+		ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 	}
 
 	// ObjectAddRequest is the request type for the /bus/object/*key endpoint.
@@ -53,6 +108,36 @@ type (
 		UsedContracts map[types.PublicKey]types.FileContractID `json:"usedContracts"`
 		MimeType      string                                   `json:"mimeType"`
 		ETag          string                                   `json:"eTag"`
+		Metadata      ObjectUserMetadata                       `json:"metadata,omitempty"`
+	}
+
+	// PartialObject is a checkpoint of an upload that has not completed yet,
+	// it contains the slabs that were uploaded so far, allowing a retried
+	// upload to skip them.
+	PartialObject struct {
+		Key         object.EncryptionKey `json:"key"`
+		ContractSet string               `json:"contractSet"`
+		MinShards   uint8                `json:"minShards"`
+		TotalShards uint8                `json:"totalShards"`
+
+		// Slabs contains the uploaded slabs in order, SlabHashes contains the
+		// hash of every slab's data after it was encrypted with the object
+		// key, but before it was erasure-coded and encrypted with the slab
+		// key. Since a resumed upload reuses the object key, the hashes are
+		// used to verify the retried upload contains the same data.
+		Slabs         []object.SlabSlice                       `json:"slabs"`
+		SlabHashes    []types.Hash256                          `json:"slabHashes"`
+		UsedContracts map[types.PublicKey]types.FileContractID `json:"usedContracts"`
+	}
+
+	// PartialObjectAddRequest is the request type for the
+	// /bus/partialobjects/*path endpoint. The partial object only contains
+	// the slabs that were uploaded since the last checkpoint, offset is the
+	// index of the first one. An offset of zero starts a new checkpoint.
+	PartialObjectAddRequest struct {
+		Bucket        string        `json:"bucket"`
+		Offset        int           `json:"offset"`
+		PartialObject PartialObject `json:"partialObject"`
 	}
 
 	// ObjectsResponse is the response type for the /bus/objects endpoint.
@@ -75,17 +160,65 @@ type (
 
 	// ObjectsDeleteRequest is the request type for the /bus/objects/list endpoint.
 	ObjectsListRequest struct {
+		Bucket    string `json:"bucket"`
+		Limit     int    `json:"limit"`
+		SortBy    string `json:"sortBy,omitempty"`
+		SortDir   string `json:"sortDir,omitempty"`
+		Prefix    string `json:"prefix"`
+		Delimiter string `json:"delimiter,omitempty"`
+		Marker    string `json:"marker"`
+	}
+
+	// ObjectsListResponse is the response type for the /bus/objects/list
+	// endpoint. If the request specified a delimiter, objects that contain
+	// the delimiter after the prefix are rolled up into common prefixes.
+	ObjectsListResponse struct {
+		CommonPrefixes []string         `json:"commonPrefixes,omitempty"`
+		HasMore        bool             `json:"hasMore"`
+		NextMarker     string           `json:"nextMarker"`
+		Objects        []ObjectMetadata `json:"objects"`
+	}
+
+	// ObjectsPromoteRequest is the request type for the /bus/objects/promote
+	// endpoint. If no destination is given the object is promoted in place.
+	ObjectsPromoteRequest struct {
 		Bucket string `json:"bucket"`
-		Limit  int    `json:"limit"`
-		Prefix string `json:"prefix"`
-		Marker string `json:"marker"`
+		Path   string `json:"path"`
+
+		DestinationBucket string `json:"destinationBucket,omitempty"`
+		DestinationPath   string `json:"destinationPath,omitempty"`
 	}
 
-	// ObjectsListResponse is the response type for the /bus/objects/list endpoint.
-	ObjectsListResponse struct {
-		HasMore    bool             `json:"hasMore"`
-		NextMarker string           `json:"nextMarker"`
-		Objects    []ObjectMetadata `json:"objects"`
+	// ObjectsSampleRequest is the request type for the /bus/objects/sample
+	// endpoint.
+	ObjectsSampleRequest struct {
+		Limit int `json:"limit"`
+	}
+
+	// ObjectSample is an object that was sampled at random across all
+	// buckets, it's the response type for the /bus/objects/sample endpoint.
+	ObjectSample struct {
+		Bucket string `json:"bucket"`
+		ObjectMetadata
+	}
+
+	// HostObject is an object with at least one sector stored on a host, it's
+	// the response type for the /bus/host/:hostkey/objects endpoint.
+	HostObject struct {
+		Bucket string `json:"bucket"`
+		Name   string `json:"name"`
+		Size   int64  `json:"size"`
+	}
+
+	// AffectedObject is an object with at least one sector stored on a host or
+	// contract, it's the response type for the /bus/host/:hostkey/objects/affected
+	// and /bus/contract/:id/objects/affected endpoints. A slab is at risk if
+	// losing the host or contract drops its redundancy below MinShards+1.
+	AffectedObject struct {
+		HostObject
+		Slabs       int  `json:"slabs"`
+		AtRiskSlabs int  `json:"atRiskSlabs"`
+		AtRisk      bool `json:"atRisk"`
 	}
 
 	// ObjectsRenameRequest is the request type for the /bus/objects/rename endpoint.
@@ -96,6 +229,16 @@ type (
 		Mode   string `json:"mode"`
 	}
 
+	// ObjectsDeletion describes the progress of a batch deletion, it's the
+	// response type for the /bus/system/deletions endpoint.
+	ObjectsDeletion struct {
+		Bucket    string    `json:"bucket"`
+		Prefix    string    `json:"prefix"`
+		Deleted   int64     `json:"deleted"`
+		Total     int64     `json:"total"`
+		StartedAt time.Time `json:"startedAt"`
+	}
+
 	// ObjectsStatsResponse is the response type for the /bus/stats/objects endpoint.
 	ObjectsStatsResponse struct {
 		NumObjects        uint64 `json:"numObjects"`        // number of objects
@@ -103,8 +246,23 @@ type (
 		TotalSectorsSize  uint64 `json:"totalSectorsSize"`  // uploaded size of all objects
 		TotalUploadedSize uint64 `json:"totalUploadedSize"` // uploaded size of all objects including redundant sectors
 	}
+
+	// SlabHealthHistogram is the response type for the /stats/slabs/health
+	// endpoint, it contains the number of slabs per health range.
+	SlabHealthHistogram struct {
+		Unrecoverable uint64 `json:"unrecoverable"` // health < 0
+		Critical      uint64 `json:"critical"`      // 0 <= health < 0.25
+		Low           uint64 `json:"low"`           // 0.25 <= health < 0.5
+		Degraded      uint64 `json:"degraded"`      // 0.5 <= health < 1
+		Healthy       uint64 `json:"healthy"`       // health >= 1
+	}
 )
 
+// Total returns the total number of slabs in the histogram.
+func (h SlabHealthHistogram) Total() uint64 {
+	return h.Unrecoverable + h.Critical + h.Low + h.Degraded + h.Healthy
+}
+
 // LastModified returns the object's ModTime formatted for use in the
 // 'Last-Modified' header
 func (o ObjectMetadata) LastModified() string {
@@ -130,6 +288,7 @@ type (
 	AddObjectOptions struct {
 		MimeType string
 		ETag     string
+		Metadata ObjectUserMetadata
 	}
 
 	CopyObjectOptions struct {
@@ -141,10 +300,11 @@ type (
 	}
 
 	DownloadObjectOptions struct {
-		Prefix string
-		Offset int
-		Limit  int
-		Range  DownloadRange
+		Prefix      string
+		Offset      int
+		Limit       int
+		Range       DownloadRange
+		ContractSet string
 	}
 
 	ObjectEntriesOptions struct {
@@ -159,18 +319,26 @@ type (
 		Limit       int
 		IgnoreDelim bool
 		Marker      string
+
+		// OnlyMetadata indicates that the object should be returned without
+		// its slabs.
+		OnlyMetadata bool
 	}
 
 	ListObjectOptions struct {
-		Prefix string
-		Marker string
-		Limit  int
+		Prefix    string
+		Delimiter string
+		Marker    string
+		Limit     int
+		SortBy    string
+		SortDir   string
 	}
 
 	SearchObjectOptions struct {
-		Key    string
-		Offset int
-		Limit  int
+		Key      string
+		Metadata ObjectUserMetadata
+		Offset   int
+		Limit    int
 	}
 
 	UploadObjectOptions struct {
@@ -179,12 +347,34 @@ type (
 		TotalShards                  int
 		ContractSet                  string
 		MimeType                     string
+		Metadata                     ObjectUserMetadata
 		DisablePreshardingEncryption bool
+
+		// Staged stages the upload on the worker's disk, the worker
+		// acknowledges the upload once the data is safely stored and
+		// uploads it to the hosts in the background.
+		Staged bool
+
+		// Force starts the upload even if it's projected to exhaust the
+		// remaining contract funds before it completes.
+		Force bool
+	}
+
+	UploadSlabOptions struct {
+		Bucket      string
+		ContractSet string
+		MinShards   int
+		TotalShards int
+		UploadID    UploadID
 	}
 
 	UploadMultipartUploadPartOptions struct {
 		DisablePreshardingEncryption bool
 		EncryptionOffset             int
+
+		// Force starts the upload even if it's projected to exhaust the
+		// remaining contract funds before it completes.
+		Force bool
 	}
 )
 
@@ -207,6 +397,34 @@ func (opts UploadObjectOptions) Apply(values url.Values) {
 	if opts.DisablePreshardingEncryption {
 		values.Set("disablepreshardingencryption", "true")
 	}
+	if opts.Staged {
+		values.Set("staged", "true")
+	}
+	if opts.Force {
+		values.Set("force", "true")
+	}
+}
+
+func (opts UploadObjectOptions) ApplyHeaders(h http.Header) {
+	opts.Metadata.ApplyHeaders(h)
+}
+
+func (opts UploadSlabOptions) Apply(values url.Values) {
+	if opts.Bucket != "" {
+		values.Set("bucket", opts.Bucket)
+	}
+	if opts.ContractSet != "" {
+		values.Set("contractset", opts.ContractSet)
+	}
+	if opts.MinShards != 0 {
+		values.Set("minshards", fmt.Sprint(opts.MinShards))
+	}
+	if opts.TotalShards != 0 {
+		values.Set("totalshards", fmt.Sprint(opts.TotalShards))
+	}
+	if opts.UploadID != (UploadID{}) {
+		values.Set("uploadid", opts.UploadID.String())
+	}
 }
 
 func (opts UploadMultipartUploadPartOptions) Apply(values url.Values) {
@@ -216,6 +434,9 @@ func (opts UploadMultipartUploadPartOptions) Apply(values url.Values) {
 	if !opts.DisablePreshardingEncryption || opts.EncryptionOffset != 0 {
 		values.Set("offset", fmt.Sprint(opts.EncryptionOffset))
 	}
+	if opts.Force {
+		values.Set("force", "true")
+	}
 }
 
 func (opts DownloadObjectOptions) ApplyValues(values url.Values) {
@@ -228,11 +449,17 @@ func (opts DownloadObjectOptions) ApplyValues(values url.Values) {
 	if opts.Limit != 0 {
 		values.Set("limit", fmt.Sprint(opts.Limit))
 	}
+	if opts.ContractSet != "" {
+		values.Set("contractset", opts.ContractSet)
+	}
 }
 
 func (opts DownloadObjectOptions) ApplyHeaders(h http.Header) {
 	if opts.Range != (DownloadRange{}) {
-		if opts.Range.Length == -1 {
+		if opts.Range.Offset < 0 {
+			// a negative offset requests the last Length bytes of the object
+			h.Set("Range", fmt.Sprintf("bytes=-%v", opts.Range.Length))
+		} else if opts.Range.Length == -1 {
 			h.Set("Range", fmt.Sprintf("bytes=%v-", opts.Range.Offset))
 		} else {
 			h.Set("Range", fmt.Sprintf("bytes=%v-%v", opts.Range.Offset, opts.Range.Offset+opts.Range.Length-1))
@@ -262,12 +489,18 @@ func (opts GetObjectOptions) Apply(values url.Values) {
 	if opts.Marker != "" {
 		values.Set("marker", opts.Marker)
 	}
+	if opts.OnlyMetadata {
+		values.Set("onlyMetadata", "true")
+	}
 }
 
 func (opts SearchObjectOptions) Apply(values url.Values) {
 	if opts.Key != "" {
 		values.Set("key", opts.Key)
 	}
+	for k, v := range opts.Metadata {
+		values.Add("metadata", fmt.Sprintf("%s:%s", k, v))
+	}
 	if opts.Offset != 0 {
 		values.Set("offset", fmt.Sprint(opts.Offset))
 	}
@@ -275,3 +508,42 @@ func (opts SearchObjectOptions) Apply(values url.Values) {
 		values.Set("limit", fmt.Sprint(opts.Limit))
 	}
 }
+
+// ObjectUserMetadataFromHeaders extracts the user metadata from the given
+// headers, the keys are the lowercased header names without the metadata
+// prefix.
+func ObjectUserMetadataFromHeaders(h http.Header) ObjectUserMetadata {
+	md := make(ObjectUserMetadata)
+	for k, v := range h {
+		k = http.CanonicalHeaderKey(k)
+		if strings.HasPrefix(k, ObjectUserMetadataPrefix) && len(k) > len(ObjectUserMetadataPrefix) && len(v) > 0 {
+			md[strings.ToLower(strings.TrimPrefix(k, ObjectUserMetadataPrefix))] = v[0]
+		}
+	}
+	if len(md) == 0 {
+		return nil
+	}
+	return md
+}
+
+// ApplyHeaders sets the user metadata on the given headers.
+func (md ObjectUserMetadata) ApplyHeaders(h http.Header) {
+	for k, v := range md {
+		h.Set(ObjectUserMetadataPrefix+k, v)
+	}
+}
+
+// Validate returns an error if the user metadata exceeds the maximum size.
+func (md ObjectUserMetadata) Validate() error {
+	var size int
+	for k, v := range md {
+		if k == "" {
+			return errors.New("user metadata key can't be empty")
+		}
+		size += len(k) + len(v)
+	}
+	if size > ObjectUserMetadataMaxSize {
+		return fmt.Errorf("%w: %d > %d bytes", ErrObjectUserMetadataTooLarge, size, ObjectUserMetadataMaxSize)
+	}
+	return nil
+}
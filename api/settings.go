@@ -2,14 +2,18 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
+	rhpv2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
 )
 
 const (
 	SettingContractSet      = "contractset"
+	SettingDownloads        = "downloads"
 	SettingGouging          = "gouging"
+	SettingMaintenance      = "maintenance"
 	SettingRedundancy       = "redundancy"
 	SettingS3Authentication = "s3authentication"
 	SettingUploadPacking    = "uploadpacking"
@@ -28,6 +32,14 @@ type (
 		Default string `json:"default"`
 	}
 
+	// DownloadSettings contains the settings that dictate how workers choose
+	// the hosts to download from.
+	DownloadSettings struct {
+		// CostSaver makes workers prefer cheaper hosts over faster ones when
+		// choosing which shards of a slab to download.
+		CostSaver bool `json:"costSaver"`
+	}
+
 	// GougingSettings contain some price settings used in price gouging.
 	GougingSettings struct {
 		// MinMaxCollateral is the minimum value for 'MaxCollateral' in the host's
@@ -70,11 +82,38 @@ type (
 	RedundancySettings struct {
 		MinShards   int `json:"minShards"`
 		TotalShards int `json:"totalShards"`
+
+		// MaxShardsPerTagValue limits the number of shards of a slab that are
+		// uploaded to hosts sharing the same value for a tag, keyed by the
+		// tag's key.
+		MaxShardsPerTagValue map[string]int `json:"maxShardsPerTagValue,omitempty"`
+
+		// MaxHostStorage, if set, limits the amount of data in bytes that is
+		// stored on a single host, shards are not uploaded to hosts that
+		// reached the limit.
+		MaxHostStorage uint64 `json:"maxHostStorage,omitempty"`
+
+		// MaxHostStoragePct, if set, limits the amount of data stored on a
+		// single host to the given fraction of the data stored across all
+		// hosts.
+		MaxHostStoragePct float64 `json:"maxHostStoragePct,omitempty"`
 	}
 
 	// S3AuthenticationSettings contains S3 auth settings.
 	S3AuthenticationSettings struct {
 		V4Keypairs map[string]string `json:"v4Keypairs"`
+
+		// V4KeypairLimits limits the uploads of the keypair with the given
+		// access key, keypairs without limits are only limited by the
+		// policies of the buckets they upload to.
+		V4KeypairLimits map[string]S3KeypairLimits `json:"v4KeypairLimits,omitempty"`
+	}
+
+	// S3KeypairLimits contains the limits of an S3 keypair.
+	S3KeypairLimits struct {
+		// MaxObjectSize is the maximum size of an object uploaded with the
+		// keypair, 0 means unlimited.
+		MaxObjectSize uint64 `json:"maxObjectSize,omitempty"`
 	}
 
 	// UploadPackingSettings contains upload packing settings.
@@ -82,8 +121,25 @@ type (
 		Enabled               bool  `json:"enabled"`
 		SlabBufferMaxSizeSoft int64 `json:"slabBufferMaxSizeSoft"`
 	}
+
+	// MaintenanceSettings contains the maintenance mode settings. While the
+	// maintenance mode is active workers reject uploads and migrations but
+	// keep serving downloads.
+	MaintenanceSettings struct {
+		Enabled bool `json:"enabled"`
+
+		// Until is the time at which the maintenance mode ends
+		// automatically, if it's zero it lasts until it's disabled.
+		Until  time.Time `json:"until"`
+		Reason string    `json:"reason,omitempty"`
+	}
 )
 
+// Active returns true if the maintenance mode is active at the given time.
+func (ms MaintenanceSettings) Active(now time.Time) bool {
+	return ms.Enabled && (ms.Until.IsZero() || now.Before(ms.Until))
+}
+
 // Validate returns an error if the gouging settings are not considered valid.
 func (gs GougingSettings) Validate() error {
 	if gs.HostBlockHeightLeeway < 3 {
@@ -107,6 +163,25 @@ func (rs RedundancySettings) Redundancy() float64 {
 	return float64(rs.TotalShards) / float64(rs.MinShards)
 }
 
+// HostStorageLimit returns the amount of data a single host is allowed to
+// store given the total amount of data stored across the given number of
+// hosts, zero means there is no limit. The percentage never limits a host to
+// less than an even share of the data plus a sector, otherwise nothing could be
+// uploaded to hosts that don't store any data yet.
+func (rs RedundancySettings) HostStorageLimit(total uint64, hosts int) (limit uint64) {
+	limit = rs.MaxHostStorage
+	if rs.MaxHostStoragePct > 0 && hosts > 0 {
+		pctLimit := uint64(rs.MaxHostStoragePct * float64(total))
+		if even := total/uint64(hosts) + rhpv2.SectorSize; pctLimit < even {
+			pctLimit = even
+		}
+		if limit == 0 || pctLimit < limit {
+			limit = pctLimit
+		}
+	}
+	return
+}
+
 // Validate returns an error if the redundancy settings are not considered
 // valid.
 func (rs RedundancySettings) Validate() error {
@@ -119,5 +194,13 @@ func (rs RedundancySettings) Validate() error {
 	if rs.TotalShards > 255 {
 		return errors.New("TotalShards must be less than 256")
 	}
+	if rs.MaxHostStoragePct < 0 || rs.MaxHostStoragePct > 1 {
+		return errors.New("MaxHostStoragePct must be between 0 and 1")
+	}
+	for key, limit := range rs.MaxShardsPerTagValue {
+		if limit < 1 {
+			return fmt.Errorf("MaxShardsPerTagValue for tag '%s' must be greater than 0", key)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceSettingsActive(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		ms   MaintenanceSettings
+		want bool
+	}{
+		{MaintenanceSettings{}, false},
+		{MaintenanceSettings{Until: now.Add(time.Hour)}, false},
+		{MaintenanceSettings{Enabled: true}, true},
+		{MaintenanceSettings{Enabled: true, Until: now.Add(time.Hour)}, true},
+		{MaintenanceSettings{Enabled: true, Until: now}, false},
+		{MaintenanceSettings{Enabled: true, Until: now.Add(-time.Hour)}, false},
+	}
+	for i, test := range tests {
+		if got := test.ms.Active(now); got != test.want {
+			t.Errorf("%d: expected %v, got %v", i, test.want, got)
+		}
+	}
+}
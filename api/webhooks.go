@@ -1,8 +1,131 @@
 package api
 
-import "go.sia.tech/renterd/webhooks"
+import (
+	"time"
 
-type WebHookResponse struct {
-	Webhooks []webhooks.Webhook          `json:"webhooks"`
-	Queues   []webhooks.WebhookQueueInfo `json:"queues"`
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/object"
+	"go.sia.tech/renterd/webhooks"
+)
+
+const (
+	// WebhookModuleHosts is the module of all webhook events that are fired
+	// for hosts we have a contract with.
+	WebhookModuleHosts = "hosts"
+
+	// WebhookEventHostOnline is fired when a host transitions from offline to
+	// online.
+	WebhookEventHostOnline = "online"
+	// WebhookEventHostOffline is fired when a host transitions from online to
+	// offline.
+	WebhookEventHostOffline = "offline"
+	// WebhookEventHostScanFailures is fired when a host failed a configured
+	// number of consecutive scans.
+	WebhookEventHostScanFailures = "scanfailures"
+
+	// WebhookModuleSlabs is the module of all webhook events that are fired
+	// for slabs that require migration.
+	WebhookModuleSlabs = "slabs"
+
+	// WebhookEventSlabDegraded is fired when a slab's health drops below the
+	// migration health cutoff.
+	WebhookEventSlabDegraded = "degraded"
+	// WebhookEventSlabRepaired is fired when a migration restored the health
+	// of a slab for which a degraded event was fired.
+	WebhookEventSlabRepaired = "repaired"
+
+	// WebhookModuleContracts is the module of all webhook events that are
+	// fired for contracts.
+	WebhookModuleContracts = "contracts"
+
+	// WebhookEventContractFormed is fired when a newly formed contract is
+	// added to the bus.
+	WebhookEventContractFormed = "formed"
+	// WebhookEventContractRenewed is fired when a renewed contract is added
+	// to the bus.
+	WebhookEventContractRenewed = "renewed"
+	// WebhookEventContractArchived is fired when a contract is archived.
+	WebhookEventContractArchived = "archived"
+
+	// WebhookModuleObjects is the module of all webhook events that are fired
+	// for objects.
+	WebhookModuleObjects = "objects"
+
+	// WebhookEventObjectCreated is fired when an object is added to the bus,
+	// including the completion of a multipart upload and copies, and no
+	// object existed at its path.
+	WebhookEventObjectCreated = "created"
+	// WebhookEventObjectOverwritten is fired when an object is added to the
+	// bus and replaces the object at its path.
+	WebhookEventObjectOverwritten = "overwritten"
+	// WebhookEventObjectUploaded is fired when an object is added to the
+	// bus, together with either the created or the overwritten event.
+	//
+	// Deprecated: use WebhookEventObjectCreated and
+	// WebhookEventObjectOverwritten instead.
+	WebhookEventObjectUploaded = "uploaded"
+	// WebhookEventObjectDeleted is fired when an object, or all objects with
+	// a given prefix, are deleted.
+	WebhookEventObjectDeleted = "deleted"
+
+	// WebhookModuleConsensus is the module of all webhook events that are
+	// fired for the consensus.
+	WebhookModuleConsensus = "consensus"
+
+	// WebhookEventConsensusSynced is fired when the bus finished syncing the
+	// blockchain.
+	WebhookEventConsensusSynced = "synced"
+)
+
+type (
+	WebHookResponse struct {
+		Webhooks []webhooks.Webhook          `json:"webhooks"`
+		Queues   []webhooks.WebhookQueueInfo `json:"queues"`
+	}
+
+	// HostScanEvent is the payload of the events fired in the hosts module.
+	HostScanEvent struct {
+		HostKey             types.PublicKey `json:"hostKey"`
+		NetAddress          string          `json:"netAddress"`
+		Online              bool            `json:"online"`
+		ConsecutiveFailures uint64          `json:"consecutiveFailures"`
+		ScanError           string          `json:"scanError,omitempty"`
+		Timestamp           time.Time       `json:"timestamp"`
+	}
+
+	// SlabHealthEvent is the payload of the events fired in the slabs module.
+	// The health is the health of the slab at the time it was found to be
+	// degraded.
+	SlabHealthEvent struct {
+		Key       object.EncryptionKey `json:"key"`
+		Health    float64              `json:"health"`
+		Bucket    string               `json:"bucket,omitempty"`
+		Objects   []string             `json:"objects"`
+		Timestamp time.Time            `json:"timestamp"`
+	}
+
+	// ContractEvent is the payload of the events fired in the contracts
+	// module.
+	ContractEvent struct {
+		ContractID  types.FileContractID `json:"contractID"`
+		HostKey     types.PublicKey      `json:"hostKey"`
+		RenewedFrom types.FileContractID `json:"renewedFrom,omitempty"`
+		Reason      string               `json:"reason,omitempty"`
+		Timestamp   time.Time            `json:"timestamp"`
+	}
+
+	// ObjectEvent is the payload of the events fired in the objects module,
+	// for batch deletions the path is the prefix of the deleted objects.
+	ObjectEvent struct {
+		Bucket    string    `json:"bucket"`
+		Path      string    `json:"path"`
+		Batch     bool      `json:"batch,omitempty"`
+		Size      int64     `json:"size,omitempty"`
+		Timestamp time.Time `json:"timestamp"`
+	}
+)
+
+// ObjectScope implements the webhooks.ObjectPayload interface.
+func (e ObjectEvent) ObjectScope() (bucket, path string, batch bool) {
+	return e.Bucket, e.Path, e.Batch
 }
@@ -11,6 +11,43 @@ import (
 	rhpv2 "go.sia.tech/core/rhp/v2"
 	rhpv3 "go.sia.tech/core/rhp/v3"
 	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/object"
+)
+
+const (
+	// ObjectTrailerSize is the HTTP trailer a client can set when uploading a
+	// stream of unknown length to finalize the size of the object.
+	ObjectTrailerSize = "X-Sia-Object-Size"
+
+	// ObjectTrailerChecksum is the HTTP trailer a client can set when
+	// uploading a stream of unknown length to finalize the checksum of the
+	// object, it's expected to match the object's ETag.
+	ObjectTrailerChecksum = "X-Sia-Object-Checksum"
+
+	// ObjectCostHeader is the HTTP header the worker sets to the total amount
+	// of hastings it spent on hosts serving an upload or download. Downloads
+	// only include it as a trailer, and only if the client asked for it.
+	ObjectCostHeader = "X-Sia-Object-Cost"
+
+	// ObjectCostBreakdownHeader is the HTTP header the worker sets to a JSON
+	// encoded map of the hastings spent per host, it's only set if the client
+	// asked for it.
+	ObjectCostBreakdownHeader = "X-Sia-Object-Cost-Breakdown"
+)
+
+const (
+	UploadErrorCategoryConnection = "connection"
+	UploadErrorCategoryContract   = "contract"
+	UploadErrorCategoryFunds      = "funds"
+	UploadErrorCategoryGouging    = "gouging"
+	UploadErrorCategoryTimeout    = "timeout"
+	UploadErrorCategoryUnknown    = "unknown"
+)
+
+const (
+	DenyReasonCorruptData     = "corrupt data"
+	DenyReasonPaymentRejected = "payment rejected"
 )
 
 var (
@@ -21,9 +58,51 @@ var (
 	// ErrContractSetNotSpecified is returned by the worker API by endpoints that
 	// need a contract set to be able to upload data.
 	ErrContractSetNotSpecified = errors.New("contract set is not specified")
+
+	// ErrObjectTrailerMismatch is returned by the worker API when the size or
+	// checksum trailer of an upload doesn't match the uploaded data.
+	ErrObjectTrailerMismatch = errors.New("object trailer mismatch")
+
+	// ErrObjectTooLarge is returned by the bus and worker APIs when an object
+	// exceeds the max object size of its bucket.
+	ErrObjectTooLarge = errors.New("object exceeds the bucket's max object size")
+
+	// ErrBucketQuotaExceeded is returned by the bus and worker APIs when
+	// adding an object exceeds the max stored bytes of its bucket.
+	ErrBucketQuotaExceeded = errors.New("bucket exceeds its max stored bytes")
+
+	// ErrMaintenanceMode is returned by the worker API when an upload or
+	// migration is rejected because the maintenance mode is active.
+	ErrMaintenanceMode = errors.New("uploads and migrations are paused for maintenance")
+
+	// ErrUploadFundsExhausted is returned by the worker API when an upload is
+	// projected to exhaust the remaining funds of the contracts it's uploaded
+	// to before it completes.
+	ErrUploadFundsExhausted = errors.New("upload would exhaust the remaining contract funds")
+
+	// ErrTooManyHostKeys is returned by the worker API when too many host
+	// keys are passed to the /hosts/pricetables endpoint.
+	ErrTooManyHostKeys = errors.New("too many host keys")
+
+	// ErrHostNotDenied is returned by the worker API when a host is removed
+	// from the deny list while it isn't denied.
+	ErrHostNotDenied = errors.New("host is not denied")
+
+	// ErrUploadStagingDisabled is returned by the worker API when an upload
+	// is staged while the worker has no staging directory configured.
+	ErrUploadStagingDisabled = errors.New("upload staging is disabled")
 )
 
 type (
+	// DeniedHost is a host the worker temporarily doesn't use because it
+	// misbehaved.
+	DeniedHost struct {
+		HostKey types.PublicKey `json:"hostKey"`
+		Reason  string          `json:"reason"`
+		Error   string          `json:"error"`
+		Until   time.Time       `json:"until"`
+	}
+
 	// AccountsLockHandlerRequest is the request type for the /accounts/:id/lock
 	// endpoint.
 	AccountsLockHandlerRequest struct {
@@ -51,11 +130,55 @@ type (
 		Error     string     `json:"error,omitempty"`
 	}
 
+	// HostGougingResponse is the response type for the /host/:hostkey/gouging
+	// endpoint, it compares the host's live price table to the gouging
+	// settings field by field and contains the overall verdict.
+	HostGougingResponse struct {
+		HostKey    types.PublicKey      `json:"hostKey"`
+		PriceTable rhpv3.HostPriceTable `json:"priceTable"`
+		Fields     []GougingField       `json:"fields"`
+		Breakdown  HostGougingBreakdown `json:"breakdown"`
+		Gouging    bool                 `json:"gouging"`
+	}
+
+	// GougingField compares a single field of a host's prices to the limit
+	// imposed on it by the gouging settings.
+	GougingField struct {
+		Name    string `json:"name"`
+		Value   string `json:"value"`
+		Limit   string `json:"limit"`
+		Gouging bool   `json:"gouging"`
+	}
+
 	// MigrateSlabResponse is the response type for the /slab/migrate endpoint.
 	MigrateSlabResponse struct {
 		NumShardsMigrated int `json:"numShardsMigrated"`
 	}
 
+	// VerifyObjectRequest is the request type for the /objects/verify
+	// endpoint.
+	VerifyObjectRequest struct {
+		Bucket string `json:"bucket"`
+		Path   string `json:"path"`
+	}
+
+	// VerifyObjectResponse is the response type for the /objects/verify
+	// endpoint. The hash is computed over the downloaded plaintext and only
+	// matches the ETag of objects that weren't uploaded in multiple parts,
+	// see IsMultipartETag.
+	VerifyObjectResponse struct {
+		Duration  DurationMS `json:"duration"`
+		ETagMatch bool       `json:"eTagMatch"`
+		Hash      string     `json:"hash"`
+		Size      int64      `json:"size"`
+	}
+
+	// UploadSlabResponse is the response type for the /slab/upload endpoint.
+	UploadSlabResponse struct {
+		Slab          object.SlabSlice                         `json:"slab"`
+		UsedContracts map[types.PublicKey]types.FileContractID `json:"usedContracts"`
+	}
+
 	// RHPFormRequest is the request type for the /rhp/form endpoint.
 	RHPFormRequest struct {
 		EndHeight      uint64          `json:"endHeight"`
@@ -95,6 +218,37 @@ type (
 		Error     error  `json:"error,omitempty"`
 	}
 
+	// RHPDeleteSectorsRequest is the request type for the
+	// /rhp/contract/:id/deletesectors endpoint.
+	RHPDeleteSectorsRequest struct {
+		Roots []types.Hash256 `json:"roots"`
+	}
+
+	// RHPDeleteSectorsResponse is the response type for the
+	// /rhp/contract/:id/deletesectors endpoint. Skipped is the number of
+	// sectors that weren't deleted because the host doesn't store them or
+	// because they are still referenced by the bus.
+	RHPDeleteSectorsResponse struct {
+		Deleted uint64 `json:"deleted"`
+		Skipped uint64 `json:"skipped"`
+	}
+
+	// FetchPriceTablesRequest is the request type for the worker's
+	// /hosts/pricetables endpoint.
+	FetchPriceTablesRequest struct {
+		HostKeys []types.PublicKey `json:"hostKeys"`
+		Timeout  DurationMS        `json:"timeout"`
+	}
+
+	// HostPriceTableResult contains the price table fetched from a host, or the
+	// error that occurred while fetching it, and how long that took.
+	HostPriceTableResult struct {
+		HostKey    types.PublicKey        `json:"hostKey"`
+		PriceTable *hostdb.HostPriceTable `json:"priceTable,omitempty"`
+		Latency    DurationMS             `json:"latency"`
+		Error      string                 `json:"error,omitempty"`
+	}
+
 	// RHPPriceTableRequest is the request type for the /rhp/pricetable endpoint.
 	RHPPriceTableRequest struct {
 		HostKey    types.PublicKey `json:"hostKey"`
@@ -138,6 +292,19 @@ type (
 		PriceTable rhpv3.HostPriceTable `json:"priceTable,omitempty"`
 	}
 
+	// RHPPriceTablesRefreshRequest is the request type for the
+	// /rhp/pricetables/refresh endpoint.
+	RHPPriceTablesRefreshRequest struct {
+		HostKeys []types.PublicKey `json:"hostKeys"`
+	}
+
+	// RHPPriceTablesRefreshResponse is the response type for the
+	// /rhp/pricetables/refresh endpoint.
+	RHPPriceTablesRefreshResponse struct {
+		Refreshed int `json:"refreshed"`
+		Failed    int `json:"failed"`
+	}
+
 	// RHPSyncRequest is the request type for the /rhp/sync endpoint.
 	RHPSyncRequest struct {
 		ContractID types.FileContractID `json:"contractID"`
@@ -179,11 +346,24 @@ type (
 		HealthyDownloaders   uint64            `json:"healthyDownloaders"`
 		NumDownloaders       uint64            `json:"numDownloaders"`
 		DownloadersStats     []DownloaderStats `json:"downloadersStats"`
+		SectorCache          *SectorCacheStats `json:"sectorCache,omitempty"`
+	}
+
+	// SectorCacheStats contains the metrics of the worker's sector cache.
+	SectorCacheStats struct {
+		Entries   uint64 `json:"entries"`
+		Size      uint64 `json:"size"`
+		MaxSize   uint64 `json:"maxSize"`
+		Hits      uint64 `json:"hits"`
+		Misses    uint64 `json:"misses"`
+		Evictions uint64 `json:"evictions"`
 	}
 	DownloaderStats struct {
 		AvgSectorDownloadSpeedMBPS float64         `json:"avgSectorDownloadSpeedMBPS"`
 		HostKey                    types.PublicKey `json:"hostKey"`
 		NumDownloads               uint64          `json:"numDownloads"`
+		NumFallbacks               uint64          `json:"numFallbacks"`
+		QueueLength                uint64          `json:"queueLength"`
 	}
 
 	// UploadStatsResponse is the response type for the /stats/uploads endpoint.
@@ -193,33 +373,141 @@ type (
 		HealthyUploaders       uint64          `json:"healthyUploaders"`
 		NumUploaders           uint64          `json:"numUploaders"`
 		UploadersStats         []UploaderStats `json:"uploadersStats"`
+
+		// MaxOverdrive is the max overdrive currently in use, it changes
+		// over time if AutoTuned is set. MaxConcurrentSectorsPerHost is the
+		// configured upper bound of the number of sectors uploaded to a host
+		// in parallel, the number in use is tuned per host and reported in
+		// the uploader stats.
+		AutoTuned                   bool   `json:"autoTuned"`
+		MaxOverdrive                uint64 `json:"maxOverdrive"`
+		MaxConcurrentSectorsPerHost uint64 `json:"maxConcurrentSectorsPerHost"`
+
+		// Pipeline contains gauges on the state of the upload pipeline.
+		Pipeline UploadPipelineStats `json:"pipeline"`
 	}
 	UploaderStats struct {
 		HostKey                  types.PublicKey `json:"hostKey"`
 		AvgSectorUploadSpeedMBPS float64         `json:"avgSectorUploadSpeedMBPS"`
+		QueueLength              uint64          `json:"queueLength"`
+
+		// MaxConcurrentSectors is the number of sectors that are uploaded to
+		// the host in parallel, it's tuned per host if auto-tuning is on.
+		MaxConcurrentSectors uint64 `json:"maxConcurrentSectors"`
+	}
+
+	// UploadPipelineStats contains gauges on the queues and channels of the
+	// upload pipeline, they allow for diagnosing stalls in the pipeline.
+	UploadPipelineStats struct {
+		// QueuedSectors and InflightSectors are the number of sectors that
+		// are queued in, or being uploaded by, the uploaders.
+		QueuedSectors   uint64 `json:"queuedSectors"`
+		InflightSectors uint64 `json:"inflightSectors"`
+
+		// PendingSectorResponses and PendingSlabResponses are the number of
+		// sector and slab uploads that are done but whose response hasn't
+		// been received yet.
+		PendingSectorResponses uint64 `json:"pendingSectorResponses"`
+		PendingSlabResponses   uint64 `json:"pendingSlabResponses"`
+
+		// WaitingForParents is the number of sector uploads that wait for
+		// the slabs that were started before theirs to finish before an
+		// uploader is selected.
+		WaitingForParents uint64 `json:"waitingForParents"`
+
+		// AvgNextSlabWaitMS is the average time an upload waits to be
+		// triggered to read its next slab, AvgParentsWaitMS is the average
+		// time a sector upload waits for its parents.
+		AvgNextSlabWaitMS float64 `json:"avgNextSlabWaitMS"`
+		AvgParentsWaitMS  float64 `json:"avgParentsWaitMS"`
+	}
+
+	// WorkerJobQueue contains the state of the queue of a class of jobs the
+	// worker schedules.
+	WorkerJobQueue struct {
+		Class   string `json:"class"`
+		Limit   uint64 `json:"limit"`
+		Queued  uint64 `json:"queued"`
+		Running uint64 `json:"running"`
 	}
 
 	// WorkerStateResponse is the response type for the /worker/state endpoint.
 	WorkerStateResponse struct {
 		ID        string    `json:"id"`
 		StartTime time.Time `json:"startTime"`
+
+		// SettingsVersion is the most recent version of the bus' settings
+		// the worker fetched, the worker fetches the settings from the bus
+		// for every operation so changes take effect immediately.
+		SettingsVersion uint64 `json:"settingsVersion"`
+
+		// JobQueues holds the number of running and queued jobs per job
+		// class, ordered by priority.
+		JobQueues []WorkerJobQueue `json:"jobQueues"`
 		BuildState
 	}
 
 	UploadObjectResponse struct {
-		ETag string `json:"etag"`
+		ETag string         `json:"etag"`
+		Cost types.Currency `json:"cost"`
+
+		// StagedUpload is set if the upload was staged, in which case the
+		// object is uploaded to the hosts in the background.
+		StagedUpload *StagedUpload `json:"stagedUpload,omitempty"`
+	}
+
+	// StagedUpload describes an upload that was staged on the worker's disk
+	// and acknowledged, it's uploaded to the hosts in the background and
+	// retried until it succeeds.
+	StagedUpload struct {
+		ID          string    `json:"id"`
+		Bucket      string    `json:"bucket"`
+		Path        string    `json:"path"`
+		Size        int64     `json:"size"`
+		StagedAt    time.Time `json:"stagedAt"`
+		Attempts    int       `json:"attempts"`
+		LastAttempt time.Time `json:"lastAttempt"`
+		LastError   string    `json:"lastError,omitempty"`
+	}
+
+	// UploadError is the body the worker responds with when an upload failed
+	// because a slab couldn't be uploaded to enough hosts. It lists the hosts
+	// that failed along with the category of their error.
+	UploadError struct {
+		Message string            `json:"error"`
+		Hosts   []UploadHostError `json:"hosts"`
+	}
+
+	// UploadHostError describes the errors a single host returned while
+	// uploading a slab, Error is the most recent one.
+	UploadHostError struct {
+		HostKey  types.PublicKey `json:"hostKey"`
+		Category string          `json:"category"`
+		Attempts int             `json:"attempts"`
+		Error    string          `json:"error"`
 	}
 
 	UploadMultipartUploadPartResponse struct {
-		ETag string `json:"etag"`
+		ETag string         `json:"etag"`
+		Cost types.Currency `json:"cost"`
 	}
 
 	GetObjectResponse struct {
-		Content     io.ReadCloser  `json:"content"`
-		ContentType string         `json:"contentType"`
-		ModTime     time.Time      `json:"modTime"`
-		Range       *DownloadRange `json:"range,omitempty"`
-		Size        int64          `json:"size"`
+		Content     io.ReadCloser      `json:"content"`
+		ContentType string             `json:"contentType"`
+		ETag        string             `json:"etag"`
+		Metadata    ObjectUserMetadata `json:"metadata,omitempty"`
+		ModTime     time.Time          `json:"modTime"`
+		Range       *DownloadRange     `json:"range,omitempty"`
+		Size        int64              `json:"size"`
+	}
+
+	HeadObjectResponse struct {
+		ContentType string             `json:"contentType"`
+		ETag        string             `json:"etag"`
+		Metadata    ObjectUserMetadata `json:"metadata,omitempty"`
+		ModTime     time.Time          `json:"modTime"`
+		Size        int64              `json:"size"`
 	}
 )
 
@@ -261,3 +549,8 @@ func ParseDownloadRange(contentRange string) (DownloadRange, error) {
 		Size:   size,
 	}, nil
 }
+
+// Error implements error.
+func (e *UploadError) Error() string {
+	return e.Message
+}
@@ -16,15 +16,14 @@ import (
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/tracing"
 	"go.uber.org/zap"
-	"lukechampine.com/frand"
 )
 
 var errMaxDriftExceeded = errors.New("drift on account is too large")
 
 var (
-	alertAccountRefillID = frand.Entropy256() // constant across restarts
+	alertAccountRefillID = types.HashBytes([]byte("accountrefill")) // constant across restarts
+	alertAccountDriftID  = types.HashBytes([]byte("accountdrift"))  // constant across restarts
 
-	minBalance  = types.Siacoins(1).Div64(2).Big()
 	maxBalance  = types.Siacoins(1)
 	maxNegDrift = new(big.Int).Neg(types.Siacoins(10).Big())
 )
@@ -38,8 +37,32 @@ type accounts struct {
 
 	refillInterval time.Duration
 
+	// unconfirmedFundingLimit is the balance up to which an account is
+	// funded while the contract that pays for it is unconfirmed.
+	unconfirmedFundingLimit types.Currency
+
+	// drift is the policy that decides when an account's drift is large
+	// enough to resync the account and alert the user.
+	drift driftPolicy
+
+	// resync detects when the node caught up with a large number of blocks
+	// to sweep the accounts that are likely to be stale.
+	resync resyncSweeper
+
 	mu                sync.Mutex
 	inProgressRefills map[types.Hash256]struct{}
+	syncedDrift       map[rhpv3.Account]*big.Int
+}
+
+// driftPolicy describes the drift above which an account is considered to be
+// misbehaving. A zero value disables the policy.
+type driftPolicy struct {
+	// maxDrift is the absolute drift above which the policy triggers.
+	maxDrift types.Currency
+
+	// maxDriftPct is the drift above which the policy triggers, as a fraction
+	// of the balance accounts are refilled to.
+	maxDriftPct float64
 }
 
 type AccountStore interface {
@@ -52,7 +75,7 @@ type ContractStore interface {
 	ContractSetContracts(ctx context.Context, set string) ([]api.ContractMetadata, error)
 }
 
-func newAccounts(ap *Autopilot, a AccountStore, c ContractStore, w *workerPool, l *zap.SugaredLogger, refillInterval time.Duration) *accounts {
+func newAccounts(ap *Autopilot, a AccountStore, c ContractStore, w *workerPool, l *zap.SugaredLogger, refillInterval time.Duration, unconfirmedFundingLimit types.Currency, drift driftPolicy) *accounts {
 	return &accounts{
 		ap: ap,
 		a:  a,
@@ -60,9 +83,91 @@ func newAccounts(ap *Autopilot, a AccountStore, c ContractStore, w *workerPool,
 		l:  l.Named("accounts"),
 		w:  w,
 
-		refillInterval:    refillInterval,
-		inProgressRefills: make(map[types.Hash256]struct{}),
+		refillInterval:          refillInterval,
+		unconfirmedFundingLimit: unconfirmedFundingLimit,
+		drift:                   drift,
+		inProgressRefills:       make(map[types.Hash256]struct{}),
+		syncedDrift:             make(map[rhpv3.Account]*big.Int),
+	}
+}
+
+// exceeded returns true if the absolute value of the given drift exceeds
+// either of the policy's thresholds.
+func (p driftPolicy) exceeded(drift *big.Int, target types.Currency) bool {
+	if drift == nil {
+		return false
+	}
+	abs := new(big.Int).Abs(drift)
+	if !p.maxDrift.IsZero() && abs.Cmp(p.maxDrift.Big()) > 0 {
+		return true
+	}
+	if p.maxDriftPct > 0 {
+		limit, _ := new(big.Float).Mul(new(big.Float).SetInt(target.Big()), big.NewFloat(p.maxDriftPct)).Int(nil)
+		if abs.Cmp(limit) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// markDriftSynced records that the account was synced at the given drift and
+// returns false if it was already synced at that drift. Syncing doesn't reset
+// the drift, so this prevents resyncing the account every refill until the
+// drift changes again or is reset.
+func (a *accounts) markDriftSynced(id rhpv3.Account, drift *big.Int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if synced, ok := a.syncedDrift[id]; ok && synced.Cmp(drift) == 0 {
+		return false
+	}
+	a.syncedDrift[id] = new(big.Int).Set(drift)
+	return true
+}
+
+// checkDrift resyncs the worker's account with the contract's host and
+// registers an alert if the account's drift exceeds the drift policy. The
+// alert is dismissed once the drift drops below the policy's thresholds again,
+// e.g. after the drift was reset.
+func (a *accounts) checkDrift(ctx context.Context, w Worker, contract api.ContractMetadata) error {
+	if a.drift == (driftPolicy{}) {
+		return nil
+	}
+
+	// fetch the account
+	accountID, err := w.Account(ctx, contract.HostKey)
+	if err != nil {
+		return err
+	}
+	account, err := a.a.Account(ctx, accountID, contract.HostKey)
+	if err != nil {
+		return err
+	}
+
+	alertID := types.HashBytes(append(alertAccountDriftID[:], accountID[:]...))
+	if !a.drift.exceeded(account.Drift, maxBalance) {
+		return a.ap.alerts.DismissAlerts(ctx, alertID)
 	}
+
+	// resync the account once per drift value
+	if a.markDriftSynced(accountID, account.Drift) {
+		if err := w.RHPSync(ctx, contract.ID, contract.HostKey, contract.HostIP, contract.SiamuxAddr); err != nil {
+			a.l.Errorw(fmt.Sprintf("failed to sync account with excessive drift: %v", err), "account", accountID, "host", contract.HostKey)
+		}
+	}
+
+	return a.ap.alerts.RegisterAlert(ctx, alerts.Alert{
+		ID:       alertID,
+		Severity: alerts.SeverityWarning,
+		Message:  "account drift exceeds the configured threshold",
+		Data: map[string]interface{}{
+			"accountID":  accountID.String(),
+			"contractID": contract.ID.String(),
+			"hostKey":    contract.HostKey.String(),
+			"balance":    account.Balance.String(),
+			"drift":      account.Drift.String(),
+		},
+		Timestamp: time.Now(),
+	})
 }
 
 func (a *accounts) markRefillInProgress(workerID string, host types.PublicKey) bool {
@@ -149,16 +254,32 @@ func (a *accounts) refillWorkerAccounts(w Worker) {
 		inContractSet[contract.ID] = struct{}{}
 	}
 
+	// fetch the contracts that are not confirmed yet
+	unconfirmed, uErr := a.unconfirmedContracts(ctx)
+	if uErr != nil {
+		a.l.Errorw(fmt.Sprintf("failed to fetch unconfirmed contracts for refill: %v", uErr))
+	}
+
 	// refill accounts in separate goroutines
 	for _, c := range contracts {
 		// add logging for contracts in the set
 		_, inSet := inContractSet[c.ID]
 
+		// limit the funding of accounts paid for by unconfirmed contracts
+		target, ok := refillTarget(c.ID, unconfirmed, a.unconfirmedFundingLimit)
+		if !ok {
+			a.l.Debugw("skipping refill, contract is unconfirmed", "contract", c.ID, "host", c.HostKey)
+			continue
+		}
+
 		// launch refill if not already in progress
 		if a.markRefillInProgress(workerID, c.HostKey) {
-			go func(contract api.ContractMetadata, inSet bool) {
+			go func(contract api.ContractMetadata, inSet bool, target types.Currency) {
 				rCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-				accountID, refilled, rerr := refillWorkerAccount(rCtx, a.a, a.ap.bus, w, workerID, contract)
+				if err := a.checkDrift(rCtx, w, contract); err != nil {
+					a.l.Errorw(fmt.Sprintf("failed to check account drift: %v", err), "host", contract.HostKey)
+				}
+				accountID, refilled, rerr := refillWorkerAccount(rCtx, a.a, a.ap.bus, w, workerID, contract, target)
 				shouldLog := rerr != nil && (inSet || rerr.Is(errMaxDriftExceeded))
 				if shouldLog {
 					a.l.Errorw(rerr.err.Error(), rerr.keysAndValues...)
@@ -166,7 +287,7 @@ func (a *accounts) refillWorkerAccounts(w Worker) {
 					a.l.Infow("Successfully funded account",
 						"account", accountID,
 						"host", contract.HostKey,
-						"balance", maxBalance,
+						"balance", target,
 					)
 				}
 
@@ -196,9 +317,40 @@ func (a *accounts) refillWorkerAccounts(w Worker) {
 				}
 				a.markRefillDone(workerID, contract.HostKey)
 				cancel()
-			}(c, inSet)
+			}(c, inSet, target)
+		}
+	}
+}
+
+// refillTarget returns the balance up to which an account that is paid for by
+// the given contract is refilled. Accounts paid for by unconfirmed contracts
+// are only funded up to the unconfirmed funding limit, if no limit is set they
+// aren't funded at all until the contract is confirmed.
+func refillTarget(fcid types.FileContractID, unconfirmed map[types.FileContractID]struct{}, unconfirmedFundingLimit types.Currency) (types.Currency, bool) {
+	if _, ok := unconfirmed[fcid]; !ok {
+		return maxBalance, true
+	} else if unconfirmedFundingLimit.IsZero() {
+		return types.ZeroCurrency, false
+	} else if unconfirmedFundingLimit.Cmp(maxBalance) < 0 {
+		return unconfirmedFundingLimit, true
+	}
+	return maxBalance, true
+}
+
+// unconfirmedContracts returns the ids of all contracts whose formation or
+// renewal transaction is still in the transaction pool.
+func (a *accounts) unconfirmedContracts(ctx context.Context) (map[types.FileContractID]struct{}, error) {
+	txns, err := a.ap.bus.TransactionPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unconfirmed := make(map[types.FileContractID]struct{})
+	for _, txn := range txns {
+		for i := range txn.FileContracts {
+			unconfirmed[txn.FileContractID(i)] = struct{}{}
 		}
 	}
+	return unconfirmed, nil
 }
 
 type refillError struct {
@@ -217,7 +369,9 @@ func (err *refillError) Error() string {
 	return err.err.Error()
 }
 
-func refillWorkerAccount(ctx context.Context, a AccountStore, am alerts.Alerter, w Worker, workerID string, contract api.ContractMetadata) (accountID rhpv3.Account, refilled bool, rerr *refillError) {
+// refillWorkerAccount refills the worker's account with the contract's host
+// up to the target balance once its balance dropped below half of the target.
+func refillWorkerAccount(ctx context.Context, a AccountStore, am alerts.Alerter, w Worker, workerID string, contract api.ContractMetadata, target types.Currency) (accountID rhpv3.Account, refilled bool, rerr *refillError) {
 	wrapErr := func(err error, keysAndValues ...interface{}) *refillError {
 		if err == nil {
 			return nil
@@ -230,7 +384,7 @@ func refillWorkerAccount(ctx context.Context, a AccountStore, am alerts.Alerter,
 
 	// add tracing
 	ctx, span := tracing.Tracer.Start(ctx, "refillAccount")
-	span.SetAttributes(attribute.Stringer("host", contract.HostKey))
+	tracing.SetDetailedAttributes(ctx, span, attribute.Stringer("host", contract.HostKey))
 	defer func() {
 		if rerr != nil {
 			span.RecordError(rerr.err)
@@ -253,7 +407,7 @@ func refillWorkerAccount(ctx context.Context, a AccountStore, am alerts.Alerter,
 	}
 
 	// update span
-	span.SetAttributes(attribute.Stringer("account", account.ID))
+	tracing.SetDetailedAttributes(ctx, span, attribute.Stringer("account", account.ID))
 	span.SetAttributes(attribute.Stringer("balance", account.Balance))
 
 	// check if a host is potentially cheating before refilling.
@@ -291,19 +445,19 @@ func refillWorkerAccount(ctx context.Context, a AccountStore, am alerts.Alerter,
 	}
 
 	// check if refill is needed
-	if account.Balance.Cmp(minBalance) >= 0 {
+	if account.Balance.Cmp(target.Div64(2).Big()) >= 0 {
 		rerr = wrapErr(err)
 		return
 	}
 
 	// fund the account
-	err = w.RHPFund(ctx, contract.ID, contract.HostKey, contract.HostIP, contract.SiamuxAddr, maxBalance)
+	err = w.RHPFund(ctx, contract.ID, contract.HostKey, contract.HostIP, contract.SiamuxAddr, target)
 	if err != nil {
 		rerr = wrapErr(fmt.Errorf("failed to fund account: %w", err),
 			"account", account.ID,
 			"host", contract.HostKey,
 			"balance", account.Balance,
-			"expected", maxBalance,
+			"expected", target,
 		)
 	} else {
 		refilled = true
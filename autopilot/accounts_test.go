@@ -0,0 +1,123 @@
+package autopilot
+
+import (
+	"math/big"
+	"testing"
+
+	rhpv3 "go.sia.tech/core/rhp/v3"
+	"go.sia.tech/core/types"
+)
+
+func TestDriftPolicy(t *testing.T) {
+	target := types.Siacoins(10)
+	sc := func(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), types.Siacoins(1).Big()) }
+
+	tests := []struct {
+		policy   driftPolicy
+		drift    *big.Int
+		exceeded bool
+	}{
+		// disabled policy never triggers
+		{driftPolicy{}, sc(100), false},
+		{driftPolicy{}, nil, false},
+
+		// absolute threshold applies to both positive and negative drift
+		{driftPolicy{maxDrift: types.Siacoins(5)}, sc(5), false},
+		{driftPolicy{maxDrift: types.Siacoins(5)}, sc(6), true},
+		{driftPolicy{maxDrift: types.Siacoins(5)}, sc(-6), true},
+
+		// relative threshold is a fraction of the target
+		{driftPolicy{maxDriftPct: 0.5}, sc(5), false},
+		{driftPolicy{maxDriftPct: 0.5}, sc(-6), true},
+
+		// either threshold triggers the policy
+		{driftPolicy{maxDrift: types.Siacoins(100), maxDriftPct: 0.5}, sc(6), true},
+		{driftPolicy{maxDrift: types.Siacoins(1), maxDriftPct: 0.5}, sc(2), true},
+	}
+	for i, test := range tests {
+		if exceeded := test.policy.exceeded(test.drift, target); exceeded != test.exceeded {
+			t.Fatalf("%d: unexpected result %v != %v", i, exceeded, test.exceeded)
+		}
+	}
+}
+
+func TestMarkDriftSynced(t *testing.T) {
+	a := &accounts{syncedDrift: make(map[rhpv3.Account]*big.Int)}
+	id := rhpv3.Account{1}
+
+	if !a.markDriftSynced(id, big.NewInt(-10)) {
+		t.Fatal("expected account to be synced")
+	} else if a.markDriftSynced(id, big.NewInt(-10)) {
+		t.Fatal("expected account not to be synced again at the same drift")
+	} else if !a.markDriftSynced(id, big.NewInt(-20)) {
+		t.Fatal("expected account to be synced after the drift changed")
+	}
+}
+
+func TestResyncSweeper(t *testing.T) {
+	var s resyncSweeper
+
+	// the first observation is used as reference, even if not synced
+	if s.observe(100, false) {
+		t.Fatal("unexpected sweep")
+	} else if s.observe(110, true) {
+		t.Fatal("unexpected sweep")
+	}
+
+	// small jumps don't trigger a sweep
+	if s.observe(110+resyncSweepMinHeightJump-1, true) {
+		t.Fatal("unexpected sweep")
+	}
+
+	// a large jump while catching up triggers a sweep once synced
+	height := uint64(110 + resyncSweepMinHeightJump - 1)
+	if s.observe(height+10, false) {
+		t.Fatal("unexpected sweep")
+	} else if !s.observe(height+resyncSweepMinHeightJump, true) {
+		t.Fatal("expected sweep")
+	}
+
+	// only one sweep is launched at a time
+	if !s.start() {
+		t.Fatal("expected sweep to start")
+	} else if s.start() {
+		t.Fatal("unexpected sweep")
+	}
+	s.observe(height+3*resyncSweepMinHeightJump, true)
+	if s.start() {
+		t.Fatal("sweep shouldn't start while another one is running")
+	}
+	s.finish()
+	if !s.start() {
+		t.Fatal("expected pending sweep to start")
+	}
+}
+
+func TestRefillTarget(t *testing.T) {
+	confirmed, unconfirmed := types.FileContractID{1}, types.FileContractID{2}
+	pool := map[types.FileContractID]struct{}{unconfirmed: {}}
+
+	tests := []struct {
+		fcid   types.FileContractID
+		limit  types.Currency
+		target types.Currency
+		ok     bool
+	}{
+		// confirmed contracts always refill up to the max balance
+		{confirmed, types.ZeroCurrency, maxBalance, true},
+		{confirmed, types.Siacoins(1).Div64(10), maxBalance, true},
+		// unconfirmed contracts don't fund accounts unless a limit is set
+		{unconfirmed, types.ZeroCurrency, types.ZeroCurrency, false},
+		{unconfirmed, types.Siacoins(1).Div64(10), types.Siacoins(1).Div64(10), true},
+		// the limit never exceeds the max balance
+		{unconfirmed, maxBalance.Mul64(2), maxBalance, true},
+	}
+	for i, test := range tests {
+		target, ok := refillTarget(test.fcid, pool, test.limit)
+		if ok != test.ok {
+			t.Fatalf("%d: unexpected ok, %v != %v", i, ok, test.ok)
+		} else if !target.Equals(test.target) {
+			t.Fatalf("%d: unexpected target, %v != %v", i, target, test.target)
+		}
+	}
+}
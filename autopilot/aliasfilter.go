@@ -0,0 +1,68 @@
+package autopilot
+
+import (
+	"errors"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/hostdb"
+)
+
+var errHostAlias = errors.New("host is an alias of a host we already use")
+
+type (
+	// aliasFilter treats hosts that are likely the same physical host
+	// announced under different keys as a single failure domain. Hosts are
+	// grouped by the subnets their net address resolves to, using the IP
+	// filter's resolver and prefixes, combined with their settings.
+	aliasFilter struct {
+		ipFilter *ipFilter
+		groups   map[types.Hash256]types.PublicKey
+	}
+)
+
+func newAliasFilter(ipFilter *ipFilter) *aliasFilter {
+	return &aliasFilter{
+		ipFilter: ipFilter,
+		groups:   make(map[types.Hash256]types.PublicKey),
+	}
+}
+
+// IsAlias returns true if the filter already contains another host of one of
+// the given host's alias groups, if not the host is added to the filter.
+func (f *aliasFilter) IsAlias(h hostdb.Host) bool {
+	groups := f.aliasGroups(h)
+	for _, group := range groups {
+		if hk, found := f.groups[group]; found && hk != h.PublicKey {
+			return true
+		}
+	}
+	for _, group := range groups {
+		f.groups[group] = h.PublicKey
+	}
+	return false
+}
+
+// aliasGroups returns the alias groups of the given host, a host without
+// settings has no alias groups. If the host's net address can't be resolved
+// we fall back to the alias group computed by the bus, which is based on the
+// announced hostname.
+func (f *aliasFilter) aliasGroups(h hostdb.Host) []types.Hash256 {
+	if h.AliasGroup == (types.Hash256{}) {
+		return nil
+	}
+
+	addrs, err := f.ipFilter.resolver.lookup(h.NetAddress)
+	if err != nil {
+		return []types.Hash256{h.AliasGroup}
+	}
+	subnets := parseSubnets(addrs, f.ipFilter.ipv4Range, f.ipFilter.ipv6Range)
+	if len(subnets) == 0 {
+		return []types.Hash256{h.AliasGroup}
+	}
+
+	groups := make([]types.Hash256, 0, len(subnets))
+	for _, subnet := range subnets {
+		groups = append(groups, hostdb.AliasGroup(subnet, h.Settings))
+	}
+	return groups
+}
@@ -0,0 +1,61 @@
+package autopilot
+
+import (
+	"net"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+	"go.uber.org/zap"
+)
+
+func TestAliasFilter(t *testing.T) {
+	r := newTestIPResolver(map[string][]net.IPAddr{
+		"host1.com": {{IP: net.ParseIP("192.168.0.1")}},
+		"host2.com": {{IP: net.ParseIP("192.168.0.2")}},
+		"host3.com": {{IP: net.ParseIP("192.168.1.1")}},
+	})
+
+	newHost := func(netAddress string) hostdb.Host {
+		h := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+		h.NetAddress = netAddress
+		h.AliasGroup = hostdb.AliasGroup(netAddress, h.Settings)
+		return h
+	}
+
+	// hosts with different hostnames that resolve to the same subnet and
+	// share their settings are aliases
+	h1, h2, h3 := newHost("host1.com:9982"), newHost("host2.com:9982"), newHost("host3.com:9982")
+	f := newAliasFilter(newIPFilter(api.IPFilterConfig{}, r, zap.NewNop().Sugar()))
+	if f.IsAlias(h1) {
+		t.Fatal("unexpected alias")
+	} else if !f.IsAlias(h2) {
+		t.Fatal("expected alias")
+	} else if f.IsAlias(h1) {
+		t.Fatal("host should not be an alias of itself")
+	} else if f.IsAlias(h3) {
+		t.Fatal("unexpected alias")
+	}
+
+	// hosts on the same subnet with different settings are not aliases
+	h4 := newHost("host2.com:9982")
+	h4.Settings.Version = "1.6.0"
+	h4.AliasGroup = hostdb.AliasGroup(h4.NetAddress, h4.Settings)
+	if f.IsAlias(h4) {
+		t.Fatal("unexpected alias")
+	}
+
+	// hosts that can't be resolved fall back to the announced hostname
+	h5, h6 := newHost("unknown.com:9982"), newHost("unknown.com:9983")
+	if f.IsAlias(h5) {
+		t.Fatal("unexpected alias")
+	} else if !f.IsAlias(h6) {
+		t.Fatal("expected alias")
+	}
+
+	// hosts without an alias group are never aliases
+	if f.IsAlias(hostdb.Host{PublicKey: randomHostKey()}) || f.IsAlias(hostdb.Host{PublicKey: types.PublicKey{1}}) {
+		t.Fatal("unexpected alias")
+	}
+}
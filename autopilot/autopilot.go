@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
-	"strings"
 	"sync"
 	"time"
 
@@ -38,17 +37,22 @@ type Bus interface {
 	// Autopilots
 	Autopilot(ctx context.Context, id string) (autopilot api.Autopilot, err error)
 	UpdateAutopilot(ctx context.Context, autopilot api.Autopilot) error
+	AutopilotProfile(ctx context.Context, id, name string) (api.AutopilotProfile, error)
+	ActivateAutopilotProfile(ctx context.Context, id, name string) (api.Autopilot, error)
 
 	// wallet
 	Wallet(ctx context.Context) (api.WalletResponse, error)
 	WalletDiscard(ctx context.Context, txn types.Transaction) error
 	WalletOutputs(ctx context.Context) (resp []wallet.SiacoinElement, err error)
 	WalletPending(ctx context.Context) (resp []types.Transaction, err error)
+	WalletConsolidate(ctx context.Context, outputs, maxInputs int) (id types.TransactionID, err error)
 	WalletRedistribute(ctx context.Context, outputs int, amount types.Currency) (id types.TransactionID, err error)
 
 	// hostdb
 	Host(ctx context.Context, hostKey types.PublicKey) (hostdb.HostInfo, error)
 	Hosts(ctx context.Context, opts api.GetHostsOptions) ([]hostdb.Host, error)
+	HostBlocklist(ctx context.Context) ([]string, error)
+	HostObjects(ctx context.Context, hostKey types.PublicKey, limit int) ([]api.HostObject, error)
 	SearchHosts(ctx context.Context, opts api.SearchHostOptions) ([]hostdb.Host, error)
 	HostsForScanning(ctx context.Context, opts api.HostsForScanningOptions) ([]hostdb.HostAddress, error)
 	RemoveOfflineHosts(ctx context.Context, minRecentScanFailures uint64, maxDowntime time.Duration) (uint64, error)
@@ -59,8 +63,11 @@ type Bus interface {
 	AddRenewedContract(ctx context.Context, c rhpv2.ContractRevision, totalCost types.Currency, startHeight uint64, renewedFrom types.FileContractID) (api.ContractMetadata, error)
 	AncestorContracts(ctx context.Context, id types.FileContractID, minStartHeight uint64) ([]api.ArchivedContract, error)
 	ArchiveContracts(ctx context.Context, toArchive map[types.FileContractID]string) error
+	ContractRoots(ctx context.Context, fcid types.FileContractID) (roots, uploading []types.Hash256, err error)
+	ContractSlabs(ctx context.Context, fcid types.FileContractID, limit int) ([]api.ContractSlab, error)
 	ContractSetContracts(ctx context.Context, set string) ([]api.ContractMetadata, error)
 	FileContractTax(ctx context.Context, payout types.Currency) (types.Currency, error)
+	RenewedContract(ctx context.Context, renewedFrom types.FileContractID) (api.ContractMetadata, error)
 	SetContractSet(ctx context.Context, set string, contracts []types.FileContractID) error
 
 	// txpool
@@ -71,12 +78,18 @@ type Bus interface {
 	ConsensusState(ctx context.Context) (api.ConsensusState, error)
 
 	// objects
+	DeleteHostSector(ctx context.Context, hk types.PublicKey, root types.Hash256) error
+	RemoveSectorDeletions(ctx context.Context, fcid types.FileContractID, roots []types.Hash256) error
+	SectorDeletions(ctx context.Context, limit int) ([]api.ContractSectorDeletions, error)
 	ObjectsBySlabKey(ctx context.Context, bucket string, key object.EncryptionKey) (objects []api.ObjectMetadata, err error)
 	RefreshHealth(ctx context.Context) error
 	Slab(ctx context.Context, key object.EncryptionKey) (object.Slab, error)
+	SlabHealthHistogram(ctx context.Context, set string) (api.SlabHealthHistogram, error)
+	SampleObjects(ctx context.Context, limit int) ([]api.ObjectSample, error)
 	SlabsForMigration(ctx context.Context, healthCutoff float64, set string, limit int) ([]api.UnhealthySlab, error)
 
 	// settings
+	Maintenance(ctx context.Context) (api.MaintenanceResponse, error)
 	UpdateSetting(ctx context.Context, key string, value interface{}) error
 	GougingSettings(ctx context.Context) (gs api.GougingSettings, err error)
 	RedundancySettings(ctx context.Context) (rs api.RedundancySettings, err error)
@@ -85,15 +98,20 @@ type Bus interface {
 type Worker interface {
 	Account(ctx context.Context, hostKey types.PublicKey) (rhpv3.Account, error)
 	RHPBroadcast(ctx context.Context, fcid types.FileContractID) (err error)
+	RHPContractRoots(ctx context.Context, fcid types.FileContractID) ([]types.Hash256, error)
+	RHPDeleteSectors(ctx context.Context, fcid types.FileContractID, roots []types.Hash256) (api.RHPDeleteSectorsResponse, error)
 	Contracts(ctx context.Context, hostTimeout time.Duration) (api.ContractsResponse, error)
 	ID(ctx context.Context) (string, error)
-	MigrateSlab(ctx context.Context, s object.Slab, set string) (api.MigrateSlabResponse, error)
+	MigrateSlab(ctx context.Context, s object.Slab, set, bucket string) (api.MigrateSlabResponse, error)
+	MigrateSlabFromHost(ctx context.Context, s object.Slab, set, bucket string, hk types.PublicKey) (api.MigrateSlabResponse, error)
 	RHPForm(ctx context.Context, endHeight uint64, hk types.PublicKey, hostIP string, renterAddress types.Address, renterFunds types.Currency, hostCollateral types.Currency) (rhpv2.ContractRevision, []types.Transaction, error)
 	RHPFund(ctx context.Context, contractID types.FileContractID, hostKey types.PublicKey, hostIP, siamuxAddr string, balance types.Currency) (err error)
 	RHPPriceTable(ctx context.Context, hostKey types.PublicKey, siamuxAddr string, timeout time.Duration) (hostdb.HostPriceTable, error)
+	RHPRefreshPriceTables(ctx context.Context, hostKeys []types.PublicKey) (api.RHPPriceTablesRefreshResponse, error)
 	RHPRenew(ctx context.Context, fcid types.FileContractID, endHeight uint64, hk types.PublicKey, hostIP string, hostAddress, renterAddress types.Address, renterFunds, newCollateral types.Currency, windowSize uint64) (rhpv2.ContractRevision, []types.Transaction, error)
 	RHPScan(ctx context.Context, hostKey types.PublicKey, hostIP string, timeout time.Duration) (api.RHPScanResponse, error)
 	RHPSync(ctx context.Context, contractID types.FileContractID, hostKey types.PublicKey, hostIP, siamuxAddr string) (err error)
+	VerifyObject(ctx context.Context, bucket, path string) (api.VerifyObjectResponse, error)
 }
 
 type Autopilot struct {
@@ -104,8 +122,12 @@ type Autopilot struct {
 	logger  *zap.SugaredLogger
 	workers *workerPool
 
-	mu    sync.Mutex
-	state state
+	mu                  sync.Mutex
+	state               state
+	contractRootsOffset int
+
+	loops    loopTracker
+	restores restoreResults
 
 	a *accounts
 	c *contractor
@@ -167,14 +189,22 @@ func (wp *workerPool) withWorkers(workerFunc func([]Worker)) {
 
 // Handler returns an HTTP handler that serves the autopilot api.
 func (ap *Autopilot) Handler() http.Handler {
-	return jape.Mux(tracing.TracedRoutes(api.DefaultAutopilotID, map[string]jape.Handler{
-		"GET    /config":        ap.configHandlerGET,
-		"PUT    /config":        ap.configHandlerPUT,
-		"POST   /debug/trigger": ap.triggerHandlerPOST,
-		"POST   /hosts":         ap.hostsHandlerPOST,
-		"GET    /host/:hostKey": ap.hostHandlerGET,
-		"GET    /state":         ap.stateHandlerGET,
-	}))
+	return api.WithErrorEnvelope(jape.Mux(tracing.TracedRoutes(api.DefaultAutopilotID, map[string]jape.Handler{
+		"GET    /config":                       ap.configHandlerGET,
+		"PUT    /config":                       ap.configHandlerPUT,
+		"POST   /contract/:id/roots/reconcile": ap.contractRootsReconcileHandlerPOST,
+		"POST   /debug/trigger":                ap.triggerHandlerPOST,
+		"POST   /hosts":                        ap.hostsHandlerPOST,
+		"GET    /host/:hostKey":                ap.hostHandlerGET,
+		"GET    /hosts/:hostKey/score":         ap.hostScoreHandlerGET,
+		"GET    /migrations":                   ap.migrationsHandlerGET,
+		"POST   /plan":                         ap.planHandlerPOST,
+		"POST   /profiles/:name/activate":      ap.profileActivateHandlerPOST,
+		"GET    /restoredrill":                 ap.restoreDrillHandlerGET,
+		"GET    /sla":                          ap.slaHandlerGET,
+		"GET    /state":                        ap.stateHandlerGET,
+		"GET    /status":                       ap.statusHandlerGET,
+	})))
 }
 
 func (ap *Autopilot) Run() error {
@@ -196,6 +226,7 @@ func (ap *Autopilot) Run() error {
 	var launchAccountRefillsOnce sync.Once
 	for {
 		ap.logger.Info("autopilot iteration starting")
+		ap.loops.scheduleNextIteration(time.Now().Add(ap.tickerDuration))
 		tickerFired := make(chan struct{})
 		ap.workers.withWorker(func(w Worker) {
 			defer ap.logger.Info("autopilot iteration ended")
@@ -250,6 +281,10 @@ func (ap *Autopilot) Run() error {
 				return
 			}
 
+			// sync the accounts if the node caught up with a large number of
+			// blocks
+			ap.a.launchResyncSweep()
+
 			// perform wallet maintenance
 			err = ap.c.performWalletMaintenance(ctx)
 			if err != nil {
@@ -279,6 +314,21 @@ func (ap *Autopilot) Run() error {
 				ap.logger.Errorf("contract maintenance failed, err: %v", err)
 			}
 
+			// check the storage SLA
+			ap.checkSLA(ctx)
+
+			// verify the roots of a subset of the contracts
+			ap.tryVerifyContractRoots()
+
+			// delete the sectors of deleted objects from the hosts
+			ap.deleteQueuedSectors(ctx, w)
+
+			// move data off of overloaded hosts
+			ap.rebalance(ctx, w)
+
+			// prove a sample of the objects is restorable
+			ap.tryPerformRestoreDrill()
+
 			// migration
 			ap.m.tryPerformMigrations(ctx, ap.workers)
 		})
@@ -289,6 +339,7 @@ func (ap *Autopilot) Run() error {
 		case forceScan = <-ap.triggerChan:
 			ap.logger.Info("autopilot iteration triggered")
 			ap.ticker.Reset(ap.tickerDuration)
+			ap.loops.scheduleNextIteration(time.Now())
 		case <-ap.ticker.C:
 		case <-tickerFired:
 		}
@@ -356,7 +407,7 @@ func (ap *Autopilot) blockUntilConfigured(interrupt <-chan time.Time) (configure
 		cancel()
 
 		// if the config was not found, or we were unable to fetch it, keep blocking
-		if err != nil && strings.Contains(err.Error(), api.ErrAutopilotNotFound.Error()) {
+		if err != nil && errors.Is(api.ParseError(err), api.ErrAutopilotNotFound) {
 			once.Do(func() { ap.logger.Info("autopilot is waiting to be configured...") })
 		} else if err != nil {
 			ap.logger.Errorf("autopilot is unable to fetch its configuration from the bus, err: %v", err)
@@ -388,6 +439,8 @@ func (ap *Autopilot) blockUntilSynced(interrupt <-chan time.Time) (synced, inter
 		// if an error occurred, or if we're not synced, we continue
 		if err != nil {
 			ap.logger.Errorf("failed to get consensus state, err: %v", err)
+		} else {
+			ap.a.resync.observe(cs.BlockHeight, cs.Synced)
 		}
 		if err != nil || !cs.Synced {
 			select {
@@ -465,6 +518,20 @@ func (ap *Autopilot) updateState(ctx context.Context) error {
 		}
 	}
 
+	// derive the number of contracts from the target capacity
+	if target := autopilot.Config.Contracts.TargetCapacity; target > 0 {
+		hosts, err := ap.bus.Hosts(ctx, api.GetHostsOptions{})
+		if err != nil {
+			return fmt.Errorf("could not fetch hosts, err: %v", err)
+		}
+		if amount := contractsForTargetCapacity(target, rs, hosts); amount > 0 {
+			ap.logger.Debugf("target capacity of %d bytes requires %d contracts", target, amount)
+			autopilot.Config.Contracts.Amount = amount
+		} else {
+			ap.logger.Warnf("unable to derive contracts from target capacity, falling back to %d contracts", autopilot.Config.Contracts.Amount)
+		}
+	}
+
 	// update the state
 	ap.mu.Lock()
 	ap.state = state{
@@ -491,7 +558,7 @@ func (ap *Autopilot) isStopped() bool {
 
 func (ap *Autopilot) configHandlerGET(jc jape.Context) {
 	autopilot, err := ap.bus.Autopilot(jc.Request.Context(), ap.id)
-	if err != nil && strings.Contains(err.Error(), api.ErrAutopilotNotFound.Error()) {
+	if err != nil && errors.Is(api.ParseError(err), api.ErrAutopilotNotFound) {
 		jc.Error(errors.New("autopilot is not configured yet"), http.StatusNotFound)
 		return
 	}
@@ -513,13 +580,14 @@ func (ap *Autopilot) configHandlerPUT(jc jape.Context) {
 	// fetch the autopilot and update its config
 	var contractSetChanged bool
 	autopilot, err := ap.bus.Autopilot(jc.Request.Context(), ap.id)
-	if err != nil && strings.Contains(err.Error(), api.ErrAutopilotNotFound.Error()) {
+	if err != nil && errors.Is(api.ParseError(err), api.ErrAutopilotNotFound) {
 		autopilot = api.Autopilot{ID: ap.id, Config: cfg}
 	} else {
 		if autopilot.Config.Contracts.Set != cfg.Contracts.Set {
 			contractSetChanged = true
 		}
 		autopilot.Config = cfg
+		autopilot.Profile = "" // config no longer matches the profile
 	}
 
 	// update the autopilot and interrupt migrations if necessary
@@ -528,6 +596,50 @@ func (ap *Autopilot) configHandlerPUT(jc jape.Context) {
 	}
 }
 
+func (ap *Autopilot) profileActivateHandlerPOST(jc jape.Context) {
+	var name string
+	if jc.DecodeParam("name", &name) != nil {
+		return
+	}
+	autopilot, err := ap.activateProfile(jc.Request.Context(), name)
+	if errors.Is(api.ParseError(err), api.ErrAutopilotProfileNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("failed to activate autopilot profile", err) == nil {
+		jc.Encode(autopilot)
+	}
+}
+
+// activateProfile replaces the autopilot's config by the config of the profile
+// with the given name, just like updating the config it interrupts migrations
+// if the contract set changed.
+func (ap *Autopilot) activateProfile(ctx context.Context, name string) (api.Autopilot, error) {
+	profile, err := ap.bus.AutopilotProfile(ctx, ap.id, name)
+	if err != nil {
+		return api.Autopilot{}, err
+	} else if err := profile.Config.Validate(); err != nil {
+		return api.Autopilot{}, fmt.Errorf("invalid autopilot config: %w", err)
+	}
+
+	// fetch the current contract set
+	var prevSet string
+	prev, err := ap.bus.Autopilot(ctx, ap.id)
+	if err == nil {
+		prevSet = prev.Config.Contracts.Set
+	} else if !errors.Is(api.ParseError(err), api.ErrAutopilotNotFound) {
+		return api.Autopilot{}, err
+	}
+
+	// activate the profile and interrupt migrations if necessary
+	autopilot, err := ap.bus.ActivateAutopilotProfile(ctx, ap.id, name)
+	if err != nil {
+		return api.Autopilot{}, err
+	} else if autopilot.Config.Contracts.Set != prevSet {
+		ap.m.SignalMaintenanceFinished()
+	}
+	return autopilot, nil
+}
+
 func (ap *Autopilot) triggerHandlerPOST(jc jape.Context) {
 	var req api.AutopilotTriggerRequest
 	if jc.Decode(&req) != nil {
@@ -539,7 +651,7 @@ func (ap *Autopilot) triggerHandlerPOST(jc jape.Context) {
 }
 
 // New initializes an Autopilot.
-func New(id string, bus Bus, workers []Worker, logger *zap.Logger, heartbeat time.Duration, scannerScanInterval time.Duration, scannerBatchSize, scannerMinRecentFailures, scannerNumThreads uint64, migrationHealthCutoff float64, accountsRefillInterval time.Duration, revisionSubmissionBuffer, migratorParallelSlabsPerWorker uint64, revisionBroadcastInterval time.Duration) (*Autopilot, error) {
+func New(id string, bus Bus, workers []Worker, logger *zap.Logger, heartbeat time.Duration, scannerScanInterval time.Duration, scannerBatchSize, scannerMinRecentFailures, scannerNumThreads uint64, migrationHealthCutoff float64, accountsRefillInterval time.Duration, accountsUnconfirmedFundingLimit, accountsMaxDrift types.Currency, accountsMaxDriftPct float64, revisionSubmissionBuffer, migratorParallelSlabsPerWorker, migratorMaxSlabsPerMinute uint64, revisionBroadcastInterval time.Duration) (*Autopilot, error) {
 	ap := &Autopilot{
 		alerts:  alerts.WithOrigin(bus, fmt.Sprintf("autopilot.%s", id)),
 		id:      id,
@@ -564,8 +676,14 @@ func New(id string, bus Bus, workers []Worker, logger *zap.Logger, heartbeat tim
 
 	ap.s = scanner
 	ap.c = newContractor(ap, revisionSubmissionBuffer, revisionBroadcastInterval)
-	ap.m = newMigrator(ap, migrationHealthCutoff, migratorParallelSlabsPerWorker)
-	ap.a = newAccounts(ap, ap.bus, ap.bus, ap.workers, ap.logger, accountsRefillInterval)
+	ap.m = newMigrator(ap, migrationHealthCutoff, migratorParallelSlabsPerWorker, migratorMaxSlabsPerMinute)
+	if accountsMaxDriftPct < 0 || accountsMaxDriftPct > 1 {
+		return nil, fmt.Errorf("max drift percentage must be between 0 and 1, got %v", accountsMaxDriftPct)
+	}
+	ap.a = newAccounts(ap, ap.bus, ap.bus, ap.workers, ap.logger, accountsRefillInterval, accountsUnconfirmedFundingLimit, driftPolicy{
+		maxDrift:    accountsMaxDrift,
+		maxDriftPct: accountsMaxDriftPct,
+	})
 
 	return ap, nil
 }
@@ -583,11 +701,87 @@ func (ap *Autopilot) hostHandlerGET(jc jape.Context) {
 	jc.Encode(host)
 }
 
+func (ap *Autopilot) hostScoreHandlerGET(jc jape.Context) {
+	var hostKey types.PublicKey
+	if jc.DecodeParam("hostKey", &hostKey) != nil {
+		return
+	}
+
+	score, err := ap.c.HostScore(jc.Request.Context(), hostKey)
+	if jc.Check("failed to get host score", err) != nil {
+		return
+	}
+	jc.Encode(score)
+}
+
+func (ap *Autopilot) planHandlerPOST(jc jape.Context) {
+	var req api.AutopilotPlanRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+
+	// decide what config to evaluate
+	cfg := ap.State().cfg
+	if req.Profile != "" {
+		profile, err := ap.bus.AutopilotProfile(jc.Request.Context(), ap.id, req.Profile)
+		if err != nil && errors.Is(api.ParseError(err), api.ErrAutopilotProfileNotFound) {
+			jc.Error(err, http.StatusNotFound)
+			return
+		} else if jc.Check("failed to fetch autopilot profile", err) != nil {
+			return
+		}
+		cfg = profile.Config
+	} else if req.Config != nil {
+		cfg = *req.Config
+	}
+
+	plan, err := ap.c.Plan(jc.Request.Context(), cfg)
+	if jc.Check("failed to plan config", err) != nil {
+		return
+	}
+	plan.Profile = req.Profile
+	jc.Encode(plan)
+}
+
+func (ap *Autopilot) slaHandlerGET(jc jape.Context) {
+	sla, err := ap.computeSLA(jc.Request.Context())
+	if err != nil && errors.Is(api.ParseError(err), api.ErrAutopilotNotFound) {
+		jc.Error(errors.New("autopilot is not configured yet"), http.StatusNotFound)
+		return
+	} else if jc.Check("failed to compute SLA", err) != nil {
+		return
+	}
+	jc.Encode(sla)
+}
+
+func (ap *Autopilot) contractRootsReconcileHandlerPOST(jc jape.Context) {
+	var fcid types.FileContractID
+	if jc.DecodeParam("id", &fcid) != nil {
+		return
+	}
+	diff, err := ap.reconcileContractRoots(jc.Request.Context(), fcid)
+	if errors.Is(api.ParseError(err), api.ErrContractNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("failed to reconcile contract roots", err) != nil {
+		return
+	}
+	jc.Encode(diff)
+}
+
+func (ap *Autopilot) migrationsHandlerGET(jc jape.Context) {
+	jc.Encode(ap.m.Outcomes())
+}
+
+func (ap *Autopilot) restoreDrillHandlerGET(jc jape.Context) {
+	jc.Encode(ap.restores.response())
+}
+
 func (ap *Autopilot) stateHandlerGET(jc jape.Context) {
 	migrating, mLastStart := ap.m.Status()
 	scanning, sLastStart := ap.s.Status()
 	_, err := ap.bus.Autopilot(jc.Request.Context(), ap.id)
-	if err != nil && !strings.Contains(err.Error(), api.ErrAutopilotNotFound.Error()) {
+	if err != nil && !errors.Is(api.ParseError(err), api.ErrAutopilotNotFound) {
 		jc.Error(err, http.StatusInternalServerError)
 		return
 	}
@@ -611,6 +805,27 @@ func (ap *Autopilot) stateHandlerGET(jc jape.Context) {
 	})
 }
 
+func (ap *Autopilot) statusHandlerGET(jc jape.Context) {
+	// the scanner and pruner only run if a scan is required, which is checked
+	// at the start of every iteration
+	_, sLastStart := ap.s.Status()
+	nextScan := sLastStart.Add(ap.s.scanMinInterval / 20)
+
+	jc.Encode(api.AutopilotStatusResponse{
+		Loops: map[string]api.AutopilotLoopStatus{
+			loopContractor:      ap.loops.status(loopContractor, time.Time{}),
+			loopContractRoots:   ap.loops.status(loopContractRoots, ap.loops.lastStart(loopContractRoots).Add(contractRootsInterval)),
+			loopMigrator:        ap.loops.status(loopMigrator, time.Time{}),
+			loopPruner:          ap.loops.status(loopPruner, nextScan),
+			loopRebalancer:      ap.loops.status(loopRebalancer, time.Time{}),
+			loopRestoreDrill:    ap.loops.status(loopRestoreDrill, ap.loops.lastStart(loopRestoreDrill).Add(restoreDrillInterval)),
+			loopScanner:         ap.loops.status(loopScanner, nextScan),
+			loopSectorDeletions: ap.loops.status(loopSectorDeletions, time.Time{}),
+		},
+		Budget: ap.c.Budget(),
+	})
+}
+
 func (ap *Autopilot) hostsHandlerPOST(jc jape.Context) {
 	var req api.SearchHostsRequest
 	if jc.Decode(&req) != nil {
@@ -9,6 +9,11 @@ import (
 	"go.sia.tech/renterd/api"
 )
 
+func init() {
+	// request JSON error envelopes so errors can be identified by their code
+	api.RequestErrorEnvelopes()
+}
+
 // A Client provides methods for interacting with a renterd API server.
 type Client struct {
 	c jape.Client
@@ -32,11 +37,32 @@ func (c *Client) UpdateConfig(cfg api.AutopilotConfig) error {
 	return c.c.PUT("/config", cfg)
 }
 
+// ActivateProfile replaces the autopilot's config by the config of the profile
+// with the given name.
+func (c *Client) ActivateProfile(ctx context.Context, name string) (autopilot api.Autopilot, err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/profiles/%s/activate", name), nil, &autopilot)
+	return
+}
+
 func (c *Client) HostInfo(hostKey types.PublicKey) (resp api.HostHandlerResponse, err error) {
 	err = c.c.GET(fmt.Sprintf("/host/%s", hostKey), &resp)
 	return
 }
 
+// HostScore returns the score breakdown of the given host and the reasons it
+// is considered unusable, if any.
+func (c *Client) HostScore(ctx context.Context, hostKey types.PublicKey) (resp api.HostScoreResponse, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/hosts/%s/score", hostKey), &resp)
+	return
+}
+
+// Plan estimates the impact of applying the config of the given profile, or
+// the given config if no profile is specified, without changing anything.
+func (c *Client) Plan(ctx context.Context, profile string, cfg *api.AutopilotConfig) (resp api.AutopilotPlanResponse, err error) {
+	err = c.c.WithContext(ctx).POST("/plan", api.AutopilotPlanRequest{Profile: profile, Config: cfg}, &resp)
+	return
+}
+
 func (c *Client) HostInfos(ctx context.Context, filterMode, usabilityMode string, addressContains string, keyIn []types.PublicKey, offset, limit int) (resp []api.HostHandlerResponse, err error) {
 	err = c.c.POST("/hosts", api.SearchHostsRequest{
 		Offset:          offset,
@@ -49,12 +75,48 @@ func (c *Client) HostInfos(ctx context.Context, filterMode, usabilityMode string
 	return
 }
 
+// Migrations returns the outcome of the slab migrations performed by the
+// migrator within the recent window.
+func (c *Client) Migrations() (resp api.MigrationsResponse, err error) {
+	err = c.c.GET("/migrations", &resp)
+	return
+}
+
+// ReconcileContractRoots marks the sectors the host of the given contract is
+// missing as lost and returns the difference between the roots the host
+// stores and the ones the bus expects it to store.
+func (c *Client) ReconcileContractRoots(ctx context.Context, fcid types.FileContractID) (diff api.ContractRootsDiff, err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/contract/%s/roots/reconcile", fcid), nil, &diff)
+	return
+}
+
+// RestoreDrill returns the outcome of the restores performed by the restore
+// drill within the recent window.
+func (c *Client) RestoreDrill() (resp api.RestoreDrillResponse, err error) {
+	err = c.c.GET("/restoredrill", &resp)
+	return
+}
+
+// SLA returns the storage SLA score of the autopilot's contract set along
+// with the components it was computed from.
+func (c *Client) SLA() (sla api.SLAResponse, err error) {
+	err = c.c.GET("/sla", &sla)
+	return
+}
+
 // State returns the current state of the autopilot.
 func (c *Client) State() (state api.AutopilotStateResponse, err error) {
 	err = c.c.GET("/state", &state)
 	return
 }
 
+// Status returns when each of the autopilot's loops last ran, how long it took,
+// what it changed and when it is scheduled to run next.
+func (c *Client) Status() (status api.AutopilotStatusResponse, err error) {
+	err = c.c.GET("/status", &status)
+	return
+}
+
 func (c *Client) Trigger(forceScan bool) (_ bool, err error) {
 	var resp api.AutopilotTriggerResponse
 	err = c.c.POST("/debug/trigger", api.AutopilotTriggerRequest{ForceScan: forceScan}, &resp)
@@ -2,9 +2,11 @@ package autopilot
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
+	"net"
 	"sort"
 	"strings"
 	"sync"
@@ -27,8 +29,8 @@ import (
 )
 
 var (
-	alertLowBalanceID    = frand.Entropy256() // constant until restarted
-	alertRenewalFailedID = frand.Entropy256() // constant until restarted
+	alertLowBalanceID    = types.HashBytes([]byte("lowbalance"))    // constant across restarts
+	alertRenewalFailedID = types.HashBytes([]byte("renewalfailed")) // constant across restarts
 )
 
 const (
@@ -40,6 +42,11 @@ const (
 	// contract.
 	estimatedFileContractTransactionSetSize = 2048
 
+	// maxDefragInputs is the maximum number of outputs that are consolidated
+	// in a single wallet defrag transaction, it keeps the transaction within
+	// reasonable size limits.
+	maxDefragInputs = 500
+
 	// leewayPctCandidateHosts is the leeway we apply when fetching candidate
 	// hosts, we fetch ~10% more than required
 	leewayPctCandidateHosts = 1.1
@@ -98,11 +105,14 @@ type (
 		revisionBroadcastInterval time.Duration
 		revisionLastBroadcast     map[types.FileContractID]time.Time
 		revisionSubmissionBuffer  uint64
+		missedProofAlerts         map[types.PublicKey]time.Time
 
 		mu               sync.Mutex
 		cachedHostInfo   map[types.PublicKey]hostInfo
 		cachedDataStored map[types.PublicKey]uint64
 		cachedMinScore   float64
+		blockedRanges    []*net.IPNet
+		budget           *api.AutopilotBudget
 	}
 
 	hostInfo struct {
@@ -133,10 +143,11 @@ func newContractor(ap *Autopilot, revisionSubmissionBuffer uint64, revisionBroad
 		revisionBroadcastInterval: revisionBroadcastInterval,
 		revisionLastBroadcast:     make(map[types.FileContractID]time.Time),
 		revisionSubmissionBuffer:  revisionSubmissionBuffer,
+		missedProofAlerts:         make(map[types.PublicKey]time.Time),
 	}
 }
 
-func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) (bool, error) {
+func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) (_ bool, err error) {
 	ctx, span := tracing.Tracer.Start(ctx, "contractor.performContractMaintenance")
 	defer span.End()
 
@@ -146,6 +157,11 @@ func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) (
 	}
 	c.logger.Info("performing contract maintenance")
 
+	// keep track of what the maintenance changed
+	changes := make(map[string]uint64)
+	c.ap.loops.start(loopContractor)
+	defer func() { c.ap.loops.finish(loopContractor, changes, err) }()
+
 	// convenience variables
 	state := c.ap.State()
 
@@ -170,9 +186,15 @@ func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) (
 		return false, nil
 	}
 
+	// refresh the blocked IP ranges, hosts that resolve to an IP within one
+	// of these ranges are considered blocked
+	if err := c.refreshBlockedRanges(ctx); err != nil {
+		return false, err
+	}
+
 	// fetch current contract set
 	currentSet, err := c.ap.bus.ContractSetContracts(ctx, state.cfg.Contracts.Set)
-	if err != nil && !strings.Contains(err.Error(), api.ErrContractSetNotFound.Error()) {
+	if err != nil && !errors.Is(api.ParseError(err), api.ErrContractSetNotFound) {
 		return false, err
 	}
 	isInCurrentSet := make(map[types.FileContractID]struct{})
@@ -215,12 +237,23 @@ func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) (
 		hostData[c.HostKey] += c.FileSize()
 	}
 
+	// keep track of the contracts with preferred hosts
+	preferred := make(map[types.FileContractID]struct{})
+	for _, c := range contracts {
+		if isPreferredHost(state.cfg, c.HostKey) {
+			preferred[c.ID] = struct{}{}
+		}
+	}
+
 	// fetch all hosts
 	hosts, err := c.ap.bus.Hosts(ctx, api.GetHostsOptions{})
 	if err != nil {
 		return false, err
 	}
 
+	// alert on hosts that missed a storage proof
+	c.alertMissedProofs(ctx, state.cfg, hosts)
+
 	// min score to pass checks.
 	var minScore float64
 	if len(hosts) > 0 {
@@ -271,6 +304,8 @@ func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) (
 		c.logger.Debugf("archiving %d contracts: %+v", len(toArchive), toArchive)
 		if err := c.ap.bus.ArchiveContracts(ctx, toArchive); err != nil {
 			c.logger.Errorf("failed to archive contracts, err: %v", err) // continue
+		} else {
+			changes["archived"] = uint64(len(toArchive))
 		}
 	}
 
@@ -279,6 +314,7 @@ func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) (
 	if err != nil {
 		return false, err
 	}
+	defer func() { c.updateBudget(state, remaining) }()
 
 	// calculate 'limit' amount of contracts we want to renew
 	var limit int
@@ -308,11 +344,15 @@ func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) (
 	if limit > 0 {
 		var toKeep []contractInfo
 		renewed, toKeep = c.runContractRenewals(ctx, w, toRenew, &remaining, limit)
+		changes["renewed"] = uint64(len(renewed))
 		for _, ri := range renewed {
 			if ri.ci.usable || ri.ci.recoverable {
 				updatedSet = append(updatedSet, ri.to)
 			}
 			contractData[ri.to] = contractData[ri.from]
+			if _, ok := preferred[ri.from]; ok {
+				preferred[ri.to] = struct{}{}
+			}
 		}
 		for _, ci := range toKeep {
 			updatedSet = append(updatedSet, ci.contract.ID)
@@ -324,11 +364,15 @@ func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) (
 	if err != nil {
 		c.logger.Errorf("failed to refresh contracts, err: %v", err) // continue
 	} else {
+		changes["refreshed"] = uint64(len(refreshed))
 		for _, ri := range refreshed {
 			if ri.ci.usable || ri.ci.recoverable {
 				updatedSet = append(updatedSet, ri.to)
 			}
 			contractData[ri.to] = contractData[ri.from]
+			if _, ok := preferred[ri.from]; ok {
+				preferred[ri.to] = struct{}{}
+			}
 		}
 	}
 
@@ -340,16 +384,29 @@ func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) (
 		threshold = addLeeway(threshold, leewayPctRequiredContracts)
 	}
 
+	// preferred hosts we don't have a contract with yet always get one,
+	// regardless of whether we're missing contracts
+	missingPreferred := missingPreferredHosts(state.cfg, hosts, usedHosts)
+
 	// check if we need to form contracts and add them to the contract set
 	var formed []types.FileContractID
-	if uint64(len(updatedSet)) < threshold {
-		formed, err = c.runContractFormations(ctx, w, hosts, usedHosts, state.cfg.Contracts.Amount-uint64(len(updatedSet)), &remaining, minScore)
+	if uint64(len(updatedSet)) < threshold || missingPreferred > 0 {
+		var missing uint64
+		if uint64(len(updatedSet)) < threshold {
+			missing = state.cfg.Contracts.Amount - uint64(len(updatedSet))
+		}
+		formedContracts, err := c.runContractFormations(ctx, w, hosts, usedHosts, missing, &remaining, minScore)
 		if err != nil {
 			c.logger.Errorf("failed to form contracts, err: %v", err) // continue
 		} else {
-			for _, fc := range formed {
-				updatedSet = append(updatedSet, fc)
-				contractData[fc] = 0
+			changes["formed"] = uint64(len(formedContracts))
+			for _, fc := range formedContracts {
+				formed = append(formed, fc.ID)
+				updatedSet = append(updatedSet, fc.ID)
+				contractData[fc.ID] = 0
+				if isPreferredHost(state.cfg, fc.HostKey) {
+					preferred[fc.ID] = struct{}{}
+				}
 			}
 		}
 	}
@@ -361,14 +418,28 @@ func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) (
 		}
 	}
 	if len(updatedSet) > int(state.cfg.Contracts.Amount) {
-		// sort by contract size
+		// sort by contract size, contracts with preferred hosts go first
 		sort.Slice(updatedSet, func(i, j int) bool {
+			_, preferredI := preferred[updatedSet[i]]
+			_, preferredJ := preferred[updatedSet[j]]
+			if preferredI != preferredJ {
+				return preferredI
+			}
 			return contractData[updatedSet[i]] > contractData[updatedSet[j]]
 		})
-		for _, c := range updatedSet[state.cfg.Contracts.Amount:] {
+
+		// contracts with preferred hosts are never truncated
+		keep := int(state.cfg.Contracts.Amount)
+		for keep < len(updatedSet) {
+			if _, ok := preferred[updatedSet[keep]]; !ok {
+				break
+			}
+			keep++
+		}
+		for _, c := range updatedSet[keep:] {
 			toStopUsing[c] = "truncated"
 		}
-		updatedSet = updatedSet[:state.cfg.Contracts.Amount]
+		updatedSet = updatedSet[:keep]
 	}
 
 	// update contract set
@@ -553,11 +624,30 @@ func (c *contractor) performWalletMaintenance(ctx context.Context) error {
 		}
 	}
 
-	// enough outputs - nothing to do
+	// fetch spendable outputs
 	available, err := b.WalletOutputs(ctx)
 	if err != nil {
 		return err
 	}
+
+	// too many outputs - consolidate the smallest ones
+	if threshold, outputs := cfg.Wallet.DefragThreshold, cfg.Wallet.Outputs(cfg.Contracts.Amount); threshold > outputs && uint64(len(available)) > threshold {
+		maxInputs := uint64(len(available)) - threshold + outputs
+		if maxInputs > maxDefragInputs {
+			maxInputs = maxDefragInputs
+		}
+		if maxInputs > outputs {
+			id, err := b.WalletConsolidate(ctx, int(outputs), int(maxInputs))
+			if err != nil {
+				return fmt.Errorf("failed to consolidate up to %d wallet outputs into %d outputs, err %v", maxInputs, outputs, err)
+			}
+			l.Debugf("wallet defrag succeeded, tx %v", id)
+			c.maintenanceTxnID = id
+			return nil
+		}
+	}
+
+	// enough outputs - nothing to do
 	if uint64(len(available)) >= cfg.Contracts.Amount {
 		l.Debugf("no wallet maintenance needed, plenty of outputs available (%v>=%v)", len(available), cfg.Contracts.Amount)
 		return nil
@@ -601,7 +691,13 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 	}
 
 	// create new IP filter
-	ipFilter := c.newIPFilter()
+	ipFilter := c.newIPFilter(state.cfg.Hosts.IPFilter)
+
+	// create new tag filter
+	tagFilter := newTagFilter(state.cfg.Hosts.MaxHostsPerTagValue)
+
+	// create new alias filter
+	aliasFilter := newAliasFilter(ipFilter)
 
 	// calculate 'maxKeepLeeway' which defines the amount of contracts we'll be
 	// lenient towards when we fail to either fetch a valid price table or the
@@ -628,9 +724,14 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 	toStopUsing = make(map[types.FileContractID]string)
 
 	// when checking the contracts, do so from largest to smallest. That way, we
-	// prefer larger hosts on redundant networks.
+	// prefer larger hosts on redundant networks. Contracts with preferred hosts
+	// are checked first so their aliases are the ones that get filtered.
 	contracts = append([]api.Contract{}, contracts...)
 	sort.Slice(contracts, func(i, j int) bool {
+		pi, pj := isPreferredHost(state.cfg, contracts[i].HostKey), isPreferredHost(state.cfg, contracts[j].HostKey)
+		if pi != pj {
+			return pi
+		}
 		return contracts[i].FileSize() > contracts[j].FileSize()
 	})
 
@@ -668,7 +769,7 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 		}
 
 		// if the host is blocked we ignore it, it might be unblocked later
-		if host.Blocked {
+		if host.Blocked || ipFilter.IsBlockedIP(host.NetAddress, host.PublicKey) {
 			c.logger.Infow("unusable host", "hk", hk, "fcid", fcid, "reasons", errHostBlocked.Error())
 			toStopUsing[fcid] = errHostBlocked.Error()
 			continue
@@ -714,6 +815,10 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 				toStopUsing[fcid] = errContractNoRevision.Error()
 			} else if !state.cfg.Hosts.AllowRedundantIPs && ipFilter.IsRedundantIP(contract.HostIP, contract.HostKey) {
 				toStopUsing[fcid] = fmt.Sprintf("%v; %v", errHostRedundantIP, errContractNoRevision)
+			} else if tagFilter.IsOverLimit(host.Host) {
+				toStopUsing[fcid] = fmt.Sprintf("%v; %v", errHostTagLimitReached, errContractNoRevision)
+			} else if aliasFilter.IsAlias(host.Host) {
+				toStopUsing[fcid] = fmt.Sprintf("%v; %v", errHostAlias, errContractNoRevision)
 			} else {
 				toKeep = append(toKeep, fcid)
 				remainingKeepLeeway-- // we let it slide
@@ -741,6 +846,24 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 		}
 
 		usable, recoverable, refresh, renew, reasons := c.isUsableContract(state.cfg, ci, cs.BlockHeight, renterFunds, ipFilter)
+
+		// limit the number of hosts per tag value, like the IP check this
+		// has to happen last since it modifies the filter
+		if (usable || recoverable) && !isPreferredHost(state.cfg, hk) && tagFilter.IsOverLimit(host.Host) {
+			reasons = append(reasons, errHostTagLimitReached.Error())
+			usable = false
+			recoverable = false // do not use in the contract set, but keep it around for downloads
+			renew = false       // do not renew, but allow refreshes so the contracts stays funded
+		}
+
+		// treat aliases of a host we already use as a single failure domain,
+		// preferred hosts are never filtered but they are added to the filter
+		if (usable || recoverable) && aliasFilter.IsAlias(host.Host) && !isPreferredHost(state.cfg, hk) {
+			reasons = append(reasons, errHostAlias.Error())
+			usable = false
+			recoverable = false
+			renew = false
+		}
 		ci.usable = usable
 		ci.recoverable = recoverable
 		if !usable {
@@ -770,14 +893,14 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 	return toKeep, toArchive, toStopUsing, toRefresh, toRenew, nil
 }
 
-func (c *contractor) runContractFormations(ctx context.Context, w Worker, hosts []hostdb.Host, usedHosts map[types.PublicKey]struct{}, missing uint64, budget *types.Currency, minScore float64) ([]types.FileContractID, error) {
+func (c *contractor) runContractFormations(ctx context.Context, w Worker, hosts []hostdb.Host, usedHosts map[types.PublicKey]struct{}, missing uint64, budget *types.Currency, minScore float64) ([]api.ContractMetadata, error) {
 	ctx, span := tracing.Tracer.Start(ctx, "runContractFormations")
 	defer span.End()
 
 	if c.ap.isStopped() {
 		return nil, nil
 	}
-	var formed []types.FileContractID
+	var formed []api.ContractMetadata
 
 	// convenience variables
 	state := c.ap.State()
@@ -815,8 +938,19 @@ func (c *contractor) runContractFormations(ctx context.Context, w Worker, hosts
 	// prepare a gouging checker
 	gc := worker.NewGougingChecker(state.gs, cs, state.fee, state.cfg.Contracts.Period, state.cfg.Contracts.RenewWindow)
 
+	// try the reachable preferred hosts before any of the other candidates
+	var preferred []hostdb.Host
+	for _, h := range hosts {
+		if _, used := usedHosts[h.PublicKey]; used || !isPreferredHost(state.cfg, h.PublicKey) {
+			continue
+		} else if usable, _ := isUsableHost(state.cfg, state.rs, gc, h, minScore, 0); usable {
+			preferred = append(preferred, h)
+		}
+	}
+	candidates = append(preferred, candidates...)
+
 	// prepare an IP filter that contains all used hosts
-	ipFilter := c.newIPFilter()
+	ipFilter := c.newIPFilter(state.cfg.Hosts.IPFilter)
 	if shouldFilter {
 		for _, h := range hosts {
 			if _, used := usedHosts[h.PublicKey]; used {
@@ -825,12 +959,29 @@ func (c *contractor) runContractFormations(ctx context.Context, w Worker, hosts
 		}
 	}
 
+	// prepare a tag and alias filter that contain all used hosts
+	tagFilter := newTagFilter(state.cfg.Hosts.MaxHostsPerTagValue)
+	aliasFilter := newAliasFilter(ipFilter)
+	for _, h := range hosts {
+		if _, used := usedHosts[h.PublicKey]; used {
+			_ = tagFilter.IsOverLimit(h)
+			_ = aliasFilter.IsAlias(h)
+		}
+	}
+
 	// calculate min/max contract funds
 	minInitialContractFunds, maxInitialContractFunds := initialContractFundingMinMax(state.cfg)
 
-	for h := 0; missing > 0 && h < len(candidates); h++ {
+	for h := 0; h < len(candidates); h++ {
 		host := candidates[h]
 
+		// contracts with preferred hosts don't count towards the missing
+		// contracts, they come first so we're done once we formed enough
+		isPreferred := isPreferredHost(state.cfg, host.PublicKey)
+		if !isPreferred && missing == 0 {
+			break
+		}
+
 		// break if the autopilot is stopped
 		if c.ap.isStopped() {
 			break
@@ -860,16 +1011,40 @@ func (c *contractor) runContractFormations(ctx context.Context, w Worker, hosts
 			continue
 		}
 
-		// check if we already have a contract with a host on that subnet
-		if shouldFilter && ipFilter.IsRedundantIP(host.NetAddress, host.PublicKey) {
-			continue
+		// preferred hosts skip the IP, tag and alias checks but are added to
+		// the alias filter so we don't form contracts with their aliases
+		if isPreferred {
+			_ = aliasFilter.IsAlias(host)
+		} else {
+			// check if the host resolves to a blocked IP range
+			if ipFilter.IsBlockedIP(host.NetAddress, host.PublicKey) {
+				continue
+			}
+
+			// check if we already have a contract with a host on that subnet
+			if shouldFilter && ipFilter.IsRedundantIP(host.NetAddress, host.PublicKey) {
+				continue
+			}
+
+			// check if we already have enough contracts with hosts that share
+			// one of the host's tags
+			if tagFilter.IsOverLimit(host) {
+				continue
+			}
+
+			// check if we already have a contract with an alias of the host
+			if aliasFilter.IsAlias(host) {
+				continue
+			}
 		}
 
 		formedContract, proceed, err := c.formContract(ctx, w, host, minInitialContractFunds, maxInitialContractFunds, budget)
 		if err == nil {
 			// add contract to contract set
-			formed = append(formed, formedContract.ID)
-			missing--
+			formed = append(formed, formedContract)
+			if !isPreferred {
+				missing--
+			}
 		}
 		if !proceed {
 			break
@@ -1250,6 +1425,11 @@ func (c *contractor) candidateHosts(ctx context.Context, w Worker, hosts []hostd
 			notcompletedscan++
 			continue
 		}
+		// filter out preferred hosts, they are never scored
+		if isPreferredHost(state.cfg, h.PublicKey) {
+			excluded++
+			continue
+		}
 		candidates = append(candidates, h)
 	}
 
@@ -1330,8 +1510,7 @@ func (c *contractor) renewContract(ctx context.Context, w Worker, ci contractInf
 			span.SetStatus(codes.Error, "failed to renew contract")
 		}
 	}()
-	span.SetAttributes(attribute.Stringer("host", ci.contract.HostKey))
-	span.SetAttributes(attribute.Stringer("contract", ci.contract.ID))
+	tracing.SetDetailedAttributes(ctx, span, attribute.Stringer("host", ci.contract.HostKey), attribute.Stringer("contract", ci.contract.ID))
 
 	// convenience variables
 	state := c.ap.State()
@@ -1362,7 +1541,7 @@ func (c *contractor) renewContract(ctx context.Context, w Worker, ci contractInf
 	}
 
 	// sanity check the endheight is not the same on renewals
-	endHeight := endHeight(cfg, state.period)
+	endHeight := hostEndHeight(cfg, state.period, hk)
 	if endHeight <= rev.EndHeight() {
 		c.logger.Debugw("invalid renewal endheight", "oldEndheight", rev.EndHeight(), "newEndHeight", endHeight, "period", state.period, "bh", cs.BlockHeight)
 		return api.ContractMetadata{}, false, fmt.Errorf("renewal endheight should surpass the current contract endheight, %v <= %v", endHeight, rev.EndHeight())
@@ -1414,8 +1593,7 @@ func (c *contractor) refreshContract(ctx context.Context, w Worker, ci contractI
 			span.SetStatus(codes.Error, "failed to refresh contract")
 		}
 	}()
-	span.SetAttributes(attribute.Stringer("host", ci.contract.HostKey))
-	span.SetAttributes(attribute.Stringer("contract", ci.contract.ID))
+	tracing.SetDetailedAttributes(ctx, span, attribute.Stringer("host", ci.contract.HostKey), attribute.Stringer("contract", ci.contract.ID))
 
 	// convenience variables
 	state := c.ap.State()
@@ -1500,7 +1678,7 @@ func (c *contractor) formContract(ctx context.Context, w Worker, host hostdb.Hos
 		}
 	}()
 	hk := host.PublicKey
-	span.SetAttributes(attribute.Stringer("host", hk))
+	tracing.SetDetailedAttributes(ctx, span, attribute.Stringer("host", hk))
 
 	// convenience variables
 	state := c.ap.State()
@@ -1526,8 +1704,15 @@ func (c *contractor) formContract(ctx context.Context, w Worker, host hostdb.Hos
 		return api.ContractMetadata{}, false, errors.New("insufficient budget")
 	}
 
+	// verify the host's settings are consistent with the scanned values
+	// before committing any funds
+	endHeight := hostEndHeight(state.cfg, state.period, hk)
+	if err := formationPreflight(host, scan, endHeight-cs.BlockHeight); err != nil {
+		c.logger.Debugw(fmt.Sprintf("formation preflight failed, err: %v", err), "hk", hk)
+		return api.ContractMetadata{}, true, fmt.Errorf("formation preflight failed: %w", err)
+	}
+
 	// calculate the host collateral
-	endHeight := endHeight(state.cfg, state.period)
 	expectedStorage := renterFundsToExpectedStorage(renterFunds, endHeight-cs.BlockHeight, scan.PriceTable)
 	hostCollateral := rhpv2.ContractFormationCollateral(state.cfg.Contracts.Period, expectedStorage, scan.Settings)
 
@@ -1620,6 +1805,20 @@ func endHeight(cfg api.AutopilotConfig, currentPeriod uint64) uint64 {
 	return currentPeriod + cfg.Contracts.Period + cfg.Contracts.RenewWindow
 }
 
+// hostEndHeight returns the end height of contracts formed or renewed with the
+// given host. If end heights are laddered, the host is assigned to one of the
+// buckets based on its key and the end height is pushed back by that bucket's
+// share of the period. Since the offset is less than a period, renewals always
+// extend the contract.
+func hostEndHeight(cfg api.AutopilotConfig, currentPeriod uint64, hk types.PublicKey) uint64 {
+	eh := endHeight(cfg, currentPeriod)
+	if buckets := cfg.Contracts.EndHeightBuckets; buckets > 1 {
+		bucket := binary.LittleEndian.Uint64(hk[:8]) % buckets
+		eh += bucket * (cfg.Contracts.Period / buckets)
+	}
+	return eh
+}
+
 // renterFundsToExpectedStorage returns how much storage a renter is expected to
 // be able to afford given the provided 'renterFunds'.
 func renterFundsToExpectedStorage(renterFunds types.Currency, duration uint64, pt rhpv3.HostPriceTable) uint64 {
@@ -1635,3 +1834,29 @@ func renterFundsToExpectedStorage(renterFunds types.Currency, duration uint64, p
 	}
 	return expectedStorage.Big().Uint64()
 }
+
+// contractsForTargetCapacity returns the number of contracts required to store
+// the target capacity at the given redundancy. Like the host score, it only
+// expects a quarter of a host's remaining storage to be available to us and
+// assumes every host offers the median remaining storage of the scanned hosts.
+// The result is never lower than the number of shards of a slab, it is zero if
+// there are no scanned hosts with remaining storage.
+func contractsForTargetCapacity(target uint64, rs api.RedundancySettings, hosts []hostdb.Host) uint64 {
+	var remaining []float64
+	for _, h := range hosts {
+		if h.Scanned && h.Settings.RemainingStorage > 0 {
+			remaining = append(remaining, float64(h.Settings.RemainingStorage))
+		}
+	}
+	median, err := percentile(remaining, 50)
+	if err != nil {
+		return 0
+	}
+
+	required := float64(target) * rs.Redundancy()
+	amount := uint64(math.Ceil(required / (median * 0.25)))
+	if amount < uint64(rs.TotalShards) {
+		amount = uint64(rs.TotalShards)
+	}
+	return amount
+}
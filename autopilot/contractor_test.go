@@ -0,0 +1,117 @@
+package autopilot
+
+import (
+	"errors"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestContractsForTargetCapacity(t *testing.T) {
+	// every host has 4 TiB of remaining storage, of which we expect to use 1 TiB
+	hosts := newTestHosts(10)
+	rs := api.RedundancySettings{MinShards: 10, TotalShards: 30}
+
+	// 20 TiB at 3x redundancy requires 60 TiB
+	if n := contractsForTargetCapacity(20<<40, rs, hosts); n != 60 {
+		t.Fatal("unexpected number of contracts", n)
+	}
+
+	// we never want fewer contracts than shards
+	if n := contractsForTargetCapacity(1<<30, rs, hosts); n != 30 {
+		t.Fatal("unexpected number of contracts", n)
+	}
+
+	// hosts that haven't been scanned are ignored
+	for i := range hosts {
+		hosts[i].Scanned = false
+	}
+	if n := contractsForTargetCapacity(20<<40, rs, hosts); n != 0 {
+		t.Fatal("unexpected number of contracts", n)
+	}
+}
+
+func TestHostEndHeight(t *testing.T) {
+	cfg := api.AutopilotConfig{Contracts: api.ContractsConfig{Period: 1000, RenewWindow: 100}}
+
+	// without laddering every host shares the same end height
+	hk := types.PublicKey{3}
+	if eh := hostEndHeight(cfg, 500, hk); eh != 1600 {
+		t.Fatal("unexpected end height", eh)
+	}
+
+	// with laddering the host is pushed back by its bucket's share
+	cfg.Contracts.EndHeightBuckets = 4
+	if eh := hostEndHeight(cfg, 500, hk); eh != 1600+3*250 {
+		t.Fatal("unexpected end height", eh)
+	}
+
+	// assert the end heights of the buckets are spread across the period
+	heights := make(map[uint64]struct{})
+	for i := byte(0); i < 8; i++ {
+		eh := hostEndHeight(cfg, 500, types.PublicKey{i})
+		if eh < 1600 || eh >= 1600+cfg.Contracts.Period {
+			t.Fatal("end height out of range", eh)
+		}
+		heights[eh] = struct{}{}
+	}
+	if len(heights) != 4 {
+		t.Fatal("unexpected number of end heights", len(heights))
+	}
+}
+
+func TestContractorBudget(t *testing.T) {
+	c := &contractor{}
+	if c.Budget() != nil {
+		t.Fatal("expected no budget before the first maintenance")
+	}
+
+	s := state{
+		cfg:    api.AutopilotConfig{Contracts: api.ContractsConfig{Allowance: types.Siacoins(100)}},
+		period: 1000,
+	}
+	c.updateBudget(s, types.Siacoins(40))
+	budget := c.Budget()
+	if budget == nil {
+		t.Fatal("expected budget")
+	} else if !budget.Spent.Equals(types.Siacoins(60)) || !budget.Remaining.Equals(types.Siacoins(40)) || budget.Period != 1000 {
+		t.Fatalf("unexpected budget %+v", budget)
+	}
+
+	// the remaining funds never exceed the allowance
+	c.updateBudget(s, types.Siacoins(200))
+	if budget := c.Budget(); !budget.Spent.IsZero() {
+		t.Fatalf("unexpected budget %+v", budget)
+	}
+}
+
+func TestValidateWalletConfig(t *testing.T) {
+	// assert the threshold has to exceed the number of contracts if the
+	// number of outputs isn't set
+	c := cfg
+	c.Wallet = api.WalletConfig{DefragThreshold: c.Contracts.Amount}
+	if err := c.Validate(); !errors.Is(err, api.ErrInvalidDefragThreshold) {
+		t.Fatal("unexpected", err)
+	}
+	c.Wallet.DefragThreshold++
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the threshold has to exceed the number of outputs
+	c.Wallet = api.WalletConfig{DefragThreshold: 10, DefragOutputs: 20}
+	if err := c.Validate(); !errors.Is(err, api.ErrInvalidDefragThreshold) {
+		t.Fatal("unexpected", err)
+	}
+	c.Wallet.DefragOutputs = 9
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert defragging can be disabled
+	c.Wallet = api.WalletConfig{}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@ package autopilot
 
 import (
 	"context"
+	"time"
 
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/api"
@@ -60,3 +61,34 @@ func (c *contractor) remainingFunds(contracts []api.Contract) (types.Currency, e
 	}
 	return remaining, nil
 }
+
+// Budget returns the allowance spending as of the most recent contract
+// maintenance, it returns nil if no maintenance updated the budget yet.
+func (c *contractor) Budget() *api.AutopilotBudget {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.budget == nil {
+		return nil
+	}
+	budget := *c.budget
+	return &budget
+}
+
+// updateBudget records the funds that remain of the allowance after the
+// contract maintenance formed, renewed and refreshed contracts.
+func (c *contractor) updateBudget(state state, remaining types.Currency) {
+	var spent types.Currency
+	if state.cfg.Contracts.Allowance.Cmp(remaining) > 0 {
+		spent = state.cfg.Contracts.Allowance.Sub(remaining)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.budget = &api.AutopilotBudget{
+		Allowance: state.cfg.Contracts.Allowance,
+		Spent:     spent,
+		Remaining: remaining,
+		Period:    state.period,
+		UpdatedAt: api.TimeRFC3339(time.Now()),
+	}
+}
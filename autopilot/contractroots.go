@@ -0,0 +1,205 @@
+package autopilot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/alerts"
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// contractRootsBatchSize is the number of contracts of which the roots are
+	// verified every run.
+	contractRootsBatchSize = 10
+
+	// contractRootsInterval is the minimum amount of time between the start of
+	// two runs, fetching the roots of a contract is expensive for both the
+	// renter and the host so we don't verify them every iteration.
+	contractRootsInterval = time.Hour
+
+	// contractRootsTimeout is the maximum amount of time we spend verifying
+	// the roots of a single contract.
+	contractRootsTimeout = 5 * time.Minute
+)
+
+var (
+	alertContractRootsID = types.HashBytes([]byte("contractroots")) // constant across restarts
+)
+
+// alertIDForContractRoots returns the id of the alert that is registered when
+// the roots of the given contract diverge from the ones the host has.
+func alertIDForContractRoots(fcid types.FileContractID) types.Hash256 {
+	return types.HashBytes(append(alertContractRootsID[:], fcid[:]...))
+}
+
+// tryVerifyContractRoots launches a run that fetches the roots of a rotating
+// subset of the active contracts from their hosts and compares them to the
+// sectors in the bus, unless a run is still in progress or the last one
+// started less than contractRootsInterval ago. An alert is registered for
+// every contract whose host is missing sectors we expect it to store.
+func (ap *Autopilot) tryVerifyContractRoots() {
+	if ap.isStopped() || !ap.loops.tryStart(loopContractRoots, contractRootsInterval) {
+		return
+	}
+
+	ap.wg.Add(1)
+	go func() {
+		defer ap.wg.Done()
+		ap.workers.withWorker(func(w Worker) {
+			verified, diverged, err := ap.verifyContractRoots(context.Background(), w)
+			ap.loops.finish(loopContractRoots, map[string]uint64{"verified": verified, "diverged": diverged}, err)
+			if err != nil {
+				ap.logger.Errorf("contract roots verification failed, err: %v", err)
+			}
+		})
+	}()
+}
+
+// verifyContractRoots verifies the roots of the next batch of contracts.
+func (ap *Autopilot) verifyContractRoots(ctx context.Context, w Worker) (verified, diverged uint64, _ error) {
+	contracts, err := ap.bus.Contracts(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to fetch contracts: %w", err)
+	}
+	for _, c := range ap.nextContractRootsBatch(contracts) {
+		if ap.isStopped() {
+			break
+		}
+		diff, err := ap.diffContractRoots(ctx, w, c.ID)
+		if err != nil {
+			ap.logger.Errorf("failed to verify roots of contract %v, err: %v", c.ID, err)
+			continue
+		}
+		verified++
+
+		if len(diff.Missing) == 0 {
+			err = ap.alerts.DismissAlerts(ctx, alertIDForContractRoots(c.ID))
+		} else {
+			diverged++
+			err = ap.alerts.RegisterAlert(ctx, newContractRootsAlert(c, diff))
+		}
+		if err != nil {
+			ap.logger.Errorf("failed to update contract roots alert: err %v", err)
+		}
+	}
+	return verified, diverged, nil
+}
+
+// nextContractRootsBatch returns the next batch of contracts to verify, the
+// contracts are sorted by id so every contract is verified in turn.
+func (ap *Autopilot) nextContractRootsBatch(contracts []api.ContractMetadata) []api.ContractMetadata {
+	if len(contracts) == 0 {
+		return nil
+	}
+	sort.Slice(contracts, func(i, j int) bool {
+		return contracts[i].ID.String() < contracts[j].ID.String()
+	})
+
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	batch := make([]api.ContractMetadata, 0, contractRootsBatchSize)
+	for i := 0; i < contractRootsBatchSize && i < len(contracts); i++ {
+		batch = append(batch, contracts[(ap.contractRootsOffset+i)%len(contracts)])
+	}
+	ap.contractRootsOffset = (ap.contractRootsOffset + len(batch)) % len(contracts)
+	return batch
+}
+
+// diffContractRoots compares the roots of the given contract stored by the
+// host to the ones in the bus.
+func (ap *Autopilot) diffContractRoots(ctx context.Context, w Worker, fcid types.FileContractID) (api.ContractRootsDiff, error) {
+	ctx, cancel := context.WithTimeout(ctx, contractRootsTimeout)
+	defer cancel()
+
+	want, uploading, err := ap.bus.ContractRoots(ctx, fcid)
+	if err != nil {
+		return api.ContractRootsDiff{}, fmt.Errorf("failed to fetch contract roots from bus: %w", err)
+	}
+	got, err := w.RHPContractRoots(ctx, fcid)
+	if err != nil {
+		return api.ContractRootsDiff{}, fmt.Errorf("failed to fetch contract roots from host: %w", err)
+	}
+	return diffContractRoots(got, want, uploading), nil
+}
+
+// reconcileContractRoots marks the sectors the host of the given contract is
+// missing as lost, which causes the affected slabs to be migrated. Sectors the
+// host stores but the bus doesn't know about are left for the pruner.
+func (ap *Autopilot) reconcileContractRoots(ctx context.Context, fcid types.FileContractID) (diff api.ContractRootsDiff, err error) {
+	contracts, err := ap.bus.Contracts(ctx)
+	if err != nil {
+		return api.ContractRootsDiff{}, fmt.Errorf("failed to fetch contracts: %w", err)
+	}
+	var contract *api.ContractMetadata
+	for _, c := range contracts {
+		if c.ID == fcid {
+			contract = &c
+			break
+		}
+	}
+	if contract == nil {
+		return api.ContractRootsDiff{}, api.ErrContractNotFound
+	}
+
+	ap.workers.withWorker(func(w Worker) {
+		diff, err = ap.diffContractRoots(ctx, w, fcid)
+	})
+	if err != nil {
+		return api.ContractRootsDiff{}, err
+	}
+
+	for _, root := range diff.Missing {
+		if err := ap.bus.DeleteHostSector(ctx, contract.HostKey, root); err != nil {
+			return api.ContractRootsDiff{}, fmt.Errorf("failed to mark sector %v as lost: %w", root, err)
+		}
+	}
+	if err := ap.alerts.DismissAlerts(ctx, alertIDForContractRoots(fcid)); err != nil {
+		ap.logger.Errorf("failed to dismiss contract roots alert: err %v", err)
+	}
+	return diff, nil
+}
+
+// diffContractRoots returns the roots that are expected but not stored by the
+// host and the roots that are stored by the host but not expected. Roots of
+// sectors that are still being uploaded are ignored.
+func diffContractRoots(got, want, uploading []types.Hash256) (diff api.ContractRootsDiff) {
+	stored := make(map[types.Hash256]struct{}, len(got))
+	for _, root := range got {
+		stored[root] = struct{}{}
+	}
+	expected := make(map[types.Hash256]struct{}, len(want)+len(uploading))
+	for _, root := range want {
+		expected[root] = struct{}{}
+		if _, ok := stored[root]; !ok {
+			diff.Missing = append(diff.Missing, root)
+		}
+	}
+	for _, root := range uploading {
+		expected[root] = struct{}{}
+	}
+	for _, root := range got {
+		if _, ok := expected[root]; !ok {
+			diff.Unknown = append(diff.Unknown, root)
+		}
+	}
+	return
+}
+
+func newContractRootsAlert(c api.ContractMetadata, diff api.ContractRootsDiff) alerts.Alert {
+	return alerts.Alert{
+		ID:       alertIDForContractRoots(c.ID),
+		Severity: alerts.SeverityCritical,
+		Message:  fmt.Sprintf("host is missing %d sectors of contract %v", len(diff.Missing), c.ID),
+		Data: map[string]interface{}{
+			"contractID": c.ID,
+			"hostKey":    c.HostKey,
+			"missing":    len(diff.Missing),
+			"unknown":    len(diff.Unknown),
+		},
+		Timestamp: time.Now(),
+	}
+}
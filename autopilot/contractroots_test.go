@@ -0,0 +1,62 @@
+package autopilot
+
+import (
+	"reflect"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestDiffContractRoots(t *testing.T) {
+	r1, r2, r3, r4 := types.Hash256{1}, types.Hash256{2}, types.Hash256{3}, types.Hash256{4}
+
+	// host stores r1 and r4, we expect r1 and r2 and are uploading r3
+	diff := diffContractRoots([]types.Hash256{r1, r4}, []types.Hash256{r1, r2}, []types.Hash256{r3})
+	if !reflect.DeepEqual(diff.Missing, []types.Hash256{r2}) {
+		t.Fatal("unexpected missing roots", diff.Missing)
+	} else if !reflect.DeepEqual(diff.Unknown, []types.Hash256{r4}) {
+		t.Fatal("unexpected unknown roots", diff.Unknown)
+	}
+
+	// sectors that are being uploaded are not considered unknown
+	diff = diffContractRoots([]types.Hash256{r1, r3}, []types.Hash256{r1}, []types.Hash256{r3})
+	if len(diff.Missing) != 0 || len(diff.Unknown) != 0 {
+		t.Fatal("unexpected diff", diff)
+	}
+}
+
+func TestNextContractRootsBatch(t *testing.T) {
+	ap := &Autopilot{}
+
+	// create more contracts than fit in a single batch
+	contracts := make([]api.ContractMetadata, contractRootsBatchSize+5)
+	for i := range contracts {
+		contracts[i].ID = types.FileContractID{byte(len(contracts) - i)}
+	}
+
+	// assert every contract is verified before the first one is verified again
+	seen := make(map[types.FileContractID]int)
+	for _, c := range ap.nextContractRootsBatch(contracts) {
+		seen[c.ID]++
+	}
+	if len(seen) != contractRootsBatchSize {
+		t.Fatal("unexpected batch size", len(seen))
+	}
+	for _, c := range ap.nextContractRootsBatch(contracts) {
+		seen[c.ID]++
+	}
+	if len(seen) != len(contracts) {
+		t.Fatal("not all contracts were verified", len(seen))
+	}
+	for id, n := range seen {
+		if n > 2 {
+			t.Fatal("contract verified too often", id, n)
+		}
+	}
+
+	// no contracts means no batch
+	if batch := ap.nextContractRootsBatch(nil); len(batch) != 0 {
+		t.Fatal("unexpected batch", batch)
+	}
+}
@@ -191,8 +191,12 @@ func isUsableHost(cfg api.AutopilotConfig, rs api.RedundancySettings, gc worker.
 			errs = append(errs, errHostOffline)
 		}
 
+		// preferred hosts bypass the accepting contracts and scoring checks,
+		// they are still checked for gouging though
+		preferred := isPreferredHost(cfg, h.PublicKey)
+
 		// accepting contracts check
-		if !h.Settings.AcceptingContracts {
+		if !preferred && !h.Settings.AcceptingContracts {
 			errs = append(errs, errHostNotAcceptingContracts)
 		}
 
@@ -200,7 +204,7 @@ func isUsableHost(cfg api.AutopilotConfig, rs api.RedundancySettings, gc worker.
 		gougingBreakdown = gc.Check(&h.Settings, &h.PriceTable.HostPriceTable)
 		if gougingBreakdown.Gouging() {
 			errs = append(errs, fmt.Errorf("%w: %v", errHostPriceGouging, gougingBreakdown.Reasons()))
-		} else {
+		} else if !preferred {
 			// perform scoring checks
 			//
 			// NOTE: only perform these scoring checks if we know the host is
@@ -263,7 +267,7 @@ func (c *contractor) isUsableContract(cfg api.AutopilotConfig, ci contractInfo,
 	}
 
 	// IP check should be last since it modifies the filter
-	shouldFilter := !cfg.Hosts.AllowRedundantIPs && (usable || recoverable)
+	shouldFilter := !cfg.Hosts.AllowRedundantIPs && (usable || recoverable) && !isPreferredHost(cfg, contract.HostKey)
 	if shouldFilter && f.IsRedundantIP(contract.HostIP, contract.HostKey) {
 		reasons = append(reasons, errHostRedundantIP.Error())
 		usable = false
@@ -273,6 +277,31 @@ func (c *contractor) isUsableContract(cfg api.AutopilotConfig, ci contractInfo,
 	return
 }
 
+// isPreferredHost returns whether the host with given key is one of the
+// preferred hosts in the config.
+func isPreferredHost(cfg api.AutopilotConfig, hk types.PublicKey) bool {
+	for _, preferred := range cfg.Hosts.PreferredHosts {
+		if preferred == hk {
+			return true
+		}
+	}
+	return false
+}
+
+// missingPreferredHosts returns the number of preferred hosts we don't have a
+// contract with yet, hosts that are offline are not considered missing since we
+// can't form a contract with them anyway.
+func missingPreferredHosts(cfg api.AutopilotConfig, hosts []hostdb.Host, usedHosts map[types.PublicKey]struct{}) (missing uint64) {
+	for _, h := range hosts {
+		if _, used := usedHosts[h.PublicKey]; used || !isPreferredHost(cfg, h.PublicKey) {
+			continue
+		} else if h.IsAnnounced() && h.Scanned && h.IsOnline() {
+			missing++
+		}
+	}
+	return
+}
+
 func isOutOfFunds(cfg api.AutopilotConfig, s rhpv2.HostSettings, c api.Contract) bool {
 	// TotalCost should never be zero but for legacy reasons we check and return
 	// true should it be the case
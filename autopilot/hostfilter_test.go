@@ -0,0 +1,91 @@
+package autopilot
+
+import (
+	"errors"
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	rhpv3 "go.sia.tech/core/rhp/v3"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/worker"
+)
+
+// testGougingChecker is a gouging checker that considers every host to be
+// either gouging or not.
+type testGougingChecker struct {
+	gouging bool
+}
+
+var _ worker.GougingChecker = testGougingChecker{}
+
+func (gc testGougingChecker) Check(*rhpv2.HostSettings, *rhpv3.HostPriceTable) (breakdown api.HostGougingBreakdown) {
+	if gc.gouging {
+		breakdown.V3.GougingErr = "gouging"
+	}
+	return
+}
+
+func (gc testGougingChecker) CheckPriceTablePayment(rhpv3.HostPriceTable) error {
+	if gc.gouging {
+		return errors.New("gouging")
+	}
+	return nil
+}
+
+func TestIsUsableHostPreferred(t *testing.T) {
+	h := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	h.Settings.AcceptingContracts = false
+
+	cfg := cfg // copy of the test config
+	rs := api.RedundancySettings{MinShards: 1, TotalShards: 3}
+	gc := testGougingChecker{}
+
+	// assert the host is not usable
+	if usable, _ := isUsableHost(cfg, rs, gc, h, 0, 0); usable {
+		t.Fatal("expected host to be unusable")
+	}
+
+	// assert the host is usable once it's preferred, even if its score is
+	// too low
+	cfg.Hosts.PreferredHosts = []types.PublicKey{h.PublicKey}
+	if !isPreferredHost(cfg, h.PublicKey) {
+		t.Fatal("expected host to be preferred")
+	} else if usable, result := isUsableHost(cfg, rs, gc, h, 1e9, 0); !usable {
+		t.Fatal("expected preferred host to be usable", result.reasons())
+	}
+
+	// assert preferred hosts are still checked for gouging
+	if usable, result := isUsableHost(cfg, rs, testGougingChecker{gouging: true}, h, 0, 0); usable {
+		t.Fatal("expected gouging preferred host to be unusable")
+	} else if result.gouging == 0 {
+		t.Fatal("expected host to be unusable due to gouging", result.reasons())
+	}
+
+	// assert preferred hosts still have to be online
+	h.Interactions.LastScanSuccess = false
+	h.Interactions.SecondToLastScanSuccess = false
+	if usable, _ := isUsableHost(cfg, rs, gc, h, 0, 0); usable {
+		t.Fatal("expected offline preferred host to be unusable")
+	}
+}
+
+func TestMissingPreferredHosts(t *testing.T) {
+	used := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	unused := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	offline := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	offline.Interactions.LastScanSuccess = false
+	offline.Interactions.SecondToLastScanSuccess = false
+	other := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+
+	cfg := api.AutopilotConfig{}
+	cfg.Hosts.PreferredHosts = []types.PublicKey{used.PublicKey, unused.PublicKey, offline.PublicKey}
+	hosts := []hostdb.Host{used, unused, offline, other}
+	usedHosts := map[types.PublicKey]struct{}{used.PublicKey: {}}
+
+	// assert only the unused preferred host that is online is missing
+	if missing := missingPreferredHosts(cfg, hosts, usedHosts); missing != 1 {
+		t.Fatal("unexpected", missing)
+	}
+}
@@ -66,6 +66,28 @@ func (c *contractor) HostInfo(ctx context.Context, hostKey types.PublicKey) (api
 	}, nil
 }
 
+// HostScore returns the score of the given host along with its breakdown and
+// the reasons the host is considered unusable, if any.
+func (c *contractor) HostScore(ctx context.Context, hostKey types.PublicKey) (api.HostScoreResponse, error) {
+	hi, err := c.HostInfo(ctx, hostKey)
+	if err != nil {
+		return api.HostScoreResponse{}, err
+	}
+
+	c.mu.Lock()
+	minScore := c.cachedMinScore
+	c.mu.Unlock()
+
+	return api.HostScoreResponse{
+		HostKey:         hostKey,
+		Score:           hi.Checks.Score,
+		MinScore:        minScore,
+		Breakdown:       hi.Checks.ScoreBreakdown,
+		Usable:          hi.Checks.Usable,
+		UnusableReasons: hi.Checks.UnusableReasons,
+	}, nil
+}
+
 func (c *contractor) HostInfos(ctx context.Context, filterMode, usabilityMode, addressContains string, keyIn []types.PublicKey, offset, limit int) ([]api.HostHandlerResponse, error) {
 	// declare helper to decide whether to keep a host.
 	if !isValidUsabilityFilterMode(usabilityMode) {
@@ -14,17 +14,66 @@ import (
 	"lukechampine.com/frand"
 )
 
+const (
+	// missedProofPenalty is the factor by which the score of a host that
+	// recently missed a storage proof is multiplied.
+	missedProofPenalty = 0.01
+
+	// defaultMissedProofPenaltyWindow is the amount of time hosts are
+	// penalized for missing a storage proof unless configured otherwise.
+	defaultMissedProofPenaltyWindow = 30 * 24 * time.Hour
+
+	// defaultInteractionsHalfLife is the amount of time after which an
+	// interaction counts half as much towards a host's interactions score
+	// unless configured otherwise.
+	defaultInteractionsHalfLife = 7 * 24 * time.Hour
+
+	// performanceReferenceSpeedMBPS is the observed transfer speed at which a
+	// host's speed no longer lowers its performance score.
+	performanceReferenceSpeedMBPS = 40
+
+	// performanceReferenceLatencyMS is the observed p90 sector latency at
+	// which a host's latency no longer lowers its performance score.
+	performanceReferenceLatencyMS = 1000
+
+	// minPerformanceScore is the lowest performance score a host can get,
+	// that way a slow host is penalized without being ruled out entirely.
+	minPerformanceScore = 0.1
+)
+
 func hostScore(cfg api.AutopilotConfig, h hostdb.Host, storedData uint64, expectedRedundancy float64) api.HostScoreBreakdown {
 	hostPeriodCost := hostPeriodCostForScore(h, cfg, expectedRedundancy)
+	w := cfg.Hosts.ScoreWeights
 	return api.HostScoreBreakdown{
-		Age:              ageScore(h),
-		Collateral:       collateralScore(cfg, hostPeriodCost, h.Settings, expectedRedundancy),
-		Interactions:     interactionScore(h),
-		Prices:           priceAdjustmentScore(hostPeriodCost, cfg),
-		StorageRemaining: storageRemainingScore(cfg, h.Settings, storedData, expectedRedundancy),
-		Uptime:           uptimeScore(h),
-		Version:          versionScore(h.Settings),
+		Age:              weighted(ageScore(h), w.Age),
+		Collateral:       weighted(collateralScore(cfg, hostPeriodCost, h.Settings, expectedRedundancy), w.Collateral),
+		Interactions:     weighted(interactionScore(cfg, h), w.Interactions),
+		Prices:           weighted(priceAdjustmentScore(hostPeriodCost, cfg), w.Prices),
+		StorageRemaining: weighted(storageRemainingScore(cfg, h.Settings, storedData, expectedRedundancy), w.StorageRemaining),
+		Uptime:           weighted(uptimeScore(h), w.Uptime),
+		Version:          weighted(versionScore(h.Settings), w.Version),
+		Manual:           manualScore(h),
+		MissedProofs:     missedProofScore(cfg, h),
+		Performance:      weighted(performanceScore(h), w.Performance),
+	}
+}
+
+// weighted raises the given score component to the power of its weight, if no
+// weight is configured the component is returned as is.
+func weighted(score float64, weight *float64) float64 {
+	if weight == nil || *weight == 1 {
+		return score
+	}
+	return math.Pow(score, *weight)
+}
+
+// manualScore returns the factor by which the operator adjusted the host's
+// score, the modifier is a fraction so 0.2 results in a factor of 1.2.
+func manualScore(h hostdb.Host) float64 {
+	if h.ScoreModifier < -1 {
+		return 0
 	}
+	return 1 + h.ScoreModifier
 }
 
 // priceAdjustmentScore computes a score between 0 and 1 for a host giving its
@@ -173,13 +222,90 @@ func collateralScore(cfg api.AutopilotConfig, hostCostPerPeriod types.Currency,
 	panic("unreachable")
 }
 
-func interactionScore(h hostdb.Host) float64 {
-	success, fail := 30.0, 1.0
-	success += h.Interactions.SuccessfulInteractions
-	fail += h.Interactions.FailedInteractions
+// interactionScore returns the score for the host's success rate, every
+// interaction is weighted by an exponential decay based on its age so old
+// failures don't haunt hosts forever.
+func interactionScore(cfg api.AutopilotConfig, h hostdb.Host) float64 {
+	halfLife := interactionsHalfLife(cfg)
+	now := time.Now()
+
+	// weigh the aggregated interactions by the age of their period's midpoint
+	var success, fail, aggSuccess, aggFail float64
+	for _, a := range h.Interactions.Aggregates {
+		w := decayWeight(now.Sub(a.Period.Add(hostdb.InteractionAggregatePeriod/2)), halfLife)
+		success += w * a.SuccessfulInteractions
+		fail += w * a.FailedInteractions
+		aggSuccess += a.SuccessfulInteractions
+		aggFail += a.FailedInteractions
+	}
+
+	// interactions that fell out of the retention window are only accounted
+	// for in the totals, they are weighted as if they happened at its start
+	w := decayWeight(hostdb.InteractionAggregatesRetention, halfLife)
+	success += w * math.Max(0, h.Interactions.SuccessfulInteractions-aggSuccess)
+	fail += w * math.Max(0, h.Interactions.FailedInteractions-aggFail)
+
+	success += 30
+	fail += 1
 	return math.Pow(success/(success+fail), 10)
 }
 
+// interactionsHalfLife returns the half-life of a host's interactions.
+func interactionsHalfLife(cfg api.AutopilotConfig) time.Duration {
+	if cfg.Hosts.InteractionsHalfLifeHours == 0 {
+		return defaultInteractionsHalfLife
+	}
+	return time.Duration(cfg.Hosts.InteractionsHalfLifeHours) * time.Hour
+}
+
+// decayWeight returns the weight of an interaction of the given age.
+func decayWeight(age, halfLife time.Duration) float64 {
+	if age <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, float64(age)/float64(halfLife))
+}
+
+// missedProofScore returns the penalty for hosts that failed to submit a
+// storage proof for one of our contracts within the penalty window.
+func missedProofScore(cfg api.AutopilotConfig, h hostdb.Host) float64 {
+	if h.Interactions.LastMissedProof.IsZero() {
+		return 1
+	} else if time.Since(h.Interactions.LastMissedProof) > missedProofPenaltyWindow(cfg) {
+		return 1
+	}
+	return missedProofPenalty
+}
+
+// performanceScore computes a score between minPerformanceScore and 1 from the
+// transfer speeds and latencies the workers observed for the host. Hosts that
+// haven't been used yet have a perfect score, that way new hosts are not
+// penalized before we had the chance to interact with them.
+func performanceScore(h hostdb.Host) float64 {
+	p := h.Performance
+	score := 1.0
+	for _, speed := range []float64{p.UploadSpeedMBPS, p.DownloadSpeedMBPS} {
+		if speed > 0 {
+			score *= math.Min(1, speed/performanceReferenceSpeedMBPS)
+		}
+	}
+	for _, latency := range []float64{p.UploadLatencyP90MS, p.DownloadLatencyP90MS} {
+		if latency > 0 {
+			score *= math.Min(1, performanceReferenceLatencyMS/latency)
+		}
+	}
+	return math.Max(minPerformanceScore, score)
+}
+
+// missedProofPenaltyWindow returns the amount of time hosts are penalized for
+// missing a storage proof.
+func missedProofPenaltyWindow(cfg api.AutopilotConfig) time.Duration {
+	if cfg.Hosts.MissedProofPenaltyHours == 0 {
+		return defaultMissedProofPenaltyWindow
+	}
+	return time.Duration(cfg.Hosts.MissedProofPenaltyHours) * time.Hour
+}
+
 func uptimeScore(h hostdb.Host) float64 {
 	secondToLastScanSuccess := h.Interactions.SecondToLastScanSuccess
 	lastScanSuccess := h.Interactions.LastScanSuccess
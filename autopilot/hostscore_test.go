@@ -1,6 +1,7 @@
 package autopilot
 
 import (
+	"errors"
 	"math"
 	"testing"
 	"time"
@@ -105,6 +106,155 @@ func TestHostScore(t *testing.T) {
 	if hostScore(cfg, h1, 0, redundancy).Score() <= hostScore(cfg, h2, 0, redundancy).Score() {
 		t.Fatal("unexpected")
 	}
+
+	// assert the score modifier affects the score
+	h2 = newHost(newTestHostSettings()) // reset
+	h2.ScoreModifier = -0.2
+	if hostScore(cfg, h1, 0, redundancy).Score() <= hostScore(cfg, h2, 0, redundancy).Score() {
+		t.Fatal("unexpected")
+	}
+	h2.ScoreModifier = 0.2
+	if hostScore(cfg, h1, 0, redundancy).Score() >= hostScore(cfg, h2, 0, redundancy).Score() {
+		t.Fatal("unexpected")
+	}
+}
+
+func TestHostScoreWeights(t *testing.T) {
+	h := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	h.Interactions.SecondToLastScanSuccess = false
+
+	// assert omitted weights default to 1
+	redundancy := 3.0
+	sb := hostScore(cfg, h, 0, redundancy)
+	if sb.Uptime >= 1 {
+		t.Fatal("expected uptime to affect the score", sb.Uptime)
+	}
+
+	// assert increasing the weight of the uptime lowers the uptime score
+	weight := func(w float64) *float64 { return &w }
+	weighted := cfg
+	weighted.Hosts.ScoreWeights.Uptime = weight(2)
+	wsb := hostScore(weighted, h, 0, redundancy)
+	if wsb.Uptime != math.Pow(sb.Uptime, 2) {
+		t.Fatal("unexpected", wsb.Uptime, sb.Uptime)
+	} else if wsb.Score() >= sb.Score() {
+		t.Fatal("expected weighted score to be lower")
+	} else if wsb.Age != sb.Age || wsb.Prices != sb.Prices {
+		t.Fatal("expected other components to be unaffected")
+	}
+
+	// assert a weight of 0 disables the component
+	weighted.Hosts.ScoreWeights.Uptime = weight(0)
+	if wsb := hostScore(weighted, h, 0, redundancy); wsb.Uptime != 1 {
+		t.Fatal("expected uptime to be disabled", wsb.Uptime)
+	} else if wsb.Score() <= sb.Score() {
+		t.Fatal("expected score to be higher")
+	} else if err := weighted.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert negative weights are rejected
+	weighted.Hosts.ScoreWeights.Prices = weight(-1)
+	if err := weighted.Validate(); !errors.Is(err, api.ErrInvalidHostScoreWeight) {
+		t.Fatal("unexpected", err)
+	}
+}
+
+func TestMissedProofScore(t *testing.T) {
+	h := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	if score := missedProofScore(cfg, h); score != 1 {
+		t.Fatal("unexpected", score)
+	}
+
+	// assert a recently missed proof is penalized
+	h.Interactions.MissedProofs = 1
+	h.Interactions.LastMissedProof = time.Now().Add(-time.Hour)
+	if score := missedProofScore(cfg, h); score != missedProofPenalty {
+		t.Fatal("unexpected", score)
+	}
+
+	// assert the penalty window is configurable
+	c := cfg
+	c.Hosts.MissedProofPenaltyHours = 1
+	h.Interactions.LastMissedProof = time.Now().Add(-2 * time.Hour)
+	if score := missedProofScore(c, h); score != 1 {
+		t.Fatal("unexpected", score)
+	} else if score := missedProofScore(cfg, h); score != missedProofPenalty {
+		t.Fatal("unexpected", score)
+	}
+}
+
+func TestPerformanceScore(t *testing.T) {
+	h := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	if score := performanceScore(h); score != 1 {
+		t.Fatal("unexpected", score)
+	}
+
+	// assert fast hosts are not penalized
+	h.Performance = hostdb.HostPerformance{
+		UploadSpeedMBPS:    2 * performanceReferenceSpeedMBPS,
+		UploadLatencyP90MS: performanceReferenceLatencyMS / 2,
+	}
+	if score := performanceScore(h); score != 1 {
+		t.Fatal("unexpected", score)
+	}
+
+	// assert slow downloads lower the score
+	h.Performance.DownloadSpeedMBPS = performanceReferenceSpeedMBPS / 2
+	slow := performanceScore(h)
+	if slow >= 1 {
+		t.Fatal("unexpected", slow)
+	}
+
+	// assert high latency lowers the score further
+	h.Performance.DownloadLatencyP90MS = 2 * performanceReferenceLatencyMS
+	if score := performanceScore(h); score >= slow {
+		t.Fatal("unexpected", score, slow)
+	}
+
+	// assert the score is bounded
+	h.Performance = hostdb.HostPerformance{UploadSpeedMBPS: 0.001}
+	if score := performanceScore(h); score != minPerformanceScore {
+		t.Fatal("unexpected", score)
+	}
+}
+
+func TestInteractionScoreDecay(t *testing.T) {
+	h := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	fresh := interactionScore(cfg, h)
+
+	// add failures that happened a day ago and a month ago
+	period := func(age time.Duration) time.Time {
+		return time.Now().Add(-age).Truncate(hostdb.InteractionAggregatePeriod)
+	}
+	recent, old := h, h
+	recent.Interactions = hostdb.Interactions{
+		FailedInteractions: 10,
+		Aggregates:         []hostdb.InteractionAggregate{{Period: period(24 * time.Hour), FailedInteractions: 10}},
+	}
+	old.Interactions = hostdb.Interactions{
+		FailedInteractions: 10,
+		Aggregates:         []hostdb.InteractionAggregate{{Period: period(28 * 24 * time.Hour), FailedInteractions: 10}},
+	}
+
+	// assert old failures weigh less than recent ones
+	recentScore, oldScore := interactionScore(cfg, recent), interactionScore(cfg, old)
+	if !(recentScore < oldScore && oldScore < fresh) {
+		t.Fatal("unexpected", recentScore, oldScore, fresh)
+	}
+
+	// assert failures that are no longer aggregated weigh even less
+	old.Interactions.Aggregates = nil
+	if score := interactionScore(cfg, old); score <= oldScore || score >= fresh {
+		t.Fatal("unexpected", score)
+	}
+
+	// assert the half-life is configurable
+	c := cfg
+	c.Hosts.InteractionsHalfLifeHours = 1
+	if score := interactionScore(c, recent); score <= recentScore {
+		t.Fatal("unexpected", score)
+	}
 }
 
 func TestRandSelectByWeight(t *testing.T) {
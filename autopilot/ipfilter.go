@@ -9,11 +9,13 @@ import (
 	"time"
 
 	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
 	"go.uber.org/zap"
 )
 
 const (
-	// number of unique bits the host IP must have to prevent it from being filtered
+	// default number of unique bits the host IP must have to prevent it from
+	// being filtered
 	ipv4FilterRange = 24
 	ipv6FilterRange = 32
 
@@ -36,26 +38,76 @@ var (
 
 type (
 	ipFilter struct {
-		subnetToHostKey map[string]string
-
-		resolver *ipResolver
-		logger   *zap.SugaredLogger
+		subnetToHostKeys map[string]map[string]struct{}
+		blockedRanges    []*net.IPNet
+
+		ipv4Range int
+		ipv6Range int
+		maxPerNet int
+		resolver  *ipResolver
+		logger    *zap.SugaredLogger
 	}
 )
 
-func (c *contractor) newIPFilter() *ipFilter {
+func (c *contractor) newIPFilter(cfg api.IPFilterConfig) *ipFilter {
 	c.resolver.pruneCache()
-	return &ipFilter{
-		subnetToHostKey: make(map[string]string),
+	f := newIPFilter(cfg, c.resolver, c.logger)
+	c.mu.Lock()
+	f.blockedRanges = c.blockedRanges
+	c.mu.Unlock()
+	return f
+}
+
+// refreshBlockedRanges fetches the blocklist from the bus and updates the IP
+// ranges that are considered blocked.
+func (c *contractor) refreshBlockedRanges(ctx context.Context) error {
+	blocklist, err := c.ap.bus.HostBlocklist(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch blocklist: %w", err)
+	}
+	ranges := blockedRanges(blocklist)
+	c.mu.Lock()
+	c.blockedRanges = ranges
+	c.mu.Unlock()
+	return nil
+}
 
-		resolver: c.resolver,
-		logger:   c.logger,
+// blockedRanges returns the IP ranges of the blocklist entries that are in
+// CIDR notation.
+func blockedRanges(blocklist []string) (ranges []*net.IPNet) {
+	for _, entry := range blocklist {
+		if ipnet, ok := api.BlocklistRange(entry); ok {
+			ranges = append(ranges, ipnet)
+		}
 	}
+	return
+}
+
+func newIPFilter(cfg api.IPFilterConfig, resolver *ipResolver, logger *zap.SugaredLogger) *ipFilter {
+	f := &ipFilter{
+		subnetToHostKeys: make(map[string]map[string]struct{}),
+
+		ipv4Range: ipv4FilterRange,
+		ipv6Range: ipv6FilterRange,
+		maxPerNet: 1,
+		resolver:  resolver,
+		logger:    logger,
+	}
+	if cfg.IPv4Prefix > 0 {
+		f.ipv4Range = int(cfg.IPv4Prefix)
+	}
+	if cfg.IPv6Prefix > 0 {
+		f.ipv6Range = int(cfg.IPv6Prefix)
+	}
+	if cfg.MaxHostsPerSubnet > 0 {
+		f.maxPerNet = int(cfg.MaxHostsPerSubnet)
+	}
+	return f
 }
 
 func (f *ipFilter) IsRedundantIP(hostIP string, hostKey types.PublicKey) bool {
 	// perform lookup
-	subnets, err := f.resolver.lookup(hostIP)
+	addrs, err := f.resolver.lookup(hostIP)
 	if err != nil {
 		if !strings.Contains(err.Error(), errNoSuchHost.Error()) {
 			f.logger.Errorf("failed to check for redundant IP, treating host %v with IP %v as redundant, err: %v", hostKey, hostIP, err)
@@ -64,23 +116,57 @@ func (f *ipFilter) IsRedundantIP(hostIP string, hostKey types.PublicKey) bool {
 	}
 
 	// return early if we couldn't resolve to a subnet
+	subnets := parseSubnets(addrs, f.ipv4Range, f.ipv6Range)
 	if len(subnets) == 0 {
 		f.logger.Errorf("failed to resolve IP to a subnet, treating host %v with IP %v as redundant, err: %v", hostKey, hostIP, errUnparsableAddress)
 		return true
 	}
 
-	// check if we know about this subnet, if not register all the subnets
-	host, found := f.subnetToHostKey[subnets[0]]
-	if !found {
-		for _, subnet := range subnets {
-			f.subnetToHostKey[subnet] = hostKey.String()
+	// the host is not redundant if it was registered before
+	hk := hostKey.String()
+	for _, subnet := range subnets {
+		if _, found := f.subnetToHostKeys[subnet][hk]; found {
+			return false
 		}
+	}
+
+	// check if any of the host's subnets is full, if not register the host in
+	// all of them
+	for _, subnet := range subnets {
+		if len(f.subnetToHostKeys[subnet]) >= f.maxPerNet {
+			return true
+		}
+	}
+	for _, subnet := range subnets {
+		if _, found := f.subnetToHostKeys[subnet]; !found {
+			f.subnetToHostKeys[subnet] = make(map[string]struct{})
+		}
+		f.subnetToHostKeys[subnet][hk] = struct{}{}
+	}
+	return false
+}
+
+// IsBlockedIP returns true if the host resolves to an IP within one of the
+// blocked IP ranges. The bus only blocks hosts that announced such an IP
+// directly, this catches hosts that announced a domain instead.
+func (f *ipFilter) IsBlockedIP(hostIP string, hostKey types.PublicKey) bool {
+	if len(f.blockedRanges) == 0 {
 		return false
 	}
 
-	// otherwise compare host keys
-	sameHost := host == hostKey.String()
-	return !sameHost
+	addrs, err := f.resolver.lookup(hostIP)
+	if err != nil {
+		f.logger.Debugf("failed to check host %v with IP %v for blocked ranges, err: %v", hostKey, hostIP, err)
+		return false
+	}
+	for _, addr := range addrs {
+		for _, ipnet := range f.blockedRanges {
+			if ipnet.Contains(addr.IP) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 type (
@@ -98,7 +184,7 @@ type (
 
 	ipCacheEntry struct {
 		created time.Time
-		subnets []string
+		addrs   []net.IPAddr
 	}
 )
 
@@ -122,7 +208,7 @@ func (r *ipResolver) pruneCache() {
 	}
 }
 
-func (r *ipResolver) lookup(hostIP string) ([]string, error) {
+func (r *ipResolver) lookup(hostIP string) ([]net.IPAddr, error) {
 	// split off host
 	host, _, err := net.SplitHostPort(hostIP)
 	if err != nil {
@@ -140,7 +226,7 @@ func (r *ipResolver) lookup(hostIP string) ([]string, error) {
 		if isErr(err, errIOTimeout) || isErr(err, errServerMisbehaving) {
 			if entry, found := r.cache[hostIP]; found && time.Since(entry.created) < ipCacheEntryValidity {
 				r.logger.Debugf("using cached IP addresses for %v, err: %v", hostIP, err)
-				return entry.subnets, nil
+				return entry.addrs, nil
 			}
 		}
 		return nil, err
@@ -151,28 +237,25 @@ func (r *ipResolver) lookup(hostIP string) ([]string, error) {
 		return nil, errTooManyAddresses
 	}
 
-	// parse out subnets
-	subnets := parseSubnets(addrs)
-
 	// add to cache
-	if len(subnets) > 0 {
+	if len(addrs) > 0 {
 		r.cache[hostIP] = ipCacheEntry{
 			created: time.Now(),
-			subnets: subnets,
+			addrs:   addrs,
 		}
 	}
 
-	return subnets, nil
+	return addrs, nil
 }
 
-func parseSubnets(addresses []net.IPAddr) []string {
+func parseSubnets(addresses []net.IPAddr, ipv4Range, ipv6Range int) []string {
 	subnets := make([]string, 0, len(addresses))
 
 	for _, address := range addresses {
 		// figure out the IP range
-		ipRange := ipv6FilterRange
+		ipRange := ipv6Range
 		if address.IP.To4() != nil {
-			ipRange = ipv4FilterRange
+			ipRange = ipv4Range
 		}
 
 		// parse the subnet
@@ -0,0 +1,166 @@
+package autopilot
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+type testResolver struct {
+	addrs map[string][]net.IPAddr
+}
+
+func (r *testResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, ok := r.addrs[host]
+	if !ok {
+		return nil, errNoSuchHost
+	}
+	return addrs, nil
+}
+
+func newTestIPResolver(addrs map[string][]net.IPAddr) *ipResolver {
+	r := newIPResolver(time.Second, zap.NewNop().Sugar())
+	r.resolver = &testResolver{addrs: addrs}
+	return r
+}
+
+func TestIPFilter(t *testing.T) {
+	r := newTestIPResolver(map[string][]net.IPAddr{
+		"host1.com": {{IP: net.ParseIP("192.168.0.1")}},
+		"host2.com": {{IP: net.ParseIP("192.168.0.2")}},
+		"host3.com": {{IP: net.ParseIP("192.168.0.3")}},
+		"host4.com": {{IP: net.ParseIP("192.168.1.1")}},
+		"host5.com": {{IP: net.ParseIP("2001:db8:1:1::1")}},
+		"host6.com": {{IP: net.ParseIP("2001:db8:1:2::1")}},
+	})
+	hk1, hk2, hk3, hk4, hk5, hk6 := randomHostKey(), randomHostKey(), randomHostKey(), randomHostKey(), randomHostKey(), randomHostKey()
+
+	// assert the defaults allow a single host per /24 and /32
+	f := newIPFilter(api.IPFilterConfig{}, r, zap.NewNop().Sugar())
+	if f.IsRedundantIP("host1.com:1234", hk1) {
+		t.Fatal("unexpected")
+	} else if !f.IsRedundantIP("host2.com:1234", hk2) {
+		t.Fatal("expected host in same /24 to be redundant")
+	} else if f.IsRedundantIP("host1.com:1234", hk1) {
+		t.Fatal("expected host to not be redundant with itself")
+	} else if f.IsRedundantIP("host4.com:1234", hk4) {
+		t.Fatal("unexpected")
+	} else if f.IsRedundantIP("host5.com:1234", hk5) {
+		t.Fatal("unexpected")
+	} else if !f.IsRedundantIP("host6.com:1234", hk6) {
+		t.Fatal("expected host in same /32 to be redundant")
+	} else if !f.IsRedundantIP("unknown.com:1234", randomHostKey()) {
+		t.Fatal("expected unresolvable host to be redundant")
+	}
+
+	// assert tightening the IPv4 prefix considers hosts in the same /16
+	// redundant and relaxing the IPv6 prefix allows hosts in different /64s
+	f = newIPFilter(api.IPFilterConfig{IPv4Prefix: 16, IPv6Prefix: 64}, r, zap.NewNop().Sugar())
+	if f.IsRedundantIP("host1.com:1234", hk1) {
+		t.Fatal("unexpected")
+	} else if !f.IsRedundantIP("host4.com:1234", hk4) {
+		t.Fatal("expected host in same /16 to be redundant")
+	} else if f.IsRedundantIP("host5.com:1234", hk5) {
+		t.Fatal("unexpected")
+	} else if f.IsRedundantIP("host6.com:1234", hk6) {
+		t.Fatal("expected host in different /64 to not be redundant")
+	}
+
+	// assert we can allow multiple hosts per subnet
+	f = newIPFilter(api.IPFilterConfig{MaxHostsPerSubnet: 2}, r, zap.NewNop().Sugar())
+	if f.IsRedundantIP("host1.com:1234", hk1) {
+		t.Fatal("unexpected")
+	} else if f.IsRedundantIP("host2.com:1234", hk2) {
+		t.Fatal("expected second host in same subnet to not be redundant")
+	} else if !f.IsRedundantIP("host3.com:1234", hk3) {
+		t.Fatal("expected third host in same subnet to be redundant")
+	} else if f.IsRedundantIP("host2.com:1234", hk2) {
+		t.Fatal("expected host to not be redundant with itself")
+	}
+}
+
+func TestIPFilterBlockedRanges(t *testing.T) {
+	r := newTestIPResolver(map[string][]net.IPAddr{
+		"host1.com": {{IP: net.ParseIP("10.0.0.1")}},
+		"host2.com": {{IP: net.ParseIP("10.1.0.1")}},
+		"host3.com": {{IP: net.ParseIP("2001:db8::1")}},
+	})
+
+	// assert only valid ranges are parsed from the blocklist
+	ranges := blockedRanges([]string{"10.0.0.0/16", "foo.com", "*.bar.com", "2001:db8::/32", "10.0.0.0/33"})
+	if len(ranges) != 2 {
+		t.Fatal("unexpected number of ranges", len(ranges))
+	}
+
+	// assert hosts that resolve to an IP within a range are blocked
+	f := newIPFilter(api.IPFilterConfig{}, r, zap.NewNop().Sugar())
+	if f.IsBlockedIP("host1.com:1234", randomHostKey()) {
+		t.Fatal("expected host to not be blocked without ranges")
+	}
+	f.blockedRanges = ranges
+	if !f.IsBlockedIP("host1.com:1234", randomHostKey()) {
+		t.Fatal("expected host to be blocked")
+	} else if f.IsBlockedIP("host2.com:1234", randomHostKey()) {
+		t.Fatal("expected host to not be blocked")
+	} else if !f.IsBlockedIP("host3.com:1234", randomHostKey()) {
+		t.Fatal("expected IPv6 host to be blocked")
+	} else if f.IsBlockedIP("unknown.com:1234", randomHostKey()) {
+		t.Fatal("expected unresolvable host to not be blocked")
+	}
+}
+
+func TestIPResolverCache(t *testing.T) {
+	r := newTestIPResolver(map[string][]net.IPAddr{
+		"host.com": {{IP: net.ParseIP("192.168.0.1")}},
+	})
+
+	// resolve the host to populate the cache
+	if addrs, err := r.lookup("host.com:1234"); err != nil {
+		t.Fatal(err)
+	} else if len(addrs) != 1 {
+		t.Fatal("unexpected", addrs)
+	}
+
+	// assert the cache is used when the resolver times out
+	r.resolver = &errResolver{err: errIOTimeout}
+	if addrs, err := r.lookup("host.com:1234"); err != nil {
+		t.Fatal(err)
+	} else if len(addrs) != 1 {
+		t.Fatal("unexpected", addrs)
+	}
+
+	// assert other errors are returned
+	r.resolver = &errResolver{err: errNoSuchHost}
+	if _, err := r.lookup("host.com:1234"); !errors.Is(err, errNoSuchHost) {
+		t.Fatal("unexpected", err)
+	}
+}
+
+type errResolver struct {
+	err error
+}
+
+func (r *errResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return nil, r.err
+}
+
+func TestValidateIPFilterConfig(t *testing.T) {
+	c := cfg
+	c.Hosts.IPFilter.IPv4Prefix = 33
+	if err := c.Validate(); !errors.Is(err, api.ErrInvalidIPFilterPrefix) {
+		t.Fatal("unexpected", err)
+	}
+	c.Hosts.IPFilter = api.IPFilterConfig{IPv6Prefix: 129}
+	if err := c.Validate(); !errors.Is(err, api.ErrInvalidIPFilterPrefix) {
+		t.Fatal("unexpected", err)
+	}
+	c.Hosts.IPFilter = api.IPFilterConfig{IPv4Prefix: 32, IPv6Prefix: 128}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,132 @@
+package autopilot
+
+import (
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	loopContractor      = "contractor"
+	loopContractRoots   = "contractroots"
+	loopMigrator        = "migrator"
+	loopPruner          = "pruner"
+	loopRebalancer      = "rebalancer"
+	loopRestoreDrill    = "restoredrill"
+	loopScanner         = "scanner"
+	loopSectorDeletions = "sectordeletions"
+)
+
+type (
+	// loopTracker keeps track of when the autopilot's loops ran, how long
+	// they took and what they changed.
+	loopTracker struct {
+		mu            sync.Mutex
+		loops         map[string]*loopStatus
+		nextIteration time.Time
+	}
+
+	loopStatus struct {
+		running   bool
+		lastStart time.Time
+		lastEnd   time.Time
+		lastErr   error
+		changes   map[string]uint64
+	}
+)
+
+// start marks the start of a run of the loop with the given name.
+func (lt *loopTracker) start(name string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.startLocked(name)
+}
+
+func (lt *loopTracker) startLocked(name string) {
+	if lt.loops == nil {
+		lt.loops = make(map[string]*loopStatus)
+	}
+	ls, exists := lt.loops[name]
+	if !exists {
+		ls = &loopStatus{}
+		lt.loops[name] = ls
+	}
+	ls.running = true
+	ls.lastStart = time.Now()
+}
+
+// tryStart marks the start of a run of the loop with the given name, unless
+// the loop is still running or its last run started less than the given
+// interval ago. It returns whether the loop was started.
+func (lt *loopTracker) tryStart(name string, interval time.Duration) bool {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if ls, exists := lt.loops[name]; exists && (ls.running || time.Since(ls.lastStart) < interval) {
+		return false
+	}
+	lt.startLocked(name)
+	return true
+}
+
+// lastStart returns the time at which the last run of the loop with the given
+// name started.
+func (lt *loopTracker) lastStart(name string) time.Time {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if ls, exists := lt.loops[name]; exists {
+		return ls.lastStart
+	}
+	return time.Time{}
+}
+
+// finish marks the end of a run of the loop with the given name.
+func (lt *loopTracker) finish(name string, changes map[string]uint64, err error) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	ls, exists := lt.loops[name]
+	if !exists {
+		return // developer error
+	}
+	ls.running = false
+	ls.lastEnd = time.Now()
+	ls.lastErr = err
+	ls.changes = changes
+}
+
+// scheduleNextIteration sets the time at which the next autopilot iteration
+// is expected to start.
+func (lt *loopTracker) scheduleNextIteration(t time.Time) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.nextIteration = t
+}
+
+// status returns the status of the loop with the given name, nextRun is the
+// earliest time at which the loop is scheduled to run again.
+func (lt *loopTracker) status(name string, nextRun time.Time) api.AutopilotLoopStatus {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	// loops only run as part of an iteration
+	if nextRun.Before(lt.nextIteration) {
+		nextRun = lt.nextIteration
+	}
+	status := api.AutopilotLoopStatus{NextRun: api.TimeRFC3339(nextRun)}
+
+	ls, exists := lt.loops[name]
+	if !exists {
+		return status
+	}
+	status.Running = ls.running
+	status.LastStart = api.TimeRFC3339(ls.lastStart)
+	status.LastEnd = api.TimeRFC3339(ls.lastEnd)
+	status.Changes = ls.changes
+	if ls.lastErr != nil {
+		status.LastError = ls.lastErr.Error()
+	}
+	if !ls.running && !ls.lastEnd.IsZero() {
+		status.LastDuration = api.DurationMS(ls.lastEnd.Sub(ls.lastStart))
+	}
+	return status
+}
@@ -0,0 +1,65 @@
+package autopilot
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoopTracker(t *testing.T) {
+	var lt loopTracker
+
+	// assert a loop that never ran only reports its next run
+	next := time.Now().Add(time.Hour)
+	lt.scheduleNextIteration(next)
+	status := lt.status(loopContractor, time.Time{})
+	if status.Running || !time.Time(status.LastStart).IsZero() {
+		t.Fatalf("unexpected status %+v", status)
+	} else if !time.Time(status.NextRun).Equal(next) {
+		t.Fatalf("unexpected next run %v", status.NextRun)
+	}
+
+	// assert a running loop is reported as such
+	lt.start(loopContractor)
+	status = lt.status(loopContractor, time.Time{})
+	if !status.Running || time.Time(status.LastStart).IsZero() {
+		t.Fatalf("unexpected status %+v", status)
+	} else if status.LastDuration != 0 {
+		t.Fatalf("unexpected duration %v", status.LastDuration)
+	}
+
+	// assert the outcome of a finished loop is reported
+	lt.finish(loopContractor, map[string]uint64{"formed": 2}, errors.New("failure"))
+	status = lt.status(loopContractor, time.Time{})
+	if status.Running || time.Time(status.LastEnd).IsZero() {
+		t.Fatalf("unexpected status %+v", status)
+	} else if status.Changes["formed"] != 2 {
+		t.Fatalf("unexpected changes %+v", status.Changes)
+	} else if status.LastError != "failure" {
+		t.Fatalf("unexpected error %v", status.LastError)
+	}
+
+	// assert the next run is never before the next iteration
+	later := next.Add(time.Hour)
+	if status := lt.status(loopScanner, later); !time.Time(status.NextRun).Equal(later) {
+		t.Fatalf("unexpected next run %v", status.NextRun)
+	} else if status := lt.status(loopScanner, time.Now()); !time.Time(status.NextRun).Equal(next) {
+		t.Fatalf("unexpected next run %v", status.NextRun)
+	}
+
+	// assert a loop is only started if it's not running and it didn't start
+	// within the given interval
+	if !lt.tryStart(loopContractRoots, time.Hour) {
+		t.Fatal("expected loop to start")
+	} else if lt.tryStart(loopContractRoots, 0) {
+		t.Fatal("running loop shouldn't start")
+	}
+	lt.finish(loopContractRoots, nil, nil)
+	if lt.tryStart(loopContractRoots, time.Hour) {
+		t.Fatal("loop shouldn't start within the interval")
+	} else if !lt.tryStart(loopContractRoots, 0) {
+		t.Fatal("expected loop to start")
+	} else if lastStart := lt.lastStart(loopContractRoots); time.Since(lastStart) > time.Second {
+		t.Fatalf("unexpected last start %v", lastStart)
+	}
+}
@@ -13,16 +13,26 @@ import (
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/object"
 	"go.sia.tech/renterd/tracing"
+	"go.sia.tech/renterd/webhooks"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 	"lukechampine.com/frand"
 )
 
 var (
-	alertMigrationID = frand.Entropy256() // constant until restarted
+	alertMigrationID = types.HashBytes([]byte("migration")) // constant across restarts
 )
 
 const (
 	migratorBatchSize = math.MaxInt // TODO: change once we have a fix for the infinite loop
+
+	// migrationResultsWindow is the window over which the migrator keeps track
+	// of migration results.
+	migrationResultsWindow = 24 * time.Hour
+
+	// migrationOutcomesLimit is the number of migration outcomes the migrator
+	// keeps around for reporting purposes.
+	migrationOutcomesLimit = 100
 )
 
 type migrator struct {
@@ -32,19 +42,57 @@ type migrator struct {
 	parallelSlabsPerWorker    uint64
 	signalMaintenanceFinished chan struct{}
 
+	// limiter limits the rate at which slabs are scheduled for migration, it
+	// is nil if the rate is unlimited
+	limiter *rate.Limiter
+
 	mu                 sync.Mutex
 	migrating          bool
 	migratingLastStart time.Time
+	results            []migrationResult
+
+	// outcomes contains the outcome of the most recent migrations
+	outcomes []api.MigrationOutcome
+
+	// degraded contains the slabs for which a degraded event was fired
+	degraded map[object.EncryptionKey]struct{}
+
+	// slabEvents contains the slab events that are waiting to be broadcast,
+	// they are sent by a single goroutine so fetching the affected objects
+	// never holds up migrations
+	slabEvents   []slabEvent
+	broadcasting bool
+
+	// totals are never pruned, they are used to compute what a single
+	// migration run changed
+	totalSucceeded uint64
+	totalFailed    uint64
+}
+
+type slabEvent struct {
+	event string
+	slab  api.UnhealthySlab
 }
 
-func newMigrator(ap *Autopilot, healthCutoff float64, parallelSlabsPerWorker uint64) *migrator {
-	return &migrator{
+type migrationResult struct {
+	timestamp time.Time
+	success   bool
+}
+
+func newMigrator(ap *Autopilot, healthCutoff float64, parallelSlabsPerWorker, maxSlabsPerMinute uint64) *migrator {
+	m := &migrator{
 		ap:                        ap,
 		logger:                    ap.logger.Named("migrator"),
 		healthCutoff:              healthCutoff,
 		parallelSlabsPerWorker:    parallelSlabsPerWorker,
 		signalMaintenanceFinished: make(chan struct{}, 1),
+
+		degraded: make(map[object.EncryptionKey]struct{}),
 	}
+	if maxSlabsPerMinute > 0 {
+		m.limiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(maxSlabsPerMinute)), 1)
+	}
+	return m
 }
 
 func (m *migrator) SignalMaintenanceFinished() {
@@ -60,6 +108,90 @@ func (m *migrator) Status() (bool, time.Time) {
 	return m.migrating, m.migratingLastStart
 }
 
+// Results returns the number of successful and failed migrations within the
+// migration results window.
+func (m *migrator) Results() (succeeded, failed uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneResults()
+	for _, r := range m.results {
+		if r.success {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+	return
+}
+
+// Outcomes returns the migration results within the migration results window
+// as well as the outcome of the most recent migrations.
+func (m *migrator) Outcomes() api.MigrationsResponse {
+	succeeded, failed := m.Results()
+	migrating, _ := m.Status()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recent := make([]api.MigrationOutcome, 0, len(m.outcomes))
+	for i := len(m.outcomes) - 1; i >= 0; i-- {
+		recent = append(recent, m.outcomes[i])
+	}
+	return api.MigrationsResponse{
+		Migrating: migrating,
+		Succeeded: succeeded,
+		Failed:    failed,
+		Window:    api.DurationMS(migrationResultsWindow),
+		Recent:    recent,
+	}
+}
+
+func (m *migrator) recordResult(outcome api.MigrationOutcome) {
+	success := outcome.Error == ""
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results = append(m.results, migrationResult{timestamp: time.Time(outcome.Timestamp), success: success})
+	m.pruneResults()
+	if success {
+		m.totalSucceeded++
+	} else {
+		m.totalFailed++
+	}
+
+	m.outcomes = append(m.outcomes, outcome)
+	if len(m.outcomes) > migrationOutcomesLimit {
+		m.outcomes = m.outcomes[len(m.outcomes)-migrationOutcomesLimit:]
+	}
+}
+
+// throttle blocks until the rate limiter allows for the next slab to be
+// scheduled for migration, it returns false if the autopilot was stopped in
+// the meantime.
+func (m *migrator) throttle() bool {
+	if m.limiter == nil {
+		return true
+	}
+	r := m.limiter.Reserve()
+	t := time.NewTimer(r.Delay())
+	defer t.Stop()
+	select {
+	case <-m.ap.stopChan:
+		r.Cancel()
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (m *migrator) pruneResults() {
+	cutoff := time.Now().Add(-migrationResultsWindow)
+	var i int
+	for i < len(m.results) && m.results[i].timestamp.Before(cutoff) {
+		i++
+	}
+	m.results = m.results[i:]
+}
+
 func (m *migrator) tryPerformMigrations(ctx context.Context, wp *workerPool) {
 	m.mu.Lock()
 	if m.migrating || m.ap.isStopped() {
@@ -68,7 +200,9 @@ func (m *migrator) tryPerformMigrations(ctx context.Context, wp *workerPool) {
 	}
 	m.migrating = true
 	m.migratingLastStart = time.Now()
+	succeeded, failed := m.totalSucceeded, m.totalFailed
 	m.mu.Unlock()
+	m.ap.loops.start(loopMigrator)
 
 	m.ap.wg.Add(1)
 	go func() {
@@ -76,16 +210,119 @@ func (m *migrator) tryPerformMigrations(ctx context.Context, wp *workerPool) {
 		m.performMigrations(wp)
 		m.mu.Lock()
 		m.migrating = false
+		changes := map[string]uint64{
+			"migrated": m.totalSucceeded - succeeded,
+			"failed":   m.totalFailed - failed,
+		}
 		m.mu.Unlock()
+		m.ap.loops.finish(loopMigrator, changes, nil)
 	}()
 }
 
+// pruneDegraded forgets about degraded slabs that no longer require
+// migration.
+func (m *migrator) pruneDegraded(toMigrate []api.UnhealthySlab) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keep := make(map[object.EncryptionKey]struct{})
+	for _, slab := range toMigrate {
+		if _, exists := m.degraded[slab.Key]; exists {
+			keep[slab.Key] = struct{}{}
+		}
+	}
+	m.degraded = keep
+}
+
+// tryBroadcastSlabEvent queues a webhook event for the given slab. Degraded
+// events are only fired once per slab and repaired events are only fired for
+// slabs for which a degraded event was fired. Events are broadcast in the
+// background to avoid blocking migrations on the bus.
+func (m *migrator) tryBroadcastSlabEvent(event string, slab api.UnhealthySlab) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, degraded := m.degraded[slab.Key]
+	if event == api.WebhookEventSlabDegraded {
+		m.degraded[slab.Key] = struct{}{}
+	} else {
+		delete(m.degraded, slab.Key)
+	}
+	if degraded == (event == api.WebhookEventSlabDegraded) {
+		return
+	}
+
+	m.slabEvents = append(m.slabEvents, slabEvent{event: event, slab: slab})
+	if m.broadcasting {
+		return
+	}
+	m.broadcasting = true
+
+	m.ap.wg.Add(1)
+	go func() {
+		defer m.ap.wg.Done()
+		m.broadcastSlabEvents()
+	}()
+}
+
+// broadcastSlabEvents broadcasts queued slab events until the queue is empty
+// or the autopilot is stopped.
+func (m *migrator) broadcastSlabEvents() {
+	ctx := context.Background()
+	for {
+		m.mu.Lock()
+		if len(m.slabEvents) == 0 || m.ap.isStopped() {
+			m.slabEvents = nil
+			m.broadcasting = false
+			m.mu.Unlock()
+			return
+		}
+		ev := m.slabEvents[0]
+		m.slabEvents = m.slabEvents[1:]
+		m.mu.Unlock()
+
+		m.broadcastSlabEvent(ctx, ev.event, ev.slab)
+	}
+}
+
+func (m *migrator) broadcastSlabEvent(ctx context.Context, event string, slab api.UnhealthySlab) {
+	// fetch the affected objects
+	objects, err := m.ap.bus.ObjectsBySlabKey(ctx, slab.Bucket, slab.Key)
+	if err != nil {
+		m.logger.Errorf("failed to fetch objects for slab %v, err: %v", slab.Key, err)
+	}
+	names := make([]string, 0, len(objects))
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+
+	if err := m.ap.bus.BroadcastAction(ctx, webhooks.Event{
+		Module: api.WebhookModuleSlabs,
+		Event:  event,
+		Payload: api.SlabHealthEvent{
+			Key:       slab.Key,
+			Health:    slab.Health,
+			Bucket:    slab.Bucket,
+			Objects:   names,
+			Timestamp: time.Now(),
+		},
+	}); err != nil {
+		m.logger.Errorf("failed to broadcast slab %v event for slab %v, err: %v", event, slab.Key, err)
+	}
+}
+
 func (m *migrator) performMigrations(p *workerPool) {
 	m.logger.Info("performing migrations")
 	b := m.ap.bus
 	ctx, span := tracing.Tracer.Start(context.Background(), "migrator.performMigrations")
 	defer span.End()
 
+	// workers reject migrations while the maintenance mode is active
+	if mr, err := b.Maintenance(ctx); err != nil {
+		m.logger.Errorf("failed to fetch maintenance settings: %v", err)
+	} else if mr.Active {
+		m.logger.Info("skipping migrations, maintenance mode is active")
+		return
+	}
+
 	// prepare a channel to push work to the workers
 	type job struct {
 		api.UnhealthySlab
@@ -125,8 +362,18 @@ func (m *migrator) performMigrations(p *workerPool) {
 							m.logger.Errorf("%v: failed to fetch autopilot settings for migration %d/%d, health: %v, err: %v", id, j.slabIdx+1, j.batchSize, j.Health, err)
 							continue
 						}
-						res, err := w.MigrateSlab(ctx, slab, ap.Config.Contracts.Set)
+						start := time.Now()
+						res, err := w.MigrateSlab(ctx, slab, ap.Config.Contracts.Set, j.Bucket)
+						outcome := api.MigrationOutcome{
+							Key:            j.Key,
+							Bucket:         j.Bucket,
+							Health:         j.Health,
+							ShardsMigrated: res.NumShardsMigrated,
+							Duration:       api.DurationMS(time.Since(start)),
+							Timestamp:      api.TimeRFC3339(time.Now()),
+						}
 						if err != nil {
+							outcome.Error = err.Error()
 							errMsg := fmt.Sprintf("%v: failed to migrate slab %d/%d, health: %v, err: %v", id, j.slabIdx+1, j.batchSize, j.Health, err)
 							rerr := m.ap.alerts.RegisterAlert(ctx, alerts.Alert{
 								ID:       types.HashBytes([]byte(slab.Key.String())),
@@ -141,8 +388,11 @@ func (m *migrator) performMigrations(p *workerPool) {
 								m.logger.Errorf("failed to register alert: err %v", rerr)
 							}
 							m.logger.Errorf(errMsg)
+							m.recordResult(outcome)
 							continue
 						}
+						m.recordResult(outcome)
+						m.tryBroadcastSlabEvent(api.WebhookEventSlabRepaired, j.UnhealthySlab)
 						m.logger.Debugf("%v: successfully migrated slab (health: %v migrated shards: %d) %d/%d", id, j.Health, res.NumShardsMigrated, j.slabIdx+1, j.batchSize)
 					}
 				}(w)
@@ -216,6 +466,12 @@ OUTER:
 			toMigrate = append(toMigrate, *slab)
 		}
 
+		// notify about slabs that became degraded
+		m.pruneDegraded(toMigrate)
+		for _, slab := range migrateNewMap {
+			m.tryBroadcastSlabEvent(api.WebhookEventSlabDegraded, *slab)
+		}
+
 		// sort the newsly added slabs by health
 		newSlabs := toMigrate[len(toMigrate)-len(migrateNewMap):]
 		sort.Slice(newSlabs, func(i, j int) bool {
@@ -243,6 +499,9 @@ OUTER:
 		}
 
 		for i, slab := range toMigrate {
+			if !m.throttle() {
+				return
+			}
 			select {
 			case <-m.ap.stopChan:
 				return
@@ -0,0 +1,65 @@
+package autopilot
+
+import (
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+func TestMigratorOutcomes(t *testing.T) {
+	ap := &Autopilot{logger: zap.NewNop().Sugar()}
+	m := newMigrator(ap, 0.75, 1, 0)
+
+	// record more outcomes than the migrator keeps around, every third
+	// migration fails
+	for i := 0; i < migrationOutcomesLimit+10; i++ {
+		outcome := api.MigrationOutcome{
+			Health:    float64(i),
+			Timestamp: api.TimeRFC3339(time.Now()),
+		}
+		if i%3 == 0 {
+			outcome.Error = "failed"
+		}
+		m.recordResult(outcome)
+	}
+
+	resp := m.Outcomes()
+	if resp.Succeeded != 73 || resp.Failed != 37 {
+		t.Fatalf("unexpected results, %v succeeded %v failed", resp.Succeeded, resp.Failed)
+	} else if len(resp.Recent) != migrationOutcomesLimit {
+		t.Fatalf("unexpected number of outcomes, %v != %v", len(resp.Recent), migrationOutcomesLimit)
+	} else if resp.Recent[0].Health != migrationOutcomesLimit+9 {
+		t.Fatalf("expected most recent outcome first, got %v", resp.Recent[0].Health)
+	} else if resp.Recent[len(resp.Recent)-1].Health != 10 {
+		t.Fatalf("expected oldest outcomes to be pruned, got %v", resp.Recent[len(resp.Recent)-1].Health)
+	}
+}
+
+func TestMigratorThrottle(t *testing.T) {
+	ap := &Autopilot{logger: zap.NewNop().Sugar(), stopChan: make(chan struct{})}
+
+	// without a limit the migrator is never throttled
+	m := newMigrator(ap, 0.75, 1, 0)
+	if m.limiter != nil || !m.throttle() {
+		t.Fatal("expected migrator not to be throttled")
+	}
+
+	// with a limit the second slab has to wait
+	m = newMigrator(ap, 0.75, 1, 6000) // one slab every 10ms
+	start := time.Now()
+	if !m.throttle() || !m.throttle() {
+		t.Fatal("expected throttle to succeed")
+	} else if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Fatalf("expected migrator to be throttled, took %v", elapsed)
+	}
+
+	// stopping the autopilot interrupts the throttle
+	m = newMigrator(ap, 0.75, 1, 1)
+	m.throttle()
+	close(ap.stopChan)
+	if m.throttle() {
+		t.Fatal("expected throttle to be interrupted")
+	}
+}
@@ -0,0 +1,82 @@
+package autopilot
+
+import (
+	"context"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/alerts"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+)
+
+const (
+	// missedProofAlertObjectsLimit is the maximum number of objects that are
+	// listed in a missed proof alert.
+	missedProofAlertObjectsLimit = 100
+)
+
+var (
+	alertMissedProofID = types.HashBytes([]byte("missedproof")) // constant across restarts
+)
+
+// alertIDForMissedProof returns the id of the alert that is registered when
+// the given host misses a storage proof.
+func alertIDForMissedProof(hk types.PublicKey) types.Hash256 {
+	return types.HashBytes(append(alertMissedProofID[:], hk[:]...))
+}
+
+// alertMissedProofs registers an alert for every host that missed a storage
+// proof within the penalty window, listing the objects that have data stored
+// on that host. Alerts of hosts that are no longer penalized are dismissed.
+func (c *contractor) alertMissedProofs(ctx context.Context, cfg api.AutopilotConfig, hosts []hostdb.Host) {
+	window := missedProofPenaltyWindow(cfg)
+
+	var toDismiss []types.Hash256
+	for _, h := range hosts {
+		last := h.Interactions.LastMissedProof
+		if last.IsZero() {
+			continue
+		} else if time.Since(last) > window {
+			if _, alerted := c.missedProofAlerts[h.PublicKey]; alerted {
+				toDismiss = append(toDismiss, alertIDForMissedProof(h.PublicKey))
+				delete(c.missedProofAlerts, h.PublicKey)
+			}
+			continue
+		} else if c.missedProofAlerts[h.PublicKey].Equal(last) {
+			continue // already alerted
+		}
+
+		objects, err := c.ap.bus.HostObjects(ctx, h.PublicKey, missedProofAlertObjectsLimit)
+		if err != nil {
+			c.logger.Errorf("failed to fetch objects of host %v that missed a storage proof, err: %v", h.PublicKey, err)
+			continue
+		}
+		if err := c.ap.alerts.RegisterAlert(ctx, newMissedProofAlert(h, objects)); err != nil {
+			c.logger.Errorf("failed to register missed proof alert, err: %v", err)
+			continue
+		}
+		c.missedProofAlerts[h.PublicKey] = last
+	}
+
+	if len(toDismiss) > 0 {
+		if err := c.ap.alerts.DismissAlerts(ctx, toDismiss...); err != nil {
+			c.logger.Errorf("failed to dismiss missed proof alerts, err: %v", err)
+		}
+	}
+}
+
+func newMissedProofAlert(h hostdb.Host, objects []api.HostObject) alerts.Alert {
+	return alerts.Alert{
+		ID:       alertIDForMissedProof(h.PublicKey),
+		Severity: alerts.SeverityWarning,
+		Message:  "host missed a storage proof",
+		Data: map[string]interface{}{
+			"hostKey":         h.PublicKey.String(),
+			"missedProofs":    h.Interactions.MissedProofs,
+			"lastMissedProof": h.Interactions.LastMissedProof,
+			"objects":         objects,
+		},
+		Timestamp: time.Now(),
+	}
+}
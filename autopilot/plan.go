@@ -0,0 +1,123 @@
+package autopilot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/worker"
+)
+
+const (
+	// planMinScoreBuffer is the number of hosts on top of the number of
+	// wanted contracts that are considered when estimating the min score,
+	// it matches the buffer used by the contractor.
+	planMinScoreBuffer = 50
+)
+
+// Plan estimates the impact of applying the given config without changing
+// anything. It evaluates all hosts using the config and reports which of the
+// contracts in the current set would be dropped.
+func (c *contractor) Plan(ctx context.Context, cfg api.AutopilotConfig) (api.AutopilotPlanResponse, error) {
+	if err := cfg.Validate(); err != nil {
+		return api.AutopilotPlanResponse{}, fmt.Errorf("invalid autopilot config: %w", err)
+	} else if cfg.Contracts.Allowance.IsZero() || cfg.Contracts.Amount == 0 || cfg.Contracts.Period == 0 {
+		return api.AutopilotPlanResponse{}, fmt.Errorf("can not evaluate config because it has no allowance, amount or period")
+	}
+	state := c.ap.State()
+
+	hosts, err := c.ap.bus.Hosts(ctx, api.GetHostsOptions{})
+	if err != nil {
+		return api.AutopilotPlanResponse{}, fmt.Errorf("failed to fetch hosts: %w", err)
+	}
+	contracts, err := c.ap.bus.ContractSetContracts(ctx, state.cfg.Contracts.Set)
+	if err != nil {
+		return api.AutopilotPlanResponse{}, fmt.Errorf("failed to fetch contracts: %w", err)
+	}
+	cs, err := c.ap.bus.ConsensusState(ctx)
+	if err != nil {
+		return api.AutopilotPlanResponse{}, fmt.Errorf("failed to fetch consensus state: %w", err)
+	}
+
+	c.mu.Lock()
+	hostData := c.cachedDataStored
+	c.mu.Unlock()
+
+	// ignore the pricetable's HostBlockHeight by setting it to our own blockheight
+	for i := range hosts {
+		hosts[i].PriceTable.HostBlockHeight = cs.BlockHeight
+	}
+
+	gc := worker.NewGougingChecker(state.gs, cs, state.fee, cfg.Contracts.Period, cfg.Contracts.RenewWindow)
+	return planConfig(cfg, state.rs, gc, hosts, contracts, hostData), nil
+}
+
+// planConfig evaluates the given hosts and contracts using the given config.
+func planConfig(cfg api.AutopilotConfig, rs api.RedundancySettings, gc worker.GougingChecker, hosts []hostdb.Host, contracts []api.ContractMetadata, hostData map[types.PublicKey]uint64) api.AutopilotPlanResponse {
+	// score all candidates to estimate the min score
+	var scores []float64
+	for _, h := range hosts {
+		if !h.Scanned || isPreferredHost(cfg, h.PublicKey) {
+			continue
+		}
+		if usable, result := isUsableHost(cfg, rs, gc, h, math.SmallestNonzeroFloat64, hostData[h.PublicKey]); usable {
+			scores = append(scores, result.scoreBreakdown.Score())
+		}
+	}
+	minScore := estimateMinScore(scores, cfg.Contracts.Amount)
+
+	// check all hosts using the estimated min score
+	resp := api.AutopilotPlanResponse{
+		MinScore:         minScore,
+		DroppedContracts: make(map[types.FileContractID][]string),
+	}
+	usable := make(map[types.PublicKey]bool)
+	reasons := make(map[types.PublicKey][]string)
+	for _, h := range hosts {
+		ok, result := isUsableHost(cfg, rs, gc, h, minScore, hostData[h.PublicKey])
+		if ok {
+			resp.UsableHosts++
+		} else {
+			resp.UnusableHosts++
+			reasons[h.PublicKey] = result.reasons()
+		}
+		usable[h.PublicKey] = ok
+	}
+
+	// check the contracts in the current set
+	for _, c := range contracts {
+		if usable[c.HostKey] {
+			resp.KeptContracts = append(resp.KeptContracts, c.ID)
+		} else if r, ok := reasons[c.HostKey]; ok {
+			resp.DroppedContracts[c.ID] = r
+		} else {
+			resp.DroppedContracts[c.ID] = []string{"host not found"}
+		}
+	}
+	if kept := uint64(len(resp.KeptContracts)); kept < cfg.Contracts.Amount {
+		resp.MissingContracts = cfg.Contracts.Amount - kept
+	}
+	return resp
+}
+
+// estimateMinScore estimates the min score the contractor would compute for
+// the given scores. Rather than taking the median of the lowest scores in a
+// number of weighted random samples, it deterministically picks the lowest
+// score in the set of best scoring hosts we would sample.
+func estimateMinScore(scores []float64, amount uint64) float64 {
+	if len(scores) == 0 {
+		return math.SmallestNonzeroFloat64
+	}
+	sorted := append([]float64(nil), scores...)
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+
+	n := int(amount) + planMinScoreBuffer
+	if n > len(sorted) {
+		n = len(sorted)
+	}
+	return sorted[n-1] / minAllowedScoreLeeway
+}
@@ -0,0 +1,152 @@
+package autopilot
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+)
+
+func TestPlanConfig(t *testing.T) {
+	h1 := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	h2 := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	hosts := []hostdb.Host{h1, h2}
+
+	contracts := []api.ContractMetadata{
+		{ID: types.FileContractID{1}, HostKey: h1.PublicKey},
+		{ID: types.FileContractID{2}, HostKey: h2.PublicKey},
+		{ID: types.FileContractID{3}, HostKey: randomHostKey()},
+	}
+
+	// neither host accepts contracts, which makes them unusable unless they
+	// are preferred
+	plan := cfg
+	plan.Hosts.PreferredHosts = []types.PublicKey{h1.PublicKey}
+	rs := api.RedundancySettings{MinShards: 1, TotalShards: 3}
+	gc := testGougingChecker{}
+	hosts[0].Settings.AcceptingContracts = false
+	hosts[1].Settings.AcceptingContracts = false
+
+	resp := planConfig(plan, rs, gc, hosts, contracts, nil)
+	if resp.UsableHosts != 1 || resp.UnusableHosts != 1 {
+		t.Fatal("unexpected hosts", resp.UsableHosts, resp.UnusableHosts)
+	} else if len(resp.KeptContracts) != 1 || resp.KeptContracts[0] != contracts[0].ID {
+		t.Fatal("unexpected kept contracts", resp.KeptContracts)
+	} else if len(resp.DroppedContracts) != 2 {
+		t.Fatal("unexpected dropped contracts", resp.DroppedContracts)
+	} else if len(resp.DroppedContracts[contracts[1].ID]) == 0 {
+		t.Fatal("expected reasons for dropped contract")
+	} else if resp.MissingContracts != plan.Contracts.Amount-1 {
+		t.Fatal("unexpected missing contracts", resp.MissingContracts)
+	}
+}
+
+func TestEstimateMinScore(t *testing.T) {
+	if score := estimateMinScore(nil, 10); score != math.SmallestNonzeroFloat64 {
+		t.Fatal("unexpected", score)
+	}
+
+	// assert the lowest score is used if there are fewer hosts than we want
+	scores := []float64{3, 1, 2}
+	if score := estimateMinScore(scores, 10); score != 1/float64(minAllowedScoreLeeway) {
+		t.Fatal("unexpected", score)
+	}
+
+	// assert only the best hosts are considered
+	scores = make([]float64, planMinScoreBuffer+10)
+	for i := range scores {
+		scores[i] = float64(i + 1)
+	}
+	if score := estimateMinScore(scores, 1); score != 10/float64(minAllowedScoreLeeway) {
+		t.Fatal("unexpected", score)
+	} else if scores[0] != 1 {
+		t.Fatal("scores were modified")
+	}
+}
+
+// profileBus implements the parts of the Bus interface used to activate
+// autopilot profiles.
+type profileBus struct {
+	Bus
+
+	autopilot api.Autopilot
+	profiles  map[string]api.AutopilotConfig
+}
+
+func (b *profileBus) Autopilot(ctx context.Context, id string) (api.Autopilot, error) {
+	if b.autopilot.ID != id {
+		return api.Autopilot{}, api.ErrAutopilotNotFound
+	}
+	return b.autopilot, nil
+}
+
+func (b *profileBus) AutopilotProfile(ctx context.Context, id, name string) (api.AutopilotProfile, error) {
+	cfg, ok := b.profiles[name]
+	if !ok {
+		return api.AutopilotProfile{}, api.ErrAutopilotProfileNotFound
+	}
+	return api.AutopilotProfile{Name: name, Config: cfg}, nil
+}
+
+func (b *profileBus) ActivateAutopilotProfile(ctx context.Context, id, name string) (api.Autopilot, error) {
+	profile, err := b.AutopilotProfile(ctx, id, name)
+	if err != nil {
+		return api.Autopilot{}, err
+	}
+	b.autopilot = api.Autopilot{ID: id, Config: profile.Config, Profile: name}
+	return b.autopilot, nil
+}
+
+func TestActivateProfile(t *testing.T) {
+	archive := cfg
+	archive.Contracts.Set = "archive"
+	b := &profileBus{
+		autopilot: api.Autopilot{ID: t.Name(), Config: cfg},
+		profiles: map[string]api.AutopilotConfig{
+			"default": cfg,
+			"archive": archive,
+		},
+	}
+	ap := &Autopilot{
+		id:  t.Name(),
+		bus: b,
+		m:   &migrator{signalMaintenanceFinished: make(chan struct{}, 1)},
+	}
+	interrupted := func() bool {
+		select {
+		case <-ap.m.signalMaintenanceFinished:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// activate a profile with the same contract set
+	if autopilot, err := ap.activateProfile(context.Background(), "default"); err != nil {
+		t.Fatal(err)
+	} else if autopilot.Profile != "default" {
+		t.Fatal("unexpected profile", autopilot.Profile)
+	} else if interrupted() {
+		t.Fatal("migrations shouldn't be interrupted if the contract set didn't change")
+	}
+
+	// activate a profile with another contract set
+	if autopilot, err := ap.activateProfile(context.Background(), "archive"); err != nil {
+		t.Fatal(err)
+	} else if autopilot.Config.Contracts.Set != "archive" {
+		t.Fatal("unexpected contract set", autopilot.Config.Contracts.Set)
+	} else if !interrupted() {
+		t.Fatal("expected migrations to be interrupted")
+	}
+
+	// activate an unknown profile
+	if _, err := ap.activateProfile(context.Background(), "unknown"); !errors.Is(err, api.ErrAutopilotProfileNotFound) {
+		t.Fatal("unexpected error", err)
+	} else if b.autopilot.Profile != "archive" {
+		t.Fatal("expected the active profile to remain unchanged")
+	}
+}
@@ -0,0 +1,95 @@
+package autopilot
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+)
+
+const (
+	// preflightPriceTolerancePct is the percentage by which the prices the
+	// host reports during the formation preflight are allowed to diverge from
+	// the prices we scanned before considering the host for formation.
+	preflightPriceTolerancePct = 10
+)
+
+var (
+	errPreflightHandshakeFailed       = errors.New("host handshake failed")
+	errPreflightNotAcceptingContracts = errors.New("host is no longer accepting contracts")
+	errPreflightDurationTooLong       = errors.New("contract duration exceeds the host's max duration")
+	errPreflightCollateralDiverged    = errors.New("host's collateral diverged from the scanned value")
+	errPreflightPricesDiverged        = errors.New("host's prices diverged from the scanned values")
+)
+
+// formationPreflight verifies the settings and price table the host reported
+// in a fresh handshake are consistent with the scanned values that were used
+// to select the host, it returns an error that describes why formation should
+// be aborted if they are not.
+func formationPreflight(host hostdb.Host, scan api.RHPScanResponse, duration uint64) error {
+	if scan.ScanError != "" {
+		return fmt.Errorf("%w: %v", errPreflightHandshakeFailed, scan.ScanError)
+	}
+	settings, pt := scan.Settings, scan.PriceTable
+
+	// check whether the host is still accepting contracts
+	if !settings.AcceptingContracts {
+		return errPreflightNotAcceptingContracts
+	}
+
+	// check the contract duration
+	if duration > settings.MaxDuration {
+		return fmt.Errorf("%w: %v > %v", errPreflightDurationTooLong, duration, settings.MaxDuration)
+	}
+
+	// no need to compare against the scanned values if there are none
+	if !host.Scanned {
+		return nil
+	}
+
+	// check the collateral did not drop
+	for _, c := range []struct {
+		name           string
+		fresh, scanned types.Currency
+	}{
+		{"collateral", settings.Collateral, host.Settings.Collateral},
+		{"max collateral", settings.MaxCollateral, host.Settings.MaxCollateral},
+		{"collateral cost", pt.CollateralCost, host.PriceTable.CollateralCost},
+		{"price table max collateral", pt.MaxCollateral, host.PriceTable.MaxCollateral},
+	} {
+		if exceedsTolerance(c.scanned, c.fresh) {
+			return fmt.Errorf("%w: %v dropped from %v to %v", errPreflightCollateralDiverged, c.name, c.scanned, c.fresh)
+		}
+	}
+
+	// check the prices did not increase
+	for _, p := range []struct {
+		name           string
+		fresh, scanned types.Currency
+	}{
+		{"contract price", settings.ContractPrice, host.Settings.ContractPrice},
+		{"storage price", settings.StoragePrice, host.Settings.StoragePrice},
+		{"upload bandwidth price", settings.UploadBandwidthPrice, host.Settings.UploadBandwidthPrice},
+		{"download bandwidth price", settings.DownloadBandwidthPrice, host.Settings.DownloadBandwidthPrice},
+		{"price table contract price", pt.ContractPrice, host.PriceTable.ContractPrice},
+		{"write store cost", pt.WriteStoreCost, host.PriceTable.WriteStoreCost},
+		{"upload bandwidth cost", pt.UploadBandwidthCost, host.PriceTable.UploadBandwidthCost},
+		{"download bandwidth cost", pt.DownloadBandwidthCost, host.PriceTable.DownloadBandwidthCost},
+	} {
+		if exceedsTolerance(p.fresh, p.scanned) {
+			return fmt.Errorf("%w: %v increased from %v to %v", errPreflightPricesDiverged, p.name, p.scanned, p.fresh)
+		}
+	}
+	return nil
+}
+
+// exceedsTolerance returns true if a exceeds b by more than the preflight
+// price tolerance.
+func exceedsTolerance(a, b types.Currency) bool {
+	lhs := new(big.Int).Mul(a.Big(), big.NewInt(100))
+	rhs := new(big.Int).Mul(b.Big(), big.NewInt(100+preflightPriceTolerancePct))
+	return lhs.Cmp(rhs) > 0
+}
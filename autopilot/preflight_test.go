@@ -0,0 +1,71 @@
+package autopilot
+
+import (
+	"errors"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestFormationPreflight(t *testing.T) {
+	h := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	newScan := func() api.RHPScanResponse {
+		return api.RHPScanResponse{
+			Settings:   h.Settings,
+			PriceTable: h.PriceTable.HostPriceTable,
+		}
+	}
+
+	// assert a host with unchanged settings passes the preflight
+	scan := newScan()
+	if err := formationPreflight(h, scan, 144); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert a failed handshake is caught
+	scan = newScan()
+	scan.ScanError = "connection refused"
+	if err := formationPreflight(h, scan, 144); !errors.Is(err, errPreflightHandshakeFailed) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert a host that stopped accepting contracts is caught
+	scan = newScan()
+	scan.Settings.AcceptingContracts = false
+	if err := formationPreflight(h, scan, 144); !errors.Is(err, errPreflightNotAcceptingContracts) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert an excessive duration is caught
+	if err := formationPreflight(h, newScan(), h.Settings.MaxDuration+1); !errors.Is(err, errPreflightDurationTooLong) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert a drop in collateral is caught
+	scan = newScan()
+	scan.Settings.Collateral = h.Settings.Collateral.Div64(2)
+	if err := formationPreflight(h, scan, 144); !errors.Is(err, errPreflightCollateralDiverged) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert a price increase within the tolerance is allowed
+	h.Settings.StoragePrice = types.Siacoins(100)
+	scan = newScan()
+	scan.Settings.StoragePrice = types.Siacoins(105)
+	if err := formationPreflight(h, scan, 144); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert a price increase exceeding the tolerance is caught
+	scan.Settings.StoragePrice = types.Siacoins(111)
+	if err := formationPreflight(h, scan, 144); !errors.Is(err, errPreflightPricesDiverged) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert prices are not compared if the host was never scanned
+	h.Scanned = false
+	if err := formationPreflight(h, scan, 144); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,97 @@
+package autopilot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.sia.tech/renterd/api"
+)
+
+// rebalance migrates a bounded number of slabs off of the hosts that store a
+// disproportionate share of the data in the contract set. The shards are moved
+// to hosts that store less data, which spreads the data more evenly across the
+// set over time. Rebalancing is disabled unless a threshold is configured.
+func (ap *Autopilot) rebalance(ctx context.Context, w Worker) {
+	cfg := ap.State().cfg
+	if cfg.Rebalance.Threshold == 0 || cfg.Rebalance.MaxSlabs == 0 {
+		return
+	}
+	ap.loops.start(loopRebalancer)
+
+	var overloaded, migrated, remaining uint64
+	err := func() error {
+		contracts, err := ap.bus.ContractSetContracts(ctx, cfg.Contracts.Set)
+		if err != nil {
+			return fmt.Errorf("failed to fetch contract set contracts: %w", err)
+		}
+
+		toRebalance := overloadedContracts(contracts, cfg.Rebalance.Threshold)
+		overloaded = uint64(len(toRebalance))
+
+		budget := cfg.Rebalance.MaxSlabs
+		for _, c := range toRebalance {
+			if budget == 0 {
+				remaining++
+				continue
+			}
+
+			slabs, err := ap.bus.ContractSlabs(ctx, c.ID, int(budget))
+			if err != nil {
+				return fmt.Errorf("failed to fetch slabs of contract %v: %w", c.ID, err)
+			}
+			for _, s := range slabs {
+				budget--
+				slab, err := ap.bus.Slab(ctx, s.Key)
+				if err != nil {
+					ap.logger.Errorf("failed to fetch slab %v for rebalancing, err: %v", s.Key, err)
+					continue
+				}
+				if _, err := w.MigrateSlabFromHost(ctx, slab, cfg.Contracts.Set, s.Bucket, c.HostKey); err != nil {
+					ap.logger.Errorf("failed to rebalance slab %v off of host %v, err: %v", s.Key, c.HostKey, err)
+					continue
+				}
+				migrated++
+			}
+
+			// the contract is rebalanced once we ran out of slabs before
+			// running out of budget, otherwise there's still work left
+			if budget == 0 {
+				remaining++
+			}
+		}
+		return nil
+	}()
+
+	ap.loops.finish(loopRebalancer, map[string]uint64{"overloaded": overloaded, "migrated": migrated, "remaining": remaining}, err)
+	if err != nil {
+		ap.logger.Errorf("rebalancing failed, err: %v", err)
+	} else if migrated > 0 {
+		ap.logger.Infof("rebalanced %d slabs off of %d overloaded hosts", migrated, overloaded)
+	}
+}
+
+// overloadedContracts returns the contracts whose size exceeds the average
+// size of the given contracts by the given factor, sorted from largest to
+// smallest.
+func overloadedContracts(contracts []api.ContractMetadata, threshold float64) (overloaded []api.ContractMetadata) {
+	if len(contracts) == 0 {
+		return nil
+	}
+
+	var total uint64
+	for _, c := range contracts {
+		total += c.Size
+	}
+	avg := float64(total) / float64(len(contracts))
+
+	for _, c := range contracts {
+		if float64(c.Size) > avg*threshold {
+			overloaded = append(overloaded, c)
+		}
+	}
+	sort.Slice(overloaded, func(i, j int) bool {
+		return overloaded[i].Size > overloaded[j].Size
+	})
+	return
+}
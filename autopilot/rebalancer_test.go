@@ -0,0 +1,41 @@
+package autopilot
+
+import (
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestOverloadedContracts(t *testing.T) {
+	// no contracts means nothing is overloaded
+	if overloaded := overloadedContracts(nil, 1.5); len(overloaded) != 0 {
+		t.Fatal("unexpected overloaded contracts", overloaded)
+	}
+
+	// create contracts with an average size of 100
+	contracts := []api.ContractMetadata{
+		{ID: types.FileContractID{1}, Size: 40},
+		{ID: types.FileContractID{2}, Size: 160},
+		{ID: types.FileContractID{3}, Size: 50},
+		{ID: types.FileContractID{4}, Size: 150},
+	}
+
+	// assert contracts above 1.5x the average are overloaded, largest first
+	overloaded := overloadedContracts(contracts, 1.5)
+	if len(overloaded) != 1 || overloaded[0].ID != (types.FileContractID{2}) {
+		t.Fatal("unexpected overloaded contracts", overloaded)
+	}
+	overloaded = overloadedContracts(contracts, 1.2)
+	if len(overloaded) != 2 || overloaded[0].ID != (types.FileContractID{2}) || overloaded[1].ID != (types.FileContractID{4}) {
+		t.Fatal("unexpected overloaded contracts", overloaded)
+	}
+
+	// assert evenly balanced contracts aren't overloaded
+	for i := range contracts {
+		contracts[i].Size = 100
+	}
+	if overloaded := overloadedContracts(contracts, 1.1); len(overloaded) != 0 {
+		t.Fatal("unexpected overloaded contracts", overloaded)
+	}
+}
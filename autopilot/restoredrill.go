@@ -0,0 +1,200 @@
+package autopilot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/alerts"
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// restoreDrillInterval is the minimum amount of time between the start
+	// of two drills, restoring objects requires downloading them in full so
+	// we don't run the drill every iteration.
+	restoreDrillInterval = 6 * time.Hour
+
+	// restoreDrillResultsWindow is the window over which the autopilot keeps
+	// track of the outcome of restores.
+	restoreDrillResultsWindow = 7 * 24 * time.Hour
+
+	// restoreDrillTimeout is the maximum amount of time we spend restoring a
+	// single object.
+	restoreDrillTimeout = 10 * time.Minute
+)
+
+var (
+	alertRestoreDrillID = types.HashBytes([]byte("restoredrill")) // constant across restarts
+)
+
+type (
+	// restoreResults keeps track of the outcome of the restores performed by
+	// the restore drill within the results window.
+	restoreResults struct {
+		mu      sync.Mutex
+		results []restoreResult
+	}
+
+	restoreResult struct {
+		timestamp time.Time
+		success   bool
+		latency   time.Duration
+	}
+)
+
+// alertIDForRestoreDrill returns the id of the alert that is registered when
+// the given object fails to be restored.
+func alertIDForRestoreDrill(bucket, path string) types.Hash256 {
+	return types.HashBytes(append(alertRestoreDrillID[:], []byte(bucket+"/"+path)...))
+}
+
+// tryPerformRestoreDrill launches a drill that downloads a number of random
+// objects through an isolated download path that bypasses all caches and
+// verifies them in full, unless a drill is still in progress or the last one
+// started less than restoreDrillInterval ago. This proves the data is actually
+// restorable from the hosts rather than assuming it is based on the health of
+// its slabs. An alert is registered for every object that fails to be
+// restored.
+func (ap *Autopilot) tryPerformRestoreDrill() {
+	cfg := ap.State().cfg
+	if cfg.RestoreDrill.Objects == 0 || ap.isStopped() || !ap.loops.tryStart(loopRestoreDrill, restoreDrillInterval) {
+		return
+	}
+
+	ap.wg.Add(1)
+	go func() {
+		defer ap.wg.Done()
+		ap.workers.withWorker(func(w Worker) {
+			restored, failed, err := ap.performRestoreDrill(context.Background(), w, cfg.RestoreDrill.Objects)
+			ap.loops.finish(loopRestoreDrill, map[string]uint64{"restored": restored, "failed": failed}, err)
+			if err != nil {
+				ap.logger.Errorf("restore drill failed, err: %v", err)
+			}
+		})
+	}()
+}
+
+// performRestoreDrill restores the given number of random objects.
+func (ap *Autopilot) performRestoreDrill(ctx context.Context, w Worker, n uint64) (restored, failed uint64, _ error) {
+	objects, err := ap.bus.SampleObjects(ctx, int(n))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to sample objects: %w", err)
+	}
+	for _, obj := range objects {
+		if ap.isStopped() {
+			break
+		}
+		latency, err := ap.restoreObject(ctx, w, obj)
+		ap.restores.record(err == nil, latency)
+
+		alertID := alertIDForRestoreDrill(obj.Bucket, obj.Name)
+		if err == nil {
+			restored++
+			err = ap.alerts.DismissAlerts(ctx, alertID)
+		} else {
+			failed++
+			ap.logger.Errorf("failed to restore object %v in bucket %v, err: %v", obj.Name, obj.Bucket, err)
+			err = ap.alerts.RegisterAlert(ctx, newRestoreDrillAlert(alertID, obj, err))
+		}
+		if err != nil {
+			ap.logger.Errorf("failed to update restore drill alert: err %v", err)
+		}
+	}
+	return restored, failed, nil
+}
+
+// restoreObject downloads and verifies the given object, it returns the time
+// it took to restore the object.
+func (ap *Autopilot) restoreObject(ctx context.Context, w Worker, obj api.ObjectSample) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, restoreDrillTimeout)
+	defer cancel()
+
+	res, err := w.VerifyObject(ctx, obj.Bucket, obj.Name)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(res.Duration), verifyRestoredObject(obj, res)
+}
+
+// verifyRestoredObject checks the outcome of restoring the given object. The
+// ETag of objects that were uploaded in multiple parts isn't the hash of their
+// data, so it can't be used to verify them.
+func verifyRestoredObject(obj api.ObjectSample, res api.VerifyObjectResponse) error {
+	if res.Size != obj.Size {
+		return fmt.Errorf("restored %d bytes but expected %d", res.Size, obj.Size)
+	} else if !res.ETagMatch && obj.ETag != "" && !api.IsMultipartETag(obj.ETag) {
+		return fmt.Errorf("restored data has hash %v but expected ETag %v", res.Hash, obj.ETag)
+	}
+	return nil
+}
+
+func (rr *restoreResults) record(success bool, latency time.Duration) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.results = append(rr.results, restoreResult{timestamp: time.Now(), success: success, latency: latency})
+	rr.prune()
+}
+
+func (rr *restoreResults) prune() {
+	cutoff := time.Now().Add(-restoreDrillResultsWindow)
+	var i int
+	for i < len(rr.results) && rr.results[i].timestamp.Before(cutoff) {
+		i++
+	}
+	rr.results = rr.results[i:]
+}
+
+func (rr *restoreResults) response() api.RestoreDrillResponse {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.prune()
+	return newRestoreDrillResponse(rr.results)
+}
+
+func newRestoreDrillResponse(results []restoreResult) api.RestoreDrillResponse {
+	resp := api.RestoreDrillResponse{
+		SuccessRate: 1,
+		Window:      api.DurationMS(restoreDrillResultsWindow),
+	}
+
+	var latencies []float64
+	for _, r := range results {
+		if !r.success {
+			resp.Failed++
+			continue
+		}
+		resp.Succeeded++
+		latencies = append(latencies, float64(r.latency))
+		resp.Latency.Max = api.DurationMS(math.Max(float64(resp.Latency.Max), float64(r.latency)))
+	}
+	if total := resp.Succeeded + resp.Failed; total > 0 {
+		resp.SuccessRate = float64(resp.Succeeded) / float64(total)
+	}
+	if p, err := percentile(latencies, 50); err == nil {
+		resp.Latency.P50 = api.DurationMS(p)
+	}
+	if p, err := percentile(latencies, 90); err == nil {
+		resp.Latency.P90 = api.DurationMS(p)
+	}
+	return resp
+}
+
+func newRestoreDrillAlert(id types.Hash256, obj api.ObjectSample, err error) alerts.Alert {
+	return alerts.Alert{
+		ID:       id,
+		Severity: alerts.SeverityCritical,
+		Message:  "failed to restore object",
+		Data: map[string]interface{}{
+			"bucket": obj.Bucket,
+			"path":   obj.Name,
+			"size":   obj.Size,
+			"health": obj.Health,
+			"error":  err.Error(),
+		},
+		Timestamp: time.Now(),
+	}
+}
@@ -0,0 +1,65 @@
+package autopilot
+
+import (
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/api"
+)
+
+func TestRestoreDrillResponse(t *testing.T) {
+	// assert the success rate is 1 without any restores
+	resp := newRestoreDrillResponse(nil)
+	if resp.SuccessRate != 1 || resp.Succeeded != 0 || resp.Failed != 0 {
+		t.Fatal("unexpected response", resp)
+	}
+
+	// assert failures count towards the success rate but not the latency
+	var results []restoreResult
+	for i := 1; i <= 9; i++ {
+		results = append(results, restoreResult{success: true, latency: time.Duration(i) * time.Second})
+	}
+	results = append(results, restoreResult{success: false})
+	resp = newRestoreDrillResponse(results)
+	if resp.Succeeded != 9 || resp.Failed != 1 {
+		t.Fatal("unexpected results", resp.Succeeded, resp.Failed)
+	} else if resp.SuccessRate != 0.9 {
+		t.Fatal("unexpected success rate", resp.SuccessRate)
+	} else if resp.Latency.Max != api.DurationMS(9*time.Second) {
+		t.Fatal("unexpected max latency", resp.Latency.Max)
+	} else if resp.Latency.P50 != api.DurationMS(4500*time.Millisecond) {
+		t.Fatal("unexpected p50 latency", resp.Latency.P50)
+	}
+
+	// assert results outside of the window are pruned
+	rr := restoreResults{results: []restoreResult{
+		{timestamp: time.Now().Add(-2 * restoreDrillResultsWindow), success: false},
+		{timestamp: time.Now(), success: true},
+	}}
+	if resp := rr.response(); resp.Failed != 0 || resp.Succeeded != 1 {
+		t.Fatal("expected old result to be pruned", resp)
+	}
+}
+
+func TestVerifyRestoredObject(t *testing.T) {
+	sample := func(eTag string) api.ObjectSample {
+		return api.ObjectSample{ObjectMetadata: api.ObjectMetadata{ETag: eTag, Size: 10}}
+	}
+	tests := []struct {
+		obj   api.ObjectSample
+		res   api.VerifyObjectResponse
+		valid bool
+	}{
+		{sample("foo"), api.VerifyObjectResponse{Size: 10, ETagMatch: true}, true},
+		{sample("foo"), api.VerifyObjectResponse{Size: 9, ETagMatch: true}, false},
+		{sample("foo"), api.VerifyObjectResponse{Size: 10, ETagMatch: false}, false},
+		// multipart ETags and missing ETags can't be verified
+		{sample(api.MultipartETag("foo", 2)), api.VerifyObjectResponse{Size: 10, ETagMatch: false}, true},
+		{sample(""), api.VerifyObjectResponse{Size: 10, ETagMatch: false}, true},
+	}
+	for i, test := range tests {
+		if err := verifyRestoredObject(test.obj, test.res); (err == nil) != test.valid {
+			t.Errorf("%d: unexpected error %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package autopilot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/tracing"
+)
+
+const (
+	// resyncSweepMinHeightJump is the number of blocks the chain has to
+	// advance between two synced observations of the consensus state for the
+	// autopilot to consider the node to have been offline. Accounts are likely
+	// to be stale after such a jump.
+	resyncSweepMinHeightJump = 144 // 1 day
+
+	// resyncSweepThreads is the number of accounts that are synced in
+	// parallel during a sweep.
+	resyncSweepThreads = 10
+
+	// resyncSweepTimeout is the maximum amount of time a sweep takes.
+	resyncSweepTimeout = 10 * time.Minute
+)
+
+// resyncSweeper keeps track of the block height at which consensus was last
+// observed to be synced, that way a large jump in block height after a resync
+// can be detected.
+type resyncSweeper struct {
+	mu           sync.Mutex
+	observed     bool
+	syncedHeight uint64
+	pending      bool
+	running      bool
+}
+
+// observe records the given consensus state, it marks a sweep as pending and
+// returns true if the block height advanced by at least
+// resyncSweepMinHeightJump blocks since consensus was last observed to be
+// synced. The first observed height is used as the reference, even if
+// consensus is not synced, so a node that was offline is detected when it's
+// restarted.
+func (s *resyncSweeper) observe(height uint64, synced bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.observed {
+		s.observed = true
+		s.syncedHeight = height
+	}
+	if !synced {
+		return false
+	}
+	if height >= s.syncedHeight+resyncSweepMinHeightJump {
+		s.pending = true
+	}
+	s.syncedHeight = height
+	return s.pending
+}
+
+// start returns true if a sweep is pending and none is running, in which case
+// the sweep is marked as running.
+func (s *resyncSweeper) start() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pending || s.running {
+		return false
+	}
+	s.pending = false
+	s.running = true
+	return true
+}
+
+func (s *resyncSweeper) finish() {
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+}
+
+// launchResyncSweep launches a sweep in the background if the node caught up
+// with a large number of blocks since consensus was last observed to be
+// synced.
+func (a *accounts) launchResyncSweep() {
+	if !a.resync.start() {
+		return
+	}
+
+	a.l.Info("large block height jump detected after resync, syncing accounts")
+	go func() {
+		defer a.resync.finish()
+		ctx, cancel := context.WithTimeout(context.Background(), resyncSweepTimeout)
+		defer cancel()
+		a.w.withWorkers(func(workers []Worker) {
+			for _, w := range workers {
+				a.sweepWorkerAccounts(ctx, w)
+			}
+		})
+	}()
+}
+
+// sweepWorkerAccounts syncs all of the worker's accounts with bounded
+// parallelism and refreshes the price tables of the hosts in the contract set.
+// After the node was offline for a while the accounts are likely to be out of
+// sync, which causes the first downloads to fail.
+func (a *accounts) sweepWorkerAccounts(ctx context.Context, w Worker) {
+	ctx, span := tracing.Tracer.Start(ctx, "sweepWorkerAccounts")
+	defer span.End()
+
+	// fetch all contracts
+	contracts, err := a.c.Contracts(ctx)
+	if err != nil {
+		a.l.Errorw("failed to fetch contracts for resync sweep", "err", err)
+		return
+	}
+
+	// sync the accounts in parallel
+	var mu sync.Mutex
+	var synced, failed int
+	reqs := make(chan api.ContractMetadata)
+	var wg sync.WaitGroup
+	for i := 0; i < resyncSweepThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range reqs {
+				err := w.RHPSync(ctx, c.ID, c.HostKey, c.HostIP, c.SiamuxAddr)
+				if err != nil {
+					a.l.Debugw("failed to sync account during resync sweep", "host", c.HostKey, "contract", c.ID, "err", err)
+				}
+				mu.Lock()
+				if err != nil {
+					failed++
+				} else {
+					synced++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, c := range contracts {
+		reqs <- c
+	}
+	close(reqs)
+	wg.Wait()
+
+	// refresh the price tables of the hosts in the contract set
+	var refreshed api.RHPPriceTablesRefreshResponse
+	if set := a.ap.State().cfg.Contracts.Set; set != "" {
+		setContracts, err := a.c.ContractSetContracts(ctx, set)
+		if err != nil {
+			a.l.Errorw("failed to fetch contract set contracts for resync sweep", "set", set, "err", err)
+		} else if len(setContracts) > 0 {
+			hostKeys := make([]types.PublicKey, 0, len(setContracts))
+			for _, c := range setContracts {
+				hostKeys = append(hostKeys, c.HostKey)
+			}
+			refreshed, err = w.RHPRefreshPriceTables(ctx, hostKeys)
+			if err != nil {
+				a.l.Errorw("failed to refresh price tables for resync sweep", "err", err)
+			}
+		}
+	}
+
+	a.l.Infow("resync sweep finished",
+		"syncedAccounts", synced,
+		"failedAccounts", failed,
+		"refreshedPriceTables", refreshed.Refreshed,
+		"failedPriceTables", refreshed.Failed,
+	)
+}
@@ -12,6 +12,7 @@ import (
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/webhooks"
 	"go.uber.org/zap"
 )
 
@@ -34,6 +35,8 @@ type (
 		bus interface {
 			Hosts(ctx context.Context, opts api.GetHostsOptions) ([]hostdb.Host, error)
 			HostsForScanning(ctx context.Context, opts api.HostsForScanningOptions) ([]hostdb.HostAddress, error)
+			Contracts(ctx context.Context) (contracts []api.ContractMetadata, err error)
+			BroadcastAction(ctx context.Context, action webhooks.Event) error
 			RemoveOfflineHosts(ctx context.Context, minRecentScanFailures uint64, maxDowntime time.Duration) (uint64, error)
 		}
 
@@ -54,6 +57,11 @@ type (
 		scanningLastStart time.Time
 		timeout           time.Duration
 		timeoutLastUpdate time.Time
+
+		// statuses keeps track of the scan history of the hosts we have a
+		// contract with, it is used to fire webhook events when a host
+		// transitions between being online and offline
+		statuses map[types.PublicKey]*hostStatus
 	}
 	scanWorker interface {
 		RHPScan(ctx context.Context, hostKey types.PublicKey, hostIP string, timeout time.Duration) (api.RHPScanResponse, error)
@@ -66,10 +74,19 @@ type (
 
 	scanResp struct {
 		hostKey  types.PublicKey
+		hostIP   string
 		settings rhpv2.HostSettings
+		scanErr  string
 		err      error
 	}
 
+	hostStatus struct {
+		scans                   uint64
+		failures                uint64
+		lastScanSuccess         bool
+		secondToLastScanSuccess bool
+	}
+
 	tracker struct {
 		threshold  uint64
 		percentile float64
@@ -144,6 +161,8 @@ func newScanner(ap *Autopilot, scanBatchSize, scanMinRecentFailures, scanThreads
 
 		timeoutMinInterval: timeoutMinInterval,
 		timeoutMinTimeout:  timeoutMinTimeout,
+
+		statuses: make(map[types.PublicKey]*hostStatus),
 	}, nil
 }
 
@@ -168,23 +187,47 @@ func (s *scanner) tryPerformHostScan(ctx context.Context, w scanWorker, force bo
 	s.scanningLastStart = time.Now()
 	s.scanning = true
 	s.mu.Unlock()
+	s.ap.loops.start(loopScanner)
 
 	maxDowntimeHours := s.ap.State().cfg.Hosts.MaxDowntimeHours
 
+	// fetch the hosts we have a contract with, we only fire status events for
+	// those hosts
+	contracted := make(map[types.PublicKey]struct{})
+	if contracts, err := s.bus.Contracts(ctx); err != nil {
+		s.logger.Errorf("failed to fetch contracts, host status events won't be fired, err: %v", err)
+	} else {
+		for _, c := range contracts {
+			contracted[c.HostKey] = struct{}{}
+		}
+		s.pruneHostStatuses(contracted)
+	}
+
 	go func() {
+		var scanned, failed uint64
 		for resp := range s.launchScanWorkers(ctx, w, s.launchHostScans()) {
 			if s.ap.isStopped() {
 				break
 			}
+			scanned++
+			if resp.err != nil {
+				failed++
+			}
 			if resp.err != nil && !strings.Contains(resp.err.Error(), "connection refused") {
 				s.logger.Error(resp.err)
 			}
+			if _, ok := contracted[resp.hostKey]; ok && resp.err == nil {
+				s.updateHostStatus(ctx, resp)
+			}
 		}
+		s.ap.loops.finish(loopScanner, map[string]uint64{"scanned": scanned, "failed": failed}, nil)
 
 		if !s.ap.isStopped() && maxDowntimeHours > 0 {
 			s.logger.Debugf("removing hosts that have been offline for more than %v hours", maxDowntimeHours)
 			maxDowntime := time.Hour * time.Duration(maxDowntimeHours)
+			s.ap.loops.start(loopPruner)
 			removed, err := s.bus.RemoveOfflineHosts(ctx, s.scanMinRecentFailures, maxDowntime)
+			s.ap.loops.finish(loopPruner, map[string]uint64{"removed": removed}, err)
 			if removed > 0 {
 				s.logger.Infof("removed %v offline hosts", removed)
 			}
@@ -285,7 +328,12 @@ func (s *scanner) launchScanWorkers(ctx context.Context, w scanWorker, reqs chan
 				if err != nil {
 					break // abort
 				}
-				respChan <- scanResp{req.hostKey, scan.Settings, err}
+				respChan <- scanResp{
+					hostKey:  req.hostKey,
+					hostIP:   req.hostIP,
+					settings: scan.Settings,
+					scanErr:  scan.ScanError,
+				}
 				s.tracker.addDataPoint(time.Duration(scan.Ping))
 			}
 
@@ -298,6 +346,84 @@ func (s *scanner) launchScanWorkers(ctx context.Context, w scanWorker, reqs chan
 	return respChan
 }
 
+// updateHostStatus updates the scan history of the host in the given scan
+// response and fires a webhook event if the host transitioned between being
+// online and offline or if it failed too many consecutive scans.
+func (s *scanner) updateHostStatus(ctx context.Context, resp scanResp) {
+	success := resp.scanErr == ""
+
+	s.mu.Lock()
+	status, known := s.statuses[resp.hostKey]
+	if !known {
+		status = &hostStatus{}
+		s.statuses[resp.hostKey] = status
+	}
+	wasOnline := status.isOnline()
+	status.scans++
+	status.secondToLastScanSuccess = status.lastScanSuccess
+	status.lastScanSuccess = success
+	if success {
+		status.failures = 0
+	} else {
+		status.failures++
+	}
+	isOnline := status.isOnline()
+	failures := status.failures
+	s.mu.Unlock()
+
+	var events []string
+	if known && wasOnline != isOnline {
+		if isOnline {
+			events = append(events, api.WebhookEventHostOnline)
+		} else {
+			events = append(events, api.WebhookEventHostOffline)
+		}
+	}
+	if s.scanMinRecentFailures > 0 && failures == s.scanMinRecentFailures {
+		events = append(events, api.WebhookEventHostScanFailures)
+	}
+
+	for _, event := range events {
+		if err := s.bus.BroadcastAction(ctx, webhooks.Event{
+			Module: api.WebhookModuleHosts,
+			Event:  event,
+			Payload: api.HostScanEvent{
+				HostKey:             resp.hostKey,
+				NetAddress:          resp.hostIP,
+				Online:              isOnline,
+				ConsecutiveFailures: failures,
+				ScanError:           resp.scanErr,
+				Timestamp:           time.Now(),
+			},
+		}); err != nil {
+			s.logger.Errorf("failed to broadcast host %v event for host %v, err: %v", event, resp.hostKey, err)
+		}
+	}
+}
+
+// pruneHostStatuses removes the scan history of all hosts we no longer have a
+// contract with.
+func (s *scanner) pruneHostStatuses(contracted map[types.PublicKey]struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hk := range s.statuses {
+		if _, ok := contracted[hk]; !ok {
+			delete(s.statuses, hk)
+		}
+	}
+}
+
+// isOnline returns whether the host is considered online, it uses the same
+// definition as hostdb.Host.IsOnline.
+func (hs *hostStatus) isOnline() bool {
+	if hs.scans == 0 {
+		return false
+	} else if hs.scans == 1 {
+		return hs.lastScanSuccess
+	}
+	return hs.lastScanSuccess || hs.secondToLastScanSuccess
+}
+
 func (s *scanner) isScanRequired() bool {
 	return s.scanningLastStart.IsZero() || time.Since(s.scanningLastStart) > s.scanMinInterval/20 // check 20 times per minInterval, so every 30 minutes
 }
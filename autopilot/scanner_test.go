@@ -3,6 +3,7 @@ package autopilot
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -10,13 +11,29 @@ import (
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/webhooks"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 type mockBus struct {
-	hosts []hostdb.Host
-	reqs  []string
+	hosts     []hostdb.Host
+	contracts []api.ContractMetadata
+	reqs      []string
+
+	mu     sync.Mutex
+	events []webhooks.Event
+}
+
+func (b *mockBus) BroadcastAction(ctx context.Context, action webhooks.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, action)
+	return nil
+}
+
+func (b *mockBus) Contracts(ctx context.Context) ([]api.ContractMetadata, error) {
+	return b.contracts, nil
 }
 
 func (b *mockBus) Hosts(ctx context.Context, opts api.GetHostsOptions) ([]hostdb.Host, error) {
@@ -62,6 +79,7 @@ type mockWorker struct {
 
 	mu        sync.Mutex
 	scanCount int
+	offline   map[types.PublicKey]struct{}
 }
 
 func (w *mockWorker) RHPScan(ctx context.Context, hostKey types.PublicKey, hostIP string, _ time.Duration) (api.RHPScanResponse, error) {
@@ -73,6 +91,9 @@ func (w *mockWorker) RHPScan(ctx context.Context, hostKey types.PublicKey, hostI
 	defer w.mu.Unlock()
 	w.scanCount++
 
+	if _, offline := w.offline[hostKey]; offline {
+		return api.RHPScanResponse{ScanError: "host is offline"}, nil
+	}
 	return api.RHPScanResponse{}, nil
 }
 
@@ -133,6 +154,86 @@ func TestScanner(t *testing.T) {
 	}
 }
 
+func TestScannerHostStatusEvents(t *testing.T) {
+	// prepare 3 hosts, we only have a contract with the first two
+	hosts := newTestHosts(3)
+	b := &mockBus{hosts: hosts}
+	for _, h := range hosts[:2] {
+		b.contracts = append(b.contracts, api.ContractMetadata{HostKey: h.PublicKey, HostIP: h.NetAddress})
+	}
+	w := &mockWorker{offline: make(map[types.PublicKey]struct{})}
+	s := newTestScanner(b, w)
+	s.scanMinRecentFailures = 3
+
+	scan := func() {
+		t.Helper()
+		s.scanningLastStart = time.Time{}
+		if !s.tryPerformHostScan(context.Background(), w, false) {
+			t.Fatal("scan wasn't started")
+		}
+		for s.isScanning() {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	events := func() (events []string) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, e := range b.events {
+			if e.Module != api.WebhookModuleHosts {
+				t.Fatal("unexpected module", e.Module)
+			}
+			events = append(events, fmt.Sprintf("%v:%v", e.Payload.(api.HostScanEvent).HostKey, e.Event))
+		}
+		b.events = nil
+		return
+	}
+
+	// the first scan establishes the baseline and doesn't fire any events
+	scan()
+	if e := events(); len(e) != 0 {
+		t.Fatal("unexpected events", e)
+	}
+
+	// take all hosts offline, we expect an offline event for the contracted
+	// hosts after two failed scans
+	for _, h := range hosts {
+		w.offline[h.PublicKey] = struct{}{}
+	}
+	scan()
+	if e := events(); len(e) != 0 {
+		t.Fatal("unexpected events", e)
+	}
+	scan()
+	if e := events(); len(e) != 2 {
+		t.Fatal("unexpected events", e)
+	} else if !strings.HasSuffix(e[0], api.WebhookEventHostOffline) || !strings.HasSuffix(e[1], api.WebhookEventHostOffline) {
+		t.Fatal("unexpected events", e)
+	}
+
+	// after the third failed scan we expect a scan failures event
+	scan()
+	if e := events(); len(e) != 2 {
+		t.Fatal("unexpected events", e)
+	} else if !strings.HasSuffix(e[0], api.WebhookEventHostScanFailures) || !strings.HasSuffix(e[1], api.WebhookEventHostScanFailures) {
+		t.Fatal("unexpected events", e)
+	}
+
+	// the event isn't fired again for subsequent failures
+	scan()
+	if e := events(); len(e) != 0 {
+		t.Fatal("unexpected events", e)
+	}
+
+	// bring the first host back online
+	delete(w.offline, hosts[0].PublicKey)
+	scan()
+	if e := events(); len(e) != 1 {
+		t.Fatal("unexpected events", e)
+	} else if e[0] != fmt.Sprintf("%v:%v", hosts[0].PublicKey, api.WebhookEventHostOnline) {
+		t.Fatal("unexpected event", e[0])
+	}
+}
+
 func (s *scanner) isScanning() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -156,5 +257,7 @@ func newTestScanner(b *mockBus, w *mockWorker) *scanner {
 		scanBatchSize:   40,
 		scanThreads:     3,
 		scanMinInterval: time.Minute,
+
+		statuses: make(map[types.PublicKey]*hostStatus),
 	}
 }
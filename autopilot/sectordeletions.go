@@ -0,0 +1,75 @@
+package autopilot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// sectorDeletionsBatchSize is the maximum number of queued sectors that
+	// are deleted every iteration.
+	sectorDeletionsBatchSize = 10000
+
+	// sectorDeletionsTimeout is the maximum amount of time we spend deleting
+	// the queued sectors of a single contract.
+	sectorDeletionsTimeout = 5 * time.Minute
+)
+
+// deleteQueuedSectors deletes the sectors that the bus queued for deletion
+// after pruning the slabs of deleted objects from the contracts they are
+// stored in. If a contract was renewed since, the sectors are deleted from the
+// renewed contract. Sectors are only removed from the queue after they were
+// deleted, or if their contract no longer exists, so failed deletions are
+// retried in the next iteration.
+func (ap *Autopilot) deleteQueuedSectors(ctx context.Context, w Worker) {
+	ap.loops.start(loopSectorDeletions)
+
+	var deleted, skipped uint64
+	err := func() error {
+		deletions, err := ap.bus.SectorDeletions(ctx, sectorDeletionsBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to fetch sector deletions: %w", err)
+		}
+		for _, d := range deletions {
+			if ap.isStopped() {
+				return nil
+			}
+
+			dCtx, cancel := context.WithTimeout(ctx, sectorDeletionsTimeout)
+			res, err := w.RHPDeleteSectors(dCtx, d.ContractID, d.Roots)
+			if errors.Is(api.ParseError(err), api.ErrContractNotFound) {
+				// the contract might have been renewed
+				if renewed, rerr := ap.bus.RenewedContract(dCtx, d.ContractID); rerr == nil {
+					res, err = w.RHPDeleteSectors(dCtx, renewed.ID, d.Roots)
+				} else if !errors.Is(api.ParseError(rerr), api.ErrContractNotFound) {
+					err = fmt.Errorf("failed to fetch renewed contract: %w", rerr)
+				}
+			}
+			cancel()
+			if errors.Is(api.ParseError(err), api.ErrContractNotFound) {
+				ap.logger.Debugf("dropping %d sector deletions of unknown contract %v", len(d.Roots), d.ContractID)
+			} else if err != nil {
+				ap.logger.Errorf("failed to delete %d sectors from contract %v, err: %v", len(d.Roots), d.ContractID, err)
+				continue
+			}
+			deleted += res.Deleted
+			skipped += res.Skipped
+
+			if err := ap.bus.RemoveSectorDeletions(ctx, d.ContractID, d.Roots); err != nil {
+				ap.logger.Errorf("failed to remove sector deletions of contract %v, err: %v", d.ContractID, err)
+			}
+		}
+		return nil
+	}()
+
+	ap.loops.finish(loopSectorDeletions, map[string]uint64{"deleted": deleted, "skipped": skipped}, err)
+	if err != nil {
+		ap.logger.Errorf("sector deletion failed, err: %v", err)
+	} else if deleted > 0 || skipped > 0 {
+		ap.logger.Infow("deleted queued sectors", "deleted", deleted, "skipped", skipped)
+	}
+}
@@ -0,0 +1,171 @@
+package autopilot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/alerts"
+	"go.sia.tech/renterd/api"
+)
+
+var (
+	alertSLAID = types.HashBytes([]byte("sla")) // constant across restarts
+)
+
+// computeSLA computes the storage SLA score of the autopilot's contract set.
+// The score is the average of the scores of its components, which are the
+// number of contracts compared to the target, the median uptime of the hosts
+// in the set, the fraction of slabs that have at least half of their
+// redundancy left and the success rate of recent migrations.
+func (ap *Autopilot) computeSLA(ctx context.Context) (api.SLAResponse, error) {
+	autopilot, err := ap.bus.Autopilot(ctx, ap.id)
+	if err != nil {
+		return api.SLAResponse{}, err
+	}
+	set := autopilot.Config.Contracts.Set
+
+	// fetch the contracts in the set
+	contracts, err := ap.bus.ContractSetContracts(ctx, set)
+	if err != nil && !errors.Is(api.ParseError(err), api.ErrContractSetNotFound) {
+		return api.SLAResponse{}, fmt.Errorf("failed to fetch contract set: %w", err)
+	}
+
+	// compute the uptime of the hosts in the set
+	var uptimes []float64
+	if len(contracts) > 0 {
+		hks := make([]types.PublicKey, len(contracts))
+		for i, c := range contracts {
+			hks[i] = c.HostKey
+		}
+		hosts, err := ap.bus.SearchHosts(ctx, api.SearchHostOptions{
+			FilterMode: api.HostFilterModeAll,
+			KeyIn:      hks,
+			Limit:      -1,
+		})
+		if err != nil {
+			return api.SLAResponse{}, fmt.Errorf("failed to fetch hosts: %w", err)
+		}
+		for _, h := range hosts {
+			if total := h.Interactions.Uptime + h.Interactions.Downtime; total > 0 {
+				uptimes = append(uptimes, float64(h.Interactions.Uptime)/float64(total))
+			}
+		}
+	}
+
+	// fetch the slab health histogram
+	histogram, err := ap.bus.SlabHealthHistogram(ctx, set)
+	if err != nil {
+		return api.SLAResponse{}, fmt.Errorf("failed to fetch slab health: %w", err)
+	}
+
+	// the number of contracts is derived from the target capacity if it's set
+	target := autopilot.Config.Contracts.Amount
+	if autopilot.Config.Contracts.TargetCapacity > 0 {
+		target = ap.State().cfg.Contracts.Amount
+	}
+
+	succeeded, failed := ap.m.Results()
+	return newSLAResponse(target, uint64(len(contracts)), uptimes, histogram, succeeded, failed), nil
+}
+
+// checkSLA registers an alert if the storage SLA score drops below the
+// configured threshold and dismisses it once the score recovers.
+func (ap *Autopilot) checkSLA(ctx context.Context) {
+	threshold := ap.State().cfg.SLA.AlertThreshold
+	if threshold == 0 {
+		if err := ap.alerts.DismissAlerts(ctx, alertSLAID); err != nil {
+			ap.logger.Errorf("failed to dismiss alert: err %v", err)
+		}
+		return
+	}
+
+	sla, err := ap.computeSLA(ctx)
+	if err != nil {
+		ap.logger.Errorf("failed to compute SLA, err: %v", err)
+		return
+	}
+
+	if sla.Score >= threshold {
+		err = ap.alerts.DismissAlerts(ctx, alertSLAID)
+	} else {
+		err = ap.alerts.RegisterAlert(ctx, alerts.Alert{
+			ID:       alertSLAID,
+			Severity: alerts.SeverityWarning,
+			Message:  fmt.Sprintf("storage SLA score %.2f is below the threshold of %.2f", sla.Score, threshold),
+			Data: map[string]interface{}{
+				"score":     sla.Score,
+				"threshold": threshold,
+				"breakdown": sla.Breakdown,
+			},
+			Timestamp: time.Now(),
+		})
+	}
+	if err != nil {
+		ap.logger.Errorf("failed to update SLA alert: err %v", err)
+	}
+}
+
+func newSLAResponse(target, active uint64, uptimes []float64, histogram api.SlabHealthHistogram, succeeded, failed uint64) api.SLAResponse {
+	resp := api.SLAResponse{
+		Contracts: api.SLAContracts{
+			Active: active,
+			Target: target,
+		},
+		SlabHealth: histogram,
+		Migrations: api.SLAMigrations{
+			Succeeded: succeeded,
+			Failed:    failed,
+			Window:    api.DurationMS(migrationResultsWindow),
+		},
+	}
+
+	// contracts score
+	if target == 0 {
+		resp.Breakdown.Contracts = 1
+	} else {
+		resp.Breakdown.Contracts = math.Min(1, float64(active)/float64(target))
+	}
+
+	// host uptime score
+	if len(uptimes) > 0 {
+		resp.HostUptime.Min = uptimes[0]
+		for _, uptime := range uptimes {
+			resp.HostUptime.Min = math.Min(resp.HostUptime.Min, uptime)
+		}
+		resp.HostUptime.P10 = uptimePercentile(uptimes, 10, resp.HostUptime.Min)
+		resp.HostUptime.P50 = uptimePercentile(uptimes, 50, resp.HostUptime.Min)
+		resp.HostUptime.P90 = uptimePercentile(uptimes, 90, resp.HostUptime.Min)
+		resp.Breakdown.HostUptime = resp.HostUptime.P50
+	}
+
+	// slab health score
+	if total := histogram.Total(); total == 0 {
+		resp.Breakdown.SlabHealth = 1
+	} else {
+		resp.Breakdown.SlabHealth = float64(histogram.Degraded+histogram.Healthy) / float64(total)
+	}
+
+	// migrations score
+	if total := succeeded + failed; total == 0 {
+		resp.Breakdown.Migrations = 1
+	} else {
+		resp.Breakdown.Migrations = float64(succeeded) / float64(total)
+	}
+
+	resp.Score = (resp.Breakdown.Contracts + resp.Breakdown.HostUptime + resp.Breakdown.SlabHealth + resp.Breakdown.Migrations) / 4
+	return resp
+}
+
+// uptimePercentile returns the given percentile of the uptimes, if there are
+// too few uptimes to compute the percentile the min uptime is returned.
+func uptimePercentile(uptimes []float64, percent, min float64) float64 {
+	p, err := percentile(uptimes, percent)
+	if err != nil || math.IsNaN(p) {
+		return min
+	}
+	return p
+}
@@ -0,0 +1,50 @@
+package autopilot
+
+import (
+	"testing"
+
+	"go.sia.tech/renterd/api"
+)
+
+func TestNewSLAResponse(t *testing.T) {
+	// assert an empty setup has a perfect score, except for the host uptime
+	sla := newSLAResponse(0, 0, nil, api.SlabHealthHistogram{}, 0, 0)
+	if sla.Breakdown != (api.SLAScoreBreakdown{Contracts: 1, SlabHealth: 1, Migrations: 1}) {
+		t.Fatalf("unexpected breakdown %+v", sla.Breakdown)
+	} else if sla.Score != 0.75 {
+		t.Fatalf("unexpected score %v", sla.Score)
+	}
+
+	// assert the components are computed correctly
+	sla = newSLAResponse(10, 5, []float64{1, 0.5, 0.9}, api.SlabHealthHistogram{
+		Unrecoverable: 1,
+		Critical:      1,
+		Degraded:      1,
+		Healthy:       1,
+	}, 3, 1)
+	if sla.Contracts != (api.SLAContracts{Active: 5, Target: 10}) {
+		t.Fatalf("unexpected contracts %+v", sla.Contracts)
+	} else if sla.HostUptime != (api.SLAHostUptime{Min: 0.5, P10: 0.5, P50: 0.7, P90: 0.95}) {
+		t.Fatalf("unexpected host uptime %+v", sla.HostUptime)
+	} else if sla.Migrations.Succeeded != 3 || sla.Migrations.Failed != 1 {
+		t.Fatalf("unexpected migrations %+v", sla.Migrations)
+	}
+
+	expected := api.SLAScoreBreakdown{
+		Contracts:  0.5,
+		HostUptime: 0.7,
+		SlabHealth: 0.5,
+		Migrations: 0.75,
+	}
+	if sla.Breakdown != expected {
+		t.Fatalf("unexpected breakdown %+v != %+v", sla.Breakdown, expected)
+	} else if sla.Score != (0.5+0.7+0.5+0.75)/4 {
+		t.Fatalf("unexpected score %v", sla.Score)
+	}
+
+	// assert the contracts score is capped
+	sla = newSLAResponse(10, 20, nil, api.SlabHealthHistogram{}, 0, 0)
+	if sla.Breakdown.Contracts != 1 {
+		t.Fatalf("unexpected contracts score %v", sla.Breakdown.Contracts)
+	}
+}
@@ -0,0 +1,53 @@
+package autopilot
+
+import (
+	"errors"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/hostdb"
+)
+
+var errHostTagLimitReached = errors.New("host exceeds the limit of hosts for one of its tags")
+
+type (
+	// tagFilter limits the number of hosts that share the same value for a
+	// tag, allowing operators to define their own failure domains.
+	tagFilter struct {
+		limits map[string]uint64
+		counts map[string]uint64
+		hosts  map[types.PublicKey]struct{}
+	}
+)
+
+func newTagFilter(limits map[string]uint64) *tagFilter {
+	return &tagFilter{
+		limits: limits,
+		counts: make(map[string]uint64),
+		hosts:  make(map[types.PublicKey]struct{}),
+	}
+}
+
+// IsOverLimit returns true if adding the given host would exceed the limit of
+// hosts for any of its tags, if not the host is added to the filter.
+func (f *tagFilter) IsOverLimit(h hostdb.Host) bool {
+	if len(f.limits) == 0 {
+		return false
+	} else if _, added := f.hosts[h.PublicKey]; added {
+		return false
+	}
+
+	// check whether the host exceeds any of the limits
+	for _, tag := range h.Tags {
+		key, _ := hostdb.SplitTag(tag)
+		if limit, ok := f.limits[key]; ok && f.counts[tag] >= limit {
+			return true
+		}
+	}
+
+	// add the host
+	for _, tag := range h.Tags {
+		f.counts[tag]++
+	}
+	f.hosts[h.PublicKey] = struct{}{}
+	return false
+}
@@ -0,0 +1,70 @@
+package autopilot
+
+import (
+	"testing"
+
+	"go.sia.tech/renterd/hostdb"
+)
+
+func TestTagFilter(t *testing.T) {
+	newHost := func(tags ...string) hostdb.Host {
+		h := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+		h.Tags = tags
+		return h
+	}
+
+	// assert hosts are never over the limit without limits
+	f := newTagFilter(nil)
+	for i := 0; i < 3; i++ {
+		if f.IsOverLimit(newHost("region:eu")) {
+			t.Fatal("unexpected")
+		}
+	}
+
+	// limit the number of hosts per region to 2
+	f = newTagFilter(map[string]uint64{"region": 2})
+	h1 := newHost("region:eu", "provider:hetzner")
+	h2 := newHost("region:eu", "provider:ovh")
+	h3 := newHost("region:eu")
+	h4 := newHost("region:us", "provider:hetzner")
+	h5 := newHost()
+	if f.IsOverLimit(h1) {
+		t.Fatal("unexpected")
+	} else if f.IsOverLimit(h2) {
+		t.Fatal("unexpected")
+	} else if !f.IsOverLimit(h3) {
+		t.Fatal("expected host to be over the limit")
+	} else if f.IsOverLimit(h4) {
+		t.Fatal("unexpected")
+	} else if f.IsOverLimit(h5) {
+		t.Fatal("unexpected")
+	}
+
+	// assert hosts that were added already are not over the limit
+	if f.IsOverLimit(h1) || f.IsOverLimit(h2) {
+		t.Fatal("unexpected")
+	}
+
+	// assert hosts that were rejected aren't counted, tags without limits
+	// are unlimited
+	f = newTagFilter(map[string]uint64{"region": 1})
+	if f.IsOverLimit(h1) {
+		t.Fatal("unexpected")
+	} else if !f.IsOverLimit(h3) {
+		t.Fatal("expected host to be over the limit")
+	} else if f.IsOverLimit(h4) {
+		t.Fatal("unexpected")
+	} else if !f.IsOverLimit(newHost("region:us")) {
+		t.Fatal("expected host to be over the limit")
+	}
+
+	// assert automatically derived tags are subject to the limits too
+	f = newTagFilter(map[string]uint64{"domain": 1})
+	h6 := newHost(hostdb.EnrichTags("host1.example.com:9982", nil)...)
+	h7 := newHost(hostdb.EnrichTags("host2.example.com:9982", nil)...)
+	if f.IsOverLimit(h6) {
+		t.Fatal("unexpected")
+	} else if !f.IsOverLimit(h7) {
+		t.Fatal("expected host to be over the limit")
+	}
+}
@@ -75,8 +75,12 @@ type (
 	Wallet interface {
 		Address() types.Address
 		Balance() (spendable, confirmed, unconfirmed types.Currency, _ error)
+		ChangeAddresses() ([]wallet.ChangeAddress, error)
+		FundContractFormation(cs consensus.State, txn *types.Transaction, amount types.Currency, pool []types.Transaction, hostKey types.PublicKey) ([]types.Hash256, error)
 		FundTransaction(cs consensus.State, txn *types.Transaction, amount types.Currency, pool []types.Transaction) ([]types.Hash256, error)
 		Height() uint64
+		OwnsAddress(addr types.Address) bool
+		Consolidate(cs consensus.State, maxInputs, outputs int, feePerByte types.Currency, pool []types.Transaction) (types.Transaction, []types.Hash256, error)
 		Redistribute(cs consensus.State, outputs int, amount, feePerByte types.Currency, pool []types.Transaction) (types.Transaction, []types.Hash256, error)
 		ReleaseInputs(txn types.Transaction)
 		SignTransaction(cs consensus.State, txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields) error
@@ -90,6 +94,7 @@ type (
 		Hosts(ctx context.Context, offset, limit int) ([]hostdb.Host, error)
 		SearchHosts(ctx context.Context, filterMode, addressContains string, keyIn []types.PublicKey, offset, limit int) ([]hostdb.Host, error)
 		HostsForScanning(ctx context.Context, maxLastScan time.Time, offset, limit int) ([]hostdb.HostAddress, error)
+		HostAliases(ctx context.Context) ([]api.HostAliasGroup, error)
 		RecordHostScans(ctx context.Context, scans []hostdb.HostScan) error
 		RecordPriceTables(ctx context.Context, priceTableUpdate []hostdb.PriceTableUpdate) error
 		RemoveOfflineHosts(ctx context.Context, minRecentScanFailures uint64, maxDowntime time.Duration) (uint64, error)
@@ -98,6 +103,10 @@ type (
 		HostBlocklist(ctx context.Context) ([]string, error)
 		UpdateHostAllowlistEntries(ctx context.Context, add, remove []types.PublicKey, clear bool) error
 		UpdateHostBlocklistEntries(ctx context.Context, add, remove []string, clear bool) error
+		HostAllowlistUpdateImpact(ctx context.Context, add, remove []types.PublicKey, clear bool) (api.HostListUpdateImpact, error)
+		HostBlocklistUpdateImpact(ctx context.Context, add, remove []string, clear bool) (api.HostListUpdateImpact, error)
+		UpdateHostTags(ctx context.Context, hostKey types.PublicKey, add, remove []string, clear bool) error
+		UpdateHostNotes(ctx context.Context, hostKey types.PublicKey, notes string, scoreModifier float64) error
 	}
 
 	// A MetadataStore stores information about contracts and objects.
@@ -113,38 +122,65 @@ type (
 		ContractSetContracts(ctx context.Context, set string) ([]api.ContractMetadata, error)
 		ContractSets(ctx context.Context) ([]string, error)
 		RecordContractSpending(ctx context.Context, records []api.ContractSpendingRecord) error
+		ContractSpendingMetrics(ctx context.Context, fcid types.FileContractID, from, to time.Time) ([]api.ContractSpendingMetric, error)
+		RecordUploadStatsMetric(ctx context.Context, metric api.UploadStatsMetric) error
+		UploadStatsMetrics(ctx context.Context, from, to time.Time, worker string) ([]api.UploadStatsMetric, error)
+		RecordHostMetrics(ctx context.Context, metrics []api.HostMetric) error
+		ObjectEncryptionKeys(ctx context.Context, marker uint, limit int) ([]api.KeyEscrowObject, uint, error)
+		RestoreObjectEncryptionKeys(ctx context.Context, contractSet string, objects []api.KeyEscrowObject) (restored, recreated, unmatched uint64, err error)
+		HostMetrics(ctx context.Context, from, to time.Time, hostKey types.PublicKey, worker string) ([]api.HostMetric, error)
 		RemoveContractSet(ctx context.Context, name string) error
 		RenewedContract(ctx context.Context, renewedFrom types.FileContractID) (api.ContractMetadata, error)
 		SetContractSet(ctx context.Context, set string, contracts []types.FileContractID) error
 
 		ContractRoots(ctx context.Context, id types.FileContractID) ([]types.Hash256, error)
+		ContractSlabs(ctx context.Context, id types.FileContractID, limit int) ([]api.ContractSlab, error)
+		HostObjects(ctx context.Context, hk types.PublicKey, limit int) ([]api.HostObject, error)
+		HostAffectedObjects(ctx context.Context, hk types.PublicKey, offset, limit int) ([]api.AffectedObject, error)
+		ContractAffectedObjects(ctx context.Context, id types.FileContractID, offset, limit int) ([]api.AffectedObject, error)
 		ContractSizes(ctx context.Context) (map[types.FileContractID]api.ContractSize, error)
 		ContractSize(ctx context.Context, id types.FileContractID) (api.ContractSize, error)
 
 		Bucket(_ context.Context, bucketName string) (api.Bucket, error)
+		BucketStats(_ context.Context, bucketName string) (api.BucketStats, error)
 		CreateBucket(_ context.Context, bucketName string, policy api.BucketPolicy) error
 		DeleteBucket(_ context.Context, bucketName string) error
 		ListBuckets(_ context.Context) ([]api.Bucket, error)
 		UpdateBucketPolicy(ctx context.Context, bucketName string, policy api.BucketPolicy) error
 
-		ListObjects(ctx context.Context, bucketName, prefix, marker string, limit int) (api.ObjectsListResponse, error)
+		ListObjects(ctx context.Context, bucketName, prefix, delimiter, sortBy, sortDir, marker string, limit int) (api.ObjectsListResponse, error)
 		Object(ctx context.Context, bucketName, path string) (api.Object, error)
+		ObjectMetadata(ctx context.Context, bucketName, path string) (api.Object, error)
 		ObjectEntries(ctx context.Context, bucketName, path, prefix, marker string, offset, limit int) ([]api.ObjectMetadata, bool, error)
 		ObjectsBySlabKey(ctx context.Context, bucketName string, slabKey object.EncryptionKey) ([]api.ObjectMetadata, error)
-		SearchObjects(ctx context.Context, bucketName, substring string, offset, limit int) ([]api.ObjectMetadata, error)
-		CopyObject(ctx context.Context, srcBucket, dstBucket, srcPath, dstPath, mimeType string) (api.ObjectMetadata, error)
-		UpdateObject(ctx context.Context, bucketName, path, contractSet, ETag, mimeType string, o object.Object, usedContracts map[types.PublicKey]types.FileContractID) error
+		SearchObjects(ctx context.Context, bucketName, substring string, metadata api.ObjectUserMetadata, offset, limit int) ([]api.ObjectMetadata, error)
+		CopyObject(ctx context.Context, srcBucket, dstBucket, srcPath, dstPath, mimeType string) (_ api.ObjectMetadata, overwritten bool, _ error)
+		UpdateObject(ctx context.Context, bucketName, path, contractSet, ETag, mimeType string, metadata api.ObjectUserMetadata, o object.Object, usedContracts map[types.PublicKey]types.FileContractID) (overwritten bool, _ error)
 		RemoveObject(ctx context.Context, bucketName, path string) error
-		RemoveObjects(ctx context.Context, bucketName, prefix string) error
+		RemoveObjects(ctx context.Context, bucketName, prefix string, progress func(deleted, total int64)) error
 		RenameObject(ctx context.Context, bucketName, from, to string) error
 		RenameObjects(ctx context.Context, bucketName, from, to string) error
+		SampleObjects(ctx context.Context, limit int) ([]api.ObjectSample, error)
+
+		AddPartialObjectSlabs(ctx context.Context, bucketName, path string, offset int, po api.PartialObject) error
+		DeletePartialObject(ctx context.Context, bucketName, path string) error
+		PartialObject(ctx context.Context, bucketName, path string) (api.PartialObject, error)
+		PartialObjectRoots(ctx context.Context, id types.FileContractID) ([]types.Hash256, error)
+		PrunePartialObjects(ctx context.Context, before time.Time) (int64, error)
+
+		PromoteObject(ctx context.Context, bucketName, path, dstBucket, dstPath string) error
+		PruneExpiredObjects(ctx context.Context, now time.Time, deleted func(bucket, path string)) (objects, uploads int64, err error)
+
+		PruneSlabs(ctx context.Context, limit int) (int64, error)
+		RemoveSectorDeletions(ctx context.Context, fcid types.FileContractID, roots []types.Hash256) error
+		SectorDeletions(ctx context.Context, limit int) ([]api.ContractSectorDeletions, error)
 
 		AbortMultipartUpload(ctx context.Context, bucketName, path string, uploadID string) (err error)
 		AddMultipartPart(ctx context.Context, bucketName, path, contractSet, eTag, uploadID string, partNumber int, slices []object.SlabSlice, partialSlab []object.PartialSlab, usedContracts map[types.PublicKey]types.FileContractID) (err error)
-		CompleteMultipartUpload(ctx context.Context, bucketName, path, uploadID string, parts []api.MultipartCompletedPart) (_ api.MultipartCompleteResponse, err error)
-		CreateMultipartUpload(ctx context.Context, bucketName, path string, ec object.EncryptionKey, mimeType string) (api.MultipartCreateResponse, error)
+		CompleteMultipartUpload(ctx context.Context, bucketName, path, uploadID string, parts []api.MultipartCompletedPart) (_ api.MultipartCompleteResponse, overwritten bool, err error)
+		CreateMultipartUpload(ctx context.Context, bucketName, path string, ec object.EncryptionKey, mimeType string, metadata api.ObjectUserMetadata) (api.MultipartCreateResponse, error)
 		MultipartUpload(ctx context.Context, uploadID string) (resp api.MultipartUpload, _ error)
-		MultipartUploads(ctx context.Context, bucketName, prefix, keyMarker, uploadIDMarker string, maxUploads int) (resp api.MultipartListUploadsResponse, _ error)
+		MultipartUploads(ctx context.Context, bucketName, prefix, delimiter, keyMarker, uploadIDMarker string, maxUploads int) (resp api.MultipartListUploadsResponse, _ error)
 		MultipartUploadParts(ctx context.Context, bucketName, object string, uploadID string, marker int, limit int64) (resp api.MultipartListPartsResponse, _ error)
 
 		MarkPackedSlabsUploaded(ctx context.Context, slabs []api.UploadedPackedSlab, usedContracts map[types.PublicKey]types.FileContractID) error
@@ -154,11 +190,13 @@ type (
 		DeleteHostSector(ctx context.Context, hk types.PublicKey, root types.Hash256) error
 
 		ObjectsStats(ctx context.Context) (api.ObjectsStatsResponse, error)
+		SlabHealthHistogram(ctx context.Context, set string) (api.SlabHealthHistogram, error)
 
 		AddPartialSlab(ctx context.Context, data []byte, minShards, totalShards uint8, contractSet string) (slabs []object.PartialSlab, bufferSize int64, err error)
 		FetchPartialSlab(ctx context.Context, key object.EncryptionKey, offset, length uint32) ([]byte, error)
 		Slab(ctx context.Context, key object.EncryptionKey) (object.Slab, error)
 		RefreshHealth(ctx context.Context) error
+		SlabsHealth(ctx context.Context, set string, unhealthyOnly bool, offset, limit int) ([]api.SlabHealth, error)
 		UnhealthySlabs(ctx context.Context, healthCutoff float64, set string, limit int) ([]api.UnhealthySlab, error)
 		UpdateSlab(ctx context.Context, s object.Slab, contractSet string, usedContracts map[types.PublicKey]types.FileContractID) error
 	}
@@ -168,6 +206,12 @@ type (
 		Autopilots(ctx context.Context) ([]api.Autopilot, error)
 		Autopilot(ctx context.Context, id string) (api.Autopilot, error)
 		UpdateAutopilot(ctx context.Context, ap api.Autopilot) error
+
+		AutopilotProfiles(ctx context.Context, id string) ([]api.AutopilotProfile, error)
+		AutopilotProfile(ctx context.Context, id, name string) (api.AutopilotProfile, error)
+		UpdateAutopilotProfile(ctx context.Context, id string, profile api.AutopilotProfile) error
+		DeleteAutopilotProfile(ctx context.Context, id, name string) error
+		ActivateAutopilotProfile(ctx context.Context, id, name string) (api.Autopilot, error)
 	}
 
 	// A SettingStore stores settings.
@@ -205,12 +249,41 @@ type bus struct {
 
 	logger           *zap.SugaredLogger
 	accounts         *accounts
+	consensus        *consensusNotifier
 	contractLocks    *contractLocks
+	deletions        *objectDeletions
+	idempotency      *idempotencyCache
+	maintenance      *databaseMaintenance
+	scratchGC        *scratchGC
+	slabPruner       *slabPruner
+	rebroadcaster    *rebroadcaster
 	uploadingSectors *uploadingSectorsCache
 
+	settingsVersion *settingsVersion
+
 	startTime time.Time
 }
 
+func (b *bus) databaseHandlerGET(jc jape.Context) {
+	jc.Encode(b.maintenance.Status())
+}
+
+func (b *bus) deletionsHandlerGET(jc jape.Context) {
+	jc.Encode(b.deletions.Deletions())
+}
+
+func (b *bus) databaseOptimizeHandlerPOST(jc jape.Context) {
+	err := b.maintenance.Optimize()
+	if errors.Is(err, api.ErrDatabaseBusy) {
+		jc.Error(err, http.StatusServiceUnavailable)
+		return
+	} else if errors.Is(err, api.ErrDatabaseMaintenanceRunning) {
+		jc.Error(err, http.StatusConflict)
+		return
+	}
+	jc.Check("failed to optimize database", err)
+}
+
 func (b *bus) consensusAcceptBlock(jc jape.Context) {
 	var block types.Block
 	if jc.Decode(&block) != nil {
@@ -244,6 +317,37 @@ func (b *bus) consensusStateHandler(jc jape.Context) {
 	jc.Encode(b.consensusState(jc.Request.Context()))
 }
 
+func (b *bus) consensusEventsHandler(jc jape.Context) {
+	var after types.BlockID
+	timeout := defaultConsensusEventsTimeout
+	if jc.DecodeForm("after", &after) != nil || jc.DecodeForm("timeout", (*api.DurationMS)(&timeout)) != nil {
+		return
+	} else if timeout <= 0 || timeout > maxConsensusEventsTimeout {
+		jc.Error(fmt.Errorf("timeout has to be between 0 and %v", maxConsensusEventsTimeout), http.StatusBadRequest)
+		return
+	}
+
+	// wait for the tip to change, if it didn't change before the timeout the
+	// current tip is returned and the subscriber polls again
+	ctx, cancel := context.WithTimeout(jc.Request.Context(), timeout)
+	defer cancel()
+	tip, reorg, err := b.consensus.Wait(ctx, after)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		jc.Error(err, http.StatusServiceUnavailable)
+		return
+	}
+
+	jc.Encode(api.ConsensusEvent{
+		ConsensusState: api.ConsensusState{
+			BlockHeight:   tip.Height,
+			LastBlockTime: b.cm.LastBlockTime(),
+			Synced:        b.cm.Synced(jc.Request.Context()),
+		},
+		BlockID: tip.ID,
+		Reorg:   reorg,
+	})
+}
+
 func (b *bus) consensusNetworkHandler(jc jape.Context) {
 	jc.Encode(api.ConsensusNetwork{
 		Name: b.cm.TipState(jc.Request.Context()).Network.Name,
@@ -281,6 +385,9 @@ func (b *bus) bucketsHandlerPOST(jc jape.Context) {
 	} else if bucket.Name == "" {
 		jc.Error(errors.New("no name provided"), http.StatusBadRequest)
 		return
+	} else if err := bucket.Policy.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
 	} else if jc.Check("failed to create bucket", b.ms.CreateBucket(jc.Request.Context(), bucket.Name, bucket.Policy)) != nil {
 		return
 	}
@@ -293,6 +400,9 @@ func (b *bus) bucketsHandlerPolicyPUT(jc jape.Context) {
 	} else if bucket := jc.PathParam("name"); bucket == "" {
 		jc.Error(errors.New("no bucket name provided"), http.StatusBadRequest)
 		return
+	} else if err := req.Policy.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
 	} else if jc.Check("failed to create bucket", b.ms.UpdateBucketPolicy(jc.Request.Context(), bucket, req.Policy)) != nil {
 		return
 	}
@@ -328,6 +438,24 @@ func (b *bus) bucketHandlerGET(jc jape.Context) {
 	jc.Encode(bucket)
 }
 
+func (b *bus) bucketHandlerStatsGET(jc jape.Context) {
+	var name string
+	if jc.DecodeParam("name", &name) != nil {
+		return
+	} else if name == "" {
+		jc.Error(errors.New("no name provided"), http.StatusBadRequest)
+		return
+	}
+	stats, err := b.ms.BucketStats(jc.Request.Context(), name)
+	if errors.Is(err, api.ErrBucketNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("failed to fetch bucket stats", err) != nil {
+		return
+	}
+	jc.Encode(stats)
+}
+
 func (b *bus) walletHandler(jc jape.Context) {
 	address := b.w.Address()
 	spendable, confirmed, unconfirmed, err := b.w.Balance()
@@ -343,6 +471,102 @@ func (b *bus) walletHandler(jc jape.Context) {
 	})
 }
 
+func (b *bus) walletAddressHandler(jc jape.Context) {
+	jc.Encode(b.w.Address())
+}
+
+func (b *bus) walletBalanceHandler(jc jape.Context) {
+	spendable, confirmed, unconfirmed, err := b.w.Balance()
+	if jc.Check("couldn't fetch wallet balance", err) == nil {
+		jc.Encode(api.WalletBalanceResponse{
+			Confirmed:   confirmed,
+			Spendable:   spendable,
+			Unconfirmed: unconfirmed,
+		})
+	}
+}
+
+func (b *bus) walletSendHandler(jc jape.Context) {
+	var wsr api.WalletSendRequest
+	if jc.Decode(&wsr) != nil {
+		return
+	} else if wsr.Amount.IsZero() {
+		jc.Error(errors.New("'amount' has to be greater than zero"), http.StatusBadRequest)
+		return
+	} else if wsr.Address == types.VoidAddress {
+		jc.Error(errors.New("'address' can't be the void address"), http.StatusBadRequest)
+		return
+	}
+
+	// fund the transaction, the fee depends on the number of inputs so it's
+	// only known once the transaction is funded
+	cs := b.cm.TipState(jc.Request.Context())
+	txn, toSign, fee, err := b.fundSendTransaction(cs, wsr.Address, wsr.Amount)
+	if jc.Check("couldn't fund transaction", err) != nil {
+		return
+	} else if wsr.DryRun {
+		b.w.ReleaseInputs(txn)
+		jc.Encode(api.WalletSendResponse{Fee: fee})
+		return
+	}
+	parents, err := b.tp.UnconfirmedParents(txn)
+	if jc.Check("couldn't load transaction dependencies", err) != nil {
+		b.w.ReleaseInputs(txn)
+		return
+	}
+
+	// sign and broadcast it
+	err = b.w.SignTransaction(cs, &txn, toSign, types.CoveredFields{WholeTransaction: true})
+	if jc.Check("couldn't sign the transaction", err) != nil {
+		b.w.ReleaseInputs(txn)
+		return
+	}
+	if jc.Check("couldn't broadcast the transaction", b.tp.AddTransactionSet(append(parents, txn))) != nil {
+		b.w.ReleaseInputs(txn)
+		return
+	}
+	jc.Encode(api.WalletSendResponse{
+		TransactionID: txn.ID(),
+		Fee:           fee,
+	})
+}
+
+// fundSendTransaction funds a transaction that sends the given amount to the
+// given address. The fee is estimated from the inputs the wallet selected, if
+// that fee isn't covered the inputs are released and the transaction is funded
+// again using the higher fee.
+func (b *bus) fundSendTransaction(cs consensus.State, addr types.Address, amount types.Currency) (types.Transaction, []types.Hash256, types.Currency, error) {
+	// estimate the size of the transaction without its inputs, assuming it
+	// has a change output
+	base := types.EncodedLen(types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Address: addr, Value: amount},
+			{Address: b.w.Address(), Value: types.ZeroCurrency},
+		},
+		MinerFees: []types.Currency{types.ZeroCurrency},
+	})
+
+	feePerByte := b.tp.RecommendedFee()
+	fee := feePerByte.Mul64(uint64(base) + wallet.BytesPerInput)
+	for {
+		txn := types.Transaction{
+			SiacoinOutputs: []types.SiacoinOutput{{Address: addr, Value: amount}},
+			MinerFees:      []types.Currency{fee},
+		}
+		toSign, err := b.w.FundTransaction(cs, &txn, amount.Add(fee), b.tp.Transactions())
+		if err != nil {
+			return types.Transaction{}, nil, types.ZeroCurrency, err
+		}
+
+		required := feePerByte.Mul64(uint64(base) + wallet.BytesPerInput*uint64(len(txn.SiacoinInputs)))
+		if fee.Cmp(required) >= 0 {
+			return txn, toSign, fee, nil
+		}
+		b.w.ReleaseInputs(txn)
+		fee = required
+	}
+}
+
 func (b *bus) walletTransactionsHandler(jc jape.Context) {
 	var before, since time.Time
 	offset := 0
@@ -359,6 +583,13 @@ func (b *bus) walletTransactionsHandler(jc jape.Context) {
 	}
 }
 
+func (b *bus) walletChangeAddressesHandler(jc jape.Context) {
+	addrs, err := b.w.ChangeAddresses()
+	if jc.Check("couldn't load change addresses", err) == nil {
+		jc.Encode(addrs)
+	}
+}
+
 func (b *bus) walletOutputsHandler(jc jape.Context) {
 	utxos, err := b.w.UnspentOutputs()
 	if jc.Check("couldn't load outputs", err) == nil {
@@ -433,6 +664,39 @@ func (b *bus) walletRedistributeHandler(jc jape.Context) {
 	jc.Encode(txn.ID())
 }
 
+func (b *bus) walletConsolidateHandler(jc jape.Context) {
+	var wcr api.WalletConsolidateRequest
+	if jc.Decode(&wcr) != nil {
+		return
+	}
+	if wcr.Outputs <= 0 {
+		jc.Error(errors.New("'outputs' has to be greater than zero"), http.StatusBadRequest)
+		return
+	} else if wcr.MaxInputs <= wcr.Outputs {
+		jc.Error(errors.New("'maxInputs' has to be greater than 'outputs'"), http.StatusBadRequest)
+		return
+	}
+
+	cs := b.cm.TipState(jc.Request.Context())
+	txn, toSign, err := b.w.Consolidate(cs, wcr.MaxInputs, wcr.Outputs, b.tp.RecommendedFee(), b.tp.Transactions())
+	if jc.Check("couldn't consolidate the outputs in the wallet", err) != nil {
+		return
+	}
+
+	err = b.w.SignTransaction(cs, &txn, toSign, types.CoveredFields{WholeTransaction: true})
+	if jc.Check("couldn't sign the transaction", err) != nil {
+		b.w.ReleaseInputs(txn)
+		return
+	}
+
+	if jc.Check("couldn't broadcast the transaction", b.tp.AddTransactionSet([]types.Transaction{txn})) != nil {
+		b.w.ReleaseInputs(txn)
+		return
+	}
+
+	jc.Encode(txn.ID())
+}
+
 func (b *bus) walletDiscardHandler(jc jape.Context) {
 	var txn types.Transaction
 	if jc.Decode(&txn) == nil {
@@ -462,7 +726,7 @@ func (b *bus) walletPrepareFormHandler(jc jape.Context) {
 		FileContracts: []types.FileContract{fc},
 	}
 	txn.MinerFees = []types.Currency{b.tp.RecommendedFee().Mul64(uint64(types.EncodedLen(txn)))}
-	toSign, err := b.w.FundTransaction(cs, &txn, cost.Add(txn.MinerFees[0]), b.tp.Transactions())
+	toSign, err := b.w.FundContractFormation(cs, &txn, cost.Add(txn.MinerFees[0]), b.tp.Transactions(), wpfr.HostKey)
 	if jc.Check("couldn't fund transaction", err) != nil {
 		return
 	}
@@ -538,14 +802,13 @@ func (b *bus) walletPrepareRenewHandler(jc jape.Context) {
 
 func (b *bus) walletPendingHandler(jc jape.Context) {
 	isRelevant := func(txn types.Transaction) bool {
-		addr := b.w.Address()
 		for _, sci := range txn.SiacoinInputs {
-			if sci.UnlockConditions.UnlockHash() == addr {
+			if b.w.OwnsAddress(sci.UnlockConditions.UnlockHash()) {
 				return true
 			}
 		}
 		for _, sco := range txn.SiacoinOutputs {
-			if sco.Address == addr {
+			if b.w.OwnsAddress(sco.Address) {
 				return true
 			}
 		}
@@ -603,6 +866,13 @@ func (b *bus) hostsRemoveHandlerPOST(jc jape.Context) {
 	jc.Encode(removed)
 }
 
+func (b *bus) hostsAliasesHandlerGET(jc jape.Context) {
+	aliases, err := b.hdb.HostAliases(jc.Request.Context())
+	if jc.Check("couldn't fetch host aliases", err) == nil {
+		jc.Encode(aliases)
+	}
+}
+
 func (b *bus) hostsScanningHandlerGET(jc jape.Context) {
 	offset := 0
 	limit := -1
@@ -628,6 +898,49 @@ func (b *bus) hostsPubkeyHandlerGET(jc jape.Context) {
 	}
 }
 
+func (b *bus) hostsPubkeyTagsHandlerPUT(jc jape.Context) {
+	var hostKey types.PublicKey
+	if jc.DecodeParam("hostkey", &hostKey) != nil {
+		return
+	}
+	var req api.UpdateHostTagsRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if len(req.Add)+len(req.Remove) > 0 && req.Clear {
+		jc.Error(errors.New("cannot add or remove tags while clearing the tags"), http.StatusBadRequest)
+		return
+	} else if err := req.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	err := b.hdb.UpdateHostTags(jc.Request.Context(), hostKey, req.Add, req.Remove, req.Clear)
+	if errors.Is(err, api.ErrHostNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	}
+	jc.Check("couldn't update host tags", err)
+}
+
+func (b *bus) hostsPubkeyNotesHandlerPUT(jc jape.Context) {
+	var hostKey types.PublicKey
+	if jc.DecodeParam("hostkey", &hostKey) != nil {
+		return
+	}
+	var req api.UpdateHostNotesRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if err := req.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	err := b.hdb.UpdateHostNotes(jc.Request.Context(), hostKey, req.Notes, req.ScoreModifier)
+	if errors.Is(err, api.ErrHostNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	}
+	jc.Check("couldn't update host notes", err)
+}
+
 func (b *bus) hostsScanHandlerPOST(jc jape.Context) {
 	var req api.HostsScanRequest
 	if jc.Decode(&req) != nil {
@@ -658,6 +971,87 @@ func (b *bus) contractsSpendingHandlerPOST(jc jape.Context) {
 	}
 }
 
+func (b *bus) metricsContractsSpendingHandlerGET(jc jape.Context) {
+	var fcid types.FileContractID
+	if jc.DecodeParam("id", &fcid) != nil {
+		return
+	}
+	var from, to time.Time
+	if jc.DecodeForm("from", (*api.TimeRFC3339)(&from)) != nil ||
+		jc.DecodeForm("to", (*api.TimeRFC3339)(&to)) != nil {
+		return
+	}
+	if !to.IsZero() && to.Before(from) {
+		jc.Error(errors.New("'to' can't be before 'from'"), http.StatusBadRequest)
+		return
+	}
+	metrics, err := b.ms.ContractSpendingMetrics(jc.Request.Context(), fcid, from, to)
+	if jc.Check("failed to fetch contract spending metrics", err) == nil {
+		jc.Encode(metrics)
+	}
+}
+
+func (b *bus) metricsUploadsHandlerGET(jc jape.Context) {
+	var from, to time.Time
+	var worker string
+	if jc.DecodeForm("from", (*api.TimeRFC3339)(&from)) != nil ||
+		jc.DecodeForm("to", (*api.TimeRFC3339)(&to)) != nil ||
+		jc.DecodeForm("worker", &worker) != nil {
+		return
+	}
+	if !to.IsZero() && to.Before(from) {
+		jc.Error(errors.New("'to' can't be before 'from'"), http.StatusBadRequest)
+		return
+	}
+	metrics, err := b.ms.UploadStatsMetrics(jc.Request.Context(), from, to, worker)
+	if jc.Check("failed to fetch upload stats metrics", err) == nil {
+		jc.Encode(metrics)
+	}
+}
+
+func (b *bus) metricsUploadsHandlerPOST(jc jape.Context) {
+	var metric api.UploadStatsMetric
+	if jc.Decode(&metric) != nil {
+		return
+	} else if time.Time(metric.Timestamp).IsZero() {
+		metric.Timestamp = api.TimeRFC3339(time.Now())
+	}
+	jc.Check("failed to record upload stats metric", b.ms.RecordUploadStatsMetric(jc.Request.Context(), metric))
+}
+
+func (b *bus) metricsHostsHandlerGET(jc jape.Context) {
+	var from, to time.Time
+	var hostKey types.PublicKey
+	var worker string
+	if jc.DecodeForm("from", (*api.TimeRFC3339)(&from)) != nil ||
+		jc.DecodeForm("to", (*api.TimeRFC3339)(&to)) != nil ||
+		jc.DecodeForm("hostKey", &hostKey) != nil ||
+		jc.DecodeForm("worker", &worker) != nil {
+		return
+	}
+	if !to.IsZero() && to.Before(from) {
+		jc.Error(errors.New("'to' can't be before 'from'"), http.StatusBadRequest)
+		return
+	}
+	metrics, err := b.ms.HostMetrics(jc.Request.Context(), from, to, hostKey, worker)
+	if jc.Check("failed to fetch host metrics", err) == nil {
+		jc.Encode(metrics)
+	}
+}
+
+func (b *bus) metricsHostsHandlerPOST(jc jape.Context) {
+	var metrics []api.HostMetric
+	if jc.Decode(&metrics) != nil {
+		return
+	}
+	for i := range metrics {
+		if time.Time(metrics[i].Timestamp).IsZero() {
+			metrics[i].Timestamp = api.TimeRFC3339(time.Now())
+		}
+	}
+	jc.Check("failed to record host metrics", b.ms.RecordHostMetrics(jc.Request.Context(), metrics))
+}
+
 func (b *bus) hostsAllowlistHandlerGET(jc jape.Context) {
 	allowlist, err := b.hdb.HostAllowlist(jc.Request.Context())
 	if jc.Check("couldn't load allowlist", err) == nil {
@@ -668,14 +1062,21 @@ func (b *bus) hostsAllowlistHandlerGET(jc jape.Context) {
 func (b *bus) hostsAllowlistHandlerPUT(jc jape.Context) {
 	ctx := jc.Request.Context()
 	var req api.UpdateAllowlistRequest
-	if jc.Decode(&req) == nil {
-		if len(req.Add)+len(req.Remove) > 0 && req.Clear {
-			jc.Error(errors.New("cannot add or remove entries while clearing the allowlist"), http.StatusBadRequest)
-			return
-		} else if jc.Check("couldn't update allowlist entries", b.hdb.UpdateHostAllowlistEntries(ctx, req.Add, req.Remove, req.Clear)) != nil {
-			return
+	if jc.Decode(&req) != nil {
+		return
+	} else if len(req.Remove) > 0 && req.Clear {
+		jc.Error(errors.New("cannot remove entries while clearing the allowlist"), http.StatusBadRequest)
+		return
+	}
+
+	if req.DryRun {
+		impact, err := b.hdb.HostAllowlistUpdateImpact(ctx, req.Add, req.Remove, req.Clear)
+		if jc.Check("couldn't compute allowlist update impact", err) == nil {
+			jc.Encode(impact)
 		}
+		return
 	}
+	jc.Check("couldn't update allowlist entries", b.hdb.UpdateHostAllowlistEntries(ctx, req.Add, req.Remove, req.Clear))
 }
 
 func (b *bus) hostsBlocklistHandlerGET(jc jape.Context) {
@@ -688,14 +1089,24 @@ func (b *bus) hostsBlocklistHandlerGET(jc jape.Context) {
 func (b *bus) hostsBlocklistHandlerPUT(jc jape.Context) {
 	ctx := jc.Request.Context()
 	var req api.UpdateBlocklistRequest
-	if jc.Decode(&req) == nil {
-		if len(req.Add)+len(req.Remove) > 0 && req.Clear {
-			jc.Error(errors.New("cannot add or remove entries while clearing the blocklist"), http.StatusBadRequest)
-			return
-		} else if jc.Check("couldn't update blocklist entries", b.hdb.UpdateHostBlocklistEntries(ctx, req.Add, req.Remove, req.Clear)) != nil {
-			return
+	if jc.Decode(&req) != nil {
+		return
+	} else if len(req.Remove) > 0 && req.Clear {
+		jc.Error(errors.New("cannot remove entries while clearing the blocklist"), http.StatusBadRequest)
+		return
+	} else if err := req.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	if req.DryRun {
+		impact, err := b.hdb.HostBlocklistUpdateImpact(ctx, req.Add, req.Remove, req.Clear)
+		if jc.Check("couldn't compute blocklist update impact", err) == nil {
+			jc.Encode(impact)
 		}
+		return
 	}
+	jc.Check("couldn't update blocklist entries", b.hdb.UpdateHostBlocklistEntries(ctx, req.Add, req.Remove, req.Clear))
 }
 
 func (b *bus) contractsHandlerGET(jc jape.Context) {
@@ -723,12 +1134,26 @@ func (b *bus) contractsArchiveHandlerPOST(jc jape.Context) {
 		return
 	}
 
-	jc.Check("failed to archive contracts", b.ms.ArchiveContracts(jc.Request.Context(), toArchive))
+	ids := make([]types.FileContractID, 0, len(toArchive))
+	for id := range toArchive {
+		ids = append(ids, id)
+	}
+	contracts := b.contractsMetadata(jc.Request.Context(), ids)
+
+	if jc.Check("failed to archive contracts", b.ms.ArchiveContracts(jc.Request.Context(), toArchive)) != nil {
+		return
+	}
+	for _, c := range contracts {
+		b.broadcastContractEvent(jc.Request.Context(), api.WebhookEventContractArchived, c, toArchive[c.ID])
+	}
 }
 
 func (b *bus) contractsSetHandlerGET(jc jape.Context) {
 	cs, err := b.ms.ContractSetContracts(jc.Request.Context(), jc.PathParam("set"))
-	if jc.Check("couldn't load contracts", err) == nil {
+	if errors.Is(err, api.ErrContractSetNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't load contracts", err) == nil {
 		jc.Encode(cs)
 	}
 }
@@ -903,9 +1328,11 @@ func (b *bus) contractIDHandlerPOST(jc jape.Context) {
 	}
 
 	a, err := b.ms.AddContract(jc.Request.Context(), req.Contract, req.TotalCost, req.StartHeight)
-	if jc.Check("couldn't store contract", err) == nil {
-		jc.Encode(a)
+	if jc.Check("couldn't store contract", err) != nil {
+		return
 	}
+	b.broadcastContractEvent(jc.Request.Context(), api.WebhookEventContractFormed, a, "")
+	jc.Encode(a)
 }
 
 func (b *bus) contractIDRenewedHandlerPOST(jc jape.Context) {
@@ -924,9 +1351,12 @@ func (b *bus) contractIDRenewedHandlerPOST(jc jape.Context) {
 	}
 
 	r, err := b.ms.AddRenewedContract(jc.Request.Context(), req.Contract, req.TotalCost, req.StartHeight, req.RenewedFrom)
-	if jc.Check("couldn't store contract", err) == nil {
-		jc.Encode(r)
+	if jc.Check("couldn't store contract", err) != nil {
+		return
 	}
+	b.uploadingSectors.renewContract(req.RenewedFrom, r.ID)
+	b.broadcastContractEvent(jc.Request.Context(), api.WebhookEventContractRenewed, r, "")
+	jc.Encode(r)
 }
 
 func (b *bus) contractIDRootsHandlerGET(jc jape.Context) {
@@ -936,11 +1366,88 @@ func (b *bus) contractIDRootsHandlerGET(jc jape.Context) {
 	}
 
 	roots, err := b.ms.ContractRoots(jc.Request.Context(), id)
-	if jc.Check("couldn't fetch contract sectors", err) == nil {
-		jc.Encode(api.ContractRootsResponse{
-			Roots:     roots,
-			Uploading: b.uploadingSectors.sectors(id),
-		})
+	if jc.Check("couldn't fetch contract sectors", err) != nil {
+		return
+	}
+
+	// the sectors of checkpointed uploads are not part of any object yet but
+	// they need to be protected from pruning until the upload is resumed
+	checkpointed, err := b.ms.PartialObjectRoots(jc.Request.Context(), id)
+	if jc.Check("couldn't fetch checkpointed sectors", err) != nil {
+		return
+	}
+	jc.Encode(api.ContractRootsResponse{
+		Roots:     roots,
+		Uploading: append(b.uploadingSectors.sectors(id), checkpointed...),
+	})
+}
+
+func (b *bus) contractIDSlabsHandlerGET(jc jape.Context) {
+	var id types.FileContractID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	limit := -1
+	if jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+
+	slabs, err := b.ms.ContractSlabs(jc.Request.Context(), id, limit)
+	if jc.Check("couldn't fetch contract slabs", err) == nil {
+		jc.Encode(slabs)
+	}
+}
+
+func (b *bus) hostsPubkeyObjectsHandlerGET(jc jape.Context) {
+	var hostKey types.PublicKey
+	if jc.DecodeParam("hostkey", &hostKey) != nil {
+		return
+	}
+	limit := -1
+	if jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+
+	objects, err := b.ms.HostObjects(jc.Request.Context(), hostKey, limit)
+	if jc.Check("couldn't fetch host objects", err) == nil {
+		jc.Encode(objects)
+	}
+}
+
+func (b *bus) hostsPubkeyAffectedObjectsHandlerGET(jc jape.Context) {
+	var hostKey types.PublicKey
+	if jc.DecodeParam("hostkey", &hostKey) != nil {
+		return
+	}
+	offset := 0
+	limit := -1
+	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+
+	objects, err := b.ms.HostAffectedObjects(jc.Request.Context(), hostKey, offset, limit)
+	if jc.Check("couldn't fetch affected host objects", err) == nil {
+		jc.Encode(objects)
+	}
+}
+
+func (b *bus) contractIDAffectedObjectsHandlerGET(jc jape.Context) {
+	var id types.FileContractID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	offset := 0
+	limit := -1
+	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+
+	objects, err := b.ms.ContractAffectedObjects(jc.Request.Context(), id, offset, limit)
+	if errors.Is(err, api.ErrContractNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't fetch affected contract objects", err) == nil {
+		jc.Encode(objects)
 	}
 }
 
@@ -949,11 +1456,24 @@ func (b *bus) contractIDHandlerDELETE(jc jape.Context) {
 	if jc.DecodeParam("id", &id) != nil {
 		return
 	}
-	jc.Check("couldn't remove contract", b.ms.ArchiveContract(jc.Request.Context(), id, api.ContractArchivalReasonRemoved))
+	contracts := b.contractsMetadata(jc.Request.Context(), []types.FileContractID{id})
+	if jc.Check("couldn't remove contract", b.ms.ArchiveContract(jc.Request.Context(), id, api.ContractArchivalReasonRemoved)) != nil {
+		return
+	}
+	b.broadcastContractEvent(jc.Request.Context(), api.WebhookEventContractArchived, contracts[0], api.ContractArchivalReasonRemoved)
 }
 
 func (b *bus) contractsAllHandlerDELETE(jc jape.Context) {
-	jc.Check("couldn't remove contracts", b.ms.ArchiveAllContracts(jc.Request.Context(), api.ContractArchivalReasonRemoved))
+	contracts, err := b.ms.Contracts(jc.Request.Context())
+	if jc.Check("couldn't fetch contracts", err) != nil {
+		return
+	}
+	if jc.Check("couldn't remove contracts", b.ms.ArchiveAllContracts(jc.Request.Context(), api.ContractArchivalReasonRemoved)) != nil {
+		return
+	}
+	for _, c := range contracts {
+		b.broadcastContractEvent(jc.Request.Context(), api.WebhookEventContractArchived, c, api.ContractArchivalReasonRemoved)
+	}
 }
 
 func (b *bus) searchObjectsHandlerGET(jc jape.Context) {
@@ -967,7 +1487,21 @@ func (b *bus) searchObjectsHandlerGET(jc jape.Context) {
 	if jc.DecodeForm("bucket", &bucket) != nil {
 		return
 	}
-	keys, err := b.ms.SearchObjects(jc.Request.Context(), bucket, key, offset, limit)
+
+	// metadata filters are passed as 'key:value'
+	var metadata api.ObjectUserMetadata
+	for _, kv := range jc.Request.URL.Query()["metadata"] {
+		k, v, found := strings.Cut(kv, ":")
+		if !found || k == "" {
+			jc.Error(fmt.Errorf("invalid metadata filter '%s', expected 'key:value'", kv), http.StatusBadRequest)
+			return
+		} else if metadata == nil {
+			metadata = make(api.ObjectUserMetadata)
+		}
+		metadata[k] = v
+	}
+
+	keys, err := b.ms.SearchObjects(jc.Request.Context(), bucket, key, metadata, offset, limit)
 	if jc.Check("couldn't list objects", err) != nil {
 		return
 	}
@@ -988,8 +1522,18 @@ func (b *bus) objectsHandlerGET(jc jape.Context) {
 	if jc.DecodeForm("bucket", &bucket) != nil {
 		return
 	}
+	var onlyMetadata bool
+	if jc.DecodeForm("onlyMetadata", &onlyMetadata) != nil {
+		return
+	}
 
-	o, err := b.ms.Object(jc.Request.Context(), bucket, path)
+	var o api.Object
+	var err error
+	if onlyMetadata {
+		o, err = b.ms.ObjectMetadata(jc.Request.Context(), bucket, path)
+	} else {
+		o, err = b.ms.Object(jc.Request.Context(), bucket, path)
+	}
 	if errors.Is(err, api.ErrObjectNotFound) {
 		jc.Error(err, http.StatusNotFound)
 		return
@@ -1038,10 +1582,26 @@ func (b *bus) objectsHandlerPUT(jc jape.Context) {
 	var aor api.ObjectAddRequest
 	if jc.Decode(&aor) != nil {
 		return
+	} else if err := aor.Metadata.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
 	} else if aor.Bucket == "" {
 		aor.Bucket = api.DefaultBucketName
 	}
-	jc.Check("couldn't store object", b.ms.UpdateObject(jc.Request.Context(), aor.Bucket, jc.PathParam("path"), aor.ContractSet, aor.ETag, aor.MimeType, aor.Object, aor.UsedContracts))
+	overwritten, err := b.ms.UpdateObject(jc.Request.Context(), aor.Bucket, jc.PathParam("path"), aor.ContractSet, aor.ETag, aor.MimeType, aor.Metadata, aor.Object, aor.UsedContracts)
+	if errors.Is(err, api.ErrObjectTooLarge) || errors.Is(err, api.ErrBucketQuotaExceeded) {
+		jc.Error(err, http.StatusRequestEntityTooLarge)
+		return
+	} else if jc.Check("couldn't store object", err) != nil {
+		return
+	}
+	if err := b.ms.DeletePartialObject(jc.Request.Context(), aor.Bucket, jc.PathParam("path")); err != nil {
+		b.logger.Errorf("failed to delete checkpoint of '%v', err: %v", jc.PathParam("path"), err)
+	}
+	if overwritten {
+		b.slabPruner.Trigger()
+	}
+	b.broadcastObjectAddedEvent(jc.Request.Context(), overwritten, aor.Bucket, jc.PathParam("path"), aor.Object.TotalSize())
 }
 
 func (b *bus) objectsCopyHandlerPOST(jc jape.Context) {
@@ -1050,10 +1610,17 @@ func (b *bus) objectsCopyHandlerPOST(jc jape.Context) {
 		return
 	}
 
-	om, err := b.ms.CopyObject(jc.Request.Context(), orr.SourceBucket, orr.DestinationBucket, orr.SourcePath, orr.DestinationPath, orr.MimeType)
-	if jc.Check("couldn't copy object", err) != nil {
+	om, overwritten, err := b.ms.CopyObject(jc.Request.Context(), orr.SourceBucket, orr.DestinationBucket, orr.SourcePath, orr.DestinationPath, orr.MimeType)
+	if errors.Is(err, api.ErrObjectNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, api.ErrObjectTooLarge) || errors.Is(err, api.ErrBucketQuotaExceeded) {
+		jc.Error(err, http.StatusRequestEntityTooLarge)
+		return
+	} else if jc.Check("couldn't copy object", err) != nil {
 		return
 	}
+	b.broadcastObjectAddedEvent(jc.Request.Context(), overwritten, orr.DestinationBucket, orr.DestinationPath, om.Size)
 
 	jc.ResponseWriter.Header().Set("Last-Modified", om.LastModified())
 	jc.ResponseWriter.Header().Set("ETag", api.FormatETag(om.ETag))
@@ -1067,13 +1634,49 @@ func (b *bus) objectsListHandlerPOST(jc jape.Context) {
 	} else if req.Bucket == "" {
 		req.Bucket = api.DefaultBucketName
 	}
-	resp, err := b.ms.ListObjects(jc.Request.Context(), req.Bucket, req.Prefix, req.Marker, req.Limit)
-	if jc.Check("couldn't list objects", err) != nil {
+	resp, err := b.ms.ListObjects(jc.Request.Context(), req.Bucket, req.Prefix, req.Delimiter, req.SortBy, req.SortDir, req.Marker, req.Limit)
+	if errors.Is(err, api.ErrInvalidObjectSortParameters) || errors.Is(err, api.ErrInvalidMarker) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if jc.Check("couldn't list objects", err) != nil {
 		return
 	}
 	jc.Encode(resp)
 }
 
+func (b *bus) objectsSampleHandlerPOST(jc jape.Context) {
+	var osr api.ObjectsSampleRequest
+	if jc.Decode(&osr) != nil {
+		return
+	} else if osr.Limit <= 0 {
+		jc.Error(errors.New("limit must be greater than zero"), http.StatusBadRequest)
+		return
+	}
+	objects, err := b.ms.SampleObjects(jc.Request.Context(), osr.Limit)
+	if jc.Check("couldn't sample objects", err) != nil {
+		return
+	}
+	jc.Encode(objects)
+}
+
+func (b *bus) objectsPromoteHandlerPOST(jc jape.Context) {
+	var opr api.ObjectsPromoteRequest
+	if jc.Decode(&opr) != nil {
+		return
+	} else if opr.Bucket == "" {
+		opr.Bucket = api.DefaultBucketName
+	}
+	err := b.ms.PromoteObject(jc.Request.Context(), opr.Bucket, opr.Path, opr.DestinationBucket, opr.DestinationPath)
+	if errors.Is(err, api.ErrObjectNotFound) || errors.Is(err, api.ErrBucketNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, api.ErrObjectTooLarge) || errors.Is(err, api.ErrBucketQuotaExceeded) {
+		jc.Error(err, http.StatusRequestEntityTooLarge)
+		return
+	}
+	jc.Check("couldn't promote object", err)
+}
+
 func (b *bus) objectsRenameHandlerPOST(jc jape.Context) {
 	var orr api.ObjectsRenameRequest
 	if jc.Decode(&orr) != nil {
@@ -1087,7 +1690,15 @@ func (b *bus) objectsRenameHandlerPOST(jc jape.Context) {
 			jc.Error(fmt.Errorf("can't rename dirs with mode %v", orr.Mode), http.StatusBadRequest)
 			return
 		}
-		jc.Check("couldn't rename object", b.ms.RenameObject(jc.Request.Context(), orr.Bucket, orr.From, orr.To))
+		err := b.ms.RenameObject(jc.Request.Context(), orr.Bucket, orr.From, orr.To)
+		if errors.Is(err, api.ErrObjectNotFound) {
+			jc.Error(err, http.StatusNotFound)
+			return
+		} else if errors.Is(err, api.ErrObjectExists) {
+			jc.Error(err, http.StatusConflict)
+			return
+		}
+		jc.Check("couldn't rename object", err)
 		return
 	} else if orr.Mode == api.ObjectsRenameModeMulti {
 		// Multi object rename.
@@ -1095,7 +1706,12 @@ func (b *bus) objectsRenameHandlerPOST(jc jape.Context) {
 			jc.Error(fmt.Errorf("can't rename file with mode %v", orr.Mode), http.StatusBadRequest)
 			return
 		}
-		jc.Check("couldn't rename objects", b.ms.RenameObjects(jc.Request.Context(), orr.Bucket, orr.From, orr.To))
+		err := b.ms.RenameObjects(jc.Request.Context(), orr.Bucket, orr.From, orr.To)
+		if errors.Is(err, api.ErrObjectNotFound) {
+			jc.Error(err, http.StatusNotFound)
+			return
+		}
+		jc.Check("couldn't rename objects", err)
 		return
 	} else {
 		// Invalid mode.
@@ -1115,15 +1731,65 @@ func (b *bus) objectsHandlerDELETE(jc jape.Context) {
 	}
 	var err error
 	if batch {
-		err = b.ms.RemoveObjects(jc.Request.Context(), bucket, jc.PathParam("path"))
+		path := jc.PathParam("path")
+		deletion := b.deletions.start(bucket, path)
+		err = b.ms.RemoveObjects(jc.Request.Context(), bucket, path, deletion.update)
+		b.deletions.finish(deletion)
 	} else {
 		err = b.ms.RemoveObject(jc.Request.Context(), bucket, jc.PathParam("path"))
 	}
 	if errors.Is(err, api.ErrObjectNotFound) {
 		jc.Error(err, http.StatusNotFound)
 		return
+	} else if jc.Check("couldn't delete object", err) != nil {
+		return
 	}
-	jc.Check("couldn't delete object", err)
+	b.slabPruner.Trigger()
+	b.broadcastObjectEvent(jc.Request.Context(), api.WebhookEventObjectDeleted, bucket, jc.PathParam("path"), batch, 0)
+}
+
+func (b *bus) partialObjectsHandlerGET(jc jape.Context) {
+	bucket := api.DefaultBucketName
+	if jc.DecodeForm("bucket", &bucket) != nil {
+		return
+	}
+	po, err := b.ms.PartialObject(jc.Request.Context(), bucket, jc.PathParam("path"))
+	if errors.Is(err, api.ErrPartialObjectNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't fetch partial object", err) != nil {
+		return
+	}
+	jc.Encode(po)
+}
+
+func (b *bus) partialObjectsHandlerPUT(jc jape.Context) {
+	var req api.PartialObjectAddRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if req.Bucket == "" {
+		req.Bucket = api.DefaultBucketName
+	}
+
+	// prune the checkpoints of abandoned uploads
+	if _, err := b.ms.PrunePartialObjects(jc.Request.Context(), time.Now().Add(-cacheExpiry)); err != nil {
+		b.logger.Errorf("failed to prune partial objects, err: %v", err)
+	}
+
+	err := b.ms.AddPartialObjectSlabs(jc.Request.Context(), req.Bucket, jc.PathParam("path"), req.Offset, req.PartialObject)
+	if errors.Is(err, api.ErrPartialObjectConflict) {
+		jc.Error(err, http.StatusConflict)
+		return
+	}
+	jc.Check("couldn't update partial object", err)
+}
+
+func (b *bus) partialObjectsHandlerDELETE(jc jape.Context) {
+	bucket := api.DefaultBucketName
+	if jc.DecodeForm("bucket", &bucket) != nil {
+		return
+	}
+	jc.Check("couldn't delete partial object", b.ms.DeletePartialObject(jc.Request.Context(), bucket, jc.PathParam("path")))
 }
 
 func (b *bus) slabbuffersHandlerGET(jc jape.Context) {
@@ -1142,6 +1808,18 @@ func (b *bus) objectsStatshandlerGET(jc jape.Context) {
 	jc.Encode(info)
 }
 
+func (b *bus) slabsHealthStatsHandlerGET(jc jape.Context) {
+	var set string
+	if jc.DecodeForm("contractset", &set) != nil {
+		return
+	}
+	histogram, err := b.ms.SlabHealthHistogram(jc.Request.Context(), set)
+	if jc.Check("couldn't get slab health stats", err) != nil {
+		return
+	}
+	jc.Encode(histogram)
+}
+
 func (b *bus) packedSlabsHandlerFetchPOST(jc jape.Context) {
 	var psrg api.PackedSlabsRequestGET
 	if jc.Decode(&psrg) != nil {
@@ -1188,6 +1866,25 @@ func (b *bus) sectorsHostRootHandlerDELETE(jc jape.Context) {
 	}
 }
 
+func (b *bus) sectorsDeletionsHandlerGET(jc jape.Context) {
+	limit := -1
+	if jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	deletions, err := b.ms.SectorDeletions(jc.Request.Context(), limit)
+	if jc.Check("couldn't fetch sector deletions", err) == nil {
+		jc.Encode(deletions)
+	}
+}
+
+func (b *bus) sectorsDeletionsHandlerDonePOST(jc jape.Context) {
+	var req api.ContractSectorDeletions
+	if jc.Decode(&req) != nil {
+		return
+	}
+	jc.Check("couldn't remove sector deletions", b.ms.RemoveSectorDeletions(jc.Request.Context(), req.ContractID, req.Roots))
+}
+
 func (b *bus) slabObjectsHandlerGET(jc jape.Context) {
 	var key object.EncryptionKey
 	if jc.DecodeParam("key", &key) != nil {
@@ -1242,6 +1939,44 @@ func (b *bus) slabsMigrationHandlerPOST(jc jape.Context) {
 	}
 }
 
+func (b *bus) slabsHealthHandlerGET(jc jape.Context) {
+	var set string
+	var unhealthy bool
+	offset, limit := 0, -1
+	if jc.DecodeForm("contractSet", &set) != nil ||
+		jc.DecodeForm("unhealthy", &unhealthy) != nil ||
+		jc.DecodeForm("offset", &offset) != nil ||
+		jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+
+	// default to the default contract set
+	if set == "" {
+		var css api.ContractSetSetting
+		if err := b.fetchSetting(jc.Request.Context(), api.SettingContractSet, &css); err != nil && !errors.Is(err, api.ErrSettingNotFound) {
+			jc.Error(fmt.Errorf("could not get contract set settings: %w", err), http.StatusInternalServerError)
+			return
+		}
+		set = css.Default
+	}
+	if set == "" {
+		jc.Error(errors.New("no contract set provided"), http.StatusBadRequest)
+		return
+	}
+
+	slabs, err := b.ms.SlabsHealth(jc.Request.Context(), set, unhealthy, offset, limit)
+	if errors.Is(err, api.ErrContractSetNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't compute slab health", err) != nil {
+		return
+	}
+	jc.Encode(api.SlabsHealthResponse{
+		ContractSet: set,
+		Slabs:       slabs,
+	})
+}
+
 func (b *bus) slabsPartialHandlerGET(jc jape.Context) {
 	jc.Custom(nil, []byte{})
 
@@ -1354,6 +2089,9 @@ func (b *bus) settingKeyHandlerPUT(jc jape.Context) {
 	if key == "" {
 		jc.Error(errors.New("param 'key' can not be empty"), http.StatusBadRequest)
 		return
+	} else if key == settingsVersionKey {
+		jc.Error(errSettingsVersionReadOnly, http.StatusBadRequest)
+		return
 	}
 
 	var value interface{}
@@ -1388,7 +2126,9 @@ func (b *bus) settingKeyHandlerPUT(jc jape.Context) {
 		}
 	}
 
-	jc.Check("could not update setting", b.ss.UpdateSetting(jc.Request.Context(), key, string(data)))
+	if jc.Check("could not update setting", b.ss.UpdateSetting(jc.Request.Context(), key, string(data))) == nil {
+		jc.Check("could not update settings version", b.settingsVersion.Bump(jc.Request.Context(), key))
+	}
 }
 
 func (b *bus) settingKeyHandlerDELETE(jc jape.Context) {
@@ -1397,7 +2137,49 @@ func (b *bus) settingKeyHandlerDELETE(jc jape.Context) {
 		jc.Error(errors.New("param 'key' can not be empty"), http.StatusBadRequest)
 		return
 	}
-	jc.Check("could not delete setting", b.ss.DeleteSetting(jc.Request.Context(), key))
+	if key == settingsVersionKey {
+		jc.Error(errSettingsVersionReadOnly, http.StatusBadRequest)
+		return
+	}
+	if jc.Check("could not delete setting", b.ss.DeleteSetting(jc.Request.Context(), key)) == nil {
+		jc.Check("could not update settings version", b.settingsVersion.Bump(jc.Request.Context(), key))
+	}
+}
+
+func (b *bus) maintenanceHandlerGET(jc jape.Context) {
+	var ms api.MaintenanceSettings
+	if err := b.fetchSetting(jc.Request.Context(), api.SettingMaintenance, &ms); err != nil && !errors.Is(err, api.ErrSettingNotFound) {
+		jc.Error(fmt.Errorf("could not get maintenance settings: %w", err), http.StatusInternalServerError)
+		return
+	}
+	jc.Encode(api.MaintenanceResponse{
+		MaintenanceSettings: ms,
+		Active:              ms.Active(time.Now()),
+	})
+}
+
+func (b *bus) maintenanceHandlerPUT(jc jape.Context) {
+	var req api.MaintenanceRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if req.Duration < 0 {
+		jc.Error(errors.New("duration can not be negative"), http.StatusBadRequest)
+		return
+	}
+
+	ms := api.MaintenanceSettings{
+		Enabled: req.Enabled,
+		Reason:  req.Reason,
+	}
+	if req.Enabled && req.Duration > 0 {
+		ms.Until = time.Now().Add(time.Duration(req.Duration))
+	}
+	data, err := json.Marshal(ms)
+	if jc.Check("couldn't marshal maintenance settings", err) != nil {
+		return
+	} else if jc.Check("could not update maintenance settings", b.ss.UpdateSetting(jc.Request.Context(), api.SettingMaintenance, string(data))) == nil {
+		jc.Check("could not update settings version", b.settingsVersion.Bump(jc.Request.Context(), api.SettingMaintenance))
+	}
 }
 
 func (b *bus) contractIDAncestorsHandler(jc jape.Context) {
@@ -1440,10 +2222,17 @@ func (b *bus) paramsHandlerUploadGET(jc jape.Context) {
 		uploadPacking = pus.Enabled
 	}
 
+	var ms api.MaintenanceSettings
+	if err := b.fetchSetting(jc.Request.Context(), api.SettingMaintenance, &ms); err != nil && !errors.Is(err, api.ErrSettingNotFound) {
+		jc.Error(fmt.Errorf("could not get maintenance settings: %w", err), http.StatusInternalServerError)
+		return
+	}
+
 	jc.Encode(api.UploadParams{
 		ContractSet:   contractSet,
 		CurrentHeight: b.cm.TipState(jc.Request.Context()).Index.Height,
 		GougingParams: gp,
+		Maintenance:   ms,
 		UploadPacking: uploadPacking,
 	})
 }
@@ -1479,18 +2268,53 @@ func (b *bus) gougingParams(ctx context.Context) (api.GougingParams, error) {
 		b.logger.Panicf("failed to unmarshal redundancy settings '%s': %v", rss, err)
 	}
 
+	var ds api.DownloadSettings
+	if err := b.fetchSetting(ctx, api.SettingDownloads, &ds); err != nil && !errors.Is(err, api.ErrSettingNotFound) {
+		return api.GougingParams{}, err
+	}
+
 	cs := b.consensusState(ctx)
 
 	return api.GougingParams{
 		ConsensusState:     cs,
+		DownloadSettings:   ds,
 		GougingSettings:    gs,
 		RedundancySettings: rs,
 		TransactionFee:     b.tp.RecommendedFee(),
+		SettingsVersion:    b.settingsVersion.Version(),
 	}, nil
 }
 
-func (b *bus) handleGETAlerts(c jape.Context) {
-	c.Encode(b.alertMgr.Active())
+func (b *bus) handleGETAlerts(jc jape.Context) {
+	var severity string
+	opts := alerts.AlertsOpts{Limit: -1}
+	if jc.DecodeForm("severity", &severity) != nil {
+		return
+	} else if jc.DecodeForm("module", &opts.Module) != nil {
+		return
+	} else if jc.DecodeForm("dismissed", &opts.Dismissed) != nil {
+		return
+	} else if jc.DecodeForm("offset", &opts.Offset) != nil {
+		return
+	} else if jc.DecodeForm("limit", &opts.Limit) != nil {
+		return
+	}
+	if severity != "" {
+		if err := opts.Severity.UnmarshalText([]byte(severity)); err != nil {
+			jc.Error(err, http.StatusBadRequest)
+			return
+		}
+	}
+	if opts.Offset < 0 {
+		jc.Error(errors.New("offset can not be negative"), http.StatusBadRequest)
+		return
+	}
+
+	as, err := b.alertMgr.Alerts(jc.Request.Context(), opts)
+	if jc.Check("failed to fetch alerts", err) != nil {
+		return
+	}
+	jc.Encode(as)
 }
 
 func (b *bus) handlePOSTAlertsDismiss(jc jape.Context) {
@@ -1681,11 +2505,81 @@ func (b *bus) autopilotsHandlerPUT(jc jape.Context) {
 	if ap.ID != id {
 		jc.Error(errors.New("id in path and body don't match"), http.StatusBadRequest)
 		return
+	} else if err := ap.Config.Validate(); err != nil {
+		jc.Error(fmt.Errorf("invalid autopilot config: %w", err), http.StatusBadRequest)
+		return
 	}
 
 	jc.Check("failed to update autopilot", b.as.UpdateAutopilot(jc.Request.Context(), ap))
 }
 
+func (b *bus) autopilotProfilesHandlerGET(jc jape.Context) {
+	var id string
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	profiles, err := b.as.AutopilotProfiles(jc.Request.Context(), id)
+	if jc.Check("failed to fetch autopilot profiles", err) == nil {
+		jc.Encode(profiles)
+	}
+}
+
+func (b *bus) autopilotProfileHandlerGET(jc jape.Context) {
+	var id, name string
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("name", &name) != nil {
+		return
+	}
+	profile, err := b.as.AutopilotProfile(jc.Request.Context(), id, name)
+	if errors.Is(err, api.ErrAutopilotProfileNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("failed to fetch autopilot profile", err) == nil {
+		jc.Encode(profile)
+	}
+}
+
+func (b *bus) autopilotProfileHandlerPUT(jc jape.Context) {
+	var id, name string
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("name", &name) != nil {
+		return
+	}
+	var cfg api.AutopilotConfig
+	if jc.Decode(&cfg) != nil {
+		return
+	} else if err := cfg.Validate(); err != nil {
+		jc.Error(fmt.Errorf("invalid autopilot config: %w", err), http.StatusBadRequest)
+		return
+	}
+	jc.Check("failed to update autopilot profile", b.as.UpdateAutopilotProfile(jc.Request.Context(), id, api.AutopilotProfile{Name: name, Config: cfg}))
+}
+
+func (b *bus) autopilotProfileHandlerDELETE(jc jape.Context) {
+	var id, name string
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("name", &name) != nil {
+		return
+	}
+	err := b.as.DeleteAutopilotProfile(jc.Request.Context(), id, name)
+	if errors.Is(err, api.ErrAutopilotProfileNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	}
+	jc.Check("failed to delete autopilot profile", err)
+}
+
+func (b *bus) autopilotProfileActivateHandlerPOST(jc jape.Context) {
+	var id, name string
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("name", &name) != nil {
+		return
+	}
+	ap, err := b.as.ActivateAutopilotProfile(jc.Request.Context(), id, name)
+	if errors.Is(err, api.ErrAutopilotProfileNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("failed to activate autopilot profile", err) == nil {
+		jc.Encode(ap)
+	}
+}
+
 func (b *bus) contractTaxHandlerGET(jc jape.Context) {
 	var payout types.Currency
 	if jc.DecodeParam("payout", (*api.ParamCurrency)(&payout)) != nil {
@@ -1770,18 +2664,25 @@ func (b *bus) webhookHandlerPost(jc jape.Context) {
 		return
 	}
 	err := b.hooks.Register(webhooks.Webhook{
-		Event:  req.Event,
-		Module: req.Module,
-		URL:    req.URL,
+		Event:       req.Event,
+		Module:      req.Module,
+		URL:         req.URL,
+		Secret:      req.Secret,
+		MinSeverity: req.MinSeverity,
+		Bucket:      req.Bucket,
+		Prefix:      req.Prefix,
 	})
-	if err != nil {
+	if errors.Is(err, webhooks.ErrInvalidPattern) || errors.Is(err, webhooks.ErrInvalidMinSeverity) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if err != nil {
 		jc.Error(fmt.Errorf("failed to add Webhook: %w", err), http.StatusInternalServerError)
 		return
 	}
 }
 
 // New returns a new Bus.
-func New(s Syncer, am *alerts.Manager, hm *webhooks.Manager, cm ChainManager, tp TransactionPool, w Wallet, hdb HostDB, as AutopilotStore, ms MetadataStore, ss SettingStore, eas EphemeralAccountStore, l *zap.Logger) (*bus, error) {
+func New(s Syncer, am *alerts.Manager, hm *webhooks.Manager, cm ChainManager, tp TransactionPool, w Wallet, hdb HostDB, as AutopilotStore, ms MetadataStore, ss SettingStore, eas EphemeralAccountStore, dbs DatabaseStore, is IdempotencyStore, dbOptimizeInterval, scratchGCInterval time.Duration, l *zap.Logger) (*bus, error) {
 	b := &bus{
 		alerts:           alerts.WithOrigin(am, "bus"),
 		alertMgr:         am,
@@ -1795,12 +2696,19 @@ func New(s Syncer, am *alerts.Manager, hm *webhooks.Manager, cm ChainManager, tp
 		ms:               ms,
 		ss:               ss,
 		eas:              eas,
+		consensus:        newConsensusNotifier(cm, hm, l.Sugar().Named("consensus")),
 		contractLocks:    newContractLocks(),
+		deletions:        newObjectDeletions(),
+		idempotency:      newIdempotencyCache(is, idempotencyKeyExpiry, idempotencyMaxResponses, l.Sugar().Named("idempotency")),
+		maintenance:      newDatabaseMaintenance(dbs, dbOptimizeInterval, l.Sugar().Named("maintenance")),
+		rebroadcaster:    newRebroadcaster(s, tp, w, cm, l.Sugar().Named("rebroadcaster")),
+		slabPruner:       newSlabPruner(ms, l.Sugar().Named("slabpruner")),
 		uploadingSectors: newUploadingSectorsCache(),
 		logger:           l.Sugar().Named("bus"),
 
 		startTime: time.Now(),
 	}
+	b.scratchGC = newScratchGC(ms, scratchGCInterval, b.objectExpired, l.Sugar().Named("scratchgc"))
 	ctx, span := tracing.Tracer.Start(context.Background(), "bus.New")
 	defer span.End()
 
@@ -1869,6 +2777,13 @@ func New(s Syncer, am *alerts.Manager, hm *webhooks.Manager, cm ChainManager, tp
 		}
 	}
 
+	// Load the settings version.
+	sv, err := newSettingsVersion(ctx, ss)
+	if err != nil {
+		return nil, err
+	}
+	b.settingsVersion = sv
+
 	// Load the accounts into memory. They're saved when the bus is stopped.
 	accounts, err := eas.Accounts(ctx)
 	if err != nil {
@@ -1888,6 +2803,9 @@ func (b *bus) multipartHandlerCreatePOST(jc jape.Context) {
 	var req api.MultipartCreateRequest
 	if jc.Decode(&req) != nil {
 		return
+	} else if err := req.Metadata.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
 	}
 
 	key := req.Key
@@ -1895,7 +2813,7 @@ func (b *bus) multipartHandlerCreatePOST(jc jape.Context) {
 		key = object.NoOpKey
 	}
 
-	resp, err := b.ms.CreateMultipartUpload(jc.Request.Context(), req.Bucket, req.Path, key, req.MimeType)
+	resp, err := b.ms.CreateMultipartUpload(jc.Request.Context(), req.Bucket, req.Path, key, req.MimeType, req.Metadata)
 	if jc.Check("failed to create multipart upload", err) != nil {
 		return
 	}
@@ -1911,6 +2829,7 @@ func (b *bus) multipartHandlerAbortPOST(jc jape.Context) {
 	if jc.Check("failed to abort multipart upload", err) != nil {
 		return
 	}
+	b.slabPruner.Trigger()
 }
 
 func (b *bus) multipartHandlerCompletePOST(jc jape.Context) {
@@ -1918,10 +2837,14 @@ func (b *bus) multipartHandlerCompletePOST(jc jape.Context) {
 	if jc.Decode(&req) != nil {
 		return
 	}
-	resp, err := b.ms.CompleteMultipartUpload(jc.Request.Context(), req.Bucket, req.Path, req.UploadID, req.Parts)
-	if jc.Check("failed to complete multipart upload", err) != nil {
+	resp, overwritten, err := b.ms.CompleteMultipartUpload(jc.Request.Context(), req.Bucket, req.Path, req.UploadID, req.Parts)
+	if errors.Is(err, api.ErrObjectTooLarge) || errors.Is(err, api.ErrBucketQuotaExceeded) {
+		jc.Error(err, http.StatusRequestEntityTooLarge)
+		return
+	} else if jc.Check("failed to complete multipart upload", err) != nil {
 		return
 	}
+	b.broadcastObjectAddedEvent(jc.Request.Context(), overwritten, req.Bucket, req.Path, 0)
 	jc.Encode(resp)
 }
 
@@ -1964,7 +2887,7 @@ func (b *bus) multipartHandlerListUploadsPOST(jc jape.Context) {
 	if jc.Decode(&req) != nil {
 		return
 	}
-	resp, err := b.ms.MultipartUploads(jc.Request.Context(), req.Bucket, req.Prefix, req.PathMarker, req.UploadIDMarker, req.Limit)
+	resp, err := b.ms.MultipartUploads(jc.Request.Context(), req.Bucket, req.Prefix, req.Delimiter, req.PathMarker, req.UploadIDMarker, req.Limit)
 	if jc.Check("failed to list multipart uploads", err) != nil {
 		return
 	}
@@ -1985,7 +2908,7 @@ func (b *bus) multipartHandlerListPartsPOST(jc jape.Context) {
 
 // Handler returns an HTTP handler that serves the bus API.
 func (b *bus) Handler() http.Handler {
-	return jape.Mux(tracing.TracedRoutes("bus", map[string]jape.Handler{
+	return api.WithErrorEnvelope(b.idempotency.Handler(jape.Mux(tracing.TracedRoutes("bus", map[string]jape.Handler{
 		"GET    /alerts":                    b.handleGETAlerts,
 		"POST   /alerts/dismiss":            b.handlePOSTAlertsDismiss,
 		"POST   /alerts/register":           b.handlePOSTAlertsRegister,
@@ -2002,12 +2925,21 @@ func (b *bus) Handler() http.Handler {
 		"GET    /autopilots/:id": b.autopilotsHandlerGET,
 		"PUT    /autopilots/:id": b.autopilotsHandlerPUT,
 
+		"GET    /autopilots/:id/profiles":                b.autopilotProfilesHandlerGET,
+		"GET    /autopilots/:id/profiles/:name":          b.autopilotProfileHandlerGET,
+		"PUT    /autopilots/:id/profiles/:name":          b.autopilotProfileHandlerPUT,
+		"DELETE /autopilots/:id/profiles/:name":          b.autopilotProfileHandlerDELETE,
+		"POST   /autopilots/:id/profiles/:name/activate": b.autopilotProfileActivateHandlerPOST,
+
 		"GET    /syncer/address": b.syncerAddrHandler,
 		"GET    /syncer/peers":   b.syncerPeersHandler,
 		"POST   /syncer/connect": b.syncerConnectHandler,
 
-		"POST   /consensus/acceptblock":        b.consensusAcceptBlock,
-		"GET    /consensus/state":              b.consensusStateHandler,
+		"POST   /consensus/acceptblock": b.consensusAcceptBlock,
+		"GET    /consensus/state":       b.consensusStateHandler,
+		"GET    /consensus/events":      b.consensusEventsHandler,
+
+		"GET    /events":                       b.eventsHandlerGET,
 		"GET    /consensus/network":            b.consensusNetworkHandler,
 		"GET    /consensus/siafundfee/:payout": b.contractTaxHandlerGET,
 
@@ -2015,61 +2947,86 @@ func (b *bus) Handler() http.Handler {
 		"GET    /txpool/transactions":   b.txpoolTransactionsHandler,
 		"POST   /txpool/broadcast":      b.txpoolBroadcastHandler,
 
-		"GET    /wallet":               b.walletHandler,
-		"GET    /wallet/transactions":  b.walletTransactionsHandler,
-		"GET    /wallet/outputs":       b.walletOutputsHandler,
-		"POST   /wallet/fund":          b.walletFundHandler,
-		"POST   /wallet/sign":          b.walletSignHandler,
-		"POST   /wallet/redistribute":  b.walletRedistributeHandler,
-		"POST   /wallet/discard":       b.walletDiscardHandler,
-		"POST   /wallet/prepare/form":  b.walletPrepareFormHandler,
-		"POST   /wallet/prepare/renew": b.walletPrepareRenewHandler,
-		"GET    /wallet/pending":       b.walletPendingHandler,
-
-		"GET    /hosts":             b.hostsHandlerGET,
-		"GET    /host/:hostkey":     b.hostsPubkeyHandlerGET,
-		"POST   /hosts/scans":       b.hostsScanHandlerPOST,
-		"POST   /hosts/pricetables": b.hostsPricetableHandlerPOST,
-		"POST   /hosts/remove":      b.hostsRemoveHandlerPOST,
-		"GET    /hosts/allowlist":   b.hostsAllowlistHandlerGET,
-		"PUT    /hosts/allowlist":   b.hostsAllowlistHandlerPUT,
-		"GET    /hosts/blocklist":   b.hostsBlocklistHandlerGET,
-		"PUT    /hosts/blocklist":   b.hostsBlocklistHandlerPUT,
-		"GET    /hosts/scanning":    b.hostsScanningHandlerGET,
-
-		"GET    /contracts":              b.contractsHandlerGET,
-		"DELETE /contracts/all":          b.contractsAllHandlerDELETE,
-		"POST   /contracts/archive":      b.contractsArchiveHandlerPOST,
-		"GET    /contracts/prunable":     b.contractsPrunableDataHandlerGET,
-		"GET    /contracts/renewed/:id":  b.contractsRenewedIDHandlerGET,
-		"GET    /contracts/sets":         b.contractsSetsHandlerGET,
-		"GET    /contracts/set/:set":     b.contractsSetHandlerGET,
-		"PUT    /contracts/set/:set":     b.contractsSetHandlerPUT,
-		"DELETE /contracts/set/:set":     b.contractsSetHandlerDELETE,
-		"POST   /contracts/spending":     b.contractsSpendingHandlerPOST,
-		"GET    /contract/:id":           b.contractIDHandlerGET,
-		"POST   /contract/:id":           b.contractIDHandlerPOST,
-		"GET    /contract/:id/ancestors": b.contractIDAncestorsHandler,
-		"POST   /contract/:id/renewed":   b.contractIDRenewedHandlerPOST,
-		"POST   /contract/:id/acquire":   b.contractAcquireHandlerPOST,
-		"POST   /contract/:id/keepalive": b.contractKeepaliveHandlerPOST,
-		"POST   /contract/:id/release":   b.contractReleaseHandlerPOST,
-		"GET    /contract/:id/roots":     b.contractIDRootsHandlerGET,
-		"GET    /contract/:id/size":      b.contractSizeHandlerGET,
-		"DELETE /contract/:id":           b.contractIDHandlerDELETE,
+		"GET    /wallet":                 b.walletHandler,
+		"GET    /wallet/address":         b.walletAddressHandler,
+		"GET    /wallet/balance":         b.walletBalanceHandler,
+		"GET    /wallet/changeaddresses": b.walletChangeAddressesHandler,
+		"GET    /wallet/transactions":    b.walletTransactionsHandler,
+		"GET    /wallet/outputs":         b.walletOutputsHandler,
+		"POST   /wallet/fund":            b.walletFundHandler,
+		"POST   /wallet/sign":            b.walletSignHandler,
+		"POST   /wallet/redistribute":    b.walletRedistributeHandler,
+		"POST   /wallet/consolidate":     b.walletConsolidateHandler,
+		"POST   /wallet/send":            b.walletSendHandler,
+		"POST   /wallet/discard":         b.walletDiscardHandler,
+		"POST   /wallet/prepare/form":    b.walletPrepareFormHandler,
+		"POST   /wallet/prepare/renew":   b.walletPrepareRenewHandler,
+		"GET    /wallet/pending":         b.walletPendingHandler,
+
+		"GET    /hosts":                          b.hostsHandlerGET,
+		"GET    /host/:hostkey":                  b.hostsPubkeyHandlerGET,
+		"PUT    /host/:hostkey/tags":             b.hostsPubkeyTagsHandlerPUT,
+		"PUT    /host/:hostkey/notes":            b.hostsPubkeyNotesHandlerPUT,
+		"GET    /host/:hostkey/objects":          b.hostsPubkeyObjectsHandlerGET,
+		"GET    /host/:hostkey/objects/affected": b.hostsPubkeyAffectedObjectsHandlerGET,
+		"POST   /hosts/scans":                    b.hostsScanHandlerPOST,
+		"POST   /hosts/pricetables":              b.hostsPricetableHandlerPOST,
+		"POST   /hosts/remove":                   b.hostsRemoveHandlerPOST,
+		"GET    /hosts/aliases":                  b.hostsAliasesHandlerGET,
+		"GET    /hosts/allowlist":                b.hostsAllowlistHandlerGET,
+		"PUT    /hosts/allowlist":                b.hostsAllowlistHandlerPUT,
+		"GET    /hosts/blocklist":                b.hostsBlocklistHandlerGET,
+		"PUT    /hosts/blocklist":                b.hostsBlocklistHandlerPUT,
+		"GET    /hosts/scanning":                 b.hostsScanningHandlerGET,
+
+		"GET    /contracts":                     b.contractsHandlerGET,
+		"DELETE /contracts/all":                 b.contractsAllHandlerDELETE,
+		"POST   /contracts/archive":             b.contractsArchiveHandlerPOST,
+		"GET    /contracts/prunable":            b.contractsPrunableDataHandlerGET,
+		"GET    /contracts/renewed/:id":         b.contractsRenewedIDHandlerGET,
+		"GET    /contracts/sets":                b.contractsSetsHandlerGET,
+		"GET    /contracts/set/:set":            b.contractsSetHandlerGET,
+		"PUT    /contracts/set/:set":            b.contractsSetHandlerPUT,
+		"DELETE /contracts/set/:set":            b.contractsSetHandlerDELETE,
+		"POST   /contracts/spending":            b.contractsSpendingHandlerPOST,
+		"GET    /contract/:id":                  b.contractIDHandlerGET,
+		"POST   /contract/:id":                  b.contractIDHandlerPOST,
+		"GET    /contract/:id/ancestors":        b.contractIDAncestorsHandler,
+		"POST   /contract/:id/renewed":          b.contractIDRenewedHandlerPOST,
+		"POST   /contract/:id/acquire":          b.contractAcquireHandlerPOST,
+		"POST   /contract/:id/keepalive":        b.contractKeepaliveHandlerPOST,
+		"POST   /contract/:id/release":          b.contractReleaseHandlerPOST,
+		"GET    /contract/:id/roots":            b.contractIDRootsHandlerGET,
+		"GET    /contract/:id/size":             b.contractSizeHandlerGET,
+		"GET    /contract/:id/slabs":            b.contractIDSlabsHandlerGET,
+		"GET    /contract/:id/objects/affected": b.contractIDAffectedObjectsHandlerGET,
+		"DELETE /contract/:id":                  b.contractIDHandlerDELETE,
+
+		"GET    /metrics/contracts/:id/spending": b.metricsContractsSpendingHandlerGET,
+		"GET    /metrics/hosts":                  b.metricsHostsHandlerGET,
+		"POST   /metrics/hosts":                  b.metricsHostsHandlerPOST,
+		"GET    /metrics/uploads":                b.metricsUploadsHandlerGET,
+		"POST   /metrics/uploads":                b.metricsUploadsHandlerPOST,
 
 		"GET    /buckets":              b.bucketsHandlerGET,
 		"POST   /buckets":              b.bucketsHandlerPOST,
 		"PUT    /buckets/:name/policy": b.bucketsHandlerPolicyPUT,
 		"DELETE /buckets/:name":        b.bucketHandlerDELETE,
 		"GET    /buckets/:name":        b.bucketHandlerGET,
+		"GET    /buckets/:name/stats":  b.bucketHandlerStatsGET,
+
+		"GET    /objects/*path":   b.objectsHandlerGET,
+		"PUT    /objects/*path":   b.objectsHandlerPUT,
+		"DELETE /objects/*path":   b.objectsHandlerDELETE,
+		"POST   /objects/copy":    b.objectsCopyHandlerPOST,
+		"POST   /objects/rename":  b.objectsRenameHandlerPOST,
+		"POST   /objects/promote": b.objectsPromoteHandlerPOST,
+		"POST   /objects/sample":  b.objectsSampleHandlerPOST,
+		"POST   /objects/list":    b.objectsListHandlerPOST,
 
-		"GET    /objects/*path":  b.objectsHandlerGET,
-		"PUT    /objects/*path":  b.objectsHandlerPUT,
-		"DELETE /objects/*path":  b.objectsHandlerDELETE,
-		"POST   /objects/copy":   b.objectsCopyHandlerPOST,
-		"POST   /objects/rename": b.objectsRenameHandlerPOST,
-		"POST   /objects/list":   b.objectsListHandlerPOST,
+		"GET    /partialobjects/*path": b.partialObjectsHandlerGET,
+		"PUT    /partialobjects/*path": b.partialObjectsHandlerPUT,
+		"DELETE /partialobjects/*path": b.partialObjectsHandlerDELETE,
 
 		"GET    /params/upload":  b.paramsHandlerUploadGET,
 		"GET    /params/gouging": b.paramsHandlerGougingGET,
@@ -2078,8 +3035,11 @@ func (b *bus) Handler() http.Handler {
 		"POST   /slabbuffer/fetch": b.packedSlabsHandlerFetchPOST,
 		"POST   /slabbuffer/done":  b.packedSlabsHandlerDonePOST,
 
-		"DELETE /sectors/:hk/:root": b.sectorsHostRootHandlerDELETE,
+		"DELETE /sectors/:hk/:root":      b.sectorsHostRootHandlerDELETE,
+		"GET    /sectors/deletions":      b.sectorsDeletionsHandlerGET,
+		"POST   /sectors/deletions/done": b.sectorsDeletionsHandlerDonePOST,
 
+		"GET    /slabs/health":        b.slabsHealthHandlerGET,
 		"POST   /slabs/migration":     b.slabsMigrationHandlerPOST,
 		"GET    /slabs/partial/:key":  b.slabsPartialHandlerGET,
 		"POST   /slabs/partial":       b.slabsPartialHandlerPOST,
@@ -2096,8 +3056,17 @@ func (b *bus) Handler() http.Handler {
 		"PUT    /setting/:key": b.settingKeyHandlerPUT,
 		"DELETE /setting/:key": b.settingKeyHandlerDELETE,
 
-		"GET    /state":         b.stateHandlerGET,
-		"GET    /stats/objects": b.objectsStatshandlerGET,
+		"GET    /system/database":          b.databaseHandlerGET,
+		"POST   /system/database/optimize": b.databaseOptimizeHandlerPOST,
+		"POST   /system/keys/export":       b.keysExportHandlerPOST,
+		"POST   /system/keys/import":       b.keysImportHandlerPOST,
+		"GET    /system/maintenance":       b.maintenanceHandlerGET,
+		"PUT    /system/maintenance":       b.maintenanceHandlerPUT,
+		"GET    /system/deletions":         b.deletionsHandlerGET,
+
+		"GET    /state":              b.stateHandlerGET,
+		"GET    /stats/objects":      b.objectsStatshandlerGET,
+		"GET    /stats/slabs/health": b.slabsHealthStatsHandlerGET,
 
 		"POST   /upload/:id":        b.uploadTrackHandlerPOST,
 		"POST   /upload/:id/sector": b.uploadAddSectorHandlerPOST,
@@ -2115,12 +3084,17 @@ func (b *bus) Handler() http.Handler {
 		"POST   /webhooks":        b.webhookHandlerPost,
 		"POST   /webhooks/action": b.webhookActionHandlerPost,
 		"POST   /webhook/delete":  b.webhookHandlerDelete,
-	}))
+	}))))
 }
 
 // Shutdown shuts down the bus.
 func (b *bus) Shutdown(ctx context.Context) error {
+	b.consensus.Close()
 	b.hooks.Close()
+	b.maintenance.Close()
+	b.scratchGC.Close()
+	b.slabPruner.Close()
+	b.rebroadcaster.Close()
 	accounts := b.accounts.ToPersist()
 	err := b.eas.SaveAccounts(ctx, accounts)
 	if err != nil {
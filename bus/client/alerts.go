@@ -2,6 +2,8 @@ package client
 
 import (
 	"context"
+	"fmt"
+	"net/url"
 
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/alerts"
@@ -13,6 +15,30 @@ func (c *Client) Alerts() (alerts []alerts.Alert, err error) {
 	return
 }
 
+// SearchAlerts fetches the alerts matching the given options from the bus,
+// dismissed alerts are only included if requested and a zero limit returns
+// all alerts.
+func (c *Client) SearchAlerts(ctx context.Context, opts alerts.AlertsOpts) (resp []alerts.Alert, err error) {
+	values := url.Values{}
+	if opts.Severity != 0 {
+		values.Set("severity", opts.Severity.String())
+	}
+	if opts.Module != "" {
+		values.Set("module", opts.Module)
+	}
+	if opts.Dismissed {
+		values.Set("dismissed", "true")
+	}
+	if opts.Offset > 0 {
+		values.Set("offset", fmt.Sprint(opts.Offset))
+	}
+	if opts.Limit != 0 {
+		values.Set("limit", fmt.Sprint(opts.Limit))
+	}
+	err = c.c.WithContext(ctx).GET("/alerts?"+values.Encode(), &resp)
+	return
+}
+
 // DismissAlerts dimisses the alerts with the given IDs.
 func (c *Client) DismissAlerts(ctx context.Context, ids ...types.Hash256) error {
 	return c.c.WithContext(ctx).POST("/alerts/dismiss", ids, nil)
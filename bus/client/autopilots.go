@@ -24,3 +24,38 @@ func (c *Client) UpdateAutopilot(ctx context.Context, autopilot api.Autopilot) (
 	err = c.c.WithContext(ctx).PUT(fmt.Sprintf("/autopilots/%s", autopilot.ID), autopilot)
 	return
 }
+
+// ActivateAutopilotProfile atomically replaces the config of the autopilot with
+// the given ID by the config of the profile with the given name. Profiles
+// should be activated through the autopilot, which interrupts ongoing
+// migrations when the contract set changes.
+func (c *Client) ActivateAutopilotProfile(ctx context.Context, id, name string) (autopilot api.Autopilot, err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/autopilots/%s/profiles/%s/activate", id, name), nil, &autopilot)
+	return
+}
+
+// AutopilotProfile returns the config profile with the given name.
+func (c *Client) AutopilotProfile(ctx context.Context, id, name string) (profile api.AutopilotProfile, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/autopilots/%s/profiles/%s", id, name), &profile)
+	return
+}
+
+// AutopilotProfiles returns the config profiles of the autopilot with the
+// given ID.
+func (c *Client) AutopilotProfiles(ctx context.Context, id string) (profiles []api.AutopilotProfile, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/autopilots/%s/profiles", id), &profiles)
+	return
+}
+
+// DeleteAutopilotProfile deletes the config profile with the given name.
+func (c *Client) DeleteAutopilotProfile(ctx context.Context, id, name string) (err error) {
+	err = c.c.WithContext(ctx).DELETE(fmt.Sprintf("/autopilots/%s/profiles/%s", id, name))
+	return
+}
+
+// UpdateAutopilotProfile adds or updates the config profile with the given
+// name.
+func (c *Client) UpdateAutopilotProfile(ctx context.Context, id, name string, cfg api.AutopilotConfig) (err error) {
+	err = c.c.WithContext(ctx).PUT(fmt.Sprintf("/autopilots/%s/profiles/%s", id, name), cfg)
+	return
+}
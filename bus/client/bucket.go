@@ -33,6 +33,12 @@ func (c *Client) Bucket(ctx context.Context, bucketName string) (resp api.Bucket
 	return
 }
 
+// BucketStats returns the number of objects in a bucket and their total size.
+func (c *Client) BucketStats(ctx context.Context, bucketName string) (resp api.BucketStats, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/buckets/%s/stats", bucketName), &resp)
+	return
+}
+
 // ListBuckets lists all available buckets.
 func (c *Client) ListBuckets(ctx context.Context) (buckets []api.Bucket, err error) {
 	err = c.c.WithContext(ctx).GET("/buckets", &buckets)
@@ -3,6 +3,8 @@ package client
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"time"
 
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/api"
@@ -32,6 +34,21 @@ func (c *Client) ConsensusState(ctx context.Context) (resp api.ConsensusState, e
 	return
 }
 
+// ConsensusEvent blocks until the chain tip is no longer the block with the
+// given id or until the timeout expires, in which case the current state is
+// returned. A zero id returns the current state immediately.
+func (c *Client) ConsensusEvent(ctx context.Context, after types.BlockID, timeout time.Duration) (resp api.ConsensusEvent, err error) {
+	values := url.Values{}
+	if after != (types.BlockID{}) {
+		values.Set("after", after.String())
+	}
+	if timeout != 0 {
+		values.Set("timeout", api.DurationMS(timeout).String())
+	}
+	err = c.c.WithContext(ctx).GET("/consensus/events?"+values.Encode(), &resp)
+	return
+}
+
 // FileContractTax asks the bus for the siafund fee that has to be paid for a
 // contract with a given payout.
 func (c *Client) FileContractTax(ctx context.Context, payout types.Currency) (tax types.Currency, err error) {
@@ -2,7 +2,6 @@ package client
 
 import (
 	"encoding/json"
-	"errors"
 	"io"
 	"net/http"
 
@@ -10,6 +9,11 @@ import (
 	"go.sia.tech/renterd/api"
 )
 
+func init() {
+	// request JSON error envelopes so errors can be identified by their code
+	api.RequestErrorEnvelopes()
+}
+
 // A Client provides methods for interacting with a bus.
 type Client struct {
 	c jape.Client
@@ -31,6 +35,7 @@ func (c *Client) State() (state api.BusStateResponse, err error) {
 
 func (c *Client) do(req *http.Request, resp interface{}) error {
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
 	if c.c.Password != "" {
 		req.SetBasicAuth("", c.c.Password)
 	}
@@ -41,8 +46,7 @@ func (c *Client) do(req *http.Request, resp interface{}) error {
 	defer io.Copy(io.Discard, r.Body)
 	defer r.Body.Close()
 	if !(200 <= r.StatusCode && r.StatusCode < 300) {
-		err, _ := io.ReadAll(r.Body)
-		return errors.New(string(err))
+		return api.ReadError(r)
 	}
 	if resp == nil {
 		return nil
@@ -75,6 +75,25 @@ func (c *Client) ContractRoots(ctx context.Context, fcid types.FileContractID) (
 	return resp.Roots, resp.Uploading, nil
 }
 
+// ContractSlabs returns up to 'limit' slabs that have at least one sector
+// stored on the contract with given id, a negative limit returns all slabs.
+func (c *Client) ContractSlabs(ctx context.Context, fcid types.FileContractID, limit int) (slabs []api.ContractSlab, err error) {
+	values := url.Values{}
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/contract/%s/slabs?"+values.Encode(), fcid), &slabs)
+	return
+}
+
+// ContractAffectedObjects returns the objects that have at least one sector
+// stored on the contract with given id, flagging the ones that are at risk of
+// losing redundancy if the contract is lost.
+func (c *Client) ContractAffectedObjects(ctx context.Context, fcid types.FileContractID, opts api.AffectedObjectsOptions) (objects []api.AffectedObject, err error) {
+	values := url.Values{}
+	opts.Apply(values)
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/contract/%s/objects/affected?"+values.Encode(), fcid), &objects)
+	return
+}
+
 // ContractSets returns the contract sets of the bus.
 func (c *Client) ContractSets(ctx context.Context) (sets []string, err error) {
 	err = c.c.WithContext(ctx).GET("/contracts/sets", &sets)
@@ -174,3 +193,12 @@ func (c *Client) SetContractSet(ctx context.Context, set string, contracts []typ
 	err = c.c.WithContext(ctx).PUT(fmt.Sprintf("/contracts/set/%s", set), contracts)
 	return
 }
+
+// ContractSpendingMetrics returns the hourly spending of the contract with the
+// given id.
+func (c *Client) ContractSpendingMetrics(ctx context.Context, fcid types.FileContractID, opts api.ContractSpendingMetricsOptions) (metrics []api.ContractSpendingMetric, err error) {
+	values := url.Values{}
+	opts.Apply(values)
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/metrics/contracts/%s/spending?%s", fcid, values.Encode()), &metrics)
+	return
+}
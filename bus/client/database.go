@@ -0,0 +1,19 @@
+package client
+
+import (
+	"context"
+
+	"go.sia.tech/renterd/api"
+)
+
+// DatabaseMaintenanceStatus returns the status of the current or most recent
+// database maintenance run.
+func (c *Client) DatabaseMaintenanceStatus(ctx context.Context) (status api.DatabaseMaintenanceStatus, err error) {
+	err = c.c.WithContext(ctx).GET("/system/database", &status)
+	return
+}
+
+// OptimizeDatabase starts optimizing the database in the background.
+func (c *Client) OptimizeDatabase(ctx context.Context) error {
+	return c.c.WithContext(ctx).POST("/system/database/optimize", nil, nil)
+}
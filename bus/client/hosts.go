@@ -1,8 +1,11 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"time"
 
@@ -23,12 +26,38 @@ func (c *Client) HostAllowlist(ctx context.Context) (allowlist []types.PublicKey
 	return
 }
 
+// HostAliases returns the groups of hosts that are likely the same physical
+// host announced under different keys.
+func (c *Client) HostAliases(ctx context.Context) (aliases []api.HostAliasGroup, err error) {
+	err = c.c.WithContext(ctx).GET("/hosts/aliases", &aliases)
+	return
+}
+
 // HostBlocklist returns a host blocklist.
 func (c *Client) HostBlocklist(ctx context.Context) (blocklist []string, err error) {
 	err = c.c.WithContext(ctx).GET("/hosts/blocklist", &blocklist)
 	return
 }
 
+// HostObjects returns up to 'limit' objects that have at least one sector
+// stored on the host with the given key.
+func (c *Client) HostObjects(ctx context.Context, hostKey types.PublicKey, limit int) (objects []api.HostObject, err error) {
+	values := url.Values{}
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/host/%s/objects?"+values.Encode(), hostKey), &objects)
+	return
+}
+
+// HostAffectedObjects returns the objects that have at least one sector stored
+// on the host with the given key, flagging the ones that are at risk of losing
+// redundancy if the host goes offline.
+func (c *Client) HostAffectedObjects(ctx context.Context, hostKey types.PublicKey, opts api.AffectedObjectsOptions) (objects []api.AffectedObject, err error) {
+	values := url.Values{}
+	opts.Apply(values)
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/host/%s/objects/affected?"+values.Encode(), hostKey), &objects)
+	return
+}
+
 // Hosts returns 'limit' hosts at given 'offset'.
 func (c *Client) Hosts(ctx context.Context, opts api.GetHostsOptions) (hosts []hostdb.Host, err error) {
 	values := url.Values{}
@@ -89,8 +118,50 @@ func (c *Client) UpdateHostAllowlist(ctx context.Context, add, remove []types.Pu
 	return
 }
 
+// HostAllowlistUpdateImpact returns the number of hosts and active contracts
+// that would be affected by updating the host allowlist, without updating it.
+func (c *Client) HostAllowlistUpdateImpact(ctx context.Context, add, remove []types.PublicKey, clear bool) (impact api.HostListUpdateImpact, err error) {
+	err = c.dryRunPUT(ctx, "/hosts/allowlist", api.UpdateAllowlistRequest{Add: add, Remove: remove, Clear: clear, DryRun: true}, &impact)
+	return
+}
+
+// UpdateHostTags updates the tags of the given host, adding and removing the
+// given tags.
+func (c *Client) UpdateHostTags(ctx context.Context, hostKey types.PublicKey, add, remove []string, clear bool) (err error) {
+	err = c.c.WithContext(ctx).PUT(fmt.Sprintf("/host/%s/tags", hostKey), api.UpdateHostTagsRequest{Add: add, Remove: remove, Clear: clear})
+	return
+}
+
+// UpdateHostNotes updates the notes and score modifier of the given host.
+func (c *Client) UpdateHostNotes(ctx context.Context, hostKey types.PublicKey, notes string, scoreModifier float64) (err error) {
+	err = c.c.WithContext(ctx).PUT(fmt.Sprintf("/host/%s/notes", hostKey), api.UpdateHostNotesRequest{Notes: notes, ScoreModifier: scoreModifier})
+	return
+}
+
 // UpdateHostBlocklist updates the host blocklist, adding and removing the given entries.
 func (c *Client) UpdateHostBlocklist(ctx context.Context, add, remove []string, clear bool) (err error) {
 	err = c.c.WithContext(ctx).PUT("/hosts/blocklist", api.UpdateBlocklistRequest{Add: add, Remove: remove, Clear: clear})
 	return
 }
+
+// HostBlocklistUpdateImpact returns the number of hosts and active contracts
+// that would be affected by updating the host blocklist, without updating it.
+func (c *Client) HostBlocklistUpdateImpact(ctx context.Context, add, remove []string, clear bool) (impact api.HostListUpdateImpact, err error) {
+	err = c.dryRunPUT(ctx, "/hosts/blocklist", api.UpdateBlocklistRequest{Add: add, Remove: remove, Clear: clear, DryRun: true}, &impact)
+	return
+}
+
+// dryRunPUT performs a PUT request and decodes the response, which the jape
+// client doesn't support.
+func (c *Client) dryRunPUT(ctx context.Context, route string, body, resp interface{}) error {
+	c.c.Custom("PUT", route, body, resp)
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%v%v", c.c.BaseURL, route), bytes.NewReader(data))
+	if err != nil {
+		panic(err)
+	}
+	return c.do(req, resp)
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.sia.tech/renterd/api"
+)
+
+// ExportKeys writes a bundle containing the encryption keys of all objects,
+// encrypted under the given passphrase, to w.
+func (c *Client) ExportKeys(ctx context.Context, passphrase string, w io.Writer) error {
+	c.c.Custom("POST", "/system/keys/export", api.KeyEscrowExportRequest{}, nil)
+
+	data, err := json.Marshal(api.KeyEscrowExportRequest{Passphrase: passphrase})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%v/system/keys/export", c.c.BaseURL), bytes.NewReader(data))
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer io.Copy(io.Discard, resp.Body)
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return api.ReadError(resp)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// ImportKeys restores the encryption keys of the objects in the given bundle,
+// objects that no longer exist are recreated in the given contract set.
+func (c *Client) ImportKeys(ctx context.Context, passphrase string, bundle []byte, contractSet string) (resp api.KeyEscrowImportResponse, err error) {
+	err = c.c.WithContext(ctx).POST("/system/keys/import", api.KeyEscrowImportRequest{Passphrase: passphrase, Bundle: bundle, ContractSet: contractSet}, &resp)
+	return
+}
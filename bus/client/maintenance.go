@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"go.sia.tech/renterd/api"
+)
+
+// Maintenance returns the maintenance mode settings and whether the
+// maintenance mode is currently active.
+func (c *Client) Maintenance(ctx context.Context) (resp api.MaintenanceResponse, err error) {
+	err = c.c.WithContext(ctx).GET("/system/maintenance", &resp)
+	return
+}
+
+// EnableMaintenance enables the maintenance mode, uploads and migrations are
+// paused until it's disabled or the given duration elapsed. A zero duration
+// enables it until it's disabled.
+func (c *Client) EnableMaintenance(ctx context.Context, duration time.Duration, reason string) error {
+	return c.c.WithContext(ctx).PUT("/system/maintenance", api.MaintenanceRequest{
+		Enabled:  true,
+		Duration: api.DurationMS(duration),
+		Reason:   reason,
+	})
+}
+
+// DisableMaintenance disables the maintenance mode.
+func (c *Client) DisableMaintenance(ctx context.Context) error {
+	return c.c.WithContext(ctx).PUT("/system/maintenance", api.MaintenanceRequest{})
+}
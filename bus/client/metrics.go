@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"net/url"
+
+	"go.sia.tech/renterd/api"
+)
+
+// RecordUploadStatsMetric stores a snapshot of the upload stats of a worker.
+func (c *Client) RecordUploadStatsMetric(ctx context.Context, metric api.UploadStatsMetric) (err error) {
+	err = c.c.WithContext(ctx).POST("/metrics/uploads", metric, nil)
+	return
+}
+
+// UploadStatsMetrics returns the snapshots of the upload stats of the workers.
+func (c *Client) UploadStatsMetrics(ctx context.Context, opts api.UploadStatsMetricsOptions) (metrics []api.UploadStatsMetric, err error) {
+	values := url.Values{}
+	opts.Apply(values)
+	err = c.c.WithContext(ctx).GET("/metrics/uploads?"+values.Encode(), &metrics)
+	return
+}
+
+// RecordHostMetrics stores snapshots of the performance of hosts as observed by
+// a worker.
+func (c *Client) RecordHostMetrics(ctx context.Context, metrics []api.HostMetric) (err error) {
+	err = c.c.WithContext(ctx).POST("/metrics/hosts", metrics, nil)
+	return
+}
+
+// HostMetrics returns the snapshots of the performance of hosts.
+func (c *Client) HostMetrics(ctx context.Context, opts api.HostMetricsOptions) (metrics []api.HostMetric, err error) {
+	values := url.Values{}
+	opts.Apply(values)
+	err = c.c.WithContext(ctx).GET("/metrics/hosts?"+values.Encode(), &metrics)
+	return
+}
@@ -53,6 +53,7 @@ func (c *Client) CreateMultipartUpload(ctx context.Context, bucket, path string,
 		Path:     path,
 		Key:      opts.Key,
 		MimeType: opts.MimeType,
+		Metadata: opts.Metadata,
 	}, &resp)
 	return
 }
@@ -64,10 +65,11 @@ func (c *Client) MultipartUpload(ctx context.Context, uploadID string) (resp api
 }
 
 // MultipartUploads returns information about all multipart uploads.
-func (c *Client) MultipartUploads(ctx context.Context, bucket, prefix, keyMarker, uploadIDMarker string, maxUploads int) (resp api.MultipartListUploadsResponse, err error) {
+func (c *Client) MultipartUploads(ctx context.Context, bucket, prefix, delimiter, keyMarker, uploadIDMarker string, maxUploads int) (resp api.MultipartListUploadsResponse, err error) {
 	err = c.c.WithContext(ctx).POST("/multipart/listuploads", api.MultipartListUploadsRequest{
 		Bucket:         bucket,
 		Prefix:         prefix,
+		Delimiter:      delimiter,
 		PathMarker:     keyMarker,
 		UploadIDMarker: uploadIDMarker,
 		Limit:          maxUploads,
@@ -20,6 +20,7 @@ func (c *Client) AddObject(ctx context.Context, bucket, path, contractSet string
 		UsedContracts: usedContracts,
 		MimeType:      opts.MimeType,
 		ETag:          opts.ETag,
+		Metadata:      opts.Metadata,
 	})
 	return
 }
@@ -50,13 +51,22 @@ func (c *Client) DeleteObject(ctx context.Context, bucket, path string, opts api
 	return
 }
 
+// ObjectDeletions returns the progress of the ongoing batch deletions.
+func (c *Client) ObjectDeletions(ctx context.Context) (deletions []api.ObjectsDeletion, err error) {
+	err = c.c.WithContext(ctx).GET("/system/deletions", &deletions)
+	return
+}
+
 // ListOBjects lists objects in the given bucket.
 func (c *Client) ListObjects(ctx context.Context, bucket string, opts api.ListObjectOptions) (resp api.ObjectsListResponse, err error) {
 	err = c.c.WithContext(ctx).POST("/objects/list", api.ObjectsListRequest{
-		Bucket: bucket,
-		Limit:  opts.Limit,
-		Prefix: opts.Prefix,
-		Marker: opts.Marker,
+		Bucket:    bucket,
+		Limit:     opts.Limit,
+		SortBy:    opts.SortBy,
+		SortDir:   opts.SortDir,
+		Prefix:    opts.Prefix,
+		Delimiter: opts.Delimiter,
+		Marker:    opts.Marker,
 	}, &resp)
 	return
 }
@@ -88,6 +98,62 @@ func (c *Client) ObjectsStats() (osr api.ObjectsStatsResponse, err error) {
 	return
 }
 
+// SlabHealthHistogram returns the number of slabs per health range, if a
+// contract set is given only slabs in that set are considered.
+func (c *Client) SlabHealthHistogram(ctx context.Context, set string) (h api.SlabHealthHistogram, err error) {
+	values := url.Values{}
+	values.Set("contractset", set)
+	err = c.c.WithContext(ctx).GET("/stats/slabs/health?"+values.Encode(), &h)
+	return
+}
+
+// PartialObject returns the checkpoint of an unfinished upload to the given
+// path.
+func (c *Client) PartialObject(ctx context.Context, bucket, path string) (po api.PartialObject, err error) {
+	values := url.Values{}
+	values.Set("bucket", bucket)
+
+	path = api.ObjectPathEscape(path)
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/partialobjects/%s?"+values.Encode(), path), &po)
+	return
+}
+
+// AddPartialObjectSlabs checkpoints the progress of an unfinished upload to
+// the given path, the partial object only contains the slabs that were
+// uploaded since the last checkpoint, offset is the index of the first one.
+func (c *Client) AddPartialObjectSlabs(ctx context.Context, bucket, path string, offset int, po api.PartialObject) (err error) {
+	path = api.ObjectPathEscape(path)
+	err = c.c.WithContext(ctx).PUT(fmt.Sprintf("/partialobjects/%s", path), api.PartialObjectAddRequest{
+		Bucket:        bucket,
+		Offset:        offset,
+		PartialObject: po,
+	})
+	return
+}
+
+// DeletePartialObject deletes the checkpoint of an unfinished upload to the
+// given path.
+func (c *Client) DeletePartialObject(ctx context.Context, bucket, path string) (err error) {
+	values := url.Values{}
+	values.Set("bucket", bucket)
+
+	path = api.ObjectPathEscape(path)
+	err = c.c.WithContext(ctx).DELETE(fmt.Sprintf("/partialobjects/%s?"+values.Encode(), path))
+	return
+}
+
+// PromoteObject makes an object in a scratch bucket permanent, optionally
+// moving it to the given destination bucket and path.
+func (c *Client) PromoteObject(ctx context.Context, bucket, path, dstBucket, dstPath string) (err error) {
+	err = c.c.WithContext(ctx).POST("/objects/promote", api.ObjectsPromoteRequest{
+		Bucket:            bucket,
+		Path:              path,
+		DestinationBucket: dstBucket,
+		DestinationPath:   dstPath,
+	}, nil)
+	return
+}
+
 // RenameObject renames a single object.
 func (c *Client) RenameObject(ctx context.Context, bucket, from, to string) (err error) {
 	return c.renameObjects(ctx, bucket, from, to, api.ObjectsRenameModeSingle)
@@ -98,6 +164,12 @@ func (c *Client) RenameObjects(ctx context.Context, bucket, from, to string) (er
 	return c.renameObjects(ctx, bucket, from, to, api.ObjectsRenameModeMulti)
 }
 
+// SampleObjects returns up to limit random objects across all buckets.
+func (c *Client) SampleObjects(ctx context.Context, limit int) (objects []api.ObjectSample, err error) {
+	err = c.c.WithContext(ctx).POST("/objects/sample", api.ObjectsSampleRequest{Limit: limit}, &objects)
+	return
+}
+
 // SearchObjects returns all objects that contains a sub-string in their key.
 func (c *Client) SearchObjects(ctx context.Context, bucket string, opts api.SearchObjectOptions) (entries []api.ObjectMetadata, err error) {
 	values := url.Values{}
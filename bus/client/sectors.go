@@ -5,8 +5,26 @@ import (
 	"fmt"
 
 	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
 )
 
 func (c *Client) DeleteHostSector(ctx context.Context, hk types.PublicKey, root types.Hash256) error {
 	return c.c.WithContext(ctx).DELETE(fmt.Sprintf("/sectors/%s/%s", hk, root))
 }
+
+// SectorDeletions returns up to limit sectors that are queued for deletion,
+// grouped by contract.
+func (c *Client) SectorDeletions(ctx context.Context, limit int) (deletions []api.ContractSectorDeletions, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/sectors/deletions?limit=%d", limit), &deletions)
+	return
+}
+
+// RemoveSectorDeletions removes the given sectors from the deletion queue of
+// the contract with the given id, it's called once they were deleted from the
+// contract.
+func (c *Client) RemoveSectorDeletions(ctx context.Context, fcid types.FileContractID, roots []types.Hash256) error {
+	return c.c.WithContext(ctx).POST("/sectors/deletions/done", api.ContractSectorDeletions{
+		ContractID: fcid,
+		Roots:      roots,
+	}, nil)
+}
@@ -18,6 +18,12 @@ func (c *Client) DeleteSetting(ctx context.Context, key string) error {
 	return c.c.WithContext(ctx).DELETE(fmt.Sprintf("/setting/%s", key))
 }
 
+// DownloadSettings returns the download settings.
+func (c *Client) DownloadSettings(ctx context.Context) (ds api.DownloadSettings, err error) {
+	err = c.Setting(ctx, api.SettingDownloads, &ds)
+	return
+}
+
 // GougingSettings returns the gouging settings.
 func (c *Client) GougingSettings(ctx context.Context) (gs api.GougingSettings, err error) {
 	err = c.Setting(ctx, api.SettingGouging, &gs)
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -34,6 +33,7 @@ func (c *Client) AddPartialSlab(ctx context.Context, data []byte, minShards, tot
 		panic(err)
 	}
 	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	req.Header.Set("Accept", "application/json")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, false, err
@@ -41,8 +41,7 @@ func (c *Client) AddPartialSlab(ctx context.Context, data []byte, minShards, tot
 	defer io.Copy(io.Discard, resp.Body)
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		err, _ := io.ReadAll(resp.Body)
-		return nil, false, errors.New(string(err))
+		return nil, false, api.ReadError(resp)
 	}
 	var apsr api.AddPartialSlabResponse
 	err = json.NewDecoder(resp.Body).Decode(&apsr)
@@ -69,6 +68,7 @@ func (c *Client) FetchPartialSlab(ctx context.Context, key object.EncryptionKey,
 		panic(err)
 	}
 	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	req.Header.Set("Accept", "application/json")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -76,8 +76,7 @@ func (c *Client) FetchPartialSlab(ctx context.Context, key object.EncryptionKey,
 	defer io.Copy(io.Discard, resp.Body)
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 && resp.StatusCode != 206 {
-		err, _ := io.ReadAll(resp.Body)
-		return nil, errors.New(string(err))
+		return nil, api.ReadError(resp)
 	}
 	return io.ReadAll(resp.Body)
 }
@@ -120,6 +119,15 @@ func (c *Client) SlabBuffers() (buffers []api.SlabBuffer, err error) {
 	return
 }
 
+// SlabsHealth returns the health of the slabs with regards to the given
+// contract set, or the default contract set if none is given.
+func (c *Client) SlabsHealth(ctx context.Context, opts api.SlabsHealthOptions) (resp api.SlabsHealthResponse, err error) {
+	values := url.Values{}
+	opts.Apply(values)
+	err = c.c.WithContext(ctx).GET("/slabs/health?"+values.Encode(), &resp)
+	return
+}
+
 // SlabsForMigration returns up to 'limit' slabs which require migration. A slab
 // needs to be migrated if it has sectors on contracts that are not part of the
 // given 'set'.
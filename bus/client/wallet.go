@@ -44,6 +44,26 @@ func (c *Client) Wallet(ctx context.Context) (resp api.WalletResponse, err error
 	return
 }
 
+// WalletAddress returns the address of the wallet.
+func (c *Client) WalletAddress(ctx context.Context) (resp types.Address, err error) {
+	err = c.c.WithContext(ctx).GET("/wallet/address", &resp)
+	return
+}
+
+// WalletBalance returns the spendable, confirmed and unconfirmed balance of
+// the wallet.
+func (c *Client) WalletBalance(ctx context.Context) (resp api.WalletBalanceResponse, err error) {
+	err = c.c.WithContext(ctx).GET("/wallet/balance", &resp)
+	return
+}
+
+// WalletChangeAddresses returns the change addresses the wallet derived to
+// fund contract formations, including the contracts they were linked to.
+func (c *Client) WalletChangeAddresses(ctx context.Context) (resp []wallet.ChangeAddress, err error) {
+	err = c.c.WithContext(ctx).GET("/wallet/changeaddresses", &resp)
+	return
+}
+
 // WalletDiscard discards the provided txn, make its inputs usable again. This
 // should only be called on transactions that will never be broadcast.
 func (c *Client) WalletDiscard(ctx context.Context, txn types.Transaction) error {
@@ -112,6 +132,20 @@ func (c *Client) WalletPrepareRenew(ctx context.Context, revision types.FileCont
 	return resp, err
 }
 
+// WalletConsolidate broadcasts a transaction that consolidates up to maxInputs
+// of the smallest outputs in the wallet into the desired number of outputs. If
+// the transaction was successfully broadcasted it will return the transaction
+// ID.
+func (c *Client) WalletConsolidate(ctx context.Context, outputs, maxInputs int) (id types.TransactionID, err error) {
+	req := api.WalletConsolidateRequest{
+		MaxInputs: maxInputs,
+		Outputs:   outputs,
+	}
+
+	err = c.c.WithContext(ctx).POST("/wallet/consolidate", req, &id)
+	return
+}
+
 // WalletRedistribute broadcasts a transaction that redistributes the money in
 // the wallet in the desired number of outputs of given amount. If the
 // transaction was successfully broadcasted it will return the transaction ID.
@@ -125,6 +159,18 @@ func (c *Client) WalletRedistribute(ctx context.Context, outputs int, amount typ
 	return
 }
 
+// WalletSend sends the given amount of siacoins to the given address and
+// returns the id of the transaction and the fee that was paid. If dryRun is
+// set, only the fee is estimated.
+func (c *Client) WalletSend(ctx context.Context, addr types.Address, amount types.Currency, dryRun bool) (resp api.WalletSendResponse, err error) {
+	err = c.c.WithContext(ctx).POST("/wallet/send", api.WalletSendRequest{
+		Address: addr,
+		Amount:  amount,
+		DryRun:  dryRun,
+	}, &resp)
+	return
+}
+
 // WalletSign signs txn using the wallet's private key.
 func (c *Client) WalletSign(ctx context.Context, txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields) error {
 	req := api.WalletSignRequest{
@@ -22,6 +22,18 @@ func (c *Client) DeleteWebhook(ctx context.Context, url, module, event string) e
 	}, nil)
 }
 
+// DeleteObjectWebhook deletes the object webhook for the given URL with the
+// given bucket and prefix filters.
+func (c *Client) DeleteObjectWebhook(ctx context.Context, url, event, bucket, prefix string) error {
+	return c.c.WithContext(ctx).POST("/webhook/delete", webhooks.Webhook{
+		URL:    url,
+		Module: api.WebhookModuleObjects,
+		Event:  event,
+		Bucket: bucket,
+		Prefix: prefix,
+	}, nil)
+}
+
 // RegisterWebhook registers a new webhook for the given URL.
 func (c *Client) RegisterWebhook(ctx context.Context, url, module, event string) error {
 	err := c.c.WithContext(ctx).POST("/webhooks", webhooks.Webhook{
@@ -32,6 +44,44 @@ func (c *Client) RegisterWebhook(ctx context.Context, url, module, event string)
 	return err
 }
 
+// RegisterSignedWebhook registers a new webhook for the given URL, every
+// delivery is signed with the given secret.
+func (c *Client) RegisterSignedWebhook(ctx context.Context, url, module, event, secret string) error {
+	err := c.c.WithContext(ctx).POST("/webhooks", webhooks.Webhook{
+		Event:  event,
+		Module: module,
+		URL:    url,
+		Secret: secret,
+	}, nil)
+	return err
+}
+
+// RegisterSeverityWebhook registers a new webhook for the given URL that only
+// receives events with at least the given severity, e.g. "critical".
+func (c *Client) RegisterSeverityWebhook(ctx context.Context, url, module, event, minSeverity string) error {
+	err := c.c.WithContext(ctx).POST("/webhooks", webhooks.Webhook{
+		Event:       event,
+		Module:      module,
+		URL:         url,
+		MinSeverity: minSeverity,
+	}, nil)
+	return err
+}
+
+// RegisterObjectWebhook registers a new webhook for the given URL that only
+// receives object events for objects in the given bucket with the given path
+// prefix, an empty bucket or prefix matches all objects.
+func (c *Client) RegisterObjectWebhook(ctx context.Context, url, event, bucket, prefix string) error {
+	err := c.c.WithContext(ctx).POST("/webhooks", webhooks.Webhook{
+		Event:  event,
+		Module: api.WebhookModuleObjects,
+		URL:    url,
+		Bucket: bucket,
+		Prefix: prefix,
+	}, nil)
+	return err
+}
+
 // Webhooks returns all webhooks currently registered.
 func (c *Client) Webhooks(ctx context.Context) (resp api.WebHookResponse, err error) {
 	err = c.c.WithContext(ctx).GET("/webhooks", &resp)
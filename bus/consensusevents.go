@@ -0,0 +1,181 @@
+package bus
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/webhooks"
+	"go.uber.org/zap"
+)
+
+const (
+	// consensusNotifierPollInterval is the interval at which the notifier
+	// checks whether the chain tip changed.
+	consensusNotifierPollInterval = time.Second
+
+	// consensusNotifierHistorySize is the number of chain tips the notifier
+	// remembers to tell whether a subscriber's tip was reverted.
+	consensusNotifierHistorySize = 144
+
+	// defaultConsensusEventsTimeout is the default amount of time a request
+	// to the /consensus/events endpoint waits for the chain tip to change.
+	defaultConsensusEventsTimeout = 30 * time.Second
+
+	// maxConsensusEventsTimeout is the maximum amount of time a request to
+	// the /consensus/events endpoint waits for the chain tip to change.
+	maxConsensusEventsTimeout = 5 * time.Minute
+)
+
+// consensusNotifier keeps track of the chain tip and wakes up the subscribers
+// that are long-polling for the next consensus event whenever it changes.
+type consensusNotifier struct {
+	tipIndex func() types.ChainIndex
+	state    func() api.ConsensusState
+	hooks    webhooks.Broadcaster
+	logger   *zap.SugaredLogger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	synced bool
+
+	mu      sync.Mutex
+	tip     types.ChainIndex
+	history []types.ChainIndex
+	changed chan struct{}
+}
+
+func newConsensusNotifier(cm ChainManager, hooks webhooks.Broadcaster, logger *zap.SugaredLogger) *consensusNotifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &consensusNotifier{
+		tipIndex: func() types.ChainIndex {
+			return cm.TipState(ctx).Index
+		},
+		state: func() api.ConsensusState {
+			return api.ConsensusState{
+				BlockHeight:   cm.TipState(ctx).Index.Height,
+				LastBlockTime: cm.LastBlockTime(),
+				Synced:        cm.Synced(ctx),
+			}
+		},
+		hooks:  hooks,
+		logger: logger,
+
+		ctx:    ctx,
+		cancel: cancel,
+
+		changed: make(chan struct{}),
+	}
+	n.update(n.tipIndex())
+
+	n.wg.Add(1)
+	go n.schedule()
+	return n
+}
+
+// Close stops the notifier and waits for it to finish.
+func (n *consensusNotifier) Close() {
+	n.cancel()
+	n.wg.Wait()
+}
+
+func (n *consensusNotifier) schedule() {
+	defer n.wg.Done()
+
+	t := time.NewTicker(consensusNotifierPollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if tip := n.tipIndex(); n.update(tip) {
+			n.logger.Debugf("chain reorg detected, new tip %v", tip)
+		}
+		n.checkSynced()
+	}
+}
+
+// checkSynced fires a webhook event when the bus finished syncing.
+func (n *consensusNotifier) checkSynced() {
+	state := n.state()
+	if state.Synced && !n.synced {
+		if err := n.hooks.BroadcastAction(n.ctx, webhooks.Event{
+			Module:  api.WebhookModuleConsensus,
+			Event:   api.WebhookEventConsensusSynced,
+			Payload: state,
+		}); err != nil {
+			n.logger.Errorf("failed to broadcast synced event: %v", err)
+		}
+	}
+	n.synced = state.Synced
+}
+
+// update sets the chain tip and notifies the subscribers if it changed, it
+// returns true if the previous tip was reverted. Since the tip is polled a
+// reorg is detected when the tip changes without increasing the height.
+func (n *consensusNotifier) update(tip types.ChainIndex) (reorg bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if tip == n.tip {
+		return false
+	}
+
+	// forget about the tips that were reverted
+	if reorg = len(n.history) > 0 && tip.Height <= n.tip.Height; reorg {
+		for len(n.history) > 0 && n.history[len(n.history)-1].Height >= tip.Height {
+			n.history = n.history[:len(n.history)-1]
+		}
+	}
+	n.history = append(n.history, tip)
+	if len(n.history) > consensusNotifierHistorySize {
+		n.history = n.history[len(n.history)-consensusNotifierHistorySize:]
+	}
+
+	n.tip = tip
+	close(n.changed)
+	n.changed = make(chan struct{})
+	return
+}
+
+// Wait blocks until the chain tip is no longer the block with the given id,
+// a zero id returns the current tip immediately. The returned flag indicates
+// whether the given block is no longer known to be part of the chain, in
+// which case the subscriber has to assume its tip was reverted. If the
+// context is done before the tip changed, the current tip is returned
+// together with the context's error.
+func (n *consensusNotifier) Wait(ctx context.Context, after types.BlockID) (types.ChainIndex, bool, error) {
+	for {
+		n.mu.Lock()
+		tip, changed := n.tip, n.changed
+		if after == (types.BlockID{}) || tip.ID != after {
+			reorg := after != (types.BlockID{}) && !n.isKnown(after)
+			n.mu.Unlock()
+			return tip, reorg, nil
+		}
+		n.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return tip, false, ctx.Err()
+		case <-n.ctx.Done():
+			return tip, false, context.Canceled
+		case <-changed:
+		}
+	}
+}
+
+func (n *consensusNotifier) isKnown(id types.BlockID) bool {
+	for _, index := range n.history {
+		if index.ID == id {
+			return true
+		}
+	}
+	return false
+}
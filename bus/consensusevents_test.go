@@ -0,0 +1,134 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/webhooks"
+	"go.uber.org/zap"
+)
+
+func TestConsensusNotifier(t *testing.T) {
+	n := &consensusNotifier{
+		logger:  zap.NewNop().Sugar(),
+		ctx:     context.Background(),
+		changed: make(chan struct{}),
+	}
+	index := func(height uint64, id byte) types.ChainIndex {
+		return types.ChainIndex{Height: height, ID: types.BlockID{id}}
+	}
+
+	// add a couple of blocks
+	for i := byte(1); i <= 3; i++ {
+		if n.update(index(uint64(i), i)) {
+			t.Fatal("unexpected reorg")
+		}
+	}
+
+	// assert a zero id returns the tip immediately
+	if tip, reorg, err := n.Wait(context.Background(), types.BlockID{}); err != nil {
+		t.Fatal(err)
+	} else if tip != index(3, 3) || reorg {
+		t.Fatal("unexpected tip", tip, reorg)
+	}
+
+	// assert an outdated tip returns the current tip without reorg
+	if tip, reorg, err := n.Wait(context.Background(), index(2, 2).ID); err != nil {
+		t.Fatal(err)
+	} else if tip != index(3, 3) || reorg {
+		t.Fatal("unexpected tip", tip, reorg)
+	}
+
+	// assert waiting on the current tip times out
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if tip, _, err := n.Wait(ctx, index(3, 3).ID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("unexpected error", err)
+	} else if tip != index(3, 3) {
+		t.Fatal("unexpected tip", tip)
+	}
+
+	// assert subscribers are woken up when the tip changes
+	done := make(chan types.ChainIndex)
+	go func() {
+		tip, _, _ := n.Wait(context.Background(), index(3, 3).ID)
+		done <- tip
+	}()
+	time.Sleep(10 * time.Millisecond)
+	n.update(index(4, 4))
+	select {
+	case tip := <-done:
+		if tip != index(4, 4) {
+			t.Fatal("unexpected tip", tip)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscriber wasn't notified")
+	}
+
+	// revert the last two blocks
+	if !n.update(index(3, 5)) {
+		t.Fatal("expected reorg")
+	}
+
+	// assert subscribers with a reverted tip are told about the reorg
+	if _, reorg, err := n.Wait(context.Background(), index(4, 4).ID); err != nil {
+		t.Fatal(err)
+	} else if !reorg {
+		t.Fatal("expected reorg")
+	} else if _, reorg, err := n.Wait(context.Background(), index(3, 3).ID); err != nil {
+		t.Fatal(err)
+	} else if !reorg {
+		t.Fatal("expected reorg")
+	} else if _, reorg, err := n.Wait(context.Background(), index(2, 2).ID); err != nil {
+		t.Fatal(err)
+	} else if reorg {
+		t.Fatal("unexpected reorg")
+	}
+}
+
+type testHooks struct {
+	events []webhooks.Event
+}
+
+func (h *testHooks) BroadcastAction(_ context.Context, event webhooks.Event) error {
+	h.events = append(h.events, event)
+	return nil
+}
+
+func TestConsensusNotifierSynced(t *testing.T) {
+	var synced bool
+	hooks := &testHooks{}
+	n := &consensusNotifier{
+		state:  func() api.ConsensusState { return api.ConsensusState{Synced: synced} },
+		hooks:  hooks,
+		logger: zap.NewNop().Sugar(),
+		ctx:    context.Background(),
+	}
+
+	// assert the synced event is only fired when the bus becomes synced
+	n.checkSynced()
+	if len(hooks.events) != 0 {
+		t.Fatal("unexpected events", hooks.events)
+	}
+	synced = true
+	n.checkSynced()
+	n.checkSynced()
+	if len(hooks.events) != 1 {
+		t.Fatal("unexpected events", hooks.events)
+	} else if hooks.events[0].Module != api.WebhookModuleConsensus || hooks.events[0].Event != api.WebhookEventConsensusSynced {
+		t.Fatal("unexpected event", hooks.events[0])
+	}
+
+	// assert it's fired again after the bus fell out of sync
+	synced = false
+	n.checkSynced()
+	synced = true
+	n.checkSynced()
+	if len(hooks.events) != 2 {
+		t.Fatal("unexpected events", hooks.events)
+	}
+}
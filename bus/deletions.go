@@ -0,0 +1,76 @@
+package bus
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/api"
+)
+
+type (
+	// objectDeletions keeps track of the progress of the ongoing batch
+	// deletions.
+	objectDeletions struct {
+		mu      sync.Mutex
+		nextID  uint64
+		ongoing map[uint64]*objectDeletion
+	}
+
+	objectDeletion struct {
+		id uint64
+		od *objectDeletions
+
+		status api.ObjectsDeletion
+	}
+)
+
+func newObjectDeletions() *objectDeletions {
+	return &objectDeletions{
+		ongoing: make(map[uint64]*objectDeletion),
+	}
+}
+
+// Deletions returns the progress of the ongoing batch deletions, oldest first.
+func (od *objectDeletions) Deletions() []api.ObjectsDeletion {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	deletions := make([]api.ObjectsDeletion, 0, len(od.ongoing))
+	for _, d := range od.ongoing {
+		deletions = append(deletions, d.status)
+	}
+	sort.Slice(deletions, func(i, j int) bool {
+		return deletions[i].StartedAt.Before(deletions[j].StartedAt)
+	})
+	return deletions
+}
+
+func (od *objectDeletions) start(bucket, prefix string) *objectDeletion {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	od.nextID++
+	d := &objectDeletion{
+		id: od.nextID,
+		od: od,
+		status: api.ObjectsDeletion{
+			Bucket:    bucket,
+			Prefix:    prefix,
+			StartedAt: time.Now(),
+		},
+	}
+	od.ongoing[d.id] = d
+	return d
+}
+
+func (od *objectDeletions) finish(d *objectDeletion) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	delete(od.ongoing, d.id)
+}
+
+func (d *objectDeletion) update(deleted, total int64) {
+	d.od.mu.Lock()
+	defer d.od.mu.Unlock()
+	d.status.Deleted = deleted
+	d.status.Total = total
+}
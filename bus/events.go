@@ -0,0 +1,160 @@
+package bus
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.sia.tech/core/types"
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/webhooks"
+)
+
+const (
+	// eventsPingInterval is the interval at which the bus pings subscribers
+	// of the /events endpoint to keep the connection alive.
+	eventsPingInterval = 30 * time.Second
+
+	// eventsWriteTimeout is the amount of time the bus waits for an event to
+	// be written to a subscriber before it drops the connection.
+	eventsWriteTimeout = 10 * time.Second
+)
+
+var eventsUpgrader = websocket.Upgrader{
+	// the bus API is protected by a password so we allow any origin, like
+	// the rest of the API does
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// eventsHandlerGET upgrades the connection to a websocket and streams all
+// events that are broadcast through the webhooks manager to the subscriber,
+// optionally filtered by module and event.
+func (b *bus) eventsHandlerGET(jc jape.Context) {
+	var filter webhooks.Webhook
+	if jc.DecodeForm("module", &filter.Module) != nil || jc.DecodeForm("event", &filter.Event) != nil {
+		return
+	} else if jc.DecodeForm("bucket", &filter.Bucket) != nil || jc.DecodeForm("prefix", &filter.Prefix) != nil {
+		return
+	}
+	filtered := filter != (webhooks.Webhook{})
+	if filtered && filter.Module == "" {
+		filter.Module = "*"
+	}
+
+	// subscribe before upgrading so no events are missed once the
+	// subscriber is connected
+	events, unsubscribe := b.hooks.Subscribe()
+	defer unsubscribe()
+
+	conn, err := eventsUpgrader.Upgrade(jc.ResponseWriter, jc.Request, nil)
+	if err != nil {
+		return // the upgrader already responded with an error
+	}
+	defer conn.Close()
+
+	// read from the connection to process control messages and to notice
+	// when the subscriber goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	t := time.NewTicker(eventsPingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-t.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventsWriteTimeout)); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down"), time.Now().Add(eventsWriteTimeout))
+				return
+			} else if filtered && !filter.Matches(event) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				b.logger.Debugf("failed to write event to subscriber: %v", err)
+				return
+			}
+		}
+	}
+}
+
+func (b *bus) broadcastContractEvent(ctx context.Context, event string, c api.ContractMetadata, reason string) {
+	b.broadcastAction(ctx, webhooks.Event{
+		Module: api.WebhookModuleContracts,
+		Event:  event,
+		Payload: api.ContractEvent{
+			ContractID:  c.ID,
+			HostKey:     c.HostKey,
+			RenewedFrom: c.RenewedFrom,
+			Reason:      reason,
+			Timestamp:   time.Now().UTC(),
+		},
+	})
+}
+
+func (b *bus) broadcastObjectEvent(ctx context.Context, event, bucket, path string, batch bool, size int64) {
+	b.broadcastAction(ctx, webhooks.Event{
+		Module: api.WebhookModuleObjects,
+		Event:  event,
+		Payload: api.ObjectEvent{
+			Bucket:    bucket,
+			Path:      path,
+			Batch:     batch,
+			Size:      size,
+			Timestamp: time.Now().UTC(),
+		},
+	})
+}
+
+// broadcastObjectAddedEvent broadcasts the events that are fired when an object
+// is added at the given path, the uploaded event is still fired for webhooks
+// that were registered before it was split up.
+func (b *bus) broadcastObjectAddedEvent(ctx context.Context, overwritten bool, bucket, path string, size int64) {
+	event := api.WebhookEventObjectCreated
+	if overwritten {
+		event = api.WebhookEventObjectOverwritten
+	}
+	b.broadcastObjectEvent(ctx, event, bucket, path, false, size)
+	b.broadcastObjectEvent(ctx, api.WebhookEventObjectUploaded, bucket, path, false, size)
+}
+
+// objectExpired is called for every expired object that was pruned from a
+// scratch bucket, it fires the same event as deleting the object does.
+func (b *bus) objectExpired(bucket, path string) {
+	b.slabPruner.Trigger()
+	b.broadcastObjectEvent(context.Background(), api.WebhookEventObjectDeleted, bucket, path, false, 0)
+}
+
+func (b *bus) broadcastAction(ctx context.Context, event webhooks.Event) {
+	if err := b.hooks.BroadcastAction(ctx, event); err != nil {
+		b.logger.Errorf("failed to broadcast event %v: %v", event, err)
+	}
+}
+
+// contractsMetadata returns the metadata of the given contracts, contracts
+// that can't be found are returned with only their id set.
+func (b *bus) contractsMetadata(ctx context.Context, ids []types.FileContractID) []api.ContractMetadata {
+	contracts := make([]api.ContractMetadata, len(ids))
+	for i, id := range ids {
+		c, err := b.ms.Contract(ctx, id)
+		if err != nil {
+			c = api.ContractMetadata{ID: id}
+		}
+		contracts[i] = c
+	}
+	return contracts
+}
@@ -0,0 +1,61 @@
+package bus
+
+import (
+	"testing"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/webhooks"
+)
+
+func TestObjectEventFilters(t *testing.T) {
+	event := func(event, bucket, path string, batch bool) webhooks.Event {
+		return webhooks.Event{
+			Module: api.WebhookModuleObjects,
+			Event:  event,
+			Payload: api.ObjectEvent{
+				Bucket: bucket,
+				Path:   path,
+				Batch:  batch,
+			},
+		}
+	}
+
+	hook := webhooks.Webhook{
+		Module: api.WebhookModuleObjects,
+		Event:  api.WebhookEventObjectCreated,
+		Bucket: "foo",
+		Prefix: "/bar/",
+	}
+	tests := []struct {
+		event webhooks.Event
+		match bool
+	}{
+		{event(api.WebhookEventObjectCreated, "foo", "/bar/baz", false), true},
+		{event(api.WebhookEventObjectCreated, "foo", "/bar", false), false},
+		{event(api.WebhookEventObjectCreated, "foo", "/baz/bar", false), false},
+		{event(api.WebhookEventObjectCreated, "baz", "/bar/baz", false), false},
+		{event(api.WebhookEventObjectOverwritten, "foo", "/bar/baz", false), false},
+		{webhooks.Event{Module: api.WebhookModuleObjects, Event: api.WebhookEventObjectCreated}, false},
+	}
+	for i, test := range tests {
+		if hook.Matches(test.event) != test.match {
+			t.Fatalf("%d: expected match to be %v", i, test.match)
+		}
+	}
+
+	// assert batch deletions match if they affect objects with the prefix
+	hook.Event = api.WebhookEventObjectDeleted
+	if !hook.Matches(event(api.WebhookEventObjectDeleted, "foo", "/", true)) {
+		t.Fatal("expected batch deletion of parent to match")
+	} else if !hook.Matches(event(api.WebhookEventObjectDeleted, "foo", "/bar/baz/", true)) {
+		t.Fatal("expected batch deletion of child to match")
+	} else if hook.Matches(event(api.WebhookEventObjectDeleted, "foo", "/baz/", true)) {
+		t.Fatal("expected batch deletion of sibling not to match")
+	}
+
+	// assert hooks without a bucket match all buckets
+	hook.Bucket = ""
+	if !hook.Matches(event(api.WebhookEventObjectDeleted, "baz", "/bar/baz", false)) {
+		t.Fatal("expected match")
+	}
+}
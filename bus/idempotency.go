@@ -0,0 +1,213 @@
+package bus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+const (
+	// idempotencyKeyExpiry is the amount of time for which the response to a
+	// request carrying an idempotency key is kept around to be replayed.
+	idempotencyKeyExpiry = 24 * time.Hour
+
+	// idempotencyKeyMaxLen is the maximum length of an idempotency key.
+	idempotencyKeyMaxLen = 255
+
+	// idempotencyMaxResponses is the maximum number of recorded responses,
+	// the oldest responses are pruned when the limit is exceeded.
+	idempotencyMaxResponses = 100_000
+
+	// idempotencyPruneInterval is the minimum amount of time between two
+	// prunes of the recorded responses, the number of recorded responses can
+	// exceed the limit by the number of requests in that window.
+	idempotencyPruneInterval = time.Minute
+)
+
+type (
+	// An IdempotencyStore persists the responses to requests that carry an
+	// idempotency key so retries remain idempotent across restarts.
+	IdempotencyStore interface {
+		IdempotentResponse(ctx context.Context, key string) (api.IdempotentResponse, error)
+		RecordIdempotentResponse(ctx context.Context, key string, resp api.IdempotentResponse) error
+		PruneIdempotentResponses(ctx context.Context, now time.Time, keep int) (int64, error)
+	}
+
+	// idempotencyCache keeps track of the responses to mutating requests that
+	// carry an idempotency key, allowing clients to safely retry requests
+	// without applying them twice. Responses are recorded in the store, only
+	// the keys of the requests that are being processed are kept in memory.
+	idempotencyCache struct {
+		store        IdempotencyStore
+		expiry       time.Duration
+		maxResponses int
+		logger       *zap.SugaredLogger
+
+		mu        sync.Mutex
+		inflight  map[string]struct{}
+		lastPrune time.Time
+	}
+
+	// recordingWriter is a http.ResponseWriter that records the response
+	// while writing it.
+	recordingWriter struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+	}
+)
+
+func newIdempotencyCache(store IdempotencyStore, expiry time.Duration, maxResponses int, logger *zap.SugaredLogger) *idempotencyCache {
+	return &idempotencyCache{
+		store:        store,
+		expiry:       expiry,
+		maxResponses: maxResponses,
+		logger:       logger,
+
+		inflight: make(map[string]struct{}),
+	}
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Handler wraps the given handler and makes mutating requests that carry an
+// idempotency key idempotent. The first request with a given key is
+// processed as usual and its response is recorded, subsequent requests with
+// the same key get the recorded response. Server errors are not recorded so
+// that the request can be retried.
+func (c *idempotencyCache) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(api.IdempotencyKeyHeader)
+		if key == "" || !isMutatingMethod(req.Method) {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		if len(key) > idempotencyKeyMaxLen {
+			http.Error(w, fmt.Sprintf("idempotency key can't be longer than %d characters", idempotencyKeyMaxLen), http.StatusBadRequest)
+			return
+		}
+
+		// read the body to fingerprint the request
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, "failed to read request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := requestFingerprint(req, body)
+
+		// reject the request if a request with the same key is in flight
+		c.mu.Lock()
+		_, exists := c.inflight[key]
+		if !exists {
+			c.inflight[key] = struct{}{}
+		}
+		c.mu.Unlock()
+		if exists {
+			http.Error(w, api.ErrIdempotencyKeyInUse.Error(), http.StatusConflict)
+			return
+		}
+		defer func() {
+			c.mu.Lock()
+			delete(c.inflight, key)
+			c.mu.Unlock()
+		}()
+
+		// replay the recorded response if we've seen the key before
+		ctx := req.Context()
+		resp, err := c.store.IdempotentResponse(ctx, key)
+		if err != nil && !errors.Is(err, api.ErrIdempotentResponseNotFound) {
+			http.Error(w, "failed to fetch idempotent response: "+err.Error(), http.StatusInternalServerError)
+			return
+		} else if err == nil && time.Now().Before(resp.Expiry) {
+			if resp.Fingerprint != fingerprint {
+				http.Error(w, api.ErrIdempotencyKeyMismatch.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			for k, v := range resp.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set(api.IdempotentReplayedHeader, "true")
+			w.WriteHeader(resp.Status)
+			w.Write(resp.Body)
+			return
+		}
+
+		// process the request and record the response, server errors are not
+		// recorded so the request can be retried
+		rw := &recordingWriter{ResponseWriter: w}
+		h.ServeHTTP(rw, req)
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		if rw.status >= 500 {
+			return
+		}
+		if err := c.store.RecordIdempotentResponse(context.Background(), key, api.IdempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      rw.status,
+			Header:      w.Header().Clone(),
+			Body:        rw.body.Bytes(),
+			Expiry:      time.Now().Add(c.expiry),
+		}); err != nil {
+			c.logger.Errorf("failed to record response for idempotency key %v, err: %v", key, err)
+		}
+		c.tryPrune()
+	})
+}
+
+// tryPrune prunes expired responses and the oldest responses exceeding the
+// limit unless the responses were pruned recently.
+func (c *idempotencyCache) tryPrune() {
+	c.mu.Lock()
+	if time.Since(c.lastPrune) < idempotencyPruneInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.lastPrune = time.Now()
+	c.mu.Unlock()
+
+	if _, err := c.store.PruneIdempotentResponses(context.Background(), time.Now(), c.maxResponses); err != nil {
+		c.logger.Errorf("failed to prune idempotent responses, err: %v", err)
+	}
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func requestFingerprint(req *http.Request, body []byte) types.Hash256 {
+	h := types.NewHasher()
+	h.E.WriteString(req.Method)
+	h.E.WriteString(req.URL.RequestURI())
+	h.E.WriteBytes(body)
+	return h.Sum()
+}
@@ -0,0 +1,154 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+type mockIdempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]api.IdempotentResponse
+}
+
+func newMockIdempotencyStore() *mockIdempotencyStore {
+	return &mockIdempotencyStore{responses: make(map[string]api.IdempotentResponse)}
+}
+
+func (s *mockIdempotencyStore) IdempotentResponse(_ context.Context, key string) (api.IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp, ok := s.responses[key]
+	if !ok {
+		return api.IdempotentResponse{}, api.ErrIdempotentResponseNotFound
+	}
+	return resp, nil
+}
+
+func (s *mockIdempotencyStore) RecordIdempotentResponse(_ context.Context, key string, resp api.IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[key] = resp
+	return nil
+}
+
+func (s *mockIdempotencyStore) PruneIdempotentResponses(_ context.Context, now time.Time, keep int) (pruned int64, _ error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, resp := range s.responses {
+		if resp.Expiry.Before(now) {
+			delete(s.responses, key)
+			pruned++
+		}
+	}
+	return
+}
+
+func TestIdempotencyCache(t *testing.T) {
+	store := newMockIdempotencyStore()
+	c := newIdempotencyCache(store, time.Hour, 10, zap.NewNop().Sugar())
+
+	// create a handler that counts how often it was applied
+	var applied int
+	var fail bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if fail {
+			http.Error(w, "failure", http.StatusInternalServerError)
+			return
+		}
+		applied++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "applied %d", applied)
+	})
+	h := c.Handler(handler)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(api.IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// assert the response is replayed
+	if rec := do(http.MethodPost, "/contracts", "foo", "{}"); rec.Code != http.StatusCreated || rec.Body.String() != "applied 1" {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	} else if rec := do(http.MethodPost, "/contracts", "foo", "{}"); rec.Code != http.StatusCreated || rec.Body.String() != "applied 1" {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	} else if rec.Header().Get(api.IdempotentReplayedHeader) != "true" {
+		t.Fatal("expected replayed header")
+	} else if applied != 1 {
+		t.Fatal("unexpected number of applications", applied)
+	}
+
+	// assert reusing the key for another request fails
+	if rec := do(http.MethodPost, "/contracts", "foo", "{\"foo\":1}"); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	}
+
+	// assert requests without a key and non-mutating requests are not cached
+	if rec := do(http.MethodPost, "/contracts", "", "{}"); rec.Body.String() != "applied 2" {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	} else if rec := do(http.MethodGet, "/contracts", "bar", ""); rec.Body.String() != "applied 3" {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	} else if rec := do(http.MethodGet, "/contracts", "bar", ""); rec.Body.String() != "applied 4" {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	}
+
+	// assert server errors are not recorded
+	fail = true
+	if rec := do(http.MethodDelete, "/objects/foo", "baz", ""); rec.Code != http.StatusInternalServerError {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	}
+	fail = false
+	if rec := do(http.MethodDelete, "/objects/foo", "baz", ""); rec.Code != http.StatusCreated || rec.Body.String() != "applied 5" {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	}
+
+	// assert a key in use is rejected
+	c.inflight["inuse"] = struct{}{}
+	if rec := do(http.MethodPost, "/contracts", "inuse", "{}"); rec.Code != http.StatusConflict {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	}
+	delete(c.inflight, "inuse")
+
+	// assert keys that are too long are rejected
+	if rec := do(http.MethodPost, "/contracts", strings.Repeat("a", idempotencyKeyMaxLen+1), "{}"); rec.Code != http.StatusBadRequest {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	}
+
+	// assert responses are replayed after a restart
+	c = newIdempotencyCache(store, time.Hour, 10, zap.NewNop().Sugar())
+	h = c.Handler(handler)
+	if rec := do(http.MethodPost, "/contracts", "foo", "{}"); rec.Body.String() != "applied 1" {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	}
+
+	// assert expired responses are pruned
+	c.expiry = 0
+	do(http.MethodPost, "/contracts", "qux", "{}")
+	time.Sleep(time.Millisecond)
+	if rec := do(http.MethodPost, "/contracts", "qux", "{}"); rec.Body.String() != "applied 7" {
+		t.Fatal("unexpected response", rec.Code, rec.Body.String())
+	}
+
+	// assert expired responses are pruned from the store
+	c.lastPrune = time.Time{}
+	do(http.MethodPost, "/contracts", "quux", "{}")
+	if _, exists := store.responses["qux"]; exists {
+		t.Fatal("expected expired response to be pruned")
+	} else if _, exists := store.responses["foo"]; !exists {
+		t.Fatal("expected response to be kept")
+	}
+}
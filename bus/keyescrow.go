@@ -0,0 +1,212 @@
+package bus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"filippo.io/age"
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// keyEscrowBatchSize is the number of objects that are fetched from, or
+	// restored to, the database at once.
+	keyEscrowBatchSize = 100
+
+	// keyEscrowMaxScryptLogN is the highest scrypt work factor we accept when
+	// opening a bundle, it prevents a malicious bundle from making us spend an
+	// excessive amount of memory and time deriving the key.
+	keyEscrowMaxScryptLogN = 18
+)
+
+var (
+	// keyEscrowScryptLogN is the scrypt work factor used to derive the key
+	// that encrypts a bundle from the passphrase.
+	keyEscrowScryptLogN = 18
+
+	errInvalidKeyEscrowBundle = errors.New("invalid key escrow bundle")
+	errMissingPassphrase      = errors.New("passphrase is required")
+	errWrongPassphrase        = errors.New("failed to decrypt key escrow bundle, wrong passphrase?")
+)
+
+// sealKeyEscrowBundle returns a writer that encrypts the objects written to it
+// into an age file that is protected by the given passphrase. The objects are
+// encoded as a stream of JSON objects. The bundle is only complete once the
+// writer is closed, truncated bundles fail to open.
+func sealKeyEscrowBundle(w io.Writer, passphrase string) (*keyEscrowWriter, error) {
+	r, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	r.SetWorkFactor(keyEscrowScryptLogN)
+	wc, err := age.Encrypt(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return &keyEscrowWriter{wc: wc, enc: json.NewEncoder(wc)}, nil
+}
+
+// openKeyEscrowBundle returns a reader that decrypts a bundle that was sealed
+// with sealKeyEscrowBundle.
+func openKeyEscrowBundle(r io.Reader, passphrase string) (*keyEscrowReader, error) {
+	id, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	id.SetMaxWorkFactor(keyEscrowMaxScryptLogN)
+
+	pr, err := age.Decrypt(r, id)
+	var errNoMatch *age.NoIdentityMatchError
+	if errors.As(err, &errNoMatch) {
+		return nil, errWrongPassphrase
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidKeyEscrowBundle, err)
+	}
+	return &keyEscrowReader{dec: json.NewDecoder(pr)}, nil
+}
+
+// keyEscrowWriter writes objects to a key escrow bundle.
+type keyEscrowWriter struct {
+	wc  io.WriteCloser
+	enc *json.Encoder
+}
+
+// Write adds the given objects to the bundle.
+func (w *keyEscrowWriter) Write(objects []api.KeyEscrowObject) error {
+	for _, o := range objects {
+		if err := w.enc.Encode(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close finalizes the bundle.
+func (w *keyEscrowWriter) Close() error {
+	return w.wc.Close()
+}
+
+// keyEscrowReader reads objects from a key escrow bundle.
+type keyEscrowReader struct {
+	dec *json.Decoder
+}
+
+// Read reads up to n objects from the bundle, it returns io.EOF once all
+// objects were read.
+func (r *keyEscrowReader) Read(n int) ([]api.KeyEscrowObject, error) {
+	var objects []api.KeyEscrowObject
+	for len(objects) < n {
+		var o api.KeyEscrowObject
+		if err := r.dec.Decode(&o); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidKeyEscrowBundle, err)
+		}
+		objects = append(objects, o)
+	}
+	if len(objects) == 0 {
+		return nil, io.EOF
+	}
+	return objects, nil
+}
+
+func (b *bus) keysExportHandlerPOST(jc jape.Context) {
+	var req api.KeyEscrowExportRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if req.Passphrase == "" {
+		jc.Error(errMissingPassphrase, http.StatusBadRequest)
+		return
+	}
+
+	// fetch the first batch before writing the response, that way we can
+	// still return an error
+	ctx := jc.Request.Context()
+	objects, marker, err := b.ms.ObjectEncryptionKeys(ctx, 0, keyEscrowBatchSize)
+	if jc.Check("failed to fetch object encryption keys", err) != nil {
+		return
+	}
+
+	jc.ResponseWriter.Header().Set("Content-Type", "application/octet-stream")
+	bw, err := sealKeyEscrowBundle(jc.ResponseWriter, req.Passphrase)
+	if jc.Check("failed to seal key escrow bundle", err) != nil {
+		return
+	}
+
+	// stream the keys in batches, if we fail halfway through the bundle is
+	// not finalized which causes it to fail to open, we paginate by id so
+	// objects that are added or removed during the export don't cause other
+	// objects to be skipped or exported twice
+	for len(objects) > 0 {
+		if err := bw.Write(objects); err != nil {
+			b.logger.Errorf("failed to write key escrow bundle, err: %v", err)
+			return
+		} else if len(objects) < keyEscrowBatchSize {
+			break
+		}
+		objects, marker, err = b.ms.ObjectEncryptionKeys(ctx, marker, keyEscrowBatchSize)
+		if err != nil {
+			b.logger.Errorf("failed to fetch object encryption keys, err: %v", err)
+			return
+		}
+	}
+	if err := bw.Close(); err != nil {
+		b.logger.Errorf("failed to finalize key escrow bundle, err: %v", err)
+	}
+}
+
+func (b *bus) keysImportHandlerPOST(jc jape.Context) {
+	var req api.KeyEscrowImportRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if req.Passphrase == "" {
+		jc.Error(errMissingPassphrase, http.StatusBadRequest)
+		return
+	}
+
+	// default to the default contract set
+	if req.ContractSet == "" {
+		var css api.ContractSetSetting
+		if err := b.fetchSetting(jc.Request.Context(), api.SettingContractSet, &css); err != nil && !errors.Is(err, api.ErrSettingNotFound) {
+			jc.Error(fmt.Errorf("could not get contract set settings: %w", err), http.StatusInternalServerError)
+			return
+		}
+		req.ContractSet = css.Default
+	}
+	if req.ContractSet == "" {
+		jc.Error(errors.New("no contract set provided"), http.StatusBadRequest)
+		return
+	}
+
+	br, err := openKeyEscrowBundle(bytes.NewReader(req.Bundle), req.Passphrase)
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	// restore the objects in batches to avoid long running transactions
+	var resp api.KeyEscrowImportResponse
+	for {
+		objects, err := br.Read(keyEscrowBatchSize)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			jc.Error(err, http.StatusBadRequest)
+			return
+		}
+		restored, recreated, unmatched, err := b.ms.RestoreObjectEncryptionKeys(jc.Request.Context(), req.ContractSet, objects)
+		if jc.Check("failed to restore object encryption keys", err) != nil {
+			return
+		}
+		resp.Objects += uint64(len(objects))
+		resp.Restored += restored
+		resp.Recreated += recreated
+		resp.Unmatched += unmatched
+	}
+	jc.Encode(resp)
+}
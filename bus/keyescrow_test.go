@@ -0,0 +1,97 @@
+package bus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+)
+
+func TestKeyEscrowBundle(t *testing.T) {
+	// lower the work factor to speed up the test
+	defer func(logN int) { keyEscrowScryptLogN = logN }(keyEscrowScryptLogN)
+	keyEscrowScryptLogN = 10
+
+	// seal a bundle that spans multiple batches
+	var objects []api.KeyEscrowObject
+	for i := 0; i < keyEscrowBatchSize+1; i++ {
+		objects = append(objects, api.KeyEscrowObject{
+			Bucket: "default",
+			Path:   fmt.Sprintf("/foo%d", i),
+			Object: object.Object{
+				Key:   object.GenerateEncryptionKey(),
+				Slabs: []object.SlabSlice{{Slab: object.Slab{Key: object.GenerateEncryptionKey()}}},
+			},
+		})
+	}
+	var buf bytes.Buffer
+	bw, err := sealKeyEscrowBundle(&buf, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := bw.Write(objects[:keyEscrowBatchSize]); err != nil {
+		t.Fatal(err)
+	} else if err := bw.Write(objects[keyEscrowBatchSize:]); err != nil {
+		t.Fatal(err)
+	} else if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bundle := buf.Bytes()
+
+	// assert the bundle can be opened
+	br, err := openKeyEscrowBundle(bytes.NewReader(bundle), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opened []api.KeyEscrowObject
+	for {
+		batch, err := br.Read(keyEscrowBatchSize)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		} else if len(batch) > keyEscrowBatchSize {
+			t.Fatal("batch too large", len(batch))
+		}
+		opened = append(opened, batch...)
+	}
+	if len(opened) != len(objects) {
+		t.Fatal("unexpected number of objects", len(opened))
+	}
+	for i, o := range opened {
+		if o.Path != objects[i].Path || o.Key.String() != objects[i].Key.String() || o.Slabs[0].Key.String() != objects[i].Slabs[0].Key.String() {
+			t.Fatal("unexpected object", o)
+		}
+	}
+
+	// assert a wrong passphrase fails
+	if _, err := openKeyEscrowBundle(bytes.NewReader(bundle), "wrong"); !errors.Is(err, errWrongPassphrase) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert truncated bundles fail to open
+	if br, err := openKeyEscrowBundle(bytes.NewReader(bundle[:len(bundle)-1]), "passphrase"); err != nil {
+		t.Fatal(err)
+	} else if _, err := br.Read(len(objects)); !errors.Is(err, errInvalidKeyEscrowBundle) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert invalid bundles are rejected
+	if _, err := openKeyEscrowBundle(bytes.NewReader(bundle[:10]), "passphrase"); !errors.Is(err, errInvalidKeyEscrowBundle) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert bundles with an excessive work factor are rejected
+	keyEscrowScryptLogN = keyEscrowMaxScryptLogN + 1
+	buf.Reset()
+	if bw, err := sealKeyEscrowBundle(&buf, "passphrase"); err != nil {
+		t.Fatal(err)
+	} else if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, err := openKeyEscrowBundle(&buf, "passphrase"); !errors.Is(err, errInvalidKeyEscrowBundle) {
+		t.Fatal("unexpected error", err)
+	}
+}
@@ -0,0 +1,131 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+type (
+	// A DatabaseStore can perform maintenance on the database.
+	DatabaseStore interface {
+		OptimizeDatabase(ctx context.Context, progress func(step string, completed, total int)) error
+	}
+
+	databaseMaintenance struct {
+		store    DatabaseStore
+		logger   *zap.SugaredLogger
+		interval time.Duration
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
+
+		mu     sync.Mutex
+		status api.DatabaseMaintenanceStatus
+	}
+)
+
+func newDatabaseMaintenance(store DatabaseStore, interval time.Duration, logger *zap.SugaredLogger) *databaseMaintenance {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &databaseMaintenance{
+		store:    store,
+		logger:   logger,
+		interval: interval,
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if interval > 0 {
+		m.wg.Add(1)
+		go m.schedule()
+	}
+	return m
+}
+
+// Close cancels any ongoing maintenance and waits for it to finish.
+func (m *databaseMaintenance) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Optimize starts optimizing the database in the background. It returns once
+// the optimization is underway or failed to start, e.g. because the database
+// is busy or maintenance is already running.
+func (m *databaseMaintenance) Optimize() error {
+	m.mu.Lock()
+	if m.status.Running {
+		m.mu.Unlock()
+		return api.ErrDatabaseMaintenanceRunning
+	}
+	m.status = api.DatabaseMaintenanceStatus{
+		Running:   true,
+		StartedAt: time.Now(),
+	}
+	m.mu.Unlock()
+
+	// the optimization is considered started on the first progress update
+	startedChan := make(chan error, 1)
+	var once sync.Once
+	signal := func(err error) { once.Do(func() { startedChan <- err }) }
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		err := m.store.OptimizeDatabase(m.ctx, func(step string, completed, total int) {
+			signal(nil)
+			m.mu.Lock()
+			m.status.Step = step
+			m.status.Completed = completed
+			m.status.Total = total
+			m.mu.Unlock()
+		})
+		signal(err)
+
+		m.mu.Lock()
+		m.status.Running = false
+		m.status.Step = ""
+		m.status.FinishedAt = time.Now()
+		if err != nil {
+			m.status.Error = err.Error()
+		}
+		m.mu.Unlock()
+
+		if err != nil && !errors.Is(err, api.ErrDatabaseBusy) {
+			m.logger.Errorf("database optimization failed: %v", err)
+		} else if err == nil {
+			m.logger.Infof("database optimization finished after %v", time.Since(m.Status().StartedAt))
+		}
+	}()
+	return <-startedChan
+}
+
+// Status returns the status of the current or most recent maintenance run.
+func (m *databaseMaintenance) Status() api.DatabaseMaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+func (m *databaseMaintenance) schedule() {
+	defer m.wg.Done()
+
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		err := m.Optimize()
+		if errors.Is(err, api.ErrDatabaseBusy) || errors.Is(err, api.ErrDatabaseMaintenanceRunning) {
+			m.logger.Debugf("skipping scheduled database optimization: %v", err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package bus
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// rebroadcastCheckInterval is the interval at which the rebroadcaster
+	// checks whether unconfirmed transactions need to be rebroadcast.
+	rebroadcastCheckInterval = time.Minute
+
+	// rebroadcastIntervalBlocks is the number of blocks after which an
+	// unconfirmed wallet transaction is rebroadcast.
+	rebroadcastIntervalBlocks = 6
+)
+
+type (
+	// A txnBroadcaster broadcasts transactions to peers.
+	txnBroadcaster interface {
+		BroadcastTransaction(txn types.Transaction, dependsOn []types.Transaction)
+	}
+
+	// A txnRebroadcastPool is the part of the transaction pool the
+	// rebroadcaster uses.
+	txnRebroadcastPool interface {
+		Transactions() []types.Transaction
+		UnconfirmedParents(txn types.Transaction) ([]types.Transaction, error)
+	}
+
+	// rebroadcaster periodically re-announces unconfirmed transactions that
+	// spend wallet outputs, such as contract formations and renewals, so they
+	// don't get stuck when they were dropped by peers during fee spikes.
+	rebroadcaster struct {
+		s      txnBroadcaster
+		tp     txnRebroadcastPool
+		owns   func(types.Address) bool
+		height func() uint64
+		logger *zap.SugaredLogger
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
+
+		mu            sync.Mutex
+		lastBroadcast map[types.TransactionID]uint64
+	}
+)
+
+func newRebroadcaster(s txnBroadcaster, tp txnRebroadcastPool, w Wallet, cm ChainManager, logger *zap.SugaredLogger) *rebroadcaster {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &rebroadcaster{
+		s:    s,
+		tp:   tp,
+		owns: w.OwnsAddress,
+		height: func() uint64 {
+			return cm.TipState(ctx).Index.Height
+		},
+		logger: logger,
+
+		ctx:    ctx,
+		cancel: cancel,
+
+		lastBroadcast: make(map[types.TransactionID]uint64),
+	}
+	r.wg.Add(1)
+	go r.schedule()
+	return r
+}
+
+// Close stops the rebroadcaster and waits for it to finish.
+func (r *rebroadcaster) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *rebroadcaster) schedule() {
+	defer r.wg.Done()
+
+	t := time.NewTicker(rebroadcastCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if n := r.rebroadcast(r.height()); n > 0 {
+			r.logger.Infof("rebroadcast %d unconfirmed wallet transactions", n)
+		}
+	}
+}
+
+// rebroadcast rebroadcasts the unconfirmed wallet transactions that weren't
+// broadcast in the last rebroadcastIntervalBlocks blocks and returns how many
+// were rebroadcast. Transactions that are seen for the first time are only
+// tracked since they were broadcast when they were added to the pool.
+func (r *rebroadcaster) rebroadcast(height uint64) (n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inPool := make(map[types.TransactionID]struct{})
+	for _, txn := range r.tp.Transactions() {
+		if !r.isWalletTxn(txn) {
+			continue
+		}
+		id := txn.ID()
+		inPool[id] = struct{}{}
+
+		last, exists := r.lastBroadcast[id]
+		if !exists {
+			r.lastBroadcast[id] = height
+			continue
+		} else if height < last+rebroadcastIntervalBlocks {
+			continue
+		}
+
+		parents, err := r.tp.UnconfirmedParents(txn)
+		if err != nil {
+			r.logger.Errorf("failed to fetch parents of transaction %v: %v", id, err)
+			continue
+		}
+		r.s.BroadcastTransaction(txn, parents)
+		r.lastBroadcast[id] = height
+		n++
+	}
+
+	// forget about transactions that were confirmed or dropped
+	for id := range r.lastBroadcast {
+		if _, exists := inPool[id]; !exists {
+			delete(r.lastBroadcast, id)
+		}
+	}
+	return
+}
+
+func (r *rebroadcaster) isWalletTxn(txn types.Transaction) bool {
+	for _, sci := range txn.SiacoinInputs {
+		if r.owns(sci.UnlockConditions.UnlockHash()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package bus
+
+import (
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/wallet"
+	"go.uber.org/zap"
+)
+
+type testBroadcaster struct {
+	broadcast []types.TransactionID
+}
+
+func (b *testBroadcaster) BroadcastTransaction(txn types.Transaction, dependsOn []types.Transaction) {
+	b.broadcast = append(b.broadcast, txn.ID())
+}
+
+type testTxnPool struct {
+	txns []types.Transaction
+}
+
+func (tp *testTxnPool) Transactions() []types.Transaction { return tp.txns }
+func (tp *testTxnPool) UnconfirmedParents(txn types.Transaction) ([]types.Transaction, error) {
+	return nil, nil
+}
+
+func TestRebroadcast(t *testing.T) {
+	walletUC := wallet.StandardUnlockConditions(types.GeneratePrivateKey().PublicKey())
+	otherUC := wallet.StandardUnlockConditions(types.GeneratePrivateKey().PublicKey())
+
+	walletTxn := types.Transaction{SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}, UnlockConditions: walletUC}}}
+	otherTxn := types.Transaction{SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{2}, UnlockConditions: otherUC}}}
+
+	b := &testBroadcaster{}
+	tp := &testTxnPool{txns: []types.Transaction{walletTxn, otherTxn}}
+	r := &rebroadcaster{
+		s:             b,
+		tp:            tp,
+		owns:          func(addr types.Address) bool { return addr == walletUC.UnlockHash() },
+		logger:        zap.NewNop().Sugar(),
+		lastBroadcast: make(map[types.TransactionID]uint64),
+	}
+
+	// assert new transactions are only tracked
+	if n := r.rebroadcast(10); n != 0 {
+		t.Fatal("unexpected rebroadcast", n)
+	} else if len(r.lastBroadcast) != 1 {
+		t.Fatal("expected only the wallet transaction to be tracked")
+	}
+
+	// assert the wallet transaction is rebroadcast after enough blocks
+	if n := r.rebroadcast(10 + rebroadcastIntervalBlocks - 1); n != 0 {
+		t.Fatal("unexpected rebroadcast", n)
+	} else if n := r.rebroadcast(10 + rebroadcastIntervalBlocks); n != 1 {
+		t.Fatal("expected rebroadcast", n)
+	} else if len(b.broadcast) != 1 || b.broadcast[0] != walletTxn.ID() {
+		t.Fatal("unexpected broadcast", b.broadcast)
+	} else if n := r.rebroadcast(10 + rebroadcastIntervalBlocks); n != 0 {
+		t.Fatal("unexpected rebroadcast", n)
+	}
+
+	// assert confirmed transactions are forgotten
+	tp.txns = []types.Transaction{otherTxn}
+	if n := r.rebroadcast(100); n != 0 {
+		t.Fatal("unexpected rebroadcast", n)
+	} else if len(r.lastBroadcast) != 0 {
+		t.Fatal("expected transaction to be forgotten")
+	}
+}
@@ -0,0 +1,77 @@
+package bus
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type (
+	// A ScratchStore can garbage collect expired objects and multipart
+	// uploads in scratch buckets.
+	ScratchStore interface {
+		PruneExpiredObjects(ctx context.Context, now time.Time, deleted func(bucket, path string)) (objects, uploads int64, err error)
+	}
+
+	// scratchGC periodically reclaims the data of expired objects and stale
+	// multipart uploads in scratch buckets.
+	scratchGC struct {
+		store     ScratchStore
+		onDeleted func(bucket, path string)
+		logger    *zap.SugaredLogger
+		interval  time.Duration
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
+	}
+)
+
+// newScratchGC returns a garbage collector that prunes expired objects at the
+// given interval, the given function is called for every pruned object.
+func newScratchGC(store ScratchStore, interval time.Duration, onDeleted func(bucket, path string), logger *zap.SugaredLogger) *scratchGC {
+	ctx, cancel := context.WithCancel(context.Background())
+	gc := &scratchGC{
+		store:     store,
+		onDeleted: onDeleted,
+		logger:    logger,
+		interval:  interval,
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if interval > 0 {
+		gc.wg.Add(1)
+		go gc.schedule()
+	}
+	return gc
+}
+
+// Close cancels any ongoing garbage collection and waits for it to finish.
+func (gc *scratchGC) Close() {
+	gc.cancel()
+	gc.wg.Wait()
+}
+
+func (gc *scratchGC) schedule() {
+	defer gc.wg.Done()
+
+	t := time.NewTicker(gc.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-gc.ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		objects, uploads, err := gc.store.PruneExpiredObjects(gc.ctx, time.Now(), gc.onDeleted)
+		if err != nil && gc.ctx.Err() == nil {
+			gc.logger.Errorf("failed to prune expired objects: %v", err)
+		} else if objects > 0 || uploads > 0 {
+			gc.logger.Infof("pruned %d expired objects and %d expired multipart uploads", objects, uploads)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// settingsVersionKey is the key of the setting that holds the settings
+	// version, it is managed by the bus and can't be updated through the API.
+	settingsVersionKey = "settingsversion"
+)
+
+var (
+	// versionedSettings are the settings that make up the gouging and upload
+	// params, updating any of them bumps the settings version.
+	versionedSettings = map[string]struct{}{
+		api.SettingContractSet:   {},
+		api.SettingDownloads:     {},
+		api.SettingGouging:       {},
+		api.SettingMaintenance:   {},
+		api.SettingRedundancy:    {},
+		api.SettingUploadPacking: {},
+	}
+
+	errSettingsVersionReadOnly = errors.New("the settings version is managed by the bus")
+)
+
+// settingsVersion keeps track of the version of the settings that make up the
+// gouging and upload params. The version is persisted alongside the settings
+// so it increases monotonically across restarts.
+type settingsVersion struct {
+	ss SettingStore
+
+	mu      sync.Mutex
+	version uint64
+}
+
+func newSettingsVersion(ctx context.Context, ss SettingStore) (*settingsVersion, error) {
+	sv := &settingsVersion{ss: ss, version: 1}
+	value, err := ss.Setting(ctx, settingsVersionKey)
+	if errors.Is(err, api.ErrSettingNotFound) {
+		return sv, nil
+	} else if err != nil {
+		return nil, err
+	}
+	sv.version, err = strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse settings version '%s': %w", value, err)
+	}
+	return sv, nil
+}
+
+// Bump increments the settings version if the setting with the given key is
+// versioned.
+func (sv *settingsVersion) Bump(ctx context.Context, key string) error {
+	if _, ok := versionedSettings[key]; !ok {
+		return nil
+	}
+
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	if err := sv.ss.UpdateSetting(ctx, settingsVersionKey, strconv.FormatUint(sv.version+1, 10)); err != nil {
+		return fmt.Errorf("failed to update settings version: %w", err)
+	}
+	sv.version++
+	return nil
+}
+
+// Version returns the current settings version.
+func (sv *settingsVersion) Version() uint64 {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	return sv.version
+}
@@ -0,0 +1,81 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.sia.tech/renterd/api"
+)
+
+// mockSettingStore is an in-memory SettingStore.
+type mockSettingStore map[string]string
+
+func (s mockSettingStore) DeleteSetting(ctx context.Context, key string) error {
+	delete(s, key)
+	return nil
+}
+
+func (s mockSettingStore) Setting(ctx context.Context, key string) (string, error) {
+	value, ok := s[key]
+	if !ok {
+		return "", fmt.Errorf("key '%s' err: %w", key, api.ErrSettingNotFound)
+	}
+	return value, nil
+}
+
+func (s mockSettingStore) Settings(ctx context.Context) (keys []string, _ error) {
+	for key := range s {
+		keys = append(keys, key)
+	}
+	return
+}
+
+func (s mockSettingStore) UpdateSetting(ctx context.Context, key, value string) error {
+	s[key] = value
+	return nil
+}
+
+func TestSettingsVersion(t *testing.T) {
+	ctx := context.Background()
+	ss := make(mockSettingStore)
+
+	// the initial version is 1
+	sv, err := newSettingsVersion(ctx, ss)
+	if err != nil {
+		t.Fatal(err)
+	} else if sv.Version() != 1 {
+		t.Fatal("unexpected version", sv.Version())
+	}
+
+	// settings that aren't part of the params don't bump the version
+	if err := sv.Bump(ctx, api.SettingS3Authentication); err != nil {
+		t.Fatal(err)
+	} else if sv.Version() != 1 {
+		t.Fatal("unexpected version", sv.Version())
+	}
+
+	// settings that are part of the params do
+	for _, key := range []string{api.SettingGouging, api.SettingRedundancy} {
+		if err := sv.Bump(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sv.Version() != 3 {
+		t.Fatal("unexpected version", sv.Version())
+	}
+
+	// the version survives a restart
+	sv, err = newSettingsVersion(ctx, ss)
+	if err != nil {
+		t.Fatal(err)
+	} else if sv.Version() != 3 {
+		t.Fatal("unexpected version after restart", sv.Version())
+	}
+
+	// a corrupt version is an error
+	ss[settingsVersionKey] = "foo"
+	if _, err := newSettingsVersion(ctx, ss); err == nil {
+		t.Fatal("expected error")
+	}
+}
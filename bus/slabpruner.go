@@ -0,0 +1,99 @@
+package bus
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// slabPrunerBatchSize is the number of slabs that are pruned per
+	// transaction.
+	slabPrunerBatchSize = 1000
+
+	// slabPrunerInterval is the interval at which the slab pruner runs if it
+	// isn't triggered by a deletion.
+	slabPrunerInterval = 10 * time.Minute
+)
+
+type (
+	// A SlabPruneStore prunes slabs that are no longer referenced by any
+	// object and queues their sectors for deletion.
+	SlabPruneStore interface {
+		PruneSlabs(ctx context.Context, limit int) (int64, error)
+	}
+
+	// slabPruner prunes unreferenced slabs in the background, that way
+	// deleting objects doesn't have to wait for their slabs and sectors to be
+	// deleted.
+	slabPruner struct {
+		store   SlabPruneStore
+		logger  *zap.SugaredLogger
+		trigger chan struct{}
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
+	}
+)
+
+func newSlabPruner(store SlabPruneStore, logger *zap.SugaredLogger) *slabPruner {
+	ctx, cancel := context.WithCancel(context.Background())
+	sp := &slabPruner{
+		store:   store,
+		logger:  logger,
+		trigger: make(chan struct{}, 1),
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	sp.wg.Add(1)
+	go sp.schedule()
+	return sp
+}
+
+// Close cancels any ongoing pruning and waits for it to finish.
+func (sp *slabPruner) Close() {
+	sp.cancel()
+	sp.wg.Wait()
+}
+
+// Trigger schedules the pruner to run, it doesn't block.
+func (sp *slabPruner) Trigger() {
+	select {
+	case sp.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (sp *slabPruner) schedule() {
+	defer sp.wg.Done()
+
+	t := time.NewTicker(slabPrunerInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-sp.ctx.Done():
+			return
+		case <-sp.trigger:
+		case <-t.C:
+		}
+
+		var pruned int64
+		for sp.ctx.Err() == nil {
+			n, err := sp.store.PruneSlabs(sp.ctx, slabPrunerBatchSize)
+			if err != nil && sp.ctx.Err() == nil {
+				sp.logger.Errorf("failed to prune slabs: %v", err)
+			}
+			pruned += n
+			if err != nil || n < slabPrunerBatchSize {
+				break
+			}
+		}
+		if pruned > 0 {
+			sp.logger.Debugf("pruned %d slabs", pruned)
+		}
+	}
+}
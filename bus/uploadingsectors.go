@@ -21,6 +21,11 @@ type (
 	uploadingSectorsCache struct {
 		mu      sync.Mutex
 		uploads map[api.UploadID]*ongoingUpload
+
+		// renewedTo maps contracts to the contract they were renewed to while
+		// uploads were ongoing, sectors that are added for a renewed contract
+		// are tracked for the contract it was renewed to
+		renewedTo map[types.FileContractID]types.FileContractID
 	}
 
 	ongoingUpload struct {
@@ -32,7 +37,8 @@ type (
 
 func newUploadingSectorsCache() *uploadingSectorsCache {
 	return &uploadingSectorsCache{
-		uploads: make(map[api.UploadID]*ongoingUpload),
+		uploads:   make(map[api.UploadID]*ongoingUpload),
+		renewedTo: make(map[types.FileContractID]types.FileContractID),
 	}
 }
 
@@ -42,6 +48,15 @@ func (ou *ongoingUpload) addSector(fcid types.FileContractID, root types.Hash256
 	ou.contractSectors[fcid] = append(ou.contractSectors[fcid], root)
 }
 
+func (ou *ongoingUpload) renewContract(renewedFrom, renewedTo types.FileContractID) {
+	ou.mu.Lock()
+	defer ou.mu.Unlock()
+	if sectors, exists := ou.contractSectors[renewedFrom]; exists {
+		ou.contractSectors[renewedTo] = append(ou.contractSectors[renewedTo], sectors...)
+		delete(ou.contractSectors, renewedFrom)
+	}
+}
+
 func (ou *ongoingUpload) sectors(fcid types.FileContractID) (roots []types.Hash256) {
 	ou.mu.Lock()
 	defer ou.mu.Unlock()
@@ -52,9 +67,16 @@ func (ou *ongoingUpload) sectors(fcid types.FileContractID) (roots []types.Hash2
 }
 
 func (usc *uploadingSectorsCache) addUploadingSector(uID api.UploadID, fcid types.FileContractID, root types.Hash256) error {
-	// fetch ongoing upload
+	// fetch ongoing upload and the latest renewal of the contract
 	usc.mu.Lock()
 	ongoing, exists := usc.uploads[uID]
+	for i := 0; i < len(usc.renewedTo); i++ {
+		renewedTo, renewed := usc.renewedTo[fcid]
+		if !renewed {
+			break
+		}
+		fcid = renewedTo
+	}
 	usc.mu.Unlock()
 
 	// add sector if upload exists
@@ -105,6 +127,25 @@ func (usc *uploadingSectorsCache) finishUpload(uID api.UploadID) {
 			delete(usc.uploads, uID)
 		}
 	}
+
+	// renewals are only relevant to ongoing uploads
+	if len(usc.uploads) == 0 {
+		usc.renewedTo = make(map[types.FileContractID]types.FileContractID)
+	}
+}
+
+// renewContract moves the sectors of ongoing uploads from the renewed contract
+// to the contract it was renewed to.
+func (usc *uploadingSectorsCache) renewContract(renewedFrom, renewedTo types.FileContractID) {
+	usc.mu.Lock()
+	defer usc.mu.Unlock()
+	if len(usc.uploads) == 0 {
+		return
+	}
+	usc.renewedTo[renewedFrom] = renewedTo
+	for _, ongoing := range usc.uploads {
+		ongoing.renewContract(renewedFrom, renewedTo)
+	}
 }
 
 func (usc *uploadingSectorsCache) trackUpload(uID api.UploadID) error {
@@ -63,6 +63,42 @@ func TestUploadingSectorsCache(t *testing.T) {
 	}
 }
 
+func TestUploadingSectorsCacheRenewals(t *testing.T) {
+	c := newUploadingSectorsCache()
+
+	// renewals without ongoing uploads are ignored
+	c.renewContract(types.FileContractID{1}, types.FileContractID{2})
+	if len(c.renewedTo) != 0 {
+		t.Fatal("unexpected renewals", c.renewedTo)
+	}
+
+	uID := newTestUploadID()
+	c.trackUpload(uID)
+	_ = c.addUploadingSector(uID, types.FileContractID{1}, types.Hash256{1})
+
+	// assert sectors are moved to the renewed contract
+	c.renewContract(types.FileContractID{1}, types.FileContractID{2})
+	if roots := c.sectors(types.FileContractID{1}); len(roots) != 0 {
+		t.Fatal("unexpected cached sectors", roots)
+	} else if roots := c.sectors(types.FileContractID{2}); len(roots) != 1 || roots[0] != (types.Hash256{1}) {
+		t.Fatal("unexpected cached sectors", roots)
+	}
+
+	// assert sectors added for a contract that was renewed twice are tracked
+	// for the latest contract
+	c.renewContract(types.FileContractID{2}, types.FileContractID{3})
+	_ = c.addUploadingSector(uID, types.FileContractID{1}, types.Hash256{2})
+	if roots := c.sectors(types.FileContractID{3}); len(roots) != 2 {
+		t.Fatal("unexpected cached sectors", roots)
+	}
+
+	// assert renewals are forgotten once all uploads are finished
+	c.finishUpload(uID)
+	if len(c.renewedTo) != 0 {
+		t.Fatal("unexpected renewals", c.renewedTo)
+	}
+}
+
 func newTestUploadID() api.UploadID {
 	var uID api.UploadID
 	frand.Read(uID[:])
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/wallet"
+)
+
+// legacyTypes are the types whose fields were only tagged when the versioned
+// API was introduced, alongside the fields that were untagged before. The
+// legacy routes serialize those fields using their Go names, that way clients
+// of the unversioned API keep working until the legacy routes are removed.
+var legacyTypes = []legacyType{
+	newLegacyType(hostdb.Announcement{}, "index", "timestamp", "netAddress"),
+	newLegacyType(hostdb.Interactions{}, "totalScans", "lastScan", "lastScanSuccess", "secondToLastScanSuccess", "uptime", "downtime", "successfulInteractions", "failedInteractions", "missedProofs", "lastMissedProof"),
+	newLegacyType(hostdb.HostScan{}, "success", "timestamp", "settings", "priceTable"),
+	newLegacyType(hostdb.PriceTableUpdate{}, "success", "timestamp", "priceTable"),
+	newLegacyType(api.ConsensusNetwork{}, "name"),
+	newLegacyType(api.GougingParams{}, "consensusState", "gougingSettings", "redundancySettings", "transactionFee", "settingsVersion"),
+	newLegacyType(api.MultipartCompleteRequest{}, "parts"),
+	newLegacyType(api.UploadedPackedSlab{}, "bufferID", "shards"),
+	newLegacyType(api.UploadParams{}, "currentHeight", "contractSet", "uploadPacking", "consensusState", "gougingSettings", "redundancySettings", "transactionFee", "settingsVersion"),
+	newLegacyType(wallet.SiacoinElement{}, "id", "maturityHeight"),
+}
+
+// legacyType identifies the JSON objects of a type by their keys and maps the
+// keys of its retagged fields to their legacy names.
+type legacyType struct {
+	fields  map[string]jsonField
+	renames map[string]string
+}
+
+// jsonField is a field of a struct as it's serialized by encoding/json.
+type jsonField struct {
+	name      string
+	omitempty bool
+}
+
+func newLegacyType(v interface{}, retagged ...string) legacyType {
+	lt := legacyType{
+		fields:  make(map[string]jsonField),
+		renames: make(map[string]string),
+	}
+	jsonFields(reflect.TypeOf(v), lt.fields)
+	for _, key := range retagged {
+		f, ok := lt.fields[key]
+		if !ok {
+			panic("unknown field " + key) // developer error
+		}
+		lt.renames[key] = f.name
+	}
+	return lt
+}
+
+// jsonFields adds the JSON keys of the given struct type to the given map,
+// alongside the fields they belong to. Fields of embedded structs are promoted
+// like encoding/json does.
+func jsonFields(t reflect.Type, fields map[string]jsonField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			jsonFields(f.Type, fields)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = jsonField{
+			name:      f.Name,
+			omitempty: strings.Contains(opts, "omitempty"),
+		}
+	}
+}
+
+// matches returns true if the given object has all keys of the type, except
+// for the ones that are omitted when empty, and no other keys.
+func (lt legacyType) matches(obj map[string]interface{}) bool {
+	for key := range obj {
+		if _, ok := lt.fields[key]; !ok {
+			return false
+		}
+	}
+	for key, f := range lt.fields {
+		if _, ok := obj[key]; !ok && !f.omitempty {
+			return false
+		}
+	}
+	return true
+}
+
+// legacyFieldNames renames the retagged fields of all objects in the given
+// JSON value to their legacy names.
+func legacyFieldNames(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = legacyFieldNames(val)
+		}
+		for _, lt := range legacyTypes {
+			if !lt.matches(v) {
+				continue
+			}
+			for key, name := range lt.renames {
+				v[name] = v[key]
+				delete(v, key)
+			}
+			break
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = legacyFieldNames(v[i])
+		}
+	}
+	return v
+}
+
+// withLegacyFieldNames wraps the given handler and rewrites its JSON responses
+// to use the legacy field names.
+func withLegacyFieldNames(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lw := &legacyResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(lw, req)
+		if lw.buf == nil {
+			return
+		}
+
+		body := lw.buf.Bytes()
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err == nil {
+			if b, err := json.Marshal(legacyFieldNames(v)); err == nil {
+				body = append(b, '\n')
+			}
+		}
+		w.WriteHeader(lw.status)
+		w.Write(body)
+	})
+}
+
+// legacyResponseWriter buffers JSON responses so their field names can be
+// rewritten, all other responses are passed through.
+type legacyResponseWriter struct {
+	http.ResponseWriter
+
+	wroteHeader bool
+	status      int
+	buf         *bytes.Buffer
+}
+
+func (w *legacyResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.status = status
+		w.buf = new(bytes.Buffer)
+		w.Header().Del("Content-Length")
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *legacyResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buf != nil {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (w *legacyResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.buf == nil {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer, it allows http.ResponseController to
+// access the underlying connection.
+func (w *legacyResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack implements http.Hijacker, it allows upgrading connections to
+// websockets.
+func (w *legacyResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer doesn't support hijacking")
+	}
+	return h.Hijack()
+}
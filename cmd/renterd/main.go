@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -17,6 +18,7 @@ import (
 
 	"go.sia.tech/core/types"
 	"go.sia.tech/jape"
+	"go.sia.tech/renterd/alerts"
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/autopilot"
 	"go.sia.tech/renterd/build"
@@ -55,8 +57,9 @@ var (
 		Directory: ".",
 		Seed:      os.Getenv("RENTERD_SEED"),
 		HTTP: config.HTTP{
-			Address:  build.DefaultAPIAddress,
-			Password: os.Getenv("RENTERD_API_PASSWORD"),
+			Address:      build.DefaultAPIAddress,
+			Password:     os.Getenv("RENTERD_API_PASSWORD"),
+			LegacyRoutes: true,
 		},
 		ShutdownTimeout: 5 * time.Minute,
 		Tracing: config.Tracing{
@@ -77,6 +80,9 @@ var (
 			PersistInterval:               time.Minute,
 			UsedUTXOExpiry:                24 * time.Hour,
 			SlabBufferCompletionThreshold: 1 << 12,
+			SlabBufferMaxAge:              time.Hour,
+			ScratchGCInterval:             10 * time.Minute,
+			AlertsRetention:               alerts.DefaultRetention,
 		},
 		Worker: config.Worker{
 			Enabled: true,
@@ -88,8 +94,13 @@ var (
 			DownloadMaxOverdrive:     5,
 			DownloadOverdriveTimeout: 3 * time.Second,
 
-			UploadMaxOverdrive:     5,
-			UploadOverdriveTimeout: 3 * time.Second,
+			UploadMaxOverdrive:                5,
+			UploadMaxConcurrentSectorsPerHost: 1,
+			UploadOverdriveTimeout:            3 * time.Second,
+			UploadIdleTimeout:                 time.Minute,
+
+			PriceTablePrefetchInterval: time.Minute,
+			AccountsRefillTarget:       "1SC",
 		},
 		Autopilot: config.Autopilot{
 			Enabled:                        true,
@@ -280,8 +291,10 @@ func main() {
 
 	// node
 	flag.StringVar(&cfg.HTTP.Address, "http", cfg.HTTP.Address, "address to serve API on")
+	flag.BoolVar(&cfg.HTTP.LegacyRoutes, "http.legacyRoutes", cfg.HTTP.LegacyRoutes, "[DEPRECATED] serve the unversioned /api routes next to the /api/v1 routes, they will be removed in the next release - can be overwritten using RENTERD_HTTP_LEGACY_ROUTES environment variable")
 	flag.StringVar(&cfg.Directory, "dir", cfg.Directory, "directory to store node state in")
 	flag.BoolVar(&cfg.Tracing.Enabled, "tracing-enabled", cfg.Tracing.Enabled, "Enables tracing through OpenTelemetry. If RENTERD_TRACING_ENABLED is set, it overwrites the CLI flag's value. Tracing can be configured using the standard OpenTelemetry environment variables. https://github.com/open-telemetry/opentelemetry-specification/blob/v1.8.0/specification/protocol/exporter.md")
+	flag.BoolVar(&cfg.Tracing.DetailedAttributes, "tracing-detailed-attributes", cfg.Tracing.DetailedAttributes, "Records detailed span attributes, such as slab ids and host keys, for all requests. If disabled, they are only recorded for requests carrying the X-Sia-Trace-Debug header. If RENTERD_TRACING_DETAILED_ATTRIBUTES is set, it overwrites the CLI flag's value.")
 	flag.StringVar(&cfg.Tracing.InstanceID, "tracing-service-instance-id", cfg.Tracing.InstanceID, "ID of the service instance used for tracing. If RENTERD_TRACING_SERVICE_INSTANCE_ID is set, it overwrites the CLI flag's value.")
 	flag.StringVar(&cfg.Log.Path, "log-path", cfg.Log.Path, "Overwrites the default log location on disk. Alternatively RENTERD_LOG_PATH can be used")
 
@@ -301,6 +314,11 @@ func main() {
 	flag.DurationVar(&cfg.Bus.PersistInterval, "bus.persistInterval", cfg.Bus.PersistInterval, "interval at which to persist the consensus updates")
 	flag.DurationVar(&cfg.Bus.UsedUTXOExpiry, "bus.usedUTXOExpiry", cfg.Bus.UsedUTXOExpiry, "time after which a used UTXO that hasn't been included in a transaction becomes spendable again")
 	flag.Int64Var(&cfg.Bus.SlabBufferCompletionThreshold, "bus.slabBufferCompletionThreshold", cfg.Bus.SlabBufferCompletionThreshold, "number of remaining bytes in a slab buffer before it is uploaded - can be overwritten using the RENTERD_BUS_SLAB_BUFFER_COMPLETION_THRESHOLD environment variable")
+	flag.DurationVar(&cfg.Bus.SlabBufferMaxAge, "bus.slabBufferMaxAge", cfg.Bus.SlabBufferMaxAge, "time after which a slab buffer that contains data is uploaded even if it isn't full - 0 disables the timeout")
+
+	flag.DurationVar(&cfg.Bus.DatabaseOptimizeInterval, "bus.databaseOptimizeInterval", cfg.Bus.DatabaseOptimizeInterval, "interval at which the database is vacuumed and optimized - 0 disables scheduled optimizations")
+	flag.DurationVar(&cfg.Bus.ScratchGCInterval, "bus.scratchGCInterval", cfg.Bus.ScratchGCInterval, "interval at which expired objects in scratch buckets are garbage collected - 0 disables garbage collection")
+	flag.DurationVar(&cfg.Bus.AlertsRetention, "bus.alertsRetention", cfg.Bus.AlertsRetention, "time after which dismissed alerts are pruned from the alert history")
 
 	// worker
 	flag.BoolVar(&cfg.Worker.AllowPrivateIPs, "worker.allowPrivateIPs", cfg.Worker.AllowPrivateIPs, "allow hosts with private IPs")
@@ -309,12 +327,29 @@ func main() {
 	flag.StringVar(&cfg.Worker.ID, "worker.id", cfg.Worker.ID, "unique identifier of worker used internally - can be overwritten using the RENTERD_WORKER_ID environment variable")
 	flag.DurationVar(&cfg.Worker.DownloadOverdriveTimeout, "worker.downloadOverdriveTimeout", cfg.Worker.DownloadOverdriveTimeout, "timeout applied to slab downloads that decides when we start overdriving")
 	flag.Uint64Var(&cfg.Worker.UploadMaxOverdrive, "worker.uploadMaxOverdrive", cfg.Worker.UploadMaxOverdrive, "maximum number of active overdrive workers when uploading a slab")
+	flag.Uint64Var(&cfg.Worker.UploadMaxConcurrentSectorsPerHost, "worker.uploadMaxConcurrentSectorsPerHost", cfg.Worker.UploadMaxConcurrentSectorsPerHost, "maximum number of sectors that are uploaded to a single host in parallel")
+	flag.Uint64Var(&cfg.Worker.UploadMaxSlabsAhead, "worker.uploadMaxSlabsAhead", cfg.Worker.UploadMaxSlabsAhead, "maximum number of older slabs that may still be uploading when uploaders are selected for a slab - 0 adapts it to the number of healthy uploaders")
+	flag.BoolVar(&cfg.Worker.UploadAutoTune, "worker.uploadAutoTune", cfg.Worker.UploadAutoTune, "adjust the upload overdrive and the sectors uploaded to a host in parallel based on throughput and errors, bounded by their configured maximums")
 	flag.DurationVar(&cfg.Worker.UploadOverdriveTimeout, "worker.uploadOverdriveTimeout", cfg.Worker.UploadOverdriveTimeout, "timeout applied to slab uploads that decides when we start overdriving")
+	flag.DurationVar(&cfg.Worker.UploadIdleTimeout, "worker.uploadIdleTimeout", cfg.Worker.UploadIdleTimeout, "timeout after which an upload fails if no data was received from the client - 0 disables the timeout")
+	flag.DurationVar(&cfg.Worker.UploadMaxDuration, "worker.uploadMaxDuration", cfg.Worker.UploadMaxDuration, "maximum duration of a single upload - 0 disables the limit")
+	flag.StringVar(&cfg.Worker.DownloadCacheDir, "worker.downloadCacheDir", cfg.Worker.DownloadCacheDir, "directory of the download cache - defaults to 'downloadcache' in the node's directory")
+	flag.DurationVar(&cfg.Worker.AccountsRefillInterval, "worker.accountsRefillInterval", cfg.Worker.AccountsRefillInterval, "interval at which the worker refills its accounts with hosts - 0 leaves refilling accounts to the autopilot")
+	flag.StringVar(&cfg.Worker.AccountsRefillTarget, "worker.accountsRefillTarget", cfg.Worker.AccountsRefillTarget, "balance the worker refills its accounts to, e.g. '1SC'")
+	flag.StringVar(&cfg.Worker.AccountsRefillThreshold, "worker.accountsRefillThreshold", cfg.Worker.AccountsRefillThreshold, "balance below which the worker refills an account - defaults to half of the target")
+	flag.DurationVar(&cfg.Worker.PriceTablePrefetchInterval, "worker.priceTablePrefetchInterval", cfg.Worker.PriceTablePrefetchInterval, "interval at which the worker renews the price tables of hosts it has contracts with before they expire - 0 disables prefetching")
+	flag.Uint64Var(&cfg.Worker.DownloadCacheMaxSize, "worker.downloadCacheMaxSize", cfg.Worker.DownloadCacheMaxSize, "maximum size of the download cache in bytes - 0 disables the cache")
+	flag.StringVar(&cfg.Worker.SectorCacheDir, "worker.sectorCacheDir", cfg.Worker.SectorCacheDir, "directory of the sector cache - the sector cache is kept in memory if not set")
+	flag.Uint64Var(&cfg.Worker.SectorCacheMaxSize, "worker.sectorCacheMaxSize", cfg.Worker.SectorCacheMaxSize, "maximum size of the sector cache in bytes - 0 disables the cache")
+	flag.StringVar(&cfg.Worker.UploadStagingDir, "worker.uploadStagingDir", cfg.Worker.UploadStagingDir, "directory uploads can be staged in, staged uploads are acknowledged once they're written to disk and uploaded in the background - staging is disabled if not set")
 	flag.BoolVar(&cfg.Worker.Enabled, "worker.enabled", cfg.Worker.Enabled, "enable/disable creating a worker - can be overwritten using the RENTERD_WORKER_ENABLED environment variable")
 	flag.BoolVar(&cfg.Worker.AllowUnauthenticatedDownloads, "worker.unauthenticatedDownloads", cfg.Worker.AllowUnauthenticatedDownloads, "if set to 'true', the worker will allow for downloading from the /objects endpoint without basic authentication. Can be overwritten using the RENTERD_WORKER_UNAUTHENTICATED_DOWNLOADS environment variable")
 
 	// autopilot
 	flag.DurationVar(&cfg.Autopilot.AccountsRefillInterval, "autopilot.accountRefillInterval", cfg.Autopilot.AccountsRefillInterval, "interval at which the autopilot checks the workers' accounts balance and refills them if necessary")
+	flag.StringVar(&cfg.Autopilot.AccountsUnconfirmedFundingLimit, "autopilot.accountUnconfirmedFundingLimit", cfg.Autopilot.AccountsUnconfirmedFundingLimit, "balance up to which the autopilot funds accounts while the contract paying for them is unconfirmed, e.g. '0.1SC' - accounts aren't funded by unconfirmed contracts if not set")
+	flag.StringVar(&cfg.Autopilot.AccountsMaxDrift, "autopilot.accountMaxDrift", cfg.Autopilot.AccountsMaxDrift, "drift above which the autopilot resyncs an account and registers an alert, e.g. '1SC' - disabled if not set")
+	flag.Float64Var(&cfg.Autopilot.AccountsMaxDriftPct, "autopilot.accountMaxDriftPct", cfg.Autopilot.AccountsMaxDriftPct, "drift above which the autopilot resyncs an account and registers an alert, as a fraction of the balance accounts are refilled to, e.g. 0.5 - disabled if 0")
 	flag.DurationVar(&cfg.Autopilot.Heartbeat, "autopilot.heartbeat", cfg.Autopilot.Heartbeat, "interval at which autopilot loop runs")
 	flag.Float64Var(&cfg.Autopilot.MigrationHealthCutoff, "autopilot.migrationHealthCutoff", cfg.Autopilot.MigrationHealthCutoff, "health threshold below which slabs are migrated to new hosts")
 	flag.DurationVar(&cfg.Autopilot.RevisionBroadcastInterval, "autopilot.revisionBroadcastInterval", cfg.Autopilot.RevisionBroadcastInterval, "interval at which the autopilot broadcasts contract revisions to be mined - can be overwritten using the RENTERD_AUTOPILOT_REVISION_BROADCAST_INTERVAL environment variable - setting it to 0 will disable this feature")
@@ -322,6 +357,7 @@ func main() {
 	flag.DurationVar(&cfg.Autopilot.ScannerInterval, "autopilot.scannerInterval", cfg.Autopilot.ScannerInterval, "interval at which hosts are scanned")
 	flag.Uint64Var(&cfg.Autopilot.ScannerMinRecentFailures, "autopilot.scannerMinRecentFailures", cfg.Autopilot.ScannerMinRecentFailures, "minimum amount of consesutive failed scans a host must have before it is removed for exceeding the max downtime")
 	flag.Uint64Var(&cfg.Autopilot.ScannerNumThreads, "autopilot.scannerNumThreads", cfg.Autopilot.ScannerNumThreads, "number of threads that scan hosts")
+	flag.Uint64Var(&cfg.Autopilot.MigratorMaxSlabsPerMinute, "autopilot.migratorMaxSlabsPerMinute", cfg.Autopilot.MigratorMaxSlabsPerMinute, "maximum number of slabs that the autopilot schedules for migration per minute, 0 means unlimited. Can be overwritten using the RENTERD_MIGRATOR_MAX_SLABS_PER_MINUTE environment variable")
 	flag.Uint64Var(&cfg.Autopilot.MigratorParallelSlabsPerWorker, "autopilot.migratorParallelSlabsPerWorker", cfg.Autopilot.MigratorParallelSlabsPerWorker, "number of slabs that the autopilot migrates in parallel per worker. Can be overwritten using the RENTERD_MIGRATOR_PARALLEL_SLABS_PER_WORKER environment variable")
 	flag.BoolVar(&cfg.Autopilot.Enabled, "autopilot.enabled", cfg.Autopilot.Enabled, "enable/disable the autopilot - can be overwritten using the RENTERD_AUTOPILOT_ENABLED environment variable")
 	flag.DurationVar(&cfg.ShutdownTimeout, "node.shutdownTimeout", cfg.ShutdownTimeout, "the timeout applied to the node shutdown")
@@ -354,9 +390,11 @@ func main() {
 
 	// Overwrite flags from environment if set.
 	parseEnvVar("RENTERD_LOG_PATH", &cfg.Log.Path)
+	parseEnvVar("RENTERD_HTTP_LEGACY_ROUTES", &cfg.HTTP.LegacyRoutes)
 
 	parseEnvVar("RENTERD_TRACING_ENABLED", &cfg.Tracing.Enabled)
 	parseEnvVar("RENTERD_TRACING_SERVICE_INSTANCE_ID", &cfg.Tracing.InstanceID)
+	parseEnvVar("RENTERD_TRACING_DETAILED_ATTRIBUTES", &cfg.Tracing.DetailedAttributes)
 
 	parseEnvVar("RENTERD_BUS_REMOTE_ADDR", &cfg.Bus.RemoteAddr)
 	parseEnvVar("RENTERD_BUS_API_PASSWORD", &cfg.Bus.RemotePassword)
@@ -381,6 +419,7 @@ func main() {
 	parseEnvVar("RENTERD_AUTOPILOT_ENABLED", &cfg.Autopilot.Enabled)
 	parseEnvVar("RENTERD_AUTOPILOT_REVISION_BROADCAST_INTERVAL", &cfg.Autopilot.RevisionBroadcastInterval)
 	parseEnvVar("RENTERD_MIGRATOR_PARALLEL_SLABS_PER_WORKER", &cfg.Autopilot.MigratorParallelSlabsPerWorker)
+	parseEnvVar("RENTERD_MIGRATOR_MAX_SLABS_PER_MINUTE", &cfg.Autopilot.MigratorMaxSlabsPerMinute)
 
 	parseEnvVar("RENTERD_S3_ADDRESS", &cfg.S3.Address)
 	parseEnvVar("RENTERD_S3_ENABLED", &cfg.S3.Enabled)
@@ -450,19 +489,32 @@ func main() {
 		SlowThreshold:             cfg.Database.Log.SlowThreshold,
 	}
 
+	// The node is shut down in stages. First we stop accepting API requests
+	// and wait for in-flight ones to finish, then the workers are drained and
+	// flush what they recorded to the bus, after which the bus persists its
+	// accounts and closes the database. Every stage gets its own timeout.
+	const (
+		stageAPI = iota
+		stageWorkers
+		stageBus
+		stageTracing
+		numStages
+	)
+	stageNames := [numStages]string{"API", "Workers", "Bus", "Tracing"}
+
 	type shutdownFn struct {
 		name string
 		fn   func(context.Context) error
 	}
-	var shutdownFns []shutdownFn
+	var shutdownFns [numStages][]shutdownFn
 
 	// Init tracing.
 	if cfg.Tracing.Enabled {
-		fn, err := tracing.Init(cfg.Tracing.InstanceID)
+		fn, err := tracing.Init(cfg.Tracing.InstanceID, cfg.Tracing.DetailedAttributes)
 		if err != nil {
 			logger.Fatal("failed to init tracing: " + err.Error())
 		}
-		shutdownFns = append(shutdownFns, shutdownFn{
+		shutdownFns[stageTracing] = append(shutdownFns[stageTracing], shutdownFn{
 			name: "Tracing",
 			fn:   fn,
 		})
@@ -490,9 +542,11 @@ func main() {
 		sub: make(map[string]treeMux),
 	}
 
-	// Create the webserver.
+	// Create the webserver. The bus API keeps being served until the bus is
+	// shut down, all other APIs are gated so they can be drained first.
+	gate := &apiGate{}
 	srv := &http.Server{Handler: mux}
-	shutdownFns = append(shutdownFns, shutdownFn{
+	shutdownFns[stageBus] = append(shutdownFns[stageBus], shutdownFn{
 		name: "HTTP Server",
 		fn:   srv.Shutdown,
 	})
@@ -507,17 +561,17 @@ func main() {
 		if err != nil {
 			logger.Fatal("failed to create bus, err: " + err.Error())
 		}
-		shutdownFns = append(shutdownFns, shutdownFn{
+		shutdownFns[stageBus] = append(shutdownFns[stageBus], shutdownFn{
 			name: "Bus",
 			fn:   fn,
 		})
 
-		mux.sub["/api/bus"] = treeMux{h: auth(b)}
-		busAddr = cfg.HTTP.Address + "/api/bus"
+		mux.mount("/bus", auth(b), cfg.HTTP.LegacyRoutes)
+		busAddr = cfg.HTTP.Address + apiPrefix + "/bus"
 		busPassword = cfg.HTTP.Password
 
 		// only serve the UI if a bus is created
-		mux.h = renterd.Handler()
+		mux.h = gate.wrap(renterd.Handler())
 	} else {
 		logger.Info("connecting to remote bus at " + busAddr)
 	}
@@ -528,17 +582,41 @@ func main() {
 	var workers []autopilot.Worker
 	if len(cfg.Worker.Remotes) == 0 {
 		if cfg.Worker.Enabled {
+			if cfg.Worker.DownloadCacheDir == "" {
+				cfg.Worker.DownloadCacheDir = filepath.Join(cfg.Directory, "downloadcache")
+			}
 			w, fn, err := node.NewWorker(cfg.Worker, bc, getSeed(), logger)
 			if err != nil {
 				logger.Fatal("failed to create worker: " + err.Error())
 			}
-			shutdownFns = append(shutdownFns, shutdownFn{
+			shutdownFns[stageWorkers] = append(shutdownFns[stageWorkers], shutdownFn{
 				name: "Worker",
 				fn:   fn,
 			})
 
-			mux.sub["/api/worker"] = treeMux{h: workerAuth(cfg.HTTP.Password, cfg.Worker.AllowUnauthenticatedDownloads)(w)}
-			workerAddr := cfg.HTTP.Address + "/api/worker"
+			mux.mount("/worker", gate.wrap(workerAuth(cfg.HTTP.Password, cfg.Worker.AllowUnauthenticatedDownloads)(w)), cfg.HTTP.LegacyRoutes)
+			workerAddr := cfg.HTTP.Address + apiPrefix + "/worker"
+
+			// create a worker for every tenant
+			tenants := make(map[string]struct{})
+			for _, tenant := range cfg.Worker.Tenants {
+				if _, exists := tenants[tenant.ID]; exists {
+					logger.Fatal("duplicate worker tenant: " + tenant.ID)
+				}
+				tenants[tenant.ID] = struct{}{}
+
+				tw, fn, err := node.NewTenantWorker(cfg.Worker, tenant, getSeed(), logger)
+				if err != nil {
+					logger.Fatal("failed to create worker for tenant: " + err.Error())
+				}
+				shutdownFns[stageWorkers] = append(shutdownFns[stageWorkers], shutdownFn{
+					name: "Worker " + tenant.ID,
+					fn:   fn,
+				})
+
+				mux.mount("/tenants/"+tenant.ID+"/worker", gate.wrap(workerAuth(tenant.Password, cfg.Worker.AllowUnauthenticatedDownloads)(tw)), cfg.HTTP.LegacyRoutes)
+				logger.Info("serving worker for tenant " + tenant.ID + " connected to bus at " + tenant.BusAddress)
+			}
 			wc := worker.NewClient(workerAddr, cfg.HTTP.Password)
 			workers = append(workers, wc)
 
@@ -558,7 +636,7 @@ func main() {
 				if err != nil {
 					logger.Fatal("failed to create listener: " + err.Error())
 				}
-				shutdownFns = append(shutdownFns, shutdownFn{
+				shutdownFns[stageAPI] = append(shutdownFns[stageAPI], shutdownFn{
 					name: "S3",
 					fn:   s3Srv.Shutdown,
 				})
@@ -584,22 +662,29 @@ func main() {
 		}
 
 		// NOTE: the autopilot shutdown function needs to be called first.
-		shutdownFns = append(shutdownFns, shutdownFn{
+		shutdownFns[stageAPI] = append([]shutdownFn{{
 			name: "Autopilot",
 			fn:   fn,
-		})
+		}}, shutdownFns[stageAPI]...)
 
 		go func() { autopilotErr <- runFn() }()
-		mux.sub["/api/autopilot"] = treeMux{h: auth(ap)}
+		mux.mount("/autopilot", gate.wrap(auth(ap)), cfg.HTTP.LegacyRoutes)
 	}
 
+	// NOTE: the gate is shut down after the S3 server, which talks to the
+	// worker API and would otherwise fail its in-flight requests.
+	shutdownFns[stageAPI] = append(shutdownFns[stageAPI], shutdownFn{
+		name: "API",
+		fn:   gate.Shutdown,
+	})
+
 	// Start server.
 	go srv.Serve(l)
 
 	// Set initial S3 keys.
 	if cfg.S3.Enabled && !cfg.S3.DisableAuth {
 		as, err := bc.S3AuthenticationSettings(context.Background())
-		if err != nil && !strings.Contains(err.Error(), api.ErrSettingNotFound.Error()) {
+		if err != nil && !errors.Is(api.ParseError(err), api.ErrSettingNotFound) {
 			logger.Fatal("failed to fetch S3 authentication settings: " + err.Error())
 		} else if as.V4Keypairs == nil {
 			as.V4Keypairs = make(map[string]string)
@@ -642,24 +727,38 @@ func main() {
 		logger.Fatal("Fatal autopilot error: " + err.Error())
 	}
 
-	// Give each service a fraction of the total shutdown timeout. One service
+	// Give each stage a fraction of the total shutdown timeout. One stage
 	// timing out shouldn't prevent the others from attempting a shutdown.
-	timeout := cfg.ShutdownTimeout / time.Duration(len(shutdownFns))
-	shutdown := func(fn func(ctx context.Context) error) error {
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		defer cancel()
-		return fn(ctx)
+	var stages int
+	for _, fns := range shutdownFns {
+		if len(fns) > 0 {
+			stages++
+		}
 	}
+	timeout := cfg.ShutdownTimeout / time.Duration(stages)
 
-	// Shut down the autopilot first, then the rest of the services in reverse order and then
+	// Shut down the stages in order, services within a stage are shut down in
+	// the order they were registered and share the stage's timeout.
 	exitCode := 0
-	for i := len(shutdownFns) - 1; i >= 0; i-- {
-		if err := shutdown(shutdownFns[i].fn); err != nil {
-			logger.Sugar().Errorf("Failed to shut down %v: %v", shutdownFns[i].name, err)
-			exitCode = 1
-		} else {
-			logger.Sugar().Infof("%v shut down successfully", shutdownFns[i].name)
+	var failures []string
+	for stage, fns := range shutdownFns {
+		if len(fns) == 0 {
+			continue
 		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		for _, fn := range fns {
+			if err := fn.fn(ctx); err != nil {
+				logger.Sugar().Errorf("Failed to shut down %v: %v", fn.name, err)
+				failures = append(failures, fmt.Sprintf("%v (%v stage): %v", fn.name, stageNames[stage], err))
+				exitCode = 1
+			} else {
+				logger.Sugar().Infof("%v shut down successfully", fn.name)
+			}
+		}
+		cancel()
+	}
+	if len(failures) > 0 {
+		logger.Sugar().Warnf("Shutdown incomplete, the following services might not have flushed all of their state:\n%v", strings.Join(failures, "\n"))
 	}
 	logger.Info("Shutdown complete")
 	os.Exit(exitCode)
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"strings"
+	"sync"
 )
 
 type treeMux struct {
@@ -30,3 +33,77 @@ func (t treeMux) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	http.NotFound(w, req)
 }
+
+const (
+	// apiPrefix is the prefix of the versioned API routes.
+	apiPrefix = "/api/v1"
+
+	// legacyAPIPrefix is the prefix of the unversioned API routes, they are
+	// deprecated and only served if legacy routes are enabled.
+	legacyAPIPrefix = "/api"
+)
+
+// mount serves the given handler on the versioned route for the given path
+// and, if legacy is true, on the deprecated unversioned route too. The legacy
+// route keeps serializing fields using their legacy names.
+func (t treeMux) mount(path string, h http.Handler, legacy bool) {
+	t.sub[apiPrefix+path] = treeMux{h: h}
+	if legacy {
+		t.sub[legacyAPIPrefix+path] = treeMux{h: deprecated(withLegacyFieldNames(h))}
+	}
+}
+
+// deprecated wraps the given handler and marks its responses as deprecated,
+// pointing clients to the versioned API.
+func deprecated(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", apiPrefix))
+		h.ServeHTTP(w, req)
+	})
+}
+
+// apiGate wraps API handlers and allows for them to stop accepting new
+// requests while waiting for the in-flight ones to finish. This is used to
+// drain the worker and autopilot APIs on shutdown while the bus, which they
+// talk to, keeps serving requests.
+type apiGate struct {
+	mu       sync.RWMutex
+	closed   bool
+	inflight sync.WaitGroup
+}
+
+func (g *apiGate) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		g.mu.RLock()
+		if g.closed {
+			g.mu.RUnlock()
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		g.inflight.Add(1)
+		g.mu.RUnlock()
+		defer g.inflight.Done()
+		h.ServeHTTP(w, req)
+	})
+}
+
+// Shutdown stops accepting new requests and waits for all in-flight requests
+// to finish.
+func (g *apiGate) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("in-flight requests didn't finish: %w", ctx.Err())
+	case <-done:
+		return nil
+	}
+}
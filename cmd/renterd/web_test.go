@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/wallet"
+)
+
+func TestAPIGate(t *testing.T) {
+	gate := &apiGate{}
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	h := gate.wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/block" {
+			close(started)
+			<-unblock
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(path string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	// requests are served while the gate is open
+	if code := serve("/"); code != http.StatusOK {
+		t.Fatalf("unexpected status %v", code)
+	}
+
+	// start a request that blocks
+	blocked := make(chan int)
+	go func() { blocked <- serve("/block") }()
+	<-started
+
+	// shutting down times out while the request is in-flight
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := gate.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// new requests are rejected once the gate is closed
+	if code := serve("/"); code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status %v", code)
+	}
+
+	// the in-flight request is allowed to finish
+	close(unblock)
+	if code := <-blocked; code != http.StatusOK {
+		t.Fatalf("unexpected status %v", code)
+	}
+	if err := gate.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyFieldNames(t *testing.T) {
+	type response struct {
+		Hosts    []hostdb.Host           `json:"hosts"`
+		Params   api.UploadParams        `json:"params"`
+		Outputs  []wallet.SiacoinElement `json:"outputs"`
+		Alert    map[string]string       `json:"alert"`
+		Download int                     `json:"download"`
+	}
+	h := jape.Mux(map[string]jape.Handler{
+		"GET /": func(jc jape.Context) {
+			jc.Encode(response{
+				Hosts:    []hostdb.Host{{NetAddress: "foo.com:9982", Interactions: hostdb.Interactions{TotalScans: 2}}},
+				Params:   api.UploadParams{CurrentHeight: 10, GougingParams: api.GougingParams{SettingsVersion: 3}},
+				Outputs:  []wallet.SiacoinElement{{SiacoinOutput: types.SiacoinOutput{Value: types.Siacoins(1)}, MaturityHeight: 5}},
+				Alert:    map[string]string{"timestamp": "now"},
+				Download: 1 << 62,
+			})
+		},
+	})
+
+	get := func(h http.Handler) (resp map[string]interface{}) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		dec := json.NewDecoder(rec.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	object := func(v interface{}, path ...string) map[string]interface{} {
+		t.Helper()
+		for _, p := range path {
+			if arr, ok := v.([]interface{}); ok {
+				v = arr[0]
+			}
+			v = v.(map[string]interface{})[p]
+		}
+		if arr, ok := v.([]interface{}); ok {
+			v = arr[0]
+		}
+		return v.(map[string]interface{})
+	}
+
+	// assert the versioned route uses the new field names
+	resp := get(h)
+	if _, ok := object(resp, "hosts", "interactions")["totalScans"]; !ok {
+		t.Fatal("missing totalScans", resp)
+	} else if _, ok := object(resp, "params")["currentHeight"]; !ok {
+		t.Fatal("missing currentHeight", resp)
+	}
+
+	// assert the legacy route uses the legacy field names for the retagged
+	// fields only
+	resp = get(withLegacyFieldNames(h))
+	host := object(resp, "hosts")
+	if _, ok := host["netAddress"]; !ok {
+		t.Fatal("missing netAddress", host)
+	} else if _, ok := object(host, "interactions")["TotalScans"]; !ok {
+		t.Fatal("missing TotalScans", host)
+	}
+	params := object(resp, "params")
+	for _, key := range []string{"CurrentHeight", "ContractSet", "UploadPacking", "ConsensusState", "GougingSettings", "RedundancySettings", "TransactionFee", "SettingsVersion"} {
+		if _, ok := params[key]; !ok {
+			t.Fatal("missing", key, params)
+		}
+	}
+	if _, ok := object(params, "GougingSettings")["maxStoragePrice"]; !ok {
+		t.Fatal("nested fields shouldn't be renamed", params)
+	}
+	output := object(resp, "outputs")
+	if _, ok := output["MaturityHeight"]; !ok {
+		t.Fatal("missing MaturityHeight", output)
+	} else if _, ok := output["value"]; !ok {
+		t.Fatal("missing value", output)
+	}
+	if _, ok := object(resp, "alert")["timestamp"]; !ok {
+		t.Fatal("unrelated objects shouldn't be renamed", resp)
+	} else if resp["download"] != json.Number("4611686018427387904") {
+		t.Fatal("numbers should be preserved", resp["download"])
+	}
+}
@@ -28,6 +28,10 @@ type (
 	HTTP struct {
 		Address  string `yaml:"address"`
 		Password string `yaml:"password"`
+
+		// LegacyRoutes enables serving the unversioned /api routes next to
+		// the /api/v1 routes, it will be removed in the next release.
+		LegacyRoutes bool `yaml:"legacyRoutes"`
 	}
 
 	DatabaseLog struct {
@@ -43,8 +47,9 @@ type (
 
 	// Tracing contains the configuration for tracing.
 	Tracing struct {
-		Enabled    bool   `yaml:"enabled"`
-		InstanceID string `yaml:"instanceID"`
+		Enabled            bool   `yaml:"enabled"`
+		InstanceID         string `yaml:"instanceID"`
+		DetailedAttributes bool   `yaml:"detailedAttributes"`
 	}
 
 	// Bus contains the configuration for a bus.
@@ -56,6 +61,10 @@ type (
 		PersistInterval               time.Duration `yaml:"persistInterval"`
 		UsedUTXOExpiry                time.Duration `yaml:"usedUTXOExpiry"`
 		SlabBufferCompletionThreshold int64         `yaml:"slabBufferCompleionThreshold"`
+		SlabBufferMaxAge              time.Duration `yaml:"slabBufferMaxAge"`
+		DatabaseOptimizeInterval      time.Duration `yaml:"databaseOptimizeInterval"`
+		ScratchGCInterval             time.Duration `yaml:"scratchGCInterval"`
+		AlertsRetention               time.Duration `yaml:"alertsRetention"`
 	}
 
 	// Log contains the configuration for the logger.
@@ -87,31 +96,65 @@ type (
 
 	// Worker contains the configuration for a worker.
 	Worker struct {
-		Enabled                       bool           `yaml:"enabled"`
-		ID                            string         `yaml:"ID"`
-		Remotes                       []RemoteWorker `yaml:"remotes"`
-		AllowPrivateIPs               bool           `yaml:"allowPrivateIPs"`
-		BusFlushInterval              time.Duration  `yaml:"busFlushInterval"`
-		ContractLockTimeout           time.Duration  `yaml:"contractLockTimeout"`
-		DownloadOverdriveTimeout      time.Duration  `yaml:"downloadOverdriveTimeout"`
-		UploadOverdriveTimeout        time.Duration  `yaml:"uploadOverdriveTimeout"`
-		DownloadMaxOverdrive          uint64         `yaml:"downloadMaxOverdrive"`
-		UploadMaxOverdrive            uint64         `yaml:"uploadMaxOverdrive"`
-		AllowUnauthenticatedDownloads bool           `yaml:"allowUnauthenticatedDownloads"`
+		Enabled                           bool           `yaml:"enabled"`
+		ID                                string         `yaml:"ID"`
+		Remotes                           []RemoteWorker `yaml:"remotes"`
+		AllowPrivateIPs                   bool           `yaml:"allowPrivateIPs"`
+		BusFlushInterval                  time.Duration  `yaml:"busFlushInterval"`
+		ContractLockTimeout               time.Duration  `yaml:"contractLockTimeout"`
+		DownloadOverdriveTimeout          time.Duration  `yaml:"downloadOverdriveTimeout"`
+		UploadOverdriveTimeout            time.Duration  `yaml:"uploadOverdriveTimeout"`
+		UploadIdleTimeout                 time.Duration  `yaml:"uploadIdleTimeout"`
+		UploadMaxDuration                 time.Duration  `yaml:"uploadMaxDuration"`
+		DownloadMaxOverdrive              uint64         `yaml:"downloadMaxOverdrive"`
+		UploadMaxOverdrive                uint64         `yaml:"uploadMaxOverdrive"`
+		UploadMaxConcurrentSectorsPerHost uint64         `yaml:"uploadMaxConcurrentSectorsPerHost"`
+		UploadMaxSlabsAhead               uint64         `yaml:"uploadMaxSlabsAhead"`
+		UploadAutoTune                    bool           `yaml:"uploadAutoTune"`
+		DownloadCacheDir                  string         `yaml:"downloadCacheDir"`
+		DownloadCacheMaxSize              uint64         `yaml:"downloadCacheMaxSize"`
+		SectorCacheDir                    string         `yaml:"sectorCacheDir"`
+		SectorCacheMaxSize                uint64         `yaml:"sectorCacheMaxSize"`
+		UploadStagingDir                  string         `yaml:"uploadStagingDir"`
+		PriceTablePrefetchInterval        time.Duration  `yaml:"priceTablePrefetchInterval"`
+		AccountsRefillInterval            time.Duration  `yaml:"accountsRefillInterval"`
+		AccountsRefillTarget              string         `yaml:"accountsRefillTarget"`
+		AccountsRefillThreshold           string         `yaml:"accountsRefillThreshold"`
+		AllowUnauthenticatedDownloads     bool           `yaml:"allowUnauthenticatedDownloads"`
+		Tenants                           []WorkerTenant `yaml:"tenants"`
+		UploadPeers                       []RemoteWorker `yaml:"uploadPeers"`
+	}
+
+	// WorkerTenant contains the configuration for an additional bus that is
+	// served by the worker. Every tenant gets its own worker with its own keys
+	// and accounts, served under /api/tenants/<id>/worker and protected by the
+	// tenant's own password. Ids must start with a letter or digit and may
+	// only contain letters, digits, '-' and '_'.
+	WorkerTenant struct {
+		ID                string  `yaml:"id"`
+		Password          string  `yaml:"password"`
+		BusAddress        string  `yaml:"busAddress"`
+		BusPassword       string  `yaml:"busPassword"`
+		RequestsPerSecond float64 `yaml:"requestsPerSecond"`
+		RequestsBurst     int     `yaml:"requestsBurst"`
 	}
 
 	// Autopilot contains the configuration for an autopilot.
 	Autopilot struct {
-		Enabled                        bool          `yaml:"enabled"`
-		AccountsRefillInterval         time.Duration `yaml:"accountsRefillInterval"`
-		Heartbeat                      time.Duration `yaml:"heartbeat"`
-		MigrationHealthCutoff          float64       `yaml:"migrationHealthCutoff"`
-		RevisionBroadcastInterval      time.Duration `yaml:"revisionBroadcastInterval"`
-		RevisionSubmissionBuffer       uint64        `yaml:"revisionSubmissionBuffer"`
-		ScannerInterval                time.Duration `yaml:"scannerInterval"`
-		ScannerBatchSize               uint64        `yaml:"scannerBatchSize"`
-		ScannerMinRecentFailures       uint64        `yaml:"scannerMinRecentFailures"`
-		ScannerNumThreads              uint64        `yaml:"scannerNumThreads"`
-		MigratorParallelSlabsPerWorker uint64        `yaml:"migratorParallelSlabsPerWorker"`
+		Enabled                         bool          `yaml:"enabled"`
+		AccountsRefillInterval          time.Duration `yaml:"accountsRefillInterval"`
+		AccountsUnconfirmedFundingLimit string        `yaml:"accountsUnconfirmedFundingLimit"`
+		AccountsMaxDrift                string        `yaml:"accountsMaxDrift"`
+		AccountsMaxDriftPct             float64       `yaml:"accountsMaxDriftPct"`
+		Heartbeat                       time.Duration `yaml:"heartbeat"`
+		MigrationHealthCutoff           float64       `yaml:"migrationHealthCutoff"`
+		RevisionBroadcastInterval       time.Duration `yaml:"revisionBroadcastInterval"`
+		RevisionSubmissionBuffer        uint64        `yaml:"revisionSubmissionBuffer"`
+		ScannerInterval                 time.Duration `yaml:"scannerInterval"`
+		ScannerBatchSize                uint64        `yaml:"scannerBatchSize"`
+		ScannerMinRecentFailures        uint64        `yaml:"scannerMinRecentFailures"`
+		ScannerNumThreads               uint64        `yaml:"scannerNumThreads"`
+		MigratorParallelSlabsPerWorker  uint64        `yaml:"migratorParallelSlabsPerWorker"`
+		MigratorMaxSlabsPerMinute       uint64        `yaml:"migratorMaxSlabsPerMinute"`
 	}
 )
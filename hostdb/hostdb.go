@@ -1,6 +1,8 @@
 package hostdb
 
 import (
+	"net"
+	"strings"
 	"time"
 
 	"gitlab.com/NebulousLabs/encoding"
@@ -9,13 +11,14 @@ import (
 	"go.sia.tech/core/types"
 	"go.sia.tech/siad/crypto"
 	"go.sia.tech/siad/modules"
+	"golang.org/x/net/publicsuffix"
 )
 
 // Announcement represents a host announcement in a given block.
 type Announcement struct {
-	Index      types.ChainIndex
-	Timestamp  time.Time
-	NetAddress string
+	Index      types.ChainIndex `json:"index"`
+	Timestamp  time.Time        `json:"timestamp"`
+	NetAddress string           `json:"netAddress"`
 }
 
 type hostAnnouncement struct {
@@ -44,6 +47,17 @@ type PriceTableUpdateResult struct {
 	PriceTable HostPriceTable `json:"priceTable,omitempty"`
 }
 
+const (
+	// InteractionAggregatePeriod is the length of the periods interactions
+	// are aggregated by.
+	InteractionAggregatePeriod = 24 * time.Hour
+
+	// InteractionAggregatesRetention is the amount of time interaction
+	// aggregates are kept for, older interactions are only accounted for in
+	// the totals.
+	InteractionAggregatesRetention = 30 * 24 * time.Hour
+)
+
 const InteractionTypeScan = "scan"
 const InteractionTypePriceTableUpdate = "pricetableupdate"
 
@@ -86,30 +100,60 @@ func ForEachAnnouncement(b types.Block, height uint64, fn func(types.PublicKey,
 
 // Interactions contains metadata about a host's interactions.
 type Interactions struct {
-	TotalScans              uint64
-	LastScan                time.Time
-	LastScanSuccess         bool
-	SecondToLastScanSuccess bool
-	Uptime                  time.Duration
-	Downtime                time.Duration
+	TotalScans              uint64        `json:"totalScans"`
+	LastScan                time.Time     `json:"lastScan"`
+	LastScanSuccess         bool          `json:"lastScanSuccess"`
+	SecondToLastScanSuccess bool          `json:"secondToLastScanSuccess"`
+	Uptime                  time.Duration `json:"uptime"`
+	Downtime                time.Duration `json:"downtime"`
+
+	SuccessfulInteractions float64 `json:"successfulInteractions"`
+	FailedInteractions     float64 `json:"failedInteractions"`
+
+	// MissedProofs is the number of our contracts for which the host failed
+	// to submit a storage proof, LastMissedProof is the time we noticed the
+	// most recent one.
+	MissedProofs    uint64    `json:"missedProofs"`
+	LastMissedProof time.Time `json:"lastMissedProof"`
+
+	// Aggregates contains the successful and failed interactions per period
+	// over the retention window, sorted by period. Together with the totals
+	// above they allow for weighing recent interactions more heavily.
+	Aggregates []InteractionAggregate `json:"aggregates,omitempty"`
+}
+
+// InteractionAggregate contains the number of successful and failed
+// interactions with a host within the period starting at the given time.
+type InteractionAggregate struct {
+	Period                 time.Time `json:"period"`
+	SuccessfulInteractions float64   `json:"successfulInteractions"`
+	FailedInteractions     float64   `json:"failedInteractions"`
+}
 
-	SuccessfulInteractions float64
-	FailedInteractions     float64
+// HostPerformance contains the upload and download performance of a host as
+// observed by the workers, speeds are in megabits per second and latencies are
+// the 90th percentile of the time it takes to transfer a sector. A zero value
+// means the workers didn't observe any transfers.
+type HostPerformance struct {
+	UploadSpeedMBPS      float64 `json:"uploadSpeedMBPS"`
+	UploadLatencyP90MS   float64 `json:"uploadLatencyP90MS"`
+	DownloadSpeedMBPS    float64 `json:"downloadSpeedMBPS"`
+	DownloadLatencyP90MS float64 `json:"downloadLatencyP90MS"`
 }
 
 type HostScan struct {
-	HostKey    types.PublicKey `json:"hostKey"`
-	Success    bool
-	Timestamp  time.Time
-	Settings   rhpv2.HostSettings
-	PriceTable rhpv3.HostPriceTable
+	HostKey    types.PublicKey      `json:"hostKey"`
+	Success    bool                 `json:"success"`
+	Timestamp  time.Time            `json:"timestamp"`
+	Settings   rhpv2.HostSettings   `json:"settings"`
+	PriceTable rhpv3.HostPriceTable `json:"priceTable"`
 }
 
 type PriceTableUpdate struct {
 	HostKey    types.PublicKey `json:"hostKey"`
-	Success    bool
-	Timestamp  time.Time
-	PriceTable HostPriceTable
+	Success    bool            `json:"success"`
+	Timestamp  time.Time       `json:"timestamp"`
+	PriceTable HostPriceTable  `json:"priceTable"`
 }
 
 // HostAddress contains the address of a specific host identified by a public
@@ -128,7 +172,19 @@ type Host struct {
 	PriceTable       HostPriceTable     `json:"priceTable"`
 	Settings         rhpv2.HostSettings `json:"settings"`
 	Interactions     Interactions       `json:"interactions"`
+	Performance      HostPerformance    `json:"performance"`
+	AliasGroup       types.Hash256      `json:"aliasGroup"`
 	Scanned          bool               `json:"scanned"`
+
+	// Tags contains the tags set by the operator and the tags derived from
+	// the host's net address, see EnrichTags.
+	Tags []string `json:"tags,omitempty"`
+
+	// Notes and ScoreModifier are set by the operator to record knowledge
+	// about the host the autopilot can't know, the modifier adjusts the
+	// host's score by the given fraction, e.g. 0.2 increases it by 20%.
+	Notes         string  `json:"notes,omitempty"`
+	ScoreModifier float64 `json:"scoreModifier,omitempty"`
 }
 
 // A HostPriceTable extends the host price table with its expiry.
@@ -148,6 +204,69 @@ func (h Host) IsAnnounced() bool {
 	return !h.LastAnnouncement.IsZero()
 }
 
+// SplitTag splits a host tag into its key and value. Tags are of the form
+// 'key:value', e.g. 'region:eu', and are used to group hosts into failure
+// domains.
+func SplitTag(tag string) (key, value string) {
+	key, value, _ = strings.Cut(tag, ":")
+	return
+}
+
+// EnrichTags adds the tags that are derived automatically from the host's net
+// address to the given tags. Currently that's the 'domain' tag, which groups
+// hosts by the registered domain they announced, e.g. 'domain:example.com'
+// for 'host1.eu.example.com:9982'. Tags that are set manually take precedence
+// over the derived ones.
+func EnrichTags(netAddress string, tags []string) []string {
+	hostname, _, err := net.SplitHostPort(netAddress)
+	if err != nil || net.ParseIP(hostname) != nil {
+		return tags
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(hostname))
+	if err != nil {
+		return tags
+	}
+	for _, tag := range tags {
+		if key, _ := SplitTag(tag); key == "domain" {
+			return tags
+		}
+	}
+	return append(tags, "domain:"+domain)
+}
+
+// AliasGroup returns an identifier that is shared by hosts that are likely the
+// same physical host announced under different keys, i.e. hosts that announced
+// the same hostname and are configured with identical settings. Settings that
+// change over time, like the remaining storage, or that necessarily differ
+// between hosts on the same machine, like the ports, are not taken into
+// account.
+func AliasGroup(netAddress string, s rhpv2.HostSettings) types.Hash256 {
+	hostname, _, err := net.SplitHostPort(netAddress)
+	if err != nil {
+		hostname = netAddress
+	}
+
+	h := types.NewHasher()
+	h.E.WriteString(strings.ToLower(hostname))
+	h.E.WriteUint64(s.MaxDownloadBatchSize)
+	h.E.WriteUint64(s.MaxDuration)
+	h.E.WriteUint64(s.MaxReviseBatchSize)
+	h.E.WriteUint64(s.SectorSize)
+	h.E.WriteUint64(s.WindowSize)
+	s.Collateral.EncodeTo(h.E)
+	s.MaxCollateral.EncodeTo(h.E)
+	s.BaseRPCPrice.EncodeTo(h.E)
+	s.ContractPrice.EncodeTo(h.E)
+	s.DownloadBandwidthPrice.EncodeTo(h.E)
+	s.SectorAccessPrice.EncodeTo(h.E)
+	s.StoragePrice.EncodeTo(h.E)
+	s.UploadBandwidthPrice.EncodeTo(h.E)
+	h.E.WriteUint64(uint64(s.EphemeralAccountExpiry))
+	s.MaxEphemeralAccountBalance.EncodeTo(h.E)
+	h.E.WriteString(s.Version)
+	return h.Sum()
+}
+
 // IsOnline returns whether a host is considered online.
 func (h Host) IsOnline() bool {
 	if h.Interactions.TotalScans == 0 {
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"time"
 
 	"gitlab.com/NebulousLabs/encoding"
@@ -31,6 +32,7 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/crypto/blake2b"
+	"golang.org/x/time/rate"
 	"gorm.io/gorm"
 )
 
@@ -232,7 +234,8 @@ func NewBus(cfg BusConfig, dir string, seed types.PrivateKey, l *zap.Logger) (ht
 	sqlLogger := stores.NewSQLLogger(l.Named("db"), cfg.DBLoggerConfig)
 	walletAddr := wallet.StandardAddress(seed.PublicKey())
 	sqlStoreDir := filepath.Join(dir, "partial_slabs")
-	sqlStore, ccid, err := stores.NewSQLStore(dbConn, alerts.WithOrigin(alertsMgr, "bus"), sqlStoreDir, true, cfg.PersistInterval, walletAddr, cfg.SlabBufferCompletionThreshold, l.Sugar(), sqlLogger)
+	deriveChangeAddr := func(index uint64) types.Address { return wallet.DeriveChangeAddress(seed, index) }
+	sqlStore, ccid, err := stores.NewSQLStore(dbConn, alerts.WithOrigin(alertsMgr, "bus"), sqlStoreDir, true, cfg.PersistInterval, walletAddr, deriveChangeAddr, cfg.SlabBufferCompletionThreshold, cfg.SlabBufferMaxAge, l.Sugar(), sqlLogger)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -244,6 +247,11 @@ func NewBus(cfg BusConfig, dir string, seed types.PrivateKey, l *zap.Logger) (ht
 	// Hook up webhooks to alerts.
 	alertsMgr.RegisterWebhookBroadcaster(hooksMgr)
 
+	// Persist alerts in the database.
+	if err := alertsMgr.RegisterStore(sqlStore, cfg.AlertsRetention, l.Named("alerts").Sugar()); err != nil {
+		return nil, nil, err
+	}
+
 	cancelSubscribe := make(chan struct{})
 	go func() {
 		subscribeErr := cs.ConsensusSetSubscribe(sqlStore, ccid, cancelSubscribe)
@@ -272,21 +280,21 @@ func NewBus(cfg BusConfig, dir string, seed types.PrivateKey, l *zap.Logger) (ht
 		tp.TransactionPoolSubscribe(m)
 	}
 
-	b, err := bus.New(syncer{g, tp}, alertsMgr, hooksMgr, chainManager{cs: cs, network: cfg.Network}, txpool{tp}, w, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, l)
+	b, err := bus.New(syncer{g, tp}, alertsMgr, hooksMgr, chainManager{cs: cs, network: cfg.Network}, txpool{tp}, w, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, cfg.DatabaseOptimizeInterval, cfg.ScratchGCInterval, l)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// NOTE: the bus is shut down before the consensus set and the database
+	// are closed, that way it can still persist its accounts.
 	shutdownFn := func(ctx context.Context) error {
+		close(cancelSubscribe)
+		busErr := b.Shutdown(ctx)
 		return errors.Join(
-			func() error {
-				close(cancelSubscribe)
-				return nil
-			}(),
+			busErr,
 			g.Close(),
 			cs.Close(),
 			tp.Close(),
-			b.Shutdown(ctx),
 			sqlStore.Close(),
 		)
 	}
@@ -294,8 +302,19 @@ func NewBus(cfg BusConfig, dir string, seed types.PrivateKey, l *zap.Logger) (ht
 }
 
 func NewWorker(cfg config.Worker, b worker.Bus, seed types.PrivateKey, l *zap.Logger) (http.Handler, ShutdownFn, error) {
+	wc, err := workerConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// NOTE: upload peers need to share our bus and seed, the slabs they upload
+	// are added to our objects using the contracts of our bus
+	for _, peer := range cfg.UploadPeers {
+		wc.UploadPeers = append(wc.UploadPeers, worker.NewClient(peer.Address, peer.Password))
+	}
+
 	workerKey := blake2b.Sum256(append([]byte("worker"), seed...))
-	w, err := worker.New(workerKey, cfg.ID, b, cfg.ContractLockTimeout, cfg.BusFlushInterval, cfg.DownloadOverdriveTimeout, cfg.UploadOverdriveTimeout, cfg.DownloadMaxOverdrive, cfg.UploadMaxOverdrive, cfg.AllowPrivateIPs, l)
+	w, err := worker.New(workerKey, b, wc, l)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -303,8 +322,141 @@ func NewWorker(cfg config.Worker, b worker.Bus, seed types.PrivateKey, l *zap.Lo
 	return w.Handler(), w.Shutdown, nil
 }
 
+// accountsRefillBalances parses the balance the worker refills its accounts
+// to and the balance below which it does so, the threshold defaults to half of
+// the target.
+// workerConfig converts the worker's configuration into the config of the
+// worker package, upload peers are not included.
+func workerConfig(cfg config.Worker) (worker.Config, error) {
+	wc := worker.Config{
+		ID:                                cfg.ID,
+		AllowPrivateIPs:                   cfg.AllowPrivateIPs,
+		BusFlushInterval:                  cfg.BusFlushInterval,
+		ContractLockTimeout:               cfg.ContractLockTimeout,
+		DownloadOverdriveTimeout:          cfg.DownloadOverdriveTimeout,
+		DownloadMaxOverdrive:              cfg.DownloadMaxOverdrive,
+		DownloadCacheDir:                  cfg.DownloadCacheDir,
+		DownloadCacheMaxSize:              cfg.DownloadCacheMaxSize,
+		SectorCacheDir:                    cfg.SectorCacheDir,
+		SectorCacheMaxSize:                cfg.SectorCacheMaxSize,
+		UploadOverdriveTimeout:            cfg.UploadOverdriveTimeout,
+		UploadIdleTimeout:                 cfg.UploadIdleTimeout,
+		UploadMaxDuration:                 cfg.UploadMaxDuration,
+		UploadMaxOverdrive:                cfg.UploadMaxOverdrive,
+		UploadMaxConcurrentSectorsPerHost: cfg.UploadMaxConcurrentSectorsPerHost,
+		UploadMaxSlabsAhead:               cfg.UploadMaxSlabsAhead,
+		UploadAutoTune:                    cfg.UploadAutoTune,
+		UploadStagingDir:                  cfg.UploadStagingDir,
+		PriceTablePrefetchInterval:        cfg.PriceTablePrefetchInterval,
+		AccountsRefillInterval:            cfg.AccountsRefillInterval,
+	}
+	if cfg.AccountsRefillInterval == 0 {
+		return wc, nil
+	} else if cfg.AccountsRefillTarget == "" {
+		return worker.Config{}, errors.New("accounts refill target can't be empty")
+	}
+	target, err := types.ParseCurrency(cfg.AccountsRefillTarget)
+	if err != nil {
+		return worker.Config{}, fmt.Errorf("failed to parse accounts refill target: %w", err)
+	}
+	threshold := target.Div64(2)
+	if cfg.AccountsRefillThreshold != "" {
+		threshold, err = types.ParseCurrency(cfg.AccountsRefillThreshold)
+		if err != nil {
+			return worker.Config{}, fmt.Errorf("failed to parse accounts refill threshold: %w", err)
+		}
+	}
+	wc.AccountsRefillTarget, wc.AccountsRefillThreshold = target, threshold
+	return wc, nil
+}
+
+// tenantIDRegex matches the ids tenants may use, the id is used both in the
+// tenant's route and in the names of its cache and staging directories.
+var tenantIDRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,63}$`)
+
+// NewTenantWorker creates a worker that serves the given tenant's bus. The
+// worker's keys are derived from both the seed and the tenant's id so tenants
+// never share renter keys or ephemeral accounts.
+func NewTenantWorker(cfg config.Worker, tenant config.WorkerTenant, seed types.PrivateKey, l *zap.Logger) (http.Handler, ShutdownFn, error) {
+	if tenant.ID == "" {
+		return nil, nil, errors.New("tenant id can't be empty")
+	} else if !tenantIDRegex.MatchString(tenant.ID) {
+		return nil, nil, fmt.Errorf("invalid tenant id '%v', ids must start with a letter or digit and only contain letters, digits, '-' and '_'", tenant.ID)
+	} else if tenant.Password == "" {
+		return nil, nil, fmt.Errorf("tenant '%v' has no password", tenant.ID)
+	} else if tenant.BusAddress == "" {
+		return nil, nil, fmt.Errorf("tenant '%v' has no bus address", tenant.ID)
+	}
+
+	wc, err := workerConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	wc.ID = fmt.Sprintf("%s-%s", cfg.ID, tenant.ID)
+	if wc.DownloadCacheDir != "" {
+		wc.DownloadCacheDir = filepath.Join(wc.DownloadCacheDir, tenant.ID)
+	}
+	if wc.SectorCacheDir != "" {
+		wc.SectorCacheDir = filepath.Join(wc.SectorCacheDir, tenant.ID)
+	}
+	if wc.UploadStagingDir != "" {
+		wc.UploadStagingDir = filepath.Join(wc.UploadStagingDir, tenant.ID)
+	}
+
+	workerKey := tenantWorkerKey(seed, tenant.ID)
+	b := bus.NewClient(tenant.BusAddress, tenant.BusPassword)
+	w, err := worker.New(workerKey, b, wc, l.Named(tenant.ID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := w.Handler()
+	if tenant.RequestsPerSecond > 0 {
+		h = rateLimit(h, tenant.RequestsPerSecond, tenant.RequestsBurst)
+	}
+	return h, w.Shutdown, nil
+}
+
+// tenantWorkerKey derives the key of the worker that serves the tenant with
+// the given id.
+func tenantWorkerKey(seed types.PrivateKey, id string) [32]byte {
+	return blake2b.Sum256(append([]byte("worker"+id), seed...))
+}
+
+// rateLimit wraps the handler and rejects requests that exceed the given rate.
+func rateLimit(h http.Handler, rps float64, burst int) http.Handler {
+	if burst < 1 {
+		burst = 1
+	}
+	limiter := rate.NewLimiter(rate.Limit(rps), burst)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !limiter.Allow() {
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
 func NewAutopilot(cfg AutopilotConfig, b autopilot.Bus, workers []autopilot.Worker, l *zap.Logger) (http.Handler, RunFn, ShutdownFn, error) {
-	ap, err := autopilot.New(cfg.ID, b, workers, l, cfg.Heartbeat, cfg.ScannerInterval, cfg.ScannerBatchSize, cfg.ScannerMinRecentFailures, cfg.ScannerNumThreads, cfg.MigrationHealthCutoff, cfg.AccountsRefillInterval, cfg.RevisionSubmissionBuffer, cfg.MigratorParallelSlabsPerWorker, cfg.RevisionBroadcastInterval)
+	var unconfirmedFundingLimit types.Currency
+	if cfg.AccountsUnconfirmedFundingLimit != "" {
+		var err error
+		unconfirmedFundingLimit, err = types.ParseCurrency(cfg.AccountsUnconfirmedFundingLimit)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse unconfirmed funding limit: %w", err)
+		}
+	}
+	var maxDrift types.Currency
+	if cfg.AccountsMaxDrift != "" {
+		var err error
+		maxDrift, err = types.ParseCurrency(cfg.AccountsMaxDrift)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse max drift: %w", err)
+		}
+	}
+
+	ap, err := autopilot.New(cfg.ID, b, workers, l, cfg.Heartbeat, cfg.ScannerInterval, cfg.ScannerBatchSize, cfg.ScannerMinRecentFailures, cfg.ScannerNumThreads, cfg.MigrationHealthCutoff, cfg.AccountsRefillInterval, unconfirmedFundingLimit, maxDrift, cfg.AccountsMaxDriftPct, cfg.RevisionSubmissionBuffer, cfg.MigratorParallelSlabsPerWorker, cfg.MigratorMaxSlabsPerMinute, cfg.RevisionBroadcastInterval)
 	if err != nil {
 		return nil, nil, nil, err
 	}
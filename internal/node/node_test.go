@@ -0,0 +1,69 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/config"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestNewTenantWorker(t *testing.T) {
+	tenant := config.WorkerTenant{
+		ID:          "tenant",
+		Password:    "password",
+		BusAddress:  "http://localhost:9980/api/bus",
+		BusPassword: "bus",
+	}
+
+	// assert tenants are validated
+	for _, invalid := range []func(config.WorkerTenant) config.WorkerTenant{
+		func(t config.WorkerTenant) config.WorkerTenant { t.ID = ""; return t },
+		func(t config.WorkerTenant) config.WorkerTenant { t.ID = ".."; return t },
+		func(t config.WorkerTenant) config.WorkerTenant { t.ID = "a/../b"; return t },
+		func(t config.WorkerTenant) config.WorkerTenant { t.ID = "-tenant"; return t },
+		func(t config.WorkerTenant) config.WorkerTenant { t.Password = ""; return t },
+		func(t config.WorkerTenant) config.WorkerTenant { t.BusAddress = ""; return t },
+	} {
+		if _, _, err := NewTenantWorker(config.Worker{}, invalid(tenant), types.GeneratePrivateKey(), zap.NewNop()); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	// assert tenants never share keys with each other or the worker
+	seed := types.GeneratePrivateKey()
+	key := blake2b.Sum256(append([]byte("worker"), seed...))
+	key1, key2 := tenantWorkerKey(seed, "tenant1"), tenantWorkerKey(seed, "tenant2")
+	if key1 == key2 || key1 == key || key2 == key {
+		t.Fatal("expected tenant keys to be unique")
+	} else if tenantWorkerKey(seed, "tenant1") != key1 {
+		t.Fatal("expected tenant key to be deterministic")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	h := rateLimit(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), 0.001, 2)
+
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	// assert requests within the burst are served
+	for i := 0; i < 2; i++ {
+		if code := serve(); code != http.StatusOK {
+			t.Fatalf("unexpected status %v", code)
+		}
+	}
+
+	// assert the next request is rejected
+	if code := serve(); code != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status %v", code)
+	}
+}
@@ -943,15 +943,16 @@ func testApCfg() node.AutopilotConfig {
 	return node.AutopilotConfig{
 		ID: api.DefaultAutopilotID,
 		Autopilot: config.Autopilot{
-			AccountsRefillInterval:         time.Second,
-			Heartbeat:                      time.Second,
-			MigrationHealthCutoff:          0.99,
-			MigratorParallelSlabsPerWorker: 1,
-			RevisionSubmissionBuffer:       0,
-			ScannerInterval:                time.Second,
-			ScannerBatchSize:               10,
-			ScannerNumThreads:              1,
-			ScannerMinRecentFailures:       5,
+			AccountsRefillInterval:          time.Second,
+			AccountsUnconfirmedFundingLimit: "1SC",
+			Heartbeat:                       time.Second,
+			MigrationHealthCutoff:           0.99,
+			MigratorParallelSlabsPerWorker:  1,
+			RevisionSubmissionBuffer:        0,
+			ScannerInterval:                 time.Second,
+			ScannerBatchSize:                10,
+			ScannerNumThreads:               1,
+			ScannerMinRecentFailures:        5,
 		},
 	}
 }
@@ -1856,7 +1856,7 @@ func TestMultipartUploads(t *testing.T) {
 	}
 
 	// List uploads
-	lmu, err := b.MultipartUploads(context.Background(), api.DefaultBucketName, "/f", "", "", 0)
+	lmu, err := b.MultipartUploads(context.Background(), api.DefaultBucketName, "/f", "", "", "", 0)
 	tt.OK(err)
 	if len(lmu.Uploads) != 1 {
 		t.Fatal("expected 1 upload got", len(lmu.Uploads))
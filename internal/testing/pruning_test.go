@@ -215,12 +215,16 @@ func TestSectorPruning(t *testing.T) {
 		tt.OK(b.DeleteObject(context.Background(), api.DefaultBucketName, filename, api.DeleteObjectOptions{}))
 	}
 
-	// assert amount of prunable data
-	res, err = b.PrunableData(context.Background())
-	tt.OK(err)
-	if res.TotalPrunable != uint64(math.Ceil(float64(numObjects)/2))*uint64(rs.TotalShards)*rhpv2.SectorSize {
-		t.Fatal("unexpected prunable data", n)
-	}
+	// assert amount of prunable data, the slabs of the deleted objects are
+	// pruned in the background
+	tt.Retry(10, 100*time.Millisecond, func() error {
+		res, err := b.PrunableData(context.Background())
+		tt.OK(err)
+		if res.TotalPrunable != uint64(math.Ceil(float64(numObjects)/2))*uint64(rs.TotalShards)*rhpv2.SectorSize {
+			return fmt.Errorf("unexpected prunable data: %d", res.TotalPrunable)
+		}
+		return nil
+	})
 
 	// prune all contracts
 	for _, c := range contracts {
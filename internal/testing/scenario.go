@@ -0,0 +1,254 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"lukechampine.com/frand"
+)
+
+type (
+	// scenario describes a sequence of steps that is executed against a test
+	// cluster, it allows for describing complex autopilot behaviour like
+	// "form 5 contracts, kill 2 hosts, advance 100 blocks, expect migrations
+	// and alerts" in a couple of lines.
+	//
+	//	newScenario("migrations").
+	//		FormContracts(5).
+	//		Upload("foo", rhpv2.SectorSize).
+	//		RemoveHosts(2).
+	//		MineUntilRemovedContractsExpire().
+	//		ExpectMigrated("foo").
+	//		ExpectAlert("contract").
+	//		Run(t)
+	scenario struct {
+		name  string
+		opts  testClusterOptions
+		steps []scenarioStep
+	}
+
+	scenarioStep struct {
+		desc string
+		fn   func(s *scenarioState)
+	}
+
+	// scenarioState is the state that is shared between the steps of a
+	// scenario.
+	scenarioState struct {
+		cluster *TestCluster
+		tt      *TT
+
+		// removed contains the hosts that were removed from the cluster
+		removed map[types.PublicKey]struct{}
+
+		// uploads contains the data of the objects that were uploaded
+		uploads map[string][]byte
+	}
+)
+
+// newScenario creates a new scenario with the given name.
+func newScenario(name string) *scenario {
+	return &scenario{name: name}
+}
+
+// WithOptions sets the options of the cluster the scenario is executed
+// against.
+func (s *scenario) WithOptions(opts testClusterOptions) *scenario {
+	s.opts = opts
+	return s
+}
+
+// Step adds a custom step to the scenario.
+func (s *scenario) Step(desc string, fn func(c *TestCluster)) *scenario {
+	return s.step(desc, func(st *scenarioState) { fn(st.cluster) })
+}
+
+// AddHosts adds n hosts to the cluster and waits until the autopilot formed
+// contracts with them.
+func (s *scenario) AddHosts(n int) *scenario {
+	return s.step(fmt.Sprintf("add %d hosts", n), func(st *scenarioState) {
+		st.cluster.AddHostsBlocking(n)
+	})
+}
+
+// FormContracts updates the autopilot to form n contracts, adds the hosts that
+// are needed to do so and waits until the contract set contains n contracts.
+func (s *scenario) FormContracts(n int) *scenario {
+	return s.step(fmt.Sprintf("form %d contracts", n), func(st *scenarioState) {
+		cfg, _ := st.cluster.AutopilotConfig(context.Background())
+		cfg.Contracts.Amount = uint64(n)
+		st.cluster.UpdateAutopilotConfig(context.Background(), cfg)
+		if missing := n - len(st.cluster.hosts); missing > 0 {
+			st.cluster.AddHostsBlocking(missing)
+		}
+		st.cluster.WaitForContractSet(cfg.Contracts.Set, n)
+	})
+}
+
+// RemoveHosts shuts down n hosts, hosts that store data of uploaded objects
+// are removed first.
+func (s *scenario) RemoveHosts(n int) *scenario {
+	return s.step(fmt.Sprintf("remove %d hosts", n), func(st *scenarioState) {
+		used := make(map[types.PublicKey]struct{})
+		for path := range st.uploads {
+			for hk := range st.usedHosts(path) {
+				used[hk] = struct{}{}
+			}
+		}
+
+		var hosts []*Host
+		for _, h := range st.cluster.hosts {
+			if _, ok := used[h.PublicKey()]; ok {
+				hosts = append(hosts, h)
+			}
+		}
+		for _, h := range st.cluster.hosts {
+			if _, ok := used[h.PublicKey()]; !ok {
+				hosts = append(hosts, h)
+			}
+		}
+		if len(hosts) < n {
+			st.tt.Fatalf("can't remove %d hosts, the cluster only has %d", n, len(hosts))
+		}
+
+		for _, h := range hosts[:n] {
+			st.cluster.RemoveHost(h)
+			st.removed[h.PublicKey()] = struct{}{}
+		}
+	})
+}
+
+// MineBlocks advances the chain by n blocks.
+func (s *scenario) MineBlocks(n int) *scenario {
+	return s.step(fmt.Sprintf("mine %d blocks", n), func(st *scenarioState) {
+		st.cluster.MineBlocks(n)
+	})
+}
+
+// MineUntilRemovedContractsExpire advances the chain until the contracts with
+// the removed hosts expired.
+func (s *scenario) MineUntilRemovedContractsExpire() *scenario {
+	return s.step("mine until the contracts with removed hosts expire", func(st *scenarioState) {
+		contracts, err := st.cluster.Bus.Contracts(context.Background())
+		st.tt.OK(err)
+		var endHeight uint64
+		for _, c := range contracts {
+			if _, removed := st.removed[c.HostKey]; removed && c.WindowEnd > endHeight {
+				endHeight = c.WindowEnd
+			}
+		}
+
+		cs, err := st.cluster.Bus.ConsensusState(context.Background())
+		st.tt.OK(err)
+		if endHeight >= cs.BlockHeight {
+			st.cluster.MineBlocks(int(endHeight - cs.BlockHeight + 1))
+		}
+	})
+}
+
+// Upload uploads an object of the given size filled with random data.
+func (s *scenario) Upload(path string, size int) *scenario {
+	return s.step(fmt.Sprintf("upload %d bytes to '%s'", size, path), func(st *scenarioState) {
+		data := frand.Bytes(size)
+		_, err := st.cluster.Worker.UploadObject(context.Background(), bytes.NewReader(data), api.DefaultBucketName, path, api.UploadObjectOptions{})
+		st.tt.OK(err)
+		st.uploads[path] = data
+	})
+}
+
+// ExpectContracts waits until the contract set contains n contracts.
+func (s *scenario) ExpectContracts(n int) *scenario {
+	return s.step(fmt.Sprintf("expect %d contracts", n), func(st *scenarioState) {
+		cfg, _ := st.cluster.AutopilotConfig(context.Background())
+		st.cluster.WaitForContractSet(cfg.Contracts.Set, n)
+	})
+}
+
+// ExpectMigrated waits until the given object no longer stores data on any of
+// the removed hosts and asserts it can still be downloaded. A block is mined
+// between every attempt to trigger the autopilot.
+func (s *scenario) ExpectMigrated(path string) *scenario {
+	return s.step(fmt.Sprintf("expect '%s' to be migrated", path), func(st *scenarioState) {
+		st.tt.Retry(300, 100*time.Millisecond, func() error {
+			for hk := range st.usedHosts(path) {
+				if _, removed := st.removed[hk]; removed {
+					st.cluster.MineBlocks(1)
+					return fmt.Errorf("object '%s' is still stored on removed host %v", path, hk)
+				}
+			}
+			return nil
+		})
+
+		var buf bytes.Buffer
+		st.tt.OK(st.cluster.Worker.DownloadObject(context.Background(), &buf, api.DefaultBucketName, path, api.DownloadObjectOptions{}))
+		if !bytes.Equal(buf.Bytes(), st.uploads[path]) {
+			st.tt.Fatalf("downloaded data of '%s' doesn't match the uploaded data", path)
+		}
+	})
+}
+
+// ExpectAlert waits until an alert is registered whose message contains the
+// given string.
+func (s *scenario) ExpectAlert(msg string) *scenario {
+	return s.step(fmt.Sprintf("expect alert '%s'", msg), func(st *scenarioState) {
+		st.tt.Retry(100, 100*time.Millisecond, func() error {
+			alerts, err := st.cluster.Bus.Alerts()
+			if err != nil {
+				return err
+			}
+			for _, a := range alerts {
+				if strings.Contains(a.Message, msg) {
+					return nil
+				}
+			}
+			return errors.New("alert not found")
+		})
+	})
+}
+
+// Run executes the scenario against a new test cluster.
+func (s *scenario) Run(t *testing.T) {
+	t.Helper()
+	cluster := newTestCluster(t, s.opts)
+	defer cluster.Shutdown()
+
+	st := &scenarioState{
+		cluster: cluster,
+		tt:      cluster.tt,
+		removed: make(map[types.PublicKey]struct{}),
+		uploads: make(map[string][]byte),
+	}
+	for i, step := range s.steps {
+		t.Logf("%s: step %d/%d: %s", s.name, i+1, len(s.steps), step.desc)
+		step.fn(st)
+	}
+}
+
+func (s *scenario) step(desc string, fn func(st *scenarioState)) *scenario {
+	s.steps = append(s.steps, scenarioStep{desc: desc, fn: fn})
+	return s
+}
+
+// usedHosts returns the hosts that store data of the object at the given path.
+func (st *scenarioState) usedHosts(path string) map[types.PublicKey]struct{} {
+	res, err := st.cluster.Bus.Object(context.Background(), api.DefaultBucketName, path, api.GetObjectOptions{})
+	st.tt.OK(err)
+	if res.Object == nil {
+		st.tt.Fatalf("object '%s' not found", path)
+	}
+
+	used := make(map[types.PublicKey]struct{})
+	for _, slab := range res.Object.Slabs {
+		for _, sector := range slab.Shards {
+			used[sector.Host] = struct{}{}
+		}
+	}
+	return used
+}
@@ -0,0 +1,29 @@
+package testing
+
+import (
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+)
+
+func TestScenarioMigrations(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	// form one more contract than the total shards, remove a host storing
+	// data and assert the object is migrated to the spare host and the
+	// removal of the contract from the set is alerted
+	cfg := testAutopilotConfig
+	cfg.Contracts.Amount = uint64(testRedundancySettings.TotalShards) + 1
+	newScenario("migrations").
+		WithOptions(testClusterOptions{autopilotSettings: &cfg}).
+		FormContracts(testRedundancySettings.TotalShards+1).
+		Upload("foo", rhpv2.SectorSize).
+		RemoveHosts(1).
+		MineUntilRemovedContractsExpire().
+		ExpectMigrated("foo").
+		ExpectContracts(testRedundancySettings.TotalShards).
+		ExpectAlert("0 contracts added and 1 removed").
+		Run(t)
+}
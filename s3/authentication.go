@@ -2,6 +2,7 @@ package s3
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -41,6 +42,10 @@ type (
 		ListParts               bool
 		AbortMultipartUpload    bool
 		CompleteMultipartUpload bool
+
+		// MaxObjectSize is the maximum size of an object that can be
+		// uploaded, 0 means unlimited.
+		MaxObjectSize uint64
 	}
 
 	contextKey int
@@ -89,7 +94,7 @@ func newAuthenticatedBackend(b *s3) *authenticatedBackend {
 
 func (b *authenticatedBackend) applyBucketPolicy(ctx context.Context, bucketName string, p *permissions) error {
 	bucket, err := b.backend.b.Bucket(ctx, bucketName)
-	if err != nil && strings.Contains(err.Error(), api.ErrBucketNotFound.Error()) {
+	if err != nil && errors.Is(api.ParseError(err), api.ErrBucketNotFound) {
 		return gofakes3.BucketNotFound(bucketName)
 	} else if err != nil {
 		return gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
@@ -114,12 +119,35 @@ func (b *authenticatedBackend) permsFromCtx(ctx context.Context, bucket string)
 	return perms
 }
 
-func (b *authenticatedBackend) reloadV4Keys(ctx context.Context) error {
+func (b *authenticatedBackend) reloadV4Keys(ctx context.Context) (api.S3AuthenticationSettings, error) {
 	as, err := b.backend.b.S3AuthenticationSettings(ctx)
 	if err != nil {
-		return err
+		return api.S3AuthenticationSettings{}, err
 	}
 	signature.ReloadKeys(as.V4Keypairs)
+	return as, nil
+}
+
+// accessKeyID returns the access key of the credential in the authorization
+// header of a v4 signed request.
+func accessKeyID(rq *http.Request) string {
+	_, params, _ := strings.Cut(rq.Header.Get("Authorization"), " ")
+	for _, param := range strings.Split(params, ",") {
+		credential, ok := strings.CutPrefix(strings.TrimSpace(param), "Credential=")
+		if ok {
+			accessKey, _, _ := strings.Cut(credential, "/")
+			return accessKey
+		}
+	}
+	return ""
+}
+
+// checkObjectSize returns an error if an object of the given size exceeds the
+// max object size of the permissions.
+func (p permissions) checkObjectSize(ctx context.Context, size int64) error {
+	if p.MaxObjectSize > 0 && size > 0 && uint64(size) > p.MaxObjectSize {
+		return entityTooLarge(ctx, fmt.Sprintf("object of %d bytes exceeds the keypair's max object size of %d bytes", size, p.MaxObjectSize))
+	}
 	return nil
 }
 
@@ -129,7 +157,7 @@ func (b *authenticatedBackend) AuthenticationMiddleware(handler http.Handler) ht
 		if rq.Header.Get("Authorization") == "" {
 			// No auth header, we continue without permissions. Request might
 			// still succeed due to bucket policy.
-		} else if err := b.reloadV4Keys(rq.Context()); err != nil {
+		} else if as, err := b.reloadV4Keys(rq.Context()); err != nil {
 			writeResponse(w, signature.APIError{
 				Code:           string(gofakes3.ErrInternal),
 				Description:    fmt.Sprintf("failed to reload v4 keys: %v", err),
@@ -141,8 +169,10 @@ func (b *authenticatedBackend) AuthenticationMiddleware(handler http.Handler) ht
 			writeResponse(w, signature.GetAPIError(result))
 			return
 		} else {
-			// Authenticated request, treat as root user.
+			// Authenticated request, treat as root user but apply the limits
+			// of the keypair.
 			perms = rootPerms
+			perms.MaxObjectSize = as.V4KeypairLimits[accessKeyID(rq)].MaxObjectSize
 		}
 		// Add permissions to context.
 		ctx := context.WithValue(rq.Context(), permissionKey, &perms)
@@ -207,8 +237,11 @@ func (b *authenticatedBackend) DeleteObject(ctx context.Context, bucketName, obj
 }
 
 func (b *authenticatedBackend) PutObject(ctx context.Context, bucketName, key string, meta map[string]string, input io.Reader, size int64) (gofakes3.PutObjectResult, error) {
-	if !b.permsFromCtx(ctx, bucketName).PutObject {
+	perms := b.permsFromCtx(ctx, bucketName)
+	if !perms.PutObject {
 		return gofakes3.PutObjectResult{}, gofakes3.ErrAccessDenied
+	} else if err := perms.checkObjectSize(ctx, size); err != nil {
+		return gofakes3.PutObjectResult{}, err
 	}
 	return b.backend.PutObject(ctx, bucketName, key, meta, input, size)
 }
@@ -237,8 +270,11 @@ func (b *authenticatedBackend) CreateMultipartUpload(ctx context.Context, bucket
 }
 
 func (b *authenticatedBackend) UploadPart(ctx context.Context, bucket, object string, id gofakes3.UploadID, partNumber int, contentLength int64, input io.Reader) (resp *gofakes3.UploadPartResult, err error) {
-	if !b.permsFromCtx(ctx, bucket).UploadPart {
+	perms := b.permsFromCtx(ctx, bucket)
+	if !perms.UploadPart {
 		return nil, gofakes3.ErrAccessDenied
+	} else if err := perms.checkObjectSize(ctx, contentLength); err != nil {
+		return nil, err
 	}
 	return b.backend.UploadPart(ctx, bucket, object, id, partNumber, contentLength, input)
 }
@@ -265,8 +301,40 @@ func (b *authenticatedBackend) AbortMultipartUpload(ctx context.Context, bucket,
 }
 
 func (b *authenticatedBackend) CompleteMultipartUpload(ctx context.Context, bucket, object string, id gofakes3.UploadID, input *gofakes3.CompleteMultipartUploadRequest) (resp *gofakes3.CompleteMultipartUploadResult, err error) {
-	if !b.permsFromCtx(ctx, bucket).CompleteMultipartUpload {
+	perms := b.permsFromCtx(ctx, bucket)
+	if !perms.CompleteMultipartUpload {
 		return nil, gofakes3.ErrAccessDenied
+	} else if perms.MaxObjectSize > 0 {
+		size, err := b.multipartUploadSize(ctx, bucket, object, id, input)
+		if err != nil {
+			return nil, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
+		} else if err := perms.checkObjectSize(ctx, size); err != nil {
+			return nil, err
+		}
 	}
 	return b.backend.CompleteMultipartUpload(ctx, bucket, object, id, input)
 }
+
+// multipartUploadSize returns the size of the object that results from
+// completing the multipart upload with the given parts.
+func (b *authenticatedBackend) multipartUploadSize(ctx context.Context, bucket, object string, id gofakes3.UploadID, input *gofakes3.CompleteMultipartUploadRequest) (size int64, _ error) {
+	completed := make(map[int]struct{}, len(input.Parts))
+	for _, part := range input.Parts {
+		completed[part.PartNumber] = struct{}{}
+	}
+	for marker := 0; ; {
+		resp, err := b.backend.b.MultipartUploadParts(ctx, bucket, "/"+object, string(id), marker, 1000)
+		if err != nil {
+			return 0, err
+		}
+		for _, part := range resp.Parts {
+			if _, ok := completed[part.PartNumber]; ok {
+				size += part.Size
+			}
+		}
+		if !resp.HasMore {
+			return size, nil
+		}
+		marker = resp.NextMarker
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
@@ -14,12 +15,14 @@ import (
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/object"
 	"go.uber.org/zap"
-	"lukechampine.com/frand"
 )
 
 // maxKeysDefault is the default maxKeys value used in the AWS SDK
 const maxKeysDefault = 1000
 
+// amzMetaPrefix is the prefix of the headers that carry user metadata
+const amzMetaPrefix = "X-Amz-Meta-"
+
 var (
 	_ gofakes3.Backend          = (*s3)(nil)
 	_ gofakes3.MultipartBackend = (*s3)(nil)
@@ -68,18 +71,11 @@ func (s *s3) ListBuckets(ctx context.Context) ([]gofakes3.BucketInfo, error) {
 // work fine if you ignore the pagination request, but this may not suit
 // your application. Not all backends bundled with gofakes3 correctly
 // support this pagination yet, but that will change.
-//
-// TODO: This implementation is not ideal because it fetches all objects. We
-// will eventually want to support this type of pagination in the bus.
 func (s *s3) ListBucket(ctx context.Context, bucketName string, prefix *gofakes3.Prefix, page gofakes3.ListBucketPage) (*gofakes3.ObjectList, error) {
 	if prefix == nil {
 		prefix = &gofakes3.Prefix{}
 	}
 	prefix.HasDelimiter = prefix.Delimiter != ""
-	if prefix.HasDelimiter && prefix.Delimiter != "/" {
-		// NOTE: this is a limitation of the current implementation of the bus.
-		return nil, gofakes3.ErrorMessage(gofakes3.ErrNotImplemented, "delimiter must be '/' but was "+prefix.Delimiter)
-	}
 
 	// Workaround for empty prefix
 	prefix.HasPrefix = prefix.Prefix != ""
@@ -89,72 +85,36 @@ func (s *s3) ListBucket(ctx context.Context, bucketName string, prefix *gofakes3
 		page.MaxKeys = maxKeysDefault
 	}
 
-	var objects []api.ObjectMetadata
-	var err error
-	response := gofakes3.NewObjectList()
-	if prefix.HasDelimiter {
-		// Handle request with delimiter.
-		opts := api.GetObjectOptions{}
-		if page.HasMarker {
-			opts.Marker = page.Marker
-			opts.Limit = int(page.MaxKeys)
-		}
-		var path string // root of bucket
-		adjustedPrefix := prefix.Prefix
-		if idx := strings.LastIndex(adjustedPrefix, prefix.Delimiter); idx != -1 {
-			path = adjustedPrefix[:idx+1]
-			adjustedPrefix = adjustedPrefix[idx+1:]
-		}
-		if adjustedPrefix != "" {
-			opts.Prefix = adjustedPrefix
-		}
-		var res api.ObjectsResponse
-		res, err = s.b.Object(ctx, bucketName, path, opts)
-		if err != nil && strings.Contains(err.Error(), api.ErrBucketNotFound.Error()) {
-			return nil, gofakes3.BucketNotFound(bucketName)
-		} else if err != nil {
-			return nil, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
-		}
-		objects = res.Entries
-		response.IsTruncated = res.HasMore
-		if response.IsTruncated {
-			response.NextMarker = objects[len(objects)-1].Name
-		}
-	} else {
-		// Handle request without delimiter.
-		opts := api.ListObjectOptions{
-			Limit:  int(page.MaxKeys),
-			Marker: page.Marker,
-			Prefix: "/" + prefix.Prefix,
-		}
-
-		var res api.ObjectsListResponse
-		res, err = s.b.ListObjects(ctx, bucketName, opts)
-		if err != nil && strings.Contains(err.Error(), api.ErrBucketNotFound.Error()) {
-			return nil, gofakes3.BucketNotFound(bucketName)
-		} else if err != nil {
-			return nil, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
-		}
-		objects = res.Objects
-		response.IsTruncated = res.HasMore
-		response.NextMarker = res.NextMarker
+	// Object paths in the bus start with a '/', keys in S3 don't.
+	opts := api.ListObjectOptions{
+		Delimiter: prefix.Delimiter,
+		Limit:     int(page.MaxKeys),
+		Prefix:    "/" + prefix.Prefix,
 	}
-	if err != nil {
+	if page.HasMarker {
+		opts.Marker = "/" + page.Marker
+	}
+
+	res, err := s.b.ListObjects(ctx, bucketName, opts)
+	if err != nil && errors.Is(api.ParseError(err), api.ErrBucketNotFound) {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	} else if err != nil {
 		return nil, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
 	}
 
-	// Loop over the entries and add them to the response.
-	for _, object := range objects {
-		key := strings.TrimPrefix(object.Name, "/")
-		if prefix.HasDelimiter && strings.HasSuffix(key, prefix.Delimiter) {
-			response.AddPrefix(key)
-			continue
-		}
+	response := gofakes3.NewObjectList()
+	response.IsTruncated = res.HasMore
+	response.NextMarker = strings.TrimPrefix(res.NextMarker, "/")
 
+	// Loop over the entries and add them to the response.
+	for _, cp := range res.CommonPrefixes {
+		response.AddPrefix(strings.TrimPrefix(cp, "/"))
+	}
+	for _, object := range res.Objects {
 		item := &gofakes3.Content{
-			Key:          key,
+			Key:          strings.TrimPrefix(object.Name, "/"),
 			LastModified: gofakes3.NewContentTime(object.ModTime),
-			ETag:         hex.EncodeToString(frand.Bytes(32)), // TODO: don't have that
+			ETag:         api.FormatETag(object.ETag),
 			Size:         object.Size,
 			StorageClass: gofakes3.StorageStandard,
 		}
@@ -170,7 +130,7 @@ func (s *s3) ListBucket(ctx context.Context, bucketName string, prefix *gofakes3
 // If the bucket already exists, a gofakes3.ResourceError with
 // gofakes3.ErrBucketAlreadyExists MUST be returned.
 func (s *s3) CreateBucket(ctx context.Context, name string) error {
-	if err := s.b.CreateBucket(ctx, name, api.CreateBucketOptions{}); err != nil && strings.Contains(err.Error(), api.ErrBucketExists.Error()) {
+	if err := s.b.CreateBucket(ctx, name, api.CreateBucketOptions{}); err != nil && errors.Is(api.ParseError(err), api.ErrBucketExists) {
 		return gofakes3.ErrBucketAlreadyExists
 	} else if err != nil {
 		return gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
@@ -184,7 +144,7 @@ func (s *s3) CreateBucket(ctx context.Context, name string) error {
 // TODO: backend could be improved to allow for checking specific dir in root.
 func (s *s3) BucketExists(ctx context.Context, name string) (bool, error) {
 	_, err := s.b.Bucket(ctx, name)
-	if err != nil && strings.Contains(err.Error(), api.ErrBucketNotFound.Error()) {
+	if err != nil && errors.Is(api.ParseError(err), api.ErrBucketNotFound) {
 		return false, nil
 	} else if err != nil {
 		return false, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
@@ -203,9 +163,9 @@ func (s *s3) BucketExists(ctx context.Context, name string) (bool, error) {
 // TODO: This check is not atomic. The backend needs to be updated to support
 // atomically checking whether a bucket is empty.
 func (s *s3) DeleteBucket(ctx context.Context, name string) error {
-	if err := s.b.DeleteBucket(ctx, name); err != nil && strings.Contains(err.Error(), api.ErrBucketNotEmpty.Error()) {
+	if err := s.b.DeleteBucket(ctx, name); err != nil && errors.Is(api.ParseError(err), api.ErrBucketNotEmpty) {
 		return gofakes3.ErrBucketNotEmpty
-	} else if err != nil && strings.Contains(err.Error(), api.ErrBucketNotFound.Error()) {
+	} else if err != nil && errors.Is(api.ParseError(err), api.ErrBucketNotFound) {
 		return gofakes3.BucketNotFound(name)
 	} else if err != nil {
 		return gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
@@ -226,15 +186,11 @@ func (s *s3) DeleteBucket(ctx context.Context, name string) error {
 // implementers MUST return ErrNotImplemented.
 //
 // If the backend is a VersionedBackend, GetObject retrieves the latest version.
-// TODO: Range requests starting from the end are not supported yet. Backend
-// needs to be updated for that.
 func (s *s3) GetObject(ctx context.Context, bucketName, objectName string, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
-	if rangeRequest != nil && rangeRequest.FromEnd {
-		return nil, gofakes3.ErrorMessage(gofakes3.ErrNotImplemented, "range request from end not supported")
-	}
-
 	opts := api.DownloadObjectOptions{}
-	if rangeRequest != nil {
+	if rangeRequest != nil && rangeRequest.FromEnd {
+		opts.Range = api.DownloadRange{Offset: -1, Length: rangeRequest.End}
+	} else if rangeRequest != nil {
 		length := int64(-1)
 		if rangeRequest.End >= 0 {
 			length = rangeRequest.End - rangeRequest.Start + 1
@@ -242,9 +198,9 @@ func (s *s3) GetObject(ctx context.Context, bucketName, objectName string, range
 		opts.Range = api.DownloadRange{Offset: rangeRequest.Start, Length: length}
 	}
 	res, err := s.w.GetObject(ctx, bucketName, objectName, opts)
-	if err != nil && strings.Contains(err.Error(), api.ErrBucketNotFound.Error()) {
+	if err != nil && errors.Is(api.ParseError(err), api.ErrBucketNotFound) {
 		return nil, gofakes3.BucketNotFound(bucketName)
-	} else if err != nil && strings.Contains(err.Error(), api.ErrObjectNotFound.Error()) {
+	} else if err != nil && errors.Is(api.ParseError(err), api.ErrObjectNotFound) {
 		return nil, gofakes3.KeyNotFound(objectName)
 	} else if err != nil {
 		return nil, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
@@ -257,14 +213,13 @@ func (s *s3) GetObject(ctx context.Context, bucketName, objectName string, range
 		}
 	}
 
-	// TODO: When we support metadata we need to add it here.
-	metadata := map[string]string{
-		"Content-Type":  res.ContentType,
-		"Last-Modified": res.ModTime.UTC().Format(http.TimeFormat),
-	}
+	metadata := amzMetadata(res.Metadata)
+	metadata["Content-Type"] = res.ContentType
+	metadata["Last-Modified"] = res.ModTime.UTC().Format(http.TimeFormat)
 
 	return &gofakes3.Object{
 		Name:     gofakes3.URLEncode(objectName),
+		Hash:     etagHash(res.ETag),
 		Metadata: metadata,
 		Size:     res.Size,
 		Contents: res.Content,
@@ -283,18 +238,20 @@ func (s *s3) GetObject(ctx context.Context, bucketName, objectName string, range
 // exist.
 func (s *s3) HeadObject(ctx context.Context, bucketName, objectName string) (*gofakes3.Object, error) {
 	res, err := s.b.Object(ctx, bucketName, objectName, api.GetObjectOptions{IgnoreDelim: true})
-	if err != nil && strings.Contains(err.Error(), api.ErrObjectNotFound.Error()) {
+	if err != nil && errors.Is(api.ParseError(err), api.ErrObjectNotFound) {
 		return nil, gofakes3.KeyNotFound(objectName)
 	} else if err != nil {
 		return nil, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
 	}
-	// TODO: When we support metadata we need to add it here.
-	metadata := map[string]string{
-		"Content-Type":  mime.TypeByExtension(objectName),
-		"Last-Modified": res.Object.LastModified(),
+	metadata := amzMetadata(res.Object.Metadata)
+	metadata["Content-Type"] = res.Object.MimeType
+	if metadata["Content-Type"] == "" {
+		metadata["Content-Type"] = mime.TypeByExtension(objectName)
 	}
+	metadata["Last-Modified"] = res.Object.LastModified()
 	return &gofakes3.Object{
 		Name:     gofakes3.URLEncode(objectName),
+		Hash:     etagHash(res.Object.ETag),
 		Metadata: metadata,
 		Size:     res.Object.Size,
 		Contents: io.NopCloser(bytes.NewReader(nil)),
@@ -318,9 +275,9 @@ func (s *s3) HeadObject(ctx context.Context, bucketName, objectName string) (*go
 //	isn't a null version, Amazon S3 does not remove any objects.
 func (s *s3) DeleteObject(ctx context.Context, bucketName, objectName string) (gofakes3.ObjectDeleteResult, error) {
 	err := s.b.DeleteObject(ctx, bucketName, objectName, api.DeleteObjectOptions{})
-	if err != nil && strings.Contains(err.Error(), api.ErrBucketNotFound.Error()) {
+	if err != nil && errors.Is(api.ParseError(err), api.ErrBucketNotFound) {
 		return gofakes3.ObjectDeleteResult{}, gofakes3.BucketNotFound(bucketName)
-	} else if err != nil && !strings.Contains(err.Error(), api.ErrObjectNotFound.Error()) {
+	} else if err != nil && !errors.Is(api.ParseError(err), api.ErrObjectNotFound) {
 		return gofakes3.ObjectDeleteResult{}, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
 	}
 	return gofakes3.ObjectDeleteResult{
@@ -334,18 +291,16 @@ func (s *s3) DeleteObject(ctx context.Context, bucketName, objectName string) (g
 //
 // The size can be used if the backend needs to read the whole reader; use
 // gofakes3.ReadAll() for this job rather than ioutil.ReadAll().
-// TODO: Metadata is currently ignored. The backend requires an update to
-// support it.
 func (s *s3) PutObject(ctx context.Context, bucketName, key string, meta map[string]string, input io.Reader, size int64) (gofakes3.PutObjectResult, error) {
-	opts := api.UploadObjectOptions{}
+	opts := api.UploadObjectOptions{Metadata: userMetadata(meta)}
 	if ct, ok := meta["Content-Type"]; ok {
 		opts.MimeType = ct
 	}
 	ur, err := s.w.UploadObject(ctx, input, bucketName, key, opts)
-	if err != nil && strings.Contains(err.Error(), api.ErrBucketNotFound.Error()) {
+	if err != nil && errors.Is(api.ParseError(err), api.ErrBucketNotFound) {
 		return gofakes3.PutObjectResult{}, gofakes3.BucketNotFound(bucketName)
 	} else if err != nil {
-		return gofakes3.PutObjectResult{}, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
+		return gofakes3.PutObjectResult{}, uploadError(ctx, err)
 	}
 	return gofakes3.PutObjectResult{
 		ETag:      ur.ETag,
@@ -357,7 +312,7 @@ func (s *s3) DeleteMulti(ctx context.Context, bucketName string, objects ...stri
 	var res gofakes3.MultiDeleteResult
 	for _, objectName := range objects {
 		err := s.b.DeleteObject(ctx, bucketName, objectName, api.DeleteObjectOptions{})
-		if err != nil && !strings.Contains(err.Error(), api.ErrObjectNotFound.Error()) {
+		if err != nil && !errors.Is(api.ParseError(err), api.ErrObjectNotFound) {
 			res.Error = append(res.Error, gofakes3.ErrorResult{
 				Key:     objectName,
 				Code:    gofakes3.ErrInternal,
@@ -379,7 +334,13 @@ func (s *s3) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKe
 		opts.MimeType = ct
 	}
 	obj, err := s.b.CopyObject(ctx, srcBucket, dstBucket, "/"+srcKey, "/"+dstKey, opts)
-	if err != nil {
+	if err != nil && errors.Is(api.ParseError(err), api.ErrBucketNotFound) {
+		return gofakes3.CopyObjectResult{}, gofakes3.BucketNotFound(dstBucket)
+	} else if err != nil && errors.Is(api.ParseError(err), api.ErrObjectNotFound) {
+		return gofakes3.CopyObjectResult{}, gofakes3.KeyNotFound(srcKey)
+	} else if err != nil && (errors.Is(api.ParseError(err), api.ErrObjectTooLarge) || errors.Is(api.ParseError(err), api.ErrBucketQuotaExceeded)) {
+		return gofakes3.CopyObjectResult{}, entityTooLarge(ctx, err.Error())
+	} else if err != nil {
 		return gofakes3.CopyObjectResult{}, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
 	}
 	return gofakes3.CopyObjectResult{
@@ -389,7 +350,7 @@ func (s *s3) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKe
 }
 
 func (s *s3) CreateMultipartUpload(ctx context.Context, bucket, key string, meta map[string]string) (gofakes3.UploadID, error) {
-	opts := api.CreateMultipartOptions{Key: object.NoOpKey}
+	opts := api.CreateMultipartOptions{Key: object.NoOpKey, Metadata: userMetadata(meta)}
 	if ct, ok := meta["Content-Type"]; ok {
 		opts.MimeType = ct
 	}
@@ -405,7 +366,7 @@ func (s *s3) UploadPart(ctx context.Context, bucket, object string, id gofakes3.
 		DisablePreshardingEncryption: true,
 	})
 	if err != nil {
-		return nil, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
+		return nil, uploadError(ctx, err)
 	}
 	return &gofakes3.UploadPartResult{ETag: res.ETag}, nil
 }
@@ -413,17 +374,22 @@ func (s *s3) UploadPart(ctx context.Context, bucket, object string, id gofakes3.
 func (s *s3) ListMultipartUploads(ctx context.Context, bucket string, marker *gofakes3.UploadListMarker, prefix gofakes3.Prefix, limit int64) (*gofakes3.ListMultipartUploadsResult, error) {
 	prefix.HasPrefix = prefix.Prefix != ""
 	prefix.HasDelimiter = prefix.Delimiter != ""
-	if prefix.HasDelimiter && prefix.Delimiter != "/" {
-		return nil, gofakes3.ErrorMessage(gofakes3.ErrNotImplemented, "delimiter must be '/'")
-	} else if prefix.HasPrefix {
-		return nil, gofakes3.ErrorMessage(gofakes3.ErrNotImplemented, "prefix not supported")
-	} else if marker != nil {
-		return nil, gofakes3.ErrorMessage(gofakes3.ErrNotImplemented, "marker not supported")
-	}
-	resp, err := s.b.MultipartUploads(ctx, bucket, "", "", "", int(limit))
+
+	// Object paths in the bus start with a '/', keys in S3 don't.
+	var keyMarker, uploadIDMarker string
+	if marker != nil {
+		keyMarker = "/" + marker.Object
+		uploadIDMarker = string(marker.UploadID)
+	}
+	resp, err := s.b.MultipartUploads(ctx, bucket, "/"+prefix.Prefix, prefix.Delimiter, keyMarker, uploadIDMarker, int(limit))
 	if err != nil {
 		return nil, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
 	}
+
+	commonPrefixes := []gofakes3.CommonPrefix{}
+	for _, cp := range resp.CommonPrefixes {
+		commonPrefixes = append(commonPrefixes, gofakes3.CommonPrefix{Prefix: cp[1:]})
+	}
 	var uploads []gofakes3.ListMultipartUploadItem
 	for _, upload := range resp.Uploads {
 		uploads = append(uploads, gofakes3.ListMultipartUploadItem{
@@ -434,15 +400,15 @@ func (s *s3) ListMultipartUploads(ctx context.Context, bucket string, marker *go
 	}
 	return &gofakes3.ListMultipartUploadsResult{
 		Bucket:             bucket,
-		KeyMarker:          "",
-		UploadIDMarker:     "",
-		NextKeyMarker:      "",
-		NextUploadIDMarker: "",
+		KeyMarker:          strings.TrimPrefix(keyMarker, "/"),
+		UploadIDMarker:     gofakes3.UploadID(uploadIDMarker),
+		NextKeyMarker:      strings.TrimPrefix(resp.NextPathMarker, "/"),
+		NextUploadIDMarker: gofakes3.UploadID(resp.NextUploadIDMarker),
 		MaxUploads:         limit,
 		Delimiter:          prefix.Delimiter,
 		Prefix:             prefix.Prefix,
-		CommonPrefixes:     []gofakes3.CommonPrefix{},
-		IsTruncated:        false,
+		CommonPrefixes:     commonPrefixes,
+		IsTruncated:        resp.HasMore,
 		Uploads:            uploads,
 	}, nil
 }
@@ -492,9 +458,63 @@ func (s *s3) CompleteMultipartUpload(ctx context.Context, bucket, object string,
 	}
 	resp, err := s.b.CompleteMultipartUpload(ctx, bucket, "/"+object, string(id), parts)
 	if err != nil {
-		return nil, gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
+		return nil, uploadError(ctx, err)
 	}
 	return &gofakes3.CompleteMultipartUploadResult{
 		ETag: api.FormatETag(resp.ETag),
 	}, nil
 }
+
+// amzMetadata converts the user metadata of an object to S3 metadata headers.
+func amzMetadata(md api.ObjectUserMetadata) map[string]string {
+	meta := make(map[string]string, len(md)+2)
+	for k, v := range md {
+		meta[amzMetaPrefix+k] = v
+	}
+	return meta
+}
+
+// userMetadata extracts the user metadata from the S3 metadata headers.
+func userMetadata(meta map[string]string) api.ObjectUserMetadata {
+	var md api.ObjectUserMetadata
+	for k, v := range meta {
+		if strings.HasPrefix(k, amzMetaPrefix) && len(k) > len(amzMetaPrefix) {
+			if md == nil {
+				md = make(api.ObjectUserMetadata)
+			}
+			md[strings.ToLower(strings.TrimPrefix(k, amzMetaPrefix))] = v
+		}
+	}
+	return md
+}
+
+// etagHash converts an ETag to the hash gofakes3 expects, an ETag that isn't
+// hex encoded results in an empty hash.
+func etagHash(eTag string) []byte {
+	hash, err := hex.DecodeString(eTag)
+	if err != nil {
+		return nil
+	}
+	return hash
+}
+
+// uploadError converts an error returned when uploading data into an S3 error,
+// uploads rejected by the maintenance mode are retryable so they result in a
+// 503 rather than a 500. Uploads that exceed the limits of their bucket result
+// in a 400.
+func uploadError(ctx context.Context, err error) error {
+	if errors.Is(api.ParseError(err), api.ErrMaintenanceMode) {
+		overrideStatus(ctx, http.StatusServiceUnavailable)
+		return gofakes3.ErrorMessage(errServiceUnavailable, err.Error())
+	} else if errors.Is(api.ParseError(err), api.ErrObjectTooLarge) || errors.Is(api.ParseError(err), api.ErrBucketQuotaExceeded) {
+		return entityTooLarge(ctx, err.Error())
+	}
+	return gofakes3.ErrorMessage(gofakes3.ErrInternal, err.Error())
+}
+
+// entityTooLarge returns the S3 error for uploads that exceed the maximum
+// allowed object size.
+func entityTooLarge(ctx context.Context, msg string) error {
+	overrideStatus(ctx, http.StatusBadRequest)
+	return gofakes3.ErrorMessage(errEntityTooLarge, msg)
+}
@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"go.sia.tech/core/types"
 	"go.sia.tech/gofakes3"
@@ -15,6 +16,18 @@ import (
 	"go.uber.org/zap"
 )
 
+// errServiceUnavailable is the S3 error code for requests that can't be served
+// temporarily, gofakes3 doesn't define it so its status is set through
+// overrideStatus.
+const errServiceUnavailable gofakes3.ErrorCode = "ServiceUnavailable"
+
+// errEntityTooLarge is the S3 error code for uploads that exceed the maximum
+// allowed object size, gofakes3 doesn't define it so its status is set through
+// overrideStatus.
+const errEntityTooLarge gofakes3.ErrorCode = "EntityTooLarge"
+
+type statusOverrideKey struct{}
+
 type gofakes3Logger struct {
 	l *zap.SugaredLogger
 }
@@ -39,7 +52,7 @@ type bus interface {
 	AbortMultipartUpload(ctx context.Context, bucket, path string, uploadID string) (err error)
 	CompleteMultipartUpload(ctx context.Context, bucket, path, uploadID string, parts []api.MultipartCompletedPart) (_ api.MultipartCompleteResponse, err error)
 	CreateMultipartUpload(ctx context.Context, bucket, path string, opts api.CreateMultipartOptions) (api.MultipartCreateResponse, error)
-	MultipartUploads(ctx context.Context, bucket, prefix, keyMarker, uploadIDMarker string, maxUploads int) (resp api.MultipartListUploadsResponse, _ error)
+	MultipartUploads(ctx context.Context, bucket, prefix, delimiter, keyMarker, uploadIDMarker string, maxUploads int) (resp api.MultipartListUploadsResponse, _ error)
 	MultipartUploadParts(ctx context.Context, bucket, object string, uploadID string, marker int, limit int64) (resp api.MultipartListPartsResponse, _ error)
 
 	S3AuthenticationSettings(ctx context.Context) (as api.S3AuthenticationSettings, err error)
@@ -89,7 +102,38 @@ func New(b bus, w worker, logger *zap.SugaredLogger, opts Opts) (http.Handler, e
 	if err != nil {
 		return nil, fmt.Errorf("failed to create s3 server: %w", err)
 	}
-	return faker.Server(), nil
+	return withStatusOverride(faker.Server()), nil
+}
+
+// withStatusOverride wraps the given handler and allows the backend to override
+// the status code of the response using overrideStatus. gofakes3 derives the
+// status code from the error code and falls back to 500 for codes it doesn't
+// know about.
+func withStatusOverride(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sw := &statusOverrideWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, req.WithContext(context.WithValue(req.Context(), statusOverrideKey{}, &sw.status)))
+	})
+}
+
+// overrideStatus overrides the status code of the response to the request with
+// the given context.
+func overrideStatus(ctx context.Context, status int) {
+	if s, ok := ctx.Value(statusOverrideKey{}).(*atomic.Int32); ok {
+		s.Store(int32(status))
+	}
+}
+
+type statusOverrideWriter struct {
+	http.ResponseWriter
+	status atomic.Int32
+}
+
+func (w *statusOverrideWriter) WriteHeader(status int) {
+	if override := w.status.Load(); override != 0 {
+		status = int(override)
+	}
+	w.ResponseWriter.WriteHeader(status)
 }
 
 // Parsev4AuthKeys parses a list of accessKey-secretKey pairs and returns a map
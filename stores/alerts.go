@@ -0,0 +1,180 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/alerts"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	// dbAlert defines a table that stores the active alerts and the ones
+	// that were dismissed within the retention window.
+	dbAlert struct {
+		Model
+
+		AlertID     hash256         `gorm:"unique;index;NOT NULL;size:32"`
+		Severity    alerts.Severity `gorm:"index;NOT NULL"`
+		Origin      string          `gorm:"index;size:255"`
+		Message     string          `gorm:"type:text;NOT NULL"`
+		Data        string          `gorm:"type:text"`
+		Timestamp   time.Time       `gorm:"index;NOT NULL"`
+		Count       int
+		LastSeen    time.Time
+		DismissedAt sql.NullTime `gorm:"index"`
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbAlert) TableName() string { return "alerts" }
+
+// convert converts a dbAlert into an alerts.Alert.
+func (a dbAlert) convert() (alerts.Alert, error) {
+	alert := alerts.Alert{
+		ID:        types.Hash256(a.AlertID),
+		Severity:  a.Severity,
+		Message:   a.Message,
+		Timestamp: a.Timestamp.UTC(),
+		Count:     a.Count,
+		LastSeen:  a.LastSeen.UTC(),
+	}
+	if a.Data != "" {
+		if err := json.Unmarshal([]byte(a.Data), &alert.Data); err != nil {
+			return alerts.Alert{}, fmt.Errorf("failed to unmarshal data of alert %v: %w", alert.ID, err)
+		}
+	}
+	if a.DismissedAt.Valid {
+		dismissedAt := a.DismissedAt.Time.UTC()
+		alert.DismissedAt = &dismissedAt
+	}
+	return alert, nil
+}
+
+// ActiveAlerts implements the alerts.Store interface.
+func (s *SQLStore) ActiveAlerts(ctx context.Context) ([]alerts.Alert, error) {
+	var dbAlerts []dbAlert
+	if err := s.db.
+		WithContext(ctx).
+		Where("dismissed_at IS NULL").
+		Order("timestamp DESC").
+		Find(&dbAlerts).
+		Error; err != nil {
+		return nil, err
+	}
+	return convertAlerts(dbAlerts)
+}
+
+// AlertHistory implements the alerts.Store interface.
+func (s *SQLStore) AlertHistory(ctx context.Context, opts alerts.AlertsOpts) ([]alerts.Alert, error) {
+	if opts.Offset < 0 {
+		return nil, ErrNegativeOffset
+	}
+
+	query := s.db.WithContext(ctx).Model(&dbAlert{})
+	if opts.Severity != 0 {
+		query = query.Where("severity = ?", opts.Severity)
+	}
+	if opts.Module != "" {
+		query = query.Where("origin = ? OR origin LIKE ?", opts.Module, opts.Module+".%")
+	}
+
+	var dbAlerts []dbAlert
+	if err := query.
+		Order("timestamp DESC").
+		Offset(opts.Offset).
+		Limit(opts.Limit).
+		Find(&dbAlerts).
+		Error; err != nil {
+		return nil, err
+	}
+	return convertAlerts(dbAlerts)
+}
+
+// AddAlert implements the alerts.Store interface.
+func (s *SQLStore) AddAlert(ctx context.Context, a alerts.Alert) error {
+	var data string
+	if len(a.Data) > 0 {
+		b, err := json.Marshal(a.Data)
+		if err != nil {
+			return fmt.Errorf("failed to marshal alert data: %w", err)
+		}
+		data = string(b)
+	}
+	origin, _ := a.Data["origin"].(string)
+
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "alert_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"severity":     a.Severity,
+				"origin":       origin,
+				"message":      a.Message,
+				"data":         data,
+				"timestamp":    a.Timestamp,
+				"count":        a.Count,
+				"last_seen":    a.LastSeen,
+				"dismissed_at": sql.NullTime{},
+			}),
+		}).Create(&dbAlert{
+			AlertID:   hash256(a.ID),
+			Severity:  a.Severity,
+			Origin:    origin,
+			Message:   a.Message,
+			Data:      data,
+			Timestamp: a.Timestamp,
+			Count:     a.Count,
+			LastSeen:  a.LastSeen,
+		}).Error
+	})
+}
+
+// MarkAlertsDismissed implements the alerts.Store interface.
+func (s *SQLStore) MarkAlertsDismissed(ctx context.Context, dismissedAt time.Time, ids ...types.Hash256) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		for i := 0; i < len(ids); i += maxSQLVars {
+			end := i + maxSQLVars
+			if end > len(ids) {
+				end = len(ids)
+			}
+			alertIDs := make([]hash256, 0, end-i)
+			for _, id := range ids[i:end] {
+				alertIDs = append(alertIDs, hash256(id))
+			}
+			if err := tx.Model(&dbAlert{}).
+				Where("alert_id IN ? AND dismissed_at IS NULL", alertIDs).
+				Update("dismissed_at", dismissedAt).
+				Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PruneAlerts implements the alerts.Store interface.
+func (s *SQLStore) PruneAlerts(ctx context.Context, dismissedBefore time.Time) (pruned int64, err error) {
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		res := tx.Where("dismissed_at < ?", dismissedBefore).Delete(&dbAlert{})
+		pruned = res.RowsAffected
+		return res.Error
+	})
+	return
+}
+
+func convertAlerts(dbAlerts []dbAlert) ([]alerts.Alert, error) {
+	converted := make([]alerts.Alert, 0, len(dbAlerts))
+	for _, a := range dbAlerts {
+		alert, err := a.convert()
+		if err != nil {
+			return nil, err
+		}
+		converted = append(converted, alert)
+	}
+	return converted, nil
+}
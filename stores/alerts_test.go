@@ -0,0 +1,107 @@
+package stores
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/alerts"
+)
+
+func TestAlerts(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	ctx := context.Background()
+
+	newAlert := func(id byte, severity alerts.Severity, origin string, ts time.Time) alerts.Alert {
+		return alerts.Alert{
+			ID:        types.Hash256{id},
+			Severity:  severity,
+			Message:   "test",
+			Data:      map[string]any{"origin": origin, "foo": "bar"},
+			Timestamp: ts.UTC().Round(time.Second),
+		}
+	}
+	now := time.Now()
+	a1 := newAlert(1, alerts.SeverityInfo, "bus", now.Add(-3*time.Hour))
+	a2 := newAlert(2, alerts.SeverityCritical, "autopilot.autopilot", now.Add(-2*time.Hour))
+	a3 := newAlert(3, alerts.SeverityCritical, "worker.worker", now.Add(-time.Hour))
+	for _, a := range []alerts.Alert{a1, a2, a3} {
+		if err := ss.AddAlert(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert all alerts are active
+	var active []alerts.Alert
+	active, err = ss.ActiveAlerts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if !cmp.Equal(active, []alerts.Alert{a3, a2, a1}) {
+		t.Fatal("unexpected alerts", cmp.Diff(active, []alerts.Alert{a3, a2, a1}))
+	}
+
+	// dismiss two alerts
+	if err := ss.MarkAlertsDismissed(ctx, now.Add(-time.Hour), a1.ID); err != nil {
+		t.Fatal(err)
+	} else if err := ss.MarkAlertsDismissed(ctx, now, a2.ID); err != nil {
+		t.Fatal(err)
+	}
+	if active, err := ss.ActiveAlerts(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(active) != 1 || active[0].ID != a3.ID {
+		t.Fatal("unexpected alerts", active)
+	}
+
+	// assert the history contains dismissed alerts and can be filtered
+	assertHistory := func(opts alerts.AlertsOpts, ids ...types.Hash256) {
+		t.Helper()
+		history, err := ss.AlertHistory(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(history) != len(ids) {
+			t.Fatal("unexpected number of alerts", len(history), len(ids))
+		}
+		for i := range history {
+			if history[i].ID != ids[i] {
+				t.Fatal("unexpected alert", i, history[i].ID)
+			}
+		}
+	}
+	assertHistory(alerts.AlertsOpts{Limit: -1}, a3.ID, a2.ID, a1.ID)
+	assertHistory(alerts.AlertsOpts{Limit: 1, Offset: 1}, a2.ID)
+	assertHistory(alerts.AlertsOpts{Severity: alerts.SeverityCritical, Limit: -1}, a3.ID, a2.ID)
+	assertHistory(alerts.AlertsOpts{Module: "autopilot", Limit: -1}, a2.ID)
+	assertHistory(alerts.AlertsOpts{Module: "auto", Limit: -1})
+
+	history, err := ss.AlertHistory(ctx, alerts.AlertsOpts{Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	} else if history[0].DismissedAt != nil {
+		t.Fatal("active alert shouldn't be dismissed")
+	} else if history[1].DismissedAt == nil || !history[1].DismissedAt.Equal(now.Round(0).UTC()) {
+		t.Fatal("unexpected dismissal time", history[1].DismissedAt)
+	}
+
+	// assert registering a dismissed alert again reactivates it
+	if err := ss.AddAlert(ctx, a2); err != nil {
+		t.Fatal(err)
+	} else if active, err := ss.ActiveAlerts(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(active) != 2 {
+		t.Fatal("unexpected alerts", active)
+	}
+
+	// prune alerts dismissed more than 30 minutes ago
+	if pruned, err := ss.PruneAlerts(ctx, now.Add(-30*time.Minute)); err != nil {
+		t.Fatal(err)
+	} else if pruned != 1 {
+		t.Fatal("unexpected number of pruned alerts", pruned)
+	}
+	assertHistory(alerts.AlertsOpts{Limit: -1}, a3.ID, a2.ID)
+}
@@ -3,6 +3,7 @@ package stores
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"go.sia.tech/renterd/api"
 	"gorm.io/gorm"
@@ -16,18 +17,39 @@ type (
 		Identifier    string              `gorm:"unique;NOT NULL;"`
 		Config        api.AutopilotConfig `gorm:"serializer:json"`
 		CurrentPeriod uint64              `gorm:"default:0"`
+		Profile       string              `gorm:"size:255"`
+	}
+
+	dbAutopilotProfile struct {
+		Model
+
+		Autopilot string              `gorm:"uniqueIndex:idx_autopilot_profile;NOT NULL;size:255"`
+		Name      string              `gorm:"uniqueIndex:idx_autopilot_profile;NOT NULL;size:255"`
+		Config    api.AutopilotConfig `gorm:"serializer:json"`
 	}
 )
 
 // TableName implements the gorm.Tabler interface.
 func (dbAutopilot) TableName() string { return "autopilots" }
 
+// TableName implements the gorm.Tabler interface.
+func (dbAutopilotProfile) TableName() string { return "autopilot_profiles" }
+
 // convert converts a dbContract to a ContractMetadata.
 func (c dbAutopilot) convert() api.Autopilot {
 	return api.Autopilot{
 		ID:            c.Identifier,
 		Config:        c.Config,
 		CurrentPeriod: c.CurrentPeriod,
+		Profile:       c.Profile,
+	}
+}
+
+// convert converts a dbAutopilotProfile to an AutopilotProfile.
+func (p dbAutopilotProfile) convert() api.AutopilotProfile {
+	return api.AutopilotProfile{
+		Name:   p.Name,
+		Config: p.Config,
 	}
 }
 
@@ -80,5 +102,106 @@ func (s *SQLStore) UpdateAutopilot(ctx context.Context, ap api.Autopilot) error
 		Identifier:    ap.ID,
 		Config:        ap.Config,
 		CurrentPeriod: ap.CurrentPeriod,
+		Profile:       ap.Profile,
 	}).Error
 }
+
+// AutopilotProfiles returns the config profiles of the autopilot with the
+// given id, sorted by name.
+func (s *SQLStore) AutopilotProfiles(ctx context.Context, id string) ([]api.AutopilotProfile, error) {
+	var entities []dbAutopilotProfile
+	err := s.db.
+		Where("autopilot = ?", id).
+		Order("name ASC").
+		Find(&entities).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]api.AutopilotProfile, len(entities))
+	for i, p := range entities {
+		profiles[i] = p.convert()
+	}
+	return profiles, nil
+}
+
+// AutopilotProfile returns the config profile with the given name.
+func (s *SQLStore) AutopilotProfile(ctx context.Context, id, name string) (api.AutopilotProfile, error) {
+	profile, err := fetchAutopilotProfile(s.db, id, name)
+	if err != nil {
+		return api.AutopilotProfile{}, err
+	}
+	return profile.convert(), nil
+}
+
+// UpdateAutopilotProfile adds the given config profile or overwrites the
+// profile with the same name.
+func (s *SQLStore) UpdateAutopilotProfile(ctx context.Context, id string, profile api.AutopilotProfile) error {
+	if profile.Name == "" {
+		return errors.New("profile name cannot be empty")
+	} else if err := profile.Config.Validate(); err != nil {
+		return err
+	}
+
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "autopilot"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"config"}),
+	}).Create(&dbAutopilotProfile{
+		Autopilot: id,
+		Name:      profile.Name,
+		Config:    profile.Config,
+	}).Error
+}
+
+// DeleteAutopilotProfile deletes the config profile with the given name.
+func (s *SQLStore) DeleteAutopilotProfile(ctx context.Context, id, name string) error {
+	res := s.db.
+		Where("autopilot = ? AND name = ?", id, name).
+		Delete(&dbAutopilotProfile{})
+	if res.Error != nil {
+		return res.Error
+	} else if res.RowsAffected == 0 {
+		return api.ErrAutopilotProfileNotFound
+	}
+	return nil
+}
+
+// ActivateAutopilotProfile atomically replaces the config of the autopilot
+// with the config of the given profile. If the autopilot doesn't exist yet it
+// is created.
+func (s *SQLStore) ActivateAutopilotProfile(ctx context.Context, id, name string) (ap api.Autopilot, err error) {
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		profile, err := fetchAutopilotProfile(tx, id, name)
+		if err != nil {
+			return err
+		}
+
+		var entity dbAutopilot
+		err = tx.
+			Where("identifier = ?", id).
+			Take(&entity).
+			Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		entity.Identifier = id
+		entity.Config = profile.Config
+		entity.Profile = profile.Name
+		ap = entity.convert()
+		return tx.Save(&entity).Error
+	})
+	return
+}
+
+func fetchAutopilotProfile(tx *gorm.DB, id, name string) (dbAutopilotProfile, error) {
+	var profile dbAutopilotProfile
+	err := tx.
+		Where("autopilot = ? AND name = ?", id, name).
+		Take(&profile).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return dbAutopilotProfile{}, fmt.Errorf("%w: %v", api.ErrAutopilotProfileNotFound, name)
+	}
+	return profile, err
+}
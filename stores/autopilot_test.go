@@ -2,6 +2,7 @@ package stores
 
 import (
 	"context"
+	"errors"
 	"reflect"
 	"testing"
 
@@ -91,6 +92,90 @@ func TestAutopilotStore(t *testing.T) {
 	}
 }
 
+func TestAutopilotProfiles(t *testing.T) {
+	db, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// add two profiles
+	archive := testAutopilotConfig
+	archive.Contracts.Amount = 10
+	performance := testAutopilotConfig
+	performance.Contracts.Amount = 50
+	for _, p := range []api.AutopilotProfile{
+		{Name: "performance", Config: performance},
+		{Name: "cheap-archive", Config: archive},
+	} {
+		if err := db.UpdateAutopilotProfile(ctx, t.Name(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert they are returned sorted by name
+	profiles, err := db.AutopilotProfiles(ctx, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(profiles) != 2 {
+		t.Fatal("unexpected number of profiles", len(profiles))
+	} else if profiles[0].Name != "cheap-archive" || profiles[1].Name != "performance" {
+		t.Fatal("unexpected profiles", profiles)
+	}
+
+	// overwrite a profile
+	archive.Contracts.Amount = 20
+	if err := db.UpdateAutopilotProfile(ctx, t.Name(), api.AutopilotProfile{Name: "cheap-archive", Config: archive}); err != nil {
+		t.Fatal(err)
+	} else if p, err := db.AutopilotProfile(ctx, t.Name(), "cheap-archive"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(p.Config, archive) {
+		t.Fatal("unexpected config")
+	}
+
+	// activate a profile, the autopilot is created if it doesn't exist
+	ap, err := db.ActivateAutopilotProfile(ctx, t.Name(), "cheap-archive")
+	if err != nil {
+		t.Fatal(err)
+	} else if ap.Profile != "cheap-archive" {
+		t.Fatal("unexpected profile", ap.Profile)
+	}
+	ap, err = db.Autopilot(ctx, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	} else if ap.Profile != "cheap-archive" || !reflect.DeepEqual(ap.Config, archive) {
+		t.Fatal("unexpected autopilot", ap)
+	}
+
+	// switch to the other profile and assert the current period is kept
+	ap.CurrentPeriod = 5
+	if err := db.UpdateAutopilot(ctx, ap); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.ActivateAutopilotProfile(ctx, t.Name(), "performance"); err != nil {
+		t.Fatal(err)
+	} else if ap, err = db.Autopilot(ctx, t.Name()); err != nil {
+		t.Fatal(err)
+	} else if ap.Profile != "performance" || ap.CurrentPeriod != 5 || ap.Config.Contracts.Amount != 50 {
+		t.Fatal("unexpected autopilot", ap)
+	}
+
+	// assert unknown profiles can't be activated or deleted
+	if _, err := db.ActivateAutopilotProfile(ctx, t.Name(), "unknown"); !errors.Is(err, api.ErrAutopilotProfileNotFound) {
+		t.Fatal("unexpected error", err)
+	} else if err := db.DeleteAutopilotProfile(ctx, t.Name(), "unknown"); !errors.Is(err, api.ErrAutopilotProfileNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// delete a profile
+	if err := db.DeleteAutopilotProfile(ctx, t.Name(), "performance"); err != nil {
+		t.Fatal(err)
+	} else if profiles, err := db.AutopilotProfiles(ctx, t.Name()); err != nil {
+		t.Fatal(err)
+	} else if len(profiles) != 1 {
+		t.Fatal("unexpected number of profiles", len(profiles))
+	}
+}
+
 // testAutopilotConfig is the autopilot used for testing unless a different
 // one is explicitly set.
 var testAutopilotConfig = api.AutopilotConfig{
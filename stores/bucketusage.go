@@ -0,0 +1,112 @@
+package stores
+
+import (
+	"fmt"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+)
+
+const (
+	// bucketUsageCacheTTL is the amount of time after which the cached usage
+	// of a bucket is recomputed from the database. Adding objects updates the
+	// cached usage and deleting objects invalidates it, the TTL is a safety
+	// net that corrects any drift.
+	bucketUsageCacheTTL = 10 * time.Minute
+)
+
+type bucketUsage struct {
+	size      int64
+	fetchedAt time.Time
+}
+
+// checkBucketLimits checks whether storing an object of the given size at the
+// given path of the bucket would exceed the bucket's max object size or max
+// stored bytes, the size of an object that is overwritten is not counted. It
+// returns the change in the bucket's usage, which is to be applied to the
+// cache once the transaction succeeded.
+//
+// NOTE: the caller must hold the objectsMu, that way the quota can't be
+// exceeded by objects that are added concurrently.
+func (s *SQLStore) checkBucketLimits(tx *gorm.DB, b dbBucket, path string, size int64) (delta int64, _ error) {
+	if b.Policy.MaxObjectSize > 0 && size > int64(b.Policy.MaxObjectSize) {
+		return 0, fmt.Errorf("%w: object of %d bytes exceeds the limit of %d bytes", api.ErrObjectTooLarge, size, b.Policy.MaxObjectSize)
+	} else if b.Policy.MaxStoredBytes == 0 {
+		return 0, nil
+	}
+
+	// fetch the bucket's usage
+	usage, err := s.bucketStoredBytes(tx, b)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch bucket usage: %w", err)
+	}
+
+	// fetch the size of the object that is overwritten
+	var overwritten int64
+	if err := tx.
+		Model(&dbObject{}).
+		Select("COALESCE(SUM(size), 0)").
+		Where("db_bucket_id = ? AND object_id = ?", b.ID, path).
+		Scan(&overwritten).
+		Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch size of overwritten object: %w", err)
+	}
+
+	delta = size - overwritten
+	if usage+delta > int64(b.Policy.MaxStoredBytes) {
+		return 0, fmt.Errorf("%w: storing %d bytes would exceed the limit of %d bytes, %d bytes stored", api.ErrBucketQuotaExceeded, size, b.Policy.MaxStoredBytes, usage)
+	}
+	return delta, nil
+}
+
+// bucketStoredBytes returns the total size of the objects stored in the given
+// bucket, it's only computed from the database if it's not cached.
+func (s *SQLStore) bucketStoredBytes(tx *gorm.DB, b dbBucket) (int64, error) {
+	s.bucketUsageMu.Lock()
+	usage, ok := s.bucketUsage[b.Name]
+	s.bucketUsageMu.Unlock()
+	if ok && time.Since(usage.fetchedAt) < bucketUsageCacheTTL {
+		return usage.size, nil
+	}
+
+	var size int64
+	if err := tx.
+		Model(&dbObject{}).
+		Select("COALESCE(SUM(size), 0)").
+		Where("db_bucket_id = ?", b.ID).
+		Scan(&size).
+		Error; err != nil {
+		return 0, err
+	}
+
+	s.bucketUsageMu.Lock()
+	s.bucketUsage[b.Name] = bucketUsage{size: size, fetchedAt: time.Now()}
+	s.bucketUsageMu.Unlock()
+	return size, nil
+}
+
+// updateBucketUsage applies the given change to the cached usage of the given
+// bucket, if it's cached.
+func (s *SQLStore) updateBucketUsage(bucket string, delta int64) {
+	s.bucketUsageMu.Lock()
+	defer s.bucketUsageMu.Unlock()
+	if usage, ok := s.bucketUsage[bucket]; ok {
+		usage.size += delta
+		s.bucketUsage[bucket] = usage
+	}
+}
+
+// invalidateBucketUsage removes the cached usage of the given buckets, if no
+// bucket is given the usage of all buckets is removed.
+func (s *SQLStore) invalidateBucketUsage(buckets ...string) {
+	s.bucketUsageMu.Lock()
+	defer s.bucketUsageMu.Unlock()
+	if len(buckets) == 0 {
+		s.bucketUsage = make(map[string]bucketUsage)
+		return
+	}
+	for _, bucket := range buckets {
+		delete(s.bucketUsage, bucket)
+	}
+}
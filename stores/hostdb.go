@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 	"time"
 
@@ -42,6 +43,10 @@ const (
 var (
 	ErrNegativeOffset      = errors.New("offset can not be negative")
 	ErrNegativeMaxDowntime = errors.New("max downtime can not be negative")
+
+	// errRollback is returned from within a transaction to roll it back
+	// without surfacing an error, e.g. when previewing an update.
+	errRollback = errors.New("rollback")
 )
 
 type (
@@ -75,11 +80,51 @@ type (
 		SuccessfulInteractions float64
 		FailedInteractions     float64
 
+		MissedProofs    uint64
+		LastMissedProof int64 // unix nano
+
+		// UploadSpeedMBPS, UploadLatencyP90MS, DownloadSpeedMBPS and
+		// DownloadLatencyP90MS are the host's recent performance averaged
+		// over the metrics recorded by the workers.
+		UploadSpeedMBPS      float64
+		UploadLatencyP90MS   float64
+		DownloadSpeedMBPS    float64
+		DownloadLatencyP90MS float64
+
 		LastAnnouncement time.Time
 		NetAddress       string `gorm:"index"`
 
+		// AliasGroup is shared by hosts that are likely aliases of one
+		// another, it's updated with every successful scan.
+		AliasGroup hash256 `gorm:"index;size:32"`
+
 		Allowlist []dbAllowlistEntry `gorm:"many2many:host_allowlist_entry_hosts;constraint:OnDelete:CASCADE"`
 		Blocklist []dbBlocklistEntry `gorm:"many2many:host_blocklist_entry_hosts;constraint:OnDelete:CASCADE"`
+		Tags      []dbHostTag        `gorm:"constraint:OnDelete:CASCADE"`
+
+		InteractionAggregates []dbHostInteractionAggregate `gorm:"constraint:OnDelete:CASCADE"`
+
+		Notes         string `gorm:"type:text"`
+		ScoreModifier float64
+	}
+
+	// dbHostTag defines a table that stores the tags of a host.
+	dbHostTag struct {
+		Model
+		DBHostID uint   `gorm:"index;uniqueIndex:idx_host_tags_host_tag;NOT NULL"`
+		Tag      string `gorm:"index;uniqueIndex:idx_host_tags_host_tag;NOT NULL;size:255"`
+	}
+
+	// dbHostInteractionAggregate defines a table that stores the number of
+	// successful and failed interactions with a host per period, it allows for
+	// weighing recent interactions more heavily than older ones.
+	dbHostInteractionAggregate struct {
+		Model
+		DBHostID uint  `gorm:"index;uniqueIndex:idx_host_interaction_aggregates_host_period;NOT NULL"`
+		Period   int64 `gorm:"index;uniqueIndex:idx_host_interaction_aggregates_host_period;NOT NULL"` // unix
+
+		SuccessfulInteractions float64
+		FailedInteractions     float64
 	}
 
 	// dbAllowlistEntry defines a table that stores the host blocklist.
@@ -289,12 +334,22 @@ func (dbBlocklistEntry) TableName() string { return "host_blocklist_entries" }
 // TableName implements the gorm.Tabler interface.
 func (dbHostBlocklistEntryHost) TableName() string { return "host_blocklist_entry_hosts" }
 
+// TableName implements the gorm.Tabler interface.
+func (dbHostTag) TableName() string { return "host_tags" }
+
+// TableName implements the gorm.Tabler interface.
+func (dbHostInteractionAggregate) TableName() string { return "host_interaction_aggregates" }
+
 // convert converts a host into a hostdb.Host.
 func (h dbHost) convert() hostdb.Host {
 	var lastScan time.Time
 	if h.LastScan > 0 {
 		lastScan = time.Unix(0, h.LastScan)
 	}
+	var lastMissedProof time.Time
+	if h.LastMissedProof > 0 {
+		lastMissedProof = time.Unix(0, h.LastMissedProof)
+	}
 	return hostdb.Host{
 		KnownSince:       h.CreatedAt,
 		LastAnnouncement: h.LastAnnouncement,
@@ -308,17 +363,52 @@ func (h dbHost) convert() hostdb.Host {
 			Downtime:                h.Downtime,
 			SuccessfulInteractions:  h.SuccessfulInteractions,
 			FailedInteractions:      h.FailedInteractions,
+			MissedProofs:            h.MissedProofs,
+			LastMissedProof:         lastMissedProof,
+			Aggregates:              h.interactionAggregates(),
+		},
+		Performance: hostdb.HostPerformance{
+			UploadSpeedMBPS:      h.UploadSpeedMBPS,
+			UploadLatencyP90MS:   h.UploadLatencyP90MS,
+			DownloadSpeedMBPS:    h.DownloadSpeedMBPS,
+			DownloadLatencyP90MS: h.DownloadLatencyP90MS,
 		},
 		PriceTable: hostdb.HostPriceTable{
 			HostPriceTable: h.PriceTable.convert(),
 			Expiry:         h.PriceTableExpiry.Time,
 		},
-		PublicKey: types.PublicKey(h.PublicKey),
-		Scanned:   h.Scanned,
-		Settings:  h.Settings.convert(),
+		PublicKey:  types.PublicKey(h.PublicKey),
+		AliasGroup: types.Hash256(h.AliasGroup),
+		Scanned:    h.Scanned,
+		Settings:   h.Settings.convert(),
+		Tags:       hostdb.EnrichTags(h.NetAddress, h.tags()),
+
+		Notes:         h.Notes,
+		ScoreModifier: h.ScoreModifier,
 	}
 }
 
+func (h dbHost) interactionAggregates() (aggregates []hostdb.InteractionAggregate) {
+	for _, a := range h.InteractionAggregates {
+		aggregates = append(aggregates, hostdb.InteractionAggregate{
+			Period:                 time.Unix(a.Period, 0).UTC(),
+			SuccessfulInteractions: a.SuccessfulInteractions,
+			FailedInteractions:     a.FailedInteractions,
+		})
+	}
+	sort.Slice(aggregates, func(i, j int) bool {
+		return aggregates[i].Period.Before(aggregates[j].Period)
+	})
+	return
+}
+
+func (h dbHost) tags() (tags []string) {
+	for _, t := range h.Tags {
+		tags = append(tags, t.Tag)
+	}
+	return
+}
+
 func (h *dbHost) BeforeCreate(tx *gorm.DB) (err error) {
 	tx.Statement.AddClause(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "public_key"}},
@@ -370,6 +460,14 @@ func (e *dbBlocklistEntry) AfterCreate(tx *gorm.DB) error {
 		return nil
 	}
 
+	// ranges and wildcards can't be matched in SQL, we match those against
+	// the hosts' addresses in memory
+	if _, ok := api.BlocklistRange(e.Entry); ok {
+		return e.insertBlockedHosts(tx)
+	} else if _, ok := api.BlocklistWildcard(e.Entry); ok {
+		return e.insertBlockedHosts(tx)
+	}
+
 	params := map[string]interface{}{
 		"entry_id":    e.ID,
 		"exact_entry": e.Entry,
@@ -408,6 +506,31 @@ func (e *dbBlocklistEntry) BeforeCreate(tx *gorm.DB) (err error) {
 	return nil
 }
 
+func (e *dbBlocklistEntry) insertBlockedHosts(tx *gorm.DB) error {
+	var hosts []dbHost
+	if err := tx.
+		Model(&dbHost{}).
+		Select("id, net_address").
+		Find(&hosts).
+		Error; err != nil {
+		return err
+	}
+
+	var entries []dbHostBlocklistEntryHost
+	for _, h := range hosts {
+		if e.blocks(h) {
+			entries = append(entries, dbHostBlocklistEntryHost{DBBlocklistEntryID: e.ID, DBHostID: h.ID})
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return tx.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(&entries, 100).
+		Error
+}
+
 func (e *dbBlocklistEntry) blocks(h dbHost) bool {
 	values := []string{h.NetAddress}
 	host, _, err := net.SplitHostPort(h.NetAddress)
@@ -415,6 +538,17 @@ func (e *dbBlocklistEntry) blocks(h dbHost) bool {
 		values = append(values, host)
 	}
 
+	// ranges only block hosts that announced an IP within the range
+	if ipnet, ok := api.BlocklistRange(e.Entry); ok {
+		ip := net.ParseIP(host)
+		return ip != nil && ipnet.Contains(ip)
+	}
+
+	// wildcards only block subdomains
+	if domain, ok := api.BlocklistWildcard(e.Entry); ok {
+		return strings.HasSuffix(host, "."+domain)
+	}
+
 	for _, value := range values {
 		if value == e.Entry || strings.HasSuffix(value, "."+e.Entry) {
 			return true
@@ -431,6 +565,8 @@ func (ss *SQLStore) Host(ctx context.Context, hostKey types.PublicKey) (hostdb.H
 		Where(&dbHost{PublicKey: publicKey(hostKey)}).
 		Preload("Allowlist").
 		Preload("Blocklist").
+		Preload("Tags").
+		Preload("InteractionAggregates").
 		Take(&h)
 	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 		return hostdb.HostInfo{}, api.ErrHostNotFound
@@ -444,6 +580,47 @@ func (ss *SQLStore) Host(ctx context.Context, hostKey types.PublicKey) (hostdb.H
 	}, nil
 }
 
+// HostAliases returns the groups of hosts that are likely aliases of one
+// another, only groups with more than one host are returned.
+func (ss *SQLStore) HostAliases(ctx context.Context) ([]api.HostAliasGroup, error) {
+	var groups []hash256
+	if err := ss.db.
+		WithContext(ctx).
+		Model(&dbHost{}).
+		Where("alias_group != ?", hash256{}).
+		Group("alias_group").
+		Having("COUNT(*) > 1").
+		Pluck("alias_group", &groups).
+		Error; err != nil {
+		return nil, err
+	} else if len(groups) == 0 {
+		return nil, nil
+	}
+
+	var hosts []dbHost
+	if err := ss.db.
+		WithContext(ctx).
+		Select("public_key", "alias_group").
+		Where("alias_group IN ?", groups).
+		Order("id ASC").
+		Find(&hosts).
+		Error; err != nil {
+		return nil, err
+	}
+
+	aliases := make([]api.HostAliasGroup, len(groups))
+	indices := make(map[hash256]int)
+	for i, group := range groups {
+		aliases[i].Group = types.Hash256(group)
+		indices[group] = i
+	}
+	for _, h := range hosts {
+		i := indices[h.AliasGroup]
+		aliases[i].HostKeys = append(aliases[i].HostKeys, types.PublicKey(h.PublicKey))
+	}
+	return aliases, nil
+}
+
 // HostsForScanning returns the address of hosts for scanning.
 func (ss *SQLStore) HostsForScanning(ctx context.Context, maxLastScan time.Time, offset, limit int) ([]hostdb.HostAddress, error) {
 	if offset < 0 {
@@ -518,6 +695,8 @@ func (ss *SQLStore) SearchHosts(ctx context.Context, filterMode, addressContains
 	}
 
 	err := query.
+		Preload("Tags").
+		Preload("InteractionAggregates").
 		Offset(offset).
 		Limit(limit).
 		FindInBatches(&fullHosts, hostRetrievalBatchSize, func(tx *gorm.DB, batch int) error {
@@ -608,65 +787,201 @@ func (ss *SQLStore) UpdateHostAllowlistEntries(ctx context.Context, add, remove
 	}
 	defer ss.updateHasAllowlist(&err)
 
-	// clear allowlist
+	return ss.retryTransaction(func(tx *gorm.DB) error {
+		return updateAllowlistEntries(tx, add, remove, clear)
+	})
+}
+
+func (ss *SQLStore) UpdateHostBlocklistEntries(ctx context.Context, add, remove []string, clear bool) (err error) {
+	// nothing to do
+	if len(add)+len(remove) == 0 && !clear {
+		return nil
+	}
+	defer ss.updateHasBlocklist(&err)
+
+	return ss.retryTransaction(func(tx *gorm.DB) error {
+		return updateBlocklistEntries(tx, add, remove, clear)
+	})
+}
+
+// HostAllowlistUpdateImpact returns the number of hosts and active contracts
+// that would be affected by updating the allowlist with the given entries,
+// without actually updating it.
+func (ss *SQLStore) HostAllowlistUpdateImpact(ctx context.Context, add, remove []types.PublicKey, clear bool) (api.HostListUpdateImpact, error) {
+	return ss.hostListUpdateImpact(ctx, func(tx *gorm.DB) error {
+		return updateAllowlistEntries(tx, add, remove, clear)
+	})
+}
+
+// HostBlocklistUpdateImpact returns the number of hosts and active contracts
+// that would be affected by updating the blocklist with the given entries,
+// without actually updating it.
+func (ss *SQLStore) HostBlocklistUpdateImpact(ctx context.Context, add, remove []string, clear bool) (api.HostListUpdateImpact, error) {
+	return ss.hostListUpdateImpact(ctx, func(tx *gorm.DB) error {
+		return updateBlocklistEntries(tx, add, remove, clear)
+	})
+}
+
+func (ss *SQLStore) hostListUpdateImpact(ctx context.Context, update func(tx *gorm.DB) error) (impact api.HostListUpdateImpact, err error) {
+	err = ss.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before, err := blockedHostIDs(tx)
+		if err != nil {
+			return err
+		}
+		if err := update(tx); err != nil {
+			return err
+		}
+		after, err := blockedHostIDs(tx)
+		if err != nil {
+			return err
+		}
+
+		// a host is affected if it went from allowed to blocked or vice versa
+		var affected []uint
+		for id := range before {
+			if _, ok := after[id]; !ok {
+				affected = append(affected, id)
+			}
+		}
+		for id := range after {
+			if _, ok := before[id]; !ok {
+				affected = append(affected, id)
+			}
+		}
+		impact.Hosts = uint64(len(affected))
+		if len(affected) == 0 {
+			return errRollback
+		}
+
+		var contracts int64
+		if err := tx.
+			Model(&dbContract{}).
+			Where("host_id IN ?", affected).
+			Count(&contracts).
+			Error; err != nil {
+			return err
+		}
+		impact.Contracts = uint64(contracts)
+		return errRollback
+	})
+	if errors.Is(err, errRollback) {
+		err = nil
+	}
+	return
+}
+
+// blockedHostIDs returns the ids of all hosts that are currently blocked,
+// either because they are not on a non-empty allowlist or because they are on
+// the blocklist.
+func blockedHostIDs(tx *gorm.DB) (map[uint]struct{}, error) {
+	var ids []uint
+	if err := tx.
+		Model(&dbHost{}).
+		Where(`(EXISTS (SELECT 1 FROM host_allowlist_entries) AND NOT EXISTS (SELECT 1 FROM host_allowlist_entry_hosts hbeh WHERE hbeh.db_host_id = hosts.id)) OR
+	EXISTS (SELECT 1 FROM host_blocklist_entry_hosts hbeh WHERE hbeh.db_host_id = hosts.id)`).
+		Pluck("id", &ids).
+		Error; err != nil {
+		return nil, err
+	}
+	blocked := make(map[uint]struct{}, len(ids))
+	for _, id := range ids {
+		blocked[id] = struct{}{}
+	}
+	return blocked, nil
+}
+
+// updateAllowlistEntries updates the allowlist, if clear is set the allowlist
+// is cleared before adding the given entries, effectively replacing it.
+func updateAllowlistEntries(tx *gorm.DB, add, remove []types.PublicKey, clear bool) error {
 	if clear {
-		return ss.retryTransaction(func(tx *gorm.DB) error {
-			return tx.Where("TRUE").Delete(&dbAllowlistEntry{}).Error
-		})
+		if err := tx.Where("TRUE").Delete(&dbAllowlistEntry{}).Error; err != nil {
+			return err
+		}
 	}
 
 	var toInsert []dbAllowlistEntry
 	for _, entry := range add {
 		toInsert = append(toInsert, dbAllowlistEntry{Entry: publicKey(entry)})
 	}
+	if len(toInsert) > 0 {
+		if err := tx.Create(&toInsert).Error; err != nil {
+			return err
+		}
+	}
 
 	toDelete := make([]publicKey, len(remove))
 	for i, entry := range remove {
 		toDelete[i] = publicKey(entry)
 	}
-
-	return ss.retryTransaction(func(tx *gorm.DB) error {
-		if len(toInsert) > 0 {
-			if err := tx.Create(&toInsert).Error; err != nil {
-				return err
-			}
-		}
-		if len(toDelete) > 0 {
-			if err := tx.Delete(&dbAllowlistEntry{}, "entry IN ?", toDelete).Error; err != nil {
-				return err
-			}
+	if len(toDelete) > 0 {
+		if err := tx.Delete(&dbAllowlistEntry{}, "entry IN ?", toDelete).Error; err != nil {
+			return err
 		}
-		return nil
-	})
-}
-
-func (ss *SQLStore) UpdateHostBlocklistEntries(ctx context.Context, add, remove []string, clear bool) (err error) {
-	// nothing to do
-	if len(add)+len(remove) == 0 && !clear {
-		return nil
 	}
-	defer ss.updateHasBlocklist(&err)
+	return nil
+}
 
-	// clear blocklist
+// updateBlocklistEntries updates the blocklist, if clear is set the blocklist
+// is cleared before adding the given entries, effectively replacing it.
+func updateBlocklistEntries(tx *gorm.DB, add, remove []string, clear bool) error {
 	if clear {
-		return ss.retryTransaction(func(tx *gorm.DB) error {
-			return tx.Where("TRUE").Delete(&dbBlocklistEntry{}).Error
-		})
+		if err := tx.Where("TRUE").Delete(&dbBlocklistEntry{}).Error; err != nil {
+			return err
+		}
 	}
 
 	var toInsert []dbBlocklistEntry
 	for _, entry := range add {
 		toInsert = append(toInsert, dbBlocklistEntry{Entry: entry})
 	}
+	if len(toInsert) > 0 {
+		if err := tx.Create(&toInsert).Error; err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		if err := tx.Delete(&dbBlocklistEntry{}, "entry IN ?", remove).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// UpdateHostTags updates the tags of the host with the given key, adding and
+// removing the given tags.
+func (ss *SQLStore) UpdateHostTags(ctx context.Context, hostKey types.PublicKey, add, remove []string, clear bool) error {
 	return ss.retryTransaction(func(tx *gorm.DB) error {
-		if len(toInsert) > 0 {
-			if err := tx.Create(&toInsert).Error; err != nil {
+		var hostID uint
+		if err := tx.
+			Model(&dbHost{}).
+			Where("public_key = ?", publicKey(hostKey)).
+			Select("id").
+			Take(&hostID).
+			Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return api.ErrHostNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if clear {
+			if err := tx.Delete(&dbHostTag{}, "db_host_id = ?", hostID).Error; err != nil {
 				return err
 			}
 		}
 		if len(remove) > 0 {
-			if err := tx.Delete(&dbBlocklistEntry{}, "entry IN ?", remove).Error; err != nil {
+			if err := tx.Delete(&dbHostTag{}, "db_host_id = ? AND tag IN ?", hostID, remove).Error; err != nil {
+				return err
+			}
+		}
+		if len(add) > 0 {
+			toInsert := make([]dbHostTag, len(add))
+			for i, tag := range add {
+				toInsert[i] = dbHostTag{DBHostID: hostID, Tag: tag}
+			}
+			if err := tx.
+				Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&toInsert).
+				Error; err != nil {
 				return err
 			}
 		}
@@ -674,6 +989,32 @@ func (ss *SQLStore) UpdateHostBlocklistEntries(ctx context.Context, add, remove
 	})
 }
 
+// UpdateHostNotes updates the notes and score modifier of the host with the
+// given key.
+func (ss *SQLStore) UpdateHostNotes(ctx context.Context, hostKey types.PublicKey, notes string, scoreModifier float64) error {
+	return ss.retryTransaction(func(tx *gorm.DB) error {
+		var hostID uint
+		if err := tx.
+			Model(&dbHost{}).
+			Where("public_key = ?", publicKey(hostKey)).
+			Select("id").
+			Take(&hostID).
+			Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return api.ErrHostNotFound
+		} else if err != nil {
+			return err
+		}
+		return tx.
+			Model(&dbHost{}).
+			Where("id = ?", hostID).
+			Updates(map[string]interface{}{
+				"notes":          notes,
+				"score_modifier": scoreModifier,
+			}).
+			Error
+	})
+}
+
 func (ss *SQLStore) HostAllowlist(ctx context.Context) (allowlist []types.PublicKey, err error) {
 	var pubkeys []publicKey
 	err = ss.db.
@@ -738,6 +1079,8 @@ func (ss *SQLStore) RecordHostScans(ctx context.Context, scans []hostdb.HostScan
 	// Write the interactions and update to the hosts atomically within a single
 	// transaction.
 	return ss.retryTransaction(func(tx *gorm.DB) error {
+		aggregates := make(interactionAggregates)
+
 		// Handle scans
 		for _, scan := range scans {
 			host, exists := hostMap[publicKey(scan.HostKey)]
@@ -745,6 +1088,7 @@ func (ss *SQLStore) RecordHostScans(ctx context.Context, scans []hostdb.HostScan
 				continue // host doesn't exist
 			}
 			lastScan := time.Unix(0, host.LastScan)
+			aggregates.add(host.ID, scan.Timestamp, scan.Success)
 
 			if scan.Success {
 				// Handle successful scan.
@@ -759,6 +1103,7 @@ func (ss *SQLStore) RecordHostScans(ctx context.Context, scans []hostdb.HostScan
 				// received through the host announcement
 				scan.Settings.NetAddress = host.NetAddress
 				host.Settings = convertHostSettings(scan.Settings)
+				host.AliasGroup = hash256(hostdb.AliasGroup(host.NetAddress, scan.Settings))
 
 				// scans can only update the price table if the current
 				// pricetable is expired anyway, ensuring scans never
@@ -807,6 +1152,7 @@ func (ss *SQLStore) RecordHostScans(ctx context.Context, scans []hostdb.HostScan
 					"uptime":                      h.Uptime,
 					"last_scan":                   h.LastScan,
 					"settings":                    h.Settings,
+					"alias_group":                 h.AliasGroup,
 					"price_table":                 h.PriceTable,
 					"price_table_expiry":          h.PriceTableExpiry,
 					"successful_interactions":     h.SuccessfulInteractions,
@@ -816,7 +1162,7 @@ func (ss *SQLStore) RecordHostScans(ctx context.Context, scans []hostdb.HostScan
 				return err
 			}
 		}
-		return nil
+		return aggregates.persist(tx)
 	})
 }
 
@@ -864,12 +1210,15 @@ func (ss *SQLStore) RecordPriceTables(ctx context.Context, priceTableUpdate []ho
 	// Write the interactions and update to the hosts atomically within a single
 	// transaction.
 	return ss.retryTransaction(func(tx *gorm.DB) error {
+		aggregates := make(interactionAggregates)
+
 		// Handle price table updates
 		for _, ptu := range priceTableUpdate {
 			host, exists := hostMap[publicKey(ptu.HostKey)]
 			if !exists {
 				continue // host doesn't exist
 			}
+			aggregates.add(host.ID, ptu.Timestamp, ptu.Success)
 			if ptu.Success {
 				// Handle successful update.
 				host.SuccessfulInteractions++
@@ -907,10 +1256,57 @@ func (ss *SQLStore) RecordPriceTables(ctx context.Context, priceTableUpdate []ho
 				return err
 			}
 		}
-		return nil
+		return aggregates.persist(tx)
 	})
 }
 
+// interactionAggregates accumulates the interactions of a batch per host and
+// period before they are added to the aggregates in the database.
+type interactionAggregates map[interactionAggregateKey]struct{ success, fail float64 }
+
+type interactionAggregateKey struct {
+	hostID uint
+	period int64
+}
+
+func (ia interactionAggregates) add(hostID uint, timestamp time.Time, success bool) {
+	key := interactionAggregateKey{
+		hostID: hostID,
+		period: timestamp.Truncate(hostdb.InteractionAggregatePeriod).Unix(),
+	}
+	counts := ia[key]
+	if success {
+		counts.success++
+	} else {
+		counts.fail++
+	}
+	ia[key] = counts
+}
+
+// persist adds the accumulated interactions to the aggregates in the database
+// and prunes the aggregates that fell out of the retention window.
+func (ia interactionAggregates) persist(tx *gorm.DB) error {
+	for key, counts := range ia {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "db_host_id"}, {Name: "period"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"successful_interactions": gorm.Expr("successful_interactions + ?", counts.success),
+				"failed_interactions":     gorm.Expr("failed_interactions + ?", counts.fail),
+			}),
+		}).Create(&dbHostInteractionAggregate{
+			DBHostID:               key.hostID,
+			Period:                 key.period,
+			SuccessfulInteractions: counts.success,
+			FailedInteractions:     counts.fail,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update interaction aggregates: %w", err)
+		}
+	}
+	cutoff := time.Now().Add(-hostdb.InteractionAggregatesRetention).Truncate(hostdb.InteractionAggregatePeriod).Unix()
+	return tx.Where("period < ?", cutoff).Delete(&dbHostInteractionAggregate{}).Error
+}
+
 func (ss *SQLStore) processConsensusChangeHostDB(cc modules.ConsensusChange) {
 	height := uint64(cc.InitialHeight())
 	for range cc.RevertedBlocks {
@@ -1049,6 +1445,47 @@ func updateProofHeight(db *gorm.DB, fcid types.FileContractID, blockHeight uint6
 	})
 }
 
+// recordMissedProofs records a missed proof for the host of every archived
+// contract that wasn't renewed, contains data and whose proof window ended
+// before the given height without a storage proof being submitted.
+func recordMissedProofs(tx *gorm.DB, height uint64) error {
+	var contracts []dbArchivedContract
+	if err := tx.
+		Model(&dbArchivedContract{}).
+		Where("proof_checked = ? AND window_end < ?", false, height).
+		Find(&contracts).
+		Error; err != nil {
+		return err
+	}
+	if len(contracts) == 0 {
+		return nil
+	}
+
+	now := time.Now().UnixNano()
+	for _, c := range contracts {
+		if c.missedProof() {
+			if err := tx.
+				Model(&dbHost{}).
+				Where("public_key = ?", c.Host).
+				Updates(map[string]interface{}{
+					"missed_proofs":     gorm.Expr("missed_proofs + 1"),
+					"last_missed_proof": now,
+				}).
+				Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.
+			Model(&dbArchivedContract{}).
+			Where("id = ?", c.ID).
+			Update("proof_checked", true).
+			Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func updateActiveAndArchivedContract(tx *gorm.DB, fcid types.FileContractID, updates map[string]interface{}) error {
 	err1 := tx.Model(&dbContract{}).
 		Where("fcid = ?", fileContractID(fcid)).
@@ -149,7 +149,7 @@ func TestSQLHostDB(t *testing.T) {
 	// Connect to the same DB again.
 	conn2 := NewEphemeralSQLiteConnection(dbName)
 	am := alerts.WithOrigin(alerts.NewManager(), "test")
-	hdb2, ccid, err := NewSQLStore(conn2, am, dir, false, time.Second, types.Address{}, 0, zap.NewNop().Sugar(), nil)
+	hdb2, ccid, err := NewSQLStore(conn2, am, dir, false, time.Second, types.Address{}, nil, 0, 0, zap.NewNop().Sugar(), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -314,7 +314,7 @@ func TestRecordScan(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if host.Interactions != (hostdb.Interactions{}) {
+	if !reflect.DeepEqual(host.Interactions, hostdb.Interactions{}) {
 		t.Fatal("mismatch")
 	}
 	if host.Settings != (rhpv2.HostSettings{}) {
@@ -330,6 +330,22 @@ func TestRecordScan(t *testing.T) {
 		t.Fatal("creation time not set")
 	}
 
+	// assertAggregates asserts the host's aggregated interactions add up to
+	// the totals and clears them so the interactions can be compared.
+	assertAggregates := func() {
+		t.Helper()
+		interactions := host.Interactions
+		var success, fail float64
+		for _, a := range interactions.Aggregates {
+			success += a.SuccessfulInteractions
+			fail += a.FailedInteractions
+		}
+		if success != interactions.SuccessfulInteractions || fail != interactions.FailedInteractions {
+			t.Fatal("aggregates don't add up", interactions.Aggregates)
+		}
+		host.Interactions.Aggregates = nil
+	}
+
 	// Record a scan.
 	firstScanTime := time.Now().UTC()
 	settings := rhpv2.HostSettings{NetAddress: "host.com"}
@@ -348,6 +364,7 @@ func TestRecordScan(t *testing.T) {
 		t.Fatal("wrong time")
 	}
 	host.Interactions.LastScan = time.Time{}
+	assertAggregates()
 	if expected := (hostdb.Interactions{
 		TotalScans:              1,
 		LastScan:                time.Time{},
@@ -357,7 +374,7 @@ func TestRecordScan(t *testing.T) {
 		Downtime:                downtime,
 		SuccessfulInteractions:  1,
 		FailedInteractions:      0,
-	}); host.Interactions != expected {
+	}); !reflect.DeepEqual(host.Interactions, expected) {
 		t.Fatal("mismatch", cmp.Diff(host.Interactions, expected))
 	}
 	if !reflect.DeepEqual(host.Settings, settings) {
@@ -378,7 +395,8 @@ func TestRecordScan(t *testing.T) {
 	}
 	host.Interactions.LastScan = time.Time{}
 	uptime += secondScanTime.Sub(firstScanTime)
-	if host.Interactions != (hostdb.Interactions{
+	assertAggregates()
+	if !reflect.DeepEqual(host.Interactions, hostdb.Interactions{
 		TotalScans:              2,
 		LastScan:                time.Time{},
 		LastScanSuccess:         true,
@@ -405,7 +423,8 @@ func TestRecordScan(t *testing.T) {
 	}
 	host.Interactions.LastScan = time.Time{}
 	downtime += thirdScanTime.Sub(secondScanTime)
-	if host.Interactions != (hostdb.Interactions{
+	assertAggregates()
+	if !reflect.DeepEqual(host.Interactions, hostdb.Interactions{
 		TotalScans:              3,
 		LastScan:                time.Time{},
 		LastScanSuccess:         false,
@@ -1030,6 +1049,80 @@ func TestSQLHostBlocklist(t *testing.T) {
 	}
 }
 
+// TestRecordMissedProofs tests that hosts are penalized for archived contracts
+// whose proof window ended without a storage proof.
+func TestRecordMissedProofs(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// add four hosts with a contract each and archive them
+	hks, err := ss.addTestHosts(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := ss.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.ArchiveContracts(ctx, map[types.FileContractID]string{
+		fcids[0]: "expired",
+		fcids[1]: api.ContractArchivalReasonRenewed,
+		fcids[2]: "expired",
+		fcids[3]: "expired",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the third contract has a proof, the fourth one has no data
+	for i, fcid := range fcids {
+		updates := map[string]interface{}{"window_end": 100, "size": 1}
+		if i == 2 {
+			updates["proof_height"] = 90
+		} else if i == 3 {
+			updates["size"] = 0
+		}
+		if err := ss.db.Model(&dbArchivedContract{}).Where("fcid = ?", fileContractID(fcid)).Updates(updates).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	missedProofs := func() []uint64 {
+		t.Helper()
+		var missed []uint64
+		for _, hk := range hks {
+			h, err := ss.Host(ctx, hk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			missed = append(missed, h.Interactions.MissedProofs)
+			if (h.Interactions.MissedProofs > 0) != !h.Interactions.LastMissedProof.IsZero() {
+				t.Fatal("unexpected last missed proof", h.Interactions.LastMissedProof)
+			}
+		}
+		return missed
+	}
+
+	// assert nothing is recorded before the window ends
+	if err := recordMissedProofs(ss.db, 100); err != nil {
+		t.Fatal(err)
+	} else if missed := missedProofs(); !reflect.DeepEqual(missed, []uint64{0, 0, 0, 0}) {
+		t.Fatal("unexpected missed proofs", missed)
+	}
+
+	// assert only the first host missed a proof once the window ended and
+	// that contracts are only checked once
+	for i := 0; i < 2; i++ {
+		if err := recordMissedProofs(ss.db, 101); err != nil {
+			t.Fatal(err)
+		} else if missed := missedProofs(); !reflect.DeepEqual(missed, []uint64{1, 0, 0, 0}) {
+			t.Fatal("unexpected missed proofs", missed)
+		}
+	}
+}
+
 func TestSQLHostBlocklistBasic(t *testing.T) {
 	hdb, _, _, err := newTestSQLStore(t.TempDir())
 	if err != nil {
@@ -1068,6 +1161,352 @@ func TestSQLHostBlocklistBasic(t *testing.T) {
 	}
 }
 
+// TestSQLHostBlocklistRangesAndWildcards tests blocking hosts by CIDR range
+// and wildcard domain.
+func TestSQLHostBlocklistRangesAndWildcards(t *testing.T) {
+	hdb, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// add hosts
+	hk1, hk2, hk3, hk4 := types.PublicKey{1}, types.PublicKey{2}, types.PublicKey{3}, types.PublicKey{4}
+	for hk, addr := range map[types.PublicKey]string{
+		hk1: "10.0.1.1:1000",
+		hk2: "10.1.0.1:1000",
+		hk3: "foo.bar.com:1000",
+		hk4: "bar.com:1000",
+	} {
+		if err := hdb.addCustomTestHost(hk, addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	isBlocked := func(hk types.PublicKey) bool {
+		t.Helper()
+		host, err := hdb.Host(ctx, hk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return host.Blocked
+	}
+
+	// block a range and a wildcard domain
+	if err := hdb.UpdateHostBlocklistEntries(ctx, []string{"10.0.0.0/16", "*.bar.com"}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if !isBlocked(hk1) || isBlocked(hk2) {
+		t.Fatal("unexpected range blocking")
+	} else if !isBlocked(hk3) || isBlocked(hk4) {
+		t.Fatal("unexpected wildcard blocking")
+	}
+
+	// assert announcing a host within the range blocks it
+	if err := hdb.addCustomTestHost(hk2, "10.0.2.1:1000"); err != nil {
+		t.Fatal(err)
+	} else if !isBlocked(hk2) {
+		t.Fatal("expected host to be blocked after announcing in range")
+	}
+
+	// remove the entries and assert the hosts are unblocked
+	if err := hdb.UpdateHostBlocklistEntries(ctx, nil, []string{"10.0.0.0/16", "*.bar.com"}, false); err != nil {
+		t.Fatal(err)
+	} else if isBlocked(hk1) || isBlocked(hk2) || isBlocked(hk3) {
+		t.Fatal("expected hosts to be unblocked")
+	}
+}
+
+// TestSQLHostListUpdateImpact tests previewing and replacing the host allow-
+// and blocklists.
+func TestSQLHostListUpdateImpact(t *testing.T) {
+	hdb, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// add two hosts and a contract with the first one
+	hk1, hk2 := types.PublicKey{1}, types.PublicKey{2}
+	if err := hdb.addCustomTestHost(hk1, "foo.bar.com:1000"); err != nil {
+		t.Fatal(err)
+	} else if err := hdb.addCustomTestHost(hk2, "bar.baz.com:1000"); err != nil {
+		t.Fatal(err)
+	} else if _, err := hdb.addTestContract(types.FileContractID{1}, hk1); err != nil {
+		t.Fatal(err)
+	}
+
+	// preview blocking the first host
+	impact, err := hdb.HostBlocklistUpdateImpact(ctx, []string{"bar.com"}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	} else if impact.Hosts != 1 || impact.Contracts != 1 {
+		t.Fatal("unexpected impact", impact)
+	}
+
+	// assert the blocklist wasn't updated
+	if blocklist, err := hdb.HostBlocklist(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(blocklist) != 0 {
+		t.Fatal("unexpected blocklist", blocklist)
+	} else if host, err := hdb.Host(ctx, hk1); err != nil {
+		t.Fatal(err)
+	} else if host.Blocked {
+		t.Fatal("host should not be blocked")
+	}
+
+	// block the first host
+	if err := hdb.UpdateHostBlocklistEntries(ctx, []string{"bar.com"}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// preview replacing the blocklist, both hosts are affected
+	impact, err = hdb.HostBlocklistUpdateImpact(ctx, []string{"baz.com"}, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	} else if impact.Hosts != 2 || impact.Contracts != 1 {
+		t.Fatal("unexpected impact", impact)
+	}
+
+	// replace the blocklist
+	if err := hdb.UpdateHostBlocklistEntries(ctx, []string{"baz.com"}, nil, true); err != nil {
+		t.Fatal(err)
+	} else if blocklist, err := hdb.HostBlocklist(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(blocklist) != 1 || blocklist[0] != "baz.com" {
+		t.Fatal("unexpected blocklist", blocklist)
+	} else if host, err := hdb.Host(ctx, hk1); err != nil {
+		t.Fatal(err)
+	} else if host.Blocked {
+		t.Fatal("host should not be blocked")
+	} else if host, err := hdb.Host(ctx, hk2); err != nil {
+		t.Fatal(err)
+	} else if !host.Blocked {
+		t.Fatal("host should be blocked")
+	}
+
+	// preview an allowlist only containing the first host, this blocks the
+	// already blocked second host so no host is affected
+	impact, err = hdb.HostAllowlistUpdateImpact(ctx, []types.PublicKey{hk1}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	} else if impact.Hosts != 0 || impact.Contracts != 0 {
+		t.Fatal("unexpected impact", impact)
+	}
+
+	// preview an allowlist only containing the second host
+	impact, err = hdb.HostAllowlistUpdateImpact(ctx, []types.PublicKey{hk2}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	} else if impact.Hosts != 1 || impact.Contracts != 1 {
+		t.Fatal("unexpected impact", impact)
+	}
+}
+
+func TestSQLHostTags(t *testing.T) {
+	hdb, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	// updating the tags of an unknown host should fail
+	hk := types.GeneratePrivateKey().PublicKey()
+	if err := hdb.UpdateHostTags(ctx, hk, []string{"region:eu"}, nil, false); !errors.Is(err, api.ErrHostNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// add a host
+	if err := hdb.addTestHost(hk); err != nil {
+		t.Fatal(err)
+	}
+
+	// assertTags is a helper to assert the host's tags
+	assertTags := func(expected ...string) {
+		t.Helper()
+		h, err := hdb.Host(ctx, hk)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(h.Tags, expected) {
+			t.Fatalf("unexpected tags, %v != %v", h.Tags, expected)
+		}
+		hosts, err := hdb.SearchHosts(ctx, api.HostFilterModeAll, "", []types.PublicKey{hk}, 0, -1)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(hosts) != 1 || !reflect.DeepEqual(hosts[0].Tags, expected) {
+			t.Fatalf("unexpected tags, %v != %v", hosts, expected)
+		}
+	}
+	assertTags()
+
+	// add tags, adding a tag twice is a no-op
+	if err := hdb.UpdateHostTags(ctx, hk, []string{"region:eu", "provider:hetzner"}, nil, false); err != nil {
+		t.Fatal(err)
+	} else if err := hdb.UpdateHostTags(ctx, hk, []string{"region:eu"}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	assertTags("region:eu", "provider:hetzner")
+
+	// remove a tag
+	if err := hdb.UpdateHostTags(ctx, hk, nil, []string{"region:eu"}, false); err != nil {
+		t.Fatal(err)
+	}
+	assertTags("provider:hetzner")
+
+	// clear the tags
+	if err := hdb.UpdateHostTags(ctx, hk, nil, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	assertTags()
+
+	// add a tag and remove the host, the tag should be removed too
+	if err := hdb.UpdateHostTags(ctx, hk, []string{"region:us"}, nil, false); err != nil {
+		t.Fatal(err)
+	} else if err := hdb.db.Where("public_key = ?", publicKey(hk)).Delete(&dbHost{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var cnt int64
+	if err := hdb.db.Model(&dbHostTag{}).Count(&cnt).Error; err != nil {
+		t.Fatal(err)
+	} else if cnt != 0 {
+		t.Fatalf("expected no tags, got %d", cnt)
+	}
+
+	// add a host that announced a hostname, it should be tagged with its
+	// domain automatically
+	hk = types.GeneratePrivateKey().PublicKey()
+	if err := hdb.addCustomTestHost(hk, "host1.EU.example.co.uk:9982"); err != nil {
+		t.Fatal(err)
+	}
+	assertTags("domain:example.co.uk")
+
+	// assert manual tags take precedence over automatic ones
+	if err := hdb.UpdateHostTags(ctx, hk, []string{"domain:example.com", "region:eu"}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	assertTags("domain:example.com", "region:eu")
+
+	// assert hosts that announced an IP aren't tagged
+	hk = types.GeneratePrivateKey().PublicKey()
+	if err := hdb.addCustomTestHost(hk, "1.2.3.4:9982"); err != nil {
+		t.Fatal(err)
+	}
+	assertTags()
+}
+
+func TestSQLHostNotes(t *testing.T) {
+	hdb, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	// updating the notes of an unknown host should fail
+	hk := types.GeneratePrivateKey().PublicKey()
+	if err := hdb.UpdateHostNotes(ctx, hk, "my own host", 0.2); !errors.Is(err, api.ErrHostNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// add a host
+	if err := hdb.addTestHost(hk); err != nil {
+		t.Fatal(err)
+	}
+
+	// assertNotes is a helper to assert the host's notes and score modifier
+	assertNotes := func(notes string, modifier float64) {
+		t.Helper()
+		h, err := hdb.Host(ctx, hk)
+		if err != nil {
+			t.Fatal(err)
+		} else if h.Notes != notes || h.ScoreModifier != modifier {
+			t.Fatalf("unexpected notes, '%v' (%v) != '%v' (%v)", h.Notes, h.ScoreModifier, notes, modifier)
+		}
+	}
+	assertNotes("", 0)
+
+	// update the notes, updating them twice with the same values is fine
+	if err := hdb.UpdateHostNotes(ctx, hk, "my own host", 0.2); err != nil {
+		t.Fatal(err)
+	} else if err := hdb.UpdateHostNotes(ctx, hk, "my own host", 0.2); err != nil {
+		t.Fatal(err)
+	}
+	assertNotes("my own host", 0.2)
+
+	// reset the notes
+	if err := hdb.UpdateHostNotes(ctx, hk, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	assertNotes("", 0)
+}
+
+func TestSQLHostAliases(t *testing.T) {
+	hdb, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// add three hosts, two of them on the same machine
+	hk1, hk2, hk3 := types.PublicKey{1}, types.PublicKey{2}, types.PublicKey{3}
+	if err := hdb.addCustomTestHost(hk1, "host.com:9982"); err != nil {
+		t.Fatal(err)
+	} else if err := hdb.addCustomTestHost(hk2, "host.com:9992"); err != nil {
+		t.Fatal(err)
+	} else if err := hdb.addCustomTestHost(hk3, "other.com:9982"); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert hosts that weren't scanned are not aliases
+	if aliases, err := hdb.HostAliases(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(aliases) != 0 {
+		t.Fatal("unexpected aliases", aliases)
+	}
+
+	// scan the hosts with identical settings, the ports differ
+	settings := func(siamuxPort string, remaining uint64) rhpv2.HostSettings {
+		return rhpv2.HostSettings{
+			StoragePrice:     types.Siacoins(1),
+			SiaMuxPort:       siamuxPort,
+			RemainingStorage: remaining,
+			Version:          "1.6.0",
+		}
+	}
+	now := time.Now()
+	if err := hdb.RecordHostScans(ctx, []hostdb.HostScan{
+		newTestScan(hk1, now, settings("9983", 100), true),
+		newTestScan(hk2, now, settings("9993", 200), true),
+		newTestScan(hk3, now, settings("9983", 100), true),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the hosts on the same machine are grouped
+	aliases, err := hdb.HostAliases(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(aliases) != 1 || len(aliases[0].HostKeys) != 2 || aliases[0].HostKeys[0] != hk1 || aliases[0].HostKeys[1] != hk2 {
+		t.Fatal("unexpected aliases", aliases)
+	} else if h, err := hdb.Host(ctx, hk1); err != nil {
+		t.Fatal(err)
+	} else if h.AliasGroup != aliases[0].Group {
+		t.Fatal("unexpected alias group", h.AliasGroup)
+	}
+
+	// assert hosts with different settings are not grouped
+	s := settings("9993", 200)
+	s.StoragePrice = types.Siacoins(2)
+	if err := hdb.RecordHostScans(ctx, []hostdb.HostScan{newTestScan(hk2, now.Add(time.Minute), s, true)}); err != nil {
+		t.Fatal(err)
+	} else if aliases, err := hdb.HostAliases(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(aliases) != 0 {
+		t.Fatal("unexpected aliases", aliases)
+	}
+}
+
 // addTestHosts adds 'n' hosts to the db and returns their keys.
 func (s *SQLStore) addTestHosts(n int) (keys []types.PublicKey, err error) {
 	cnt, err := s.contractsCount()
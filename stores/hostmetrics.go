@@ -0,0 +1,165 @@
+package stores
+
+import (
+	"context"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+	"gorm.io/gorm"
+)
+
+const (
+	// hostMetricsRetention is the amount of time host metrics are kept
+	// around before they are pruned.
+	hostMetricsRetention = 7 * 24 * time.Hour
+
+	// hostPerformanceWindow is the window over which the host metrics are
+	// averaged to compute a host's performance.
+	hostPerformanceWindow = 24 * time.Hour
+)
+
+type (
+	// dbHostMetric defines a table that stores snapshots of the performance
+	// of a host as observed by a worker.
+	dbHostMetric struct {
+		Model
+
+		Timestamp int64     `gorm:"index;NOT NULL"` // unix milli
+		HostKey   publicKey `gorm:"index;NOT NULL;size:32"`
+		Worker    string    `gorm:"index;NOT NULL"`
+
+		UploadSpeedMBPS      float64
+		UploadLatencyP90MS   float64
+		DownloadSpeedMBPS    float64
+		DownloadLatencyP90MS float64
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbHostMetric) TableName() string { return "host_metrics" }
+
+func (m dbHostMetric) convert() api.HostMetric {
+	return api.HostMetric{
+		Timestamp: api.TimeRFC3339(time.UnixMilli(m.Timestamp).UTC()),
+		Worker:    m.Worker,
+		HostKey:   types.PublicKey(m.HostKey),
+		HostPerformance: hostdb.HostPerformance{
+			UploadSpeedMBPS:      m.UploadSpeedMBPS,
+			UploadLatencyP90MS:   m.UploadLatencyP90MS,
+			DownloadSpeedMBPS:    m.DownloadSpeedMBPS,
+			DownloadLatencyP90MS: m.DownloadLatencyP90MS,
+		},
+	}
+}
+
+// RecordHostMetrics stores the given host metrics and updates the performance
+// of the affected hosts, which is the average of their non-zero metrics within
+// the performance window. Metrics that are older than the retention period are
+// pruned.
+func (s *SQLStore) RecordHostMetrics(ctx context.Context, metrics []api.HostMetric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		tx = tx.WithContext(ctx)
+
+		// insert the metrics
+		hks := make(map[types.PublicKey]struct{})
+		dbMetrics := make([]dbHostMetric, len(metrics))
+		for i, m := range metrics {
+			dbMetrics[i] = dbHostMetric{
+				Timestamp:            time.Time(m.Timestamp).UnixMilli(),
+				HostKey:              publicKey(m.HostKey),
+				Worker:               m.Worker,
+				UploadSpeedMBPS:      m.UploadSpeedMBPS,
+				UploadLatencyP90MS:   m.UploadLatencyP90MS,
+				DownloadSpeedMBPS:    m.DownloadSpeedMBPS,
+				DownloadLatencyP90MS: m.DownloadLatencyP90MS,
+			}
+			hks[m.HostKey] = struct{}{}
+		}
+		if err := tx.CreateInBatches(&dbMetrics, 100).Error; err != nil {
+			return err
+		}
+
+		// prune old metrics
+		if err := tx.
+			Where("timestamp < ?", now.Add(-hostMetricsRetention).UnixMilli()).
+			Delete(&dbHostMetric{}).
+			Error; err != nil {
+			return err
+		}
+
+		// update the performance of the hosts
+		for hk := range hks {
+			var perf struct {
+				UploadSpeedMBPS      float64
+				UploadLatencyP90MS   float64
+				DownloadSpeedMBPS    float64
+				DownloadLatencyP90MS float64
+			}
+			if err := tx.
+				Model(&dbHostMetric{}).
+				Select(`COALESCE(AVG(NULLIF(upload_speed_mbps, 0)), 0) as upload_speed_mbps,
+				COALESCE(AVG(NULLIF(upload_latency_p90_ms, 0)), 0) as upload_latency_p90_ms,
+				COALESCE(AVG(NULLIF(download_speed_mbps, 0)), 0) as download_speed_mbps,
+				COALESCE(AVG(NULLIF(download_latency_p90_ms, 0)), 0) as download_latency_p90_ms`).
+				Where("host_key = ? AND timestamp >= ?", publicKey(hk), now.Add(-hostPerformanceWindow).UnixMilli()).
+				Scan(&perf).
+				Error; err != nil {
+				return err
+			}
+			if err := tx.
+				Model(&dbHost{}).
+				Where("public_key = ?", publicKey(hk)).
+				Select("UploadSpeedMBPS", "UploadLatencyP90MS", "DownloadSpeedMBPS", "DownloadLatencyP90MS").
+				Updates(dbHost{
+					UploadSpeedMBPS:      perf.UploadSpeedMBPS,
+					UploadLatencyP90MS:   perf.UploadLatencyP90MS,
+					DownloadSpeedMBPS:    perf.DownloadSpeedMBPS,
+					DownloadLatencyP90MS: perf.DownloadLatencyP90MS,
+				}).
+				Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// HostMetrics returns the host metrics that were recorded within [from, to),
+// optionally filtered by host and worker. A zero 'to' returns all metrics
+// recorded after 'from'.
+func (s *SQLStore) HostMetrics(ctx context.Context, from, to time.Time, hostKey types.PublicKey, worker string) ([]api.HostMetric, error) {
+	query := s.db.
+		WithContext(ctx).
+		Model(&dbHostMetric{}).
+		Where("timestamp >= ?", from.UnixMilli())
+	if !to.IsZero() {
+		query = query.Where("timestamp < ?", to.UnixMilli())
+	}
+	if hostKey != (types.PublicKey{}) {
+		query = query.Where("host_key = ?", publicKey(hostKey))
+	}
+	if worker != "" {
+		query = query.Where("worker = ?", worker)
+	}
+
+	var metrics []dbHostMetric
+	if err := query.
+		Order("timestamp ASC").
+		Find(&metrics).
+		Error; err != nil {
+		return nil, err
+	}
+
+	resp := make([]api.HostMetric, len(metrics))
+	for i, m := range metrics {
+		resp[i] = m.convert()
+	}
+	return resp, nil
+}
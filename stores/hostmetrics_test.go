@@ -0,0 +1,85 @@
+package stores
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+)
+
+func TestHostMetrics(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := ss.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// record metrics for the first host, the metric of the second worker
+	// didn't observe any downloads and the first metric is outside of the
+	// performance window
+	now := time.Now().Truncate(time.Millisecond)
+	metric := func(timestamp time.Time, worker string, perf hostdb.HostPerformance) api.HostMetric {
+		return api.HostMetric{
+			Timestamp:       api.TimeRFC3339(timestamp),
+			Worker:          worker,
+			HostKey:         hks[0],
+			HostPerformance: perf,
+		}
+	}
+	if err := ss.RecordHostMetrics(ctx, []api.HostMetric{
+		metric(now.Add(-2*hostPerformanceWindow), "w1", hostdb.HostPerformance{UploadSpeedMBPS: 100, DownloadSpeedMBPS: 100}),
+		metric(now.Add(-time.Minute), "w1", hostdb.HostPerformance{UploadSpeedMBPS: 10, UploadLatencyP90MS: 100, DownloadSpeedMBPS: 20, DownloadLatencyP90MS: 200}),
+		metric(now, "w2", hostdb.HostPerformance{UploadSpeedMBPS: 20, UploadLatencyP90MS: 300}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the performance of the host was updated
+	h, err := ss.Host(ctx, hks[0])
+	if err != nil {
+		t.Fatal(err)
+	} else if h.Performance != (hostdb.HostPerformance{UploadSpeedMBPS: 15, UploadLatencyP90MS: 200, DownloadSpeedMBPS: 20, DownloadLatencyP90MS: 200}) {
+		t.Fatal("unexpected performance", h.Performance)
+	}
+
+	// assert the other host wasn't affected
+	h, err = ss.Host(ctx, hks[1])
+	if err != nil {
+		t.Fatal(err)
+	} else if h.Performance != (hostdb.HostPerformance{}) {
+		t.Fatal("unexpected performance", h.Performance)
+	}
+
+	// assert we can filter by host, worker and range
+	if metrics, err := ss.HostMetrics(ctx, time.Time{}, time.Time{}, hks[0], ""); err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 3 {
+		t.Fatal("unexpected number of metrics", len(metrics))
+	} else if metrics, err := ss.HostMetrics(ctx, time.Time{}, time.Time{}, hks[1], ""); err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 0 {
+		t.Fatal("unexpected number of metrics", len(metrics))
+	} else if metrics, err := ss.HostMetrics(ctx, now.Add(-time.Hour), time.Time{}, hks[0], "w1"); err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 1 || metrics[0].DownloadLatencyP90MS != 200 || !time.Time(metrics[0].Timestamp).Equal(now.Add(-time.Minute)) {
+		t.Fatal("unexpected metrics", metrics)
+	}
+
+	// assert old metrics are pruned
+	if err := ss.RecordHostMetrics(ctx, []api.HostMetric{
+		metric(now.Add(-2*hostMetricsRetention), "w1", hostdb.HostPerformance{UploadSpeedMBPS: 100}),
+	}); err != nil {
+		t.Fatal(err)
+	} else if metrics, err := ss.HostMetrics(ctx, time.Time{}, time.Time{}, hks[0], ""); err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 3 {
+		t.Fatal("unexpected number of metrics", len(metrics))
+	}
+}
@@ -0,0 +1,122 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	// dbIdempotentResponse is the recorded response to a bus request that
+	// carried an idempotency key.
+	dbIdempotentResponse struct {
+		Model
+
+		IdempotencyKey string  `gorm:"unique;NOT NULL;size:255"`
+		Fingerprint    hash256 `gorm:"NOT NULL;size:32"`
+		Status         int     `gorm:"NOT NULL"`
+		Header         string  `gorm:"type:text"`
+		Body           []byte
+		Expiry         time.Time `gorm:"index;NOT NULL"`
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbIdempotentResponse) TableName() string { return "idempotent_responses" }
+
+// IdempotentResponse returns the response that was recorded for the given
+// idempotency key.
+func (s *SQLStore) IdempotentResponse(ctx context.Context, key string) (api.IdempotentResponse, error) {
+	var row dbIdempotentResponse
+	err := s.db.
+		WithContext(ctx).
+		Where("idempotency_key = ?", key).
+		Take(&row).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return api.IdempotentResponse{}, api.ErrIdempotentResponseNotFound
+	} else if err != nil {
+		return api.IdempotentResponse{}, err
+	}
+
+	resp := api.IdempotentResponse{
+		Fingerprint: types.Hash256(row.Fingerprint),
+		Status:      row.Status,
+		Body:        row.Body,
+		Expiry:      row.Expiry.UTC(),
+	}
+	if row.Header != "" {
+		if err := json.Unmarshal([]byte(row.Header), &resp.Header); err != nil {
+			return api.IdempotentResponse{}, fmt.Errorf("failed to unmarshal header of idempotent response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// RecordIdempotentResponse records the response for the given idempotency
+// key, overwriting a previously recorded response.
+func (s *SQLStore) RecordIdempotentResponse(ctx context.Context, key string, resp api.IdempotentResponse) error {
+	header, err := json.Marshal(resp.Header)
+	if err != nil {
+		return fmt.Errorf("failed to marshal header of idempotent response: %w", err)
+	}
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		return tx.
+			WithContext(ctx).
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "idempotency_key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"fingerprint", "status", "header", "body", "expiry"}),
+			}).
+			Create(&dbIdempotentResponse{
+				IdempotencyKey: key,
+				Fingerprint:    hash256(resp.Fingerprint),
+				Status:         resp.Status,
+				Header:         string(header),
+				Body:           resp.Body,
+				Expiry:         resp.Expiry.UTC(),
+			}).
+			Error
+	})
+}
+
+// PruneIdempotentResponses deletes the responses that expired before now and
+// all but the keep most recently recorded responses.
+func (s *SQLStore) PruneIdempotentResponses(ctx context.Context, now time.Time, keep int) (pruned int64, err error) {
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		tx = tx.WithContext(ctx)
+		res := tx.
+			Where("expiry < ?", now.UTC()).
+			Delete(&dbIdempotentResponse{})
+		if res.Error != nil {
+			return res.Error
+		}
+		pruned = res.RowsAffected
+
+		// find the id of the most recent response that exceeds the limit
+		var cutoff []uint
+		if err := tx.
+			Model(&dbIdempotentResponse{}).
+			Order("id DESC").
+			Offset(keep).
+			Limit(1).
+			Pluck("id", &cutoff).
+			Error; err != nil {
+			return err
+		} else if len(cutoff) == 0 {
+			return nil
+		}
+		res = tx.
+			Where("id <= ?", cutoff[0]).
+			Delete(&dbIdempotentResponse{})
+		pruned += res.RowsAffected
+		return res.Error
+	})
+	return
+}
@@ -0,0 +1,81 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestIdempotentResponses(t *testing.T) {
+	db, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// assert unknown keys are not found
+	if _, err := db.IdempotentResponse(ctx, "foo"); !errors.Is(err, api.ErrIdempotentResponseNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// record a response and assert it's returned
+	now := time.Now().Round(time.Second)
+	resp := api.IdempotentResponse{
+		Fingerprint: types.Hash256{1},
+		Status:      http.StatusCreated,
+		Header:      http.Header{"Content-Type": []string{"application/json"}},
+		Body:        []byte("foo"),
+		Expiry:      now.Add(time.Hour),
+	}
+	if err := db.RecordIdempotentResponse(ctx, "foo", resp); err != nil {
+		t.Fatal(err)
+	} else if got, err := db.IdempotentResponse(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	} else if !got.Expiry.Equal(resp.Expiry) {
+		t.Fatal("unexpected expiry", got.Expiry)
+	} else if got.Expiry = resp.Expiry; !reflect.DeepEqual(got, resp) {
+		t.Fatal("unexpected response", got)
+	}
+
+	// assert recording the key again overwrites the response
+	resp.Status = http.StatusOK
+	if err := db.RecordIdempotentResponse(ctx, "foo", resp); err != nil {
+		t.Fatal(err)
+	} else if got, err := db.IdempotentResponse(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	} else if got.Status != http.StatusOK {
+		t.Fatal("unexpected status", got.Status)
+	}
+
+	// record some more responses, one of which expired
+	for _, key := range []string{"bar", "baz", "qux"} {
+		if err := db.RecordIdempotentResponse(ctx, key, resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp.Expiry = now.Add(-time.Hour)
+	if err := db.RecordIdempotentResponse(ctx, "expired", resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert expired responses and the oldest responses exceeding the limit
+	// are pruned
+	if pruned, err := db.PruneIdempotentResponses(ctx, now, 2); err != nil {
+		t.Fatal(err)
+	} else if pruned != 3 {
+		t.Fatal("unexpected number of pruned responses", pruned)
+	}
+	for key, exists := range map[string]bool{"foo": false, "bar": false, "baz": true, "qux": true, "expired": false} {
+		if _, err := db.IdempotentResponse(ctx, key); exists && err != nil {
+			t.Fatal(err)
+		} else if !exists && !errors.Is(err, api.ErrIdempotentResponseNotFound) {
+			t.Fatal("expected response to be pruned", key, err)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+	"gorm.io/gorm"
+)
+
+// ObjectEncryptionKeys returns a page of objects with an id greater than the
+// given marker, alongside their encryption keys, slabs and metadata. The
+// objects are ordered by id and the returned marker is the id of the last
+// object on the page, it is used to fetch the next page.
+func (s *SQLStore) ObjectEncryptionKeys(ctx context.Context, marker uint, limit int) ([]api.KeyEscrowObject, uint, error) {
+	if limit <= -1 {
+		limit = math.MaxInt
+	}
+
+	// NOTE: we LEFT JOIN here because empty objects are valid and need to be
+	// included in the result set
+	var rows rawObject
+	if err := s.db.
+		WithContext(ctx).
+		Raw(`SELECT o.id as ObjectID, o.object_id as ObjectName, o.key as ObjectKey, o.mime_type as ObjectMimeType, o.etag as ObjectETag, o.created_at as ObjectModTime, sli.offset as SliceOffset, sli.length as SliceLength, sla.id as SlabID, sla.key as SlabKey, sla.min_shards as SlabMinShards, sla.db_buffered_slab_id IS NOT NULL AS SlabBuffered, sec.id as SectorID, sec.root as SectorRoot, sec.latest_host as SectorHost
+FROM (SELECT objects.id, objects.object_id, objects.key, objects.mime_type, objects.etag, objects.created_at FROM objects WHERE objects.id > ? ORDER BY objects.id ASC LIMIT ?) o
+LEFT JOIN slices sli ON sli.db_object_id = o.id
+LEFT JOIN slabs sla ON sla.id = sli.db_slab_id
+LEFT JOIN sectors sec ON sec.db_slab_id = sla.id
+ORDER BY o.id ASC, sli.id ASC, sec.id ASC`, marker, limit).
+		Scan(&rows).
+		Error; err != nil {
+		return nil, 0, err
+	} else if len(rows) == 0 {
+		return nil, marker, nil
+	}
+
+	// convert the rows of every object
+	var objects []api.KeyEscrowObject
+	var ids []uint
+	for start := 0; start < len(rows); {
+		end := start + 1
+		for end < len(rows) && rows[end].ObjectID == rows[start].ObjectID {
+			end++
+		}
+		o, err := rows[start:end].convert()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to convert object %v: %w", rows[start].ObjectName, err)
+		}
+		objects = append(objects, api.KeyEscrowObject{
+			Path:     o.Name,
+			ETag:     o.ETag,
+			MimeType: o.MimeType,
+			ModTime:  o.ModTime,
+			Object:   o.Object,
+		})
+		ids = append(ids, rows[start].ObjectID)
+		start = end
+	}
+
+	// add the buckets
+	var buckets []struct {
+		ID   uint
+		Name string
+	}
+	if err := s.db.
+		WithContext(ctx).
+		Model(&dbObject{}).
+		Select("objects.id as ID, b.name as Name").
+		Joins("INNER JOIN buckets b ON b.id = objects.db_bucket_id").
+		Where("objects.id IN (?)", ids).
+		Scan(&buckets).
+		Error; err != nil {
+		return nil, 0, err
+	}
+	indices := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		indices[id] = i
+	}
+	for _, b := range buckets {
+		objects[indices[b.ID]].Bucket = b.Name
+	}
+
+	// add the user metadata
+	var metadata []dbObjectUserMetadata
+	if err := s.db.
+		WithContext(ctx).
+		Where("db_object_id IN (?)", ids).
+		Find(&metadata).
+		Error; err != nil {
+		return nil, 0, err
+	}
+	for _, md := range metadata {
+		o := &objects[indices[*md.DBObjectID]]
+		if o.Metadata == nil {
+			o.Metadata = make(api.ObjectUserMetadata)
+		}
+		o.Metadata[md.Key] = md.Value
+	}
+
+	// objects that were removed in the meantime have no bucket
+	filtered := objects[:0]
+	for _, o := range objects {
+		if o.Bucket != "" {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered, ids[len(ids)-1], nil
+}
+
+// RestoreObjectEncryptionKeys restores the given objects. If an object still
+// exists and consists of the same slabs, its encryption key is restored. If it
+// no longer exists, it is recreated in the given contract set alongside its
+// bucket, slabs and metadata. Its sectors are linked to the contracts we
+// currently have with their hosts, sectors on hosts we have no contract with
+// are left for the migrations to repair. All other objects are unmatched.
+func (s *SQLStore) RestoreObjectEncryptionKeys(ctx context.Context, contractSet string, objects []api.KeyEscrowObject) (restored, recreated, unmatched uint64, err error) {
+	s.objectsMu.Lock()
+	defer s.objectsMu.Unlock()
+
+	var usageDeltas map[string]int64
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		tx = tx.WithContext(ctx)
+		restored, recreated, unmatched = 0, 0, 0
+		usageDeltas = make(map[string]int64)
+
+		var cs *dbContractSet
+		for _, o := range objects {
+			key, err := o.Key.MarshalText()
+			if err != nil {
+				return err
+			}
+
+			// fetch the object
+			var obj dbObject
+			err = tx.
+				Model(&dbObject{}).
+				Where("object_id = ? AND ?", o.Path, sqlWhereBucket("objects", o.Bucket)).
+				Take(&obj).
+				Error
+			if err == nil {
+				// compare its slabs and restore the key if necessary
+				if match, err := matchesSlabs(tx, obj.ID, o.Object); err != nil {
+					return err
+				} else if !match {
+					unmatched++
+				} else if !bytes.Equal(key, obj.Key) {
+					if err := tx.
+						Model(&dbObject{}).
+						Where("id", obj.ID).
+						Update("key", key).
+						Error; err != nil {
+						return err
+					}
+					restored++
+				}
+				continue
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			// the object no longer exists, if it ends with a partial slab
+			// we can only recreate it if the buffered slab still exists
+			if ok, err := bufferedSlabsExist(tx, o.PartialSlabs); err != nil {
+				return err
+			} else if !ok {
+				unmatched++
+				continue
+			}
+
+			// fetch the contract set
+			if cs == nil {
+				cs = &dbContractSet{Name: contractSet}
+				if err := tx.
+					Where(dbContractSet{Name: contractSet}).
+					FirstOrCreate(cs).
+					Error; err != nil {
+					return fmt.Errorf("failed to fetch contract set %v: %w", contractSet, err)
+				}
+			}
+
+			// fetch the bucket, it's created if it no longer exists
+			b := dbBucket{Name: o.Bucket}
+			if err := tx.
+				Where(dbBucket{Name: o.Bucket}).
+				FirstOrCreate(&b).
+				Error; err != nil {
+				return fmt.Errorf("failed to fetch bucket %v: %w", o.Bucket, err)
+			}
+
+			// recreate the object
+			obj = dbObject{
+				Model:      Model{CreatedAt: o.ModTime},
+				DBBucketID: b.ID,
+				ObjectID:   o.Path,
+				Key:        key,
+				Size:       o.TotalSize(),
+				MimeType:   o.MimeType,
+				Etag:       o.ETag,
+				ExpiresAt:  objectExpiry(b.Policy),
+			}
+			if err := tx.Create(&obj).Error; err != nil {
+				return fmt.Errorf("failed to create object: %w", err)
+			} else if err := createUserMetadata(tx, &obj.ID, nil, o.Metadata); err != nil {
+				return fmt.Errorf("failed to create user metadata: %w", err)
+			}
+			contracts, err := fetchHostContracts(tx, o.Slabs)
+			if err != nil {
+				return fmt.Errorf("failed to fetch contracts: %w", err)
+			} else if err := s.createSlices(tx, &obj.ID, nil, cs.ID, contracts, o.Slabs, o.PartialSlabs); err != nil {
+				return fmt.Errorf("failed to create slices: %w", err)
+			}
+			usageDeltas[o.Bucket] += obj.Size
+			recreated++
+		}
+		return nil
+	})
+	if err == nil {
+		for bucket, delta := range usageDeltas {
+			s.updateBucketUsage(bucket, delta)
+		}
+	}
+	return
+}
+
+// matchesSlabs returns whether the object with given id consists of the slabs
+// of the given object, in order.
+func matchesSlabs(tx *gorm.DB, objID uint, o object.Object) (bool, error) {
+	var dbKeys [][]byte
+	if err := tx.
+		Model(&dbSlice{}).
+		Joins("INNER JOIN slabs sla ON sla.id = slices.db_slab_id").
+		Where("slices.db_object_id = ?", objID).
+		Order("slices.id ASC").
+		Pluck("sla.key", &dbKeys).
+		Error; err != nil {
+		return false, err
+	}
+
+	// slices of partial slabs are created after the ones of complete slabs
+	keys := make([]object.EncryptionKey, 0, len(o.Slabs)+len(o.PartialSlabs))
+	for _, ss := range o.Slabs {
+		keys = append(keys, ss.Key)
+	}
+	for _, ps := range o.PartialSlabs {
+		keys = append(keys, ps.Key)
+	}
+	if len(dbKeys) != len(keys) {
+		return false, nil
+	}
+	for i, key := range keys {
+		var dbKey object.EncryptionKey
+		if err := dbKey.UnmarshalText(dbKeys[i]); err != nil || dbKey.String() != key.String() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// bufferedSlabsExist returns whether the buffered slabs of the given partial
+// slabs still exist.
+func bufferedSlabsExist(tx *gorm.DB, partialSlabs []object.PartialSlab) (bool, error) {
+	for _, ps := range partialSlabs {
+		key, err := ps.Key.MarshalText()
+		if err != nil {
+			return false, err
+		}
+		var count int64
+		if err := tx.
+			Model(&dbSlab{}).
+			Where("slabs.key = ? AND slabs.db_buffered_slab_id IS NOT NULL", key).
+			Count(&count).
+			Error; err != nil {
+			return false, err
+		} else if count == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// fetchHostContracts returns a contract for every host that stores a sector of
+// the given slabs and that we currently have a contract with.
+func fetchHostContracts(tx *gorm.DB, slabs []object.SlabSlice) (map[types.PublicKey]dbContract, error) {
+	var hks []publicKey
+	seen := make(map[types.PublicKey]struct{})
+	for _, ss := range slabs {
+		for _, shard := range ss.Shards {
+			if _, ok := seen[shard.Host]; !ok {
+				seen[shard.Host] = struct{}{}
+				hks = append(hks, publicKey(shard.Host))
+			}
+		}
+	}
+	contracts := make(map[types.PublicKey]dbContract)
+	if len(hks) == 0 {
+		return contracts, nil
+	}
+
+	var dbContracts []dbContract
+	if err := tx.
+		Model(&dbContract{}).
+		Joins("Host").
+		Where("Host.public_key IN (?)", hks).
+		Order("contracts.id ASC").
+		Find(&dbContracts).
+		Error; err != nil {
+		return nil, err
+	}
+	for _, c := range dbContracts {
+		contracts[types.PublicKey(c.Host.PublicKey)] = c // prefer the latest contract
+	}
+	return contracts, nil
+}
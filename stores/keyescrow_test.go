@@ -0,0 +1,163 @@
+package stores
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+)
+
+func TestObjectEncryptionKeys(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := ss.addTestHosts(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := ss.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add an object with two slabs and an empty object
+	newSlab := func(root types.Hash256) object.SlabSlice {
+		return object.SlabSlice{Slab: object.Slab{
+			Key:       object.GenerateEncryptionKey(),
+			MinShards: 1,
+			Shards:    []object.Sector{{Host: hks[0], Root: root}},
+		}}
+	}
+	obj := object.Object{
+		Key:   object.GenerateEncryptionKey(),
+		Slabs: []object.SlabSlice{newSlab(types.Hash256{1}), newSlab(types.Hash256{2})},
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0]}
+	if _, err := ss.UpdateObject(ctx, api.DefaultBucketName, "/foo", testContractSet, testETag, testMimeType, testMetadata, obj, usedContracts); err != nil {
+		t.Fatal(err)
+	} else if _, err := ss.UpdateObject(ctx, api.DefaultBucketName, "/bar", testContractSet, testETag, testMimeType, testMetadata, object.Object{Key: object.GenerateEncryptionKey()}, usedContracts); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the objects are exported
+	objects, marker, err := ss.ObjectEncryptionKeys(ctx, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(objects) != 2 {
+		t.Fatal("unexpected objects", len(objects))
+	}
+	foo := objects[0]
+	if foo.Path != "/foo" || foo.Bucket != api.DefaultBucketName || foo.Key.String() != obj.Key.String() {
+		t.Fatal("unexpected object", foo)
+	} else if foo.ETag != testETag || foo.MimeType != testMimeType || !reflect.DeepEqual(foo.Metadata, testMetadata) {
+		t.Fatal("unexpected metadata", foo)
+	} else if len(foo.Slabs) != 2 || foo.Slabs[0].Key.String() != obj.Slabs[0].Key.String() || foo.Slabs[1].Key.String() != obj.Slabs[1].Key.String() {
+		t.Fatal("unexpected slabs", foo.Slabs)
+	} else if !reflect.DeepEqual(foo.Slabs[1].Shards, obj.Slabs[1].Shards) {
+		t.Fatal("unexpected shards", foo.Slabs[1].Shards)
+	} else if objects[1].Path != "/bar" || len(objects[1].Slabs) != 0 {
+		t.Fatal("unexpected object", objects[1])
+	}
+
+	// assert the objects are paginated by id
+	if page, marker, err := ss.ObjectEncryptionKeys(ctx, 0, 1); err != nil {
+		t.Fatal(err)
+	} else if len(page) != 1 || page[0].Path != "/foo" || len(page[0].Slabs) != 2 {
+		t.Fatal("unexpected page", page)
+	} else if err := ss.RemoveObject(ctx, api.DefaultBucketName, "/foo"); err != nil {
+		t.Fatal(err) // removing an exported object doesn't shift the next page
+	} else if page, marker, err = ss.ObjectEncryptionKeys(ctx, marker, 1); err != nil {
+		t.Fatal(err)
+	} else if len(page) != 1 || page[0].Path != "/bar" {
+		t.Fatal("unexpected page", page)
+	} else if page, _, err = ss.ObjectEncryptionKeys(ctx, marker, 1); err != nil {
+		t.Fatal(err)
+	} else if len(page) != 0 {
+		t.Fatal("unexpected page", page)
+	}
+	if page, _, err := ss.ObjectEncryptionKeys(ctx, marker, -1); err != nil {
+		t.Fatal(err)
+	} else if len(page) != 0 {
+		t.Fatal("unexpected page", page)
+	}
+
+	// corrupt the key of the second object
+	if err := ss.db.Model(&dbObject{}).Where("object_id", "/bar").Update("key", []byte(object.GenerateEncryptionKey().String())).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// restore the objects, the first object no longer exists and is recreated
+	restored, recreated, unmatched, err := ss.RestoreObjectEncryptionKeys(ctx, testContractSet, objects)
+	if err != nil {
+		t.Fatal(err)
+	} else if restored != 1 || recreated != 1 || unmatched != 0 {
+		t.Fatal("unexpected", restored, recreated, unmatched)
+	}
+	if o, err := ss.Object(ctx, api.DefaultBucketName, "/bar"); err != nil {
+		t.Fatal(err)
+	} else if o.Object.Key.String() != objects[1].Key.String() {
+		t.Fatal("key wasn't restored")
+	}
+	if o, err := ss.Object(ctx, api.DefaultBucketName, "/foo"); err != nil {
+		t.Fatal(err)
+	} else if o.Object.Key.String() != obj.Key.String() || o.ETag != testETag || o.MimeType != testMimeType || !reflect.DeepEqual(o.Metadata, testMetadata) {
+		t.Fatal("unexpected object", o)
+	} else if o.Size != int64(obj.TotalSize()) || len(o.Object.Slabs) != 2 || !reflect.DeepEqual(o.Object.Slabs[0].Shards, obj.Slabs[0].Shards) {
+		t.Fatal("unexpected slabs", o.Object.Slabs)
+	}
+
+	// simulate losing the database by removing all objects, their slabs and
+	// the bucket, the bundle recreates all of them
+	if err := ss.RemoveObjects(ctx, api.DefaultBucketName, "/", nil); err != nil {
+		t.Fatal(err)
+	} else if _, err := ss.PruneSlabs(ctx, -1); err != nil {
+		t.Fatal(err)
+	} else if err := ss.DeleteBucket(ctx, api.DefaultBucketName); err != nil {
+		t.Fatal(err)
+	} else if roots, err := ss.ContractRoots(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 0 {
+		t.Fatal("unexpected roots", len(roots))
+	} else if restored, recreated, unmatched, err = ss.RestoreObjectEncryptionKeys(ctx, testContractSet, objects); err != nil {
+		t.Fatal(err)
+	} else if restored != 0 || recreated != 2 || unmatched != 0 {
+		t.Fatal("unexpected", restored, recreated, unmatched)
+	} else if _, err := ss.Object(ctx, api.DefaultBucketName, "/foo"); err != nil {
+		t.Fatal(err)
+	} else if _, err := ss.Object(ctx, api.DefaultBucketName, "/bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the sectors of the recreated object are linked to the contract
+	if roots, err := ss.ContractRoots(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 2 {
+		t.Fatal("unexpected roots", len(roots))
+	}
+
+	// assert objects aren't touched if their slabs changed
+	foo.Key = object.GenerateEncryptionKey()
+	foo.Slabs = foo.Slabs[:1]
+	if restored, recreated, unmatched, err := ss.RestoreObjectEncryptionKeys(ctx, testContractSet, []api.KeyEscrowObject{foo}); err != nil {
+		t.Fatal(err)
+	} else if restored != 0 || recreated != 0 || unmatched != 1 {
+		t.Fatal("unexpected", restored, recreated, unmatched)
+	}
+
+	// assert objects that end with a buffered slab that no longer exists are
+	// unmatched
+	baz := objects[1]
+	baz.Path = "/baz"
+	baz.PartialSlabs = []object.PartialSlab{{Key: object.GenerateEncryptionKey(), Length: 1}}
+	if restored, recreated, unmatched, err := ss.RestoreObjectEncryptionKeys(ctx, testContractSet, []api.KeyEscrowObject{baz}); err != nil {
+		t.Fatal(err)
+	} else if restored != 0 || recreated != 0 || unmatched != 1 {
+		t.Fatal("unexpected", restored, recreated, unmatched)
+	}
+}
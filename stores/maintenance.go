@@ -0,0 +1,52 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// maintenanceMaxTxnsInFlight is the number of concurrent transactions
+	// above which we consider the database to be handling heavy writes and
+	// refuse to perform maintenance on it.
+	maintenanceMaxTxnsInFlight = 5
+)
+
+// OptimizeDatabase reclaims unused space and refreshes the query planner's
+// statistics. On SQLite this runs VACUUM followed by ANALYZE, on MySQL every
+// table is optimized using OPTIMIZE TABLE. The progress callback is called
+// before every step. If the database is handling a heavy write load,
+// api.ErrDatabaseBusy is returned without performing any maintenance.
+func (s *SQLStore) OptimizeDatabase(ctx context.Context, progress func(step string, completed, total int)) error {
+	if s.txnsInFlight.Load() > maintenanceMaxTxnsInFlight {
+		return api.ErrDatabaseBusy
+	}
+
+	var stmts []string
+	if isSQLite(s.db) {
+		stmts = []string{"VACUUM", "ANALYZE"}
+	} else {
+		tables, err := s.db.WithContext(ctx).Migrator().GetTables()
+		if err != nil {
+			return fmt.Errorf("failed to fetch tables: %w", err)
+		}
+		for _, table := range tables {
+			stmts = append(stmts, fmt.Sprintf("OPTIMIZE TABLE `%s`", table))
+		}
+	}
+
+	for i, stmt := range stmts {
+		if progress != nil {
+			progress(stmt, i, len(stmts))
+		}
+		if err := s.db.WithContext(ctx).Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to execute '%s': %w", stmt, err)
+		}
+	}
+	if progress != nil {
+		progress("", len(stmts), len(stmts))
+	}
+	return nil
+}
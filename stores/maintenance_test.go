@@ -0,0 +1,42 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.sia.tech/renterd/api"
+)
+
+// TestOptimizeDatabase is a unit test for OptimizeDatabase.
+func TestOptimizeDatabase(t *testing.T) {
+	db, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// optimize the database and keep track of the progress
+	var steps []string
+	var completed, total int
+	err = db.OptimizeDatabase(context.Background(), func(step string, c, t int) {
+		steps = append(steps, step)
+		completed, total = c, t
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(steps) != 3 || steps[0] != "VACUUM" || steps[1] != "ANALYZE" || steps[2] != "" {
+		t.Fatal("unexpected steps", steps)
+	} else if completed != 2 || total != 2 {
+		t.Fatal("unexpected progress", completed, total)
+	}
+
+	// simulate heavy writes, maintenance should be refused
+	db.txnsInFlight.Store(maintenanceMaxTxnsInFlight + 1)
+	if err := db.OptimizeDatabase(context.Background(), nil); !errors.Is(err, api.ErrDatabaseBusy) {
+		t.Fatal("unexpected error", err)
+	}
+	db.txnsInFlight.Store(0)
+	if err := db.OptimizeDatabase(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+}
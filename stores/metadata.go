@@ -2,9 +2,13 @@ package stores
 
 import (
 	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -15,6 +19,7 @@ import (
 	"go.sia.tech/renterd/object"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"lukechampine.com/frand"
 )
 
 const (
@@ -22,6 +27,17 @@ const (
 	// health per db transaction. 10000 equals roughtly 1.2TiB of slabs at a
 	// 10/30 erasure coding and takes <1s to execute on an SSD in SQLite.
 	refreshHealthBatchSize = 10000
+
+	// maxUsedContractRenewals is the maximum number of renewals that are
+	// followed when resolving the contracts that were used for an upload.
+	maxUsedContractRenewals = 10
+)
+
+var (
+	// removeObjectsBatchSize is the number of objects that are deleted per db
+	// transaction when removing all objects with a given prefix, it's a
+	// variable so tests can remove objects in multiple batches.
+	removeObjectsBatchSize = 1000
 )
 
 type (
@@ -33,6 +49,10 @@ type (
 
 		Host   publicKey `gorm:"index;NOT NULL;size:32"`
 		Reason string
+
+		// ProofChecked indicates whether we checked if the host submitted a
+		// storage proof after the contract's proof window ended.
+		ProofChecked bool `gorm:"index;NOT NULL;default:false"`
 	}
 
 	dbContract struct {
@@ -90,6 +110,23 @@ type (
 
 		MimeType string `json:"index"`
 		Etag     string `gorm:"index"`
+
+		// ExpiresAt is set for objects in scratch buckets, the object is
+		// garbage collected once it expires unless it was promoted.
+		ExpiresAt sql.NullTime `gorm:"index"`
+
+		Metadata []dbObjectUserMetadata `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to delete metadata too
+	}
+
+	// dbObjectUserMetadata is a key-value pair of user metadata that belongs
+	// to either an object or a multipart upload.
+	dbObjectUserMetadata struct {
+		Model
+
+		DBObjectID          *uint  `gorm:"index"`
+		DBMultipartUploadID *uint  `gorm:"index"`
+		Key                 string `gorm:"index;NOT NULL"`
+		Value               string
 	}
 
 	dbBucket struct {
@@ -140,7 +177,7 @@ type (
 		Model
 
 		DBSlabID   uint      `gorm:"index"`
-		LatestHost publicKey `gorm:"NOT NULL"`
+		LatestHost publicKey `gorm:"index;NOT NULL"`
 		Root       []byte    `gorm:"index;unique;NOT NULL;size:32"`
 
 		Contracts []dbContract `gorm:"many2many:contract_sectors;constraint:OnDelete:CASCADE"`
@@ -166,6 +203,7 @@ type (
 		ObjectMimeType string
 		ObjectHealth   float64
 		ObjectETag     string
+		ObjectExpiry   sql.NullTime
 
 		// slice
 		SliceOffset uint32
@@ -216,6 +254,9 @@ func (dbContractSet) TableName() string { return "contract_sets" }
 // TableName implements the gorm.Tabler interface.
 func (dbObject) TableName() string { return "objects" }
 
+// TableName implements the gorm.Tabler interface.
+func (dbObjectUserMetadata) TableName() string { return "object_user_metadata" }
+
 // TableName implements the gorm.Tabler interface.
 func (dbSector) TableName() string { return "sectors" }
 
@@ -228,6 +269,16 @@ func (dbBufferedSlab) TableName() string { return "buffered_slabs" }
 // TableName implements the gorm.Tabler interface.
 func (dbSlice) TableName() string { return "slices" }
 
+// missedProof returns true if the host had to submit a storage proof for the
+// contract but didn't, renewed and finalized contracts don't require a proof
+// and neither do contracts without data.
+func (c dbArchivedContract) missedProof() bool {
+	return c.Reason != api.ContractArchivalReasonRenewed &&
+		c.RevisionNumber != fmt.Sprint(uint64(math.MaxUint64)) &&
+		c.Size > 0 &&
+		c.ProofHeight == 0
+}
+
 // convert converts a dbContract to an ArchivedContract.
 func (c dbArchivedContract) convert() api.ArchivedContract {
 	var revisionNumber uint64
@@ -397,14 +448,20 @@ func (raw rawObject) convert() (api.Object, error) {
 	}
 
 	// return object
+	var expiresAt *time.Time
+	if raw[0].ObjectExpiry.Valid {
+		t := raw[0].ObjectExpiry.Time.UTC()
+		expiresAt = &t
+	}
 	return api.Object{
 		ObjectMetadata: api.ObjectMetadata{
-			ETag:     raw[0].ObjectETag,
-			Health:   minHealth,
-			MimeType: raw[0].ObjectMimeType,
-			ModTime:  raw[0].ObjectModTime.UTC(),
-			Name:     raw[0].ObjectName,
-			Size:     raw[0].ObjectSize,
+			ETag:      raw[0].ObjectETag,
+			Health:    minHealth,
+			MimeType:  raw[0].ObjectMimeType,
+			ModTime:   raw[0].ObjectModTime.UTC(),
+			Name:      raw[0].ObjectName,
+			Size:      raw[0].ObjectSize,
+			ExpiresAt: expiresAt,
 		},
 		Object: object.Object{
 			Key:          key,
@@ -465,6 +522,34 @@ func (s *SQLStore) Bucket(ctx context.Context, bucket string) (api.Bucket, error
 	}, nil
 }
 
+// BucketStats returns the number of objects in the given bucket and their
+// total size.
+func (s *SQLStore) BucketStats(ctx context.Context, bucket string) (api.BucketStats, error) {
+	var b dbBucket
+	err := s.db.
+		Model(&dbBucket{}).
+		Where("name = ?", bucket).
+		Take(&b).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return api.BucketStats{}, api.ErrBucketNotFound
+	} else if err != nil {
+		return api.BucketStats{}, err
+	}
+
+	var stats api.BucketStats
+	err = s.db.
+		Model(&dbObject{}).
+		Select("COUNT(*) AS NumObjects, COALESCE(SUM(size), 0) AS TotalObjectsSize").
+		Where("db_bucket_id = ?", b.ID).
+		Scan(&stats).
+		Error
+	if err != nil {
+		return api.BucketStats{}, err
+	}
+	return stats, nil
+}
+
 func (s *SQLStore) CreateBucket(ctx context.Context, bucket string, policy api.BucketPolicy) error {
 	// Create bucket.
 	return s.retryTransaction(func(tx *gorm.DB) error {
@@ -497,6 +582,8 @@ func (s *SQLStore) UpdateBucketPolicy(ctx context.Context, bucket string, policy
 }
 
 func (s *SQLStore) DeleteBucket(ctx context.Context, bucket string) error {
+	defer s.invalidateBucketUsage(bucket)
+
 	// Delete bucket.
 	return s.retryTransaction(func(tx *gorm.DB) error {
 		var b dbBucket
@@ -543,6 +630,29 @@ func (s *SQLStore) ListBuckets(ctx context.Context) ([]api.Bucket, error) {
 	return resp, nil
 }
 
+// SlabHealthHistogram returns the number of slabs per health range, if a
+// contract set is given only slabs in that set are considered. The histogram
+// is computed using the cached slab health.
+func (s *SQLStore) SlabHealthHistogram(ctx context.Context, set string) (api.SlabHealthHistogram, error) {
+	query := s.db.
+		Model(&dbSlab{}).
+		Select(`
+			COALESCE(SUM(CASE WHEN health < 0 THEN 1 ELSE 0 END), 0) AS Unrecoverable,
+			COALESCE(SUM(CASE WHEN health >= 0 AND health < 0.25 THEN 1 ELSE 0 END), 0) AS Critical,
+			COALESCE(SUM(CASE WHEN health >= 0.25 AND health < 0.5 THEN 1 ELSE 0 END), 0) AS Low,
+			COALESCE(SUM(CASE WHEN health >= 0.5 AND health < 1 THEN 1 ELSE 0 END), 0) AS Degraded,
+			COALESCE(SUM(CASE WHEN health >= 1 THEN 1 ELSE 0 END), 0) AS Healthy`)
+	if set != "" {
+		query = query.Where("db_contract_set_id = (?)", s.db.Model(&dbContractSet{}).Select("id").Where("name = ?", set))
+	}
+
+	var histogram api.SlabHealthHistogram
+	if err := query.Scan(&histogram).Error; err != nil {
+		return api.SlabHealthHistogram{}, err
+	}
+	return histogram, nil
+}
+
 // ObjectsStats returns some info related to the objects stored in the store. To
 // reduce locking and make sure all results are consistent, everything is done
 // within a single transaction.
@@ -791,6 +901,180 @@ WHERE c.fcid = ?
 	return
 }
 
+// HostObjects returns the objects that have at least one sector stored on the
+// host with the given key.
+func (s *SQLStore) HostObjects(ctx context.Context, hk types.PublicKey, limit int) ([]api.HostObject, error) {
+	if limit <= -1 {
+		limit = math.MaxInt
+	}
+
+	var objects []api.HostObject
+	if err := s.db.
+		Select("b.name as Bucket, o.object_id as Name, o.size as Size").
+		Model(&dbObject{}).
+		Table("objects o").
+		Joins("INNER JOIN buckets b ON o.db_bucket_id = b.id").
+		Where(`o.id IN (
+	SELECT sli.db_object_id
+	FROM slices sli
+	INNER JOIN sectors sec ON sec.db_slab_id = sli.db_slab_id
+	WHERE sec.latest_host = ?
+)`, publicKey(hk)).
+		Order("o.id ASC").
+		Limit(limit).
+		Scan(&objects).
+		Error; err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// HostAffectedObjects returns the objects that have at least one sector stored
+// on the host with the given key, together with the number of their slabs that
+// are affected and whether losing the host puts any of them at risk.
+func (s *SQLStore) HostAffectedObjects(ctx context.Context, hk types.PublicKey, offset, limit int) ([]api.AffectedObject, error) {
+	return s.affectedObjects(ctx, `
+SELECT sec.id
+FROM sectors sec
+WHERE sec.latest_host = ?`, publicKey(hk), offset, limit)
+}
+
+// ContractAffectedObjects returns the objects that have at least one sector
+// stored on the contract with the given id, together with the number of their
+// slabs that are affected and whether losing the contract puts any of them at
+// risk.
+func (s *SQLStore) ContractAffectedObjects(ctx context.Context, id types.FileContractID, offset, limit int) ([]api.AffectedObject, error) {
+	if !s.isKnownContract(id) {
+		return nil, api.ErrContractNotFound
+	}
+	return s.affectedObjects(ctx, `
+SELECT cs.db_sector_id
+FROM contract_sectors cs
+INNER JOIN contracts c ON cs.db_contract_id = c.id
+WHERE c.fcid = ?`, fileContractID(id), offset, limit)
+}
+
+// affectedObjects returns the objects that reference at least one of the
+// sectors selected by the given query. A slab is considered at risk if the
+// number of its sectors that aren't selected and are still stored with at
+// least one contract is lower than MinShards+1, sectors without a contract are
+// lost already.
+func (s *SQLStore) affectedObjects(ctx context.Context, sectorsQuery string, arg interface{}, offset, limit int) ([]api.AffectedObject, error) {
+	if offset < 0 {
+		return nil, ErrNegativeOffset
+	}
+	if limit <= -1 {
+		limit = math.MaxInt
+	}
+
+	var rows []struct {
+		Bucket      string
+		Name        string
+		Size        int64
+		Slabs       int
+		AtRiskSlabs int
+	}
+	if err := s.db.
+		WithContext(ctx).
+		Raw(fmt.Sprintf(`
+SELECT b.name AS bucket, o.object_id AS name, o.size AS size, COUNT(DISTINCT sla.id) AS slabs, COUNT(DISTINCT CASE WHEN (
+	SELECT COUNT(*)
+	FROM sectors sec
+	WHERE sec.db_slab_id = sla.id AND sec.id NOT IN (%[1]s) AND EXISTS (
+		SELECT 1
+		FROM contract_sectors csr
+		WHERE csr.db_sector_id = sec.id
+	)
+) < sla.min_shards + 1 THEN sla.id END) AS at_risk_slabs
+FROM objects o
+INNER JOIN buckets b ON o.db_bucket_id = b.id
+INNER JOIN slices sli ON sli.db_object_id = o.id
+INNER JOIN slabs sla ON sli.db_slab_id = sla.id
+WHERE sla.id IN (
+	SELECT sec.db_slab_id
+	FROM sectors sec
+	WHERE sec.id IN (%[1]s)
+)
+GROUP BY o.id, b.name, o.object_id, o.size
+ORDER BY o.id ASC
+LIMIT ? OFFSET ?`, sectorsQuery), arg, arg, limit, offset).
+		Scan(&rows).
+		Error; err != nil {
+		return nil, err
+	}
+
+	objects := make([]api.AffectedObject, len(rows))
+	for i, row := range rows {
+		objects[i] = api.AffectedObject{
+			HostObject: api.HostObject{
+				Bucket: row.Bucket,
+				Name:   row.Name,
+				Size:   row.Size,
+			},
+			Slabs:       row.Slabs,
+			AtRiskSlabs: row.AtRiskSlabs,
+			AtRisk:      row.AtRiskSlabs > 0,
+		}
+	}
+	return objects, nil
+}
+
+// ContractSlabs returns up to 'limit' slabs that have at least one sector
+// stored on the contract with given id, ordered by the time they were created.
+func (s *SQLStore) ContractSlabs(ctx context.Context, id types.FileContractID, limit int) ([]api.ContractSlab, error) {
+	if !s.isKnownContract(id) {
+		return nil, api.ErrContractNotFound
+	}
+	if limit <= -1 {
+		limit = math.MaxInt
+	}
+
+	var rows []struct {
+		Key    []byte
+		Bucket sql.NullString
+	}
+
+	// NOTE: the bucket of a slab is the bucket of the first object that
+	// references it, consistent with UnhealthySlabs
+	if err := s.db.
+		Select(`slabs.key, (
+	SELECT b.name
+	FROM slices sli
+	INNER JOIN objects o ON sli.db_object_id = o.id
+	INNER JOIN buckets b ON o.db_bucket_id = b.id
+	WHERE sli.db_slab_id = slabs.id
+	ORDER BY sli.id ASC
+	LIMIT 1
+) AS bucket`).
+		Model(&dbSlab{}).
+		Where(`slabs.id IN (
+	SELECT sec.db_slab_id
+	FROM sectors sec
+	INNER JOIN contract_sectors cs ON cs.db_sector_id = sec.id
+	INNER JOIN contracts c ON cs.db_contract_id = c.id
+	WHERE c.fcid = ?
+)`, fileContractID(id)).
+		Order("slabs.id ASC").
+		Limit(limit).
+		Find(&rows).
+		Error; err != nil {
+		return nil, err
+	}
+
+	slabs := make([]api.ContractSlab, len(rows))
+	for i, row := range rows {
+		var key object.EncryptionKey
+		if err := key.UnmarshalText(row.Key); err != nil {
+			return nil, err
+		}
+		slabs[i] = api.ContractSlab{
+			Key:    key,
+			Bucket: row.Bucket.String,
+		}
+	}
+	return slabs, nil
+}
+
 func (s *SQLStore) ContractSetContracts(ctx context.Context, set string) ([]api.ContractMetadata, error) {
 	dbContracts, err := s.contracts(ctx, set)
 	if err != nil {
@@ -974,29 +1258,144 @@ func (s *SQLStore) RenewedContract(ctx context.Context, renewedFrom types.FileCo
 	return contract.convert(), nil
 }
 
-func (s *SQLStore) SearchObjects(ctx context.Context, bucket, substring string, offset, limit int) ([]api.ObjectMetadata, error) {
+func (s *SQLStore) SearchObjects(ctx context.Context, bucket, substring string, metadata api.ObjectUserMetadata, offset, limit int) ([]api.ObjectMetadata, error) {
 	// fetch one more to see if there are more entries
 	if limit <= -1 {
 		limit = math.MaxInt
 	}
 
-	var objects []api.ObjectMetadata
-	err := s.db.
-		Select("o.object_id as name, MAX(o.size) as size, MIN(sla.health) as health").
+	// objects have to match all of the given user metadata
+	query := s.db
+	for k, v := range metadata {
+		query = query.Where("EXISTS (SELECT 1 FROM object_user_metadata oum WHERE oum.db_object_id = o.id AND oum.`key` = ? AND oum.value = ?)", k, v)
+	}
+
+	var rows []rawObjectMetadata
+	err := query.
+		Select("o.object_id as Name, MAX(o.size) as Size, MIN(sla.health) as Health, MAX(o.mime_type) as MimeType, MAX(o.etag) as ETag, MAX(o.created_at) as ModTime").
 		Model(&dbObject{}).
 		Table("objects o").
 		Joins("INNER JOIN buckets b ON o.db_bucket_id = b.id AND b.name = ?", bucket).
 		Joins("LEFT JOIN slices sli ON o.id = sli.`db_object_id`").
 		Joins("LEFT JOIN slabs sla ON sli.db_slab_id = sla.`id`").
 		Where("INSTR(o.object_id, ?) > 0 AND ?", substring, sqlWhereBucket("o", bucket)).
+		Where("o.expires_at IS NULL OR o.expires_at > ?", time.Now()).
 		Group("o.object_id").
 		Offset(offset).
 		Limit(limit).
-		Scan(&objects).Error
+		Scan(&rows).Error
 	if err != nil {
 		return nil, err
 	}
 
+	objects := make([]api.ObjectMetadata, 0, len(rows))
+	for _, row := range rows {
+		objects = append(objects, row.convert())
+	}
+	return objects, nil
+}
+
+// SampleObjects returns up to limit random objects across all buckets. Empty
+// and expired objects are never sampled. Rather than sorting the objects table
+// randomly, which requires a full scan, we seek to random object ids, objects
+// that follow a gap in the ids are therefore slightly more likely to be
+// sampled.
+func (s *SQLStore) SampleObjects(ctx context.Context, limit int) ([]api.ObjectSample, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var bounds struct {
+		Min int64
+		Max int64
+	}
+	if err := s.db.
+		WithContext(ctx).
+		Model(&dbObject{}).
+		Select("COALESCE(MIN(id), 0) as Min, COALESCE(MAX(id), 0) as Max").
+		Scan(&bounds).
+		Error; err != nil {
+		return nil, err
+	} else if bounds.Max == 0 {
+		return nil, nil
+	}
+
+	type sampleRow struct {
+		ID       int64
+		Bucket   string
+		ETag     string
+		Health   float64
+		MimeType string
+		ModTime  datetime
+		Name     string
+		Size     int64
+	}
+	sample := func(from int64, n int) (rows []sampleRow, err error) {
+		err = s.db.
+			WithContext(ctx).
+			Select("o.id as ID, b.name as Bucket, o.object_id as Name, MAX(o.size) as Size, MIN(sla.health) as Health, MAX(o.mime_type) as MimeType, MAX(o.etag) as ETag, MAX(o.created_at) as ModTime").
+			Model(&dbObject{}).
+			Table("objects o").
+			Joins("INNER JOIN buckets b ON o.db_bucket_id = b.id").
+			Joins("LEFT JOIN slices sli ON o.id = sli.`db_object_id`").
+			Joins("LEFT JOIN slabs sla ON sli.db_slab_id = sla.`id`").
+			Where("o.id >= ? AND o.size > 0 AND (o.expires_at IS NULL OR o.expires_at > ?)", from, time.Now()).
+			Group("o.id, b.name, o.object_id").
+			Order("o.id ASC").
+			Limit(n).
+			Scan(&rows).
+			Error
+		return
+	}
+
+	// seek to a random id for every object we sample, wrapping around if
+	// there are no objects past that id
+	var rows []sampleRow
+	seen := make(map[int64]struct{})
+	for i := 0; i < limit; i++ {
+		sampled, err := sample(bounds.Min+int64(frand.Uint64n(uint64(bounds.Max-bounds.Min+1))), 1)
+		if err == nil && len(sampled) == 0 {
+			sampled, err = sample(bounds.Min, 1)
+		}
+		if err != nil {
+			return nil, err
+		} else if len(sampled) == 0 {
+			return nil, nil // no objects to sample
+		} else if _, ok := seen[sampled[0].ID]; !ok {
+			seen[sampled[0].ID] = struct{}{}
+			rows = append(rows, sampled[0])
+		}
+	}
+
+	// if we sampled the same object more than once, top up the sample with
+	// the first objects we didn't sample yet
+	if len(rows) < limit {
+		sampled, err := sample(bounds.Min, limit+len(rows))
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range sampled {
+			if _, ok := seen[row.ID]; !ok && len(rows) < limit {
+				seen[row.ID] = struct{}{}
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	objects := make([]api.ObjectSample, 0, len(rows))
+	for _, row := range rows {
+		objects = append(objects, api.ObjectSample{
+			Bucket: row.Bucket,
+			ObjectMetadata: rawObjectMetadata{
+				ETag:     row.ETag,
+				Health:   row.Health,
+				MimeType: row.MimeType,
+				ModTime:  row.ModTime,
+				Name:     row.Name,
+				Size:     row.Size,
+			}.convert(),
+		})
+	}
 	return objects, nil
 }
 
@@ -1055,7 +1454,7 @@ func (s *SQLStore) ObjectEntries(ctx context.Context, bucket, path, prefix, mark
 		INNER JOIN buckets b ON objects.db_bucket_id = b.id AND b.name = ?
 		LEFT JOIN slices ON objects.id = slices.db_object_id 
 		LEFT JOIN slabs ON slices.db_slab_id = slabs.id
-		WHERE SUBSTR(object_id, 1, ?) = ? AND ?
+		WHERE SUBSTR(object_id, 1, ?) = ? AND ? AND (objects.expires_at IS NULL OR objects.expires_at > ?)
 		GROUP BY object_id
 	) AS m
 	GROUP BY name
@@ -1078,6 +1477,7 @@ func (s *SQLStore) ObjectEntries(ctx context.Context, bucket, path, prefix, mark
 		utf8.RuneCountInString(path),      // WHERE SUBSTR(object_id, 1, ?) = ? AND ?
 		path,                              // WHERE SUBSTR(object_id, 1, ?) = ? AND ?
 		sqlWhereBucket("objects", bucket), // WHERE SUBSTR(object_id, 1, ?) = ? AND ?
+		time.Now(),                        // objects.expires_at > ?
 
 		utf8.RuneCountInString(path + prefix), // HAVING SUBSTR(name, 1, ?) = ? AND name != ?
 		path + prefix,                         // HAVING SUBSTR(name, 1, ?) = ? AND name != ?
@@ -1112,6 +1512,56 @@ func (s *SQLStore) Object(ctx context.Context, bucket, path string) (api.Object,
 			return err
 		}
 		obj, err = o.convert()
+		if err != nil {
+			return err
+		}
+		obj.Metadata, err = objectUserMetadata(tx, o[0].ObjectID)
+		return err
+	})
+	return obj, err
+}
+
+// ObjectMetadata returns the object at the given path with its metadata but
+// without its slabs.
+func (s *SQLStore) ObjectMetadata(ctx context.Context, bucket, path string) (api.Object, error) {
+	var obj api.Object
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var rows []struct {
+			ObjectID uint
+			ETag     string
+			Health   float64
+			MimeType string
+			ModTime  datetime
+			Name     string
+			Size     int64
+		}
+		err := tx.
+			Select("o.id as ObjectID, MAX(o.etag) as ETag, COALESCE(MIN(CASE WHEN sla.db_buffered_slab_id IS NULL THEN sla.health END), 1) as Health, MAX(o.mime_type) as MimeType, MAX(o.created_at) as ModTime, MAX(o.object_id) as Name, MAX(o.size) as Size").
+			Model(&dbObject{}).
+			Table("objects o").
+			Joins("INNER JOIN buckets b ON o.db_bucket_id = b.id AND b.name = ?", bucket).
+			Joins("LEFT JOIN slices sli ON o.id = sli.`db_object_id`").
+			Joins("LEFT JOIN slabs sla ON sli.db_slab_id = sla.`id`").
+			Where("o.object_id = ? AND ?", path, sqlWhereBucket("o", bucket)).
+			Where("o.expires_at IS NULL OR o.expires_at > ?", time.Now()).
+			Group("o.id").
+			Scan(&rows).
+			Error
+		if err != nil {
+			return err
+		} else if len(rows) == 0 {
+			return api.ErrObjectNotFound
+		}
+		row := rows[0]
+		obj.ObjectMetadata = rawObjectMetadata{
+			ETag:     row.ETag,
+			Health:   row.Health,
+			MimeType: row.MimeType,
+			ModTime:  row.ModTime,
+			Name:     row.Name,
+			Size:     row.Size,
+		}.convert()
+		obj.Metadata, err = objectUserMetadata(tx, row.ObjectID)
 		return err
 	})
 	return obj, err
@@ -1126,6 +1576,7 @@ func (s *SQLStore) RecordContractSpending(ctx context.Context, records []api.Con
 	s.spendingMu.Lock()
 	defer s.spendingMu.Unlock()
 
+	now := time.Now()
 	squashedRecords := make(map[types.FileContractID]api.ContractSpending)
 	latestRevision := make(map[types.FileContractID]uint64)
 	latestSize := make(map[types.FileContractID]uint64)
@@ -1165,7 +1616,10 @@ func (s *SQLStore) RecordContractSpending(ctx context.Context, records []api.Con
 			}
 			updates["revision_number"] = latestRevision[fcid]
 			updates["size"] = latestSize[fcid]
-			return tx.Model(&contract).Updates(updates).Error
+			if err := tx.Model(&contract).Updates(updates).Error; err != nil {
+				return err
+			}
+			return recordContractSpendingMetric(tx, fcid, now, newSpending)
 		})
 		if err != nil {
 			return err
@@ -1187,12 +1641,6 @@ func (s *SQLStore) isKnownContract(fcid types.FileContractID) bool {
 	return found
 }
 
-func pruneSlabs(tx *gorm.DB) error {
-	return tx.Exec(`DELETE FROM slabs WHERE slabs.id IN (SELECT * FROM (SELECT sla.id FROM slabs sla
-		LEFT JOIN slices sli ON sli.db_slab_id  = sla.id
-		WHERE db_object_id IS NULL AND db_multipart_part_id IS NULL AND sla.db_buffered_slab_id IS NULL) toDelete)`).Error
-}
-
 func fetchUsedContracts(tx *gorm.DB, usedContracts map[types.PublicKey]types.FileContractID) (map[types.PublicKey]dbContract, error) {
 	fcids := make([]fileContractID, 0, len(usedContracts))
 	for _, fcid := range usedContracts {
@@ -1210,23 +1658,82 @@ func fetchUsedContracts(tx *gorm.DB, usedContracts map[types.PublicKey]types.Fil
 	for _, c := range contracts {
 		fetchedContracts[types.PublicKey(c.Host.PublicKey)] = c
 	}
+
+	// contracts that were renewed more than once while they were used are
+	// resolved by following the renewals in the archive, that way their
+	// sectors are linked to the latest contract and don't need migrating
+	var unresolved []fileContractID
+	for hk, fcid := range usedContracts {
+		if _, ok := fetchedContracts[hk]; !ok {
+			unresolved = append(unresolved, fileContractID(fcid))
+		}
+	}
+	for i := 0; i < maxUsedContractRenewals && len(unresolved) > 0; i++ {
+		var renewedTo []fileContractID
+		if err := tx.Model(&dbArchivedContract{}).
+			Where("fcid IN (?) AND reason = ?", unresolved, api.ContractArchivalReasonRenewed).
+			Pluck("renewed_to", &renewedTo).
+			Error; err != nil {
+			return nil, err
+		} else if len(renewedTo) == 0 {
+			break
+		}
+
+		var renewed []dbContract
+		if err := tx.Model(&dbContract{}).
+			Joins("Host").
+			Where("fcid IN (?) OR renewed_from IN (?)", renewedTo, renewedTo).
+			Find(&renewed).
+			Error; err != nil {
+			return nil, err
+		}
+		resolved := make(map[fileContractID]struct{})
+		for _, c := range renewed {
+			hk := types.PublicKey(c.Host.PublicKey)
+			if _, used := usedContracts[hk]; !used {
+				continue
+			} else if _, ok := fetchedContracts[hk]; !ok {
+				fetchedContracts[hk] = c
+			}
+			resolved[c.FCID] = struct{}{}
+			resolved[c.RenewedFrom] = struct{}{}
+		}
+
+		unresolved = unresolved[:0]
+		for _, fcid := range renewedTo {
+			if _, ok := resolved[fcid]; !ok {
+				unresolved = append(unresolved, fcid)
+			}
+		}
+	}
 	return fetchedContracts, nil
 }
 
 func (s *SQLStore) RenameObject(ctx context.Context, bucket, keyOld, keyNew string) error {
-	tx := s.db.Exec(`UPDATE objects SET object_id = ? WHERE object_id = ? AND ?`, keyNew, keyOld, sqlWhereBucket("objects", bucket))
-	if tx.Error != nil {
-		return tx.Error
-	}
-	if tx.RowsAffected == 0 {
-		return fmt.Errorf("%w: key %v", api.ErrObjectNotFound, keyOld)
-	}
-	return nil
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		// renaming never overwrites another object
+		var exists bool
+		if err := tx.Raw(`SELECT COUNT(*) > 0 FROM objects WHERE object_id = ? AND ?`, keyNew, sqlWhereBucket("objects", bucket)).
+			Scan(&exists).Error; err != nil {
+			return err
+		} else if exists {
+			return fmt.Errorf("%w: key %v", api.ErrObjectExists, keyNew)
+		}
+
+		resp := tx.Exec(`UPDATE objects SET object_id = ? WHERE object_id = ? AND ?`, keyNew, keyOld, sqlWhereBucket("objects", bucket))
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if resp.RowsAffected == 0 {
+			return fmt.Errorf("%w: key %v", api.ErrObjectNotFound, keyOld)
+		}
+		return nil
+	})
 }
 
 func (s *SQLStore) RenameObjects(ctx context.Context, bucket, prefixOld, prefixNew string) error {
-	tx := s.db.Exec("UPDATE objects SET object_id = "+sqlConcat(s.db, "?", "SUBSTR(object_id, ?)")+" WHERE SUBSTR(object_id, 1, ?) = ?",
-		prefixNew, utf8.RuneCountInString(prefixOld)+1, utf8.RuneCountInString(prefixOld), prefixOld)
+	tx := s.db.Exec("UPDATE objects SET object_id = "+sqlConcat(s.db, "?", "SUBSTR(object_id, ?)")+" WHERE SUBSTR(object_id, 1, ?) = ? AND ?",
+		prefixNew, utf8.RuneCountInString(prefixOld)+1, utf8.RuneCountInString(prefixOld), prefixOld, sqlWhereBucket("objects", bucket))
 	if tx.Error != nil {
 		return tx.Error
 	}
@@ -1248,14 +1755,28 @@ func (s *SQLStore) AddPartialSlab(ctx context.Context, data []byte, minShards, t
 	return s.slabBufferMgr.AddPartialSlab(ctx, data, minShards, totalShards, contractSetID)
 }
 
-func (s *SQLStore) CopyObject(ctx context.Context, srcBucket, dstBucket, srcPath, dstPath, mimeType string) (om api.ObjectMetadata, err error) {
+// CopyObject copies an object to the given path, replacing the object that
+// existed at that path. It returns whether an object was replaced.
+func (s *SQLStore) CopyObject(ctx context.Context, srcBucket, dstBucket, srcPath, dstPath, mimeType string) (om api.ObjectMetadata, overwritten bool, err error) {
+	s.objectsMu.Lock()
+	defer s.objectsMu.Unlock()
+
+	var usageDelta int64
+	defer func() {
+		if err == nil {
+			s.updateBucketUsage(dstBucket, usageDelta)
+		}
+	}()
+
 	err = s.retryTransaction(func(tx *gorm.DB) error {
 		var srcObj dbObject
 		err = tx.Where("objects.object_id = ? AND DBBucket.name = ?", srcPath, srcBucket).
 			Joins("DBBucket").
 			Take(&srcObj).
 			Error
-		if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: key %v", api.ErrObjectNotFound, srcPath)
+		} else if err != nil {
 			return fmt.Errorf("failed to fetch src object: %w", err)
 		}
 
@@ -1267,6 +1788,7 @@ func (s *SQLStore) CopyObject(ctx context.Context, srcBucket, dstBucket, srcPath
 		if srcBucket == dstBucket && srcPath == dstPath {
 			// No copying is happening. We just update the metadata on the src
 			// object.
+			overwritten = true
 			srcObj.MimeType = mimeType
 			om = api.ObjectMetadata{
 				Health:   srcObjHealth,
@@ -1277,10 +1799,24 @@ func (s *SQLStore) CopyObject(ctx context.Context, srcBucket, dstBucket, srcPath
 			}
 			return tx.Save(&srcObj).Error
 		}
-		_, err = deleteObject(tx, dstBucket, dstPath)
+
+		var bucket dbBucket
+		err = tx.Where("name = ?", dstBucket).
+			Take(&bucket).
+			Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch dst bucket: %w", err)
+		}
+		usageDelta, err = s.checkBucketLimits(tx, bucket, dstPath, srcObj.Size)
+		if err != nil {
+			return err
+		}
+
+		numDeleted, err := deleteObject(tx, dstBucket, dstPath)
 		if err != nil {
 			return fmt.Errorf("failed to delete object: %w", err)
 		}
+		overwritten = numDeleted > 0
 
 		var srcSlices []dbSlice
 		err = tx.Where("db_object_id = ?", srcObj.ID).
@@ -1294,20 +1830,13 @@ func (s *SQLStore) CopyObject(ctx context.Context, srcBucket, dstBucket, srcPath
 			srcSlices[i].DBObjectID = nil // clear object id
 		}
 
-		var bucket dbBucket
-		err = tx.Where("name = ?", dstBucket).
-			Take(&bucket).
-			Error
-		if err != nil {
-			return fmt.Errorf("failed to fetch dst bucket: %w", err)
-		}
-
 		dstObj := srcObj
 		dstObj.Model = Model{}        // clear model
 		dstObj.DBBucket = bucket      // set dst bucket
 		dstObj.ObjectID = dstPath     // set dst path
 		dstObj.DBBucketID = bucket.ID // set dst bucket id
 		dstObj.Slabs = srcSlices      // set slices
+		dstObj.ExpiresAt = objectExpiry(bucket.Policy)
 		if mimeType != "" {
 			dstObj.MimeType = mimeType // override mime type
 		}
@@ -1315,6 +1844,12 @@ func (s *SQLStore) CopyObject(ctx context.Context, srcBucket, dstBucket, srcPath
 			return fmt.Errorf("failed to create copy of object: %w", err)
 		}
 
+		// Copy the user metadata.
+		if err := tx.Exec("INSERT INTO object_user_metadata (created_at, db_object_id, `key`, value) SELECT ?, ?, `key`, value FROM object_user_metadata WHERE db_object_id = ?",
+			time.Now(), dstObj.ID, srcObj.ID).Error; err != nil {
+			return fmt.Errorf("failed to copy user metadata: %w", err)
+		}
+
 		om = api.ObjectMetadata{
 			MimeType: dstObj.MimeType,
 			ETag:     dstObj.Etag,
@@ -1392,7 +1927,9 @@ func (s *SQLStore) DeleteHostSector(ctx context.Context, hk types.PublicKey, roo
 	})
 }
 
-func (s *SQLStore) UpdateObject(ctx context.Context, bucket, path, contractSet, eTag, mimeType string, o object.Object, usedContracts map[types.PublicKey]types.FileContractID) error {
+// UpdateObject adds an object at the given path, replacing the object that
+// existed at that path. It returns whether an object was replaced.
+func (s *SQLStore) UpdateObject(ctx context.Context, bucket, path, contractSet, eTag, mimeType string, metadata api.ObjectUserMetadata, o object.Object, usedContracts map[types.PublicKey]types.FileContractID) (overwritten bool, err error) {
 	s.objectsMu.Lock()
 	defer s.objectsMu.Unlock()
 
@@ -1402,56 +1939,70 @@ func (s *SQLStore) UpdateObject(ctx context.Context, bucket, path, contractSet,
 			// Verify that all hosts have a contract.
 			_, exists := usedContracts[shard.Host]
 			if !exists {
-				return fmt.Errorf("missing contract for host %v: %w", shard.Host, api.ErrContractNotFound)
+				return false, fmt.Errorf("missing contract for host %v: %w", shard.Host, api.ErrContractNotFound)
 			}
 		}
 	}
 
 	// UpdateObject is ACID.
-	return s.retryTransaction(func(tx *gorm.DB) error {
+	var usageDelta int64
+	err = s.retryTransaction(func(tx *gorm.DB) error {
 		// Fetch contract set.
 		var cs dbContractSet
 		if err := tx.Take(&cs, "name = ?", contractSet).Error; err != nil {
 			return fmt.Errorf("contract set %v not found: %w", contractSet, err)
 		}
 
+		// Fetch the bucket and check its limits.
+		var b dbBucket
+		err = tx.Where("name = ?", bucket).
+			Take(&b).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("bucket %v not found: %w", bucket, api.ErrBucketNotFound)
+		} else if err != nil {
+			return fmt.Errorf("failed to fetch bucket: %w", err)
+		}
+		usageDelta, err = s.checkBucketLimits(tx, b, path, int64(o.TotalSize()))
+		if err != nil {
+			return err
+		}
+
 		// Try to delete. We want to get rid of the object and its slices if it
 		// exists.
 		//
 		// NOTE: please note that the object's created_at is currently used as
 		// its ModTime, if we ever stop recreating the object but update it
 		// instead we need to take this into account
-		_, err := deleteObject(tx, bucket, path)
+		numDeleted, err := deleteObject(tx, bucket, path)
 		if err != nil {
 			return fmt.Errorf("failed to delete object: %w", err)
 		}
+		overwritten = numDeleted > 0
 
 		// Insert a new object.
 		objKey, err := o.Key.MarshalText()
 		if err != nil {
 			return fmt.Errorf("failed to marshal object key: %w", err)
 		}
-		var bucketID uint
-		err = tx.Table("(SELECT id from buckets WHERE buckets.name = ?) bucket_id", bucket).
-			Take(&bucketID).Error
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("bucket %v not found: %w", bucket, api.ErrBucketNotFound)
-		} else if err != nil {
-			return fmt.Errorf("failed to fetch bucket id: %w", err)
-		}
 		obj := dbObject{
-			DBBucketID: bucketID,
+			DBBucketID: b.ID,
 			ObjectID:   path,
 			Key:        objKey,
 			Size:       o.TotalSize(),
 			MimeType:   mimeType,
 			Etag:       eTag,
+			ExpiresAt:  objectExpiry(b.Policy),
 		}
 		err = tx.Create(&obj).Error
 		if err != nil {
 			return fmt.Errorf("failed to create object: %w", err)
 		}
 
+		// Create the user metadata.
+		if err := createUserMetadata(tx, &obj.ID, nil, metadata); err != nil {
+			return fmt.Errorf("failed to create user metadata: %w", err)
+		}
+
 		// Fetch the used contracts.
 		contracts, err := fetchUsedContracts(tx, usedContracts)
 		if err != nil {
@@ -1464,6 +2015,10 @@ func (s *SQLStore) UpdateObject(ctx context.Context, bucket, path, contractSet,
 		}
 		return nil
 	})
+	if err == nil {
+		s.updateBucketUsage(bucket, usageDelta)
+	}
+	return
 }
 
 func (s *SQLStore) RemoveObject(ctx context.Context, bucket, key string) error {
@@ -1473,6 +2028,7 @@ func (s *SQLStore) RemoveObject(ctx context.Context, bucket, key string) error {
 		rowsAffected, err = deleteObject(tx, bucket, key)
 		return err
 	})
+	s.invalidateBucketUsage(bucket)
 	if err != nil {
 		return err
 	}
@@ -1482,20 +2038,51 @@ func (s *SQLStore) RemoveObject(ctx context.Context, bucket, key string) error {
 	return nil
 }
 
-func (s *SQLStore) RemoveObjects(ctx context.Context, bucket, prefix string) error {
-	var rowsAffected int64
-	var err error
-	err = s.retryTransaction(func(tx *gorm.DB) error {
-		rowsAffected, err = deleteObjects(tx, bucket, prefix)
-		return err
-	})
-	if err != nil {
+// RemoveObjects removes all objects with the given prefix. The objects are
+// deleted in batches, every batch in its own transaction, so very large
+// prefixes don't lock the database for a long time. If the context is
+// cancelled midway, the objects that were deleted so far stay deleted. The
+// optional progress function is called after every batch.
+func (s *SQLStore) RemoveObjects(ctx context.Context, bucket, prefix string, progress func(deleted, total int64)) error {
+	var total int64
+	if err := s.db.
+		Model(&dbObject{}).
+		Where("SUBSTR(object_id, 1, ?) = ? AND ?", utf8.RuneCountInString(prefix), prefix, sqlWhereBucket("objects", bucket)).
+		Count(&total).
+		Error; err != nil {
 		return err
-	}
-	if rowsAffected == 0 {
+	} else if total == 0 {
 		return fmt.Errorf("%w: prefix: %s", api.ErrObjectNotFound, prefix)
 	}
-	return nil
+
+	var deleted int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var batch int64
+		err := s.retryTransaction(func(tx *gorm.DB) (err error) {
+			batch, err = deleteObjects(tx, bucket, prefix, removeObjectsBatchSize)
+			return
+		})
+		s.invalidateBucketUsage(bucket)
+		if err != nil {
+			return err
+		}
+		deleted += batch
+
+		// objects might have been added in the meantime
+		if deleted > total {
+			total = deleted
+		}
+		if progress != nil {
+			progress(deleted, total)
+		}
+		if batch < int64(removeObjectsBatchSize) {
+			return nil
+		}
+	}
 }
 
 func (s *SQLStore) Slab(ctx context.Context, key object.EncryptionKey) (object.Slab, error) {
@@ -1689,10 +2276,21 @@ func (s *SQLStore) UnhealthySlabs(ctx context.Context, healthCutoff float64, set
 	var rows []struct {
 		Key    []byte
 		Health float64
+		Bucket sql.NullString
 	}
 
+	// NOTE: a slab is migrated using the policy of the bucket of the first
+	// object that references it
 	if err := s.db.
-		Select("slabs.key, slabs.health").
+		Select(`slabs.key, slabs.health, (
+	SELECT b.name
+	FROM slices sli
+	INNER JOIN objects o ON sli.db_object_id = o.id
+	INNER JOIN buckets b ON o.db_bucket_id = b.id
+	WHERE sli.db_slab_id = slabs.id
+	ORDER BY sli.id ASC
+	LIMIT 1
+) AS bucket`).
 		Joins("INNER JOIN contract_sets cs ON slabs.db_contract_set_id = cs.id").
 		Model(&dbSlab{}).
 		Where("health <= ? AND health_valid = 1 AND cs.name = ?", healthCutoff, set).
@@ -1712,6 +2310,81 @@ func (s *SQLStore) UnhealthySlabs(ctx context.Context, healthCutoff float64, set
 		slabs[i] = api.UnhealthySlab{
 			Key:    key,
 			Health: row.Health,
+			Bucket: row.Bucket.String,
+		}
+	}
+	return slabs, nil
+}
+
+// SlabsHealth computes the health of the slabs with regards to the given
+// contract set. Unlike the cached health that is used for migrations, the
+// health is computed on the fly, every sector stored on a contract in the set
+// counts as a good shard. Slabs are sorted by health, least healthy first.
+func (s *SQLStore) SlabsHealth(ctx context.Context, set string, unhealthyOnly bool, offset, limit int) ([]api.SlabHealth, error) {
+	if limit <= -1 {
+		limit = math.MaxInt
+	}
+
+	var cs dbContractSet
+	if err := s.db.Where("name = ?", set).Take(&cs).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w '%s'", api.ErrContractSetNotFound, set)
+	} else if err != nil {
+		return nil, err
+	}
+
+	healthQuery := s.db.Raw(`
+SELECT slabs.id, slabs.key, slabs.min_shards, slabs.total_shards, good.shards AS good_shards, CASE WHEN (slabs.min_shards = slabs.total_shards)
+THEN
+    CASE WHEN (good.shards < slabs.min_shards)
+    THEN -1
+    ELSE 1
+    END
+ELSE (CAST(good.shards AS FLOAT) - CAST(slabs.min_shards AS FLOAT)) / CAST(slabs.total_shards - slabs.min_shards AS FLOAT)
+END AS health
+FROM slabs
+INNER JOIN (
+	SELECT s.db_slab_id, COUNT(DISTINCT(CASE WHEN csc.db_contract_id IS NULL THEN NULL ELSE c.host_id END)) AS shards
+	FROM sectors s
+	LEFT JOIN contract_sectors se ON s.id = se.db_sector_id
+	LEFT JOIN contracts c ON se.db_contract_id = c.id
+	LEFT JOIN contract_set_contracts csc ON csc.db_contract_id = c.id AND csc.db_contract_set_id = ?
+	GROUP BY s.db_slab_id
+) good ON good.db_slab_id = slabs.id
+`, cs.ID)
+
+	var rows []struct {
+		Key         []byte
+		MinShards   uint8
+		TotalShards uint8
+		GoodShards  int
+		Health      float64
+	}
+	query := s.db.Table("(?) h", healthQuery)
+	if unhealthyOnly {
+		query = query.Where("h.health < 1")
+	}
+	if err := query.
+		Select("h.key, h.min_shards, h.total_shards, h.good_shards, h.health").
+		Order("h.health ASC, h.id ASC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&rows).
+		Error; err != nil {
+		return nil, err
+	}
+
+	slabs := make([]api.SlabHealth, len(rows))
+	for i, row := range rows {
+		var key object.EncryptionKey
+		if err := key.UnmarshalText(row.Key); err != nil {
+			return nil, err
+		}
+		slabs[i] = api.SlabHealth{
+			Key:         key,
+			Health:      row.Health,
+			GoodShards:  row.GoodShards,
+			MinShards:   row.MinShards,
+			TotalShards: row.TotalShards,
 		}
 	}
 	return slabs, nil
@@ -1821,7 +2494,7 @@ func (s *SQLStore) object(ctx context.Context, txn *gorm.DB, bucket string, path
 	// accordingly
 	var rows rawObject
 	tx := s.db.
-		Select("o.id as ObjectID, o.key as ObjectKey, o.object_id as ObjectName, o.size as ObjectSize, o.mime_type as ObjectMimeType, o.created_at as ObjectModTime, o.etag as ObjectETag, sli.id as SliceID, sli.offset as SliceOffset, sli.length as SliceLength, sla.id as SlabID, sla.health as SlabHealth, sla.key as SlabKey, sla.min_shards as SlabMinShards, bs.id IS NOT NULL AS SlabBuffered, sec.id as SectorID, sec.root as SectorRoot, sec.latest_host as SectorHost").
+		Select("o.id as ObjectID, o.key as ObjectKey, o.object_id as ObjectName, o.size as ObjectSize, o.mime_type as ObjectMimeType, o.created_at as ObjectModTime, o.etag as ObjectETag, o.expires_at as ObjectExpiry, sli.id as SliceID, sli.offset as SliceOffset, sli.length as SliceLength, sla.id as SlabID, sla.health as SlabHealth, sla.key as SlabKey, sla.min_shards as SlabMinShards, bs.id IS NOT NULL AS SlabBuffered, sec.id as SectorID, sec.root as SectorRoot, sec.latest_host as SectorHost").
 		Model(&dbObject{}).
 		Table("objects o").
 		Joins("INNER JOIN buckets b ON o.db_bucket_id = b.id AND b.name = ?", bucket).
@@ -1830,6 +2503,7 @@ func (s *SQLStore) object(ctx context.Context, txn *gorm.DB, bucket string, path
 		Joins("LEFT JOIN sectors sec ON sla.id = sec.`db_slab_id`").
 		Joins("LEFT JOIN buffered_slabs bs ON sla.db_buffered_slab_id = bs.`id`").
 		Where("o.object_id = ? AND ?", path, sqlWhereBucket("o", bucket)).
+		Where("o.expires_at IS NULL OR o.expires_at > ?", time.Now()).
 		Order("sli.id ASC").
 		Order("sec.id ASC").
 		Scan(&rows)
@@ -1898,7 +2572,7 @@ func (s *SQLStore) ObjectsBySlabKey(ctx context.Context, bucket string, slabKey
 	}
 
 	err = s.db.Raw(`
-SELECT DISTINCT obj.object_id as Name, obj.size as Size, obj.mime_type as MimeType, sla.health as Health
+SELECT DISTINCT obj.object_id as Name, obj.size as Size, obj.mime_type as MimeType, obj.etag as ETag, obj.created_at as ModTime, sla.health as Health
 FROM slabs sla
 INNER JOIN slices sli ON sli.db_slab_id = sla.id
 INNER JOIN objects obj ON sli.db_object_id = obj.id
@@ -2135,36 +2809,58 @@ func archiveContracts(tx *gorm.DB, contracts []dbContract, toArchive map[types.F
 	return nil
 }
 
-// deleteObject deletes an object from the store and prunes all slabs which are
-// without an obect after the deletion. That means in case of packed uploads,
-// the slab is only deleted when no more objects point to it.
+// deleteObject deletes an object from the store. The slabs which are without an
+// object after the deletion are not pruned synchronously, that way deleting
+// large objects doesn't take long, instead they are pruned in batches by
+// PruneSlabs. That means in case of packed uploads, the slab is only deleted
+// when no more objects point to it.
 func deleteObject(tx *gorm.DB, bucket string, path string) (numDeleted int64, _ error) {
 	tx = tx.Where("object_id = ? AND ?", path, sqlWhereBucket("objects", bucket)).
 		Delete(&dbObject{})
-	if tx.Error != nil {
-		return 0, tx.Error
-	}
-	numDeleted = tx.RowsAffected
-	if numDeleted == 0 {
-		return 0, nil // nothing to prune if no object was deleted
+	return tx.RowsAffected, tx.Error
+}
+
+func deleteObjects(tx *gorm.DB, bucket string, path string, limit int) (numDeleted int64, _ error) {
+	tx = tx.Exec("DELETE FROM objects WHERE id IN (SELECT id FROM (SELECT id FROM objects WHERE SUBSTR(object_id, 1, ?) = ? AND ? LIMIT ?) AS ids)",
+		utf8.RuneCountInString(path), path, sqlWhereBucket("objects", bucket), limit)
+	return tx.RowsAffected, tx.Error
+}
+
+// createUserMetadata stores the given user metadata for either an object or a
+// multipart upload.
+func createUserMetadata(tx *gorm.DB, objectID, multipartUploadID *uint, metadata api.ObjectUserMetadata) error {
+	if len(metadata) == 0 {
+		return nil
 	}
-	if err := pruneSlabs(tx); err != nil {
-		return 0, err
+	entities := make([]dbObjectUserMetadata, 0, len(metadata))
+	for k, v := range metadata {
+		entities = append(entities, dbObjectUserMetadata{
+			DBObjectID:          objectID,
+			DBMultipartUploadID: multipartUploadID,
+			Key:                 k,
+			Value:               v,
+		})
 	}
-	return
+	return tx.CreateInBatches(&entities, 100).Error
 }
 
-func deleteObjects(tx *gorm.DB, bucket string, path string) (numDeleted int64, _ error) {
-	tx = tx.Exec("DELETE FROM objects WHERE SUBSTR(object_id, 1, ?) = ? AND ?",
-		utf8.RuneCountInString(path), path, sqlWhereBucket("objects", bucket))
-	if tx.Error != nil {
-		return 0, tx.Error
+// objectUserMetadata returns the user metadata of the object with given id.
+func objectUserMetadata(tx *gorm.DB, objectID uint) (api.ObjectUserMetadata, error) {
+	var entities []dbObjectUserMetadata
+	if err := tx.
+		Where("db_object_id = ?", objectID).
+		Find(&entities).
+		Error; err != nil {
+		return nil, err
 	}
-	numDeleted = tx.RowsAffected
-	if err := pruneSlabs(tx); err != nil {
-		return 0, err
+	if len(entities) == 0 {
+		return nil, nil
 	}
-	return numDeleted, nil
+	metadata := make(api.ObjectUserMetadata, len(entities))
+	for _, e := range entities {
+		metadata[e.Key] = e.Value
+	}
+	return metadata, nil
 }
 
 func invalidateSlabHealthByFCID(tx *gorm.DB, fcids []fileContractID) error {
@@ -2228,10 +2924,12 @@ func sqlWhereBucket(objTable string, bucket string) clause.Expr {
 	return gorm.Expr(fmt.Sprintf("%s.db_bucket_id = (SELECT id FROM buckets WHERE buckets.name = ?)", objTable), bucket)
 }
 
-// TODO: we can use ObjectEntries instead of ListObject if we want to use '/' as
-// a delimiter for now (see backend.go) but it would be interesting to have
-// arbitrary 'delim' support in ListObjects.
-func (s *SQLStore) ListObjects(ctx context.Context, bucket, prefix, marker string, limit int) (api.ObjectsListResponse, error) {
+// ListObjects lists the objects in the given bucket that start with the given
+// prefix. If a delimiter is given, objects that contain the delimiter after the
+// prefix are rolled up into a common prefix that ends at the first occurrence
+// of the delimiter, common prefixes count towards the limit and can be used as
+// a marker, matching the semantics of S3.
+func (s *SQLStore) ListObjects(ctx context.Context, bucket, prefix, delimiter, sortBy, sortDir, marker string, limit int) (api.ObjectsListResponse, error) {
 	// fetch one more to see if there are more entries
 	if limit <= -1 {
 		limit = math.MaxInt
@@ -2239,26 +2937,78 @@ func (s *SQLStore) ListObjects(ctx context.Context, bucket, prefix, marker strin
 		limit++
 	}
 
+	// objects are sorted by name by default, ties are broken by name
+	var sortColumn string
+	switch sortBy {
+	case "", api.ObjectSortByName:
+		sortColumn = "object_id"
+	case api.ObjectSortBySize:
+		sortColumn = "size"
+	case api.ObjectSortByModTime:
+		sortColumn = "created_at"
+	default:
+		return api.ObjectsListResponse{}, fmt.Errorf("%w: unknown sort field '%s'", api.ErrInvalidObjectSortParameters, sortBy)
+	}
+	if delimiter != "" && sortColumn != "object_id" {
+		return api.ObjectsListResponse{}, fmt.Errorf("%w: listing with a delimiter requires sorting by name", api.ErrInvalidObjectSortParameters)
+	}
+	var cmp string
+	switch strings.ToLower(sortDir) {
+	case "", api.ObjectSortDirAsc:
+		sortDir, cmp = "ASC", ">"
+	case api.ObjectSortDirDesc:
+		sortDir, cmp = "DESC", "<"
+	default:
+		return api.ObjectsListResponse{}, fmt.Errorf("%w: unknown sort direction '%s'", api.ErrInvalidObjectSortParameters, sortDir)
+	}
+
 	prefixExpr := gorm.Expr("TRUE")
 	if prefix != "" {
 		prefixExpr = gorm.Expr("SUBSTR(o.object_id, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix)
 	}
+
+	// objects are grouped by their name unless a delimiter is given, in which
+	// case all objects that share a common prefix are grouped together
+	nameExpr := gorm.Expr("o.object_id")
+	if delimiter != "" {
+		prefixLen := utf8.RuneCountInString(prefix)
+		delimPos := gorm.Expr("INSTR(SUBSTR(o.object_id, ?), ?)", prefixLen+1, delimiter)
+		nameExpr = gorm.Expr("CASE WHEN ? > 0 THEN SUBSTR(o.object_id, 1, ? + ?) ELSE o.object_id END", delimPos, delimPos, prefixLen+utf8.RuneCountInString(delimiter)-1)
+	}
+
+	// the marker is the name of the last object or common prefix of the
+	// previous page, if we sort by anything but the name it's a continuation
+	// token that holds the sort value and name of the last object, that way
+	// the listing continues even if that object was deleted in the meantime
 	markerExpr := gorm.Expr("TRUE")
-	if marker != "" {
-		markerExpr = gorm.Expr("o.object_id > ?", marker)
+	if marker != "" && sortColumn == "object_id" {
+		markerExpr = gorm.Expr(fmt.Sprintf("? %s ?", cmp), nameExpr, marker)
+	} else if marker != "" {
+		value, name, err := decodeListMarker(sortColumn, marker)
+		if err != nil {
+			return api.ObjectsListResponse{}, err
+		}
+		markerExpr = gorm.Expr(fmt.Sprintf("(o.%[1]s %[2]s ? OR (o.%[1]s = ? AND o.object_id %[2]s ?))", sortColumn, cmp), value, value, name)
+	}
+
+	// NOTE: the query must not join a table with a 'name' column, it groups
+	// and orders by the Name alias
+	orderBy := fmt.Sprintf("Name %s", sortDir)
+	if sortColumn != "object_id" {
+		orderBy = fmt.Sprintf("MAX(o.%s) %s, %s", sortColumn, sortDir, orderBy)
 	}
 
 	var rows []rawObjectMetadata
 	err := s.db.
-		Select("o.object_id as Name, MAX(o.size) as Size, MIN(sla.health) as Health, MAX(o.mime_type) as mimeType, MAX(o.created_at) as ModTime").
+		Select("? as Name, MAX(o.size) as Size, MIN(sla.health) as Health, MAX(o.mime_type) as MimeType, MAX(o.etag) as ETag, MAX(o.created_at) as ModTime", nameExpr).
 		Model(&dbObject{}).
 		Table("objects o").
-		Joins("INNER JOIN buckets b ON o.db_bucket_id = b.id AND b.name = ?", bucket).
 		Joins("LEFT JOIN slices sli ON o.id = sli.`db_object_id`").
 		Joins("LEFT JOIN slabs sla ON sli.db_slab_id = sla.`id`").
 		Where("? AND ? AND ?", sqlWhereBucket("o", bucket), prefixExpr, markerExpr).
-		Group("o.object_id").
-		Order("o.object_id").
+		Where("o.expires_at IS NULL OR o.expires_at > ?", time.Now()).
+		Group("Name").
+		Order(orderBy).
 		Limit(int(limit)).
 		Scan(&rows).Error
 	if err != nil {
@@ -2270,17 +3020,66 @@ func (s *SQLStore) ListObjects(ctx context.Context, bucket, prefix, marker strin
 	if len(rows) == limit {
 		hasMore = true
 		rows = rows[:len(rows)-1]
-		nextMarker = rows[len(rows)-1].Name
+		nextMarker = encodeListMarker(sortColumn, rows[len(rows)-1])
 	}
 
 	var objects []api.ObjectMetadata
+	var commonPrefixes []string
 	for _, row := range rows {
+		if delimiter != "" && strings.Contains(strings.TrimPrefix(row.Name, prefix), delimiter) {
+			commonPrefixes = append(commonPrefixes, row.Name)
+			continue
+		}
 		objects = append(objects, row.convert())
 	}
 
 	return api.ObjectsListResponse{
-		HasMore:    hasMore,
-		NextMarker: nextMarker,
-		Objects:    objects,
+		CommonPrefixes: commonPrefixes,
+		HasMore:        hasMore,
+		NextMarker:     nextMarker,
+		Objects:        objects,
 	}, nil
 }
+
+// listMarker is the continuation token of a listing that isn't sorted by name.
+type listMarker struct {
+	Value string `json:"value"`
+	Name  string `json:"name"`
+}
+
+// encodeListMarker encodes the continuation token that points to the given row.
+func encodeListMarker(sortColumn string, row rawObjectMetadata) string {
+	if sortColumn == "object_id" {
+		return row.Name
+	}
+	lm := listMarker{Name: row.Name}
+	switch sortColumn {
+	case "size":
+		lm.Value = strconv.FormatInt(row.Size, 10)
+	case "created_at":
+		lm.Value = time.Time(row.ModTime).UTC().Format(time.RFC3339Nano)
+	}
+	b, _ := json.Marshal(lm)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeListMarker decodes a continuation token into the sort value and name
+// of the last object of the previous page.
+func decodeListMarker(sortColumn, marker string) (value interface{}, name string, err error) {
+	var lm listMarker
+	if b, err := base64.RawURLEncoding.DecodeString(marker); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", api.ErrInvalidMarker, err)
+	} else if err := json.Unmarshal(b, &lm); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", api.ErrInvalidMarker, err)
+	}
+	switch sortColumn {
+	case "size":
+		value, err = strconv.ParseInt(lm.Value, 10, 64)
+	case "created_at":
+		value, err = time.Parse(time.RFC3339Nano, lm.Value)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", api.ErrInvalidMarker, err)
+	}
+	return value, lm.Name, nil
+}
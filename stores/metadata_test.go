@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -97,7 +98,7 @@ func TestObjectBasic(t *testing.T) {
 	}
 
 	// add the object
-	if err := db.UpdateObject(context.Background(), api.DefaultBucketName, t.Name(), testContractSet, testETag, testMimeType, want, map[types.PublicKey]types.FileContractID{
+	if _, err := db.UpdateObject(context.Background(), api.DefaultBucketName, t.Name(), testContractSet, testETag, testMimeType, testMetadata, want, map[types.PublicKey]types.FileContractID{
 		hk1: fcid1,
 		hk2: fcid2,
 	}); err != nil {
@@ -136,7 +137,7 @@ func TestObjectBasic(t *testing.T) {
 	}
 
 	// add the object
-	if err := db.UpdateObject(context.Background(), api.DefaultBucketName, t.Name(), testContractSet, testETag, testMimeType, want2, make(map[types.PublicKey]types.FileContractID)); err != nil {
+	if _, err := db.UpdateObject(context.Background(), api.DefaultBucketName, t.Name(), testContractSet, testETag, testMimeType, testMetadata, want2, make(map[types.PublicKey]types.FileContractID)); err != nil {
 		t.Fatal(err)
 	}
 
@@ -150,6 +151,40 @@ func TestObjectBasic(t *testing.T) {
 	}
 }
 
+// TestEmptyObject verifies empty objects are stored and listed with a size of
+// 0 and are considered healthy.
+func TestEmptyObject(t *testing.T) {
+	db, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add an empty object
+	ctx := context.Background()
+	obj := object.NewObject(object.GenerateEncryptionKey())
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, "/empty", testContractSet, testETag, testMimeType, testMetadata, obj, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// fetch the object
+	got, err := db.Object(ctx, api.DefaultBucketName, "/empty")
+	if err != nil {
+		t.Fatal(err)
+	} else if got.Size != 0 || got.Health != 1 || got.ETag != testETag {
+		t.Fatalf("unexpected object metadata %+v", got.ObjectMetadata)
+	} else if len(got.Slabs) != 0 || len(got.PartialSlabs) != 0 {
+		t.Fatal("expected no slabs", got.Slabs, got.PartialSlabs)
+	}
+
+	// assert it's listed
+	entries, _, err := db.ObjectEntries(ctx, api.DefaultBucketName, "/", "", "", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || entries[0].Name != "/empty" || entries[0].Size != 0 {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+}
+
 // TestSQLContractStore tests SQLContractStore functionality.
 func TestSQLContractStore(t *testing.T) {
 	cs, _, _, err := newTestSQLStore(t.TempDir())
@@ -434,7 +469,7 @@ func TestContractRoots(t *testing.T) {
 	}
 
 	// add the object.
-	if err := cs.UpdateObject(context.Background(), api.DefaultBucketName, t.Name(), testContractSet, testETag, testMimeType, obj, map[types.PublicKey]types.FileContractID{hks[0]: fcids[0]}); err != nil {
+	if _, err := cs.UpdateObject(context.Background(), api.DefaultBucketName, t.Name(), testContractSet, testETag, testMimeType, testMetadata, obj, map[types.PublicKey]types.FileContractID{hks[0]: fcids[0]}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -447,6 +482,213 @@ func TestContractRoots(t *testing.T) {
 	}
 }
 
+func TestContractSlabs(t *testing.T) {
+	cs, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add two hosts with a contract each
+	hks, err := cs.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := cs.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0], hks[1]: fcids[1]}
+
+	// add an object with three slabs, the first two are stored on the first
+	// host, the last one on the second host
+	newSlab := func(hk types.PublicKey, root types.Hash256) object.SlabSlice {
+		return object.SlabSlice{Slab: object.Slab{
+			Key:       object.GenerateEncryptionKey(),
+			MinShards: 1,
+			Shards:    []object.Sector{{Host: hk, Root: root}},
+		}}
+	}
+	obj := object.Object{
+		Key: object.GenerateEncryptionKey(),
+		Slabs: []object.SlabSlice{
+			newSlab(hks[0], types.Hash256{1}),
+			newSlab(hks[0], types.Hash256{2}),
+			newSlab(hks[1], types.Hash256{3}),
+		},
+	}
+	if _, err := cs.UpdateObject(context.Background(), api.DefaultBucketName, t.Name(), testContractSet, testETag, testMimeType, testMetadata, obj, usedContracts); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the slabs of the first contract are returned in order
+	slabs, err := cs.ContractSlabs(context.Background(), fcids[0], -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(slabs) != 2 {
+		t.Fatal("unexpected number of slabs", len(slabs))
+	} else if slabs[0].Key.String() != obj.Slabs[0].Key.String() || slabs[1].Key.String() != obj.Slabs[1].Key.String() {
+		t.Fatal("unexpected slabs", slabs)
+	} else if slabs[0].Bucket != api.DefaultBucketName {
+		t.Fatal("unexpected bucket", slabs[0].Bucket)
+	}
+
+	// assert the limit is applied
+	slabs, err = cs.ContractSlabs(context.Background(), fcids[0], 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(slabs) != 1 || slabs[0].Key.String() != obj.Slabs[0].Key.String() {
+		t.Fatal("unexpected slabs", slabs)
+	}
+
+	// assert unknown contracts return an error
+	if _, err := cs.ContractSlabs(context.Background(), types.FileContractID{255}, -1); !errors.Is(err, api.ErrContractNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestHostObjects tests fetching the objects that have data on a host.
+func TestHostObjects(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add three hosts with a contract each
+	hks, err := ss.addTestHosts(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := ss.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0], hks[1]: fcids[1], hks[2]: fcids[2]}
+
+	// add two objects, the first one is stored on the first two hosts, the
+	// second one on the second host
+	newObject := func(hks ...types.PublicKey) object.Object {
+		obj := object.Object{Key: object.GenerateEncryptionKey()}
+		for _, hk := range hks {
+			obj.Slabs = append(obj.Slabs, object.SlabSlice{Slab: object.Slab{
+				Key:       object.GenerateEncryptionKey(),
+				MinShards: 1,
+				Shards:    []object.Sector{{Host: hk, Root: frand.Entropy256()}},
+			}, Length: 1})
+		}
+		return obj
+	}
+	for i, obj := range []object.Object{newObject(hks[0], hks[1]), newObject(hks[1])} {
+		if _, err := ss.UpdateObject(context.Background(), api.DefaultBucketName, fmt.Sprintf("/obj%d", i), testContractSet, testETag, testMimeType, testMetadata, obj, usedContracts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert the objects of every host
+	for i, expected := range [][]string{{"/obj0"}, {"/obj0", "/obj1"}, nil} {
+		objects, err := ss.HostObjects(context.Background(), hks[i], -1)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(objects) != len(expected) {
+			t.Fatalf("unexpected number of objects for host %d: %v", i, len(objects))
+		}
+		for j, obj := range objects {
+			if obj.Name != expected[j] || obj.Bucket != api.DefaultBucketName {
+				t.Fatal("unexpected object", obj)
+			}
+		}
+	}
+
+	// assert the limit is applied
+	if objects, err := ss.HostObjects(context.Background(), hks[1], 1); err != nil {
+		t.Fatal(err)
+	} else if len(objects) != 1 || objects[0].Name != "/obj0" {
+		t.Fatal("unexpected objects", objects)
+	}
+}
+
+// TestAffectedObjects tests fetching the objects that are affected by losing a
+// host or contract.
+func TestAffectedObjects(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add three hosts with a contract each
+	hks, err := ss.addTestHosts(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := ss.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0], hks[1]: fcids[1], hks[2]: fcids[2]}
+
+	// add two objects with a single slab, the first one is stored on the
+	// first two hosts, the second one on all hosts
+	newObject := func(hks ...types.PublicKey) object.Object {
+		slab := object.Slab{Key: object.GenerateEncryptionKey(), MinShards: 1}
+		for _, hk := range hks {
+			slab.Shards = append(slab.Shards, object.Sector{Host: hk, Root: frand.Entropy256()})
+		}
+		return object.Object{
+			Key:   object.GenerateEncryptionKey(),
+			Slabs: []object.SlabSlice{{Slab: slab, Length: 1}},
+		}
+	}
+	for i, obj := range []object.Object{newObject(hks[0], hks[1]), newObject(hks...)} {
+		if _, err := ss.UpdateObject(context.Background(), api.DefaultBucketName, fmt.Sprintf("/obj%d", i), testContractSet, testETag, testMimeType, testMetadata, obj, usedContracts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert losing the first host or contract puts the first object at risk
+	assertAffected := func(objects []api.AffectedObject, err error, names []string, atRisk []bool) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		} else if len(objects) != len(names) {
+			t.Fatalf("unexpected number of objects: %v", len(objects))
+		}
+		for i, obj := range objects {
+			if obj.Name != names[i] || obj.Bucket != api.DefaultBucketName || obj.Slabs != 1 || obj.AtRisk != atRisk[i] {
+				t.Fatal("unexpected object", obj)
+			} else if obj.AtRisk && obj.AtRiskSlabs != 1 {
+				t.Fatal("unexpected number of slabs at risk", obj.AtRiskSlabs)
+			}
+		}
+	}
+	objects, err := ss.HostAffectedObjects(context.Background(), hks[0], 0, -1)
+	assertAffected(objects, err, []string{"/obj0", "/obj1"}, []bool{true, false})
+	objects, err = ss.ContractAffectedObjects(context.Background(), fcids[0], 0, -1)
+	assertAffected(objects, err, []string{"/obj0", "/obj1"}, []bool{true, false})
+
+	// assert losing the third host doesn't put any object at risk
+	objects, err = ss.HostAffectedObjects(context.Background(), hks[2], 0, -1)
+	assertAffected(objects, err, []string{"/obj1"}, []bool{false})
+
+	// assert pagination is applied
+	objects, err = ss.HostAffectedObjects(context.Background(), hks[1], 1, 1)
+	assertAffected(objects, err, []string{"/obj1"}, []bool{false})
+	if _, err := ss.HostAffectedObjects(context.Background(), hks[1], -1, 1); !errors.Is(err, ErrNegativeOffset) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert unknown contracts return an error
+	if _, err := ss.ContractAffectedObjects(context.Background(), types.FileContractID{255}, 0, -1); !errors.Is(err, api.ErrContractNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// archive the third contract, its sectors are lost so losing the first
+	// host puts both objects at risk
+	if err := ss.ArchiveContract(context.Background(), fcids[2], api.ContractArchivalReasonRemoved); err != nil {
+		t.Fatal(err)
+	}
+	objects, err = ss.HostAffectedObjects(context.Background(), hks[0], 0, -1)
+	assertAffected(objects, err, []string{"/obj0", "/obj1"}, []bool{true, true})
+}
+
 // TestRenewContract is a test for AddRenewedContract.
 func TestRenewedContract(t *testing.T) {
 	cs, _, _, err := newTestSQLStore(t.TempDir())
@@ -546,7 +788,7 @@ func TestRenewedContract(t *testing.T) {
 	}
 
 	// add the object.
-	if err := cs.UpdateObject(context.Background(), api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, obj, map[types.PublicKey]types.FileContractID{
+	if _, err := cs.UpdateObject(context.Background(), api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, testMetadata, obj, map[types.PublicKey]types.FileContractID{
 		hk:  fcid1,
 		hk2: fcid2,
 	}); err != nil {
@@ -986,12 +1228,12 @@ func TestSQLMetadataStore(t *testing.T) {
 	// Store it.
 	ctx := context.Background()
 	objID := "key1"
-	if err := db.UpdateObject(ctx, api.DefaultBucketName, objID, testContractSet, testETag, testMimeType, obj1, usedHosts); err != nil {
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, objID, testContractSet, testETag, testMimeType, testMetadata, obj1, usedHosts); err != nil {
 		t.Fatal(err)
 	}
 
 	// Try to store it again. Should work.
-	if err := db.UpdateObject(ctx, api.DefaultBucketName, objID, testContractSet, testETag, testMimeType, obj1, usedHosts); err != nil {
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, objID, testContractSet, testETag, testMimeType, testMetadata, obj1, usedHosts); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1158,7 +1400,7 @@ func TestSQLMetadataStore(t *testing.T) {
 
 	// Remove the first slab of the object.
 	obj1.Slabs = obj1.Slabs[1:]
-	if err := db.UpdateObject(ctx, api.DefaultBucketName, objID, testContractSet, testETag, testMimeType, obj1, usedHosts); err != nil {
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, objID, testContractSet, testETag, testMimeType, testMetadata, obj1, usedHosts); err != nil {
 		t.Fatal(err)
 	}
 	fullObj, err = db.Object(ctx, api.DefaultBucketName, objID)
@@ -1200,14 +1442,22 @@ func TestSQLMetadataStore(t *testing.T) {
 		}
 		return nil
 	}
+	// The slab of the overwritten object is pruned asynchronously.
+	if err := countCheck(1, 1, 2, 2); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.PruneSlabs(ctx, -1); err != nil {
+		t.Fatal(err)
+	}
 	if err := countCheck(1, 1, 1, 1); err != nil {
 		t.Fatal(err)
 	}
 
 	// Delete the object. Due to the cascade this should delete everything
-	// but the sectors.
+	// once the slabs are pruned.
 	if err := db.RemoveObject(ctx, api.DefaultBucketName, objID); err != nil {
 		t.Fatal(err)
+	} else if _, err := db.PruneSlabs(ctx, -1); err != nil {
+		t.Fatal(err)
 	}
 	if err := countCheck(0, 0, 0, 0); err != nil {
 		t.Fatal(err)
@@ -1293,7 +1543,7 @@ func TestObjectHealth(t *testing.T) {
 		},
 	}
 
-	if err := db.UpdateObject(context.Background(), api.DefaultBucketName, "/foo", testContractSet, testETag, testMimeType, add, map[types.PublicKey]types.FileContractID{
+	if _, err := db.UpdateObject(context.Background(), api.DefaultBucketName, "/foo", testContractSet, testETag, testMimeType, testMetadata, add, map[types.PublicKey]types.FileContractID{
 		hks[0]: fcids[0],
 		hks[1]: fcids[1],
 		hks[2]: fcids[2],
@@ -1358,7 +1608,7 @@ func TestObjectHealth(t *testing.T) {
 	}
 
 	// assert health is returned correctly by SearchObject
-	entries, err = db.SearchObjects(context.Background(), api.DefaultBucketName, "foo", 0, -1)
+	entries, err = db.SearchObjects(context.Background(), api.DefaultBucketName, "foo", nil, 0, -1)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(entries) != 1 {
@@ -1393,7 +1643,7 @@ func TestObjectHealth(t *testing.T) {
 		Key:   object.GenerateEncryptionKey(),
 		Slabs: nil,
 	}
-	if err := db.UpdateObject(context.Background(), api.DefaultBucketName, "/bar", testContractSet, testETag, testMimeType, add, nil); err != nil {
+	if _, err := db.UpdateObject(context.Background(), api.DefaultBucketName, "/bar", testContractSet, testETag, testMimeType, testMetadata, add, nil); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1434,7 +1684,7 @@ func TestObjectEntries(t *testing.T) {
 		obj, ucs := newTestObject(frand.Intn(9) + 1)
 		obj.Slabs = obj.Slabs[:1]
 		obj.Slabs[0].Length = uint32(o.size)
-		err := os.UpdateObject(ctx, api.DefaultBucketName, o.path, testContractSet, testETag, testMimeType, obj, ucs)
+		_, err := os.UpdateObject(ctx, api.DefaultBucketName, o.path, testContractSet, testETag, testMimeType, testMetadata, obj, ucs)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -1547,12 +1797,30 @@ func TestSearchObjects(t *testing.T) {
 		{"/gab/guub", 5},
 		{"/FOO/bar", 6}, // test case sensitivity
 	}
+
+	// assertMetadata asserts ModTime, MimeType and ETag and clears them so the
+	// entries are ready for comparison
+	assertMetadata := func(entries []api.ObjectMetadata) {
+		for i := range entries {
+			if entries[i].ModTime.IsZero() {
+				t.Fatal("mod time should be set")
+			} else if entries[i].MimeType != testMimeType {
+				t.Fatal("unexpected mime type", entries[i].MimeType)
+			} else if entries[i].ETag != testETag {
+				t.Fatal("unexpected etag", entries[i].ETag)
+			}
+			entries[i].ModTime = time.Time{}
+			entries[i].MimeType = ""
+			entries[i].ETag = ""
+		}
+	}
+
 	ctx := context.Background()
 	for _, o := range objects {
 		obj, ucs := newTestObject(frand.Intn(9) + 1)
 		obj.Slabs = obj.Slabs[:1]
 		obj.Slabs[0].Length = uint32(o.size)
-		if err := os.UpdateObject(ctx, api.DefaultBucketName, o.path, testContractSet, testETag, testMimeType, obj, ucs); err != nil {
+		if _, err := os.UpdateObject(ctx, api.DefaultBucketName, o.path, testContractSet, testETag, testMimeType, testMetadata, obj, ucs); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -1566,18 +1834,20 @@ func TestSearchObjects(t *testing.T) {
 		{"uu", []api.ObjectMetadata{{Name: "/foo/baz/quux", Size: 3, Health: 1}, {Name: "/foo/baz/quuz", Size: 4, Health: 1}, {Name: "/gab/guub", Size: 5, Health: 1}}},
 	}
 	for _, test := range tests {
-		got, err := os.SearchObjects(ctx, api.DefaultBucketName, test.path, 0, -1)
+		got, err := os.SearchObjects(ctx, api.DefaultBucketName, test.path, nil, 0, -1)
 		if err != nil {
 			t.Fatal(err)
 		}
+		assertMetadata(got)
 		if !(len(got) == 0 && len(test.want) == 0) && !reflect.DeepEqual(got, test.want) {
 			t.Errorf("\nkey: %v\ngot: %v\nwant: %v", test.path, got, test.want)
 		}
 		for offset := 0; offset < len(test.want); offset++ {
-			got, err := os.SearchObjects(ctx, api.DefaultBucketName, test.path, offset, 1)
+			got, err := os.SearchObjects(ctx, api.DefaultBucketName, test.path, nil, offset, 1)
 			if err != nil {
 				t.Fatal(err)
 			}
+			assertMetadata(got)
 			if len(got) != 1 || got[0] != test.want[offset] {
 				t.Errorf("\nkey: %v\ngot: %v\nwant: %v", test.path, got, test.want[offset])
 			}
@@ -1747,7 +2017,7 @@ func TestUnhealthySlabs(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	if err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, obj, map[types.PublicKey]types.FileContractID{
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, testMetadata, obj, map[types.PublicKey]types.FileContractID{
 		hk1: fcid1,
 		hk2: fcid2,
 		hk3: fcid3,
@@ -1769,10 +2039,10 @@ func TestUnhealthySlabs(t *testing.T) {
 	}
 
 	expected := []api.UnhealthySlab{
-		{Key: obj.Slabs[2].Key, Health: 0},
-		{Key: obj.Slabs[4].Key, Health: 0},
-		{Key: obj.Slabs[1].Key, Health: 0.5},
-		{Key: obj.Slabs[3].Key, Health: 0.5},
+		{Key: obj.Slabs[2].Key, Health: 0, Bucket: api.DefaultBucketName},
+		{Key: obj.Slabs[4].Key, Health: 0, Bucket: api.DefaultBucketName},
+		{Key: obj.Slabs[1].Key, Health: 0.5, Bucket: api.DefaultBucketName},
+		{Key: obj.Slabs[3].Key, Health: 0.5, Bucket: api.DefaultBucketName},
 	}
 	if !reflect.DeepEqual(slabs, expected) {
 		t.Fatal("slabs are not returned in the correct order")
@@ -1790,8 +2060,8 @@ func TestUnhealthySlabs(t *testing.T) {
 	}
 
 	expected = []api.UnhealthySlab{
-		{Key: obj.Slabs[2].Key, Health: 0},
-		{Key: obj.Slabs[4].Key, Health: 0},
+		{Key: obj.Slabs[2].Key, Health: 0, Bucket: api.DefaultBucketName},
+		{Key: obj.Slabs[4].Key, Health: 0, Bucket: api.DefaultBucketName},
 	}
 	if !reflect.DeepEqual(slabs, expected) {
 		t.Fatal("slabs are not returned in the correct order", slabs, expected)
@@ -1861,7 +2131,7 @@ func TestUnhealthySlabsNegHealth(t *testing.T) {
 
 	// add the object
 	ctx := context.Background()
-	if err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, obj, map[types.PublicKey]types.FileContractID{hk1: fcid1}); err != nil {
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, testMetadata, obj, map[types.PublicKey]types.FileContractID{hk1: fcid1}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1925,7 +2195,7 @@ func TestUnhealthySlabsNoContracts(t *testing.T) {
 
 	// add the object
 	ctx := context.Background()
-	if err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, obj, map[types.PublicKey]types.FileContractID{hk1: fcid1}); err != nil {
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, testMetadata, obj, map[types.PublicKey]types.FileContractID{hk1: fcid1}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -2030,7 +2300,7 @@ func TestUnhealthySlabsNoRedundancy(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	if err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, obj, map[types.PublicKey]types.FileContractID{
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, testMetadata, obj, map[types.PublicKey]types.FileContractID{
 		hk1: fcid1,
 		hk2: fcid2,
 		hk3: fcid3,
@@ -2050,13 +2320,100 @@ func TestUnhealthySlabsNoRedundancy(t *testing.T) {
 	}
 
 	expected := []api.UnhealthySlab{
-		{Key: obj.Slabs[1].Slab.Key, Health: -1},
+		{Key: obj.Slabs[1].Slab.Key, Health: -1, Bucket: api.DefaultBucketName},
 	}
 	if !reflect.DeepEqual(slabs, expected) {
 		t.Fatal("slabs are not returned in the correct order")
 	}
 }
 
+// TestSlabsHealth verifies the health of slabs is computed on the fly for the
+// given contract set and that the results can be filtered and paginated.
+func TestSlabsHealth(t *testing.T) {
+	db, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add 3 hosts with a contract each, only the first two are good
+	hks, err := db.addTestHosts(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hk1, hk2, hk3 := hks[0], hks[1], hks[2]
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetContractSet(context.Background(), testContractSet, fcids[:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	// add an object with a healthy, a degraded and a lost slab
+	newSlab := func(hosts ...types.PublicKey) object.SlabSlice {
+		var shards []object.Sector
+		for _, hk := range hosts {
+			shards = append(shards, object.Sector{Host: hk, Root: types.Hash256(frand.Entropy256())})
+		}
+		return object.SlabSlice{Slab: object.Slab{
+			Key:       object.GenerateEncryptionKey(),
+			MinShards: 1,
+			Shards:    shards,
+		}}
+	}
+	obj := object.Object{
+		Key: object.GenerateEncryptionKey(),
+		Slabs: []object.SlabSlice{
+			newSlab(hk1, hk2, hk3), // health 0.5
+			newSlab(hk3, hk3),      // health -1
+			newSlab(hk1, hk2),      // health 1
+		},
+	}
+	ctx := context.Background()
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, testMetadata, obj, map[types.PublicKey]types.FileContractID{
+		hk1: fcids[0],
+		hk2: fcids[1],
+		hk3: fcids[2],
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	slabs, err := db.SlabsHealth(ctx, testContractSet, false, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []api.SlabHealth{
+		{Key: obj.Slabs[1].Key, Health: -1, GoodShards: 0, MinShards: 1, TotalShards: 2},
+		{Key: obj.Slabs[0].Key, Health: 0.5, GoodShards: 2, MinShards: 1, TotalShards: 3},
+		{Key: obj.Slabs[2].Key, Health: 1, GoodShards: 2, MinShards: 1, TotalShards: 2},
+	}
+	if !reflect.DeepEqual(slabs, expected) {
+		t.Fatalf("unexpected slabs health, %+v", slabs)
+	}
+
+	// filter out healthy slabs
+	slabs, err = db.SlabsHealth(ctx, testContractSet, true, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(slabs, expected[:2]) {
+		t.Fatalf("unexpected slabs health, %+v", slabs)
+	}
+
+	// paginate
+	slabs, err = db.SlabsHealth(ctx, testContractSet, false, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(slabs, expected[1:2]) {
+		t.Fatalf("unexpected slabs health, %+v", slabs)
+	}
+
+	// unknown contract set
+	_, err = db.SlabsHealth(ctx, "foo", false, 0, -1)
+	if !errors.Is(err, api.ErrContractSetNotFound) {
+		t.Fatal("expected ErrContractSetNotFound", err)
+	}
+}
+
 // TestContractSectors is a test for the contract_sectors join table. It
 // verifies that deleting contracts or sectors also cleans up the join table.
 func TestContractSectors(t *testing.T) {
@@ -2103,7 +2460,7 @@ func TestContractSectors(t *testing.T) {
 		},
 	}
 	ctx := context.Background()
-	if err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, obj, usedContracts); err != nil {
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, testMetadata, obj, usedContracts); err != nil {
 		t.Fatal(err)
 	}
 
@@ -2129,7 +2486,7 @@ func TestContractSectors(t *testing.T) {
 	}
 
 	// Add the object again.
-	if err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, obj, usedContracts); err != nil {
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, testMetadata, obj, usedContracts); err != nil {
 		t.Fatal(err)
 	}
 
@@ -2194,7 +2551,7 @@ func TestPutSlab(t *testing.T) {
 		},
 	}
 	ctx := context.Background()
-	if err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, obj, map[types.PublicKey]types.FileContractID{
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, testMetadata, obj, map[types.PublicKey]types.FileContractID{
 		hk1: fcid1,
 		hk2: fcid2,
 	}); err != nil {
@@ -2487,7 +2844,7 @@ func TestRenameObjects(t *testing.T) {
 	ctx := context.Background()
 	for _, path := range objects {
 		obj, ucs := newTestObject(1)
-		if err := cs.UpdateObject(ctx, api.DefaultBucketName, path, testContractSet, testETag, testMimeType, obj, ucs); err != nil {
+		if _, err := cs.UpdateObject(ctx, api.DefaultBucketName, path, testContractSet, testETag, testMimeType, testMetadata, obj, ucs); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -2500,6 +2857,18 @@ func TestRenameObjects(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	// Try renaming an object onto an existing one.
+	if err := cs.RenameObject(ctx, api.DefaultBucketName, "/foo", "/bar"); !errors.Is(err, api.ErrObjectExists) {
+		t.Fatal(err)
+	}
+
+	// Try renaming objects in another bucket.
+	if err := cs.CreateBucket(ctx, "other", api.BucketPolicy{}); err != nil {
+		t.Fatal(err)
+	} else if err := cs.RenameObjects(ctx, "other", "/fileś/dir/", "/fileś/"); !errors.Is(err, api.ErrObjectNotFound) {
+		t.Fatal(err)
+	}
+
 	// Perform some renames.
 	if err := cs.RenameObjects(ctx, api.DefaultBucketName, "/fileś/dir/", "/fileś/"); err != nil {
 		t.Fatal(err)
@@ -2540,7 +2909,7 @@ func TestRenameObjects(t *testing.T) {
 	}
 
 	// Assert that number of objects matches.
-	objs, err := cs.SearchObjects(ctx, api.DefaultBucketName, "/", 0, 100)
+	objs, err := cs.SearchObjects(ctx, api.DefaultBucketName, "/", nil, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2593,7 +2962,7 @@ func TestObjectsStats(t *testing.T) {
 		}
 
 		key := hex.EncodeToString(frand.Bytes(32))
-		err := cs.UpdateObject(context.Background(), api.DefaultBucketName, key, testContractSet, testETag, testMimeType, obj, contracts)
+		_, err := cs.UpdateObject(context.Background(), api.DefaultBucketName, key, testContractSet, testETag, testMimeType, testMetadata, obj, contracts)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -2776,7 +3145,7 @@ func TestPartialSlab(t *testing.T) {
 		}
 	}
 	obj := testObject(slabs)
-	err = db.UpdateObject(context.Background(), api.DefaultBucketName, "key", testContractSet, testETag, testMimeType, obj, usedContracts)
+	_, err = db.UpdateObject(context.Background(), api.DefaultBucketName, "key", testContractSet, testETag, testMimeType, testMetadata, obj, usedContracts)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2815,7 +3184,7 @@ func TestPartialSlab(t *testing.T) {
 
 	// Create an object again.
 	obj2 := testObject(slabs)
-	err = db.UpdateObject(context.Background(), api.DefaultBucketName, "key2", testContractSet, testETag, testMimeType, obj2, usedContracts)
+	_, err = db.UpdateObject(context.Background(), api.DefaultBucketName, "key2", testContractSet, testETag, testMimeType, testMetadata, obj2, usedContracts)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2865,7 +3234,7 @@ func TestPartialSlab(t *testing.T) {
 
 	// Create an object again.
 	obj3 := testObject(slabs)
-	err = db.UpdateObject(context.Background(), api.DefaultBucketName, "key3", testContractSet, testETag, testMimeType, obj3, usedContracts)
+	_, err = db.UpdateObject(context.Background(), api.DefaultBucketName, "key3", testContractSet, testETag, testMimeType, testMetadata, obj3, usedContracts)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2979,7 +3348,7 @@ func TestPartialSlab(t *testing.T) {
 
 	// Restart it. The buffer should still be there.
 	conn := NewEphemeralSQLiteConnection(dbName)
-	db2, _, err := NewSQLStore(conn, alerts.NewManager(), dir, false, time.Hour, types.Address{}, 0, zap.NewNop().Sugar(), newTestLogger())
+	db2, _, err := NewSQLStore(conn, alerts.NewManager(), dir, false, time.Hour, types.Address{}, nil, 0, 0, zap.NewNop().Sugar(), newTestLogger())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2993,6 +3362,94 @@ func TestPartialSlab(t *testing.T) {
 	}
 }
 
+func TestPartialSlabMaxAge(t *testing.T) {
+	db, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.slabBufferMgr.maxAge = time.Hour
+
+	// add a small partial slab
+	ctx := context.Background()
+	data := []byte{1, 2, 3}
+	slabs, _, err := db.AddPartialSlab(ctx, data, 1, 2, testContractSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the buffer isn't ready for upload yet
+	packedSlabs, err := db.PackedSlabsForUpload(ctx, time.Hour, 1, 2, testContractSet, 100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(packedSlabs) != 0 {
+		t.Fatal("expected no packed slabs", len(packedSlabs))
+	}
+
+	// expire the buffer
+	var sb *SlabBuffer
+	db.slabBufferMgr.mu.Lock()
+	for _, buffer := range db.slabBufferMgr.buffersByKey {
+		buffer.created = time.Now().Add(-2 * time.Hour)
+		sb = buffer
+	}
+	db.slabBufferMgr.mu.Unlock()
+
+	// assert the buffer doesn't expire while an append is in progress
+	if _, _, used, err := sb.recordAppend([]byte{}); err != nil || !used {
+		t.Fatal("failed to record append", used, err)
+	} else if packedSlabs, err := db.PackedSlabsForUpload(ctx, time.Hour, 1, 2, testContractSet, 100); err != nil {
+		t.Fatal(err)
+	} else if len(packedSlabs) != 0 {
+		t.Fatal("expected no packed slabs", len(packedSlabs))
+	}
+	sb.releaseAppend()
+
+	// assert the buffer isn't complete until the db was updated and data can
+	// be appended again if that failed
+	if !sb.tryExpire(time.Hour) {
+		t.Fatal("expected buffer to expire")
+	} else if _, _, used, _ := sb.recordAppend(data); used {
+		t.Fatal("data was appended to an expiring buffer")
+	} else if sb.complete {
+		t.Fatal("buffer was marked complete")
+	}
+	sb.finishExpire(false)
+	if sb.complete {
+		t.Fatal("buffer was marked complete")
+	} else if !sb.tryExpire(time.Hour) {
+		t.Fatal("expected buffer to expire")
+	}
+	sb.finishExpire(false)
+
+	// assert it's flushed
+	packedSlabs, err = db.PackedSlabsForUpload(ctx, time.Hour, 1, 2, testContractSet, 100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(packedSlabs) != 1 {
+		t.Fatal("expected 1 packed slab", len(packedSlabs))
+	} else if !bytes.Equal(packedSlabs[0].Data, data) {
+		t.Fatal("wrong data")
+	} else if packedSlabs[0].Key.String() != slabs[0].Key.String() {
+		t.Fatal("wrong key")
+	}
+
+	// assert the buffer was marked complete in the database
+	var buffer dbBufferedSlab
+	if err := db.db.Take(&buffer).Error; err != nil {
+		t.Fatal(err)
+	} else if !buffer.Complete {
+		t.Fatal("expected buffer to be complete")
+	}
+
+	// assert new data is added to a new buffer
+	slabs2, _, err := db.AddPartialSlab(ctx, data, 1, 2, testContractSet)
+	if err != nil {
+		t.Fatal(err)
+	} else if slabs2[0].Key.String() == slabs[0].Key.String() || slabs2[0].Offset != 0 {
+		t.Fatal("expected data to be added to a new buffer")
+	}
+}
+
 func TestContractSizes(t *testing.T) {
 	db, _, _, err := newTestSQLStore(t.TempDir())
 	if err != nil {
@@ -3032,7 +3489,7 @@ func TestContractSizes(t *testing.T) {
 
 	// add an object to both contracts
 	for i := 0; i < 2; i++ {
-		if err := db.UpdateObject(context.Background(), api.DefaultBucketName, fmt.Sprintf("obj_%d", i+1), testContractSet, testETag, testMimeType, object.Object{
+		if _, err := db.UpdateObject(context.Background(), api.DefaultBucketName, fmt.Sprintf("obj_%d", i+1), testContractSet, testETag, testMimeType, testMetadata, object.Object{
 			Key: object.GenerateEncryptionKey(),
 			Slabs: []object.SlabSlice{
 				{
@@ -3081,6 +3538,8 @@ func TestContractSizes(t *testing.T) {
 	// remove the first object
 	if err := db.RemoveObject(context.Background(), api.DefaultBucketName, "obj_1"); err != nil {
 		t.Fatal(err)
+	} else if _, err := db.PruneSlabs(context.Background(), -1); err != nil {
+		t.Fatal(err)
 	}
 
 	// assert there's one sector that can be pruned and assert it's from fcid 1
@@ -3094,6 +3553,8 @@ func TestContractSizes(t *testing.T) {
 	// remove the second object
 	if err := db.RemoveObject(context.Background(), api.DefaultBucketName, "obj_2"); err != nil {
 		t.Fatal(err)
+	} else if _, err := db.PruneSlabs(context.Background(), -1); err != nil {
+		t.Fatal(err)
 	}
 
 	// assert there's now two sectors that can be pruned
@@ -3207,7 +3668,7 @@ func TestObjectsBySlabKey(t *testing.T) {
 	}
 	for _, name := range []string{"obj1", "obj2", "obj3"} {
 		obj.Slabs[0].Length++
-		err = db.UpdateObject(context.Background(), api.DefaultBucketName, name, testContractSet, testETag, testMimeType, obj, usedContracts)
+		_, err = db.UpdateObject(context.Background(), api.DefaultBucketName, name, testContractSet, testETag, testMimeType, testMetadata, obj, usedContracts)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -3273,6 +3734,60 @@ func TestBuckets(t *testing.T) {
 	} else if err := db.DeleteBucket(context.Background(), "foo"); !errors.Is(err, api.ErrBucketNotFound) {
 		t.Fatal("expected ErrBucketNotFound", err)
 	}
+
+	// Update the policy of a bucket with redundancy and gouging overrides.
+	maxStoragePrice := types.Siacoins(1)
+	policy := api.BucketPolicy{
+		RedundancySettings: &api.RedundancySettings{MinShards: 10, TotalShards: 40},
+		GougingOverrides:   &api.GougingOverrides{MaxStoragePrice: &maxStoragePrice},
+	}
+	if err := db.UpdateBucketPolicy(context.Background(), b1, policy); err != nil {
+		t.Fatal(err)
+	} else if bucket, err := db.Bucket(context.Background(), b1); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(bucket.Policy, policy) {
+		t.Fatal("unexpected policy", bucket.Policy)
+	}
+
+	// Assert the overrides are applied to the gouging params.
+	gp := policy.Apply(api.GougingParams{
+		GougingSettings:    api.GougingSettings{MaxStoragePrice: types.Siacoins(2), MaxUploadPrice: types.Siacoins(3)},
+		RedundancySettings: api.RedundancySettings{MinShards: 10, TotalShards: 30},
+	})
+	if gp.RedundancySettings.TotalShards != 40 {
+		t.Fatal("redundancy settings weren't overridden", gp.RedundancySettings)
+	} else if !gp.GougingSettings.MaxStoragePrice.Equals(maxStoragePrice) {
+		t.Fatal("storage price wasn't overridden", gp.GougingSettings.MaxStoragePrice)
+	} else if !gp.GougingSettings.MaxUploadPrice.Equals(types.Siacoins(3)) {
+		t.Fatal("upload price was overridden", gp.GougingSettings.MaxUploadPrice)
+	}
+}
+
+func TestObjectOverwritten(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// assert adding an object only overwrites an existing object
+	for _, expected := range []bool{false, true} {
+		obj, ucs := newTestObject(1)
+		if overwritten, err := ss.UpdateObject(ctx, api.DefaultBucketName, "/foo", testContractSet, testETag, testMimeType, testMetadata, obj, ucs); err != nil {
+			t.Fatal(err)
+		} else if overwritten != expected {
+			t.Fatalf("expected overwritten to be %v", expected)
+		}
+	}
+
+	// assert the same holds for copies
+	for _, expected := range []bool{false, true} {
+		if _, overwritten, err := ss.CopyObject(ctx, api.DefaultBucketName, api.DefaultBucketName, "/foo", "/bar", ""); err != nil {
+			t.Fatal(err)
+		} else if overwritten != expected {
+			t.Fatalf("expected overwritten to be %v", expected)
+		}
+	}
 }
 
 func TestBucketObjects(t *testing.T) {
@@ -3283,7 +3798,7 @@ func TestBucketObjects(t *testing.T) {
 
 	// Adding an object to a bucket that doesn't exist shouldn't work.
 	obj, ucs := newTestObject(1)
-	err = os.UpdateObject(context.Background(), "unknown-bucket", "foo", testContractSet, testETag, testMimeType, obj, ucs)
+	_, err = os.UpdateObject(context.Background(), "unknown-bucket", "foo", testContractSet, testETag, testMimeType, testMetadata, obj, ucs)
 	if !errors.Is(err, api.ErrBucketNotFound) {
 		t.Fatal("expected ErrBucketNotFound", err)
 	}
@@ -3314,9 +3829,11 @@ func TestBucketObjects(t *testing.T) {
 		obj, ucs := newTestObject(frand.Intn(9) + 1)
 		obj.Slabs = obj.Slabs[:1]
 		obj.Slabs[0].Length = uint32(o.size)
-		err := os.UpdateObject(ctx, o.bucket, o.path, testContractSet, testETag, testMimeType, obj, ucs)
+		overwritten, err := os.UpdateObject(ctx, o.bucket, o.path, testContractSet, testETag, testMimeType, testMetadata, obj, ucs)
 		if err != nil {
 			t.Fatal(err)
+		} else if overwritten {
+			t.Fatal("object shouldn't be overwritten")
 		}
 	}
 
@@ -3325,7 +3842,20 @@ func TestBucketObjects(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// List the objects in the buckets.
+	// Fetch the stats of the buckets.
+	if stats, err := os.BucketStats(ctx, b1); err != nil {
+		t.Fatal(err)
+	} else if stats.NumObjects != 2 || stats.TotalObjectsSize != 4 {
+		t.Fatal("unexpected stats", stats)
+	} else if stats, err := os.BucketStats(ctx, b2); err != nil {
+		t.Fatal(err)
+	} else if stats.NumObjects != 2 || stats.TotalObjectsSize != 6 {
+		t.Fatal("unexpected stats", stats)
+	} else if _, err := os.BucketStats(ctx, "unknown-bucket"); !errors.Is(err, api.ErrBucketNotFound) {
+		t.Fatal("expected ErrBucketNotFound", err)
+	}
+
+	// List the objects in the buckets.
 	if entries, _, err := os.ObjectEntries(context.Background(), b1, "/foo/", "", "", 0, -1); err != nil {
 		t.Fatal(err)
 	} else if len(entries) != 1 {
@@ -3341,13 +3871,13 @@ func TestBucketObjects(t *testing.T) {
 	}
 
 	// Search the objects in the buckets.
-	if objects, err := os.SearchObjects(context.Background(), b1, "", 0, -1); err != nil {
+	if objects, err := os.SearchObjects(context.Background(), b1, "", nil, 0, -1); err != nil {
 		t.Fatal(err)
 	} else if len(objects) != 2 {
 		t.Fatal("expected 2 objects", len(objects))
 	} else if objects[0].Size != 3 || objects[1].Size != 1 {
 		t.Fatal("unexpected size", objects[0].Size, objects[1].Size)
-	} else if objects, err := os.SearchObjects(context.Background(), b2, "", 0, -1); err != nil {
+	} else if objects, err := os.SearchObjects(context.Background(), b2, "", nil, 0, -1); err != nil {
 		t.Fatal(err)
 	} else if len(objects) != 2 {
 		t.Fatal("expected 2 objects", len(objects))
@@ -3409,7 +3939,7 @@ func TestBucketObjects(t *testing.T) {
 		t.Fatal(err)
 	} else if len(entries) != 2 {
 		t.Fatal("expected 2 entries", len(entries))
-	} else if err := os.RemoveObjects(context.Background(), b2, "/"); err != nil {
+	} else if err := os.RemoveObjects(context.Background(), b2, "/", nil); err != nil {
 		t.Fatal(err)
 	} else if entries, _, err := os.ObjectEntries(context.Background(), b2, "/", "", "", 0, -1); err != nil {
 		t.Fatal(err)
@@ -3463,13 +3993,13 @@ func TestCopyObject(t *testing.T) {
 
 	// Create one object.
 	obj, ucs := newTestObject(1)
-	err = os.UpdateObject(ctx, "src", "/foo", testContractSet, testETag, testMimeType, obj, ucs)
+	_, err = os.UpdateObject(ctx, "src", "/foo", testContractSet, testETag, testMimeType, testMetadata, obj, ucs)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// Copy it within the same bucket.
-	if om, err := os.CopyObject(ctx, "src", "src", "/foo", "/bar", ""); err != nil {
+	if om, _, err := os.CopyObject(ctx, "src", "src", "/foo", "/bar", ""); err != nil {
 		t.Fatal(err)
 	} else if entries, _, err := os.ObjectEntries(ctx, "src", "/", "", "", 0, -1); err != nil {
 		t.Fatal(err)
@@ -3481,8 +4011,13 @@ func TestCopyObject(t *testing.T) {
 		t.Fatal("expected mod time to be set")
 	}
 
+	// Try copying an object that doesn't exist.
+	if _, _, err := os.CopyObject(ctx, "src", "dst", "/baz", "/bar", ""); !errors.Is(err, api.ErrObjectNotFound) {
+		t.Fatal("expected ErrObjectNotFound", err)
+	}
+
 	// Copy it cross buckets.
-	if om, err := os.CopyObject(ctx, "src", "dst", "/foo", "/bar", ""); err != nil {
+	if om, _, err := os.CopyObject(ctx, "src", "dst", "/foo", "/bar", ""); err != nil {
 		t.Fatal(err)
 	} else if entries, _, err := os.ObjectEntries(ctx, "dst", "/", "", "", 0, -1); err != nil {
 		t.Fatal(err)
@@ -3495,6 +4030,116 @@ func TestCopyObject(t *testing.T) {
 	}
 }
 
+func TestBucketLimits(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create a bucket with limits and one without
+	ctx := context.Background()
+	if err := ss.CreateBucket(ctx, "limited", api.BucketPolicy{MaxObjectSize: 60, MaxStoredBytes: 100}); err != nil {
+		t.Fatal(err)
+	} else if err := ss.CreateBucket(ctx, "unlimited", api.BucketPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// helper to add an object of the given size
+	addObject := func(bucket, path string, size uint32) error {
+		obj, ucs := newTestObject(1)
+		obj.Slabs[0].Offset, obj.Slabs[0].Length = 0, size
+		_, err := ss.UpdateObject(ctx, bucket, path, testContractSet, testETag, testMimeType, testMetadata, obj, ucs)
+		return err
+	}
+
+	// helper to assert the cached usage matches the usage in the database
+	var limited dbBucket
+	if err := ss.db.Where("name = ?", "limited").Take(&limited).Error; err != nil {
+		t.Fatal(err)
+	}
+	assertUsage := func(want int64) {
+		t.Helper()
+		if stats, err := ss.BucketStats(ctx, "limited"); err != nil {
+			t.Fatal(err)
+		} else if stats.TotalObjectsSize != uint64(want) {
+			t.Fatalf("unexpected usage %v != %v", stats.TotalObjectsSize, want)
+		} else if usage, err := ss.bucketStoredBytes(ss.db, limited); err != nil {
+			t.Fatal(err)
+		} else if usage != want {
+			t.Fatalf("unexpected cached usage %v != %v", usage, want)
+		}
+	}
+
+	// assert objects that exceed the max object size are rejected
+	if err := addObject("limited", "/a", 61); !errors.Is(err, api.ErrObjectTooLarge) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert objects that exceed the quota are rejected
+	if err := addObject("limited", "/a", 50); err != nil {
+		t.Fatal(err)
+	} else if err := addObject("limited", "/b", 51); !errors.Is(err, api.ErrBucketQuotaExceeded) {
+		t.Fatal("unexpected error", err)
+	}
+	assertUsage(50)
+
+	// assert the size of an object that is overwritten isn't counted
+	if err := addObject("limited", "/a", 60); err != nil {
+		t.Fatal(err)
+	} else if err := addObject("limited", "/b", 40); err != nil {
+		t.Fatal(err)
+	}
+	assertUsage(100)
+
+	// assert copies are subject to the quota
+	if _, _, err := ss.CopyObject(ctx, "limited", "limited", "/b", "/c", ""); !errors.Is(err, api.ErrBucketQuotaExceeded) {
+		t.Fatal("unexpected error", err)
+	} else if _, _, err := ss.CopyObject(ctx, "limited", "unlimited", "/b", "/c", ""); err != nil {
+		t.Fatal(err)
+	} else if _, _, err := ss.CopyObject(ctx, "limited", "limited", "/b", "/a", ""); err != nil {
+		t.Fatal(err)
+	}
+	assertUsage(80)
+
+	// assert deleting an object frees up space
+	if err := ss.RemoveObject(ctx, "limited", "/a"); err != nil {
+		t.Fatal(err)
+	}
+	assertUsage(40)
+	if err := addObject("limited", "/a", 10); err != nil {
+		t.Fatal(err)
+	}
+	assertUsage(50)
+
+	// assert completing a multipart upload is subject to the quota
+	addUpload := func(path string, size uint32) (string, []api.MultipartCompletedPart) {
+		t.Helper()
+		resp, err := ss.CreateMultipartUpload(ctx, "limited", path, object.NoOpKey, testMimeType, testMetadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj, ucs := newTestObject(1)
+		obj.Slabs[0].Offset, obj.Slabs[0].Length = 0, size
+		if err := ss.AddMultipartPart(ctx, "limited", path, testContractSet, testETag, resp.UploadID, 1, obj.Slabs, nil, ucs); err != nil {
+			t.Fatal(err)
+		}
+		return resp.UploadID, []api.MultipartCompletedPart{{PartNumber: 1, ETag: testETag}}
+	}
+	id, parts := addUpload("/c", 61)
+	if _, _, err := ss.CompleteMultipartUpload(ctx, "limited", "/c", id, parts); !errors.Is(err, api.ErrObjectTooLarge) {
+		t.Fatal("unexpected error", err)
+	}
+	id, parts = addUpload("/c", 60)
+	if _, _, err := ss.CompleteMultipartUpload(ctx, "limited", "/c", id, parts); !errors.Is(err, api.ErrBucketQuotaExceeded) {
+		t.Fatal("unexpected error", err)
+	}
+	id, parts = addUpload("/b", 60)
+	if _, _, err := ss.CompleteMultipartUpload(ctx, "limited", "/b", id, parts); err != nil {
+		t.Fatal(err)
+	}
+	assertUsage(70)
+}
+
 func TestMarkSlabUploadedAfterRenew(t *testing.T) {
 	dir := t.TempDir()
 	db, _, _, err := newTestSQLStore(dir)
@@ -3577,6 +4222,65 @@ func TestMarkSlabUploadedAfterRenew(t *testing.T) {
 	}
 }
 
+func TestMarkSlabUploadedAfterRenewals(t *testing.T) {
+	db, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create host and contract
+	hks, err := db.addTestHosts(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hk := hks[0]
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid := fcids[0]
+
+	// create a full buffered slab and fetch it for upload
+	_, _, err = db.AddPartialSlab(context.Background(), frand.Bytes(bufferedSlabSize(1)), 1, 1, testContractSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packedSlabs, err := db.PackedSlabsForUpload(context.Background(), time.Hour, 1, 1, testContractSet, 100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(packedSlabs) != 1 {
+		t.Fatal("expected 1 slab to be returned", len(packedSlabs))
+	}
+
+	// renew the contract twice
+	fcidRenewed1 := types.FileContractID{2, 2, 2, 2, 2}
+	fcidRenewed2 := types.FileContractID{3, 3, 3, 3, 3}
+	if _, err := db.addTestRenewedContract(fcidRenewed1, fcid, hk, 100); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.addTestRenewedContract(fcidRenewed2, fcidRenewed1, hk, 200); err != nil {
+		t.Fatal(err)
+	}
+
+	// mark it as uploaded using the original contract
+	err = db.MarkPackedSlabsUploaded(context.Background(), []api.UploadedPackedSlab{
+		{
+			BufferID: packedSlabs[0].BufferID,
+			Shards:   []object.Sector{{Host: hk, Root: types.Hash256{1}}},
+		},
+	}, map[types.PublicKey]types.FileContractID{hk: fcid})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the sector was linked to the latest contract
+	roots, err := db.ContractRoots(context.Background(), fcidRenewed2)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 1 || roots[0] != (types.Hash256{1}) {
+		t.Fatal("unexpected roots", roots)
+	}
+}
+
 func TestListObjects(t *testing.T) {
 	os, _, _, err := newTestSQLStore(t.TempDir())
 	if err != nil {
@@ -3595,12 +4299,18 @@ func TestListObjects(t *testing.T) {
 	}
 
 	// assert mod time & clear it afterwards so we can compare
-	assertModTime := func(entries []api.ObjectMetadata) {
+	assertMetadata := func(entries []api.ObjectMetadata) {
 		for i := range entries {
 			if !strings.HasSuffix(entries[i].Name, "/") && entries[i].ModTime.IsZero() {
 				t.Fatal("mod time should be set")
+			} else if entries[i].MimeType != testMimeType {
+				t.Fatal("unexpected mime type", entries[i].MimeType)
+			} else if entries[i].ETag != testETag {
+				t.Fatal("unexpected etag", entries[i].ETag)
 			}
 			entries[i].ModTime = time.Time{}
+			entries[i].MimeType = ""
+			entries[i].ETag = ""
 		}
 	}
 
@@ -3609,7 +4319,7 @@ func TestListObjects(t *testing.T) {
 		obj, ucs := newTestObject(frand.Intn(9) + 1)
 		obj.Slabs = obj.Slabs[:1]
 		obj.Slabs[0].Length = uint32(o.size)
-		if err := os.UpdateObject(ctx, api.DefaultBucketName, o.path, testContractSet, testETag, testMimeType, obj, ucs); err != nil {
+		if _, err := os.UpdateObject(ctx, api.DefaultBucketName, o.path, testContractSet, testETag, testMimeType, testMetadata, obj, ucs); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -3624,13 +4334,13 @@ func TestListObjects(t *testing.T) {
 		{"/foo", "", []api.ObjectMetadata{{Name: "/foo/bar", Size: 1, Health: 1}, {Name: "/foo/bat", Size: 2, Health: 1}, {Name: "/foo/baz/quux", Size: 3, Health: 1}, {Name: "/foo/baz/quuz", Size: 4, Health: 1}}},
 	}
 	for _, test := range tests {
-		res, err := os.ListObjects(ctx, api.DefaultBucketName, test.prefix, "", -1)
+		res, err := os.ListObjects(ctx, api.DefaultBucketName, test.prefix, "", "", "", "", -1)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		// assert mod time & clear it afterwards so we can compare
-		assertModTime(res.Objects)
+		// assert metadata & clear it afterwards so we can compare
+		assertMetadata(res.Objects)
 
 		got := res.Objects
 		if !(len(got) == 0 && len(test.want) == 0) && !reflect.DeepEqual(got, test.want) {
@@ -3639,13 +4349,13 @@ func TestListObjects(t *testing.T) {
 		if len(res.Objects) > 0 {
 			marker := ""
 			for offset := 0; offset < len(test.want); offset++ {
-				res, err := os.ListObjects(ctx, api.DefaultBucketName, test.prefix, marker, 1)
+				res, err := os.ListObjects(ctx, api.DefaultBucketName, test.prefix, "", "", "", marker, 1)
 				if err != nil {
 					t.Fatal(err)
 				}
 
-				// assert mod time & clear it afterwards so we can compare
-				assertModTime(res.Objects)
+				// assert metadata & clear it afterwards so we can compare
+				assertMetadata(res.Objects)
 
 				got := res.Objects
 				if len(got) != 1 {
@@ -3657,6 +4367,106 @@ func TestListObjects(t *testing.T) {
 			}
 		}
 	}
+
+	// assert objects can be sorted and paginated by size and mod time
+	sorted := []struct {
+		sortBy  string
+		sortDir string
+		want    []string
+	}{
+		{api.ObjectSortBySize, api.ObjectSortDirAsc, []string{"/foo/bar", "/foo/bat", "/foo/baz/quux", "/foo/baz/quuz", "/gab/guub", "/FOO/bar"}},
+		{api.ObjectSortBySize, api.ObjectSortDirDesc, []string{"/FOO/bar", "/gab/guub", "/foo/baz/quuz", "/foo/baz/quux", "/foo/bat", "/foo/bar"}},
+		{api.ObjectSortByModTime, api.ObjectSortDirAsc, []string{"/foo/bar", "/foo/bat", "/foo/baz/quux", "/foo/baz/quuz", "/gab/guub", "/FOO/bar"}},
+		{api.ObjectSortByName, api.ObjectSortDirDesc, []string{"/gab/guub", "/foo/baz/quuz", "/foo/baz/quux", "/foo/bat", "/foo/bar", "/FOO/bar"}},
+	}
+	for _, test := range sorted {
+		var got []string
+		var marker string
+		for {
+			res, err := os.ListObjects(ctx, api.DefaultBucketName, "/", "", test.sortBy, test.sortDir, marker, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, o := range res.Objects {
+				got = append(got, o.Name)
+			}
+			if !res.HasMore {
+				break
+			}
+			marker = res.NextMarker
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v %v: got %v, want %v", test.sortBy, test.sortDir, got, test.want)
+		}
+	}
+
+	// assert objects are rolled up into common prefixes if a delimiter is
+	// given and common prefixes can be used as markers
+	delimited := []struct {
+		prefix    string
+		delimiter string
+		want      []string
+	}{
+		{"/", "/", []string{"/FOO/", "/foo/", "/gab/"}},
+		{"/foo/", "/", []string{"/foo/bar", "/foo/bat", "/foo/baz/"}},
+		{"/foo/ba", "/", []string{"/foo/bar", "/foo/bat", "/foo/baz/"}},
+		{"/foo/", "ba", []string{"/foo/ba"}},
+		{"/foo/baz/", "/", []string{"/foo/baz/quux", "/foo/baz/quuz"}},
+		{"/gab", "/", []string{"/gab/"}},
+		{"/", "quu", []string{"/FOO/bar", "/foo/bar", "/foo/bat", "/foo/baz/quu", "/gab/guub"}},
+	}
+	for _, test := range delimited {
+		for _, limit := range []int{-1, 1, 2} {
+			var got []string
+			var marker string
+			for {
+				res, err := os.ListObjects(ctx, api.DefaultBucketName, test.prefix, test.delimiter, "", "", marker, limit)
+				if err != nil {
+					t.Fatal(err)
+				} else if limit > 0 && len(res.Objects)+len(res.CommonPrefixes) > limit {
+					t.Fatalf("expected at most %d entries, got %d", limit, len(res.Objects)+len(res.CommonPrefixes))
+				}
+				for _, o := range res.Objects {
+					got = append(got, o.Name)
+				}
+				got = append(got, res.CommonPrefixes...)
+				if !res.HasMore {
+					break
+				}
+				marker = res.NextMarker
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("prefix %q delimiter %q limit %d: got %v, want %v", test.prefix, test.delimiter, limit, got, test.want)
+			}
+		}
+	}
+
+	// assert the listing continues if the object the marker points to is
+	// deleted in between pages
+	res, err := os.ListObjects(ctx, api.DefaultBucketName, "/", "", api.ObjectSortBySize, api.ObjectSortDirAsc, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := os.RemoveObject(ctx, api.DefaultBucketName, res.Objects[1].Name); err != nil {
+		t.Fatal(err)
+	}
+	res, err = os.ListObjects(ctx, api.DefaultBucketName, "/", "", api.ObjectSortBySize, api.ObjectSortDirAsc, res.NextMarker, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(res.Objects) != 2 || res.Objects[0].Name != "/foo/baz/quux" || res.Objects[1].Name != "/foo/baz/quuz" {
+		t.Fatal("unexpected objects", res.Objects)
+	}
+
+	// assert invalid sort parameters and markers are rejected
+	if _, err := os.ListObjects(ctx, api.DefaultBucketName, "/", "/", api.ObjectSortBySize, "", "", -1); !errors.Is(err, api.ErrInvalidObjectSortParameters) {
+		t.Fatal("unexpected error", err)
+	} else if _, err := os.ListObjects(ctx, api.DefaultBucketName, "/", "", "health", "", "", -1); !errors.Is(err, api.ErrInvalidObjectSortParameters) {
+		t.Fatal("unexpected error", err)
+	} else if _, err := os.ListObjects(ctx, api.DefaultBucketName, "/", "", "", "up", "", -1); !errors.Is(err, api.ErrInvalidObjectSortParameters) {
+		t.Fatal("unexpected error", err)
+	} else if _, err := os.ListObjects(ctx, api.DefaultBucketName, "/", "", api.ObjectSortBySize, "", "/unknown", -1); !errors.Is(err, api.ErrInvalidMarker) {
+		t.Fatal("unexpected error", err)
+	}
 }
 
 func TestDeleteHostSector(t *testing.T) {
@@ -3738,3 +4548,381 @@ func TestDeleteHostSector(t *testing.T) {
 		t.Fatal("expected hk2 to be latest host", types.PublicKey(s.Shards[0].LatestHost))
 	}
 }
+
+func TestSlabHealthHistogram(t *testing.T) {
+	db, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add a host and a contract
+	hks, err := db.addTestHosts(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetContractSet(context.Background(), testContractSet, fcids); err != nil {
+		t.Fatal(err)
+	}
+
+	// add an object with 6 slabs
+	obj := object.Object{Key: object.GenerateEncryptionKey()}
+	for i := 0; i < 6; i++ {
+		obj.Slabs = append(obj.Slabs, object.SlabSlice{
+			Slab: object.Slab{
+				Key:       object.GenerateEncryptionKey(),
+				MinShards: 1,
+				Shards:    []object.Sector{{Host: hks[0], Root: types.Hash256{byte(i + 1)}}},
+			},
+		})
+	}
+	ctx := context.Background()
+	if _, err := db.UpdateObject(ctx, api.DefaultBucketName, "foo", testContractSet, testETag, testMimeType, testMetadata, obj, map[types.PublicKey]types.FileContractID{hks[0]: fcids[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// overwrite the cached health of the slabs
+	for i, health := range []float64{-0.5, 0, 0.3, 0.5, 0.99, 1} {
+		if err := db.db.Exec("UPDATE slabs SET health = ? WHERE id = ?", health, i+1).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert the histogram
+	expected := api.SlabHealthHistogram{
+		Unrecoverable: 1,
+		Critical:      1,
+		Low:           1,
+		Degraded:      2,
+		Healthy:       1,
+	}
+	if histogram, err := db.SlabHealthHistogram(ctx, ""); err != nil {
+		t.Fatal(err)
+	} else if histogram != expected {
+		t.Fatalf("unexpected histogram, %+v != %+v", histogram, expected)
+	}
+	if histogram, err := db.SlabHealthHistogram(ctx, testContractSet); err != nil {
+		t.Fatal(err)
+	} else if histogram != expected {
+		t.Fatalf("unexpected histogram, %+v != %+v", histogram, expected)
+	}
+
+	// assert the histogram is empty for an unknown set
+	if histogram, err := db.SlabHealthHistogram(ctx, "unknown"); err != nil {
+		t.Fatal(err)
+	} else if histogram.Total() != 0 {
+		t.Fatalf("unexpected histogram, %+v", histogram)
+	}
+}
+
+func TestRemoveObjectsProgress(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// remove objects in batches of 2
+	defer func(size int) { removeObjectsBatchSize = size }(removeObjectsBatchSize)
+	removeObjectsBatchSize = 2
+
+	// create a few objects
+	ctx := context.Background()
+	for _, path := range []string{"/dir/1", "/dir/2", "/dir/3", "/dir/sub/4", "/dir/sub/5", "/other"} {
+		obj, ucs := newTestObject(1)
+		if _, err := ss.UpdateObject(ctx, api.DefaultBucketName, path, testContractSet, testETag, testMimeType, testMetadata, obj, ucs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// remove the directory and assert progress is reported after every batch
+	var progress [][2]int64
+	if err := ss.RemoveObjects(ctx, api.DefaultBucketName, "/dir/", func(d, t int64) {
+		progress = append(progress, [2]int64{d, t})
+	}); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(progress, [][2]int64{{2, 5}, {4, 5}, {5, 5}}) {
+		t.Fatal("unexpected progress", progress)
+	}
+
+	// assert only the object outside of the directory remains
+	if entries, _, err := ss.ObjectEntries(ctx, api.DefaultBucketName, "/", "", "", 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || entries[0].Name != "/other" {
+		t.Fatal("unexpected entries", entries)
+	}
+
+	// assert removing the directory again fails
+	if err := ss.RemoveObjects(ctx, api.DefaultBucketName, "/dir/", nil); !errors.Is(err, api.ErrObjectNotFound) {
+		t.Fatal("expected ErrObjectNotFound", err)
+	}
+}
+
+func TestScratchObjects(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create a scratch bucket
+	ctx := context.Background()
+	if err := ss.CreateBucket(ctx, "scratch", api.BucketPolicy{ObjectTTL: api.DurationMS(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// upload a few objects to it
+	for _, path := range []string{"/a", "/b", "/c"} {
+		obj, ucs := newTestObject(1)
+		if _, err := ss.UpdateObject(ctx, "scratch", path, testContractSet, testETag, testMimeType, testMetadata, obj, ucs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ss.CreateMultipartUpload(ctx, "scratch", "/d", object.GenerateEncryptionKey(), testMimeType, testMetadata); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the objects expire
+	if obj, err := ss.Object(ctx, "scratch", "/a"); err != nil {
+		t.Fatal(err)
+	} else if obj.ExpiresAt == nil || time.Until(*obj.ExpiresAt) > time.Hour {
+		t.Fatal("unexpected expiry", obj.ExpiresAt)
+	}
+
+	// promote one object in place and move another one to the default bucket
+	if err := ss.PromoteObject(ctx, "scratch", "/a", "", ""); err != nil {
+		t.Fatal(err)
+	} else if err := ss.PromoteObject(ctx, "scratch", "/b", api.DefaultBucketName, "/permanent"); err != nil {
+		t.Fatal(err)
+	} else if err := ss.PromoteObject(ctx, "scratch", "/b", "", ""); !errors.Is(err, api.ErrObjectNotFound) {
+		t.Fatal("expected ErrObjectNotFound", err)
+	}
+	if obj, err := ss.Object(ctx, "scratch", "/a"); err != nil {
+		t.Fatal(err)
+	} else if obj.ExpiresAt != nil {
+		t.Fatal("expected promoted object to not expire")
+	}
+	if obj, err := ss.Object(ctx, api.DefaultBucketName, "/permanent"); err != nil {
+		t.Fatal(err)
+	} else if obj.ExpiresAt != nil {
+		t.Fatal("expected promoted object to not expire")
+	}
+
+	// assert nothing is pruned before the TTL passed
+	if objects, uploads, err := ss.PruneExpiredObjects(ctx, time.Now(), nil); err != nil {
+		t.Fatal(err)
+	} else if objects != 0 || uploads != 0 {
+		t.Fatal("unexpected number of pruned objects", objects, uploads)
+	}
+
+	// expire the remaining object and assert it's no longer listed
+	if err := ss.db.Model(&dbObject{}).Where("object_id", "/c").Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := ss.ListObjects(ctx, "scratch", "", "", "", "", "", -1); err != nil {
+		t.Fatal(err)
+	} else if len(resp.Objects) != 1 || resp.Objects[0].Name != "/a" {
+		t.Fatal("unexpected objects", resp.Objects)
+	}
+	if entries, _, err := ss.ObjectEntries(ctx, "scratch", "/", "", "", 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || entries[0].Name != "/a" {
+		t.Fatal("unexpected entries", entries)
+	}
+	if objects, err := ss.SearchObjects(ctx, "scratch", "/", nil, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(objects) != 1 || objects[0].Name != "/a" {
+		t.Fatal("unexpected objects", objects)
+	}
+
+	// assert the remaining object and the multipart upload are pruned after
+	// the TTL passed and the deleted object is reported
+	var deleted []string
+	if objects, uploads, err := ss.PruneExpiredObjects(ctx, time.Now().Add(2*time.Hour), func(bucket, path string) {
+		deleted = append(deleted, bucket+path)
+	}); err != nil {
+		t.Fatal(err)
+	} else if objects != 1 || uploads != 1 {
+		t.Fatal("unexpected number of pruned objects", objects, uploads)
+	} else if len(deleted) != 1 || deleted[0] != "scratch/c" {
+		t.Fatal("unexpected deleted objects", deleted)
+	}
+	if _, err := ss.Object(ctx, "scratch", "/c"); !errors.Is(err, api.ErrObjectNotFound) {
+		t.Fatal("expected ErrObjectNotFound", err)
+	} else if _, err := ss.Object(ctx, "scratch", "/a"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestObjectUserMetadata(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add an object with metadata and one without
+	ctx := context.Background()
+	obj, ucs := newTestObject(1)
+	if _, err := ss.UpdateObject(ctx, api.DefaultBucketName, "/foo", testContractSet, testETag, testMimeType, testMetadata, obj, ucs); err != nil {
+		t.Fatal(err)
+	}
+	obj, ucs = newTestObject(1)
+	if _, err := ss.UpdateObject(ctx, api.DefaultBucketName, "/bar", testContractSet, testETag, testMimeType, nil, obj, ucs); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the metadata is returned
+	if obj, err := ss.Object(ctx, api.DefaultBucketName, "/foo"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(obj.Metadata, testMetadata) {
+		t.Fatal("unexpected metadata", obj.Metadata)
+	}
+	if obj, err := ss.Object(ctx, api.DefaultBucketName, "/bar"); err != nil {
+		t.Fatal(err)
+	} else if len(obj.Metadata) != 0 {
+		t.Fatal("unexpected metadata", obj.Metadata)
+	}
+
+	// assert the metadata is copied
+	if _, _, err := ss.CopyObject(ctx, api.DefaultBucketName, api.DefaultBucketName, "/foo", "/baz", ""); err != nil {
+		t.Fatal(err)
+	} else if obj, err := ss.Object(ctx, api.DefaultBucketName, "/baz"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(obj.Metadata, testMetadata) {
+		t.Fatal("unexpected metadata", obj.Metadata)
+	}
+
+	// assert we can filter on metadata
+	if objs, err := ss.SearchObjects(ctx, api.DefaultBucketName, "", api.ObjectUserMetadata{"foo": "bar"}, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(objs) != 2 || objs[0].Name != "/baz" || objs[1].Name != "/foo" {
+		t.Fatal("unexpected objects", objs)
+	}
+	if objs, err := ss.SearchObjects(ctx, api.DefaultBucketName, "", api.ObjectUserMetadata{"foo": "bar", "baz": "foo"}, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(objs) != 0 {
+		t.Fatal("unexpected objects", objs)
+	}
+
+	// assert the metadata is removed with the object
+	if err := ss.RemoveObject(ctx, api.DefaultBucketName, "/foo"); err != nil {
+		t.Fatal(err)
+	} else if err := ss.RemoveObject(ctx, api.DefaultBucketName, "/baz"); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	if err := ss.db.Model(&dbObjectUserMetadata{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal("expected metadata to be removed", n)
+	}
+}
+
+func TestSampleObjects(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create a scratch bucket
+	ctx := context.Background()
+	if err := ss.CreateBucket(ctx, "scratch", api.BucketPolicy{ObjectTTL: api.DurationMS(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// add objects to both buckets and an empty object
+	for _, path := range []string{"/a", "/b", "/c"} {
+		obj, ucs := newTestObject(1)
+		if _, err := ss.UpdateObject(ctx, api.DefaultBucketName, path, testContractSet, testETag, testMimeType, nil, obj, ucs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	obj, ucs := newTestObject(1)
+	if _, err := ss.UpdateObject(ctx, "scratch", "/d", testContractSet, testETag, testMimeType, nil, obj, ucs); err != nil {
+		t.Fatal(err)
+	} else if _, err := ss.UpdateObject(ctx, api.DefaultBucketName, "/empty", testContractSet, testETag, testMimeType, nil, object.NewObject(object.GenerateEncryptionKey()), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// sample all objects
+	objects, err := ss.SampleObjects(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(objects) != 4 {
+		t.Fatal("unexpected number of objects", len(objects))
+	}
+	sampled := make(map[string]api.ObjectSample)
+	for _, o := range objects {
+		sampled[o.Bucket+o.Name] = o
+	}
+	if o, ok := sampled["scratch/d"]; !ok {
+		t.Fatal("expected object in scratch bucket to be sampled")
+	} else if o.Size == 0 || o.ETag != testETag || o.MimeType != testMimeType {
+		t.Fatal("unexpected object", o)
+	} else if _, ok := sampled[api.DefaultBucketName+"/empty"]; ok {
+		t.Fatal("empty object shouldn't be sampled")
+	}
+
+	// assert the limit is respected and objects are sampled at most once
+	if objects, err := ss.SampleObjects(ctx, 2); err != nil {
+		t.Fatal(err)
+	} else if len(objects) != 2 {
+		t.Fatal("unexpected number of objects", len(objects))
+	} else if objects[0].Bucket+objects[0].Name == objects[1].Bucket+objects[1].Name {
+		t.Fatal("object was sampled twice", objects[0].Name)
+	}
+
+	// assert expired objects aren't sampled
+	if err := ss.db.Model(&dbObject{}).Where("object_id = ?", "/d").Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	} else if objects, err := ss.SampleObjects(ctx, 10); err != nil {
+		t.Fatal(err)
+	} else if len(objects) != 3 {
+		t.Fatal("unexpected number of objects", len(objects))
+	}
+}
+
+func TestObjectMetadata(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add an object and an empty object
+	ctx := context.Background()
+	obj, ucs := newTestObject(2)
+	if _, err := ss.UpdateObject(ctx, api.DefaultBucketName, "/foo", testContractSet, testETag, testMimeType, testMetadata, obj, ucs); err != nil {
+		t.Fatal(err)
+	} else if _, err := ss.UpdateObject(ctx, api.DefaultBucketName, "/empty", testContractSet, testETag, testMimeType, nil, object.Object{Key: object.GenerateEncryptionKey()}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the metadata matches the full object without the slabs
+	full, err := ss.Object(ctx, api.DefaultBucketName, "/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	om, err := ss.ObjectMetadata(ctx, api.DefaultBucketName, "/foo")
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(om.ObjectMetadata, full.ObjectMetadata) {
+		t.Fatal("unexpected metadata", om.ObjectMetadata, full.ObjectMetadata)
+	} else if !reflect.DeepEqual(om.Metadata, testMetadata) {
+		t.Fatal("unexpected user metadata", om.Metadata)
+	} else if len(om.Slabs) != 0 {
+		t.Fatal("expected no slabs")
+	}
+
+	// assert empty objects are healthy
+	if om, err := ss.ObjectMetadata(ctx, api.DefaultBucketName, "/empty"); err != nil {
+		t.Fatal(err)
+	} else if om.Health != 1 || om.Size != 0 {
+		t.Fatal("unexpected metadata", om.ObjectMetadata)
+	}
+
+	// assert unknown objects aren't found
+	if _, err := ss.ObjectMetadata(ctx, api.DefaultBucketName, "/bar"); !errors.Is(err, api.ErrObjectNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+}
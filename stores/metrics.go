@@ -0,0 +1,189 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+)
+
+const (
+	// contractSpendingMetricInterval is the interval by which contract
+	// spending is bucketed.
+	contractSpendingMetricInterval = time.Hour
+
+	// uploadStatsMetricsRetention is the amount of time snapshots of the
+	// upload stats are kept around before they are pruned.
+	uploadStatsMetricsRetention = 30 * 24 * time.Hour
+)
+
+type (
+	// dbContractSpendingMetric defines a table that stores the spending of a
+	// contract per category, bucketed by the hour.
+	dbContractSpendingMetric struct {
+		Model
+
+		FCID      fileContractID `gorm:"uniqueIndex:idx_contract_spending_metrics_fcid_start;NOT NULL;column:fcid;size:32"`
+		StartTime int64          `gorm:"uniqueIndex:idx_contract_spending_metrics_fcid_start;index;NOT NULL"` // unix milli
+
+		Uploads     currency
+		Downloads   currency
+		FundAccount currency
+		Deletions   currency
+		SectorRoots currency
+	}
+
+	// dbUploadStatsMetric defines a table that stores snapshots of the upload
+	// stats of a worker.
+	dbUploadStatsMetric struct {
+		Model
+
+		Timestamp int64  `gorm:"index;NOT NULL"` // unix milli
+		Worker    string `gorm:"index;NOT NULL"`
+		Version   string `gorm:"index"`
+
+		AvgSlabUploadSpeedMBPS float64
+		AvgOverdrivePct        float64
+		HealthyUploaders       uint64
+		NumUploaders           uint64
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbContractSpendingMetric) TableName() string { return "contract_spending_metrics" }
+
+// TableName implements the gorm.Tabler interface.
+func (dbUploadStatsMetric) TableName() string { return "upload_stats_metrics" }
+
+func (m dbContractSpendingMetric) convert() api.ContractSpendingMetric {
+	return api.ContractSpendingMetric{
+		Timestamp: api.TimeRFC3339(time.UnixMilli(m.StartTime).UTC()),
+		ContractSpending: api.ContractSpending{
+			Uploads:     types.Currency(m.Uploads),
+			Downloads:   types.Currency(m.Downloads),
+			FundAccount: types.Currency(m.FundAccount),
+			Deletions:   types.Currency(m.Deletions),
+			SectorRoots: types.Currency(m.SectorRoots),
+		},
+	}
+}
+
+func (m dbUploadStatsMetric) convert() api.UploadStatsMetric {
+	return api.UploadStatsMetric{
+		Timestamp:              api.TimeRFC3339(time.UnixMilli(m.Timestamp).UTC()),
+		Worker:                 m.Worker,
+		Version:                m.Version,
+		AvgSlabUploadSpeedMBPS: m.AvgSlabUploadSpeedMBPS,
+		AvgOverdrivePct:        m.AvgOverdrivePct,
+		HealthyUploaders:       m.HealthyUploaders,
+		NumUploaders:           m.NumUploaders,
+	}
+}
+
+// ContractSpendingMetrics returns the spending of the given contract bucketed
+// by the hour, only buckets that start within [from, to) are returned. A zero
+// 'to' returns all buckets starting at 'from'.
+func (s *SQLStore) ContractSpendingMetrics(ctx context.Context, fcid types.FileContractID, from, to time.Time) ([]api.ContractSpendingMetric, error) {
+	query := s.db.
+		Model(&dbContractSpendingMetric{}).
+		Where("fcid = ? AND start_time >= ?", fileContractID(fcid), from.Truncate(contractSpendingMetricInterval).UnixMilli())
+	if !to.IsZero() {
+		query = query.Where("start_time < ?", to.UnixMilli())
+	}
+
+	var metrics []dbContractSpendingMetric
+	if err := query.
+		Order("start_time ASC").
+		Find(&metrics).
+		Error; err != nil {
+		return nil, err
+	}
+
+	resp := make([]api.ContractSpendingMetric, len(metrics))
+	for i, m := range metrics {
+		resp[i] = m.convert()
+	}
+	return resp, nil
+}
+
+// RecordUploadStatsMetric stores a snapshot of the upload stats of a worker.
+// Snapshots that are older than the retention period are pruned.
+func (s *SQLStore) RecordUploadStatsMetric(ctx context.Context, metric api.UploadStatsMetric) error {
+	now := time.Now()
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		tx = tx.WithContext(ctx)
+		if err := tx.Create(&dbUploadStatsMetric{
+			Timestamp:              time.Time(metric.Timestamp).UnixMilli(),
+			Worker:                 metric.Worker,
+			Version:                metric.Version,
+			AvgSlabUploadSpeedMBPS: metric.AvgSlabUploadSpeedMBPS,
+			AvgOverdrivePct:        metric.AvgOverdrivePct,
+			HealthyUploaders:       metric.HealthyUploaders,
+			NumUploaders:           metric.NumUploaders,
+		}).Error; err != nil {
+			return err
+		}
+
+		// prune old snapshots
+		return tx.
+			Where("timestamp < ?", now.Add(-uploadStatsMetricsRetention).UnixMilli()).
+			Delete(&dbUploadStatsMetric{}).
+			Error
+	})
+}
+
+// UploadStatsMetrics returns the snapshots of the upload stats that were taken
+// within [from, to), optionally filtered by worker. A zero 'to' returns all
+// snapshots taken after 'from'.
+func (s *SQLStore) UploadStatsMetrics(ctx context.Context, from, to time.Time, worker string) ([]api.UploadStatsMetric, error) {
+	query := s.db.
+		Model(&dbUploadStatsMetric{}).
+		Where("timestamp >= ?", from.UnixMilli())
+	if !to.IsZero() {
+		query = query.Where("timestamp < ?", to.UnixMilli())
+	}
+	if worker != "" {
+		query = query.Where("worker = ?", worker)
+	}
+
+	var metrics []dbUploadStatsMetric
+	if err := query.
+		Order("timestamp ASC").
+		Find(&metrics).
+		Error; err != nil {
+		return nil, err
+	}
+
+	resp := make([]api.UploadStatsMetric, len(metrics))
+	for i, m := range metrics {
+		resp[i] = m.convert()
+	}
+	return resp, nil
+}
+
+// recordContractSpendingMetric adds the given spending to the bucket of the
+// contract that contains the given timestamp.
+func recordContractSpendingMetric(tx *gorm.DB, fcid types.FileContractID, timestamp time.Time, spending api.ContractSpending) error {
+	start := timestamp.Truncate(contractSpendingMetricInterval).UnixMilli()
+
+	var m dbContractSpendingMetric
+	err := tx.
+		Where("fcid = ? AND start_time = ?", fileContractID(fcid), start).
+		Take(&m).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		m = dbContractSpendingMetric{FCID: fileContractID(fcid), StartTime: start}
+	} else if err != nil {
+		return err
+	}
+
+	m.Uploads = currency(types.Currency(m.Uploads).Add(spending.Uploads))
+	m.Downloads = currency(types.Currency(m.Downloads).Add(spending.Downloads))
+	m.FundAccount = currency(types.Currency(m.FundAccount).Add(spending.FundAccount))
+	m.Deletions = currency(types.Currency(m.Deletions).Add(spending.Deletions))
+	m.SectorRoots = currency(types.Currency(m.SectorRoots).Add(spending.SectorRoots))
+	return tx.Save(&m).Error
+}
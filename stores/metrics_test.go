@@ -0,0 +1,149 @@
+package stores
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestContractSpendingMetrics(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add a contract
+	hk := types.GeneratePrivateKey().PublicKey()
+	if err := ss.addTestHost(hk); err != nil {
+		t.Fatal(err)
+	}
+	fcid := types.FileContractID{1}
+	if _, err := ss.addTestContract(fcid, hk); err != nil {
+		t.Fatal(err)
+	}
+
+	// record spending twice
+	spending := api.ContractSpending{
+		Uploads:     types.Siacoins(1),
+		Downloads:   types.Siacoins(2),
+		FundAccount: types.Siacoins(3),
+		Deletions:   types.Siacoins(4),
+		SectorRoots: types.Siacoins(5),
+	}
+	for i := uint64(1); i <= 2; i++ {
+		if err := ss.RecordContractSpending(context.Background(), []api.ContractSpendingRecord{
+			{ContractID: fcid, ContractSpending: spending, RevisionNumber: i},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// record spending in the previous hour
+	now := time.Now()
+	if err := recordContractSpendingMetric(ss.db, fcid, now.Add(-time.Hour), spending); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert both buckets are returned in order
+	metrics, err := ss.ContractSpendingMetrics(context.Background(), fcid, now.Add(-2*time.Hour), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 2 {
+		t.Fatal("unexpected number of metrics", len(metrics))
+	} else if metrics[0].ContractSpending != spending {
+		t.Fatal("unexpected spending", metrics[0].ContractSpending)
+	} else if metrics[1].ContractSpending != spending.Add(spending) {
+		t.Fatal("unexpected spending", metrics[1].ContractSpending)
+	} else if !time.Time(metrics[1].Timestamp).Equal(now.Truncate(time.Hour)) {
+		t.Fatal("unexpected timestamp", time.Time(metrics[1].Timestamp))
+	}
+
+	// assert the range is respected
+	metrics, err = ss.ContractSpendingMetrics(context.Background(), fcid, now.Add(-2*time.Hour), now.Truncate(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 1 || metrics[0].ContractSpending != spending {
+		t.Fatal("unexpected metrics", metrics)
+	}
+	metrics, err = ss.ContractSpendingMetrics(context.Background(), fcid, now, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 1 {
+		t.Fatal("unexpected number of metrics", len(metrics))
+	}
+
+	// assert metrics of other contracts are not returned
+	metrics, err = ss.ContractSpendingMetrics(context.Background(), types.FileContractID{2}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 0 {
+		t.Fatal("unexpected metrics", metrics)
+	}
+}
+
+func TestUploadStatsMetrics(t *testing.T) {
+	ss, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// record a snapshot per minute for two workers
+	start := time.Now().Truncate(time.Minute)
+	for i := 0; i < 4; i++ {
+		for _, worker := range []string{"w1", "w2"} {
+			if err := ss.RecordUploadStatsMetric(context.Background(), api.UploadStatsMetric{
+				Timestamp:              api.TimeRFC3339(start.Add(time.Duration(i) * time.Minute)),
+				Worker:                 worker,
+				Version:                "v1.0.0",
+				AvgSlabUploadSpeedMBPS: float64(i),
+				AvgOverdrivePct:        0.1,
+				HealthyUploaders:       uint64(i),
+				NumUploaders:           4,
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// assert all snapshots are returned
+	metrics, err := ss.UploadStatsMetrics(context.Background(), time.Time{}, time.Time{}, "")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 8 {
+		t.Fatal("unexpected number of metrics", len(metrics))
+	}
+
+	// assert we can filter by worker and range
+	metrics, err = ss.UploadStatsMetrics(context.Background(), start.Add(time.Minute), start.Add(3*time.Minute), "w2")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 2 {
+		t.Fatal("unexpected number of metrics", len(metrics))
+	} else if metrics[0].Worker != "w2" || metrics[0].HealthyUploaders != 1 || metrics[1].HealthyUploaders != 2 {
+		t.Fatal("unexpected metrics", metrics)
+	} else if !time.Time(metrics[0].Timestamp).Equal(start.Add(time.Minute)) {
+		t.Fatal("unexpected timestamp", time.Time(metrics[0].Timestamp))
+	} else if metrics[0].Version != "v1.0.0" {
+		t.Fatal("unexpected version", metrics[0].Version)
+	}
+
+	// assert snapshots that are older than the retention period are pruned
+	// when a snapshot is recorded
+	old := start.Add(-uploadStatsMetricsRetention - time.Minute)
+	for _, ts := range []time.Time{old, start.Add(4 * time.Minute)} {
+		if err := ss.RecordUploadStatsMetric(context.Background(), api.UploadStatsMetric{
+			Timestamp: api.TimeRFC3339(ts),
+			Worker:    "w1",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if metrics, err := ss.UploadStatsMetrics(context.Background(), time.Time{}, time.Time{}, "w1"); err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 5 {
+		t.Fatal("unexpected number of metrics", len(metrics))
+	}
+}
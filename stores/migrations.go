@@ -8,6 +8,7 @@ import (
 
 	"github.com/go-gormigrate/gormigrate/v2"
 	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -20,6 +21,7 @@ var (
 		&dbContractSet{},
 		&dbObject{},
 		&dbMultipartUpload{},
+		&dbObjectUserMetadata{},
 		&dbBucket{},
 		&dbBufferedSlab{},
 		&dbSlab{},
@@ -32,22 +34,45 @@ var (
 		&dbHost{},
 		&dbAllowlistEntry{},
 		&dbBlocklistEntry{},
+		&dbHostTag{},
+		&dbHostInteractionAggregate{},
 
 		// wallet tables
 		&dbSiacoinElement{},
 		&dbTransaction{},
+		&dbChangeAddress{},
 
 		// bus.SettingStore tables
 		&dbSetting{},
 
+		// alerts.Store tables
+		&dbAlert{},
+
 		// bus.EphemeralAccountStore tables
 		&dbAccount{},
 
 		// bus.AutopilotStore tables
 		&dbAutopilot{},
+		&dbAutopilotProfile{},
+
+		// bus.MetricsStore tables
+		&dbContractSpendingMetric{},
+		&dbUploadStatsMetric{},
 
 		// webhooks.WebhookStore tables
 		&dbWebhook{},
+
+		// sector deletion queue
+		&dbSectorDeletion{},
+		&dbHostMetric{},
+
+		// upload checkpoints
+		&dbPartialObject{},
+		&dbPartialObjectSlab{},
+		&dbPartialObjectSector{},
+
+		// bus idempotency keys
+		&dbIdempotentResponse{},
 	}
 )
 
@@ -261,6 +286,138 @@ func performMigrations(db *gorm.DB, logger *zap.SugaredLogger) error {
 				return performMigration00020_missingIndices(tx, logger)
 			},
 		},
+		{
+			ID: "00021_hostTags",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00021_hostTags(tx, logger)
+			},
+		},
+		{
+			ID: "00022_hostNotes",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00022_hostNotes(tx, logger)
+			},
+		},
+		{
+			ID: "00023_objectExpiry",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00023_objectExpiry(tx, logger)
+			},
+		},
+		{
+			ID: "00024_objectUserMetadata",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00024_objectUserMetadata(tx, logger)
+			},
+		},
+		{
+			ID: "00025_walletChangeAddresses",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00025_walletChangeAddresses(tx, logger)
+			},
+		},
+		{
+			ID: "00026_autopilotProfiles",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00026_autopilotProfiles(tx, logger)
+			},
+		},
+		{
+			ID: "00027_missedProofs",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00027_missedProofs(tx, logger)
+			},
+		},
+		{
+			ID: "00028_contractSpendingMetrics",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00028_contractSpendingMetrics(tx, logger)
+			},
+		},
+		{
+			ID: "00029_uploadStatsMetrics",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00029_uploadStatsMetrics(tx, logger)
+			},
+		},
+		{
+			ID: "00030_sectorsLatestHostIndex",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00030_sectorsLatestHostIndex(tx, logger)
+			},
+		},
+		{
+			ID: "00031_hostInteractionAggregates",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00031_hostInteractionAggregates(tx, logger)
+			},
+		},
+		{
+			ID: "00032_webhookSecret",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00032_webhookSecret(tx, logger)
+			},
+		},
+		{
+			ID: "00033_alerts",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00033_alerts(tx, logger)
+			},
+		},
+		{
+			ID: "00034_alertAggregation",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00034_alertAggregation(tx, logger)
+			},
+		},
+		{
+			ID: "00035_webhookObjectFilters",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00035_webhookObjectFilters(tx, logger)
+			},
+		},
+		{
+			ID: "00036_sectorDeletions",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00036_sectorDeletions(tx, logger)
+			},
+		},
+		{
+			ID: "00037_hostMetrics",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00037_hostMetrics(tx, logger)
+			},
+		},
+		{
+			ID: "00038_hostAliasGroups",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00038_hostAliasGroups(tx, logger)
+			},
+		},
+		{
+			ID: "00039_partialObjects",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00039_partialObjects(tx, logger)
+			},
+		},
+		{
+			ID: "00040_webhookFilterIndex",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00040_webhookFilterIndex(tx, logger)
+			},
+		},
+		{
+			ID: "00041_uploadStatsMetricsVersion",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00041_uploadStatsMetricsVersion(tx, logger)
+			},
+		},
+		{
+			ID: "00042_idempotentResponses",
+			Migrate: func(tx *gorm.DB) error {
+				return performMigration00042_idempotentResponses(tx, logger)
+			},
+		},
 	}
 	// Create migrator.
 	m := gormigrate.New(db, gormigrate.DefaultOptions, migrations)
@@ -938,3 +1095,351 @@ func performMigration00020_missingIndices(txn *gorm.DB, logger *zap.SugaredLogge
 	logger.Info("migration 00020_missingIndices complete")
 	return nil
 }
+
+func performMigration00021_hostTags(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00021_hostTags")
+	if !txn.Migrator().HasTable(&dbHostTag{}) {
+		if err := txn.Migrator().CreateTable(&dbHostTag{}); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00021_hostTags complete")
+	return nil
+}
+
+func performMigration00022_hostNotes(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00022_hostNotes")
+	for _, column := range []string{"Notes", "ScoreModifier"} {
+		if !txn.Migrator().HasColumn(&dbHost{}, column) {
+			if err := txn.Migrator().AddColumn(&dbHost{}, column); err != nil {
+				return err
+			}
+		}
+	}
+	logger.Info("migration 00022_hostNotes complete")
+	return nil
+}
+
+func performMigration00023_objectExpiry(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00023_objectExpiry")
+	if !txn.Migrator().HasColumn(&dbObject{}, "ExpiresAt") {
+		if err := txn.Migrator().AddColumn(&dbObject{}, "ExpiresAt"); err != nil {
+			return err
+		}
+	}
+	if !txn.Migrator().HasIndex(&dbObject{}, "ExpiresAt") {
+		if err := txn.Migrator().CreateIndex(&dbObject{}, "ExpiresAt"); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00023_objectExpiry complete")
+	return nil
+}
+
+func performMigration00024_objectUserMetadata(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00024_objectUserMetadata")
+	if !txn.Migrator().HasTable(&dbObjectUserMetadata{}) {
+		if err := txn.Migrator().CreateTable(&dbObjectUserMetadata{}); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00024_objectUserMetadata complete")
+	return nil
+}
+
+func performMigration00025_walletChangeAddresses(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00025_walletChangeAddresses")
+	if !txn.Migrator().HasTable(&dbChangeAddress{}) {
+		if err := txn.Migrator().CreateTable(&dbChangeAddress{}); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00025_walletChangeAddresses complete")
+	return nil
+}
+
+func performMigration00026_autopilotProfiles(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00026_autopilotProfiles")
+	if !txn.Migrator().HasColumn(&dbAutopilot{}, "Profile") {
+		if err := txn.Migrator().AddColumn(&dbAutopilot{}, "Profile"); err != nil {
+			return err
+		}
+	}
+	if !txn.Migrator().HasTable(&dbAutopilotProfile{}) {
+		if err := txn.Migrator().CreateTable(&dbAutopilotProfile{}); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00026_autopilotProfiles complete")
+	return nil
+}
+
+func performMigration00027_missedProofs(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00027_missedProofs")
+	for _, column := range []string{"MissedProofs", "LastMissedProof"} {
+		if !txn.Migrator().HasColumn(&dbHost{}, column) {
+			if err := txn.Migrator().AddColumn(&dbHost{}, column); err != nil {
+				return err
+			}
+		}
+	}
+	if !txn.Migrator().HasColumn(&dbArchivedContract{}, "ProofChecked") {
+		if err := txn.Migrator().AddColumn(&dbArchivedContract{}, "ProofChecked"); err != nil {
+			return err
+		}
+	}
+
+	// only check contracts whose proof window ends after the migration, we
+	// don't want to penalize hosts for proofs they missed in the past
+	if err := txn.Exec("UPDATE archived_contracts SET proof_checked = ? WHERE window_end <= (SELECT COALESCE(MAX(height), 0) FROM consensus_infos)", true).Error; err != nil {
+		return err
+	}
+	logger.Info("migration 00027_missedProofs complete")
+	return nil
+}
+
+func performMigration00028_contractSpendingMetrics(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00028_contractSpendingMetrics")
+	if !txn.Migrator().HasTable(&dbContractSpendingMetric{}) {
+		if err := txn.Migrator().CreateTable(&dbContractSpendingMetric{}); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00028_contractSpendingMetrics complete")
+	return nil
+}
+
+func performMigration00029_uploadStatsMetrics(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00029_uploadStatsMetrics")
+	if !txn.Migrator().HasTable(&dbUploadStatsMetric{}) {
+		if err := txn.Migrator().CreateTable(&dbUploadStatsMetric{}); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00029_uploadStatsMetrics complete")
+	return nil
+}
+
+func performMigration00030_sectorsLatestHostIndex(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00030_sectorsLatestHostIndex")
+	if !txn.Migrator().HasIndex(&dbSector{}, "LatestHost") {
+		if err := txn.Migrator().CreateIndex(&dbSector{}, "LatestHost"); err != nil {
+			return fmt.Errorf("failed to create index on column 'LatestHost' of table 'sectors': %w", err)
+		}
+	}
+	logger.Info("migration 00030_sectorsLatestHostIndex complete")
+	return nil
+}
+
+func performMigration00031_hostInteractionAggregates(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00031_hostInteractionAggregates")
+	if !txn.Migrator().HasTable(&dbHostInteractionAggregate{}) {
+		if err := txn.Migrator().CreateTable(&dbHostInteractionAggregate{}); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00031_hostInteractionAggregates complete")
+	return nil
+}
+
+func performMigration00032_webhookSecret(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00032_webhookSecret")
+	if !txn.Migrator().HasColumn(&dbWebhook{}, "Secret") {
+		if err := txn.Migrator().AddColumn(&dbWebhook{}, "Secret"); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00032_webhookSecret complete")
+	return nil
+}
+
+func performMigration00033_alerts(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00033_alerts")
+	if !txn.Migrator().HasTable(&dbAlert{}) {
+		if err := txn.Migrator().CreateTable(&dbAlert{}); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00033_alerts complete")
+	return nil
+}
+
+func performMigration00034_alertAggregation(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00034_alertAggregation")
+	for _, field := range []string{"Count", "LastSeen"} {
+		if !txn.Migrator().HasColumn(&dbAlert{}, field) {
+			if err := txn.Migrator().AddColumn(&dbAlert{}, field); err != nil {
+				return err
+			}
+		}
+	}
+	if err := txn.Exec("UPDATE alerts SET count = 1, last_seen = timestamp WHERE count IS NULL OR count = 0").Error; err != nil {
+		return err
+	}
+	if !txn.Migrator().HasColumn(&dbWebhook{}, "MinSeverity") {
+		if err := txn.Migrator().AddColumn(&dbWebhook{}, "MinSeverity"); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00034_alertAggregation complete")
+	return nil
+}
+
+func performMigration00035_webhookObjectFilters(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00035_webhookObjectFilters")
+	for _, field := range []string{"Bucket", "Prefix"} {
+		if !txn.Migrator().HasColumn(&dbWebhook{}, field) {
+			if err := txn.Migrator().AddColumn(&dbWebhook{}, field); err != nil {
+				return err
+			}
+		}
+	}
+	logger.Info("migration 00035_webhookObjectFilters complete")
+	return nil
+}
+
+func performMigration00036_sectorDeletions(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00036_sectorDeletions")
+	if !txn.Migrator().HasTable(&dbSectorDeletion{}) {
+		if err := txn.Migrator().CreateTable(&dbSectorDeletion{}); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00036_sectorDeletions complete")
+	return nil
+}
+
+func performMigration00037_hostMetrics(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00037_hostMetrics")
+	if !txn.Migrator().HasTable(&dbHostMetric{}) {
+		if err := txn.Migrator().CreateTable(&dbHostMetric{}); err != nil {
+			return err
+		}
+	}
+	for _, column := range []string{"UploadSpeedMBPS", "UploadLatencyP90MS", "DownloadSpeedMBPS", "DownloadLatencyP90MS"} {
+		if !txn.Migrator().HasColumn(&dbHost{}, column) {
+			if err := txn.Migrator().AddColumn(&dbHost{}, column); err != nil {
+				return err
+			}
+		}
+	}
+	logger.Info("migration 00037_hostMetrics complete")
+	return nil
+}
+
+func performMigration00038_hostAliasGroups(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00038_hostAliasGroups")
+	if !txn.Migrator().HasColumn(&dbHost{}, "AliasGroup") {
+		if err := txn.Migrator().AddColumn(&dbHost{}, "AliasGroup"); err != nil {
+			return err
+		}
+	}
+	if !txn.Migrator().HasIndex(&dbHost{}, "AliasGroup") {
+		if err := txn.Migrator().CreateIndex(&dbHost{}, "AliasGroup"); err != nil {
+			return err
+		}
+	}
+
+	// compute the alias groups of the hosts that were scanned successfully
+	if err := txn.Model(&dbHost{}).
+		Where("1 = 1").
+		Update("alias_group", hash256{}).
+		Error; err != nil {
+		return err
+	}
+	var hosts []dbHost
+	if err := txn.
+		Select("id", "net_address", "settings").
+		Where("scanned = ? AND total_scans > 0", true).
+		Find(&hosts).
+		Error; err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		if err := txn.Model(&dbHost{}).
+			Where("id", h.ID).
+			Update("alias_group", hash256(hostdb.AliasGroup(h.NetAddress, h.Settings.convert()))).
+			Error; err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00038_hostAliasGroups complete")
+	return nil
+}
+
+func performMigration00039_partialObjects(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00039_partialObjects")
+	for _, table := range []interface{}{&dbPartialObject{}, &dbPartialObjectSlab{}, &dbPartialObjectSector{}} {
+		if !txn.Migrator().HasTable(table) {
+			if err := txn.Migrator().CreateTable(table); err != nil {
+				return err
+			}
+		}
+	}
+	logger.Info("migration 00039_partialObjects complete")
+	return nil
+}
+
+func performMigration00040_webhookFilterIndex(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00040_webhookFilterIndex")
+
+	// webhooks without filters need empty filters to be unique
+	if err := txn.Exec("UPDATE webhooks SET bucket = '' WHERE bucket IS NULL").Error; err != nil {
+		return err
+	} else if err := txn.Exec("UPDATE webhooks SET prefix = '' WHERE prefix IS NULL").Error; err != nil {
+		return err
+	}
+
+	// shrink the columns so the index doesn't exceed the max key length
+	if !isSQLite(txn) {
+		for _, stmt := range []string{
+			"ALTER TABLE webhooks MODIFY COLUMN module VARCHAR(32) NOT NULL",
+			"ALTER TABLE webhooks MODIFY COLUMN event VARCHAR(32) NOT NULL",
+			"ALTER TABLE webhooks MODIFY COLUMN bucket VARCHAR(255) NOT NULL DEFAULT ''",
+			"ALTER TABLE webhooks MODIFY COLUMN prefix VARCHAR(191) NOT NULL DEFAULT ''",
+		} {
+			if err := txn.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	// add the filters to the index
+	if txn.Migrator().HasIndex(&dbWebhook{}, "idx_module_event_url") {
+		if err := txn.Migrator().DropIndex(&dbWebhook{}, "idx_module_event_url"); err != nil {
+			return err
+		}
+	}
+	if err := txn.Migrator().CreateIndex(&dbWebhook{}, "idx_module_event_url"); err != nil {
+		return err
+	}
+	logger.Info("migration 00040_webhookFilterIndex complete")
+	return nil
+}
+
+func performMigration00041_uploadStatsMetricsVersion(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00041_uploadStatsMetricsVersion")
+	if !txn.Migrator().HasColumn(&dbUploadStatsMetric{}, "Version") {
+		if err := txn.Migrator().AddColumn(&dbUploadStatsMetric{}, "Version"); err != nil {
+			return err
+		}
+	}
+	if !txn.Migrator().HasIndex(&dbUploadStatsMetric{}, "Version") {
+		if err := txn.Migrator().CreateIndex(&dbUploadStatsMetric{}, "Version"); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00041_uploadStatsMetricsVersion complete")
+	return nil
+}
+
+func performMigration00042_idempotentResponses(txn *gorm.DB, logger *zap.SugaredLogger) error {
+	logger.Info("performing migration 00042_idempotentResponses")
+	if !txn.Migrator().HasTable(&dbIdempotentResponse{}) {
+		if err := txn.Migrator().CreateTable(&dbIdempotentResponse{}); err != nil {
+			return err
+		}
+	}
+	logger.Info("migration 00042_idempotentResponses complete")
+	return nil
+}
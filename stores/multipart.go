@@ -25,9 +25,10 @@ type (
 		UploadID   string `gorm:"uniqueIndex;NOT NULL;size:64"`
 		ObjectID   string `gorm:"index;NOT NULL"`
 		DBBucket   dbBucket
-		DBBucketID uint              `gorm:"index;NOT NULL"`
-		Parts      []dbMultipartPart `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to delete parts too
-		MimeType   string            `gorm:"index"`
+		DBBucketID uint                   `gorm:"index;NOT NULL"`
+		Parts      []dbMultipartPart      `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to delete parts too
+		Metadata   []dbObjectUserMetadata `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to delete metadata too
+		MimeType   string                 `gorm:"index"`
 	}
 
 	dbMultipartPart struct {
@@ -49,7 +50,7 @@ func (dbMultipartPart) TableName() string {
 	return "multipart_parts"
 }
 
-func (s *SQLStore) CreateMultipartUpload(ctx context.Context, bucket, path string, ec object.EncryptionKey, mimeType string) (api.MultipartCreateResponse, error) {
+func (s *SQLStore) CreateMultipartUpload(ctx context.Context, bucket, path string, ec object.EncryptionKey, mimeType string, metadata api.ObjectUserMetadata) (api.MultipartCreateResponse, error) {
 	// Marshal key
 	key, err := ec.MarshalText()
 	if err != nil {
@@ -69,15 +70,21 @@ func (s *SQLStore) CreateMultipartUpload(ctx context.Context, bucket, path strin
 		// Create multipart upload
 		uploadIDEntropy := frand.Entropy256()
 		uploadID = hex.EncodeToString(uploadIDEntropy[:])
-		if err := s.db.Create(&dbMultipartUpload{
+		mu := dbMultipartUpload{
 			DBBucketID: bucketID,
 			Key:        key,
 			UploadID:   uploadID,
 			ObjectID:   path,
 			MimeType:   mimeType,
-		}).Error; err != nil {
+		}
+		if err := tx.Create(&mu).Error; err != nil {
 			return fmt.Errorf("failed to create multipart upload: %w", err)
 		}
+
+		// Create the user metadata.
+		if err := createUserMetadata(tx, nil, &mu.ID, metadata); err != nil {
+			return fmt.Errorf("failed to create user metadata: %w", err)
+		}
 		return nil
 	})
 	return api.MultipartCreateResponse{
@@ -160,7 +167,13 @@ func (s *SQLStore) MultipartUpload(ctx context.Context, uploadID string) (resp a
 	return
 }
 
-func (s *SQLStore) MultipartUploads(ctx context.Context, bucket, prefix, keyMarker, uploadIDMarker string, limit int) (resp api.MultipartListUploadsResponse, err error) {
+// MultipartUploads lists the multipart uploads in the given bucket that start
+// with the given prefix, sorted by path and upload id. If a delimiter is given,
+// uploads of paths that contain the delimiter after the prefix are rolled up
+// into a common prefix that ends at the first occurrence of the delimiter,
+// common prefixes count towards the limit and can be used as a path marker,
+// matching the semantics of S3.
+func (s *SQLStore) MultipartUploads(ctx context.Context, bucket, prefix, delimiter, keyMarker, uploadIDMarker string, limit int) (resp api.MultipartListUploadsResponse, err error) {
 	limitUsed := limit > 0
 	if !limitUsed {
 		limit = math.MaxInt64
@@ -170,35 +183,77 @@ func (s *SQLStore) MultipartUploads(ctx context.Context, bucket, prefix, keyMark
 
 	prefixExpr := gorm.Expr("TRUE")
 	if prefix != "" {
-		prefixExpr = gorm.Expr("SUBSTR(object_id, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix)
+		prefixExpr = gorm.Expr("SUBSTR(mu.object_id, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix)
 	}
-	keyMarkerExpr := gorm.Expr("TRUE")
-	if keyMarker != "" {
-		keyMarkerExpr = gorm.Expr("object_id > ?", keyMarker)
+
+	// uploads are grouped by their path and upload id unless a delimiter is
+	// given, in which case all uploads that share a common prefix are grouped
+	// together under an empty upload id
+	nameExpr, uploadIDExpr := gorm.Expr("mu.object_id"), gorm.Expr("mu.upload_id")
+	if delimiter != "" {
+		prefixLen := utf8.RuneCountInString(prefix)
+		delimPos := gorm.Expr("INSTR(SUBSTR(mu.object_id, ?), ?)", prefixLen+1, delimiter)
+		nameExpr = gorm.Expr("CASE WHEN ? > 0 THEN SUBSTR(mu.object_id, 1, ? + ?) ELSE mu.object_id END", delimPos, delimPos, prefixLen+utf8.RuneCountInString(delimiter)-1)
+		uploadIDExpr = gorm.Expr("CASE WHEN ? > 0 THEN '' ELSE mu.upload_id END", delimPos)
 	}
-	uploadIDMarkerExpr := gorm.Expr("TRUE")
-	if uploadIDMarker != "" {
-		uploadIDMarkerExpr = gorm.Expr("upload_id > ?", keyMarker)
+
+	// uploads are sorted by path and upload id, if an upload id marker is
+	// given we continue with the uploads of the marker path that come after
+	// it, otherwise we continue after the marker path or common prefix
+	markerExpr := gorm.Expr("TRUE")
+	if keyMarker != "" && uploadIDMarker != "" {
+		markerExpr = gorm.Expr("(? > ? OR (? = ? AND ? > ?))", nameExpr, keyMarker, nameExpr, keyMarker, uploadIDExpr, uploadIDMarker)
+	} else if keyMarker != "" {
+		markerExpr = gorm.Expr("? > ?", nameExpr, keyMarker)
 	}
 
 	err = s.retryTransaction(func(tx *gorm.DB) error {
-		var dbUploads []dbMultipartUpload
+		var rows []struct {
+			Name     string
+			UploadID string
+		}
 		err := tx.
-			Model(&dbMultipartUpload{}).
-			Joins("DBBucket").
-			Where("? AND ? AND ?", prefixExpr, keyMarkerExpr, uploadIDMarkerExpr).
+			Select("? as Name, ? as UploadID", nameExpr, uploadIDExpr).
+			Table("multipart_uploads mu").
+			Where("? AND ? AND ?", sqlWhereBucket("mu", bucket), prefixExpr, markerExpr).
+			Group("Name, UploadID").
+			Order("Name ASC, UploadID ASC").
 			Limit(limit).
-			Find(&dbUploads).
+			Scan(&rows).
 			Error
 		if err != nil {
 			return err
 		}
 		// Check if there are more uploads beyond 'limit'.
-		if limitUsed && len(dbUploads) == int(limit) {
+		if limitUsed && len(rows) == int(limit) {
 			resp.HasMore = true
-			dbUploads = dbUploads[:len(dbUploads)-1]
-			resp.NextPathMarker = dbUploads[len(dbUploads)-1].ObjectID
-			resp.NextUploadIDMarker = dbUploads[len(dbUploads)-1].UploadID
+			rows = rows[:len(rows)-1]
+			resp.NextPathMarker = rows[len(rows)-1].Name
+			resp.NextUploadIDMarker = rows[len(rows)-1].UploadID
+		}
+
+		// Fetch the uploads that weren't rolled up into a common prefix.
+		var uploadIDs []string
+		for _, row := range rows {
+			if row.UploadID == "" {
+				resp.CommonPrefixes = append(resp.CommonPrefixes, row.Name)
+			} else {
+				uploadIDs = append(uploadIDs, row.UploadID)
+			}
+		}
+		if len(uploadIDs) == 0 {
+			return nil
+		}
+		var dbUploads []dbMultipartUpload
+		err = tx.
+			Model(&dbMultipartUpload{}).
+			Joins("DBBucket").
+			Where("upload_id IN ?", uploadIDs).
+			Order("object_id ASC, upload_id ASC").
+			Find(&dbUploads).
+			Error
+		if err != nil {
+			return err
 		}
 		for _, upload := range dbUploads {
 			u, err := upload.convert()
@@ -276,23 +331,30 @@ func (s *SQLStore) AbortMultipartUpload(ctx context.Context, bucket, path string
 		if err != nil {
 			return fmt.Errorf("failed to delete multipart upload: %w", err)
 		}
-		return pruneSlabs(tx)
+		return nil
 	})
 }
 
-func (s *SQLStore) CompleteMultipartUpload(ctx context.Context, bucket, path string, uploadID string, parts []api.MultipartCompletedPart) (_ api.MultipartCompleteResponse, err error) {
+// CompleteMultipartUpload adds the object of a multipart upload at its path,
+// replacing the object that existed at that path. It returns whether an
+// object was replaced.
+func (s *SQLStore) CompleteMultipartUpload(ctx context.Context, bucket, path string, uploadID string, parts []api.MultipartCompletedPart) (_ api.MultipartCompleteResponse, overwritten bool, err error) {
 	// Sanity check input parts.
 	if !sort.SliceIsSorted(parts, func(i, j int) bool {
 		return parts[i].PartNumber < parts[j].PartNumber
 	}) {
-		return api.MultipartCompleteResponse{}, fmt.Errorf("provided parts are not sorted")
+		return api.MultipartCompleteResponse{}, false, fmt.Errorf("provided parts are not sorted")
 	}
 	for i := 0; i < len(parts)-1; i++ {
 		if parts[i].PartNumber == parts[i+1].PartNumber {
-			return api.MultipartCompleteResponse{}, fmt.Errorf("duplicate part number %v", parts[i].PartNumber)
+			return api.MultipartCompleteResponse{}, false, fmt.Errorf("duplicate part number %v", parts[i].PartNumber)
 		}
 	}
+	s.objectsMu.Lock()
+	defer s.objectsMu.Unlock()
+
 	var eTag string
+	var usageDelta int64
 	err = s.retryTransaction(func(tx *gorm.DB) error {
 		// Find multipart upload.
 		var mu dbMultipartUpload
@@ -314,12 +376,6 @@ func (s *SQLStore) CompleteMultipartUpload(ctx context.Context, bucket, path str
 			return fmt.Errorf("bucket name mismatch: %v != %v: %w", mu.DBBucket.Name, bucket, api.ErrBucketNotFound)
 		}
 
-		// Delete potentially existing object.
-		_, err := deleteObject(tx, bucket, path)
-		if err != nil {
-			return fmt.Errorf("failed to delete object: %w", err)
-		}
-
 		// Sort the parts.
 		sort.Slice(mu.Parts, func(i, j int) bool {
 			return mu.Parts[i].PartNumber < mu.Parts[j].PartNumber
@@ -349,6 +405,19 @@ func (s *SQLStore) CompleteMultipartUpload(ctx context.Context, bucket, path str
 			}
 		}
 
+		// Check the bucket's limits.
+		usageDelta, err = s.checkBucketLimits(tx, mu.DBBucket, path, int64(size))
+		if err != nil {
+			return err
+		}
+
+		// Delete potentially existing object.
+		numDeleted, err := deleteObject(tx, bucket, path)
+		if err != nil {
+			return fmt.Errorf("failed to delete object: %w", err)
+		}
+		overwritten = numDeleted > 0
+
 		// Fetch all the slices in the right order.
 		var slices []dbSlice
 		h := types.NewHasher()
@@ -370,7 +439,7 @@ func (s *SQLStore) CompleteMultipartUpload(ctx context.Context, bucket, path str
 
 		// Compute ETag.
 		sum := h.Sum()
-		eTag = hex.EncodeToString(sum[:])
+		eTag = api.MultipartETag(hex.EncodeToString(sum[:]), len(parts))
 
 		// Create the object.
 		obj := dbObject{
@@ -380,11 +449,23 @@ func (s *SQLStore) CompleteMultipartUpload(ctx context.Context, bucket, path str
 			Size:       int64(size),
 			MimeType:   mu.MimeType,
 			Etag:       eTag,
+			ExpiresAt:  objectExpiry(mu.DBBucket.Policy),
 		}
 		if err := tx.Create(&obj).Error; err != nil {
 			return fmt.Errorf("failed to create object: %w", err)
 		}
 
+		// Move the user metadata from the upload to the object.
+		if err := tx.Model(&dbObjectUserMetadata{}).
+			Where("db_multipart_upload_id = ?", mu.ID).
+			Updates(map[string]interface{}{
+				"db_object_id":           obj.ID,
+				"db_multipart_upload_id": nil,
+			}).
+			Error; err != nil {
+			return fmt.Errorf("failed to move user metadata: %w", err)
+		}
+
 		// Assign the right object id and unassign the multipart upload.  Also
 		// clear the ID to make sure new slices are created with IDs in
 		// ascending order.
@@ -406,11 +487,12 @@ func (s *SQLStore) CompleteMultipartUpload(ctx context.Context, bucket, path str
 		return nil
 	})
 	if err != nil {
-		return api.MultipartCompleteResponse{}, err
+		return api.MultipartCompleteResponse{}, false, err
 	}
+	s.updateBucketUsage(bucket, usageDelta)
 	return api.MultipartCompleteResponse{
 		ETag: eTag,
-	}, nil
+	}, overwritten, nil
 }
 
 func (u dbMultipartUpload) convert() (api.MultipartUpload, error) {
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/hex"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -50,7 +52,7 @@ func TestMultipartUploadWithUploadPackingRegression(t *testing.T) {
 	totalSize := int64(nParts * partSize)
 
 	// Upload parts until we have enough data for 2 buffers.
-	resp, err := db.CreateMultipartUpload(ctx, api.DefaultBucketName, objName, object.NoOpKey, testMimeType)
+	resp, err := db.CreateMultipartUpload(ctx, api.DefaultBucketName, objName, object.NoOpKey, testMimeType, testMetadata)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -78,7 +80,7 @@ func TestMultipartUploadWithUploadPackingRegression(t *testing.T) {
 		t.Fatal(err)
 	} else if nSlicesBefore == 0 {
 		t.Fatal("expected some slices")
-	} else if _, err = db.CompleteMultipartUpload(ctx, api.DefaultBucketName, objName, resp.UploadID, parts); err != nil {
+	} else if _, _, err = db.CompleteMultipartUpload(ctx, api.DefaultBucketName, objName, resp.UploadID, parts); err != nil {
 		t.Fatal(err)
 	} else if err := db.db.Model(&dbSlice{}).Count(&nSlicesAfter).Error; err != nil {
 		t.Fatal(err)
@@ -92,8 +94,12 @@ func TestMultipartUploadWithUploadPackingRegression(t *testing.T) {
 		t.Fatal(err)
 	} else if obj.Size != int64(totalSize) {
 		t.Fatalf("expected object size to be %v, got %v", totalSize, obj.Size)
+	} else if !reflect.DeepEqual(obj.Metadata, testMetadata) {
+		t.Fatal("unexpected metadata", obj.Metadata)
 	} else if obj.TotalSize() != totalSize {
 		t.Fatalf("expected object total size to be %v, got %v", totalSize, obj.TotalSize())
+	} else if !api.IsMultipartETag(obj.ETag) || !strings.HasSuffix(obj.ETag, fmt.Sprintf("-%d", len(parts))) {
+		t.Fatal("unexpected ETag", obj.ETag)
 	}
 
 	// Upload buffers.
@@ -146,3 +152,98 @@ func TestMultipartUploadWithUploadPackingRegression(t *testing.T) {
 		t.Fatalf("expected object total size to be %v, got %v", totalSize, obj.TotalSize())
 	}
 }
+
+func TestMultipartUploadsListing(t *testing.T) {
+	db, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create uploads in two buckets
+	ctx := context.Background()
+	if err := db.CreateBucket(ctx, "other", api.BucketPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/foo/a", "/foo/b", "/foo/b", "/bar/c"} {
+		if _, err := db.CreateMultipartUpload(ctx, api.DefaultBucketName, path, object.NoOpKey, testMimeType, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.CreateMultipartUpload(ctx, "other", "/foo/a", object.NoOpKey, testMimeType, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert uploads are scoped to the bucket and sorted by path
+	resp, err := db.MultipartUploads(ctx, api.DefaultBucketName, "", "", "", "", -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(resp.Uploads) != 4 || resp.HasMore {
+		t.Fatal("unexpected uploads", len(resp.Uploads), resp.HasMore)
+	} else if resp.Uploads[0].Path != "/bar/c" || resp.Uploads[3].Path != "/foo/b" {
+		t.Fatal("unexpected order", resp.Uploads)
+	}
+	all := resp.Uploads
+
+	// assert the prefix is respected
+	if resp, err := db.MultipartUploads(ctx, api.DefaultBucketName, "/foo/", "", "", "", -1); err != nil {
+		t.Fatal(err)
+	} else if len(resp.Uploads) != 3 {
+		t.Fatal("unexpected uploads", len(resp.Uploads))
+	}
+
+	// assert we can paginate through the uploads one by one, including the
+	// two uploads for the same path
+	var keyMarker, uploadIDMarker string
+	for i := range all {
+		resp, err := db.MultipartUploads(ctx, api.DefaultBucketName, "", "", keyMarker, uploadIDMarker, 1)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(resp.Uploads) != 1 {
+			t.Fatal("unexpected uploads", len(resp.Uploads))
+		} else if resp.Uploads[0].UploadID != all[i].UploadID {
+			t.Fatalf("unexpected upload at index %d", i)
+		} else if resp.HasMore != (i < len(all)-1) {
+			t.Fatal("unexpected hasMore", resp.HasMore)
+		}
+		keyMarker, uploadIDMarker = resp.NextPathMarker, resp.NextUploadIDMarker
+	}
+
+	// assert uploads are rolled up into common prefixes if a delimiter is
+	// given, common prefixes count towards the limit
+	if resp, err := db.MultipartUploads(ctx, api.DefaultBucketName, "/", "/", "", "", -1); err != nil {
+		t.Fatal(err)
+	} else if len(resp.Uploads) != 0 || !reflect.DeepEqual(resp.CommonPrefixes, []string{"/bar/", "/foo/"}) {
+		t.Fatal("unexpected listing", resp.Uploads, resp.CommonPrefixes)
+	}
+	if _, err := db.CreateMultipartUpload(ctx, api.DefaultBucketName, "/baz", object.NoOpKey, testMimeType, nil); err != nil {
+		t.Fatal(err)
+	}
+	var listed []string
+	keyMarker, uploadIDMarker = "", ""
+	for {
+		resp, err := db.MultipartUploads(ctx, api.DefaultBucketName, "/", "/", keyMarker, uploadIDMarker, 1)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(resp.Uploads)+len(resp.CommonPrefixes) != 1 {
+			t.Fatal("unexpected page size", resp.Uploads, resp.CommonPrefixes)
+		}
+		listed = append(listed, resp.CommonPrefixes...)
+		for _, u := range resp.Uploads {
+			listed = append(listed, u.Path)
+		}
+		if !resp.HasMore {
+			break
+		}
+		keyMarker, uploadIDMarker = resp.NextPathMarker, resp.NextUploadIDMarker
+	}
+	if !reflect.DeepEqual(listed, []string{"/bar/", "/baz", "/foo/"}) {
+		t.Fatal("unexpected listing", listed)
+	}
+
+	// assert the delimiter is applied after the prefix
+	if resp, err := db.MultipartUploads(ctx, api.DefaultBucketName, "/foo/", "/", "", "", -1); err != nil {
+		t.Fatal(err)
+	} else if len(resp.Uploads) != 3 || len(resp.CommonPrefixes) != 0 {
+		t.Fatal("unexpected listing", resp.Uploads, resp.CommonPrefixes)
+	}
+}
@@ -0,0 +1,270 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+	"gorm.io/gorm"
+)
+
+type (
+	// dbPartialObject is the checkpoint of an upload that did not complete
+	// yet.
+	dbPartialObject struct {
+		Model
+		UpdatedAt time.Time `gorm:"index"`
+
+		Bucket   string `gorm:"uniqueIndex:idx_partial_objects_bucket_path;NOT NULL"`
+		ObjectID string `gorm:"uniqueIndex:idx_partial_objects_bucket_path;NOT NULL"`
+
+		Key           []byte
+		ContractSet   string
+		MinShards     uint8
+		TotalShards   uint8
+		UsedContracts []byte
+
+		Slabs   []dbPartialObjectSlab   `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to delete slabs too
+		Sectors []dbPartialObjectSector `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to delete sectors too
+	}
+
+	// dbPartialObjectSlab is a slab of a checkpointed upload.
+	dbPartialObjectSlab struct {
+		Model
+
+		DBPartialObjectID uint `gorm:"uniqueIndex:idx_partial_object_slabs_index;NOT NULL"`
+		SlabIndex         int  `gorm:"uniqueIndex:idx_partial_object_slabs_index;NOT NULL"`
+		Slab              []byte
+		Hash              hash256 `gorm:"size:32"`
+	}
+
+	// dbPartialObjectSector is a sector of a checkpointed upload, sectors are
+	// tracked separately so they can be excluded when pruning contracts.
+	dbPartialObjectSector struct {
+		Model
+
+		DBPartialObjectID uint      `gorm:"index;NOT NULL"`
+		Host              publicKey `gorm:"index;NOT NULL;size:32"`
+		Root              hash256   `gorm:"NOT NULL;size:32"`
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbPartialObject) TableName() string { return "partial_objects" }
+
+// TableName implements the gorm.Tabler interface.
+func (dbPartialObjectSlab) TableName() string { return "partial_object_slabs" }
+
+// TableName implements the gorm.Tabler interface.
+func (dbPartialObjectSector) TableName() string { return "partial_object_sectors" }
+
+// PartialObject returns the checkpoint of an unfinished upload to the given
+// path.
+func (s *SQLStore) PartialObject(ctx context.Context, bucket, path string) (api.PartialObject, error) {
+	var po dbPartialObject
+	err := s.db.
+		WithContext(ctx).
+		Preload("Slabs", func(db *gorm.DB) *gorm.DB { return db.Order("slab_index ASC") }).
+		Where("bucket = ? AND object_id = ?", bucket, path).
+		Take(&po).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return api.PartialObject{}, api.ErrPartialObjectNotFound
+	} else if err != nil {
+		return api.PartialObject{}, err
+	}
+	return po.convert()
+}
+
+// AddPartialObjectSlabs adds the slabs of the given partial object to the
+// checkpoint of an unfinished upload to the given path. The offset is the
+// index of the first slab, an offset of zero replaces any existing
+// checkpoint. Adding slabs with an offset that doesn't match the number of
+// slabs in the checkpoint fails with api.ErrPartialObjectConflict.
+func (s *SQLStore) AddPartialObjectSlabs(ctx context.Context, bucket, path string, offset int, po api.PartialObject) error {
+	if len(po.Slabs) != len(po.SlabHashes) {
+		return fmt.Errorf("number of slabs and slab hashes doesn't match, %v != %v", len(po.Slabs), len(po.SlabHashes))
+	}
+	key, err := po.Key.MarshalText()
+	if err != nil {
+		return err
+	}
+
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		tx = tx.WithContext(ctx)
+
+		// fetch the existing checkpoint
+		var existing dbPartialObject
+		err := tx.
+			Where("bucket = ? AND object_id = ?", bucket, path).
+			Take(&existing).
+			Error
+		exists := err == nil
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// an offset of zero starts a new checkpoint
+		if offset == 0 && exists {
+			if err := tx.Delete(&existing).Error; err != nil {
+				return err
+			}
+			exists = false
+		}
+
+		used := make(map[types.PublicKey]types.FileContractID)
+		if !exists {
+			if offset != 0 {
+				return fmt.Errorf("%w; checkpoint doesn't exist", api.ErrPartialObjectConflict)
+			}
+			existing = dbPartialObject{
+				Bucket:      bucket,
+				ObjectID:    path,
+				Key:         key,
+				ContractSet: po.ContractSet,
+				MinShards:   po.MinShards,
+				TotalShards: po.TotalShards,
+			}
+		} else {
+			var numSlabs int64
+			if err := tx.
+				Model(&dbPartialObjectSlab{}).
+				Where("db_partial_object_id = ?", existing.ID).
+				Count(&numSlabs).
+				Error; err != nil {
+				return err
+			} else if int(numSlabs) != offset {
+				return fmt.Errorf("%w; checkpoint has %v slabs, offset is %v", api.ErrPartialObjectConflict, numSlabs, offset)
+			} else if err := json.Unmarshal(existing.UsedContracts, &used); err != nil {
+				return err
+			}
+		}
+
+		// merge the used contracts
+		for hk, fcid := range po.UsedContracts {
+			used[hk] = fcid
+		}
+		existing.UsedContracts, err = json.Marshal(used)
+		if err != nil {
+			return err
+		}
+		if err := tx.Save(&existing).Error; err != nil {
+			return err
+		}
+
+		// add the slabs and their sectors
+		slabs := make([]dbPartialObjectSlab, 0, len(po.Slabs))
+		var sectors []dbPartialObjectSector
+		for i, slab := range po.Slabs {
+			b, err := json.Marshal(slab)
+			if err != nil {
+				return err
+			}
+			slabs = append(slabs, dbPartialObjectSlab{
+				DBPartialObjectID: existing.ID,
+				SlabIndex:         offset + i,
+				Slab:              b,
+				Hash:              hash256(po.SlabHashes[i]),
+			})
+			for _, sector := range slab.Shards {
+				sectors = append(sectors, dbPartialObjectSector{
+					DBPartialObjectID: existing.ID,
+					Host:              publicKey(sector.Host),
+					Root:              hash256(sector.Root),
+				})
+			}
+		}
+		if len(slabs) > 0 {
+			if err := tx.CreateInBatches(&slabs, 100).Error; err != nil {
+				return err
+			}
+		}
+		if len(sectors) > 0 {
+			if err := tx.CreateInBatches(&sectors, pruneSlabsInsertBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeletePartialObject deletes the checkpoint of an unfinished upload to the
+// given path.
+func (s *SQLStore) DeletePartialObject(ctx context.Context, bucket, path string) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		return tx.
+			WithContext(ctx).
+			Where("bucket = ? AND object_id = ?", bucket, path).
+			Delete(&dbPartialObject{}).
+			Error
+	})
+}
+
+// PartialObjectRoots returns the roots of the checkpointed sectors that are
+// stored on the host of the contract with the given id. Sectors are matched by
+// host rather than by contract so they remain protected when the contract is
+// renewed.
+func (s *SQLStore) PartialObjectRoots(ctx context.Context, id types.FileContractID) ([]types.Hash256, error) {
+	var roots []hash256
+	if err := s.db.
+		WithContext(ctx).
+		Raw(`SELECT pos.root FROM partial_object_sectors pos
+	INNER JOIN hosts h ON h.public_key = pos.host
+	INNER JOIN contracts c ON c.host_id = h.id
+	WHERE c.fcid = ?`, fileContractID(id)).
+		Scan(&roots).
+		Error; err != nil {
+		return nil, err
+	}
+	res := make([]types.Hash256, len(roots))
+	for i, root := range roots {
+		res[i] = types.Hash256(root)
+	}
+	return res, nil
+}
+
+// PrunePartialObjects deletes the checkpoints that weren't updated since the
+// given time, the uploads were most likely abandoned.
+func (s *SQLStore) PrunePartialObjects(ctx context.Context, before time.Time) (pruned int64, err error) {
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		res := tx.
+			WithContext(ctx).
+			Where("updated_at < ?", before).
+			Delete(&dbPartialObject{})
+		pruned = res.RowsAffected
+		return res.Error
+	})
+	return
+}
+
+// convert turns a dbPartialObject into an api.PartialObject, the slabs need
+// to be preloaded.
+func (po dbPartialObject) convert() (api.PartialObject, error) {
+	res := api.PartialObject{
+		ContractSet:   po.ContractSet,
+		MinShards:     po.MinShards,
+		TotalShards:   po.TotalShards,
+		Slabs:         make([]object.SlabSlice, len(po.Slabs)),
+		SlabHashes:    make([]types.Hash256, len(po.Slabs)),
+		UsedContracts: make(map[types.PublicKey]types.FileContractID),
+	}
+	if err := res.Key.UnmarshalText(po.Key); err != nil {
+		return api.PartialObject{}, err
+	} else if err := json.Unmarshal(po.UsedContracts, &res.UsedContracts); err != nil {
+		return api.PartialObject{}, err
+	}
+	for i, slab := range po.Slabs {
+		if slab.SlabIndex != i {
+			return api.PartialObject{}, fmt.Errorf("checkpoint is missing slab %v", i)
+		} else if err := json.Unmarshal(slab.Slab, &res.Slabs[i]); err != nil {
+			return api.PartialObject{}, err
+		}
+		res.SlabHashes[i] = types.Hash256(slab.Hash)
+	}
+	return res, nil
+}
@@ -0,0 +1,143 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+func TestPartialObjects(t *testing.T) {
+	db, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// create hosts and contracts
+	hks, err := db.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert there's no checkpoint
+	if _, err := db.PartialObject(ctx, "bucket", "foo"); !errors.Is(err, api.ErrPartialObjectNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// newCheckpoint returns a checkpoint with one slab stored on the given host
+	key := object.GenerateEncryptionKey()
+	newCheckpoint := func(i int) (api.PartialObject, types.Hash256) {
+		root := types.Hash256(frand.Entropy256())
+		return api.PartialObject{
+			Key:         key,
+			ContractSet: testContractSet,
+			MinShards:   1,
+			TotalShards: 1,
+			Slabs: []object.SlabSlice{{
+				Slab: object.Slab{
+					Key:       object.GenerateEncryptionKey(),
+					MinShards: 1,
+					Shards:    []object.Sector{{Host: hks[i], Root: root}},
+				},
+				Length: 1,
+			}},
+			SlabHashes:    []types.Hash256{frand.Entropy256()},
+			UsedContracts: map[types.PublicKey]types.FileContractID{hks[i]: fcids[i]},
+		}, root
+	}
+
+	// add two slabs, one at a time
+	po1, root1 := newCheckpoint(0)
+	if err := db.AddPartialObjectSlabs(ctx, "bucket", "foo", 0, po1); err != nil {
+		t.Fatal(err)
+	}
+	po2, root2 := newCheckpoint(1)
+	if err := db.AddPartialObjectSlabs(ctx, "bucket", "foo", 1, po2); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert adding slabs at the wrong offset fails
+	if err := db.AddPartialObjectSlabs(ctx, "bucket", "foo", 1, po2); !errors.Is(err, api.ErrPartialObjectConflict) {
+		t.Fatal("unexpected error", err)
+	} else if err := db.AddPartialObjectSlabs(ctx, "bucket", "bar", 1, po2); !errors.Is(err, api.ErrPartialObjectConflict) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert the checkpoint contains both slabs and the merged contracts
+	po, err := db.PartialObject(ctx, "bucket", "foo")
+	if err != nil {
+		t.Fatal(err)
+	} else if po.Key.String() != key.String() || po.ContractSet != testContractSet || po.MinShards != 1 || po.TotalShards != 1 {
+		t.Fatal("unexpected checkpoint", po)
+	} else if !reflect.DeepEqual(po.Slabs, append(po1.Slabs, po2.Slabs...)) {
+		t.Fatal("unexpected slabs", po.Slabs)
+	} else if !reflect.DeepEqual(po.SlabHashes, append(po1.SlabHashes, po2.SlabHashes...)) {
+		t.Fatal("unexpected slab hashes", po.SlabHashes)
+	} else if len(po.UsedContracts) != 2 || po.UsedContracts[hks[0]] != fcids[0] || po.UsedContracts[hks[1]] != fcids[1] {
+		t.Fatal("unexpected used contracts", po.UsedContracts)
+	}
+
+	// assert the checkpoint is scoped to the bucket
+	if _, err := db.PartialObject(ctx, "other", "foo"); !errors.Is(err, api.ErrPartialObjectNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert the checkpointed sectors are returned for their contracts
+	if roots, err := db.PartialObjectRoots(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 1 || roots[0] != root1 {
+		t.Fatal("unexpected roots", roots)
+	} else if roots, err := db.PartialObjectRoots(ctx, fcids[1]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 1 || roots[0] != root2 {
+		t.Fatal("unexpected roots", roots)
+	}
+
+	// assert an offset of zero replaces the checkpoint
+	if err := db.AddPartialObjectSlabs(ctx, "bucket", "foo", 0, po2); err != nil {
+		t.Fatal(err)
+	} else if po, err := db.PartialObject(ctx, "bucket", "foo"); err != nil {
+		t.Fatal(err)
+	} else if len(po.Slabs) != 1 || len(po.UsedContracts) != 1 {
+		t.Fatal("unexpected checkpoint", po)
+	} else if roots, err := db.PartialObjectRoots(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 0 {
+		t.Fatal("unexpected roots", roots)
+	}
+
+	// assert only expired checkpoints are pruned
+	if pruned, err := db.PrunePartialObjects(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if pruned != 0 {
+		t.Fatal("unexpected number of pruned checkpoints", pruned)
+	} else if pruned, err := db.PrunePartialObjects(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if pruned != 1 {
+		t.Fatal("unexpected number of pruned checkpoints", pruned)
+	} else if roots, err := db.PartialObjectRoots(ctx, fcids[1]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 0 {
+		t.Fatal("unexpected roots", roots)
+	}
+
+	// assert the checkpoint can be deleted
+	if err := db.AddPartialObjectSlabs(ctx, "bucket", "foo", 0, po1); err != nil {
+		t.Fatal(err)
+	} else if err := db.DeletePartialObject(ctx, "bucket", "foo"); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.PartialObject(ctx, "bucket", "foo"); !errors.Is(err, api.ErrPartialObjectNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+}
@@ -0,0 +1,166 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+)
+
+// objectExpiry returns the expiry of an object that is added to a bucket with
+// the given policy, objects in buckets without a TTL never expire.
+func objectExpiry(bp api.BucketPolicy) sql.NullTime {
+	if bp.ObjectTTL <= 0 {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{
+		Time:  time.Now().Add(time.Duration(bp.ObjectTTL)),
+		Valid: true,
+	}
+}
+
+// PromoteObject makes an object in a scratch bucket permanent by clearing its
+// expiry. If a destination is given, the object is moved there and overwrites
+// any object that already exists at that path.
+func (s *SQLStore) PromoteObject(ctx context.Context, bucket, path, dstBucket, dstPath string) error {
+	if dstBucket == "" {
+		dstBucket = bucket
+	}
+	if dstPath == "" {
+		dstPath = path
+	}
+
+	s.objectsMu.Lock()
+	defer s.objectsMu.Unlock()
+
+	// the object moves between buckets, so the usage of both buckets changes
+	defer s.invalidateBucketUsage(bucket, dstBucket)
+
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		var obj dbObject
+		err := tx.Where("object_id = ? AND ?", path, sqlWhereBucket("objects", bucket)).
+			Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+			Take(&obj).
+			Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: key %v", api.ErrObjectNotFound, path)
+		} else if err != nil {
+			return fmt.Errorf("failed to fetch object: %w", err)
+		}
+
+		var b dbBucket
+		err = tx.Where("name = ?", dstBucket).
+			Take(&b).
+			Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("bucket %v not found: %w", dstBucket, api.ErrBucketNotFound)
+		} else if err != nil {
+			return fmt.Errorf("failed to fetch bucket: %w", err)
+		}
+
+		// delete the object at the destination unless we promote in place,
+		// the slabs of the promoted object are still referenced so they
+		// won't be pruned
+		if b.ID != obj.DBBucketID || dstPath != path {
+			if b.ID != obj.DBBucketID {
+				if _, err := s.checkBucketLimits(tx, b, dstPath, obj.Size); err != nil {
+					return err
+				}
+			}
+			if _, err := deleteObject(tx, dstBucket, dstPath); err != nil {
+				return fmt.Errorf("failed to delete object: %w", err)
+			}
+		}
+
+		return tx.Model(&obj).
+			Updates(map[string]interface{}{
+				"db_bucket_id": b.ID,
+				"object_id":    dstPath,
+				"expires_at":   nil,
+			}).
+			Error
+	})
+}
+
+// PruneExpiredObjects deletes all objects that expired before the given time
+// as well as multipart uploads in scratch buckets that were created more than
+// the bucket's TTL ago. Objects are deleted in batches to avoid locking the
+// database for a long time, the given function is called for every deleted
+// object once its batch was committed.
+func (s *SQLStore) PruneExpiredObjects(ctx context.Context, now time.Time, deleted func(bucket, path string)) (objects, uploads int64, err error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return objects, uploads, err
+		}
+
+		var batch []struct {
+			ID     uint
+			Bucket string
+			Path   string
+		}
+		err := s.retryTransaction(func(tx *gorm.DB) error {
+			batch = nil
+			if err := tx.
+				Model(&dbObject{}).
+				Select("objects.id as ID, b.name as Bucket, objects.object_id as Path").
+				Joins("INNER JOIN buckets b ON b.id = objects.db_bucket_id").
+				Where("objects.expires_at IS NOT NULL AND objects.expires_at <= ?", now).
+				Limit(removeObjectsBatchSize).
+				Scan(&batch).
+				Error; err != nil {
+				return err
+			} else if len(batch) == 0 {
+				return nil
+			}
+			ids := make([]uint, len(batch))
+			for i, o := range batch {
+				ids[i] = o.ID
+			}
+			return tx.Where("id IN (?)", ids).Delete(&dbObject{}).Error
+		})
+		if err != nil {
+			return objects, uploads, fmt.Errorf("failed to prune expired objects: %w", err)
+		}
+		objects += int64(len(batch))
+		if len(batch) > 0 {
+			s.invalidateBucketUsage()
+		}
+		if deleted != nil {
+			for _, o := range batch {
+				deleted(o.Bucket, o.Path)
+			}
+		}
+		if len(batch) < removeObjectsBatchSize {
+			break
+		}
+	}
+
+	var buckets []dbBucket
+	if err := s.db.Find(&buckets).Error; err != nil {
+		return objects, uploads, fmt.Errorf("failed to fetch buckets: %w", err)
+	}
+	for _, b := range buckets {
+		if b.Policy.ObjectTTL <= 0 {
+			continue
+		}
+		var aborted int64
+		err := s.retryTransaction(func(tx *gorm.DB) error {
+			res := tx.Where("db_bucket_id = ? AND created_at <= ?", b.ID, now.Add(-time.Duration(b.Policy.ObjectTTL))).
+				Delete(&dbMultipartUpload{})
+			if res.Error != nil {
+				return res.Error
+			}
+			aborted = res.RowsAffected
+			return nil
+		})
+		if err != nil {
+			return objects, uploads, fmt.Errorf("failed to prune expired multipart uploads: %w", err)
+		}
+		uploads += aborted
+	}
+	return objects, uploads, nil
+}
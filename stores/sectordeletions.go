@@ -0,0 +1,151 @@
+package stores
+
+import (
+	"context"
+	"math"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// pruneSlabsInsertBatchSize is the number of sector deletions that are
+	// queued per insert when pruning slabs.
+	pruneSlabsInsertBatchSize = 100
+)
+
+type (
+	// dbSectorDeletion is a sector that is no longer referenced by any slab
+	// and is queued to be deleted from the contract it is stored in.
+	dbSectorDeletion struct {
+		Model
+
+		FCID fileContractID `gorm:"uniqueIndex:idx_sector_deletions_fcid_root;NOT NULL;column:fcid;size:32"`
+		Root hash256        `gorm:"uniqueIndex:idx_sector_deletions_fcid_root;NOT NULL;size:32"`
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbSectorDeletion) TableName() string { return "sector_deletions" }
+
+// PruneSlabs deletes up to limit slabs that are no longer referenced by any
+// object, multipart upload or buffered slab. The sectors of the pruned slabs
+// are queued for deletion from the contracts they are stored in. A negative
+// limit prunes all unreferenced slabs.
+func (s *SQLStore) PruneSlabs(ctx context.Context, limit int) (pruned int64, err error) {
+	err = s.retryTransaction(func(tx *gorm.DB) (err error) {
+		pruned, err = pruneSlabs(tx.WithContext(ctx), limit)
+		return
+	})
+	return
+}
+
+// SectorDeletions returns up to limit sectors that are queued for deletion in
+// the order they were queued, grouped by contract. A negative limit returns
+// all queued sectors.
+func (s *SQLStore) SectorDeletions(ctx context.Context, limit int) ([]api.ContractSectorDeletions, error) {
+	if limit <= -1 {
+		limit = math.MaxInt
+	}
+	var rows []dbSectorDeletion
+	if err := s.db.
+		WithContext(ctx).
+		Model(&dbSectorDeletion{}).
+		Select("fcid, root").
+		Order("id ASC").
+		Limit(limit).
+		Find(&rows).
+		Error; err != nil {
+		return nil, err
+	}
+
+	deletions := make([]api.ContractSectorDeletions, 0)
+	indices := make(map[fileContractID]int)
+	for _, row := range rows {
+		i, ok := indices[row.FCID]
+		if !ok {
+			i = len(deletions)
+			indices[row.FCID] = i
+			deletions = append(deletions, api.ContractSectorDeletions{ContractID: types.FileContractID(row.FCID)})
+		}
+		deletions[i].Roots = append(deletions[i].Roots, types.Hash256(row.Root))
+	}
+	return deletions, nil
+}
+
+// RemoveSectorDeletions removes the given sectors from the deletion queue of
+// the contract with the given id.
+func (s *SQLStore) RemoveSectorDeletions(ctx context.Context, fcid types.FileContractID, roots []types.Hash256) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		for i := 0; i < len(roots); i += maxSQLVars {
+			end := i + maxSQLVars
+			if end > len(roots) {
+				end = len(roots)
+			}
+			batch := make([]hash256, 0, end-i)
+			for _, root := range roots[i:end] {
+				batch = append(batch, hash256(root))
+			}
+			if err := tx.
+				Where("fcid = ? AND root IN ?", fileContractID(fcid), batch).
+				Delete(&dbSectorDeletion{}).
+				Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// pruneSlabs deletes up to limit slabs that are not referenced by any object,
+// multipart upload or buffered slab and queues their sectors for deletion.
+// The sectors and contract sectors are deleted through the cascade.
+func pruneSlabs(tx *gorm.DB, limit int) (int64, error) {
+	var slabIDs []uint
+	if err := tx.
+		Model(&dbSlab{}).
+		Joins("LEFT JOIN slices sli ON sli.db_slab_id = slabs.id").
+		Where("sli.db_object_id IS NULL AND sli.db_multipart_part_id IS NULL AND slabs.db_buffered_slab_id IS NULL").
+		Limit(limit).
+		Pluck("slabs.id", &slabIDs).
+		Error; err != nil {
+		return 0, err
+	}
+
+	var pruned int64
+	for i := 0; i < len(slabIDs); i += maxSQLVars {
+		end := i + maxSQLVars
+		if end > len(slabIDs) {
+			end = len(slabIDs)
+		}
+		batch := slabIDs[i:end]
+
+		// queue the sectors for deletion
+		var deletions []dbSectorDeletion
+		if err := tx.Raw(`SELECT c.fcid, sec.root FROM sectors sec
+		INNER JOIN contract_sectors cs ON cs.db_sector_id = sec.id
+		INNER JOIN contracts c ON c.id = cs.db_contract_id
+		WHERE sec.db_slab_id IN ?`, batch).
+			Scan(&deletions).
+			Error; err != nil {
+			return 0, err
+		} else if len(deletions) > 0 {
+			if err := tx.
+				Clauses(clause.OnConflict{DoNothing: true}).
+				CreateInBatches(&deletions, pruneSlabsInsertBatchSize).
+				Error; err != nil {
+				return 0, err
+			}
+		}
+
+		// delete the slabs
+		res := tx.Where("id IN ?", batch).Delete(&dbSlab{})
+		if res.Error != nil {
+			return 0, res.Error
+		}
+		pruned += res.RowsAffected
+	}
+	return pruned, nil
+}
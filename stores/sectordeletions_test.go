@@ -0,0 +1,128 @@
+package stores
+
+import (
+	"context"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+)
+
+func TestSectorDeletions(t *testing.T) {
+	db, _, _, err := newTestSQLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// create hosts and contracts
+	hks, err := db.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add two objects, the first one has a sector on both hosts
+	addObject := func(path string, roots ...types.Hash256) {
+		t.Helper()
+		var shards []object.Sector
+		usedContracts := make(map[types.PublicKey]types.FileContractID)
+		for i, root := range roots {
+			shards = append(shards, object.Sector{Host: hks[i], Root: root})
+			usedContracts[hks[i]] = fcids[i]
+		}
+		if _, err := db.UpdateObject(ctx, api.DefaultBucketName, path, testContractSet, testETag, testMimeType, testMetadata, object.Object{
+			Key: object.GenerateEncryptionKey(),
+			Slabs: []object.SlabSlice{{
+				Slab: object.Slab{
+					Key:       object.GenerateEncryptionKey(),
+					MinShards: 1,
+					Shards:    shards,
+				},
+			}},
+		}, usedContracts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addObject("foo", types.Hash256{1}, types.Hash256{2})
+	addObject("bar", types.Hash256{3})
+
+	// assert nothing is pruned while the slabs are referenced
+	if pruned, err := db.PruneSlabs(ctx, -1); err != nil {
+		t.Fatal(err)
+	} else if pruned != 0 {
+		t.Fatal("unexpected number of pruned slabs", pruned)
+	}
+
+	// remove both objects, the sectors are only queued for deletion once the
+	// slabs are pruned
+	if err := db.RemoveObject(ctx, api.DefaultBucketName, "foo"); err != nil {
+		t.Fatal(err)
+	} else if err := db.RemoveObject(ctx, api.DefaultBucketName, "bar"); err != nil {
+		t.Fatal(err)
+	} else if deletions, err := db.SectorDeletions(ctx, -1); err != nil {
+		t.Fatal(err)
+	} else if len(deletions) != 0 {
+		t.Fatal("unexpected deletions", deletions)
+	}
+
+	// prune the slabs one by one
+	for i := 0; i < 2; i++ {
+		if pruned, err := db.PruneSlabs(ctx, 1); err != nil {
+			t.Fatal(err)
+		} else if pruned != 1 {
+			t.Fatal("unexpected number of pruned slabs", pruned)
+		}
+	}
+	if pruned, err := db.PruneSlabs(ctx, 1); err != nil {
+		t.Fatal(err)
+	} else if pruned != 0 {
+		t.Fatal("unexpected number of pruned slabs", pruned)
+	}
+
+	// assert the sectors were deleted and queued for deletion
+	var n int64
+	if err := db.db.Model(&dbSector{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal("expected sectors to be deleted", n)
+	}
+	deletions, err := db.SectorDeletions(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := make(map[types.FileContractID][]types.Hash256)
+	for _, d := range deletions {
+		roots[d.ContractID] = d.Roots
+	}
+	if len(roots) != 2 {
+		t.Fatal("unexpected deletions", deletions)
+	} else if r := roots[fcids[0]]; len(r) != 2 || r[0] != (types.Hash256{1}) || r[1] != (types.Hash256{3}) {
+		t.Fatal("unexpected roots", r)
+	} else if r := roots[fcids[1]]; len(r) != 1 || r[0] != (types.Hash256{2}) {
+		t.Fatal("unexpected roots", r)
+	}
+
+	// assert the limit is applied and the sectors are returned in the order
+	// they were queued
+	if deletions, err := db.SectorDeletions(ctx, 2); err != nil {
+		t.Fatal(err)
+	} else if len(deletions) != 2 || deletions[0].ContractID != fcids[0] || deletions[1].ContractID != fcids[1] {
+		t.Fatal("unexpected deletions", deletions)
+	} else if len(deletions[0].Roots) != 1 || deletions[0].Roots[0] != (types.Hash256{1}) || len(deletions[1].Roots) != 1 || deletions[1].Roots[0] != (types.Hash256{2}) {
+		t.Fatal("unexpected roots", deletions)
+	}
+
+	// remove the deletions of the first contract
+	if err := db.RemoveSectorDeletions(ctx, fcids[0], roots[fcids[0]]); err != nil {
+		t.Fatal(err)
+	} else if deletions, err := db.SectorDeletions(ctx, -1); err != nil {
+		t.Fatal(err)
+	} else if len(deletions) != 1 || deletions[0].ContractID != fcids[1] {
+		t.Fatal("unexpected deletions", deletions)
+	}
+}
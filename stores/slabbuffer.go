@@ -29,6 +29,10 @@ type SlabBuffer struct {
 	dbMu sync.Mutex
 
 	mu          sync.Mutex
+	complete    bool
+	expiring    bool // set while an expired buffer is marked complete in the db
+	pending     int  // number of appends that weren't written to the db yet
+	created     time.Time
 	file        *os.File
 	lockedUntil time.Time
 	size        int64
@@ -41,6 +45,7 @@ type bufferGroupID [6]byte
 type SlabBufferManager struct {
 	bufferedSlabCompletionThreshold int64
 	dir                             string
+	maxAge                          time.Duration
 	s                               *SQLStore
 
 	mu                sync.Mutex
@@ -49,9 +54,11 @@ type SlabBufferManager struct {
 	buffersByKey      map[string]*SlabBuffer
 }
 
-func newSlabBufferManager(sqlStore *SQLStore, slabBufferCompletionThreshold int64, partialSlabDir string) (*SlabBufferManager, error) {
+func newSlabBufferManager(sqlStore *SQLStore, slabBufferCompletionThreshold int64, slabBufferMaxAge time.Duration, partialSlabDir string) (*SlabBufferManager, error) {
 	if slabBufferCompletionThreshold < 0 || slabBufferCompletionThreshold > 1<<22 {
 		return nil, fmt.Errorf("invalid slabBufferCompletionThreshold %v", slabBufferCompletionThreshold)
+	} else if slabBufferMaxAge < 0 {
+		return nil, fmt.Errorf("invalid slabBufferMaxAge %v", slabBufferMaxAge)
 	}
 
 	// load existing buffers
@@ -66,6 +73,7 @@ func newSlabBufferManager(sqlStore *SQLStore, slabBufferCompletionThreshold int6
 	mgr := &SlabBufferManager{
 		bufferedSlabCompletionThreshold: slabBufferCompletionThreshold,
 		dir:                             partialSlabDir,
+		maxAge:                          slabBufferMaxAge,
 		s:                               sqlStore,
 		completeBuffers:                 make(map[bufferGroupID][]*SlabBuffer),
 		incompleteBuffers:               make(map[bufferGroupID][]*SlabBuffer),
@@ -110,6 +118,8 @@ func newSlabBufferManager(sqlStore *SQLStore, slabBufferCompletionThreshold int6
 			filename: buffer.Filename,
 			slabKey:  ec,
 			maxSize:  int64(bufferedSlabSize(buffer.DBSlab.MinShards)),
+			complete: buffer.Complete,
+			created:  buffer.CreatedAt,
 			file:     file,
 			dbSize:   buffer.Size,
 			size:     buffer.Size,
@@ -174,6 +184,15 @@ func (mgr *SlabBufferManager) AddPartialSlab(ctx context.Context, data []byte, m
 	var slabs []object.PartialSlab
 	var err error
 	var usedBuffers []*SlabBuffer
+
+	// Once we're done, release the buffers we appended to, that way they can
+	// expire again.
+	defer func() {
+		for _, buffer := range usedBuffers {
+			buffer.releaseAppend()
+		}
+	}()
+
 	for _, buffer := range buffers {
 		var used bool
 		slab, data, used, err = buffer.recordAppend(data)
@@ -348,8 +367,13 @@ func (mgr *SlabBufferManager) SlabBuffers() (sbs []api.SlabBuffer) {
 }
 
 func (mgr *SlabBufferManager) SlabsForUpload(ctx context.Context, lockingDuration time.Duration, minShards, totalShards uint8, set uint, limit int) (slabs []api.PackedSlab, _ error) {
+	gid := bufferGID(minShards, totalShards, uint32(set))
+	if err := mgr.flushExpiredBuffers(ctx, gid); err != nil {
+		return nil, err
+	}
+
 	mgr.mu.Lock()
-	buffers := mgr.completeBuffers[bufferGID(minShards, totalShards, uint32(set))]
+	buffers := mgr.completeBuffers[gid]
 	mgr.mu.Unlock()
 
 	for _, buffer := range buffers {
@@ -384,6 +408,38 @@ func (mgr *SlabBufferManager) SlabsForUpload(ctx context.Context, lockingDuratio
 	return slabs, nil
 }
 
+// flushExpiredBuffers marks the incomplete buffers of the given group that
+// exceeded the max age as complete, that way small uploads don't linger in a
+// buffer forever when no further data is uploaded to fill it up.
+func (mgr *SlabBufferManager) flushExpiredBuffers(ctx context.Context, gid bufferGroupID) error {
+	if mgr.maxAge == 0 {
+		return nil
+	}
+
+	mgr.mu.Lock()
+	buffers := append([]*SlabBuffer{}, mgr.incompleteBuffers[gid]...)
+	mgr.mu.Unlock()
+
+	for _, buffer := range buffers {
+		if !buffer.tryExpire(mgr.maxAge) {
+			continue
+		}
+		err := mgr.s.retryTransaction(func(tx *gorm.DB) error {
+			return tx.WithContext(ctx).
+				Model(&dbBufferedSlab{}).
+				Where("id", buffer.dbID).
+				Update("complete", true).
+				Error
+		})
+		buffer.finishExpire(err == nil)
+		if err != nil {
+			return fmt.Errorf("failed to mark buffered slab %v as complete: %w", buffer.dbID, err)
+		}
+		mgr.markBufferComplete(buffer, gid)
+	}
+	return nil
+}
+
 func (mgr *SlabBufferManager) RemoveBuffers(fileNames ...string) {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
@@ -424,11 +480,41 @@ func (buf *SlabBuffer) acquireForUpload(lockingDuration time.Duration) bool {
 	return true
 }
 
+// tryExpire returns true if the buffer contains data, is older than the given
+// max age and no appends are in progress. In that case no more data is
+// appended to the buffer until finishExpire is called.
+func (buf *SlabBuffer) tryExpire(maxAge time.Duration) bool {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+	if buf.complete || buf.expiring || buf.pending > 0 || buf.size == 0 || time.Since(buf.created) < maxAge {
+		return false
+	}
+	buf.expiring = true
+	return true
+}
+
+// finishExpire marks an expiring buffer as complete if it was marked complete
+// in the db, otherwise data can be appended to it again.
+func (buf *SlabBuffer) finishExpire(complete bool) {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+	buf.expiring = false
+	buf.complete = buf.complete || complete
+}
+
+// releaseAppend is called once an append that was recorded successfully was
+// written to the db or failed to be.
+func (buf *SlabBuffer) releaseAppend() {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+	buf.pending--
+}
+
 func (buf *SlabBuffer) recordAppend(data []byte) (object.PartialSlab, []byte, bool, error) {
 	buf.mu.Lock()
 	defer buf.mu.Unlock()
 	remainingSpace := buf.maxSize - buf.size
-	if remainingSpace == 0 {
+	if remainingSpace == 0 || buf.complete || buf.expiring {
 		return object.PartialSlab{}, data, false, nil
 	} else if int64(len(data)) <= remainingSpace {
 		_, err := buf.file.WriteAt(data, buf.size)
@@ -441,6 +527,7 @@ func (buf *SlabBuffer) recordAppend(data []byte) (object.PartialSlab, []byte, bo
 			Length: uint32(len(data)),
 		}
 		buf.size += int64(len(data))
+		buf.pending++
 		return slab, nil, true, nil
 	} else {
 		_, err := buf.file.WriteAt(data[:remainingSpace], buf.size)
@@ -453,6 +540,7 @@ func (buf *SlabBuffer) recordAppend(data []byte) (object.PartialSlab, []byte, bo
 			Length: uint32(remainingSpace),
 		}
 		buf.size += remainingSpace
+		buf.pending++
 		return slab, data[remainingSpace:], true, nil
 	}
 }
@@ -474,7 +562,10 @@ func (buf *SlabBuffer) commitAppend(completionThreshold int64) (int64, bool, err
 	buf.mu.Lock()
 	defer buf.mu.Unlock()
 	buf.syncErr = err
-	return syncSize, syncSize >= buf.maxSize-completionThreshold, err
+	if syncSize >= buf.maxSize-completionThreshold {
+		buf.complete = true
+	}
+	return syncSize, buf.complete, err
 }
 
 func (buf *SlabBuffer) requiresDBUpdate() bool {
@@ -494,13 +585,11 @@ func (buf *SlabBuffer) updateDBSize(size int64) {
 func (mgr *SlabBufferManager) markBufferComplete(buffer *SlabBuffer, gid bufferGroupID) {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
-	if _, exists := mgr.incompleteBuffers[gid]; exists {
-		mgr.completeBuffers[gid] = append(mgr.completeBuffers[gid], buffer)
-		for i := range mgr.incompleteBuffers[gid] {
-			if mgr.incompleteBuffers[gid][i] == buffer {
-				mgr.incompleteBuffers[gid] = append(mgr.incompleteBuffers[gid][:i], mgr.incompleteBuffers[gid][i+1:]...)
-				break
-			}
+	for i := range mgr.incompleteBuffers[gid] {
+		if mgr.incompleteBuffers[gid][i] == buffer {
+			mgr.incompleteBuffers[gid] = append(mgr.incompleteBuffers[gid][:i], mgr.incompleteBuffers[gid][i+1:]...)
+			mgr.completeBuffers[gid] = append(mgr.completeBuffers[gid], buffer)
+			break
 		}
 	}
 }
@@ -536,6 +625,7 @@ func createSlabBuffer(tx *gorm.DB, contractSetID uint, dir string, minShards, to
 		filename: fileName,
 		slabKey:  ec,
 		maxSize:  int64(bufferedSlabSize(minShards)),
+		created:  createdSlab.CreatedAt,
 		file:     file,
 	}, err
 }
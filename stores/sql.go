@@ -8,6 +8,7 @@ import (
 	"os"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.sia.tech/core/types"
@@ -55,13 +56,20 @@ type (
 		unappliedProofs        map[types.FileContractID]uint64
 		unappliedOutputChanges []outputChange
 		unappliedTxnChanges    []txnChange
+		unappliedChangeLinks   map[types.Address]types.FileContractID
+		unappliedChangeAddrs   []dbChangeAddress
 
 		// SettingsDB related fields.
 		settingsMu sync.Mutex
 		settings   map[string]string
 
 		// WalletDB related fields.
-		walletAddress types.Address
+		walletAddress       types.Address
+		deriveChangeAddress func(index uint64) types.Address
+		walletMu            sync.Mutex
+		changeAddresses     map[types.Address]uint64
+		changeLookahead     map[types.Address]uint64
+		nextChangeIndex     uint64
 
 		// Consensus related fields.
 		ccid       modules.ConsensusChangeID
@@ -77,6 +85,15 @@ type (
 		spendingMu     sync.Mutex
 		interactionsMu sync.Mutex
 		objectsMu      sync.Mutex
+
+		// bucketUsage caches the number of bytes stored in buckets that
+		// have a quota.
+		bucketUsageMu sync.Mutex
+		bucketUsage   map[string]bucketUsage
+
+		// txnsInFlight is the number of transactions currently being
+		// executed through retryTransaction.
+		txnsInFlight atomic.Int64
 	}
 
 	revisionUpdate struct {
@@ -127,7 +144,7 @@ func DBConfigFromEnv() (uri, user, password, dbName string) {
 // NewSQLStore uses a given Dialector to connect to a SQL database.  NOTE: Only
 // pass migrate=true for the first instance of SQLHostDB if you connect via the
 // same Dialector multiple times.
-func NewSQLStore(conn gorm.Dialector, alerts alerts.Alerter, partialSlabDir string, migrate bool, persistInterval time.Duration, walletAddress types.Address, slabBufferCompletionThreshold int64, logger *zap.SugaredLogger, gormLogger glogger.Interface) (*SQLStore, modules.ConsensusChangeID, error) {
+func NewSQLStore(conn gorm.Dialector, alerts alerts.Alerter, partialSlabDir string, migrate bool, persistInterval time.Duration, walletAddress types.Address, deriveChangeAddress func(index uint64) types.Address, slabBufferCompletionThreshold int64, slabBufferMaxAge time.Duration, logger *zap.SugaredLogger, gormLogger glogger.Interface) (*SQLStore, modules.ConsensusChangeID, error) {
 	if err := os.MkdirAll(partialSlabDir, 0700); err != nil {
 		return nil, modules.ConsensusChangeID{}, fmt.Errorf("failed to create partial slab dir: %v", err)
 	}
@@ -188,6 +205,22 @@ func NewSQLStore(conn gorm.Dialector, alerts alerts.Alerter, partialSlabDir stri
 		isOurContract[types.FileContractID(fcid)] = struct{}{}
 	}
 
+	// Fetch the change addresses derived by the wallet.
+	var changeAddrs []dbChangeAddress
+	if err := db.Model(&dbChangeAddress{}).
+		Select("address, key_index").
+		Find(&changeAddrs).Error; err != nil {
+		return nil, modules.ConsensusChangeID{}, err
+	}
+	changeAddresses := make(map[types.Address]uint64)
+	nextChangeIndex := uint64(1)
+	for _, ca := range changeAddrs {
+		changeAddresses[types.Address(ca.Address)] = ca.KeyIndex
+		if ca.KeyIndex >= nextChangeIndex {
+			nextChangeIndex = ca.KeyIndex + 1
+		}
+	}
+
 	ss := &SQLStore{
 		alerts:             alerts,
 		db:                 db,
@@ -198,18 +231,29 @@ func NewSQLStore(conn gorm.Dialector, alerts alerts.Alerter, partialSlabDir stri
 		hasAllowlist:       allowlistCnt > 0,
 		hasBlocklist:       blocklistCnt > 0,
 		settings:           make(map[string]string),
+		bucketUsage:        make(map[string]bucketUsage),
 		unappliedHostKeys:  make(map[types.PublicKey]struct{}),
 		unappliedRevisions: make(map[types.FileContractID]revisionUpdate),
 		unappliedProofs:    make(map[types.FileContractID]uint64),
 
-		walletAddress: walletAddress,
+		unappliedChangeLinks: make(map[types.Address]types.FileContractID),
+
+		walletAddress:       walletAddress,
+		deriveChangeAddress: deriveChangeAddress,
+		changeAddresses:     changeAddresses,
+		changeLookahead:     make(map[types.Address]uint64),
+		nextChangeIndex:     nextChangeIndex,
 		chainIndex: types.ChainIndex{
 			Height: ci.Height,
 			ID:     types.BlockID(ci.BlockID),
 		},
 	}
 
-	ss.slabBufferMgr, err = newSlabBufferManager(ss, slabBufferCompletionThreshold, partialSlabDir)
+	ss.walletMu.Lock()
+	ss.extendChangeLookahead()
+	ss.walletMu.Unlock()
+
+	ss.slabBufferMgr, err = newSlabBufferManager(ss, slabBufferCompletionThreshold, slabBufferMaxAge, partialSlabDir)
 	if err != nil {
 		return nil, modules.ConsensusChangeID{}, err
 	}
@@ -339,7 +383,8 @@ func (ss *SQLStore) applyUpdates(force bool) (err error) {
 	softLimitReached := len(ss.unappliedAnnouncements) >= announcementBatchSoftLimit                // enough announcements have accumulated
 	unappliedRevisionsOrProofs := len(ss.unappliedRevisions) > 0 || len(ss.unappliedProofs) > 0     // enough revisions/proofs have accumulated
 	unappliedOutputsOrTxns := len(ss.unappliedOutputChanges) > 0 || len(ss.unappliedTxnChanges) > 0 // enough outputs/txns have accumualted
-	if !force && !persistIntervalPassed && !softLimitReached && !unappliedRevisionsOrProofs && !unappliedOutputsOrTxns {
+	unappliedChangeAddrs := len(ss.unappliedChangeLinks) > 0 || len(ss.unappliedChangeAddrs) > 0    // change addresses were found or used to form contracts
+	if !force && !persistIntervalPassed && !softLimitReached && !unappliedRevisionsOrProofs && !unappliedOutputsOrTxns && !unappliedChangeAddrs {
 		return nil
 	}
 
@@ -384,6 +429,9 @@ func (ss *SQLStore) applyUpdates(force bool) (err error) {
 				return fmt.Errorf("%w; failed to update proof height", err)
 			}
 		}
+		if err := recordMissedProofs(tx, ss.chainIndex.Height); err != nil {
+			return fmt.Errorf("%w; failed to record missed proofs", err)
+		}
 		for _, oc := range ss.unappliedOutputChanges {
 			if oc.addition {
 				err = applyUnappliedOutputAdditions(tx, oc.sco)
@@ -404,6 +452,16 @@ func (ss *SQLStore) applyUpdates(force bool) (err error) {
 				return fmt.Errorf("%w; failed to apply unapplied txn change", err)
 			}
 		}
+		if len(ss.unappliedChangeAddrs) > 0 {
+			if err := insertChangeAddresses(tx, ss.unappliedChangeAddrs); err != nil {
+				return fmt.Errorf("%w; failed to insert change addresses", err)
+			}
+		}
+		for addr, fcid := range ss.unappliedChangeLinks {
+			if err := applyChangeAddressLink(tx, addr, fcid); err != nil {
+				return fmt.Errorf("%w; failed to link change address to contract", err)
+			}
+		}
 		return updateCCID(tx, ss.ccid, ss.chainIndex)
 	})
 
@@ -414,6 +472,8 @@ func (ss *SQLStore) applyUpdates(force bool) (err error) {
 	ss.lastSave = time.Now()
 	ss.unappliedOutputChanges = nil
 	ss.unappliedTxnChanges = nil
+	ss.unappliedChangeLinks = make(map[types.Address]types.FileContractID)
+	ss.unappliedChangeAddrs = nil
 	return
 }
 
@@ -427,6 +487,8 @@ func (s *SQLStore) retryTransaction(fc func(tx *gorm.DB) error, opts ...*sql.TxO
 			errors.Is(err, api.ErrBucketExists) ||
 			errors.Is(err, api.ErrBucketNotFound) ||
 			errors.Is(err, api.ErrBucketNotEmpty) ||
+			errors.Is(err, api.ErrBucketQuotaExceeded) ||
+			errors.Is(err, api.ErrObjectTooLarge) ||
 			errors.Is(err, api.ErrContractNotFound) ||
 			errors.Is(err, api.ErrMultipartUploadNotFound) ||
 			errors.Is(err, api.ErrPartNotFound) {
@@ -436,6 +498,8 @@ func (s *SQLStore) retryTransaction(fc func(tx *gorm.DB) error, opts ...*sql.TxO
 	}
 	var err error
 	timeoutIntervals := []time.Duration{200 * time.Millisecond, 500 * time.Millisecond, time.Second, 3 * time.Second, 10 * time.Second, 10 * time.Second}
+	s.txnsInFlight.Add(1)
+	defer s.txnsInFlight.Add(-1)
 	for i := 0; i < len(timeoutIntervals); i++ {
 		err = s.db.Transaction(fc, opts...)
 		if abortRetry(err) {
@@ -12,7 +12,10 @@ import (
 
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/alerts"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/wallet"
 	"go.sia.tech/siad/modules"
+	stypes "go.sia.tech/siad/types"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gorm.io/gorm/logger"
@@ -26,13 +29,18 @@ const (
 	testETag            = "d34db33f"
 )
 
+var testMetadata = api.ObjectUserMetadata{
+	"foo": "bar",
+	"baz": "qux",
+}
+
 // newTestSQLStore creates a new SQLStore for testing.
 func newTestSQLStore(dir string) (*SQLStore, string, modules.ConsensusChangeID, error) {
 	dbName := hex.EncodeToString(frand.Bytes(32)) // random name for db
 	conn := NewEphemeralSQLiteConnection(dbName)
 	walletAddrs := types.Address(frand.Entropy256())
 	alerts := alerts.WithOrigin(alerts.NewManager(), "test")
-	sqlStore, ccid, err := NewSQLStore(conn, alerts, dir, true, time.Second, walletAddrs, 0, zap.NewNop().Sugar(), newTestLogger())
+	sqlStore, ccid, err := NewSQLStore(conn, alerts, dir, true, time.Second, walletAddrs, nil, 0, 0, zap.NewNop().Sugar(), newTestLogger())
 	if err != nil {
 		return nil, "", modules.ConsensusChangeID{}, err
 	}
@@ -171,3 +179,137 @@ func TestQueryPlan(t *testing.T) {
 		}
 	}
 }
+
+// TestChangeAddresses asserts change addresses are persisted, considered part
+// of the wallet and linked to the contract they funded.
+func TestChangeAddresses(t *testing.T) {
+	dir := t.TempDir()
+	db, dbName, _, err := newTestSQLStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add two change addresses
+	hk := types.PublicKey{1}
+	addr1, addr2 := types.Address{1}, types.Address{2}
+	for i, addr := range []types.Address{addr1, addr2} {
+		if err := db.AddChangeAddress(wallet.ChangeAddress{Address: addr, Index: uint64(i + 1), HostKey: hk}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !db.isWalletAddress(addr1) || !db.isWalletAddress(addr2) || !db.isWalletAddress(db.walletAddress) {
+		t.Fatal("expected addresses to be part of the wallet")
+	} else if db.isWalletAddress(types.Address{3}) {
+		t.Fatal("unexpected wallet address")
+	}
+
+	// link the first address to a contract
+	fcid := types.FileContractID{1}
+	db.persistMu.Lock()
+	db.unappliedChangeLinks[addr1] = fcid
+	err = db.applyUpdates(true)
+	db.persistMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := db.ChangeAddresses()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(addrs) != 2 {
+		t.Fatalf("unexpected number of change addresses, %v != 2", len(addrs))
+	} else if addrs[0].Address != addr1 || addrs[0].Index != 1 || addrs[0].HostKey != hk || addrs[0].ContractID != fcid {
+		t.Fatal("unexpected change address", addrs[0])
+	} else if addrs[1].Address != addr2 || addrs[1].ContractID != (types.FileContractID{}) {
+		t.Fatal("unexpected change address", addrs[1])
+	}
+
+	// restart the store and assert the change addresses are still known
+	if err := db.slabBufferMgr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db2, _, err := NewSQLStore(NewEphemeralSQLiteConnection(dbName), alerts.NewManager(), dir, false, time.Hour, types.Address{}, nil, 0, 0, zap.NewNop().Sugar(), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+	if !db2.isWalletAddress(addr1) || !db2.isWalletAddress(addr2) {
+		t.Fatal("expected change addresses to be loaded")
+	}
+}
+
+// TestChangeAddressLookahead asserts outputs sent to change addresses that
+// aren't known yet are found, which is the case after losing the database.
+func TestChangeAddressLookahead(t *testing.T) {
+	dir := t.TempDir()
+	dbName := hex.EncodeToString(frand.Bytes(32))
+	derive := func(index uint64) types.Address {
+		return types.Address(types.HashBytes(append([]byte("change"), byte(index), byte(index>>8))))
+	}
+	db, _, err := NewSQLStore(NewEphemeralSQLiteConnection(dbName), alerts.NewManager(), dir, true, time.Hour, types.Address{}, derive, 0, 0, zap.NewNop().Sugar(), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert indices are reserved
+	if index := db.NextChangeAddressIndex(); index != 1 {
+		t.Fatal("unexpected index", index)
+	} else if index := db.NextChangeAddressIndex(); index != 2 {
+		t.Fatal("unexpected index", index)
+	}
+
+	// receive outputs on a change address outside of the gap limit and one
+	// within it
+	found, missed := derive(50), derive(3+changeAddressGapLimit)
+	var cc modules.ConsensusChange
+	for i, addr := range []types.Address{missed, found} {
+		cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, modules.SiacoinOutputDiff{
+			Direction:     modules.DiffApply,
+			ID:            stypes.SiacoinOutputID{byte(i)},
+			SiacoinOutput: stypes.SiacoinOutput{Value: stypes.SiacoinPrecision, UnlockHash: stypes.UnlockHash(addr)},
+		})
+	}
+	db.persistMu.Lock()
+	db.processConsensusChangeWallet(cc)
+	err = db.applyUpdates(true)
+	db.persistMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if index, ok := db.ChangeAddressIndex(found); !ok || index != 50 {
+		t.Fatal("expected change address to be found", index, ok)
+	} else if db.isWalletAddress(missed) {
+		t.Fatal("unexpected wallet address")
+	} else if utxos, err := db.UnspentSiacoinElements(false); err != nil {
+		t.Fatal(err)
+	} else if len(utxos) != 1 || utxos[0].Address != found {
+		t.Fatal("unexpected utxos", utxos)
+	}
+
+	// assert found addresses aren't reused and extend the lookahead
+	if index := db.NextChangeAddressIndex(); index != 51 {
+		t.Fatal("unexpected index", index)
+	}
+	db.persistMu.Lock()
+	db.processConsensusChangeWallet(cc)
+	db.persistMu.Unlock()
+	if !db.isWalletAddress(missed) {
+		t.Fatal("expected change address to be found")
+	}
+
+	// restart the store and assert the found address was persisted
+	if err := db.slabBufferMgr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db2, _, err := NewSQLStore(NewEphemeralSQLiteConnection(dbName), alerts.NewManager(), dir, false, time.Hour, types.Address{}, derive, 0, 0, zap.NewNop().Sugar(), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+	if index, ok := db2.ChangeAddressIndex(found); !ok || index != 50 {
+		t.Fatal("expected change address to be loaded", index, ok)
+	} else if index := db2.NextChangeAddressIndex(); index != 51 {
+		t.Fatal("unexpected index", index)
+	}
+}
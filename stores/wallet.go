@@ -10,8 +10,13 @@ import (
 	"go.sia.tech/renterd/wallet"
 	"go.sia.tech/siad/modules"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// changeAddressGapLimit is the number of change addresses following the ones
+// in use that we watch for outputs.
+const changeAddressGapLimit = 100
+
 type (
 	dbSiacoinElement struct {
 		Model
@@ -32,6 +37,14 @@ type (
 		Timestamp     int64
 	}
 
+	dbChangeAddress struct {
+		Model
+		Address    hash256        `gorm:"unique;index;NOT NULL;size:32"`
+		KeyIndex   uint64         `gorm:"unique;NOT NULL"`
+		HostKey    publicKey      `gorm:"index;NOT NULL;size:32"`
+		ContractID fileContractID `gorm:"index;size:32"`
+	}
+
 	outputChange struct {
 		addition bool
 		oid      hash256
@@ -51,6 +64,9 @@ func (dbSiacoinElement) TableName() string { return "siacoin_elements" }
 // TableName implements the gorm.Tabler interface.
 func (dbTransaction) TableName() string { return "transactions" }
 
+// TableName implements the gorm.Tabler interface.
+func (dbChangeAddress) TableName() string { return "wallet_change_addresses" }
+
 func (s *SQLStore) Height() uint64 {
 	s.persistMu.Lock()
 	height := s.chainIndex.Height
@@ -125,13 +141,147 @@ func (s *SQLStore) Transactions(before, since time.Time, offset, limit int) ([]w
 	return txns, nil
 }
 
+// AddChangeAddress implements wallet.SingleAddressStore.
+func (s *SQLStore) AddChangeAddress(ca wallet.ChangeAddress) error {
+	err := s.retryTransaction(func(tx *gorm.DB) error {
+		return tx.Create(&dbChangeAddress{
+			Address:    hash256(ca.Address),
+			KeyIndex:   ca.Index,
+			HostKey:    publicKey(ca.HostKey),
+			ContractID: fileContractID(ca.ContractID),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.walletMu.Lock()
+	s.changeAddresses[ca.Address] = ca.Index
+	delete(s.changeLookahead, ca.Address)
+	if ca.Index >= s.nextChangeIndex {
+		s.nextChangeIndex = ca.Index + 1
+	}
+	s.extendChangeLookahead()
+	s.walletMu.Unlock()
+	return nil
+}
+
+// ChangeAddresses implements wallet.SingleAddressStore.
+func (s *SQLStore) ChangeAddresses() ([]wallet.ChangeAddress, error) {
+	var dbAddrs []dbChangeAddress
+	if err := s.db.Order("key_index ASC").Find(&dbAddrs).Error; err != nil {
+		return nil, err
+	}
+	addrs := make([]wallet.ChangeAddress, len(dbAddrs))
+	for i, a := range dbAddrs {
+		addrs[i] = wallet.ChangeAddress{
+			Address:    types.Address(a.Address),
+			Index:      a.KeyIndex,
+			HostKey:    types.PublicKey(a.HostKey),
+			ContractID: types.FileContractID(a.ContractID),
+			CreatedAt:  a.CreatedAt.UTC(),
+		}
+	}
+	return addrs, nil
+}
+
+// NextChangeAddressIndex implements wallet.SingleAddressStore. It reserves the
+// returned index, that way concurrent formations never derive the same change
+// address.
+func (s *SQLStore) NextChangeAddressIndex() uint64 {
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+	index := s.nextChangeIndex
+	s.nextChangeIndex++
+	s.extendChangeLookahead()
+	return index
+}
+
+// extendChangeLookahead derives the change addresses that follow the highest
+// index in use, up to the gap limit. Outputs sent to those addresses are picked
+// up while processing consensus changes, which allows recovering the change of
+// formations after losing the database. The caller must hold walletMu.
+func (s *SQLStore) extendChangeLookahead() {
+	if s.deriveChangeAddress == nil {
+		return
+	}
+	var start uint64
+	for _, index := range s.changeLookahead {
+		if index > start {
+			start = index
+		}
+	}
+	if start < s.nextChangeIndex {
+		start = s.nextChangeIndex - 1
+	}
+	for index := start + 1; index < s.nextChangeIndex+changeAddressGapLimit; index++ {
+		s.changeLookahead[s.deriveChangeAddress(index)] = index
+	}
+	for addr, index := range s.changeLookahead {
+		if index < s.nextChangeIndex {
+			delete(s.changeLookahead, addr)
+		}
+	}
+}
+
+// discoverChangeAddress adds the given address to the known change addresses
+// if it's one of the addresses in the lookahead. Discovered addresses are
+// persisted alongside the next batch of updates.
+func (s *SQLStore) discoverChangeAddress(addr types.Address) {
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+	index, ok := s.changeLookahead[addr]
+	if !ok {
+		return
+	}
+	s.changeAddresses[addr] = index
+	delete(s.changeLookahead, addr)
+	if index >= s.nextChangeIndex {
+		s.nextChangeIndex = index + 1
+	}
+	s.extendChangeLookahead()
+	s.unappliedChangeAddrs = append(s.unappliedChangeAddrs, dbChangeAddress{
+		Address:  hash256(addr),
+		KeyIndex: index,
+	})
+}
+
+// ChangeAddressIndex implements wallet.SingleAddressStore.
+func (s *SQLStore) ChangeAddressIndex(addr types.Address) (uint64, bool) {
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+	index, ok := s.changeAddresses[addr]
+	return index, ok
+}
+
+// isChangeAddress returns true if the given address is one of the change
+// addresses derived by the wallet.
+func (s *SQLStore) isChangeAddress(addr types.Address) bool {
+	_, ok := s.ChangeAddressIndex(addr)
+	return ok
+}
+
+// isWalletAddress returns true if the given address is controlled by the
+// wallet, which is the case for its primary address and all change addresses.
+func (s *SQLStore) isWalletAddress(addr types.Address) bool {
+	return addr == s.walletAddress || s.isChangeAddress(addr)
+}
+
 // ProcessConsensusChange implements chain.Subscriber.
 func (s *SQLStore) processConsensusChangeWallet(cc modules.ConsensusChange) {
+	// Discover change addresses that received outputs, this is necessary to
+	// recover the wallet's change after losing the database.
+	for _, diff := range cc.SiacoinOutputDiffs {
+		if diff.Direction == modules.DiffApply {
+			s.discoverChangeAddress(types.Address(diff.SiacoinOutput.UnlockHash))
+		}
+	}
+
 	// Add/Remove siacoin outputs.
 	for _, diff := range cc.SiacoinOutputDiffs {
 		var sco types.SiacoinOutput
 		convertToCore(diff.SiacoinOutput, &sco)
-		if sco.Address != s.walletAddress {
+		if !s.isWalletAddress(sco.Address) {
 			continue
 		}
 		if diff.Direction == modules.DiffApply {
@@ -162,7 +312,7 @@ func (s *SQLStore) processConsensusChangeWallet(cc modules.ConsensusChange) {
 			// output has matured -- add a payout transaction.
 			if dsco.Direction != modules.DiffRevert {
 				continue
-			} else if types.Address(dsco.SiacoinOutput.UnlockHash) != s.walletAddress {
+			} else if !s.isWalletAddress(types.Address(dsco.SiacoinOutput.UnlockHash)) {
 				continue
 			}
 			var sco types.SiacoinOutput
@@ -185,7 +335,7 @@ func (s *SQLStore) processConsensusChangeWallet(cc modules.ConsensusChange) {
 		for _, stxn := range block.Transactions {
 			var txn types.Transaction
 			convertToCore(stxn, &txn)
-			if transactionIsRelevant(txn, s.walletAddress) {
+			if transactionIsRelevant(txn, s.isWalletAddress) {
 				// remove reverted txns
 				s.unappliedTxnChanges = append(s.unappliedTxnChanges, txnChange{
 					addition: false,
@@ -221,15 +371,20 @@ func (s *SQLStore) processConsensusChangeWallet(cc modules.ConsensusChange) {
 		for _, stxn := range block.Transactions {
 			var txn types.Transaction
 			convertToCore(stxn, &txn)
-			if transactionIsRelevant(txn, s.walletAddress) {
+			if transactionIsRelevant(txn, s.isWalletAddress) {
 				var inflow, outflow types.Currency
 				for _, out := range txn.SiacoinOutputs {
-					if out.Address == s.walletAddress {
+					if s.isWalletAddress(out.Address) {
 						inflow = inflow.Add(out.Value)
 					}
+
+					// link change addresses to the contract they funded
+					if len(txn.FileContracts) > 0 && s.isChangeAddress(out.Address) {
+						s.unappliedChangeLinks[out.Address] = txn.FileContractID(0)
+					}
 				}
 				for _, in := range txn.SiacoinInputs {
-					if in.UnlockConditions.UnlockHash() == s.walletAddress {
+					if s.isWalletAddress(in.UnlockConditions.UnlockHash()) {
 						so, ok := spentOutputs[in.ParentID]
 						if !ok {
 							panic("spent output not found")
@@ -257,50 +412,50 @@ func (s *SQLStore) processConsensusChangeWallet(cc modules.ConsensusChange) {
 	}
 }
 
-func transactionIsRelevant(txn types.Transaction, addr types.Address) bool {
+func transactionIsRelevant(txn types.Transaction, isWalletAddress func(types.Address) bool) bool {
 	for i := range txn.SiacoinInputs {
-		if txn.SiacoinInputs[i].UnlockConditions.UnlockHash() == addr {
+		if isWalletAddress(txn.SiacoinInputs[i].UnlockConditions.UnlockHash()) {
 			return true
 		}
 	}
 	for i := range txn.SiacoinOutputs {
-		if txn.SiacoinOutputs[i].Address == addr {
+		if isWalletAddress(txn.SiacoinOutputs[i].Address) {
 			return true
 		}
 	}
 	for i := range txn.SiafundInputs {
-		if txn.SiafundInputs[i].UnlockConditions.UnlockHash() == addr {
+		if isWalletAddress(txn.SiafundInputs[i].UnlockConditions.UnlockHash()) {
 			return true
 		}
-		if txn.SiafundInputs[i].ClaimAddress == addr {
+		if isWalletAddress(txn.SiafundInputs[i].ClaimAddress) {
 			return true
 		}
 	}
 	for i := range txn.SiafundOutputs {
-		if txn.SiafundOutputs[i].Address == addr {
+		if isWalletAddress(txn.SiafundOutputs[i].Address) {
 			return true
 		}
 	}
 	for i := range txn.FileContracts {
 		for _, sco := range txn.FileContracts[i].ValidProofOutputs {
-			if sco.Address == addr {
+			if isWalletAddress(sco.Address) {
 				return true
 			}
 		}
 		for _, sco := range txn.FileContracts[i].MissedProofOutputs {
-			if sco.Address == addr {
+			if isWalletAddress(sco.Address) {
 				return true
 			}
 		}
 	}
 	for i := range txn.FileContractRevisions {
 		for _, sco := range txn.FileContractRevisions[i].ValidProofOutputs {
-			if sco.Address == addr {
+			if isWalletAddress(sco.Address) {
 				return true
 			}
 		}
 		for _, sco := range txn.FileContractRevisions[i].MissedProofOutputs {
-			if sco.Address == addr {
+			if isWalletAddress(sco.Address) {
 				return true
 			}
 		}
@@ -337,3 +492,16 @@ func applyUnappliedTxnRemovals(tx *gorm.DB, txnID hash256) error {
 		Delete(&dbTransaction{}).
 		Error
 }
+
+func insertChangeAddresses(tx *gorm.DB, addrs []dbChangeAddress) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&addrs).
+		Error
+}
+
+func applyChangeAddressLink(tx *gorm.DB, addr types.Address, fcid types.FileContractID) error {
+	return tx.Model(&dbChangeAddress{}).
+		Where("address", hash256(addr)).
+		Update("contract_id", fileContractID(fcid)).
+		Error
+}
@@ -10,9 +10,13 @@ type (
 	dbWebhook struct {
 		Model
 
-		Module string `gorm:"uniqueIndex:idx_module_event_url;NOT NULL;size:255"`
-		Event  string `gorm:"uniqueIndex:idx_module_event_url;NOT NULL;size:255"`
-		URL    string `gorm:"uniqueIndex:idx_module_event_url;NOT NULL;size:255"`
+		Module      string `gorm:"uniqueIndex:idx_module_event_url;NOT NULL;size:32"`
+		Event       string `gorm:"uniqueIndex:idx_module_event_url;NOT NULL;size:32"`
+		URL         string `gorm:"uniqueIndex:idx_module_event_url;NOT NULL;size:255"`
+		Secret      string `gorm:"size:255"`
+		MinSeverity string `gorm:"size:32"`
+		Bucket      string `gorm:"uniqueIndex:idx_module_event_url;NOT NULL;default:'';size:255"`
+		Prefix      string `gorm:"uniqueIndex:idx_module_event_url;NOT NULL;default:'';size:191"`
 	}
 )
 
@@ -22,8 +26,8 @@ func (dbWebhook) TableName() string {
 
 func (s *SQLStore) DeleteWebhook(wb webhooks.Webhook) error {
 	return s.retryTransaction(func(tx *gorm.DB) error {
-		res := tx.Exec("DELETE FROM webhooks WHERE module = ? AND event = ? AND url = ?",
-			wb.Module, wb.Event, wb.URL)
+		res := tx.Exec("DELETE FROM webhooks WHERE module = ? AND event = ? AND url = ? AND bucket = ? AND prefix = ?",
+			wb.Module, wb.Event, wb.URL, wb.Bucket, wb.Prefix)
 		if res.Error != nil {
 			return res.Error
 		} else if res.RowsAffected == 0 {
@@ -36,11 +40,16 @@ func (s *SQLStore) DeleteWebhook(wb webhooks.Webhook) error {
 func (s *SQLStore) AddWebhook(wb webhooks.Webhook) error {
 	return s.retryTransaction(func(tx *gorm.DB) error {
 		return tx.Clauses(clause.OnConflict{
-			DoNothing: true,
+			Columns:   []clause.Column{{Name: "module"}, {Name: "event"}, {Name: "url"}, {Name: "bucket"}, {Name: "prefix"}},
+			DoUpdates: clause.AssignmentColumns([]string{"secret", "min_severity"}),
 		}).Create(&dbWebhook{
-			Module: wb.Module,
-			Event:  wb.Event,
-			URL:    wb.URL,
+			Module:      wb.Module,
+			Event:       wb.Event,
+			URL:         wb.URL,
+			Secret:      wb.Secret,
+			MinSeverity: wb.MinSeverity,
+			Bucket:      wb.Bucket,
+			Prefix:      wb.Prefix,
 		}).Error
 	})
 }
@@ -53,9 +62,13 @@ func (s *SQLStore) Webhooks() ([]webhooks.Webhook, error) {
 	var whs []webhooks.Webhook
 	for _, wb := range dbWebhooks {
 		whs = append(whs, webhooks.Webhook{
-			Module: wb.Module,
-			Event:  wb.Event,
-			URL:    wb.URL,
+			Module:      wb.Module,
+			Event:       wb.Event,
+			URL:         wb.URL,
+			Secret:      wb.Secret,
+			MinSeverity: wb.MinSeverity,
+			Bucket:      wb.Bucket,
+			Prefix:      wb.Prefix,
 		})
 	}
 	return whs, nil
@@ -50,6 +50,50 @@ func TestWebhooks(t *testing.T) {
 		t.Fatal("unexpected webhook", cmp.Diff(whs[0], wh1))
 	}
 
+	// Add it with a secret and a minimum severity. Should update both.
+	wh1.Secret = "secret"
+	wh1.MinSeverity = "critical"
+	if err := db.AddWebhook(wh1); err != nil {
+		t.Fatal(err)
+	}
+	whs, err = db.Webhooks()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(whs) != 1 {
+		t.Fatal("expected 1 webhook")
+	} else if !cmp.Equal(whs[0], wh1) {
+		t.Fatal("unexpected webhook", cmp.Diff(whs[0], wh1))
+	}
+
+	// Add it with a bucket and prefix filter. Should add a separate webhook
+	// that can be updated and deleted on its own.
+	wh3 := wh1
+	wh3.Bucket = "bucket"
+	wh3.Prefix = "/foo/"
+	if err := db.AddWebhook(wh3); err != nil {
+		t.Fatal(err)
+	}
+	wh3.Secret = "other"
+	if err := db.AddWebhook(wh3); err != nil {
+		t.Fatal(err)
+	}
+	whs, err = db.Webhooks()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(whs) != 2 {
+		t.Fatal("expected 2 webhooks", len(whs))
+	} else if !cmp.Equal(whs[0], wh1) {
+		t.Fatal("unexpected webhook", cmp.Diff(whs[0], wh1))
+	} else if !cmp.Equal(whs[1], wh3) {
+		t.Fatal("unexpected webhook", cmp.Diff(whs[1], wh3))
+	} else if err := db.DeleteWebhook(wh3); err != nil {
+		t.Fatal(err)
+	} else if whs, err := db.Webhooks(); err != nil {
+		t.Fatal(err)
+	} else if len(whs) != 1 || !cmp.Equal(whs[0], wh1) {
+		t.Fatal("unexpected webhooks", whs)
+	}
+
 	// Add another.
 	if err := db.AddWebhook(wh2); err != nil {
 		t.Fatal(err)
@@ -7,6 +7,7 @@ import (
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
@@ -20,18 +21,30 @@ import (
 const (
 	service        = "renterd"
 	serviceVersion = "0.1.0"
+
+	// DebugHeader is the header that enables detailed span attributes, such
+	// as slab ids and host keys, for a single request.
+	DebugHeader = "X-Sia-Trace-Debug"
 )
 
 var (
 	Tracer = trace.NewNoopTracerProvider().Tracer("noop")
+
+	// detailedAttributes indicates whether detailed span attributes are
+	// recorded for all spans rather than only for debug requests.
+	detailedAttributes bool
 )
 
+type debugKey struct{}
+
 // Init initialises a new OpenTelemetry Tracer using information from the
 // environment and process. For more information on available environment
 // variables for configuration, check out
 // https://opentelemetry.io/docs/reference/specification/sdk-environment-variables/.
 // https://github.com/open-telemetry/opentelemetry-go/tree/main/exporters/otlp/otlptrace
-func Init(serviceInstanceId string) (func(ctx context.Context) error, error) {
+func Init(serviceInstanceId string, detailed bool) (func(ctx context.Context) error, error) {
+	detailedAttributes = detailed
+
 	// Create resources.
 	resources := resource.NewWithAttributes(
 		semconv.SchemaURL,
@@ -63,8 +76,8 @@ func Init(serviceInstanceId string) (func(ctx context.Context) error, error) {
 	Tracer = otel.Tracer(service)
 
 	// Overwrite the default transport to make sure all requests attach tracing
-	// headers.
-	http.DefaultTransport = otelhttp.NewTransport(http.DefaultTransport)
+	// headers and propagate the debug header.
+	http.DefaultTransport = otelhttp.NewTransport(debugTransport{http.DefaultTransport})
 
 	return provider.Shutdown, nil
 }
@@ -73,7 +86,7 @@ func Init(serviceInstanceId string) (func(ctx context.Context) error, error) {
 func TracedRoutes(component string, routes map[string]jape.Handler) map[string]jape.Handler {
 	adapt := func(route string, h jape.Handler) jape.Handler {
 		return jape.Adapt(func(h http.Handler) http.Handler {
-			return otelhttp.NewHandler(h, fmt.Sprintf("%s: %s", component, route))
+			return otelhttp.NewHandler(debugHandler(h), fmt.Sprintf("%s: %s", component, route))
 		})(h)
 	}
 	for route, handler := range routes {
@@ -81,3 +94,50 @@ func TracedRoutes(component string, routes map[string]jape.Handler) map[string]j
 	}
 	return routes
 }
+
+// WithDebug returns a context that enables detailed span attributes.
+func WithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugKey{}, true)
+}
+
+// IsDebug returns true if detailed span attributes should be recorded for the
+// given context, either because they are enabled by default or because the
+// context belongs to a debug request.
+func IsDebug(ctx context.Context) bool {
+	debug, _ := ctx.Value(debugKey{}).(bool)
+	return detailedAttributes || debug
+}
+
+// SetDetailedAttributes sets the given attributes on the span, but only if
+// detailed attributes are enabled for the given context.
+func SetDetailedAttributes(ctx context.Context, span trace.Span, kv ...attribute.KeyValue) {
+	if IsDebug(ctx) {
+		span.SetAttributes(kv...)
+	}
+}
+
+// debugHandler enables detailed span attributes for requests that carry the
+// debug header.
+func debugHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(DebugHeader) != "" {
+			req = req.WithContext(WithDebug(req.Context()))
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// debugTransport sets the debug header on outgoing requests that are made on
+// behalf of a debug request, enabling deep investigation across components.
+type debugTransport struct {
+	rt http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if debug, _ := req.Context().Value(debugKey{}).(bool); debug && req.Header.Get(DebugHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(DebugHeader, "true")
+	}
+	return t.rt.RoundTrip(req)
+}
@@ -26,6 +26,10 @@ const BytesPerInput = 241
 // cover the requested amount.
 var ErrInsufficientBalance = errors.New("insufficient balance")
 
+// ErrInsufficientOutputs is returned when there aren't enough unused outputs to
+// consolidate into the requested number of outputs.
+var ErrInsufficientOutputs = errors.New("insufficient outputs")
+
 // StandardUnlockConditions returns the standard unlock conditions for a single
 // Ed25519 key.
 func StandardUnlockConditions(pk types.PublicKey) types.UnlockConditions {
@@ -92,8 +96,8 @@ func ExplicitCoveredFields(txn types.Transaction) (cf types.CoveredFields) {
 // A SiacoinElement is a SiacoinOutput along with its ID.
 type SiacoinElement struct {
 	types.SiacoinOutput
-	ID             types.Hash256
-	MaturityHeight uint64
+	ID             types.Hash256 `json:"id"`
+	MaturityHeight uint64        `json:"maturityHeight"`
 }
 
 // A Transaction is an on-chain transaction relevant to a particular wallet,
@@ -107,12 +111,28 @@ type Transaction struct {
 	Timestamp time.Time           `json:"timestamp"`
 }
 
+// A ChangeAddress is an address derived from the wallet's key that receives
+// the change of a single contract formation. Once the formation transaction is
+// confirmed, the address is linked to the contract it funded.
+type ChangeAddress struct {
+	Address    types.Address        `json:"address"`
+	Index      uint64               `json:"index"`
+	HostKey    types.PublicKey      `json:"hostKey"`
+	ContractID types.FileContractID `json:"contractID"`
+	CreatedAt  time.Time            `json:"createdAt"`
+}
+
 // A SingleAddressStore stores the state of a single-address wallet.
 // Implementations are assumed to be thread safe.
 type SingleAddressStore interface {
 	Height() uint64
 	UnspentSiacoinElements(matured bool) ([]SiacoinElement, error)
 	Transactions(before, since time.Time, offset, limit int) ([]Transaction, error)
+
+	AddChangeAddress(ca ChangeAddress) error
+	ChangeAddresses() ([]ChangeAddress, error)
+	ChangeAddressIndex(addr types.Address) (uint64, bool)
+	NextChangeAddressIndex() uint64
 }
 
 // A TransactionPool contains transactions that have not yet been included in a
@@ -209,6 +229,21 @@ func (w *SingleAddressWallet) Transactions(before, since time.Time, offset, limi
 func (w *SingleAddressWallet) FundTransaction(cs consensus.State, txn *types.Transaction, amount types.Currency, pool []types.Transaction) ([]types.Hash256, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	return w.fundTransaction(cs, txn, amount, pool, func() (types.Address, error) { return w.addr, nil })
+}
+
+// FundContractFormation funds a contract formation transaction with the given
+// host like FundTransaction does. The change of the formation is sent to a
+// freshly derived change address instead of the wallet's primary address, that
+// way the change of every formation is isolated and can be attributed to the
+// contract it funded.
+func (w *SingleAddressWallet) FundContractFormation(cs consensus.State, txn *types.Transaction, amount types.Currency, pool []types.Transaction, hostKey types.PublicKey) ([]types.Hash256, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.fundTransaction(cs, txn, amount, pool, func() (types.Address, error) { return w.newChangeAddress(hostKey) })
+}
+
+func (w *SingleAddressWallet) fundTransaction(cs consensus.State, txn *types.Transaction, amount types.Currency, pool []types.Transaction, changeAddress func() (types.Address, error)) ([]types.Hash256, error) {
 	if amount.IsZero() {
 		return nil, nil
 	}
@@ -242,19 +277,25 @@ func (w *SingleAddressWallet) FundTransaction(cs consensus.State, txn *types.Tra
 	}
 	if outputSum.Cmp(amount) < 0 {
 		return nil, fmt.Errorf("%w: outputSum: %v, amount: %v", ErrInsufficientBalance, outputSum.String(), amount.String())
-	} else if outputSum.Cmp(amount) > 0 {
+	}
+	scis, err := w.siacoinInputs(fundingElements)
+	if err != nil {
+		return nil, err
+	}
+	if outputSum.Cmp(amount) > 0 {
+		addr, err := changeAddress()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get change address: %w", err)
+		}
 		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
 			Value:   outputSum.Sub(amount),
-			Address: w.addr,
+			Address: addr,
 		})
 	}
 
 	toSign := make([]types.Hash256, len(fundingElements))
 	for i, sce := range fundingElements {
-		txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
-			ParentID:         types.SiacoinOutputID(sce.ID),
-			UnlockConditions: StandardUnlockConditions(w.priv.PublicKey()),
-		})
+		txn.SiacoinInputs = append(txn.SiacoinInputs, scis[i])
 		toSign[i] = sce.ID
 		w.lastUsed[sce.ID] = time.Now()
 	}
@@ -283,7 +324,21 @@ func (w *SingleAddressWallet) SignTransaction(cs consensus.State, txn *types.Tra
 		cs.Index.Height = 179000
 	}
 
+	// inputs are signed with the key of the address they spend from
+	addrs := make(map[types.Hash256]types.Address)
+	for _, sci := range txn.SiacoinInputs {
+		addrs[types.Hash256(sci.ParentID)] = sci.UnlockConditions.UnlockHash()
+	}
+
 	for _, id := range toSign {
+		addr, ok := addrs[id]
+		if !ok {
+			return fmt.Errorf("no input with id %v", id)
+		}
+		priv, err := w.keyForAddress(addr)
+		if err != nil {
+			return err
+		}
 		ts := types.TransactionSignature{
 			ParentID:       id,
 			CoveredFields:  cf,
@@ -295,7 +350,7 @@ func (w *SingleAddressWallet) SignTransaction(cs consensus.State, txn *types.Tra
 		} else {
 			h = cs.PartialSigHash(*txn, cf)
 		}
-		sig := w.priv.SignHash(h)
+		sig := priv.SignHash(h)
 		ts.Signature = sig[:]
 		txn.Signatures = append(txn.Signatures, ts)
 	}
@@ -377,6 +432,11 @@ func (w *SingleAddressWallet) Redistribute(cs consensus.State, outputs int, amou
 			ErrInsufficientBalance, sumOut.String(), want.String(), fee.String(), sumOut.String(), amtInUse.String(), amtSameValue.String(), amtNotMatured.String())
 	}
 
+	scis, err := w.siacoinInputs(inputs)
+	if err != nil {
+		return types.Transaction{}, nil, err
+	}
+
 	// set the miner fee
 	txn.MinerFees = []types.Currency{fee}
 
@@ -392,10 +452,91 @@ func (w *SingleAddressWallet) Redistribute(cs consensus.State, outputs int, amou
 	// add the inputs
 	toSign := make([]types.Hash256, len(inputs))
 	for i, sce := range inputs {
-		txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
-			ParentID:         types.SiacoinOutputID(sce.ID),
-			UnlockConditions: StandardUnlockConditions(w.priv.PublicKey()),
+		txn.SiacoinInputs = append(txn.SiacoinInputs, scis[i])
+		toSign[i] = sce.ID
+		w.lastUsed[sce.ID] = time.Now()
+	}
+
+	return txn, toSign, nil
+}
+
+// Consolidate returns a transaction that sweeps up to 'maxInputs' of the
+// smallest spendable outputs in the wallet into the given number of outputs of
+// equal value. It also returns a list of output IDs that need to be signed.
+func (w *SingleAddressWallet) Consolidate(cs consensus.State, maxInputs, outputs int, feePerByte types.Currency, pool []types.Transaction) (types.Transaction, []types.Hash256, error) {
+	if outputs <= 0 {
+		return types.Transaction{}, nil, errors.New("number of outputs has to be greater than zero")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// fetch unspent transaction outputs
+	utxos, err := w.store.UnspentSiacoinElements(false)
+	if err != nil {
+		return types.Transaction{}, nil, err
+	}
+
+	// asc sort
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].Value.Cmp(utxos[j].Value) < 0
+	})
+
+	// map used outputs
+	inPool := make(map[types.Hash256]bool)
+	for _, ptxn := range pool {
+		for _, in := range ptxn.SiacoinInputs {
+			inPool[types.Hash256(in.ParentID)] = true
+		}
+	}
+
+	// collect the smallest spendable outputs
+	var inputs []SiacoinElement
+	for _, sce := range utxos {
+		if len(inputs) >= maxInputs {
+			break
+		} else if w.isOutputUsed(sce.ID) || inPool[sce.ID] || cs.Index.Height < sce.MaturityHeight {
+			continue
+		}
+		inputs = append(inputs, sce)
+	}
+	if len(inputs) <= outputs {
+		return types.Transaction{}, nil, fmt.Errorf("%w: %d spendable outputs can't be consolidated into %d outputs", ErrInsufficientOutputs, len(inputs), outputs)
+	}
+
+	// prepare all outputs, the value is set once the fee is known
+	var txn types.Transaction
+	for i := 0; i < outputs; i++ {
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+			Address: w.addr,
 		})
+	}
+
+	// compute the fee and make sure the inputs cover it
+	outputFees := feePerByte.Mul64(uint64(len(encoding.Marshal(txn.SiacoinOutputs))))
+	fee := feePerByte.Mul64(BytesPerInput).Mul64(uint64(len(inputs))).Add(outputFees)
+	sum := SumOutputs(inputs)
+	if sum.Cmp(fee.Add(types.NewCurrency64(uint64(outputs)))) <= 0 {
+		return types.Transaction{}, nil, fmt.Errorf("%w: inputs %v don't cover txnFee %v", ErrInsufficientBalance, sum, fee)
+	}
+	txn.MinerFees = []types.Currency{fee}
+	scis, err := w.siacoinInputs(inputs)
+	if err != nil {
+		return types.Transaction{}, nil, err
+	}
+
+	// split the remaining value evenly, the first output gets the remainder
+	value := sum.Sub(fee).Div64(uint64(outputs))
+	remainder := sum.Sub(fee).Sub(value.Mul64(uint64(outputs)))
+	for i := range txn.SiacoinOutputs {
+		txn.SiacoinOutputs[i].Value = value
+	}
+	txn.SiacoinOutputs[0].Value = txn.SiacoinOutputs[0].Value.Add(remainder)
+
+	// add the inputs
+	toSign := make([]types.Hash256, len(inputs))
+	for i, sce := range inputs {
+		txn.SiacoinInputs = append(txn.SiacoinInputs, scis[i])
 		toSign[i] = sce.ID
 		w.lastUsed[sce.ID] = time.Now()
 	}
@@ -403,6 +544,87 @@ func (w *SingleAddressWallet) Redistribute(cs consensus.State, outputs int, amou
 	return txn, toSign, nil
 }
 
+// ChangeAddresses returns the change addresses the wallet derived to fund
+// contract formations.
+func (w *SingleAddressWallet) ChangeAddresses() ([]ChangeAddress, error) {
+	return w.store.ChangeAddresses()
+}
+
+// OwnsAddress returns true if the given address is controlled by the wallet.
+func (w *SingleAddressWallet) OwnsAddress(addr types.Address) bool {
+	if addr == w.addr {
+		return true
+	}
+	_, ok := w.store.ChangeAddressIndex(addr)
+	return ok
+}
+
+// keyForAddress returns the private key that controls the given address,
+// which is either the wallet's address or one of its change addresses.
+func (w *SingleAddressWallet) keyForAddress(addr types.Address) (types.PrivateKey, error) {
+	if addr == w.addr {
+		return w.priv, nil
+	}
+	index, ok := w.store.ChangeAddressIndex(addr)
+	if !ok {
+		return nil, fmt.Errorf("address %v is not controlled by the wallet", addr)
+	}
+	priv := deriveChangeKey(w.priv, index)
+	if StandardAddress(priv.PublicKey()) != addr {
+		return nil, fmt.Errorf("change address %v doesn't match the key derived at index %d", addr, index)
+	}
+	return priv, nil
+}
+
+// siacoinInputs returns the inputs that spend the given elements.
+func (w *SingleAddressWallet) siacoinInputs(sces []SiacoinElement) ([]types.SiacoinInput, error) {
+	scis := make([]types.SiacoinInput, len(sces))
+	for i, sce := range sces {
+		priv, err := w.keyForAddress(sce.Address)
+		if err != nil {
+			return nil, err
+		}
+		scis[i] = types.SiacoinInput{
+			ParentID:         types.SiacoinOutputID(sce.ID),
+			UnlockConditions: StandardUnlockConditions(priv.PublicKey()),
+		}
+	}
+	return scis, nil
+}
+
+// newChangeAddress derives the next change address, records it in the store
+// alongside the host it is used for and returns it.
+func (w *SingleAddressWallet) newChangeAddress(hostKey types.PublicKey) (types.Address, error) {
+	index := w.store.NextChangeAddressIndex()
+	addr := DeriveChangeAddress(w.priv, index)
+	if err := w.store.AddChangeAddress(ChangeAddress{
+		Address:   addr,
+		Index:     index,
+		HostKey:   hostKey,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return types.Address{}, err
+	}
+	return addr, nil
+}
+
+// DeriveChangeAddress returns the change address at the given index, it is
+// derived from the wallet's primary key. Indices start at 1.
+func DeriveChangeAddress(priv types.PrivateKey, index uint64) types.Address {
+	return StandardAddress(deriveChangeKey(priv, index).PublicKey())
+}
+
+// deriveChangeKey deterministically derives the key of the change address at
+// the given index from the wallet's primary key.
+func deriveChangeKey(priv types.PrivateKey, index uint64) types.PrivateKey {
+	h := types.NewHasher()
+	h.E.Write([]byte("renterd/change"))
+	h.E.Write(priv[:32])
+	h.E.WriteUint64(index)
+	seed := h.Sum()
+	return types.NewPrivateKeyFromSeed(seed[:])
+}
+
 func (w *SingleAddressWallet) isOutputUsed(id types.Hash256) bool {
 	lastUsed := w.lastUsed[id]
 	if w.usedUTXOExpiry == 0 {
@@ -464,7 +686,7 @@ func (w *SingleAddressWallet) ReceiveUpdatedUnconfirmedTransactions(diff *module
 				Timestamp: time.Now(),
 			}
 			for _, sci := range txn.SiacoinInputs {
-				if sci.UnlockConditions.UnlockHash() != w.addr {
+				if !w.OwnsAddress(sci.UnlockConditions.UnlockHash()) {
 					continue
 				}
 				relevant = true
@@ -481,7 +703,7 @@ func (w *SingleAddressWallet) ReceiveUpdatedUnconfirmedTransactions(diff *module
 			}
 
 			for i, sco := range txn.SiacoinOutputs {
-				if sco.Address != w.addr {
+				if !w.OwnsAddress(sco.Address) {
 					continue
 				}
 				relevant = true
@@ -1,10 +1,12 @@
 package wallet_test
 
 import (
+	"errors"
 	"strings"
 	"testing"
 	"time"
 
+	"go.sia.tech/core/chain"
 	"go.sia.tech/core/consensus"
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/wallet"
@@ -15,7 +17,8 @@ import (
 // mockStore implements wallet.SingleAddressStore and allows to manipulate the
 // wallet's utxos
 type mockStore struct {
-	utxos []wallet.SiacoinElement
+	utxos       []wallet.SiacoinElement
+	changeAddrs []wallet.ChangeAddress
 }
 
 func (s *mockStore) Balance() (types.Currency, error) { return types.ZeroCurrency, nil }
@@ -26,6 +29,24 @@ func (s *mockStore) UnspentSiacoinElements(bool) ([]wallet.SiacoinElement, error
 func (s *mockStore) Transactions(before, since time.Time, offset, limit int) ([]wallet.Transaction, error) {
 	return nil, nil
 }
+func (s *mockStore) AddChangeAddress(ca wallet.ChangeAddress) error {
+	s.changeAddrs = append(s.changeAddrs, ca)
+	return nil
+}
+func (s *mockStore) ChangeAddresses() ([]wallet.ChangeAddress, error) {
+	return s.changeAddrs, nil
+}
+func (s *mockStore) NextChangeAddressIndex() uint64 {
+	return uint64(len(s.changeAddrs)) + 1
+}
+func (s *mockStore) ChangeAddressIndex(addr types.Address) (uint64, bool) {
+	for _, ca := range s.changeAddrs {
+		if ca.Address == addr {
+			return ca.Index, true
+		}
+	}
+	return 0, false
+}
 
 var cs = consensus.State{
 	Index: types.ChainIndex{
@@ -131,7 +152,177 @@ func TestWalletRedistribute(t *testing.T) {
 	}
 }
 
+// TestFundContractFormation asserts the change of a contract formation is sent
+// to a derived change address and that outputs sent to that address can be
+// spent by the wallet.
+func TestFundContractFormation(t *testing.T) {
+	// create a wallet with one output
+	priv := types.GeneratePrivateKey()
+	utxo := wallet.SiacoinElement{
+		types.SiacoinOutput{
+			Value:   types.Siacoins(20),
+			Address: wallet.StandardAddress(priv.PublicKey()),
+		},
+		randomOutputID(),
+		0,
+	}
+	s := &mockStore{utxos: []wallet.SiacoinElement{utxo}}
+	w := wallet.NewSingleAddressWallet(priv, s, 0, zap.NewNop().Sugar())
+
+	// signing requires a network
+	network, _ := chain.Mainnet()
+	cs := consensus.State{Network: network, Index: cs.Index}
+
+	// assertSigned asserts all inputs of the txn are signed by the key in their
+	// unlock conditions
+	assertSigned := func(txn types.Transaction) {
+		t.Helper()
+		if len(txn.Signatures) != len(txn.SiacoinInputs) {
+			t.Fatalf("unexpected number of signatures, %v != %v", len(txn.Signatures), len(txn.SiacoinInputs))
+		}
+		for i, sci := range txn.SiacoinInputs {
+			var pk types.PublicKey
+			copy(pk[:], sci.UnlockConditions.PublicKeys[0].Key)
+			var sig types.Signature
+			copy(sig[:], txn.Signatures[i].Signature)
+			if !pk.VerifyHash(cs.WholeSigHash(txn, txn.Signatures[i].ParentID, 0, 0, nil), sig) {
+				t.Fatal("invalid signature")
+			}
+		}
+	}
+
+	// fund a formation with a host
+	hk := types.GeneratePrivateKey().PublicKey()
+	var txn types.Transaction
+	toSign, err := w.FundContractFormation(cs, &txn, types.Siacoins(5), nil, hk)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := w.SignTransaction(cs, &txn, toSign, types.CoveredFields{WholeTransaction: true}); err != nil {
+		t.Fatal(err)
+	}
+	assertSigned(txn)
+
+	// assert the change was sent to a change address
+	addrs, err := w.ChangeAddresses()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(addrs) != 1 {
+		t.Fatalf("unexpected number of change addresses, %v != 1", len(addrs))
+	} else if addrs[0].HostKey != hk {
+		t.Fatal("unexpected host key")
+	} else if len(txn.SiacoinOutputs) != 1 || txn.SiacoinOutputs[0].Address != addrs[0].Address {
+		t.Fatal("change wasn't sent to the change address")
+	} else if addrs[0].Address == w.Address() {
+		t.Fatal("change address should differ from the wallet's address")
+	} else if !w.OwnsAddress(addrs[0].Address) {
+		t.Fatal("wallet should own the change address")
+	}
+
+	// spend the change output, a new wallet is used to assert the change keys
+	// are derived from the store
+	s.utxos = []wallet.SiacoinElement{{
+		SiacoinOutput: txn.SiacoinOutputs[0],
+		ID:            randomOutputID(),
+	}}
+	w = wallet.NewSingleAddressWallet(priv, s, 0, zap.NewNop().Sugar())
+	txn = types.Transaction{}
+	toSign, err = w.FundContractFormation(cs, &txn, types.Siacoins(5), nil, hk)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := w.SignTransaction(cs, &txn, toSign, types.CoveredFields{WholeTransaction: true}); err != nil {
+		t.Fatal(err)
+	} else if txn.SiacoinInputs[0].UnlockConditions.UnlockHash() != addrs[0].Address {
+		t.Fatal("unexpected unlock conditions")
+	}
+	assertSigned(txn)
+
+	// assert every formation uses a distinct change address
+	if addrs, err := w.ChangeAddresses(); err != nil {
+		t.Fatal(err)
+	} else if len(addrs) != 2 {
+		t.Fatalf("unexpected number of change addresses, %v != 2", len(addrs))
+	} else if addrs[0].Address == addrs[1].Address || addrs[1].Index != 2 {
+		t.Fatal("expected a new change address")
+	}
+
+	// assert the wallet refuses to spend outputs it doesn't control
+	s.utxos = []wallet.SiacoinElement{{
+		SiacoinOutput: types.SiacoinOutput{
+			Value:   types.Siacoins(20),
+			Address: wallet.StandardAddress(types.GeneratePrivateKey().PublicKey()),
+		},
+		ID: randomOutputID(),
+	}}
+	txn = types.Transaction{}
+	if _, err := w.FundTransaction(cs, &txn, types.Siacoins(5), nil); err == nil {
+		t.Fatal("expected funding with an unknown address to fail")
+	}
+	txn = types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         types.SiacoinOutputID(s.utxos[0].ID),
+			UnlockConditions: wallet.StandardUnlockConditions(types.GeneratePrivateKey().PublicKey()),
+		}},
+	}
+	if err := w.SignTransaction(cs, &txn, []types.Hash256{s.utxos[0].ID}, types.CoveredFields{WholeTransaction: true}); err == nil {
+		t.Fatal("expected signing an input of an unknown address to fail")
+	}
+}
+
 func randomOutputID() (t types.Hash256) {
 	frand.Read(t[:])
 	return
 }
+
+// TestWalletConsolidate is a small unit test that covers the functionality of
+// the 'Consolidate' method on the wallet.
+func TestWalletConsolidate(t *testing.T) {
+	// create a wallet with 10 outputs of 1SC to 10SC
+	priv := types.GeneratePrivateKey()
+	addr := wallet.StandardAddress(priv.PublicKey())
+	s := &mockStore{}
+	for i := 1; i <= 10; i++ {
+		s.utxos = append(s.utxos, wallet.SiacoinElement{
+			types.SiacoinOutput{Value: types.Siacoins(uint32(i)), Address: addr},
+			randomOutputID(),
+			0,
+		})
+	}
+	w := wallet.NewSingleAddressWallet(priv, s, 0, zap.NewNop().Sugar())
+
+	// consolidate the 5 smallest outputs into 2 outputs
+	feePerByte := types.NewCurrency64(1)
+	txn, toSign, err := w.Consolidate(cs, 5, 2, feePerByte, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(txn.SiacoinInputs) != 5 || len(toSign) != 5 {
+		t.Fatalf("unexpected number of inputs, %v != 5", len(txn.SiacoinInputs))
+	} else if len(txn.SiacoinOutputs) != 2 {
+		t.Fatalf("unexpected number of outputs, %v != 2", len(txn.SiacoinOutputs))
+	}
+
+	// assert the outputs and fee add up to the 5 smallest outputs
+	total := txn.MinerFees[0]
+	for _, sco := range txn.SiacoinOutputs {
+		if sco.Address != addr {
+			t.Fatal("unexpected address", sco.Address)
+		}
+		total = total.Add(sco.Value)
+	}
+	if !total.Equals(types.Siacoins(15)) {
+		t.Fatalf("unexpected total, %v != 15SC", total)
+	} else if txn.SiacoinOutputs[1].Value.Cmp(types.Siacoins(7)) < 0 {
+		t.Fatalf("unexpected value, %v", txn.SiacoinOutputs[1].Value)
+	}
+
+	// assert the used outputs are skipped, leaving 5 outputs to consolidate
+	if txn, _, err := w.Consolidate(cs, 10, 2, feePerByte, nil); err != nil {
+		t.Fatal(err)
+	} else if len(txn.SiacoinInputs) != 5 {
+		t.Fatalf("unexpected number of inputs, %v != 5", len(txn.SiacoinInputs))
+	}
+
+	// assert we can't consolidate if there are no spendable outputs left
+	if _, _, err := w.Consolidate(cs, 10, 2, feePerByte, nil); !errors.Is(err, wallet.ErrInsufficientOutputs) {
+		t.Fatalf("unexpected err: '%v'", err)
+	}
+}
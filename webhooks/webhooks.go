@@ -3,19 +3,45 @@ package webhooks
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"lukechampine.com/frand"
 )
 
-var ErrWebhookNotFound = errors.New("Webhook not found")
+var (
+	ErrWebhookNotFound = errors.New("Webhook not found")
+
+	// ErrInvalidPattern is returned when a webhook is registered with a
+	// malformed module or event pattern.
+	ErrInvalidPattern = errors.New("invalid webhook pattern")
+
+	// ErrInvalidMinSeverity is returned when a webhook is registered with an
+	// unknown minimum severity.
+	ErrInvalidMinSeverity = errors.New("invalid webhook minimum severity")
+)
+
+// severityLevels maps the severities an event can have to their level, they
+// match the severities of alerts.
+var severityLevels = map[string]int{
+	"info":     1,
+	"warning":  2,
+	"error":    3,
+	"critical": 4,
+}
 
 type (
 	WebhookStore interface {
@@ -27,6 +53,13 @@ type (
 	Broadcaster interface {
 		BroadcastAction(ctx context.Context, action Event) error
 	}
+
+	// ObjectPayload is implemented by the payloads of events that concern
+	// objects, it allows filtering webhooks by bucket and path prefix. For
+	// batch events the path is the prefix of the affected objects.
+	ObjectPayload interface {
+		ObjectScope() (bucket, path string, batch bool)
+	}
 )
 
 type NoopBroadcaster struct{}
@@ -36,13 +69,44 @@ func (NoopBroadcaster) BroadcastAction(_ context.Context, _ Event) error { retur
 const (
 	webhookTimeout   = 10 * time.Second
 	WebhookEventPing = "ping"
+
+	// subscriberBufferSize is the number of events that are buffered for a
+	// subscriber before events are dropped.
+	subscriberBufferSize = 100
+)
+
+const (
+	// HeaderIdempotencyKey is the header that contains a key that uniquely
+	// identifies an event, receivers can use it to deduplicate deliveries.
+	HeaderIdempotencyKey = "Idempotency-Key"
+
+	// HeaderSignature is the header that contains the signature of a
+	// delivery to a webhook that was registered with a secret, see
+	// VerifySignature.
+	HeaderSignature = "X-Renterd-Signature"
+
+	// HeaderTimestamp is the header that contains the unix timestamp at
+	// which a delivery was signed.
+	HeaderTimestamp = "X-Renterd-Timestamp"
 )
 
 type (
+	// Webhook describes a URL that events are delivered to. Module and
+	// event are patterns, as accepted by path.Match, that an event's module
+	// and event need to match for it to be delivered. An empty event matches
+	// all events of the module. If a secret is set, every delivery is signed
+	// using it. If a minimum severity is set, only events with at least that
+	// severity are delivered, e.g. "critical" to only page on critical alerts.
+	// If a bucket or prefix is set, only events concerning objects in that
+	// bucket or with that path prefix are delivered.
 	Webhook struct {
-		Module string `json:"module"`
-		Event  string `json:"event"`
-		URL    string `json:"url"`
+		Module      string `json:"module"`
+		Event       string `json:"event"`
+		URL         string `json:"url"`
+		Secret      string `json:"secret,omitempty"`
+		MinSeverity string `json:"minSeverity,omitempty"`
+		Bucket      string `json:"bucket,omitempty"`
+		Prefix      string `json:"prefix,omitempty"`
 	}
 
 	WebhookQueueInfo struct {
@@ -50,11 +114,13 @@ type (
 		Size int    `json:"size"`
 	}
 
-	// Event describes an event that has been triggered.
+	// Event describes an event that has been triggered. The severity is only
+	// set for events that have one, e.g. alerts.
 	Event struct {
-		Module  string      `json:"module"`
-		Event   string      `json:"event"`
-		Payload interface{} `json:"payload,omitempty"`
+		Module   string      `json:"module"`
+		Event    string      `json:"event"`
+		Severity string      `json:"severity,omitempty"`
+		Payload  interface{} `json:"payload,omitempty"`
 	}
 )
 
@@ -65,9 +131,11 @@ type Manager struct {
 	wg        sync.WaitGroup
 	store     WebhookStore
 
-	mu       sync.Mutex
-	queues   map[string]*eventQueue // URL -> queue
-	webhooks map[string]Webhook
+	mu          sync.Mutex
+	closed      bool
+	queues      map[string]*eventQueue // URL -> queue
+	subscribers map[chan Event]struct{}
+	webhooks    map[string]Webhook
 }
 
 type eventQueue struct {
@@ -77,26 +145,53 @@ type eventQueue struct {
 
 	mu           sync.Mutex
 	isDequeueing bool
-	events       []Event
+	events       []queuedEvent
+}
+
+// queuedEvent is an event that is queued for delivery to a webhook.
+type queuedEvent struct {
+	event  Event
+	key    string
+	secret string
 }
 
 func (w *Manager) Close() error {
 	w.ctxCancel()
 	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	for ch := range w.subscribers {
+		close(ch)
+		delete(w.subscribers, ch)
+	}
 	return nil
 }
 
 func (w Webhook) String() string {
-	return fmt.Sprintf("%v.%v.%v", w.URL, w.Module, w.Event)
+	return fmt.Sprintf("%v.%v.%v.%v.%v", w.URL, w.Module, w.Event, w.Bucket, w.Prefix)
 }
 
 func (w *Manager) Register(wh Webhook) error {
+	// Validate patterns.
+	for _, pattern := range []string{wh.Module, wh.Event} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w '%v': %v", ErrInvalidPattern, pattern, err)
+		}
+	}
+	if _, ok := severityLevels[wh.MinSeverity]; wh.MinSeverity != "" && !ok {
+		return fmt.Errorf("%w '%v'", ErrInvalidMinSeverity, wh.MinSeverity)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
 	defer cancel()
 
 	// Test URL.
-	err := sendEvent(ctx, wh.URL, Event{
-		Event: WebhookEventPing,
+	err := sendEvent(ctx, wh.URL, queuedEvent{
+		event:  Event{Event: WebhookEventPing},
+		key:    newIdempotencyKey(),
+		secret: wh.Secret,
 	})
 	if err != nil {
 		return err
@@ -130,9 +225,12 @@ func (w *Manager) Info() ([]Webhook, []WebhookQueueInfo) {
 	var hooks []Webhook
 	for _, hook := range w.webhooks {
 		hooks = append(hooks, Webhook{
-			Event:  hook.Event,
-			Module: hook.Module,
-			URL:    hook.URL,
+			Event:       hook.Event,
+			Module:      hook.Module,
+			URL:         hook.URL,
+			MinSeverity: hook.MinSeverity,
+			Bucket:      hook.Bucket,
+			Prefix:      hook.Prefix,
 		})
 	}
 	var queueInfos []WebhookQueueInfo
@@ -151,9 +249,41 @@ func (a Event) String() string {
 	return a.Module + "." + a.Event
 }
 
+// Subscribe returns a channel that receives every event that is broadcast
+// from now on and a function to unsubscribe. Events are dropped for
+// subscribers that don't keep up, the channel is closed when the subscriber
+// unsubscribes or the manager is closed.
+func (w *Manager) Subscribe() (<-chan Event, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ch := make(chan Event, subscriberBufferSize)
+	if w.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	w.subscribers[ch] = struct{}{}
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if _, exists := w.subscribers[ch]; exists {
+			close(ch)
+			delete(w.subscribers, ch)
+		}
+	}
+}
+
 func (w *Manager) BroadcastAction(_ context.Context, event Event) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	for ch := range w.subscribers {
+		select {
+		case ch <- event:
+		default:
+			w.logger.Debugf("dropped event %v for slow subscriber", event.String())
+		}
+	}
+	key := newIdempotencyKey()
 	for _, hook := range w.webhooks {
 		if !hook.Matches(event) {
 			continue
@@ -172,7 +302,11 @@ func (w *Manager) BroadcastAction(_ context.Context, event Event) error {
 
 		// Add event and launch goroutine to start dequeueing if necessary.
 		queue.mu.Lock()
-		queue.events = append(queue.events, event)
+		queue.events = append(queue.events, queuedEvent{
+			event:  event,
+			key:    key,
+			secret: hook.Secret,
+		})
 		if !queue.isDequeueing {
 			queue.isDequeueing = true
 			w.wg.Add(1)
@@ -200,16 +334,67 @@ func (q *eventQueue) dequeue() {
 
 		err := sendEvent(q.ctx, q.url, next)
 		if err != nil {
-			q.logger.Errorf("failed to send Webhook event %v to %v: %v", next.String(), q.url, err)
+			q.logger.Errorf("failed to send Webhook event %v to %v: %v", next.event.String(), q.url, err)
 		}
 	}
 }
 
 func (w Webhook) Matches(action Event) bool {
-	if w.Module != action.Module {
+	if !matchPattern(w.Module, action.Module) {
 		return false
 	}
-	return w.Event == "" || w.Event == action.Event
+	if w.MinSeverity != "" {
+		level, ok := severityLevels[action.Severity]
+		if !ok || level < severityLevels[w.MinSeverity] {
+			return false
+		}
+	}
+	if w.Bucket != "" || w.Prefix != "" {
+		p, ok := action.Payload.(ObjectPayload)
+		if !ok {
+			return false
+		}
+		bucket, path, batch := p.ObjectScope()
+		if w.Bucket != "" && bucket != w.Bucket {
+			return false
+		}
+		// batch events affect all objects with their path as prefix
+		if !strings.HasPrefix(path, w.Prefix) && !(batch && strings.HasPrefix(w.Prefix, path)) {
+			return false
+		}
+	}
+	return w.Event == "" || matchPattern(w.Event, action.Event)
+}
+
+func matchPattern(pattern, s string) bool {
+	if pattern == s {
+		return true
+	}
+	match, _ := path.Match(pattern, s)
+	return match
+}
+
+// Sign returns the signature of a delivery with the given timestamp and body
+// for a webhook with the given secret. The signature is the hex encoded
+// HMAC-SHA256 of the timestamp and body joined by a dot, prefixed by
+// "sha256=".
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature returns true if the signature matches the delivery with the
+// given timestamp and body for a webhook with the given secret. Receivers
+// should also check the timestamp is recent to prevent replays.
+func VerifySignature(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+func newIdempotencyKey() string {
+	return hex.EncodeToString(frand.Bytes(16))
 }
 
 func NewManager(logger *zap.SugaredLogger, store WebhookStore) (*Manager, error) {
@@ -219,12 +404,13 @@ func NewManager(logger *zap.SugaredLogger, store WebhookStore) (*Manager, error)
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	m := &Manager{
-		ctx:       ctx,
-		ctxCancel: cancel,
-		logger:    logger.Named("webhooks"),
-		queues:    make(map[string]*eventQueue),
-		store:     store,
-		webhooks:  make(map[string]Webhook),
+		ctx:         ctx,
+		ctxCancel:   cancel,
+		logger:      logger.Named("webhooks"),
+		queues:      make(map[string]*eventQueue),
+		store:       store,
+		subscribers: make(map[chan Event]struct{}),
+		webhooks:    make(map[string]Webhook),
 	}
 	for _, hook := range hooks {
 		m.webhooks[hook.String()] = hook
@@ -232,8 +418,8 @@ func NewManager(logger *zap.SugaredLogger, store WebhookStore) (*Manager, error)
 	return m, nil
 }
 
-func sendEvent(ctx context.Context, url string, action Event) error {
-	body, err := json.Marshal(action)
+func sendEvent(ctx context.Context, url string, qe queuedEvent) error {
+	body, err := json.Marshal(qe.event)
 	if err != nil {
 		return err
 	}
@@ -244,6 +430,14 @@ func sendEvent(ctx context.Context, url string, action Event) error {
 	}
 	defer io.ReadAll(req.Body) // always drain body
 
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderIdempotencyKey, qe.key)
+	if qe.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, Sign(qe.secret, timestamp, body))
+	}
+
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
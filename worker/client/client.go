@@ -18,6 +18,11 @@ import (
 	"go.sia.tech/renterd/object"
 )
 
+func init() {
+	// request JSON error envelopes so errors can be identified by their code
+	api.RequestErrorEnvelopes()
+}
+
 // A Client provides methods for interacting with a renterd API server.
 type Client struct {
 	c jape.Client
@@ -29,6 +34,25 @@ func (c *Client) Account(ctx context.Context, hostKey types.PublicKey) (account
 	return
 }
 
+// ClearDenyList removes all hosts from the worker's deny list.
+func (c *Client) ClearDenyList(ctx context.Context) (err error) {
+	err = c.c.WithContext(ctx).DELETE("/denylist")
+	return
+}
+
+// DenyList returns the hosts the worker temporarily doesn't use because they
+// misbehaved.
+func (c *Client) DenyList(ctx context.Context) (hosts []api.DeniedHost, err error) {
+	err = c.c.WithContext(ctx).GET("/denylist", &hosts)
+	return
+}
+
+// RemoveDeniedHost removes the given host from the worker's deny list.
+func (c *Client) RemoveDeniedHost(ctx context.Context, hostKey types.PublicKey) (err error) {
+	err = c.c.WithContext(ctx).DELETE(fmt.Sprintf("/denylist/%s", hostKey))
+	return
+}
+
 // DownloadObject downloads the object at the given path.
 func (c *Client) DownloadObject(ctx context.Context, w io.Writer, bucket, path string, opts api.DownloadObjectOptions) (err error) {
 	if strings.HasSuffix(path, "/") {
@@ -98,12 +122,77 @@ func (c *Client) GetObject(ctx context.Context, bucket, path string, opts api.Do
 	return &api.GetObjectResponse{
 		Content:     body,
 		ContentType: header.Get("Content-Type"),
+		ETag:        strings.Trim(header.Get("ETag"), `"`),
+		Metadata:    api.ObjectUserMetadataFromHeaders(header),
 		ModTime:     modTime.UTC(),
 		Range:       r,
 		Size:        size,
 	}, nil
 }
 
+// HeadObject returns the metadata of the object at given path.
+func (c *Client) HeadObject(ctx context.Context, bucket, path string) (*api.HeadObjectResponse, error) {
+	if strings.HasSuffix(path, "/") {
+		return nil, errors.New("the given path is a directory, use ObjectEntries instead")
+	}
+
+	values := url.Values{}
+	values.Set("bucket", bucket)
+	path = api.ObjectPathEscape(path) + "?" + values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", fmt.Sprintf("%s/objects/%s", c.c.BaseURL, path), nil)
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, api.ErrObjectNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	// Parse header.
+	var size int64
+	if _, err := fmt.Sscan(resp.Header.Get("Content-Length"), &size); err != nil {
+		return nil, err
+	}
+	modTime, err := time.Parse(http.TimeFormat, resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return nil, err
+	}
+	return &api.HeadObjectResponse{
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+		Metadata:    api.ObjectUserMetadataFromHeaders(resp.Header),
+		ModTime:     modTime.UTC(),
+		Size:        size,
+	}, nil
+}
+
+// HostGouging fetches the live price table of the host with the given key and
+// compares it to the gouging settings.
+func (c *Client) HostGouging(ctx context.Context, hostKey types.PublicKey) (resp api.HostGougingResponse, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/host/%s/gouging", hostKey), &resp)
+	return
+}
+
+// HostsPriceTables fetches the current price tables of the given hosts, hosts
+// that fail to respond within the given timeout have their error set.
+func (c *Client) HostsPriceTables(ctx context.Context, hostKeys []types.PublicKey, timeout time.Duration) (resp []api.HostPriceTableResult, err error) {
+	err = c.c.WithContext(ctx).POST("/hosts/pricetables", api.FetchPriceTablesRequest{
+		HostKeys: hostKeys,
+		Timeout:  api.DurationMS(timeout),
+	}, &resp)
+	return
+}
+
 // ID returns the id of the worker.
 func (c *Client) ID(ctx context.Context) (id string, err error) {
 	err = c.c.WithContext(ctx).GET("/id", &id)
@@ -128,10 +217,65 @@ func (c *Client) DeleteObject(ctx context.Context, bucket, path string, opts api
 	return
 }
 
-// MigrateSlab migrates the specified slab.
-func (c *Client) MigrateSlab(ctx context.Context, slab object.Slab, set string) (res api.MigrateSlabResponse, err error) {
+// AbortMultipartUpload aborts the multipart upload with the given id.
+func (c *Client) AbortMultipartUpload(ctx context.Context, bucket, path, uploadID string) (err error) {
+	err = c.c.WithContext(ctx).POST("/multipart/abort", api.MultipartAbortRequest{
+		Bucket:   bucket,
+		Path:     path,
+		UploadID: uploadID,
+	}, nil)
+	return
+}
+
+// CompleteMultipartUpload completes the multipart upload with the given id,
+// stitching the given parts together into an object at the given path.
+func (c *Client) CompleteMultipartUpload(ctx context.Context, bucket, path, uploadID string, parts []api.MultipartCompletedPart) (resp api.MultipartCompleteResponse, err error) {
+	err = c.c.WithContext(ctx).POST("/multipart/complete", api.MultipartCompleteRequest{
+		Bucket:   bucket,
+		Path:     path,
+		UploadID: uploadID,
+		Parts:    parts,
+	}, &resp)
+	return
+}
+
+// CreateMultipartUpload starts a multipart upload for the object at the given
+// path, a random encryption key is used if none is specified.
+func (c *Client) CreateMultipartUpload(ctx context.Context, bucket, path string, opts api.CreateMultipartOptions) (resp api.MultipartCreateResponse, err error) {
+	if opts.Key == (object.EncryptionKey{}) {
+		opts.Key = object.GenerateEncryptionKey()
+	}
+	err = c.c.WithContext(ctx).POST("/multipart/create", api.MultipartCreateRequest{
+		Bucket:   bucket,
+		Path:     path,
+		Key:      opts.Key,
+		MimeType: opts.MimeType,
+		Metadata: opts.Metadata,
+	}, &resp)
+	return
+}
+
+// MigrateSlab migrates the specified slab, the gouging overrides of the given
+// bucket are applied if it's not empty.
+func (c *Client) MigrateSlab(ctx context.Context, slab object.Slab, set, bucket string) (res api.MigrateSlabResponse, err error) {
+	values := make(url.Values)
+	values.Set("contractset", set)
+	if bucket != "" {
+		values.Set("bucket", bucket)
+	}
+	err = c.c.WithContext(ctx).POST("/slab/migrate?"+values.Encode(), slab, &res)
+	return
+}
+
+// MigrateSlabFromHost migrates the shards of the specified slab that are
+// stored on the given host to hosts that store less data than it does.
+func (c *Client) MigrateSlabFromHost(ctx context.Context, slab object.Slab, set, bucket string, hk types.PublicKey) (res api.MigrateSlabResponse, err error) {
 	values := make(url.Values)
 	values.Set("contractset", set)
+	values.Set("evict", hk.String())
+	if bucket != "" {
+		values.Set("bucket", bucket)
+	}
 	err = c.c.WithContext(ctx).POST("/slab/migrate?"+values.Encode(), slab, &res)
 	return
 }
@@ -180,6 +324,7 @@ func (c *Client) UploadMultipartUploadPart(ctx context.Context, r io.Reader, buc
 		panic(err)
 	}
 	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	req.Header.Set("Accept", "application/json")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -187,10 +332,13 @@ func (c *Client) UploadMultipartUploadPart(ctx context.Context, r io.Reader, buc
 	defer io.Copy(io.Discard, resp.Body)
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		err, _ := io.ReadAll(resp.Body)
-		return nil, errors.New(string(err))
+		return nil, parseUploadError(resp)
+	}
+	cost, err := parseCostHeader(resp.Header)
+	if err != nil {
+		return nil, err
 	}
-	return &api.UploadMultipartUploadPartResponse{ETag: resp.Header.Get("ETag")}, nil
+	return &api.UploadMultipartUploadPartResponse{ETag: resp.Header.Get("ETag"), Cost: cost}, nil
 }
 
 // UploadObject uploads the data in r, creating an object at the given path.
@@ -211,17 +359,60 @@ func (c *Client) UploadObject(ctx context.Context, r io.Reader, bucket, path str
 		panic(err)
 	}
 	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	req.Header.Set("Accept", "application/json")
+	opts.ApplyHeaders(req.Header)
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer io.Copy(io.Discard, resp.Body)
 	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		err, _ := io.ReadAll(resp.Body)
-		return nil, errors.New(string(err))
+	if resp.StatusCode == http.StatusAccepted {
+		var su api.StagedUpload
+		if err := json.NewDecoder(resp.Body).Decode(&su); err != nil {
+			return nil, fmt.Errorf("failed to decode staged upload: %w", err)
+		}
+		return &api.UploadObjectResponse{StagedUpload: &su}, nil
+	} else if resp.StatusCode != 200 {
+		return nil, parseUploadError(resp)
+	}
+	cost, err := parseCostHeader(resp.Header)
+	if err != nil {
+		return nil, err
+	}
+	return &api.UploadObjectResponse{ETag: resp.Header.Get("ETag"), Cost: cost}, nil
+}
+
+// UploadSlab uploads a single slab's worth of data in r and returns the
+// resulting slab without adding it to an object, the data is expected to be
+// encrypted already.
+func (c *Client) UploadSlab(ctx context.Context, r io.Reader, opts api.UploadSlabOptions) (resp api.UploadSlabResponse, err error) {
+	c.c.Custom("POST", "/slab/upload", []byte{}, &resp)
+
+	values := make(url.Values)
+	opts.Apply(values)
+	u, err := url.Parse(fmt.Sprintf("%v/slab/upload", c.c.BaseURL))
+	if err != nil {
+		panic(err)
+	}
+	u.RawQuery = values.Encode()
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), r)
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	req.Header.Set("Accept", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return api.UploadSlabResponse{}, err
+	}
+	defer io.Copy(io.Discard, res.Body)
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return api.UploadSlabResponse{}, api.ReadError(res)
 	}
-	return &api.UploadObjectResponse{ETag: resp.Header.Get("ETag")}, nil
+	err = json.NewDecoder(res.Body).Decode(&resp)
+	return
 }
 
 // UploadStats returns the upload stats.
@@ -230,6 +421,20 @@ func (c *Client) UploadStats() (resp api.UploadStatsResponse, err error) {
 	return
 }
 
+// StagedUploads returns the uploads that were staged on the worker's disk but
+// weren't uploaded to the hosts yet.
+func (c *Client) StagedUploads(ctx context.Context) (resp []api.StagedUpload, err error) {
+	err = c.c.WithContext(ctx).GET("/uploads/staged", &resp)
+	return
+}
+
+// VerifyObject downloads the object at the given path in full, bypassing all
+// caches, and returns the hash of its contents.
+func (c *Client) VerifyObject(ctx context.Context, bucket, path string) (res api.VerifyObjectResponse, err error) {
+	err = c.c.WithContext(ctx).POST("/objects/verify", api.VerifyObjectRequest{Bucket: bucket, Path: path}, &res)
+	return
+}
+
 // New returns a client that communicates with a renterd worker server
 // listening on the specified address.
 func New(addr, password string) *Client {
@@ -251,6 +456,7 @@ func (c *Client) object(ctx context.Context, bucket, path string, opts api.Downl
 		panic(err)
 	}
 	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	req.Header.Set("Accept", "application/json")
 	opts.ApplyHeaders(req.Header)
 
 	resp, err := http.DefaultClient.Do(req)
@@ -258,9 +464,38 @@ func (c *Client) object(ctx context.Context, bucket, path string, opts api.Downl
 		return nil, nil, err
 	}
 	if resp.StatusCode != 200 && resp.StatusCode != 206 {
-		err, _ := io.ReadAll(resp.Body)
+		err := api.ReadError(resp)
 		_ = resp.Body.Close()
-		return nil, nil, errors.New(string(err))
+		return nil, nil, err
 	}
 	return resp.Body, resp.Header, err
 }
+
+func parseCostHeader(h http.Header) (types.Currency, error) {
+	v := h.Get(api.ObjectCostHeader)
+	if v == "" {
+		return types.ZeroCurrency, nil
+	}
+	cost, err := types.ParseCurrency(v)
+	if err != nil {
+		return types.ZeroCurrency, fmt.Errorf("failed to parse cost header: %w", err)
+	}
+	return cost, nil
+}
+
+// parseUploadError returns the error of a failed upload, uploads that failed
+// because of errors returned by hosts are returned as an *api.UploadError.
+func parseUploadError(resp *http.Response) error {
+	b, _ := io.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Type") == "application/json" {
+		var ue api.UploadError
+		if err := json.Unmarshal(b, &ue); err == nil && ue.Message != "" {
+			return &ue
+		}
+		var apiErr api.Error
+		if err := json.Unmarshal(b, &apiErr); err == nil && apiErr.Code != "" {
+			return &apiErr
+		}
+	}
+	return errors.New(string(b))
+}
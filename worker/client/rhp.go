@@ -74,6 +74,15 @@ func (c *Client) RHPPruneContract(ctx context.Context, fcid types.FileContractID
 	return
 }
 
+// RHPDeleteSectors deletes the sectors with the given roots from the contract
+// with given id.
+func (c *Client) RHPDeleteSectors(ctx context.Context, fcid types.FileContractID, roots []types.Hash256) (resp api.RHPDeleteSectorsResponse, err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/rhp/contract/%s/deletesectors", fcid), api.RHPDeleteSectorsRequest{
+		Roots: roots,
+	}, &resp)
+	return
+}
+
 // RHPReadRegistry reads a registry value.
 func (c *Client) RHPReadRegistry(ctx context.Context, hostKey types.PublicKey, siamuxAddr string, key rhpv3.RegistryKey, payment rhpv3.PayByEphemeralAccountRequest) (resp rhpv3.RegistryValue, err error) {
 	req := api.RHPRegistryReadRequest{
@@ -115,6 +124,13 @@ func (c *Client) RHPScan(ctx context.Context, hostKey types.PublicKey, hostIP st
 	return
 }
 
+// RHPRefreshPriceTables renews the price tables the worker has cached for the
+// given hosts if they are no longer valid.
+func (c *Client) RHPRefreshPriceTables(ctx context.Context, hostKeys []types.PublicKey) (resp api.RHPPriceTablesRefreshResponse, err error) {
+	err = c.c.WithContext(ctx).POST("/rhp/pricetables/refresh", api.RHPPriceTablesRefreshRequest{HostKeys: hostKeys}, &resp)
+	return
+}
+
 // RHPSync funds an ephemeral account using the supplied contract.
 func (c *Client) RHPSync(ctx context.Context, contractID types.FileContractID, hostKey types.PublicKey, hostIP, siamuxAddr string) (err error) {
 	req := api.RHPSyncRequest{
@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// consensusEventsTimeout is the amount of time the bus holds on to a
+	// consensus event request before it returns the unchanged state.
+	consensusEventsTimeout = 30 * time.Second
+
+	// consensusSubscribeRetryInterval is the amount of time the worker waits
+	// before subscribing again after a consensus event request failed.
+	consensusSubscribeRetryInterval = 5 * time.Second
+)
+
+type (
+	// consensusSubscriber keeps track of the consensus state by long-polling
+	// the bus for consensus events, that way the worker doesn't have to fetch
+	// the state from the bus for every operation.
+	consensusSubscriber struct {
+		w        *worker
+		stopChan chan struct{}
+
+		mu    sync.Mutex
+		cs    api.ConsensusState
+		tip   types.BlockID
+		valid bool
+	}
+)
+
+func (w *worker) initConsensusSubscriber() {
+	if w.consensus != nil {
+		panic("consensus subscriber already initialized") // developer error
+	}
+	w.consensus = &consensusSubscriber{
+		w:        w,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Stop stops the subscriber.
+func (s *consensusSubscriber) Stop() {
+	close(s.stopChan)
+}
+
+// ConsensusState returns the latest consensus state received from the bus, if
+// the subscription isn't active the state is fetched from the bus.
+func (s *consensusSubscriber) ConsensusState(ctx context.Context) (api.ConsensusState, error) {
+	s.mu.Lock()
+	cs, valid := s.cs, s.valid
+	s.mu.Unlock()
+	if valid {
+		return cs, nil
+	}
+	return s.w.bus.ConsensusState(ctx)
+}
+
+func (s *consensusSubscriber) threadedSubscribe() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		s.mu.Lock()
+		tip := s.tip
+		s.mu.Unlock()
+
+		event, err := s.w.bus.ConsensusEvent(ctx, tip, consensusEventsTimeout)
+		if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+			return
+		} else if err != nil {
+			// fall back to fetching the state from the bus until we're
+			// subscribed again
+			s.w.logger.Errorf("failed to fetch consensus event, err: %v", err)
+			s.mu.Lock()
+			s.valid = false
+			s.tip = types.BlockID{}
+			s.mu.Unlock()
+
+			select {
+			case <-s.stopChan:
+				return
+			case <-time.After(consensusSubscribeRetryInterval):
+			}
+			continue
+		}
+
+		s.processEvent(event)
+	}
+}
+
+func (s *consensusSubscriber) processEvent(event api.ConsensusEvent) {
+	s.mu.Lock()
+	changed := !s.valid || s.tip != event.BlockID
+	s.cs = event.ConsensusState
+	s.tip = event.BlockID
+	s.valid = true
+	s.mu.Unlock()
+
+	if event.Reorg {
+		s.w.logger.Infof("chain reorg detected, new block height %d", event.BlockHeight)
+	}
+	if changed {
+		s.w.uploadManager.updateBlockHeight(event.BlockHeight)
+	}
+}
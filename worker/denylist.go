@@ -0,0 +1,165 @@
+package worker
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// corruptDataDenyDuration is the amount of time a host is denied after it
+	// returned data that doesn't match the proof or root we expected.
+	corruptDataDenyDuration = invalidProofPenaltyDuration
+
+	// paymentRejectedDenyDuration is the amount of time a host is denied
+	// after it rejected a payment.
+	paymentRejectedDenyDuration = 10 * time.Minute
+)
+
+var (
+	// errPaymentRejected is returned when the host responded to a payment
+	// with an error.
+	errPaymentRejected = errors.New("host rejected payment")
+)
+
+func isPaymentRejected(err error) bool { return isError(err, errPaymentRejected) }
+
+type (
+	// hostDenyList is a worker-local list of hosts that misbehaved recently.
+	// Unlike the bus' blocklist, hosts are added automatically and removed
+	// again after a cool-down period.
+	hostDenyList struct {
+		mu      sync.Mutex
+		entries map[types.PublicKey]api.DeniedHost
+	}
+)
+
+func (w *worker) initHostDenyList() {
+	if w.denyList != nil {
+		panic("deny list already initialized") // developer error
+	}
+	w.denyList = newHostDenyList()
+}
+
+func newHostDenyList() *hostDenyList {
+	return &hostDenyList{
+		entries: make(map[types.PublicKey]api.DeniedHost),
+	}
+}
+
+// Deny adds the host to the deny list until the given time, if the host is
+// already denied for longer the existing entry is kept.
+func (dl *hostDenyList) Deny(hk types.PublicKey, reason string, err error, until time.Time) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if e, exists := dl.entries[hk]; exists && e.Until.After(until) {
+		return
+	}
+	dl.entries[hk] = api.DeniedHost{
+		HostKey: hk,
+		Reason:  reason,
+		Error:   err.Error(),
+		Until:   until,
+	}
+}
+
+// Entries returns all hosts that are currently denied.
+func (dl *hostDenyList) Entries() []api.DeniedHost {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	dl.pruneExpired()
+
+	entries := make([]api.DeniedHost, 0, len(dl.entries))
+	for _, e := range dl.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Until.Before(entries[j].Until)
+	})
+	return entries
+}
+
+// IsDenied returns true if the host is currently denied.
+func (dl *hostDenyList) IsDenied(hk types.PublicKey) bool {
+	if dl == nil {
+		return false
+	}
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	e, exists := dl.entries[hk]
+	if exists && time.Now().After(e.Until) {
+		delete(dl.entries, hk)
+		return false
+	}
+	return exists
+}
+
+// Remove removes the given hosts from the deny list, if no hosts are given the
+// deny list is cleared.
+func (dl *hostDenyList) Remove(hks ...types.PublicKey) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if len(hks) == 0 {
+		dl.entries = make(map[types.PublicKey]api.DeniedHost)
+		return
+	}
+	for _, hk := range hks {
+		delete(dl.entries, hk)
+	}
+}
+
+// TrackError denies the host if the given error indicates that the host
+// misbehaved.
+func (dl *hostDenyList) TrackError(hk types.PublicKey, err error) {
+	if dl == nil || err == nil {
+		return
+	}
+	switch {
+	case isInvalidProof(err):
+		dl.Deny(hk, api.DenyReasonCorruptData, err, time.Now().Add(corruptDataDenyDuration))
+	case isPaymentRejected(err):
+		dl.Deny(hk, api.DenyReasonPaymentRejected, err, time.Now().Add(paymentRejectedDenyDuration))
+	}
+}
+
+func (dl *hostDenyList) pruneExpired() {
+	now := time.Now()
+	for hk, e := range dl.entries {
+		if now.After(e.Until) {
+			delete(dl.entries, hk)
+		}
+	}
+}
+
+func (w *worker) isDenied(hk types.PublicKey) bool {
+	return w.denyList.IsDenied(hk)
+}
+
+func (w *worker) trackHostError(hk types.PublicKey, err error) {
+	w.denyList.TrackError(hk, err)
+}
+
+func (w *worker) denyListHandlerGET(jc jape.Context) {
+	jc.Encode(w.denyList.Entries())
+}
+
+func (w *worker) denyListHandlerDELETE(jc jape.Context) {
+	w.denyList.Remove()
+}
+
+func (w *worker) denyListHostHandlerDELETE(jc jape.Context) {
+	var hk types.PublicKey
+	if jc.DecodeParam("hostkey", &hk) != nil {
+		return
+	} else if !w.denyList.IsDenied(hk) {
+		jc.Error(api.ErrHostNotDenied, http.StatusNotFound)
+		return
+	}
+	w.denyList.Remove(hk)
+}
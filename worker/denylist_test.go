@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestHostDenyList(t *testing.T) {
+	dl := newHostDenyList()
+	hk1, hk2, hk3 := types.PublicKey{1}, types.PublicKey{2}, types.PublicKey{3}
+
+	// assert hosts are only denied for errors that indicate they misbehaved
+	dl.TrackError(hk1, fmt.Errorf("%w: bad root", ErrInvalidMerkleProof))
+	dl.TrackError(hk2, fmt.Errorf("%w: insufficient funds", errPaymentRejected))
+	dl.TrackError(hk3, errors.New("connection refused"))
+	dl.TrackError(hk3, nil)
+	if !dl.IsDenied(hk1) || !dl.IsDenied(hk2) {
+		t.Fatal("expected hosts to be denied")
+	} else if dl.IsDenied(hk3) {
+		t.Fatal("expected host not to be denied")
+	}
+
+	// assert the entries are sorted by when they expire and have the right
+	// reason
+	entries := dl.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", len(entries))
+	} else if entries[0].HostKey != hk2 || entries[0].Reason != api.DenyReasonPaymentRejected {
+		t.Fatal("unexpected entry", entries[0])
+	} else if entries[1].HostKey != hk1 || entries[1].Reason != api.DenyReasonCorruptData {
+		t.Fatal("unexpected entry", entries[1])
+	}
+
+	// assert a shorter deny period doesn't override a longer one
+	until := entries[1].Until
+	dl.Deny(hk1, api.DenyReasonPaymentRejected, errPaymentRejected, time.Now().Add(time.Minute))
+	if e := dl.Entries()[1]; e.HostKey != hk1 || !e.Until.Equal(until) || e.Reason != api.DenyReasonCorruptData {
+		t.Fatal("unexpected entry", e)
+	}
+
+	// assert expired entries are removed
+	dl.Deny(hk3, api.DenyReasonCorruptData, ErrInvalidMerkleProof, time.Now().Add(-time.Second))
+	if dl.IsDenied(hk3) {
+		t.Fatal("expected host not to be denied")
+	} else if len(dl.Entries()) != 2 {
+		t.Fatal("expected expired entry to be pruned")
+	}
+
+	// assert hosts can be removed individually or all at once
+	dl.Remove(hk1)
+	if dl.IsDenied(hk1) || !dl.IsDenied(hk2) {
+		t.Fatal("unexpected deny list", dl.Entries())
+	}
+	dl.Deny(hk1, api.DenyReasonCorruptData, ErrInvalidMerkleProof, time.Now().Add(time.Minute))
+	dl.Remove()
+	if len(dl.Entries()) != 0 {
+		t.Fatal("expected deny list to be empty", dl.Entries())
+	}
+}
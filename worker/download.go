@@ -1,12 +1,14 @@
 package worker
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"math/big"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,6 +18,7 @@ import (
 	rhpv2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
 	"go.sia.tech/renterd/object"
 	"go.sia.tech/renterd/tracing"
 	"go.uber.org/zap"
@@ -26,6 +29,39 @@ const (
 	downloadOverheadB             = 284
 	maxConcurrentSectorsPerHost   = 3
 	maxConcurrentSlabsPerDownload = 3
+
+	// downloadStreamBufferSize is the size of the buffer used to coalesce
+	// the small writes that happen when joining the recovered shards, the
+	// buffer is flushed after every slab so the data is streamed to the
+	// caller as soon as it's available.
+	downloadStreamBufferSize = 1 << 16 // 64 KiB
+
+	// fallbackV2Duration is the amount of time a downloader downloads sectors
+	// using RHPv2 after failing to establish an RHPv3 transport with the
+	// host, after which RHPv3 is tried again.
+	fallbackV2Duration = 10 * time.Minute
+
+	// fallbackV2EstimatePenalty is the factor by which a downloader's
+	// estimate is multiplied while it's falling back to RHPv2, this makes
+	// sure we prefer hosts that are reachable over RHPv3.
+	fallbackV2EstimatePenalty = 2
+
+	// invalidProofPenaltyDuration is the amount of time a downloader is
+	// penalized for after its host returned data with an invalid proof.
+	invalidProofPenaltyDuration = time.Hour
+
+	// invalidProofEstimatePenalty is the factor by which a downloader's
+	// estimate is multiplied while it's penalized for returning bad data,
+	// this makes sure we only use the host if there's no other option.
+	invalidProofEstimatePenalty = 1000
+
+	// downloadCostWeight and downloadCostSaverWeight are the exponents applied
+	// to a host's read cost relative to the average read cost of the hosts
+	// of a slab, the result is multiplied with the host's estimate. By
+	// default speed dominates, in cost saver mode cheaper hosts are favoured
+	// even if they are slower.
+	downloadCostWeight      = 0.5
+	downloadCostSaverWeight = 2
 )
 
 type (
@@ -34,13 +70,20 @@ type (
 
 	downloadManager struct {
 		hp     hostProvider
+		hdv2   sectorDownloaderV2
 		pss    partialSlabStore
 		slm    sectorLostMarker
+		rcp    sectorReadCostProvider
+		sc     *sectorCache
 		logger *zap.SugaredLogger
 
 		maxOverdrive     uint64
 		overdriveTimeout time.Duration
 
+		// costSaver makes the manager prefer cheaper hosts over faster ones,
+		// it's updated whenever the worker fetches the download settings
+		costSaver atomic.Bool
+
 		statsOverdrivePct                *dataPoints
 		statsSlabDownloadSpeedBytesPerMS *dataPoints
 
@@ -52,30 +95,55 @@ type (
 	}
 
 	downloader struct {
-		host hostV3
+		host     hostV3
+		fallback sectorDownloaderV2
+		cache    *sectorCache
+
+		// RHPv2 fallback related fields
+		hostIP                  string
+		lastKnownRevisionNumber uint64
 
 		statsDownloadSpeedBytesPerMS    *dataPoints // keep track of this separately for stats (no decay is applied)
 		statsSectorDownloadEstimateInMS *dataPoints
+		metrics                         transferMetrics
 
 		signalWorkChan chan struct{}
 		stopChan       chan struct{}
 
 		mu                  sync.Mutex
 		consecutiveFailures uint64
+		fallbackUntil       time.Time
+		penalizedUntil      time.Time
 		queue               []*sectorDownloadReq
 		numDownloads        uint64
+		numFallbacks        uint64
 	}
 
 	downloaderStats struct {
 		avgSpeedMBPS float64
+		latencyP90MS float64
 		healthy      bool
 		numDownloads uint64
+		numFallbacks uint64
+		queueLength  uint64
+	}
+
+	// sectorReadCostProvider returns the cost of reading a sector from a
+	// host, it returns false if the cost is unknown.
+	sectorReadCostProvider interface {
+		sectorReadCost(hk types.PublicKey) (types.Currency, bool)
 	}
 
 	sectorLostMarker interface {
 		DeleteHostSector(ctx context.Context, hk types.PublicKey, root types.Hash256) error
 	}
 
+	// sectorDownloaderV2 can download sectors using RHPv2, it's used as a
+	// fallback for hosts whose RHPv3 endpoint is unavailable.
+	sectorDownloaderV2 interface {
+		DownloadSectorV2(ctx context.Context, w io.Writer, hostIP string, hostKey types.PublicKey, fcid types.FileContractID, lastKnownRevisionNumber uint64, root types.Hash256, offset, length uint32) error
+	}
+
 	slabDownload struct {
 		mgr *downloadManager
 		slm sectorLostMarker
@@ -147,22 +215,38 @@ type (
 		avgDownloadSpeedMBPS float64
 		avgOverdrivePct      float64
 		downloaders          map[types.PublicKey]downloaderStats
+		sectorCache          *api.SectorCacheStats
 	}
 )
 
-func (w *worker) initDownloadManager(maxOverdrive uint64, overdriveTimeout time.Duration, logger *zap.SugaredLogger) {
+func (w *worker) initDownloadManager(maxOverdrive uint64, overdriveTimeout time.Duration, sc *sectorCache, logger *zap.SugaredLogger) {
 	if w.downloadManager != nil {
 		panic("download manager already initialized") // developer error
 	}
 
-	w.downloadManager = newDownloadManager(w, w, w.bus, maxOverdrive, overdriveTimeout, logger)
+	w.downloadManager = newDownloadManager(w, w, w, w.bus, w, sc, maxOverdrive, overdriveTimeout, logger)
+	w.verifyManager = newDownloadManager(w, w, w, w.bus, w, nil, maxOverdrive, overdriveTimeout, logger.Named("verify"))
 }
 
-func newDownloadManager(hp hostProvider, pss partialSlabStore, slm sectorLostMarker, maxOverdrive uint64, overdriveTimeout time.Duration, logger *zap.SugaredLogger) *downloadManager {
+// sectorReadCost returns the cost of reading a full sector from the given
+// host according to its cached price table.
+func (w *worker) sectorReadCost(hk types.PublicKey) (types.Currency, bool) {
+	hpt, ok := w.priceTables.cached(hk)
+	if !ok {
+		return types.ZeroCurrency, false
+	}
+	cost, overflow := sectorReadCostRHPv3(hpt.HostPriceTable)
+	return cost, !overflow
+}
+
+func newDownloadManager(hp hostProvider, hdv2 sectorDownloaderV2, pss partialSlabStore, slm sectorLostMarker, rcp sectorReadCostProvider, sc *sectorCache, maxOverdrive uint64, overdriveTimeout time.Duration, logger *zap.SugaredLogger) *downloadManager {
 	return &downloadManager{
 		hp:     hp,
+		hdv2:   hdv2,
 		pss:    pss,
 		slm:    slm,
+		rcp:    rcp,
+		sc:     sc,
 		logger: logger,
 
 		maxOverdrive:     maxOverdrive,
@@ -177,9 +261,14 @@ func newDownloadManager(hp hostProvider, pss partialSlabStore, slm sectorLostMar
 	}
 }
 
-func newDownloader(host hostV3) *downloader {
+func newDownloader(host hostV3, fallback sectorDownloaderV2, cache *sectorCache, hostIP string, lastKnownRevisionNumber uint64) *downloader {
 	return &downloader{
-		host: host,
+		host:     host,
+		fallback: fallback,
+		cache:    cache,
+
+		hostIP:                  hostIP,
+		lastKnownRevisionNumber: lastKnownRevisionNumber,
 
 		statsSectorDownloadEstimateInMS: newDataPoints(statsDecayHalfTime),
 		statsDownloadSpeedBytesPerMS:    newDataPoints(0), // no decay for exposed stats
@@ -254,8 +343,10 @@ func (mgr *downloadManager) DownloadObject(ctx context.Context, w io.Writer, o o
 		hosts[c.HostKey] = struct{}{}
 	}
 
-	// create the cipher writer
-	cw := o.Key.Decrypt(w, offset)
+	// create the cipher writer, we buffer the writes to avoid passing the
+	// recovered data to the caller one leaf at a time
+	bw := bufio.NewWriterSize(w, downloadStreamBufferSize)
+	cw := o.Key.Decrypt(bw, offset)
 
 	// create next slab chan
 	nextSlabChan := make(chan struct{})
@@ -362,6 +453,12 @@ outer:
 						}
 					}
 
+					// stream the slab to the caller
+					if err := bw.Flush(); err != nil {
+						mgr.logger.Errorf("failed to stream slab %v: %v", respIndex, err)
+						return err
+					}
+
 					next = nil
 					delete(responses, respIndex)
 					respIndex++
@@ -467,10 +564,32 @@ func (mgr *downloadManager) Stats() downloadManagerStats {
 		stats[hk] = d.stats()
 	}
 
+	var sectorCache *api.SectorCacheStats
+	if mgr.sc != nil {
+		scs := mgr.sc.Stats()
+		sectorCache = &scs
+	}
+
 	return downloadManagerStats{
 		avgDownloadSpeedMBPS: mgr.statsSlabDownloadSpeedBytesPerMS.Average() * 0.008, // convert bytes per ms to mbps,
 		avgOverdrivePct:      mgr.statsOverdrivePct.Average(),
 		downloaders:          stats,
+		sectorCache:          sectorCache,
+	}
+}
+
+// drainMetrics adds the download speeds and latencies that were observed since
+// the last call to the given performance snapshot.
+func (mgr *downloadManager) drainMetrics(perfs map[types.PublicKey]hostdb.HostPerformance) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	for hk, d := range mgr.downloaders {
+		if mbps, p90 := d.metrics.drain(); mbps > 0 {
+			perf := perfs[hk]
+			perf.DownloadSpeedMBPS = mbps
+			perf.DownloadLatencyP90MS = p90
+			perfs[hk] = perf
+		}
 	}
 }
 
@@ -529,7 +648,7 @@ func (mgr *downloadManager) refreshDownloaders(contracts []api.ContractMetadata)
 	for _, c := range want {
 		// create a host
 		host := mgr.hp.newHostV3(c.ID, c.HostKey, c.SiamuxAddr)
-		downloader := newDownloader(host)
+		downloader := newDownloader(host, mgr.hdv2, mgr.sc, c.HostIP, c.RevisionNumber)
 		mgr.downloaders[c.HostKey] = downloader
 		go downloader.processQueue(mgr.hp)
 	}
@@ -593,8 +712,11 @@ func (d *downloader) stats() downloaderStats {
 	defer d.mu.Unlock()
 	return downloaderStats{
 		avgSpeedMBPS: d.statsDownloadSpeedBytesPerMS.Average() * 0.008,
+		latencyP90MS: d.statsSectorDownloadEstimateInMS.P90(),
 		healthy:      d.consecutiveFailures == 0,
 		numDownloads: d.numDownloads,
+		numFallbacks: d.numFallbacks,
+		queueLength:  uint64(len(d.queue)),
 	}
 }
 
@@ -620,7 +742,7 @@ func (d *downloader) fillBatch() (batch []*sectorDownloadReq) {
 	return
 }
 
-func (d *downloader) processBatch(batch []*sectorDownloadReq) chan struct{} {
+func (d *downloader) processBatch(hp hostProvider, batch []*sectorDownloadReq) chan struct{} {
 	doneChan := make(chan struct{})
 
 	// define some state to keep track of stats
@@ -635,6 +757,7 @@ func (d *downloader) processBatch(batch []*sectorDownloadReq) chan struct{} {
 		durationMS := time.Since(start).Milliseconds()
 		d.statsDownloadSpeedBytesPerMS.Track(float64(downloadedB / durationMS))
 		d.statsSectorDownloadEstimateInMS.Track(float64(durationMS))
+		d.metrics.track(uint64(downloadedB), time.Duration(durationMS)*time.Millisecond)
 		start = time.Time{}
 		downloadedB = 0
 	}
@@ -659,6 +782,7 @@ func (d *downloader) processBatch(batch []*sectorDownloadReq) chan struct{} {
 			// execute the request
 			err := d.execute(req)
 			d.trackFailure(err)
+			hp.trackHostError(d.host.HostKey(), err)
 
 			// update state + potentially track stats
 			mu.Lock()
@@ -725,7 +849,7 @@ outer:
 			}
 
 			// process the batch
-			doneChan := d.processBatch(batch)
+			doneChan := d.processBatch(hp, batch)
 			for {
 				select {
 				case <-d.stopChan:
@@ -752,8 +876,14 @@ func (d *downloader) estimate() float64 {
 		}
 	}
 
-	numSectors := float64(len(d.queue) + 1)
-	return numSectors * estimateP90
+	estimate := float64(len(d.queue)+1) * estimateP90
+	if time.Now().Before(d.penalizedUntil) {
+		estimate *= invalidProofEstimatePenalty
+	}
+	if time.Now().Before(d.fallbackUntil) {
+		estimate *= fallbackV2EstimatePenalty
+	}
+	return estimate
 }
 
 func (d *downloader) enqueue(download *sectorDownloadReq) {
@@ -803,6 +933,11 @@ func (d *downloader) trackFailure(err error) {
 		return // host is not to blame for these errors
 	}
 
+	// penalize hosts that return bad data
+	if isInvalidProof(err) {
+		d.penalizedUntil = time.Now().Add(invalidProofPenaltyDuration)
+	}
+
 	d.consecutiveFailures++
 	d.statsSectorDownloadEstimateInMS.Track(float64(time.Hour.Milliseconds()))
 }
@@ -819,9 +954,10 @@ func (d *downloader) execute(req *sectorDownloadReq) (err error) {
 		span.End()
 	}()
 
-	// download the sector
-	buf := bytes.NewBuffer(make([]byte, 0, rhpv2.SectorSize))
-	err = d.host.DownloadSector(req.ctx, buf, req.root, req.offset, req.length)
+	// download the sector, only the chunk-aligned region of the sector is
+	// requested so there's no need to allocate a full sector
+	buf := bytes.NewBuffer(make([]byte, 0, req.length))
+	err = d.downloadSector(req.ctx, buf, req)
 	if err != nil {
 		req.fail(err)
 		return err
@@ -831,10 +967,42 @@ func (d *downloader) execute(req *sectorDownloadReq) (err error) {
 	d.numDownloads++
 	d.mu.Unlock()
 
+	// add the sector to the cache
+	if d.cache != nil {
+		d.cache.Add(req.root, req.offset, req.length, buf.Bytes())
+	}
+
 	req.succeed(buf.Bytes())
 	return nil
 }
 
+// downloadSector downloads the requested sector over RHPv3, falling back to
+// RHPv2 if the host's siamux endpoint is unavailable.
+func (d *downloader) downloadSector(ctx context.Context, w io.Writer, req *sectorDownloadReq) error {
+	d.mu.Lock()
+	fallback := d.fallback != nil && time.Now().Before(d.fallbackUntil)
+	d.mu.Unlock()
+
+	if !fallback {
+		err := d.host.DownloadSector(ctx, w, req.root, req.offset, req.length)
+		if d.fallback == nil || !isDialTransportV3(err) {
+			return err
+		}
+
+		d.mu.Lock()
+		d.fallbackUntil = time.Now().Add(fallbackV2Duration)
+		d.mu.Unlock()
+	}
+
+	d.mu.Lock()
+	d.numFallbacks++
+	d.mu.Unlock()
+
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("fallback to RHPv2")
+	return d.fallback.DownloadSectorV2(ctx, w, d.hostIP, d.host.HostKey(), d.host.Contract(), d.lastKnownRevisionNumber, req.root, req.offset, req.length)
+}
+
 func (req *sectorDownloadReq) succeed(sector []byte) {
 	req.resps.Add(&sectorDownloadResp{
 		hk:          req.hk,
@@ -936,19 +1104,10 @@ func (s *slabDownload) nextRequest(ctx context.Context, resps *sectorResponses,
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// prepare next sectors to download
-	if len(s.hostToSectors[s.curr]) == 0 {
-		// grab unused hosts
-		var hosts []types.PublicKey
-		for host := range s.hostToSectors {
-			if _, used := s.used[host]; !used {
-				hosts = append(hosts, host)
-			}
-		}
-
-		// make the fastest host the current host
-		s.curr = s.mgr.fastest(hosts)
-		s.used[s.curr] = struct{}{}
+	// prepare next sectors to download, overdrive requests race the current
+	// host so we move on to another host if possible
+	if len(s.hostToSectors[s.curr]) == 0 || overdrive {
+		s.nextHost()
 
 		// no more sectors to download
 		if len(s.hostToSectors[s.curr]) == 0 {
@@ -962,7 +1121,7 @@ func (s *slabDownload) nextRequest(ctx context.Context, resps *sectorResponses,
 
 	// create the span
 	sCtx, span := tracing.Tracer.Start(ctx, "sectorDownloadReq")
-	span.SetAttributes(attribute.Stringer("hk", sector.Host))
+	tracing.SetDetailedAttributes(ctx, span, attribute.Stringer("hk", sector.Host))
 	span.SetAttributes(attribute.Bool("overdrive", overdrive))
 	span.SetAttributes(attribute.Int("sector", sector.index))
 
@@ -981,6 +1140,37 @@ func (s *slabDownload) nextRequest(ctx context.Context, resps *sectorResponses,
 	}
 }
 
+// nextHost makes the best unused host the current host. If all hosts were
+// used, the current host is only replaced if it has no more sectors to
+// download, hosts that were left by an overdrive might still hold sectors.
+// Hosts whose next sector is cached locally are always preferred since they
+// are served without contacting the host.
+func (s *slabDownload) nextHost() {
+	var unused, remaining, cached []types.PublicKey
+	for host, sectors := range s.hostToSectors {
+		if len(sectors) == 0 {
+			continue
+		} else if _, used := s.used[host]; !used {
+			unused = append(unused, host)
+			if s.mgr.sc != nil && s.mgr.sc.Contains(sectors[0].Root, s.offset, s.length) {
+				cached = append(cached, host)
+			}
+		} else {
+			remaining = append(remaining, host)
+		}
+	}
+
+	if len(cached) > 0 {
+		s.curr = s.mgr.best(cached)
+		s.used[s.curr] = struct{}{}
+	} else if len(unused) > 0 {
+		s.curr = s.mgr.best(unused)
+		s.used[s.curr] = struct{}{}
+	} else if len(s.hostToSectors[s.curr]) == 0 {
+		s.curr = s.mgr.best(remaining)
+	}
+}
+
 func (s *slabDownload) downloadShards(ctx context.Context, nextSlabChan chan struct{}) ([][]byte, error) {
 	// cancel any sector downloads once the download is done
 	ctx, cancel := context.WithCancel(ctx)
@@ -1159,26 +1349,88 @@ func (s *slabDownload) receive(resp sectorDownloadResp) (finished bool, next boo
 	return s.numCompleted >= s.minShards, s.numCompleted+int(s.mgr.maxOverdrive) >= s.minShards
 }
 
-func (mgr *downloadManager) fastest(hosts []types.PublicKey) (fastest types.PublicKey) {
+// best returns the host with the lowest score, which is its estimate weighted
+// by how expensive it is to read a sector from it compared to the other hosts.
+// Denied hosts are only considered if all hosts are denied.
+func (mgr *downloadManager) best(hosts []types.PublicKey) (best types.PublicKey) {
 	// recompute stats
 	mgr.tryRecomputeStats()
 
-	// return the fastest host
+	// filter out denied hosts
+	var allowed []types.PublicKey
+	for _, h := range hosts {
+		if !mgr.hp.isDenied(h) {
+			allowed = append(allowed, h)
+		}
+	}
+	if len(allowed) > 0 {
+		hosts = allowed
+	}
+
+	// fetch the costs
+	costs := mgr.relativeReadCosts(hosts)
+	weight := downloadCostWeight
+	if mgr.costSaver.Load() {
+		weight = downloadCostSaverWeight
+	}
+
+	// return the best host
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 	lowest := math.MaxFloat64
 	for _, h := range hosts {
-		if d, ok := mgr.downloaders[h]; !ok {
+		d, ok := mgr.downloaders[h]
+		if !ok {
 			continue
-		} else if estimate := d.estimate(); estimate < lowest {
-			lowest = estimate
-			fastest = h
+		}
+		score := d.estimate()
+		if cost, ok := costs[h]; ok {
+			score *= math.Pow(cost, weight)
+		}
+		if score < lowest {
+			lowest = score
+			best = h
 		}
 	}
 	return
 }
 
+// relativeReadCosts returns the read cost of the given hosts relative to the
+// average read cost, hosts without a known cost are omitted.
+func (mgr *downloadManager) relativeReadCosts(hosts []types.PublicKey) map[types.PublicKey]float64 {
+	if mgr.rcp == nil {
+		return nil
+	}
+
+	costs := make(map[types.PublicKey]float64)
+	var total float64
+	for _, h := range hosts {
+		if c, ok := mgr.rcp.sectorReadCost(h); ok {
+			f, _ := new(big.Float).SetInt(c.Big()).Float64()
+			costs[h] = f
+			total += f
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	avg := total / float64(len(costs))
+	for h, c := range costs {
+		costs[h] = math.Max(c/avg, 0.01) // free hosts still need to be fast
+	}
+	return costs
+}
+
 func (mgr *downloadManager) launch(req *sectorDownloadReq) error {
+	// serve the request from the sector cache if possible
+	if mgr.sc != nil {
+		if sector, ok := mgr.sc.Get(req.root, req.offset, req.length); ok {
+			req.succeed(sector)
+			return nil
+		}
+	}
+
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 
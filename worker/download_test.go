@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+func TestRelativeReadCosts(t *testing.T) {
+	hk1, hk2, hk3, hk4 := types.PublicKey{1}, types.PublicKey{2}, types.PublicKey{3}, types.PublicKey{4}
+	rcp := mockReadCostProvider{
+		hk1: types.NewCurrency64(4),
+		hk2: types.NewCurrency64(1),
+		hk3: types.ZeroCurrency,
+	}
+	mgr := newDownloadManager(newMockHostProvider(), nil, nil, nil, rcp, nil, 0, time.Second, zap.NewNop().Sugar())
+
+	// assert costs are relative to the average cost of the hosts with a known
+	// cost and free hosts don't end up with a cost of zero
+	costs := mgr.relativeReadCosts([]types.PublicKey{hk1, hk2, hk3, hk4})
+	if len(costs) != 3 {
+		t.Fatalf("expected 3 costs, got %v", len(costs))
+	} else if math.Abs(costs[hk1]-12.0/5) > 1e-9 || math.Abs(costs[hk2]-3.0/5) > 1e-9 || costs[hk3] != 0.01 {
+		t.Fatal("unexpected costs", costs)
+	} else if _, ok := costs[hk4]; ok {
+		t.Fatal("expected host without a known cost to be omitted")
+	}
+
+	// assert no costs are returned if they are all unknown or zero
+	if costs := mgr.relativeReadCosts([]types.PublicKey{hk3, hk4}); costs != nil {
+		t.Fatal("unexpected costs", costs)
+	}
+
+	// assert no costs are returned without a cost provider
+	mgr.rcp = nil
+	if costs := mgr.relativeReadCosts([]types.PublicKey{hk1, hk2}); costs != nil {
+		t.Fatal("unexpected costs", costs)
+	}
+}
+
+func TestDownloadManagerBest(t *testing.T) {
+	b := newMockBus()
+	hp := newMockHostProvider()
+	b.addHosts(hp, 3)
+	fast, cheap, unknown := b.contracts[0].HostKey, b.contracts[1].HostKey, b.contracts[2].HostKey
+
+	// the fast host is expensive, the cheap host is slow and the cost of the
+	// third host is unknown
+	rcp := mockReadCostProvider{
+		fast:  types.NewCurrency64(4),
+		cheap: types.NewCurrency64(1),
+	}
+	mgr := newDownloadManager(hp, nil, nil, nil, rcp, nil, 0, time.Second, zap.NewNop().Sugar())
+	for hk, estimate := range map[types.PublicKey]float64{fast: 10, cheap: 40, unknown: 20} {
+		d := newDownloader(hp.hosts[hk], nil, nil, "", 0)
+		d.statsSectorDownloadEstimateInMS.Track(estimate)
+		mgr.downloaders[hk] = d
+	}
+	hosts := []types.PublicKey{fast, cheap, unknown}
+
+	// assert speed dominates by default
+	if best := mgr.best(hosts); best != fast {
+		t.Fatal("expected the fast host to be the best")
+	}
+
+	// assert cheaper hosts are favoured in cost saver mode
+	mgr.costSaver.Store(true)
+	if best := mgr.best(hosts); best != cheap {
+		t.Fatal("expected the cheap host to be the best")
+	}
+	mgr.costSaver.Store(false)
+
+	// assert denied hosts are skipped unless all hosts are denied
+	hp.denyList.Deny(fast, api.DenyReasonCorruptData, ErrInvalidMerkleProof, time.Now().Add(time.Minute))
+	if best := mgr.best(hosts); best != unknown {
+		t.Fatal("expected the host with an unknown cost to be the best")
+	} else if best := mgr.best([]types.PublicKey{fast}); best != fast {
+		t.Fatal("expected the denied host to be used if it's the only one")
+	}
+
+	// assert hosts without a downloader are ignored
+	if best := mgr.best([]types.PublicKey{{9}}); best != (types.PublicKey{}) {
+		t.Fatal("expected no host")
+	}
+}
@@ -0,0 +1,226 @@
+package worker
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.sia.tech/core/types"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	// downloadCacheMaxEntryRatio defines the max size of a single cache entry
+	// relative to the size of the cache, larger ranges are not cached to
+	// avoid a single download evicting the entire cache.
+	downloadCacheMaxEntryRatio = 10
+
+	// downloadCacheFileExt is the extension of the files the cache creates,
+	// only files with this extension are removed when the cache is created.
+	downloadCacheFileExt = ".range"
+)
+
+var errDownloadCacheMiss = errors.New("download cache miss")
+
+type (
+	// downloadCache is a bounded on-disk cache of plaintext object ranges.
+	// Entries are encrypted using a key derived from the worker's master key
+	// and are keyed by object, range and ETag, this way an overwritten object
+	// never serves stale data. Entries of an object are invalidated when the
+	// object is overwritten or deleted by the worker.
+	downloadCache struct {
+		dir          string
+		key          types.PrivateKey
+		maxSize      uint64
+		maxEntrySize uint64
+
+		mu      sync.Mutex
+		size    uint64
+		lru     *list.List
+		entries map[string]*list.Element
+		objects map[string]map[string]struct{}
+	}
+
+	downloadCacheEntry struct {
+		name      string
+		objectKey string
+		size      uint64
+	}
+)
+
+func newDownloadCache(dir string, maxSize uint64, key types.PrivateKey) (*downloadCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create download cache dir: %w", err)
+	}
+
+	// the cache doesn't survive restarts, remove the ranges of a previous run
+	// but leave any other files in the directory alone
+	files, err := filepath.Glob(filepath.Join(dir, "*"+downloadCacheFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list download cache dir: %w", err)
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return nil, fmt.Errorf("failed to clear download cache dir: %w", err)
+		}
+	}
+	return &downloadCache{
+		dir:          dir,
+		key:          key,
+		maxSize:      maxSize,
+		maxEntrySize: maxSize / downloadCacheMaxEntryRatio,
+
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		objects: make(map[string]map[string]struct{}),
+	}, nil
+}
+
+// Download writes the given range of the object to w, either from the cache
+// or by calling downloadFn, in which case the range is added to the cache.
+func (c *downloadCache) Download(w io.Writer, bucket, path, eTag string, offset, length int64, downloadFn func(w io.Writer) error) error {
+	// objects without an ETag and large ranges are not cached
+	if eTag == "" || length <= 0 || uint64(length) > c.maxEntrySize {
+		return downloadFn(w)
+	}
+
+	objectKey := downloadCacheObjectKey(bucket, path)
+	name := downloadCacheEntryName(objectKey, eTag, offset, length)
+	if err := c.read(w, name); err == nil {
+		return nil
+	} else if !errors.Is(err, errDownloadCacheMiss) {
+		return err
+	}
+
+	// download the range, keeping a copy in memory
+	buf := bytes.NewBuffer(make([]byte, 0, length))
+	if err := downloadFn(io.MultiWriter(w, buf)); err != nil {
+		return err
+	}
+	c.write(objectKey, name, buf.Bytes())
+	return nil
+}
+
+// Invalidate removes all cached ranges of the given object.
+func (c *downloadCache) Invalidate(bucket, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidateObject(downloadCacheObjectKey(bucket, path))
+}
+
+// InvalidatePrefix removes all cached ranges of objects whose path starts
+// with the given prefix.
+func (c *downloadCache) InvalidatePrefix(bucket, prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keyPrefix := downloadCacheObjectKey(bucket, prefix)
+	for objectKey := range c.objects {
+		if strings.HasPrefix(objectKey, keyPrefix) {
+			c.invalidateObject(objectKey)
+		}
+	}
+}
+
+func (c *downloadCache) invalidateObject(objectKey string) {
+	for name := range c.objects[objectKey] {
+		if el, ok := c.entries[name]; ok {
+			c.removeEntry(el)
+		}
+	}
+}
+
+func (c *downloadCache) read(w io.Writer, name string) error {
+	c.mu.Lock()
+	el, ok := c.entries[name]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return errDownloadCacheMiss
+	}
+
+	data, err := os.ReadFile(c.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return errDownloadCacheMiss // evicted in the meantime
+	} else if err != nil {
+		return err
+	}
+	c.xorKeyStream(name, data)
+	_, err = w.Write(data)
+	return err
+}
+
+func (c *downloadCache) write(objectKey, name string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[name]; exists {
+		return
+	}
+
+	// evict entries until the new entry fits
+	size := uint64(len(data))
+	for c.size+size > c.maxSize && c.lru.Len() > 0 {
+		c.removeEntry(c.lru.Back())
+	}
+
+	// encrypt a copy of the data, the original might still be referenced
+	encrypted := append([]byte(nil), data...)
+	c.xorKeyStream(name, encrypted)
+	if err := os.WriteFile(c.path(name), encrypted, 0600); err != nil {
+		return // caching is best effort
+	}
+
+	c.entries[name] = c.lru.PushFront(&downloadCacheEntry{
+		name:      name,
+		objectKey: objectKey,
+		size:      size,
+	})
+	if _, exists := c.objects[objectKey]; !exists {
+		c.objects[objectKey] = make(map[string]struct{})
+	}
+	c.objects[objectKey][name] = struct{}{}
+	c.size += size
+}
+
+func (c *downloadCache) removeEntry(el *list.Element) {
+	entry := c.lru.Remove(el).(*downloadCacheEntry)
+	delete(c.entries, entry.name)
+	delete(c.objects[entry.objectKey], entry.name)
+	if len(c.objects[entry.objectKey]) == 0 {
+		delete(c.objects, entry.objectKey)
+	}
+	c.size -= entry.size
+	_ = os.Remove(c.path(entry.name))
+}
+
+// path returns the path of the file of the entry with the given name.
+func (c *downloadCache) path(name string) string {
+	return filepath.Join(c.dir, name+downloadCacheFileExt)
+}
+
+// xorKeyStream encrypts or decrypts the data of the entry with the given name
+// in place. Every entry uses its own key, entries are never rewritten with
+// different data since their name is derived from the object's ETag.
+func (c *downloadCache) xorKeyStream(name string, data []byte) {
+	key := blake2b.Sum256(append(append([]byte(nil), c.key...), name...))
+	cipher, _ := chacha20.NewUnauthenticatedCipher(key[:], make([]byte, chacha20.NonceSize))
+	cipher.XORKeyStream(data, data)
+}
+
+func downloadCacheObjectKey(bucket, path string) string {
+	return bucket + "/" + path
+}
+
+func downloadCacheEntryName(objectKey, eTag string, offset, length int64) string {
+	h := blake2b.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%d", objectKey, eTag, offset, length)))
+	return hex.EncodeToString(h[:])
+}
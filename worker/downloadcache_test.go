@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"lukechampine.com/frand"
+)
+
+func TestDownloadCacheDir(t *testing.T) {
+	dir := t.TempDir()
+
+	// create a file that doesn't belong to the cache
+	other := filepath.Join(dir, "other.txt")
+	if err := os.WriteFile(other, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// cache a range
+	key := types.GeneratePrivateKey()
+	c, err := newDownloadCache(dir, 1000, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := frand.Bytes(50)
+	var buf bytes.Buffer
+	if err := c.Download(&buf, "bucket", "foo", "etag", 0, 50, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	} else if files, _ := filepath.Glob(filepath.Join(dir, "*"+downloadCacheFileExt)); len(files) != 1 {
+		t.Fatalf("expected 1 cached range, got %v", len(files))
+	}
+
+	// assert the range is served from the cache
+	buf.Reset()
+	if err := c.Download(&buf, "bucket", "foo", "etag", 0, 50, func(w io.Writer) error {
+		t.Fatal("unexpected download")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("unexpected data")
+	}
+
+	// recreate the cache and assert only the cached range was removed
+	if _, err := newDownloadCache(dir, 1000, key); err != nil {
+		t.Fatal(err)
+	} else if files, _ := filepath.Glob(filepath.Join(dir, "*"+downloadCacheFileExt)); len(files) != 0 {
+		t.Fatalf("expected no cached ranges, got %v", len(files))
+	} else if _, err := os.Stat(other); err != nil {
+		t.Fatal("file was removed", err)
+	}
+}
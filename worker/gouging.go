@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	rhpv2 "go.sia.tech/core/rhp/v2"
@@ -34,6 +35,7 @@ const (
 type (
 	GougingChecker interface {
 		Check(*rhpv2.HostSettings, *rhpv3.HostPriceTable) api.HostGougingBreakdown
+		CheckPriceTablePayment(rhpv3.HostPriceTable) error
 	}
 
 	gougingChecker struct {
@@ -50,6 +52,25 @@ type (
 
 var _ GougingChecker = gougingChecker{}
 
+var (
+	// errPriceTableGouging is returned when we refuse to pay for a price
+	// table because the host is gouging.
+	errPriceTableGouging = errors.New("host price table gouging")
+
+	// priceTablePaymentFields are the price table fields that are checked
+	// before paying for a price table.
+	priceTablePaymentFields = map[string]struct{}{
+		"AccountBalanceCost":   {},
+		"DownloadPricePerTiB":  {},
+		"FundAccountCost":      {},
+		"InitBaseCost":         {},
+		"ReadLengthCost":       {},
+		"UpdatePriceTableCost": {},
+		"UploadPricePerTiB":    {},
+		"WriteLengthCost":      {},
+	}
+)
+
 func GougingCheckerFromContext(ctx context.Context) (GougingChecker, error) {
 	gc, ok := ctx.Value(keyGougingChecker).(func() (GougingChecker, error))
 	if !ok {
@@ -102,6 +123,12 @@ func (gc gougingChecker) Check(hs *rhpv2.HostSettings, pt *rhpv3.HostPriceTable)
 	return
 }
 
+// CheckPriceTablePayment checks the costs of a price table we are about to pay
+// for, the returned error lists all fields that violate the gouging settings.
+func (gc gougingChecker) CheckPriceTablePayment(pt rhpv3.HostPriceTable) error {
+	return checkPriceTablePaymentGouging(gc.settings, pt)
+}
+
 func (gc gougingChecker) checkHS(hs *rhpv2.HostSettings) (check api.GougingChecks) {
 	if hs != nil {
 		check = api.GougingChecks{
@@ -180,138 +207,153 @@ func checkPriceGougingHS(gs api.GougingSettings, hs rhpv2.HostSettings) error {
 // always set to 1H we should account for those fields in
 // `hostPeriodCostForScore` as well.
 func checkPriceGougingPT(gs api.GougingSettings, cs api.ConsensusState, txnFee types.Currency, pt rhpv3.HostPriceTable) error {
-	// check base rpc price
-	if !gs.MaxRPCPrice.IsZero() && gs.MaxRPCPrice.Cmp(pt.InitBaseCost) < 0 {
-		return fmt.Errorf("init base cost exceeds max: %v > %v", pt.InitBaseCost, gs.MaxRPCPrice)
-	}
-
-	// check contract price
-	if !gs.MaxContractPrice.IsZero() && pt.ContractPrice.Cmp(gs.MaxContractPrice) > 0 {
-		return fmt.Errorf("contract price exceeds max: %v > %v", pt.ContractPrice, gs.MaxContractPrice)
-	}
-
-	// check max storage
-	if !gs.MaxStoragePrice.IsZero() && pt.WriteStoreCost.Cmp(gs.MaxStoragePrice) > 0 {
-		return fmt.Errorf("storage price exceeds max: %v > %v", pt.WriteStoreCost, gs.MaxStoragePrice)
-	}
-
-	// check max collateral
-	if pt.MaxCollateral.IsZero() {
-		return errors.New("MaxCollateral of host is 0")
-	}
-	if pt.MaxCollateral.Cmp(gs.MinMaxCollateral) < 0 {
-		return fmt.Errorf("MaxCollateral is below minimum: %v < %v", pt.MaxCollateral, gs.MinMaxCollateral)
-	}
-
-	// check ReadLengthCost - should be 1H as it's unused by hosts
-	if types.NewCurrency64(1).Cmp(pt.ReadLengthCost) < 0 {
-		return fmt.Errorf("ReadLengthCost of host is %v but should be %v", pt.ReadLengthCost, types.NewCurrency64(1))
-	}
-
-	// check WriteLengthCost - should be 1H as it's unused by hosts
-	if types.NewCurrency64(1).Cmp(pt.WriteLengthCost) < 0 {
-		return fmt.Errorf("WriteLengthCost of %v exceeds 1H", pt.WriteLengthCost)
-	}
-
-	// check AccountBalanceCost - should be 1H as it's unused by hosts
-	if types.NewCurrency64(1).Cmp(pt.AccountBalanceCost) < 0 {
-		return fmt.Errorf("AccountBalanceCost of %v exceeds 1H", pt.AccountBalanceCost)
-	}
-
-	// check FundAccountCost - should be 1H as it's unused by hosts
-	if types.NewCurrency64(1).Cmp(pt.FundAccountCost) < 0 {
-		return fmt.Errorf("FundAccountCost of %v exceeds 1H", pt.FundAccountCost)
-	}
-
-	// check UpdatePriceTableCost - should be 1H as it's unused by hosts
-	if types.NewCurrency64(1).Cmp(pt.UpdatePriceTableCost) < 0 {
-		return fmt.Errorf("UpdatePriceTableCost of %v exceeds 1H", pt.UpdatePriceTableCost)
-	}
-
-	// check HasSectorBaseCost - should be 1H as it's unused by hosts
-	if types.NewCurrency64(1).Cmp(pt.HasSectorBaseCost) < 0 {
-		return fmt.Errorf("HasSectorBaseCost of %v exceeds 1H", pt.HasSectorBaseCost)
-	}
-
-	// check MemoryTimeCost - should be 1H as it's unused by hosts
-	if types.NewCurrency64(1).Cmp(pt.MemoryTimeCost) < 0 {
-		return fmt.Errorf("MemoryTimeCost of %v exceeds 1H", pt.MemoryTimeCost)
-	}
-
-	// check DropSectorsBaseCost - should be 1H as it's unused by hosts
-	if types.NewCurrency64(1).Cmp(pt.DropSectorsBaseCost) < 0 {
-		return fmt.Errorf("DropSectorsBaseCost of %v exceeds 1H", pt.DropSectorsBaseCost)
+	for _, field := range priceTableGougingFields(gs, cs, txnFee, pt) {
+		if field.Gouging {
+			return fmt.Errorf("%v of %v is not %v", field.Name, field.Value, field.Limit)
+		}
 	}
+	return nil
+}
 
-	// check DropSectorsUnitCost - should be 1H as it's unused by hosts
-	if types.NewCurrency64(1).Cmp(pt.DropSectorsUnitCost) < 0 {
-		return fmt.Errorf("DropSectorsUnitCost of %v exceeds 1H", pt.DropSectorsUnitCost)
+// priceTableGougingFields compares the fields of the price table that are
+// subject to the gouging settings to the limits imposed on them. It's the
+// single source of truth for the price table checks, the gouging checker
+// rejects a price table if any of the fields is gouging.
+func priceTableGougingFields(gs api.GougingSettings, cs api.ConsensusState, txnFee types.Currency, pt rhpv3.HostPriceTable) (fields []api.GougingField) {
+	max := func(name string, value, limit types.Currency) {
+		fields = append(fields, api.GougingField{
+			Name:    name,
+			Value:   value.String(),
+			Limit:   "<= " + limit.String(),
+			Gouging: value.Cmp(limit) > 0,
+		})
 	}
 
-	// check SwapSectorBaseCost - should be 1H as it's unused by hosts
-	if types.NewCurrency64(1).Cmp(pt.SwapSectorBaseCost) < 0 {
-		return fmt.Errorf("SwapSectorBaseCost of %v exceeds 1H", pt.SwapSectorBaseCost)
+	// check the prices that are limited by the settings, a limit of zero
+	// means the price is not limited
+	if !gs.MaxRPCPrice.IsZero() {
+		max("InitBaseCost", pt.InitBaseCost, gs.MaxRPCPrice)
 	}
-
-	// check SubscriptionMemoryCost - expect 1H default
-	if types.NewCurrency64(1).Cmp(pt.SubscriptionMemoryCost) < 0 {
-		return fmt.Errorf("SubscriptionMemoryCost of %v exceeds 1H", pt.SubscriptionMemoryCost)
+	if !gs.MaxContractPrice.IsZero() {
+		max("ContractPrice", pt.ContractPrice, gs.MaxContractPrice)
 	}
-
-	// check SubscriptionNotificationCost - expect 1H default
-	if types.NewCurrency64(1).Cmp(pt.SubscriptionNotificationCost) < 0 {
-		return fmt.Errorf("SubscriptionNotificationCost of %v exceeds 1H", pt.SubscriptionNotificationCost)
+	if !gs.MaxStoragePrice.IsZero() {
+		max("WriteStoreCost", pt.WriteStoreCost, gs.MaxStoragePrice)
 	}
 
-	// check LatestRevisionCost - expect sane value
-	maxRevisionCost := gs.MaxDownloadPrice.Div64(1 << 40).Mul64(4096)
-	if pt.LatestRevisionCost.Cmp(maxRevisionCost) > 0 {
-		return fmt.Errorf("LatestRevisionCost of %v exceeds maximum cost of %v", pt.LatestRevisionCost, maxRevisionCost)
-	}
+	// check max collateral
+	fields = append(fields, api.GougingField{
+		Name:    "MaxCollateral",
+		Value:   pt.MaxCollateral.String(),
+		Limit:   ">= " + gs.MinMaxCollateral.String(),
+		Gouging: pt.MaxCollateral.IsZero() || pt.MaxCollateral.Cmp(gs.MinMaxCollateral) < 0,
+	})
 
-	// check RenewContractCost - expect 100nS default
-	if types.Siacoins(1).Mul64(100).Div64(1e9).Cmp(pt.RenewContractCost) < 0 {
-		return fmt.Errorf("RenewContractCost of %v exceeds 100nS", pt.RenewContractCost)
-	}
-
-	// check RevisionBaseCost - expect 0H default
-	if types.ZeroCurrency.Cmp(pt.RevisionBaseCost) < 0 {
-		return fmt.Errorf("RevisionBaseCost of %v exceeds 0H", pt.RevisionBaseCost)
-	}
+	// check the costs that should be 1H as they're unused by hosts
+	oneH := types.NewCurrency64(1)
+	max("ReadLengthCost", pt.ReadLengthCost, oneH)
+	max("WriteLengthCost", pt.WriteLengthCost, oneH)
+	max("AccountBalanceCost", pt.AccountBalanceCost, oneH)
+	max("FundAccountCost", pt.FundAccountCost, oneH)
+	max("UpdatePriceTableCost", pt.UpdatePriceTableCost, oneH)
+	max("HasSectorBaseCost", pt.HasSectorBaseCost, oneH)
+	max("MemoryTimeCost", pt.MemoryTimeCost, oneH)
+	max("DropSectorsBaseCost", pt.DropSectorsBaseCost, oneH)
+	max("DropSectorsUnitCost", pt.DropSectorsUnitCost, oneH)
+	max("SwapSectorBaseCost", pt.SwapSectorBaseCost, oneH)
+	max("SubscriptionMemoryCost", pt.SubscriptionMemoryCost, oneH)
+	max("SubscriptionNotificationCost", pt.SubscriptionNotificationCost, oneH)
+
+	// check the costs that should have sane or default values
+	max("LatestRevisionCost", pt.LatestRevisionCost, gs.MaxDownloadPrice.Div64(1<<40).Mul64(4096))
+	max("RenewContractCost", pt.RenewContractCost, types.Siacoins(1).Mul64(100).Div64(1e9))
+	max("RevisionBaseCost", pt.RevisionBaseCost, types.ZeroCurrency)
 
 	// check block height - if too much time has passed since the last block
 	// there is a chance we are not up-to-date anymore. So we only check whether
 	// the host's height is at least equal to ours.
 	if !cs.Synced || time.Since(cs.LastBlockTime) > time.Hour {
-		if pt.HostBlockHeight < cs.BlockHeight {
-			return fmt.Errorf("consensus not synced and host block height is lower, %v < %v", pt.HostBlockHeight, cs.BlockHeight)
-		}
+		fields = append(fields, api.GougingField{
+			Name:    "HostBlockHeight",
+			Value:   fmt.Sprint(pt.HostBlockHeight),
+			Limit:   fmt.Sprintf(">= %d", cs.BlockHeight),
+			Gouging: pt.HostBlockHeight < cs.BlockHeight,
+		})
 	} else {
 		var min uint64
 		if cs.BlockHeight >= uint64(gs.HostBlockHeightLeeway) {
 			min = cs.BlockHeight - uint64(gs.HostBlockHeightLeeway)
 		}
 		max := cs.BlockHeight + uint64(gs.HostBlockHeightLeeway)
-		if !(min <= pt.HostBlockHeight && pt.HostBlockHeight <= max) {
-			return fmt.Errorf("consensus is synced and host block height is not within range, %v-%v %v", min, max, pt.HostBlockHeight)
-		}
-	}
+		fields = append(fields, api.GougingField{
+			Name:    "HostBlockHeight",
+			Value:   fmt.Sprint(pt.HostBlockHeight),
+			Limit:   fmt.Sprintf("%d-%d", min, max),
+			Gouging: pt.HostBlockHeight < min || pt.HostBlockHeight > max,
+		})
+	}
+
+	// check the recommended txn fees, expect the max to be at most a multiple
+	// of our fee and the min to be lower or equal than the max
+	if !txnFee.IsZero() {
+		max("TxnFeeMaxRecommended", pt.TxnFeeMaxRecommended, txnFee.Mul64(5))
+	}
+	max("TxnFeeMinRecommended", pt.TxnFeeMinRecommended, pt.TxnFeeMaxRecommended)
+
+	// check validity
+	fields = append(fields, api.GougingField{
+		Name:    "Validity",
+		Value:   pt.Validity.String(),
+		Limit:   ">= " + gs.MinPriceTableValidity.String(),
+		Gouging: pt.Validity < gs.MinPriceTableValidity,
+	})
+	return
+}
 
-	// check TxnFeeMaxRecommended - expect at most a multiple of our fee
-	if !txnFee.IsZero() && pt.TxnFeeMaxRecommended.Cmp(txnFee.Mul64(5)) > 0 {
-		return fmt.Errorf("TxnFeeMaxRecommended %v exceeds %v", pt.TxnFeeMaxRecommended, txnFee.Mul64(5))
-	}
+// explainPriceGougingPT compares all fields of the price table that are subject
+// to the gouging settings to the limits imposed on them, including the download
+// and upload prices, it's meant to help users figure out why a host is
+// considered to be gouging.
+func explainPriceGougingPT(gs api.GougingSettings, cs api.ConsensusState, txnFee types.Currency, pt rhpv3.HostPriceTable) []api.GougingField {
+	return append(priceTableGougingFields(gs, cs, txnFee, pt), transferGougingFields(gs, pt)...)
+}
 
-	// check TxnFeeMinRecommended - expect it to be lower or equal than the max
-	if pt.TxnFeeMinRecommended.Cmp(pt.TxnFeeMaxRecommended) > 0 {
-		return fmt.Errorf("TxnFeeMinRecommended is greater than TxnFeeMaxRecommended, %v > %v", pt.TxnFeeMinRecommended, pt.TxnFeeMaxRecommended)
+// transferGougingFields compares the download and upload prices per TiB of the
+// price table to the limits imposed on them.
+func transferGougingFields(gs api.GougingSettings, pt rhpv3.HostPriceTable) (fields []api.GougingField) {
+	transfer := func(name string, price types.Currency, err error, limit types.Currency) {
+		if limit.IsZero() {
+			return
+		}
+		field := api.GougingField{Name: name, Limit: "<= " + limit.String()}
+		if err != nil {
+			field.Value, field.Gouging = err.Error(), true
+		} else {
+			field.Value, field.Gouging = price.String(), price.Cmp(limit) > 0
+		}
+		fields = append(fields, field)
 	}
+	dpptb, err := downloadPricePerTiBRHPv3(pt)
+	transfer("DownloadPricePerTiB", dpptb, err, gs.MaxDownloadPrice)
+	upptb, err := uploadPricePerTiBRHPv3(pt)
+	transfer("UploadPricePerTiB", upptb, err, gs.MaxUploadPrice)
+	return
+}
 
-	// check Validity
-	if pt.Validity < gs.MinPriceTableValidity {
-		return fmt.Errorf("'Validity' is less than the allowed minimum value, %v < %v", pt.Validity, gs.MinPriceTableValidity)
+// checkPriceTablePaymentGouging checks the fields of a price table that affect
+// the cost of paying for it and using it, it's a subset of the fields checked
+// by the gouging checker that doesn't depend on the consensus state.
+func checkPriceTablePaymentGouging(gs api.GougingSettings, pt rhpv3.HostPriceTable) error {
+	var violations []string
+	fields := append(priceTableGougingFields(gs, api.ConsensusState{}, types.ZeroCurrency, pt), transferGougingFields(gs, pt)...)
+	for _, field := range fields {
+		if _, ok := priceTablePaymentFields[field.Name]; ok && field.Gouging {
+			violations = append(violations, fmt.Sprintf("%v %v is not %v", field.Name, field.Value, field.Limit))
+		}
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%w: %v", errPriceTableGouging, strings.Join(violations, "; "))
 	}
-
 	return nil
 }
 
@@ -348,13 +390,9 @@ func checkContractGouging(period, renewWindow, maxDuration, windowSize uint64) e
 }
 
 func checkDownloadGougingRHPv3(gs api.GougingSettings, pt rhpv3.HostPriceTable) error {
-	sectorDownloadPrice, overflow := sectorReadCostRHPv3(pt)
-	if overflow {
-		return fmt.Errorf("overflow detected when computing sector download price")
-	}
-	dpptb, overflow := sectorDownloadPrice.Mul64WithOverflow(1 << 40 / rhpv2.SectorSize) // sectors per TiB
-	if overflow {
-		return fmt.Errorf("overflow detected when computing download price per TiB")
+	dpptb, err := downloadPricePerTiBRHPv3(pt)
+	if err != nil {
+		return err
 	}
 	if !gs.MaxDownloadPrice.IsZero() && dpptb.Cmp(gs.MaxDownloadPrice) > 0 {
 		return fmt.Errorf("cost per TiB exceeds max dl price: %v > %v", dpptb, gs.MaxDownloadPrice)
@@ -363,18 +401,38 @@ func checkDownloadGougingRHPv3(gs api.GougingSettings, pt rhpv3.HostPriceTable)
 }
 
 func checkUploadGougingRHPv3(gs api.GougingSettings, pt rhpv3.HostPriceTable) error {
+	uploadPrice, err := uploadPricePerTiBRHPv3(pt)
+	if err != nil {
+		return err
+	}
+	if !gs.MaxUploadPrice.IsZero() && uploadPrice.Cmp(gs.MaxUploadPrice) > 0 {
+		return fmt.Errorf("cost per TiB exceeds max ul price: %v > %v", uploadPrice, gs.MaxUploadPrice)
+	}
+	return nil
+}
+
+func downloadPricePerTiBRHPv3(pt rhpv3.HostPriceTable) (types.Currency, error) {
+	sectorDownloadPrice, overflow := sectorReadCostRHPv3(pt)
+	if overflow {
+		return types.ZeroCurrency, fmt.Errorf("overflow detected when computing sector download price")
+	}
+	dpptb, overflow := sectorDownloadPrice.Mul64WithOverflow(1 << 40 / rhpv2.SectorSize) // sectors per TiB
+	if overflow {
+		return types.ZeroCurrency, fmt.Errorf("overflow detected when computing download price per TiB")
+	}
+	return dpptb, nil
+}
+
+func uploadPricePerTiBRHPv3(pt rhpv3.HostPriceTable) (types.Currency, error) {
 	sectorUploadPricePerMonth, overflow := sectorUploadCostRHPv3(pt)
 	if overflow {
-		return fmt.Errorf("overflow detected when computing sector price")
+		return types.ZeroCurrency, fmt.Errorf("overflow detected when computing sector price")
 	}
 	uploadPrice, overflow := sectorUploadPricePerMonth.Mul64WithOverflow(1 << 40 / rhpv2.SectorSize) // sectors per TiB
 	if overflow {
-		return fmt.Errorf("overflow detected when computing upload price per TiB")
+		return types.ZeroCurrency, fmt.Errorf("overflow detected when computing upload price per TiB")
 	}
-	if !gs.MaxUploadPrice.IsZero() && uploadPrice.Cmp(gs.MaxUploadPrice) > 0 {
-		return fmt.Errorf("cost per TiB exceeds max ul price: %v > %v", uploadPrice, gs.MaxUploadPrice)
-	}
-	return nil
+	return uploadPrice, nil
 }
 
 func sectorReadCostRHPv3(pt rhpv3.HostPriceTable) (types.Currency, bool) {
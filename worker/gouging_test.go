@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rhpv3 "go.sia.tech/core/rhp/v3"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestPriceTableGougingFields(t *testing.T) {
+	gs := api.GougingSettings{
+		MaxDownloadPrice:      types.Siacoins(3000),
+		MaxUploadPrice:        types.Siacoins(3000),
+		MinMaxCollateral:      types.Siacoins(10),
+		MinPriceTableValidity: time.Minute,
+	}
+	cs := api.ConsensusState{BlockHeight: 100}
+	pt := rhpv3.HostPriceTable{
+		HostBlockHeight:      100,
+		MaxCollateral:        types.Siacoins(1000),
+		UpdatePriceTableCost: types.NewCurrency64(1),
+		Validity:             time.Hour,
+	}
+
+	gouging := func(fields []api.GougingField) (names []string) {
+		for _, field := range fields {
+			if field.Gouging {
+				names = append(names, field.Name)
+			}
+		}
+		return
+	}
+
+	// assert a sane price table passes all checks
+	if err := checkPriceGougingPT(gs, cs, types.ZeroCurrency, pt); err != nil {
+		t.Fatal(err)
+	} else if err := checkPriceTablePaymentGouging(gs, pt); err != nil {
+		t.Fatal(err)
+	} else if names := gouging(explainPriceGougingPT(gs, cs, types.ZeroCurrency, pt)); len(names) != 0 {
+		t.Fatal("unexpected gouging fields", names)
+	}
+
+	// assert a price table that's too expensive to pay for is rejected by
+	// all checks
+	pt.UpdatePriceTableCost = types.NewCurrency64(2)
+	if err := checkPriceGougingPT(gs, cs, types.ZeroCurrency, pt); err == nil {
+		t.Fatal("expected gouging error")
+	} else if err := checkPriceTablePaymentGouging(gs, pt); !errors.Is(err, errPriceTableGouging) {
+		t.Fatal("unexpected error", err)
+	} else if names := gouging(explainPriceGougingPT(gs, cs, types.ZeroCurrency, pt)); len(names) != 1 || names[0] != "UpdatePriceTableCost" {
+		t.Fatal("unexpected gouging fields", names)
+	}
+
+	// assert fields that don't affect the payment only fail the gouging check
+	pt.UpdatePriceTableCost = types.NewCurrency64(1)
+	pt.Validity = time.Second
+	if err := checkPriceGougingPT(gs, cs, types.ZeroCurrency, pt); err == nil {
+		t.Fatal("expected gouging error")
+	} else if err := checkPriceTablePaymentGouging(gs, pt); err != nil {
+		t.Fatal(err)
+	} else if names := gouging(explainPriceGougingPT(gs, cs, types.ZeroCurrency, pt)); len(names) != 1 || names[0] != "Validity" {
+		t.Fatal("unexpected gouging fields", names)
+	}
+
+	// assert the download price is explained and checked before paying
+	pt.Validity = time.Hour
+	pt.ReadBaseCost = types.Siacoins(1)
+	if err := checkDownloadGougingRHPv3(gs, pt); err == nil {
+		t.Fatal("expected download gouging error")
+	} else if err := checkPriceTablePaymentGouging(gs, pt); !errors.Is(err, errPriceTableGouging) {
+		t.Fatal("unexpected error", err)
+	} else if names := gouging(explainPriceGougingPT(gs, cs, types.ZeroCurrency, pt)); len(names) != 1 || names[0] != "DownloadPricePerTiB" {
+		t.Fatal("unexpected gouging fields", names)
+	}
+}
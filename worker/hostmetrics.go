@@ -0,0 +1,136 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/montanaflynn/stats"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+)
+
+// hostMetricsRecordInterval is the interval at which a snapshot of the
+// performance of the hosts is stored in the bus.
+const hostMetricsRecordInterval = 5 * time.Minute
+
+// transferMetricsMaxSamples is the maximum number of transfers that are taken
+// into account per host and snapshot.
+const transferMetricsMaxSamples = 1000
+
+// transferMetrics collects the speeds and latencies of the transfers with a
+// host since they were last drained, that way every snapshot only reflects
+// the performance of the host within the snapshot interval.
+type transferMetrics struct {
+	mu        sync.Mutex
+	speeds    stats.Float64Data // bytes per ms
+	latencies stats.Float64Data // ms
+}
+
+func (m *transferMetrics) track(bytes uint64, d time.Duration) {
+	ms := d.Milliseconds()
+	if ms == 0 {
+		ms = 1
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.latencies) < transferMetricsMaxSamples {
+		m.speeds = append(m.speeds, float64(bytes)/float64(ms))
+		m.latencies = append(m.latencies, float64(ms))
+	}
+}
+
+// drain returns the average speed and the p90 latency of the transfers that
+// were tracked since the last call to drain and resets the metrics.
+func (m *transferMetrics) drain() (speedMBPS, latencyP90MS float64) {
+	m.mu.Lock()
+	speeds, latencies := m.speeds, m.latencies
+	m.speeds, m.latencies = nil, nil
+	m.mu.Unlock()
+
+	if len(speeds) == 0 {
+		return 0, 0
+	}
+	avg, _ := speeds.Mean()
+	p90, _ := latencies.Percentile(90)
+	return avg * 0.008, p90 // convert bytes per ms to mbps
+}
+
+// hostMetricsRecorder periodically stores the upload and download speeds and
+// latencies the worker observed per host in the bus, that way the autopilot
+// can take the actual performance of a host into account when scoring it.
+type hostMetricsRecorder struct {
+	w        *worker
+	stopChan chan struct{}
+
+	interval time.Duration
+}
+
+func (w *worker) initHostMetricsRecorder(interval time.Duration) {
+	if w.hostMetricsRecorder != nil {
+		panic("host metrics recorder already initialized") // developer error
+	}
+	w.hostMetricsRecorder = &hostMetricsRecorder{
+		w:        w,
+		stopChan: make(chan struct{}),
+
+		interval: interval,
+	}
+	go w.hostMetricsRecorder.threadedRecord()
+}
+
+// Stop stops the recorder.
+func (r *hostMetricsRecorder) Stop() {
+	close(r.stopChan)
+}
+
+func (r *hostMetricsRecorder) threadedRecord() {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-r.stopChan:
+			return
+		case <-t.C:
+		}
+
+		// skip snapshots of idle workers
+		metrics := r.metrics()
+		if len(metrics) == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+		err := r.w.bus.RecordHostMetrics(ctx, metrics)
+		cancel()
+		if err != nil {
+			r.w.logger.Errorf("failed to record host metrics, err: %v", err)
+		}
+	}
+}
+
+// metrics returns a snapshot of the performance of every host the worker
+// transferred data to or from since the previous snapshot.
+func (r *hostMetricsRecorder) metrics() []api.HostMetric {
+	perfs := make(map[types.PublicKey]hostdb.HostPerformance)
+	r.w.uploadManager.drainMetrics(perfs)
+	r.w.downloadManager.drainMetrics(perfs)
+
+	now := api.TimeRFC3339(time.Now())
+	var metrics []api.HostMetric
+	for hk, perf := range perfs {
+		if perf == (hostdb.HostPerformance{}) {
+			continue
+		}
+		metrics = append(metrics, api.HostMetric{
+			Timestamp:       now,
+			Worker:          r.w.id,
+			HostKey:         hk,
+			HostPerformance: perf,
+		})
+	}
+	return metrics
+}
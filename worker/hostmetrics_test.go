@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransferMetrics(t *testing.T) {
+	var m transferMetrics
+
+	// assert an idle host reports no metrics
+	if mbps, p90 := m.drain(); mbps != 0 || p90 != 0 {
+		t.Fatal("unexpected metrics", mbps, p90)
+	}
+
+	// track some transfers
+	for i := 1; i <= 10; i++ {
+		m.track(1000, time.Duration(i)*time.Millisecond)
+	}
+	if mbps, p90 := m.drain(); mbps == 0 || p90 != 9 {
+		t.Fatal("unexpected metrics", mbps, p90)
+	}
+
+	// assert the metrics were reset
+	if mbps, p90 := m.drain(); mbps != 0 || p90 != 0 {
+		t.Fatal("unexpected metrics", mbps, p90)
+	}
+
+	// assert only transfers since the last snapshot are taken into account
+	m.track(1000, time.Millisecond)
+	if mbps, p90 := m.drain(); mbps != 8 || p90 != 1 {
+		t.Fatal("unexpected metrics", mbps, p90)
+	}
+}
@@ -38,15 +38,15 @@ func (w *worker) recordInteractions(scans []hostdb.HostScan, priceTableUpdates [
 	// Otherwise we schedule a flush.
 	w.interactionsFlushTimer = time.AfterFunc(w.busFlushInterval, func() {
 		w.interactionsMu.Lock()
-		w.flushInteractions()
+		w.flushInteractions(context.Background())
 		w.interactionsMu.Unlock()
 	})
 }
 
 // flushInteractions flushes the worker's interaction buffer to the bus.
-func (w *worker) flushInteractions() {
+func (w *worker) flushInteractions(ctx context.Context) {
 	if len(w.interactionsScans) > 0 {
-		ctx, span := tracing.Tracer.Start(context.Background(), "worker: recordHostScans")
+		ctx, span := tracing.Tracer.Start(ctx, "worker: recordHostScans")
 		defer span.End()
 		if err := w.bus.RecordHostScans(ctx, w.interactionsScans); err != nil {
 			w.logger.Errorw(fmt.Sprintf("failed to record scans: %v", err))
@@ -55,7 +55,7 @@ func (w *worker) flushInteractions() {
 		}
 	}
 	if len(w.interactionsPriceTableUpdates) > 0 {
-		ctx, span := tracing.Tracer.Start(context.Background(), "worker: recordPriceTableUpdates")
+		ctx, span := tracing.Tracer.Start(ctx, "worker: recordPriceTableUpdates")
 		defer span.End()
 		if err := w.bus.RecordPriceTables(ctx, w.interactionsPriceTableUpdates); err != nil {
 			w.logger.Errorw(fmt.Sprintf("failed to record price table updates: %v", err))
@@ -11,7 +11,7 @@ import (
 	"go.uber.org/zap"
 )
 
-func migrateSlab(ctx context.Context, d *downloadManager, u *uploadManager, s *object.Slab, dlContracts, ulContracts []api.ContractMetadata, bh uint64, logger *zap.SugaredLogger) (map[types.PublicKey]types.FileContractID, int, error) {
+func migrateSlab(ctx context.Context, d *downloadManager, u *uploadManager, s *object.Slab, rs api.RedundancySettings, dlContracts, ulContracts []api.ContractMetadata, bh uint64, logger *zap.SugaredLogger) (map[types.PublicKey]types.FileContractID, int, error) {
 	ctx, span := tracing.Tracer.Start(ctx, "migrateSlab")
 	defer span.End()
 
@@ -92,7 +92,7 @@ func migrateSlab(ctx context.Context, d *downloadManager, u *uploadManager, s *o
 	}
 
 	// migrate the shards
-	uploaded, used, err := u.UploadShards(ctx, shards, allowed, bh, lockingPriorityUpload)
+	uploaded, used, err := u.UploadShards(ctx, shards, rs, allowed, bh, lockingPriorityUpload)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to upload slab for migration: %w", err)
 	}
@@ -0,0 +1,285 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+	"lukechampine.com/frand"
+)
+
+var (
+	_ Bus                    = (*mockBus)(nil)
+	_ hostProvider           = (*mockHostProvider)(nil)
+	_ hostV3                 = (*mockHost)(nil)
+	_ revisionLocker         = (*mockRevisionLocker)(nil)
+	_ sectorReadCostProvider = (mockReadCostProvider)(nil)
+)
+
+type (
+	// mockBus implements the parts of the Bus interface that are used by the
+	// upload manager, calling any other method panics.
+	mockBus struct {
+		Bus
+
+		mu        sync.Mutex
+		contracts []api.ContractMetadata
+		objects   map[string]api.Object
+		uploads   map[api.UploadID]bool // tracked uploads, true if finished
+		uploading map[api.UploadID][]types.Hash256
+
+		// onAddUploadingSector is called for every uploading sector if set
+		onAddUploadingSector func(fcid types.FileContractID)
+	}
+
+	mockHostProvider struct {
+		hosts    map[types.PublicKey]*mockHost
+		denyList *hostDenyList
+	}
+
+	mockHost struct {
+		hk   types.PublicKey
+		fcid types.FileContractID
+
+		mu      sync.Mutex
+		sectors map[types.Hash256]*[rhpv2.SectorSize]byte
+		delay   time.Duration
+	}
+
+	// mockReadCostProvider returns the read cost of the hosts it contains.
+	mockReadCostProvider map[types.PublicKey]types.Currency
+
+	mockRevisionLocker struct {
+		mu    sync.Mutex
+		locks map[types.FileContractID]*sync.Mutex
+		held  map[types.FileContractID]bool
+	}
+
+	// mockPeer uploads slabs using the given upload manager, or fails with
+	// the given error.
+	mockPeer struct {
+		mgr *uploadManager
+		err error
+	}
+)
+
+func newMockBus() *mockBus {
+	return &mockBus{
+		objects:   make(map[string]api.Object),
+		uploads:   make(map[api.UploadID]bool),
+		uploading: make(map[api.UploadID][]types.Hash256),
+	}
+}
+
+// addHosts creates n hosts and a contract with each of them.
+func (b *mockBus) addHosts(hp *mockHostProvider, n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := 0; i < n; i++ {
+		h := &mockHost{
+			hk:      types.PublicKey(frand.Entropy256()),
+			fcid:    types.FileContractID(frand.Entropy256()),
+			sectors: make(map[types.Hash256]*[rhpv2.SectorSize]byte),
+		}
+		hp.hosts[h.hk] = h
+		b.contracts = append(b.contracts, api.ContractMetadata{
+			ID:         h.fcid,
+			HostKey:    h.hk,
+			SiamuxAddr: fmt.Sprintf("host%d.sia:9983", len(b.contracts)),
+			WindowEnd:  1000,
+		})
+	}
+}
+
+func (b *mockBus) ContractSetContracts(ctx context.Context, set string) ([]api.ContractMetadata, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]api.ContractMetadata(nil), b.contracts...), nil
+}
+
+func (b *mockBus) Object(ctx context.Context, bucket, path string, opts api.GetObjectOptions) (api.ObjectsResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, exists := b.objects[path]
+	if !exists {
+		return api.ObjectsResponse{}, api.ErrObjectNotFound
+	}
+	return api.ObjectsResponse{Object: &o}, nil
+}
+
+func (b *mockBus) TrackUpload(ctx context.Context, uID api.UploadID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, exists := b.uploads[uID]; exists {
+		return api.ErrUploadAlreadyExists
+	}
+	b.uploads[uID] = false
+	return nil
+}
+
+func (b *mockBus) AddUploadingSector(ctx context.Context, uID api.UploadID, id types.FileContractID, root types.Hash256) error {
+	if b.onAddUploadingSector != nil {
+		b.onAddUploadingSector(id)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if finished, exists := b.uploads[uID]; !exists || finished {
+		return api.ErrUnknownUpload
+	}
+	b.uploading[uID] = append(b.uploading[uID], root)
+	return nil
+}
+
+func (b *mockBus) FinishUpload(ctx context.Context, uID api.UploadID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.uploads[uID] = true
+	return nil
+}
+
+func newMockHostProvider() *mockHostProvider {
+	return &mockHostProvider{
+		hosts:    make(map[types.PublicKey]*mockHost),
+		denyList: newHostDenyList(),
+	}
+}
+
+func (hp *mockHostProvider) newHostV3(fcid types.FileContractID, hk types.PublicKey, _ string) hostV3 {
+	return hp.hosts[hk]
+}
+
+func (hp *mockHostProvider) isDenied(hk types.PublicKey) bool {
+	return hp.denyList.IsDenied(hk)
+}
+
+func (hp *mockHostProvider) trackHostError(hk types.PublicKey, err error) {
+	hp.denyList.TrackError(hk, err)
+}
+
+func (h *mockHost) Contract() types.FileContractID { return h.fcid }
+func (h *mockHost) HostKey() types.PublicKey       { return h.hk }
+
+func (h *mockHost) DownloadSector(ctx context.Context, w io.Writer, root types.Hash256, offset, length uint32) error {
+	h.mu.Lock()
+	sector, exists := h.sectors[root]
+	h.mu.Unlock()
+	if !exists {
+		return errors.New("sector not found")
+	}
+	_, err := w.Write(sector[offset : offset+length])
+	return err
+}
+
+func (h *mockHost) UploadSector(ctx context.Context, sector *[rhpv2.SectorSize]byte, rev *types.FileContractRevision) (types.Hash256, error) {
+	h.mu.Lock()
+	delay := h.delay
+	h.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return types.Hash256{}, ctx.Err()
+	case <-time.After(delay):
+	}
+
+	root := rhpv2.SectorRoot(sector)
+	h.mu.Lock()
+	h.sectors[root] = sector
+	h.mu.Unlock()
+	return root, nil
+}
+
+func (h *mockHost) DeleteSectors(ctx context.Context, roots []types.Hash256, indices []uint64, rev types.FileContractRevision) error {
+	return errors.New("not implemented")
+}
+
+func (h *mockHost) FetchPriceTable(ctx context.Context, rev *types.FileContractRevision) (hostdb.HostPriceTable, error) {
+	return hostdb.HostPriceTable{}, errors.New("not implemented")
+}
+
+func (h *mockHost) FetchRevision(ctx context.Context, fetchTimeout time.Duration, blockHeight uint64) (types.FileContractRevision, error) {
+	return newMockRevision(h.fcid), nil
+}
+
+func (h *mockHost) FundAccount(ctx context.Context, balance types.Currency, rev *types.FileContractRevision) error {
+	return errors.New("not implemented")
+}
+
+func (h *mockHost) Renew(ctx context.Context, rrr api.RHPRenewRequest) (rhpv2.ContractRevision, []types.Transaction, error) {
+	return rhpv2.ContractRevision{}, nil, errors.New("not implemented")
+}
+
+func (h *mockHost) SyncAccount(ctx context.Context, rev *types.FileContractRevision) error {
+	return errors.New("not implemented")
+}
+
+func (h *mockHost) numSectors() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.sectors)
+}
+
+func (rcp mockReadCostProvider) sectorReadCost(hk types.PublicKey) (types.Currency, bool) {
+	cost, ok := rcp[hk]
+	return cost, ok
+}
+
+func newMockRevisionLocker() *mockRevisionLocker {
+	return &mockRevisionLocker{
+		locks: make(map[types.FileContractID]*sync.Mutex),
+		held:  make(map[types.FileContractID]bool),
+	}
+}
+
+// isHeld returns true if the revision of the given contract is locked.
+func (rl *mockRevisionLocker) isHeld(fcid types.FileContractID) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.held[fcid]
+}
+
+func (rl *mockRevisionLocker) withRevision(ctx context.Context, timeout time.Duration, fcid types.FileContractID, hk types.PublicKey, siamuxAddr string, lockPriority int, blockHeight uint64, fn func(rev types.FileContractRevision) error) error {
+	rl.mu.Lock()
+	lock, exists := rl.locks[fcid]
+	if !exists {
+		lock = new(sync.Mutex)
+		rl.locks[fcid] = lock
+	}
+	rl.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+	rl.mu.Lock()
+	rl.held[fcid] = true
+	rl.mu.Unlock()
+	defer func() {
+		rl.mu.Lock()
+		rl.held[fcid] = false
+		rl.mu.Unlock()
+	}()
+	return fn(newMockRevision(fcid))
+}
+
+func newMockRevision(fcid types.FileContractID) types.FileContractRevision {
+	return types.FileContractRevision{
+		ParentID: fcid,
+		FileContract: types.FileContract{
+			ValidProofOutputs:  []types.SiacoinOutput{{Value: types.Siacoins(1)}, {}},
+			MissedProofOutputs: []types.SiacoinOutput{{Value: types.Siacoins(1)}, {}, {}},
+		},
+	}
+}
+
+func (p *mockPeer) UploadSlab(ctx context.Context, r io.Reader, opts api.UploadSlabOptions) (api.UploadSlabResponse, error) {
+	if p.err != nil {
+		return api.UploadSlabResponse{}, p.err
+	}
+	rs := api.RedundancySettings{MinShards: opts.MinShards, TotalShards: opts.TotalShards}
+	slab, used, err := p.mgr.UploadSlab(ctx, r, rs, opts.ContractSet, opts.UploadID, 0, lockingPriorityUpload)
+	return api.UploadSlabResponse{Slab: slab, UsedContracts: used}, err
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"time"
+)
+
+// packedSlabsUploadInterval is the interval at which the worker checks
+// whether the bus has packed slabs that are ready to be uploaded.
+const packedSlabsUploadInterval = time.Minute
+
+// packedSlabsUploader periodically uploads the packed slabs of the default
+// contract set and redundancy settings. Uploads only trigger uploading packed
+// slabs when they add data to a buffer, which means buffers the bus flushes
+// because they exceeded their max age would otherwise only be uploaded once
+// the next small object is uploaded.
+type packedSlabsUploader struct {
+	w        *worker
+	stopChan chan struct{}
+
+	interval time.Duration
+}
+
+func (w *worker) initPackedSlabsUploader(interval time.Duration) {
+	if w.packedSlabsUploader != nil {
+		panic("packed slabs uploader already initialized") // developer error
+	}
+	w.packedSlabsUploader = &packedSlabsUploader{
+		w:        w,
+		stopChan: make(chan struct{}),
+
+		interval: interval,
+	}
+	go w.packedSlabsUploader.threadedUpload()
+}
+
+// Stop stops the uploader.
+func (u *packedSlabsUploader) Stop() {
+	close(u.stopChan)
+}
+
+func (u *packedSlabsUploader) threadedUpload() {
+	t := time.NewTicker(u.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-u.stopChan:
+			return
+		case <-t.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), u.interval)
+		up, err := u.w.uploadParams(ctx)
+		cancel()
+		if err != nil {
+			u.w.logger.Errorf("failed to fetch upload params, err: %v", err)
+			continue
+		} else if !up.UploadPacking || up.ContractSet == "" || !up.ConsensusState.Synced || up.Maintenance.Active(time.Now()) {
+			continue
+		}
+		go u.w.threadedUploadPackedSlabs(up.RedundancySettings, up.ContractSet, lockingPriorityBackgroundUpload)
+	}
+}
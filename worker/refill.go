@@ -0,0 +1,170 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	rhpv3 "go.sia.tech/core/rhp/v3"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+// accountRefillThreads is the number of accounts the refiller refills in
+// parallel.
+const accountRefillThreads = 10
+
+// accountRefiller periodically tops up the worker's accounts with the hosts in
+// the upload contract set, this keeps uploads and downloads from running out of
+// funds without having to wait for the autopilot to refill the accounts.
+type accountRefiller struct {
+	w        *worker
+	stopChan chan struct{}
+
+	interval  time.Duration
+	target    types.Currency
+	threshold types.Currency
+}
+
+func (w *worker) initAccountRefiller(interval time.Duration, target, threshold types.Currency) error {
+	if w.accountRefiller != nil {
+		panic("account refiller already initialized") // developer error
+	}
+	if interval > 0 && threshold.Cmp(target) > 0 {
+		return fmt.Errorf("accounts refill threshold %v can't exceed the refill target %v", threshold, target)
+	}
+	w.accountRefiller = &accountRefiller{
+		w:        w,
+		stopChan: make(chan struct{}),
+
+		interval:  interval,
+		target:    target,
+		threshold: threshold,
+	}
+	if interval > 0 {
+		go w.accountRefiller.threadedRefill()
+	}
+	return nil
+}
+
+// Stop stops the refiller.
+func (r *accountRefiller) Stop() {
+	close(r.stopChan)
+}
+
+func (r *accountRefiller) threadedRefill() {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-r.stopChan:
+			return
+		case <-t.C:
+		}
+		if err := r.refill(); err != nil {
+			r.w.logger.Errorf("failed to refill accounts, err: %v", err)
+		}
+	}
+}
+
+// refill funds every account with a balance below the threshold up to the
+// target balance.
+func (r *accountRefiller) refill() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+	defer cancel()
+
+	// attach gouging checker to the context
+	gp, err := r.w.gougingParams(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch gouging parameters from bus: %w", err)
+	}
+	ctx = WithGougingChecker(ctx, r.w.consensus, gp)
+
+	// fetch the contracts in the upload contract set
+	up, err := r.w.bus.UploadParams(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch upload parameters from bus: %w", err)
+	} else if up.ContractSet == "" {
+		return nil // nothing to refill
+	}
+	contracts, err := r.w.bus.ContractSetContracts(ctx, up.ContractSet)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch contracts for set '%s' from bus: %w", up.ContractSet, err)
+	}
+
+	// fetch the contracts that are not confirmed yet
+	txns, err := r.w.bus.TransactionPool(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch transaction pool from bus: %w", err)
+	}
+	unconfirmed := make(map[types.FileContractID]struct{})
+	for _, txn := range txns {
+		for i := range txn.FileContracts {
+			unconfirmed[txn.FileContractID(i)] = struct{}{}
+		}
+	}
+
+	// fetch the accounts
+	accounts, err := r.w.bus.Accounts(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch accounts from bus: %w", err)
+	}
+
+	// refill the accounts in parallel
+	reqs := make(chan api.ContractMetadata)
+	var wg sync.WaitGroup
+	for i := 0; i < accountRefillThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range reqs {
+				if err := r.w.fundAccount(ctx, c.ID, c.HostKey, c.SiamuxAddr, r.target, gp.ConsensusState.BlockHeight); err != nil {
+					r.w.logger.Debugw("failed to refill account", "hk", c.HostKey, "fcid", c.ID, "err", err)
+				}
+			}
+		}()
+	}
+	for _, c := range r.accountsToRefill(contracts, unconfirmed, accounts) {
+		reqs <- c
+	}
+	close(reqs)
+	wg.Wait()
+	return nil
+}
+
+// accountsToRefill returns one contract for every host whose account needs to
+// be refilled. The refiller only tops up accounts that are in good standing,
+// accounts that require a sync or have a negative drift are left to the
+// autopilot, which syncs them and checks the drift before refilling. Just like
+// the autopilot, the refiller doesn't fund accounts from unconfirmed
+// contracts.
+func (r *accountRefiller) accountsToRefill(contracts []api.ContractMetadata, unconfirmed map[types.FileContractID]struct{}, accounts []api.Account) []api.ContractMetadata {
+	byID := make(map[rhpv3.Account]api.Account)
+	for _, a := range accounts {
+		byID[a.ID] = a
+	}
+
+	var refill []api.ContractMetadata
+	seen := make(map[types.PublicKey]struct{})
+	for _, c := range contracts {
+		if _, ok := unconfirmed[c.ID]; ok {
+			continue
+		} else if _, ok := seen[c.HostKey]; ok {
+			continue
+		}
+
+		// accounts the bus doesn't know about yet have a zero balance
+		if a, ok := byID[r.w.accounts.ForHost(c.HostKey).id]; ok {
+			if a.RequiresSync || (a.Drift != nil && a.Drift.Sign() < 0) {
+				continue
+			} else if a.Balance != nil && a.Balance.Cmp(r.threshold.Big()) >= 0 {
+				continue
+			}
+		}
+		seen[c.HostKey] = struct{}{}
+		refill = append(refill, c)
+	}
+	return refill
+}
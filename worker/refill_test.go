@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"lukechampine.com/frand"
+)
+
+func TestInitAccountRefiller(t *testing.T) {
+	w := &worker{}
+	if err := w.initAccountRefiller(0, types.Siacoins(1), types.Siacoins(2)); err != nil {
+		t.Fatal("unexpected error when the refiller is disabled", err)
+	}
+
+	w = &worker{}
+	if err := w.initAccountRefiller(time.Minute, types.Siacoins(1), types.Siacoins(2)); err == nil {
+		t.Fatal("expected error when the threshold exceeds the target")
+	}
+}
+
+func TestAccountsToRefill(t *testing.T) {
+	w := &worker{masterKey: frand.Entropy256()}
+	w.initAccounts(newMockBus())
+	r := &accountRefiller{
+		w:         w,
+		target:    types.Siacoins(2),
+		threshold: types.Siacoins(1),
+	}
+
+	// create a contract with 6 hosts each
+	contracts := make([]api.ContractMetadata, 6)
+	for i := range contracts {
+		contracts[i] = api.ContractMetadata{
+			ID:      types.FileContractID(frand.Entropy256()),
+			HostKey: types.PublicKey(frand.Entropy256()),
+		}
+	}
+	account := func(i int, balance, drift *big.Int, requiresSync bool) api.Account {
+		return api.Account{
+			ID:           w.accounts.ForHost(contracts[i].HostKey).id,
+			HostKey:      contracts[i].HostKey,
+			Balance:      balance,
+			Drift:        drift,
+			RequiresSync: requiresSync,
+		}
+	}
+
+	// add a second contract with the first host
+	contracts = append(contracts, api.ContractMetadata{
+		ID:      types.FileContractID(frand.Entropy256()),
+		HostKey: contracts[0].HostKey,
+	})
+
+	// host 0 has no account yet, host 1 is below the threshold, host 2 is
+	// above the threshold, host 3 requires a sync, host 4 has a negative drift
+	// and the contract with host 5 is unconfirmed
+	low, high := types.Siacoins(1).Div64(2).Big(), types.Siacoins(1).Big()
+	accounts := []api.Account{
+		account(1, low, new(big.Int), false),
+		account(2, high, new(big.Int), false),
+		account(3, low, new(big.Int), true),
+		account(4, low, big.NewInt(-1), false),
+		account(5, low, new(big.Int), false),
+	}
+	unconfirmed := map[types.FileContractID]struct{}{contracts[5].ID: {}}
+
+	refill := r.accountsToRefill(contracts, unconfirmed, accounts)
+	if len(refill) != 2 {
+		t.Fatalf("expected 2 accounts to refill, got %v", len(refill))
+	} else if refill[0].ID != contracts[0].ID {
+		t.Fatal("expected the first contract with host 0 to be used")
+	} else if refill[1].ID != contracts[1].ID {
+		t.Fatal("expected host 1 to be refilled")
+	}
+
+	// confirm the contract with host 5
+	refill = r.accountsToRefill(contracts, nil, accounts)
+	if len(refill) != 3 || refill[2].ID != contracts[5].ID {
+		t.Fatal("expected host 5 to be refilled once its contract is confirmed")
+	}
+}
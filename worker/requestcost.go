@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+const keyRequestCost contextKey = "RequestCost"
+
+type (
+	// requestCost keeps track of the money spent on the hosts while serving a
+	// single upload or download request.
+	requestCost struct {
+		mu    sync.Mutex
+		total types.Currency
+		hosts map[types.PublicKey]types.Currency
+	}
+)
+
+// withRequestCost attaches a requestCost to the context, every RPC performed
+// using the returned context adds its cost to it.
+func withRequestCost(ctx context.Context) (context.Context, *requestCost) {
+	rc := &requestCost{hosts: make(map[types.PublicKey]types.Currency)}
+	return context.WithValue(ctx, keyRequestCost, rc), rc
+}
+
+// recordRequestCost adds the given cost to the requestCost attached to the
+// context, if there is one.
+func recordRequestCost(ctx context.Context, hk types.PublicKey, cost types.Currency) {
+	rc, ok := ctx.Value(keyRequestCost).(*requestCost)
+	if !ok || cost.IsZero() {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.total = rc.total.Add(cost)
+	rc.hosts[hk] = rc.hosts[hk].Add(cost)
+}
+
+// writeHeaders sets the cost headers on h, the per-host breakdown is only
+// included if requested.
+func (rc *requestCost) writeHeaders(h http.Header, breakdown bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	h.Set(api.ObjectCostHeader, rc.total.ExactString())
+	if breakdown {
+		b, _ := json.Marshal(rc.hosts)
+		h.Set(api.ObjectCostBreakdownHeader, string(b))
+	}
+}
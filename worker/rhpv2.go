@@ -1,12 +1,15 @@
 package worker
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/bits"
+	"os"
 	"sort"
 	"strings"
 	"time"
@@ -80,6 +83,44 @@ func (hes HostErrorSet) Error() string {
 	return "\n" + strings.Join(strs, "\n")
 }
 
+// uploadHostErrors aggregates the errors in the set per host, in the order in
+// which the hosts first failed.
+func (hes HostErrorSet) uploadHostErrors() []api.UploadHostError {
+	var errs []api.UploadHostError
+	indices := make(map[types.PublicKey]int)
+	for _, he := range hes {
+		i, ok := indices[he.HostKey]
+		if !ok {
+			i = len(errs)
+			indices[he.HostKey] = i
+			errs = append(errs, api.UploadHostError{HostKey: he.HostKey})
+		}
+		errs[i].Attempts++
+		errs[i].Category = uploadErrorCategory(he.Err)
+		errs[i].Error = he.Err.Error()
+	}
+	return errs
+}
+
+// uploadErrorCategory classifies an error returned by a host during an
+// upload so clients can tell which hosts need attention.
+func uploadErrorCategory(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return api.UploadErrorCategoryTimeout
+	case isError(err, errPriceTableGouging):
+		return api.UploadErrorCategoryGouging
+	case isInsufficientFunds(err), isBalanceInsufficient(err):
+		return api.UploadErrorCategoryFunds
+	case isDialTransportV3(err), isClosedStream(err):
+		return api.UploadErrorCategoryConnection
+	case isMaxRevisionReached(err), isError(err, ErrContractFinalized), isError(err, ErrContractLocked):
+		return api.UploadErrorCategoryContract
+	default:
+		return api.UploadErrorCategoryUnknown
+	}
+}
+
 func wrapErr(err *error, fnName string) {
 	if *err != nil {
 		*err = fmt.Errorf("%s: %w", fnName, *err)
@@ -320,6 +361,117 @@ func (w *worker) PruneContract(ctx context.Context, hostIP string, hostKey types
 	return
 }
 
+// DownloadSectorV2 downloads the given range of a sector from the host using
+// RHPv2, paying for the download with the given contract. It is used as a
+// fallback for hosts that are unreachable over RHPv3.
+func (w *worker) DownloadSectorV2(ctx context.Context, wr io.Writer, hostIP string, hostKey types.PublicKey, fcid types.FileContractID, lastKnownRevisionNumber uint64, root types.Hash256, offset, length uint32) error {
+	return w.withContractLock(ctx, fcid, lockingPriorityDownload, func() error {
+		return w.withTransportV2(ctx, hostKey, hostIP, func(t *rhpv2.Transport) error {
+			return w.withRevisionV2(ctx, defaultLockTimeout, t, hostKey, fcid, lastKnownRevisionNumber, func(t *rhpv2.Transport, rev rhpv2.ContractRevision, settings rhpv2.HostSettings) error {
+				// perform gouging checks
+				gc, err := GougingCheckerFromContext(ctx)
+				if err != nil {
+					return err
+				}
+				if breakdown := gc.Check(&settings, nil); breakdown.Gouging() {
+					return fmt.Errorf("failed to download sector, gouging check failed: %v", breakdown.Reasons())
+				}
+				return w.readSector(ctx, t, &rev, settings, wr, root, offset, length)
+			})
+		})
+	})
+}
+
+func (w *worker) readSector(ctx context.Context, t *rhpv2.Transport, rev *rhpv2.ContractRevision, settings rhpv2.HostSettings, wr io.Writer, root types.Hash256, offset, length uint32) error {
+	// derive the renter key
+	renterKey := w.deriveRenterKey(rev.HostKey())
+
+	// the merkle proof requires the section to be aligned to leaf boundaries
+	start := uint64(offset) / rhpv2.LeafSize * rhpv2.LeafSize
+	end := (uint64(offset) + uint64(length) + rhpv2.LeafSize - 1) / rhpv2.LeafSize * rhpv2.LeafSize
+	sections := []rhpv2.RPCReadRequestSection{{
+		MerkleRoot: root,
+		Offset:     start,
+		Length:     end - start,
+	}}
+
+	// check funds
+	cost := rhpv2.RPCReadCost(settings, sections)
+	if rev.RenterFunds().Cmp(cost) < 0 {
+		return ErrInsufficientFunds
+	}
+
+	// update the revision number
+	if rev.Revision.RevisionNumber == math.MaxUint64 {
+		return ErrContractFinalized
+	}
+	rev.Revision.RevisionNumber++
+
+	// update the revision outputs
+	newValid, newMissed, err := updateRevisionOutputs(&rev.Revision, cost, types.ZeroCurrency)
+	if err != nil {
+		return err
+	}
+
+	// build the read request
+	revisionHash := hashRevision(rev.Revision)
+	req := &rhpv2.RPCReadRequest{
+		Sections:    sections,
+		MerkleProof: true,
+
+		RevisionNumber:    rev.Revision.RevisionNumber,
+		ValidProofValues:  newValid,
+		MissedProofValues: newMissed,
+		Signature:         renterKey.SignHash(revisionHash),
+	}
+
+	// execute the read RPC, the host streams back the response until we send
+	// the stop signal
+	if err := t.WriteRequest(rhpv2.RPCReadID, req); err != nil {
+		return err
+	}
+	defer t.WriteResponse(&rhpv2.RPCReadStop)
+
+	var resp rhpv2.RPCReadResponse
+	if err := t.ReadResponse(&resp, minMessageSize+end-start); err != nil {
+		return fmt.Errorf("couldn't read sector response: %w", err)
+	} else if uint64(len(resp.Data)) != end-start {
+		return fmt.Errorf("host sent %d bytes of sector data, expected %d", len(resp.Data), end-start)
+	}
+
+	// verify the proof
+	verifier := rhpv2.NewRangeProofVerifier(start/rhpv2.LeafSize, end/rhpv2.LeafSize)
+	if _, err := verifier.ReadFrom(bytes.NewReader(resp.Data)); err != nil {
+		return err
+	} else if !verifier.Verify(resp.MerkleProof, root) {
+		return ErrInvalidMerkleProof
+	}
+
+	// the host might send its signature in a separate response
+	hostSig := resp.Signature
+	if hostSig == (types.Signature{}) {
+		if err := t.ReadResponse(&resp, minMessageSize); err != nil {
+			return fmt.Errorf("couldn't read signature response: %w", err)
+		}
+		hostSig = resp.Signature
+	}
+
+	// verify the host signature
+	if !rev.HostKey().VerifyHash(revisionHash, hostSig) {
+		return errors.New("host's signature is invalid")
+	}
+	rev.Signatures[0].Signature = req.Signature[:]
+	rev.Signatures[1].Signature = hostSig[:]
+
+	// record spending
+	w.contractSpendingRecorder.Record(rev.ID(), rev.Revision.RevisionNumber, rev.Revision.Filesize, api.ContractSpending{Downloads: cost})
+	recordRequestCost(ctx, rev.HostKey(), cost)
+
+	// write the requested range
+	_, err = wr.Write(resp.Data[uint64(offset)-start:][:length])
+	return err
+}
+
 func (w *worker) deleteContractRoots(t *rhpv2.Transport, rev *rhpv2.ContractRevision, settings rhpv2.HostSettings, indices []uint64) (deleted uint64, err error) {
 	w.logger.Debugw(fmt.Sprintf("deleting %d contract roots (%v)", len(indices), humanReadableSize(len(indices)*rhpv2.SectorSize)), "hk", rev.HostKey(), "fcid", rev.ID())
 
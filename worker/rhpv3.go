@@ -10,7 +10,9 @@ import (
 	"io"
 	"math"
 	"math/big"
+	"math/bits"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -41,6 +43,11 @@ const (
 	// messages.
 	defaultWithdrawalExpiryBlocks = 6
 
+	// maxHostHeightOffset is the maximum number of blocks by which we adjust
+	// the expiry height of withdrawals to make up for hosts whose view of the
+	// block height differs from ours.
+	maxHostHeightOffset = 12
+
 	// responseLeeway is the amount of leeway given to the maxLen when we read
 	// the response in the ReadSector RPC
 	responseLeeway = 1 << 12 // 4 KiB
@@ -51,10 +58,19 @@ var (
 	// account balance was insufficient.
 	errBalanceInsufficient = errors.New("ephemeral account balance was insufficient")
 
+	// errDialTransportV3 occurs when a siamux transport to the host couldn't
+	// be established.
+	errDialTransportV3 = errors.New("DialStream: could not dial transport")
+
 	// errBalanceMaxExceeded occurs when a deposit would push the account's
 	// balance over the maximum allowed ephemeral account balance.
 	errBalanceMaxExceeded = errors.New("ephemeral account maximum balance exceeded")
 
+	// ErrInvalidProof is returned when the host supplied a proof that doesn't
+	// match the data it sent or the Merkle root we expected. It is an alias of
+	// ErrInvalidMerkleProof so both RHP versions surface the same error.
+	ErrInvalidProof = ErrInvalidMerkleProof
+
 	// errMaxRevisionReached occurs when trying to revise a contract that has
 	// already reached the highest possible revision number. Usually happens
 	// when trying to use a renewed contract.
@@ -84,7 +100,9 @@ func isBalanceMaxExceeded(err error) bool  { return isError(err, errBalanceMaxEx
 func isClosedStream(err error) bool {
 	return isError(err, mux.ErrClosedStream) || isError(err, net.ErrClosed)
 }
+func isDialTransportV3(err error) bool    { return isError(err, errDialTransportV3) }
 func isInsufficientFunds(err error) bool  { return isError(err, ErrInsufficientFunds) }
+func isInvalidProof(err error) bool       { return isError(err, ErrInvalidProof) }
 func isMaxRevisionReached(err error) bool { return isError(err, errMaxRevisionReached) }
 func isPriceTableExpired(err error) bool  { return isError(err, errPriceTableExpired) }
 func isPriceTableNotFound(err error) bool { return isError(err, errPriceTableNotFound) }
@@ -134,7 +152,7 @@ func (t *transportV3) DialStream(ctx context.Context) (*streamV3, error) {
 		newTransport, err := dialTransport(ctx, t.siamuxAddr, t.hostKey)
 		if err != nil {
 			t.mu.Unlock()
-			return nil, fmt.Errorf("DialStream: could not dial transport: %w (%v)", err, time.Since(start))
+			return nil, fmt.Errorf("%w: %w (%v)", errDialTransportV3, err, time.Since(start))
 		}
 		t.t = newTransport
 	}
@@ -291,7 +309,7 @@ func (h *host) fetchRevisionWithAccount(ctx context.Context, hostKey types.Publi
 					return rhpv3.HostPriceTable{}, nil, fmt.Errorf("failed to fetch pricetable, err: %w", err)
 				}
 				cost = pt.LatestRevisionCost.Add(pt.UpdatePriceTableCost) // add cost of fetching the pricetable since we might need a new one and it's better to stay pessimistic
-				payment := rhpv3.PayByEphemeralAccount(h.acc.id, cost, bh+defaultWithdrawalExpiryBlocks, h.accountKey)
+				payment := rhpv3.PayByEphemeralAccount(h.acc.id, cost, withdrawalExpiry(bh, pt.HostBlockHeight), h.accountKey)
 				return pt, &payment, nil
 			})
 			if err != nil {
@@ -419,6 +437,7 @@ type (
 	host struct {
 		acc                      *account
 		bus                      Bus
+		cs                       consensusState
 		contractSpendingRecorder *contractSpendingRecorder
 		fcid                     types.FileContractID
 		logger                   *zap.SugaredLogger
@@ -621,24 +640,25 @@ func (h *host) DownloadSector(ctx context.Context, w io.Writer, root types.Hash2
 			payment := rhpv3.PayByEphemeralAccount(h.acc.id, cost, pt.HostBlockHeight+defaultWithdrawalExpiryBlocks, h.accountKey)
 			cost, refund, err = RPCReadSector(ctx, t, w, pt, &payment, offset, length, root)
 			amount = cost.Sub(refund)
+			recordRequestCost(ctx, h.HostKey(), amount)
 			return err
 		})
 		return
 	})
 }
 
-// UploadSector uploads a sector to the host.
-func (h *host) UploadSector(ctx context.Context, sector *[rhpv2.SectorSize]byte, rev types.FileContractRevision) (root types.Hash256, err error) {
+// UploadSector uploads a sector to the host. The upload is paid for using the
+// ephemeral account, if its balance is insufficient we fall back to paying
+// with the contract. On success the given revision is updated to the revision
+// that includes the sector and the payment.
+func (h *host) UploadSector(ctx context.Context, sector *[rhpv2.SectorSize]byte, rev *types.FileContractRevision) (root types.Hash256, err error) {
 	// fetch price table
 	pt, err := h.priceTable(ctx, nil)
 	if err != nil {
 		return types.Hash256{}, err
 	}
 
-	// prepare payment
-	//
-	// TODO: change to account payments once we have the means to check for an
-	// insufficient balance error
+	// calculate the expected cost
 	expectedCost, _, _, err := uploadSectorCost(pt, rev.WindowEnd)
 	if err != nil {
 		return types.Hash256{}, err
@@ -646,14 +666,43 @@ func (h *host) UploadSector(ctx context.Context, sector *[rhpv2.SectorSize]byte,
 	if rev.RevisionNumber == math.MaxUint64 {
 		return types.Hash256{}, fmt.Errorf("revision number has reached max, fcid %v", rev.ParentID)
 	}
-	payment, ok := rhpv3.PayByContract(&rev, expectedCost, h.acc.id, h.renterKey)
+
+	// try paying with the account, the revision passed to the RPC is a copy so
+	// we can safely retry with a contract payment if the withdrawal fails
+	err = h.acc.WithWithdrawal(ctx, func() (amount types.Currency, err error) {
+		err = h.transportPool.withTransportV3(ctx, h.HostKey(), h.siamuxAddr, func(ctx context.Context, t *transportV3) (err error) {
+			accRev := *rev
+			payment := rhpv3.PayByEphemeralAccount(h.acc.id, expectedCost, pt.HostBlockHeight+defaultWithdrawalExpiryBlocks, h.accountKey)
+			root, amount, err = RPCAppendSector(ctx, t, h.renterKey, pt, &accRev, &payment, sector)
+			recordRequestCost(ctx, h.HostKey(), amount)
+			if err != nil {
+				return
+			}
+
+			// record the new revision, the account paid for the upload so
+			// there's no contract spending
+			h.contractSpendingRecorder.Record(accRev.ParentID, accRev.RevisionNumber, accRev.Filesize, api.ContractSpending{})
+			*rev = accRev
+			return
+		})
+		return
+	})
+	if err == nil {
+		return root, nil
+	} else if !isBalanceInsufficient(err) {
+		return types.Hash256{}, err
+	}
+
+	// prepare contract payment
+	contractRev := *rev
+	payment, ok := rhpv3.PayByContract(&contractRev, expectedCost, h.acc.id, h.renterKey)
 	if !ok {
 		return types.Hash256{}, errors.New("failed to create payment")
 	}
 
 	var cost types.Currency
 	err = h.transportPool.withTransportV3(ctx, h.HostKey(), h.siamuxAddr, func(ctx context.Context, t *transportV3) error {
-		root, cost, err = RPCAppendSector(ctx, t, h.renterKey, pt, &rev, &payment, sector)
+		root, cost, err = RPCAppendSector(ctx, t, h.renterKey, pt, &contractRev, &payment, sector)
 		return err
 	})
 	if err != nil {
@@ -661,10 +710,60 @@ func (h *host) UploadSector(ctx context.Context, sector *[rhpv2.SectorSize]byte,
 	}
 
 	// record spending
-	h.contractSpendingRecorder.Record(rev.ParentID, rev.RevisionNumber, rev.Filesize, api.ContractSpending{Uploads: cost})
+	h.contractSpendingRecorder.Record(contractRev.ParentID, contractRev.RevisionNumber, contractRev.Filesize, api.ContractSpending{Uploads: cost})
+	recordRequestCost(ctx, h.HostKey(), cost)
+	*rev = contractRev
 	return root, nil
 }
 
+// DeleteSectors deletes the sectors at the given indices from the contract.
+// The sectors are swapped towards the end of the contract and then dropped,
+// all within a single program that is paid for using the ephemeral account.
+// The given roots are the contract's current sector roots, they are used to
+// verify the proofs the host sends for every instruction.
+func (h *host) DeleteSectors(ctx context.Context, roots []types.Hash256, indices []uint64, rev types.FileContractRevision) (err error) {
+	// return early
+	if len(indices) == 0 {
+		return nil
+	}
+
+	// fetch price table
+	pt, err := h.priceTable(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// return errBalanceInsufficient if balance insufficient
+	defer func() {
+		if isBalanceInsufficient(err) {
+			err = fmt.Errorf("%w %v, err: %v", errBalanceInsufficient, h.HostKey(), err)
+		}
+	}()
+
+	return h.acc.WithWithdrawal(ctx, func() (amount types.Currency, err error) {
+		err = h.transportPool.withTransportV3(ctx, h.HostKey(), h.siamuxAddr, func(ctx context.Context, t *transportV3) error {
+			cost, err := deleteSectorsCost(pt, uint64(len(roots)), uint64(len(indices)))
+			if err != nil {
+				return err
+			}
+
+			var refund types.Currency
+			payment := rhpv3.PayByEphemeralAccount(h.acc.id, cost, pt.HostBlockHeight+defaultWithdrawalExpiryBlocks, h.accountKey)
+			cost, refund, err = RPCDeleteSectors(ctx, t, h.renterKey, pt, &rev, &payment, roots, indices)
+			amount = cost.Sub(refund)
+			if err != nil {
+				return err
+			}
+
+			// record the new revision, the account paid for the deletion so
+			// there's no contract spending
+			h.contractSpendingRecorder.Record(rev.ParentID, rev.RevisionNumber, rev.Filesize, api.ContractSpending{})
+			return nil
+		})
+		return
+	})
+}
+
 // padBandwitdh pads the bandwidth to the next multiple of 1460 bytes.  1460
 // bytes is the maximum size of a TCP packet when using IPv4.
 // TODO: once hostd becomes the only host implementation we can simplify this.
@@ -714,12 +813,41 @@ func uploadSectorCost(pt rhpv3.HostPriceTable, windowEnd uint64) (cost, collater
 	return cost.Div64(10), collateral, rc.Storage, nil
 }
 
+// deleteSectorsCost returns an overestimate for the cost of deleting n sectors
+// from a contract, it assumes every sector has to be swapped before it can be
+// dropped
+func deleteSectorsCost(pt rhpv3.HostPriceTable, numSectors, n uint64) (types.Currency, error) {
+	rc := pt.BaseCost()
+	for i := uint64(0); i < n; i++ {
+		rc = rc.Add(pt.SwapSectorCost())
+	}
+	rc = rc.Add(pt.DropSectorsCost(n))
+
+	// every instruction comes with a proof
+	proofSize := (n + 1) * 2 * uint64(bits.Len64(numSectors)) * 32
+	rc.Egress = rc.Egress.Add(pt.DownloadBandwidthCost.Mul64(proofSize))
+	rc = padBandwidth(pt, rc)
+	cost, _ := rc.Total()
+
+	// overestimate the cost by 10%
+	cost, overflow := cost.Mul64WithOverflow(11)
+	if overflow {
+		return types.ZeroCurrency, errors.New("overflow occurred while adding leeway to delete sectors cost")
+	}
+	return cost.Div64(10), nil
+}
+
 // priceTableValidityLeeway is the number of time before the actual expiry of a
 // price table when we start considering it invalid.
 const priceTableValidityLeeway = -30 * time.Second
 
+// priceTablePrefetchThreads is the number of price tables the prefetcher
+// fetches in parallel.
+const priceTablePrefetchThreads = 10
+
 type priceTables struct {
-	w *worker
+	w        *worker
+	stopChan chan struct{}
 
 	mu          sync.Mutex
 	priceTables map[types.PublicKey]*priceTable
@@ -740,20 +868,52 @@ type priceTableUpdate struct {
 	hpt  hostdb.HostPriceTable
 }
 
-func (w *worker) initPriceTables() {
+func (w *worker) initPriceTables(prefetchInterval time.Duration) {
 	if w.priceTables != nil {
 		panic("priceTables already initialized") // developer error
 	}
 	w.priceTables = &priceTables{
 		w:           w,
+		stopChan:    make(chan struct{}),
 		priceTables: make(map[types.PublicKey]*priceTable),
 	}
+	if prefetchInterval > 0 {
+		go w.priceTables.threadedPrefetch(prefetchInterval)
+	}
+}
+
+// Stop stops the prefetcher.
+func (pts *priceTables) Stop() {
+	close(pts.stopChan)
 }
 
 // fetch returns a price table for the given host
 func (pts *priceTables) fetch(ctx context.Context, hk types.PublicKey, rev *types.FileContractRevision) (hostdb.HostPriceTable, error) {
+	return pts.priceTable(hk).fetch(ctx, rev, time.Now())
+}
+
+// cached returns the price table of the given host if it's cached and not
+// expired, it never fetches a new price table.
+func (pts *priceTables) cached(hk types.PublicKey) (hostdb.HostPriceTable, bool) {
 	pts.mu.Lock()
 	pt, exists := pts.priceTables[hk]
+	pts.mu.Unlock()
+	if !exists {
+		return hostdb.HostPriceTable{}, false
+	}
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.hpt.Expiry.IsZero() || time.Now().After(pt.hpt.Expiry) {
+		return hostdb.HostPriceTable{}, false
+	}
+	return pt.hpt, true
+}
+
+func (pts *priceTables) priceTable(hk types.PublicKey) *priceTable {
+	pts.mu.Lock()
+	defer pts.mu.Unlock()
+	pt, exists := pts.priceTables[hk]
 	if !exists {
 		pt = &priceTable{
 			w:  pts.w,
@@ -761,9 +921,88 @@ func (pts *priceTables) fetch(ctx context.Context, hk types.PublicKey, rev *type
 		}
 		pts.priceTables[hk] = pt
 	}
-	pts.mu.Unlock()
+	return pt
+}
+
+// threadedPrefetch periodically renews the price tables of the hosts we have
+// contracts with, this avoids having to fetch a price table when a host is
+// used for the first time after its previous price table expired.
+func (pts *priceTables) threadedPrefetch(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
 
-	return pt.fetch(ctx, rev)
+	for {
+		select {
+		case <-pts.stopChan:
+			return
+		case <-t.C:
+		}
+		if err := pts.prefetch(interval); err != nil {
+			pts.w.logger.Errorf("failed to prefetch price tables, err: %v", err)
+		}
+	}
+}
+
+// prefetch renews the price tables that expire before the next prefetch.
+func (pts *priceTables) prefetch(interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+
+	// attach gouging checker to the context
+	gp, err := pts.w.gougingParams(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch gouging parameters from bus: %w", err)
+	}
+	ctx = WithGougingChecker(ctx, pts.w.consensus, gp)
+
+	// fetch the hosts we have contracts with
+	contracts, err := pts.w.bus.Contracts(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch contracts from bus: %w", err)
+	}
+	hosts := make([]types.PublicKey, 0, len(contracts))
+	seen := make(map[types.PublicKey]struct{})
+	for _, c := range contracts {
+		if _, ok := seen[c.HostKey]; !ok {
+			seen[c.HostKey] = struct{}{}
+			hosts = append(hosts, c.HostKey)
+		}
+	}
+
+	// renew the price tables in parallel
+	pts.renew(ctx, hosts, time.Now().Add(interval))
+	return nil
+}
+
+// renew renews the price tables of the given hosts in parallel, only the price
+// tables that are not valid until the given time are renewed. The context is
+// expected to have a gouging checker attached. It returns the number of price
+// tables that are valid after renewing them.
+func (pts *priceTables) renew(ctx context.Context, hosts []types.PublicKey, validUntil time.Time) (renewed int) {
+	var mu sync.Mutex
+	reqs := make(chan types.PublicKey)
+	var wg sync.WaitGroup
+	for i := 0; i < priceTablePrefetchThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hk := range reqs {
+				if _, err := pts.priceTable(hk).fetch(ctx, nil, validUntil); err != nil {
+					pts.w.logger.Debugw("failed to renew price table", "hk", hk, "err", err)
+					continue
+				}
+				mu.Lock()
+				renewed++
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, hk := range hosts {
+		reqs <- hk
+	}
+	close(reqs)
+	wg.Wait()
+	return
 }
 
 func (pt *priceTable) ongoingUpdate() (bool, *priceTableUpdate) {
@@ -780,7 +1019,9 @@ func (pt *priceTable) ongoingUpdate() (bool, *priceTableUpdate) {
 	return ongoing, pt.update
 }
 
-func (p *priceTable) fetch(ctx context.Context, rev *types.FileContractRevision) (hpt hostdb.HostPriceTable, err error) {
+// fetch returns a price table that is valid at the given time, the current
+// price table is only updated if that is not the case.
+func (p *priceTable) fetch(ctx context.Context, rev *types.FileContractRevision, validAt time.Time) (hpt hostdb.HostPriceTable, err error) {
 	// convenience variables
 	hk := p.hk
 	w := p.w
@@ -795,7 +1036,7 @@ func (p *priceTable) fetch(ctx context.Context, rev *types.FileContractRevision)
 	if !hpt.Expiry.IsZero() {
 		total := int(math.Floor(hpt.HostPriceTable.Validity.Seconds() * 0.1))
 		priceTableUpdateLeeway := -time.Duration(frand.Intn(total)) * time.Second
-		if time.Now().Before(hpt.Expiry.Add(priceTableValidityLeeway).Add(priceTableUpdateLeeway)) {
+		if validAt.Before(hpt.Expiry.Add(priceTableValidityLeeway).Add(priceTableUpdateLeeway)) {
 			return
 		}
 	}
@@ -832,7 +1073,7 @@ func (p *priceTable) fetch(ctx context.Context, rev *types.FileContractRevision)
 
 	// fetch the host, return early if it has a valid price table
 	host, err := b.Host(ctx, hk)
-	if err == nil && host.Scanned && time.Now().Before(host.PriceTable.Expiry.Add(priceTableValidityLeeway)) {
+	if err == nil && host.Scanned && validAt.Before(host.PriceTable.Expiry.Add(priceTableValidityLeeway)) {
 		hpt = host.PriceTable
 		return
 	}
@@ -846,15 +1087,30 @@ func (p *priceTable) fetch(ctx context.Context, rev *types.FileContractRevision)
 	return w.fetchPriceTable(ctx, hk, host.Settings.SiamuxAddr(), rev)
 }
 
+// withdrawalExpiry returns the expiry height for withdrawals from a host's
+// account. It's based on the host's block height, as reported in its price
+// table, but never deviates more than maxHostHeightOffset blocks from ours.
+func withdrawalExpiry(bh, hostBH uint64) uint64 {
+	height := hostBH
+	if height > bh+maxHostHeightOffset {
+		height = bh + maxHostHeightOffset
+	} else if height+maxHostHeightOffset < bh {
+		height = bh - maxHostHeightOffset
+	}
+	return height + defaultWithdrawalExpiryBlocks
+}
+
 // preparePriceTableContractPayment prepare a payment function to pay for a
 // price table from the given host using the provided revision.
 //
 // NOTE: This way of paying for a price table should only be used if payment by
 // EA is not possible or if we already need a contract revision anyway. e.g.
 // funding an EA.
-func (h *host) preparePriceTableContractPayment(rev *types.FileContractRevision) PriceTablePaymentFunc {
+func (h *host) preparePriceTableContractPayment(gc GougingChecker, rev *types.FileContractRevision) PriceTablePaymentFunc {
 	return func(pt rhpv3.HostPriceTable) (rhpv3.PaymentMethod, error) {
-		// TODO: gouging check on price table
+		if err := gc.CheckPriceTablePayment(pt); err != nil {
+			return nil, err
+		}
 
 		refundAccount := rhpv3.Account(h.accountKey.PublicKey())
 		payment, err := payByContract(rev, pt.UpdatePriceTableCost, refundAccount, h.renterKey)
@@ -870,12 +1126,14 @@ func (h *host) preparePriceTableContractPayment(rev *types.FileContractRevision)
 //
 // NOTE: This is the preferred way of paying for a price table since it is
 // faster and doesn't require locking a contract.
-func (h *host) preparePriceTableAccountPayment(bh uint64) PriceTablePaymentFunc {
+func (h *host) preparePriceTableAccountPayment(gc GougingChecker, bh uint64) PriceTablePaymentFunc {
 	return func(pt rhpv3.HostPriceTable) (rhpv3.PaymentMethod, error) {
-		// TODO: gouging check on price table
+		if err := gc.CheckPriceTablePayment(pt); err != nil {
+			return nil, err
+		}
 
 		account := rhpv3.Account(h.accountKey.PublicKey())
-		payment := rhpv3.PayByEphemeralAccount(account, pt.UpdatePriceTableCost, bh+defaultWithdrawalExpiryBlocks, h.accountKey)
+		payment := rhpv3.PayByEphemeralAccount(account, pt.UpdatePriceTableCost, withdrawalExpiry(bh, pt.HostBlockHeight), h.accountKey)
 		return &payment, nil
 	}
 }
@@ -898,6 +1156,10 @@ func processPayment(s *streamV3, payment rhpv3.PaymentMethod) error {
 	if _, ok := payment.(*rhpv3.PayByContractRequest); ok {
 		var pr rhpv3.PaymentResponse
 		if err := s.ReadResponse(&pr, defaultRPCResponseMaxSize); err != nil {
+			var rpcErr *rhpv3.RPCError
+			if errors.As(err, &rpcErr) {
+				return fmt.Errorf("%w: %w", errPaymentRejected, err)
+			}
 			return err
 		}
 		// TODO: return host signature
@@ -962,17 +1224,23 @@ func (h *host) FetchPriceTable(ctx context.Context, rev *types.FileContractRevis
 		return
 	}
 
+	// fetch the gouging checker to check the price table before paying for it
+	gc, err := GougingCheckerFromContext(ctx)
+	if err != nil {
+		return hostdb.HostPriceTable{}, err
+	}
+
 	// pay by contract if a revision is given
 	if rev != nil {
-		return fetchPT(h.preparePriceTableContractPayment(rev))
+		return fetchPT(h.preparePriceTableContractPayment(gc, rev))
 	}
 
 	// pay by account
-	cs, err := h.bus.ConsensusState(ctx)
+	cs, err := h.cs.ConsensusState(ctx)
 	if err != nil {
 		return hostdb.HostPriceTable{}, err
 	}
-	return fetchPT(h.preparePriceTableAccountPayment(cs.BlockHeight))
+	return fetchPT(h.preparePriceTableAccountPayment(gc, cs.BlockHeight))
 }
 
 // RPCPriceTable calls the UpdatePriceTable RPC.
@@ -1131,17 +1399,8 @@ func RPCReadSector(ctx context.Context, t *transportV3, w io.Writer, pt rhpv3.Ho
 	}
 	cost = resp.TotalCost
 
-	// build proof
-	proof := make([]crypto.Hash, len(resp.Proof))
-	for i, h := range resp.Proof {
-		proof[i] = crypto.Hash(h)
-	}
-
-	// verify proof
-	proofStart := int(offset) / crypto.SegmentSize
-	proofEnd := int(offset+length) / crypto.SegmentSize
-	if !crypto.VerifyRangeProof(resp.Output, proof, proofStart, proofEnd, crypto.Hash(merkleRoot)) {
-		err = errors.New("proof verification failed")
+	// verify the proof
+	if err = verifyReadSectorProof(resp.Output, resp.Proof, offset, length, merkleRoot); err != nil {
 		return
 	}
 
@@ -1149,6 +1408,25 @@ func RPCReadSector(ctx context.Context, t *transportV3, w io.Writer, pt rhpv3.Ho
 	return
 }
 
+// verifyReadSectorProof verifies that the data returned by the host is the
+// requested range of the sector with the given root.
+func verifyReadSectorProof(data []byte, proofHashes []types.Hash256, offset, length uint32, root types.Hash256) error {
+	if uint32(len(data)) != length {
+		return fmt.Errorf("%w: host sent %d bytes of sector data, expected %d", ErrInvalidProof, len(data), length)
+	}
+
+	proof := make([]crypto.Hash, len(proofHashes))
+	for i, h := range proofHashes {
+		proof[i] = crypto.Hash(h)
+	}
+	proofStart := int(offset) / crypto.SegmentSize
+	proofEnd := int(offset+length) / crypto.SegmentSize
+	if !crypto.VerifyRangeProof(data, proof, proofStart, proofEnd, crypto.Hash(root)) {
+		return fmt.Errorf("%w: range proof verification failed for sector %v", ErrInvalidProof, root)
+	}
+	return nil
+}
+
 // RPCReadRegistry calls the ExecuteProgram RPC with an MDM program that reads
 // the specified registry value.
 func RPCReadRegistry(ctx context.Context, t *transportV3, payment rhpv3.PaymentMethod, key rhpv3.RegistryKey) (rv rhpv3.RegistryValue, err error) {
@@ -1287,7 +1565,7 @@ func RPCAppendSector(ctx context.Context, t *transportV3, renterKey types.Privat
 		// Otherwise we make sure the proof was transmitted and verify it.
 		actions := []rhpv2.RPCWriteAction{{Type: rhpv2.RPCWriteActionAppend}} // TODO: change once rhpv3 support is available
 		if !rhpv2.VerifyDiffProof(actions, rev.Filesize/rhpv2.SectorSize, executeResp.Proof, []types.Hash256{}, rev.FileMerkleRoot, executeResp.NewMerkleRoot, []types.Hash256{sectorRoot}) {
-			return types.Hash256{}, types.ZeroCurrency, errors.New("proof verification failed")
+			return types.Hash256{}, types.ZeroCurrency, fmt.Errorf("%w: append sector diff proof verification failed", ErrInvalidMerkleProof)
 		}
 	}
 
@@ -1301,20 +1579,201 @@ func RPCAppendSector(ctx context.Context, t *transportV3, renterKey types.Privat
 	newRevision.RevisionNumber++
 	newRevision.FileMerkleRoot = executeResp.NewMerkleRoot
 
-	finalizeReq := rhpv3.RPCFinalizeProgramRequest{
-		Signature:         renterKey.SignHash(hashRevision(newRevision)),
-		ValidProofValues:  newValid,
-		MissedProofValues: newMissed,
-		RevisionNumber:    newRevision.RevisionNumber,
+	if err = finalizeProgram(s, renterKey, newRevision, newValid, newMissed); err != nil {
+		return
 	}
 
-	var finalizeResp rhpv3.RPCFinalizeProgramResponse
-	if err = s.WriteResponse(&finalizeReq); err != nil {
+	*rev = newRevision
+	return
+}
+
+func RPCDeleteSectors(ctx context.Context, t *transportV3, renterKey types.PrivateKey, pt rhpv3.HostPriceTable, rev *types.FileContractRevision, payment rhpv3.PaymentMethod, roots []types.Hash256, indices []uint64) (cost, refund types.Currency, err error) {
+	defer wrapErr(&err, "DeleteSectors")
+
+	// sanity check revision first
+	if rev.RevisionNumber == math.MaxUint64 {
+		return types.ZeroCurrency, types.ZeroCurrency, errMaxRevisionReached
+	}
+
+	// sanity check the roots, we need them to verify the proofs
+	numSectors := rev.Filesize / rhpv2.SectorSize
+	if uint64(len(roots)) != numSectors {
+		return types.ZeroCurrency, types.ZeroCurrency, fmt.Errorf("expected %v roots, got %v", numSectors, len(roots))
+	} else if rhpv2.MetaRoot(roots) != rev.FileMerkleRoot {
+		return types.ZeroCurrency, types.ZeroCurrency, errors.New("roots don't match the contract's merkle root")
+	}
+
+	// sanity check the indices
+	if uint64(len(indices)) > numSectors {
+		return types.ZeroCurrency, types.ZeroCurrency, fmt.Errorf("can't delete %v sectors from a contract with %v sectors", len(indices), numSectors)
+	}
+
+	// sort in descending order so that we can swap the sectors we want to
+	// delete towards the end of the contract, preparing them to be dropped
+	indices = append([]uint64(nil), indices...)
+	sort.Slice(indices, func(i, j int) bool {
+		return indices[i] > indices[j]
+	})
+
+	// build the program, alongside the equivalent write actions which we use
+	// to verify the proof of every instruction
+	var buf bytes.Buffer
+	e := types.NewEncoder(&buf)
+	var program []rhpv3.Instruction
+	var actions []rhpv2.RPCWriteAction
+	cIndex := numSectors - 1
+	for i, rIndex := range indices {
+		if rIndex > cIndex || (i > 0 && rIndex == indices[i-1]) {
+			return types.ZeroCurrency, types.ZeroCurrency, fmt.Errorf("invalid sector index %v", rIndex)
+		}
+		if cIndex != rIndex {
+			program = append(program, &rhpv3.InstrSwapSector{
+				Sector1Offset: uint64(buf.Len()),
+				Sector2Offset: uint64(buf.Len()) + 8,
+				ProofRequired: true,
+			})
+			actions = append(actions, rhpv2.RPCWriteAction{
+				Type: rhpv2.RPCWriteActionSwap,
+				A:    cIndex,
+				B:    rIndex,
+			})
+			e.WriteUint64(cIndex)
+			e.WriteUint64(rIndex)
+			e.Flush()
+		}
+		cIndex--
+	}
+	program = append(program, &rhpv3.InstrDropSectors{
+		SectorCountOffset: uint64(buf.Len()),
+		ProofRequired:     true,
+	})
+	actions = append(actions, rhpv2.RPCWriteAction{
+		Type: rhpv2.RPCWriteActionTrim,
+		A:    uint64(len(indices)),
+	})
+	e.WriteUint64(uint64(len(indices)))
+	e.Flush()
+
+	req := rhpv3.RPCExecuteProgramRequest{
+		FileContractID: rev.ParentID,
+		Program:        program,
+		ProgramData:    buf.Bytes(),
+	}
+
+	s, err := t.DialStream(ctx)
+	if err != nil {
+		return types.ZeroCurrency, types.ZeroCurrency, err
+	}
+	defer s.Close()
+
+	var cancellationToken types.Specifier
+	if err = s.WriteRequest(rhpv3.RPCExecuteProgramID, &pt.UID); err != nil {
+		return
+	} else if err = processPayment(s, payment); err != nil {
+		return
+	} else if err = s.WriteResponse(&req); err != nil {
 		return
-	} else if err = s.ReadResponse(&finalizeResp, 64); err != nil {
+	} else if err = s.ReadResponse(&cancellationToken, 16); err != nil {
+		return
+	}
+
+	// the host sends a response for every instruction, containing the
+	// contract's merkle root after executing the instruction and a proof that
+	// it was derived from the previous one
+	roots = append([]types.Hash256(nil), roots...)
+	root := rev.FileMerkleRoot
+	var executeResp rhpv3.RPCExecuteProgramResponse
+	for _, action := range actions {
+		if err = s.ReadResponse(&executeResp, defaultRPCResponseMaxSize); err != nil {
+			return
+		} else if err = executeResp.Error; err != nil {
+			refund = executeResp.FailureRefund
+			return
+		}
+
+		roots, err = verifyDeleteSectorsProof(roots, action, executeResp.Proof, root, executeResp.NewMerkleRoot)
+		if err != nil {
+			return types.ZeroCurrency, types.ZeroCurrency, err
+		}
+		root = executeResp.NewMerkleRoot
+	}
+	cost = executeResp.TotalCost
+
+	// finalize the program with a new revision.
+	newRevision := *rev
+	newValid, newMissed, err := updateRevisionOutputs(&newRevision, types.ZeroCurrency, types.ZeroCurrency)
+	if err != nil {
+		return types.ZeroCurrency, types.ZeroCurrency, err
+	}
+	newRevision.Filesize -= uint64(len(indices)) * rhpv2.SectorSize
+	newRevision.RevisionNumber++
+	newRevision.FileMerkleRoot = root
+	if executeResp.NewSize != newRevision.Filesize {
+		return types.ZeroCurrency, types.ZeroCurrency, fmt.Errorf("unexpected contract size after deleting sectors: %v != %v", executeResp.NewSize, newRevision.Filesize)
+	}
+
+	if err = finalizeProgram(s, renterKey, newRevision, newValid, newMissed); err != nil {
 		return
 	}
 
+	*rev = newRevision
+	return
+}
+
+// verifyDeleteSectorsProof verifies the proof the host sent for a swap or trim
+// instruction of a DeleteSectors program and returns the contract's roots after
+// applying the action. The modified leaves are taken from the given roots, that
+// way we don't rely on the host for those.
+func verifyDeleteSectorsProof(roots []types.Hash256, action rhpv2.RPCWriteAction, proof []types.Hash256, oldRoot, newRoot types.Hash256) ([]types.Hash256, error) {
+	numSectors := uint64(len(roots))
+	var leafHashes []types.Hash256
+	switch action.Type {
+	case rhpv2.RPCWriteActionSwap:
+		if action.A >= numSectors || action.B >= numSectors {
+			return nil, fmt.Errorf("invalid swap of sectors %v and %v in a contract with %v sectors", action.A, action.B, numSectors)
+		}
+		leafHashes = []types.Hash256{roots[action.A], roots[action.B]}
+		if action.A > action.B {
+			leafHashes[0], leafHashes[1] = leafHashes[1], leafHashes[0]
+		}
+	case rhpv2.RPCWriteActionTrim:
+		if action.A > numSectors {
+			return nil, fmt.Errorf("invalid trim of %v sectors in a contract with %v sectors", action.A, numSectors)
+		}
+		leafHashes = roots[numSectors-action.A:]
+	default:
+		return nil, fmt.Errorf("unsupported action %v", action.Type)
+	}
+	if !rhpv2.VerifyDiffProof([]rhpv2.RPCWriteAction{action}, numSectors, proof, leafHashes, oldRoot, newRoot, nil) {
+		return nil, fmt.Errorf("%w: %v diff proof verification failed", ErrInvalidMerkleProof, action.Type)
+	}
+
+	// apply the action
+	if action.Type == rhpv2.RPCWriteActionSwap {
+		roots[action.A], roots[action.B] = roots[action.B], roots[action.A]
+	} else {
+		roots = roots[:numSectors-action.A]
+	}
+	return roots, nil
+}
+
+// finalizeProgram signs the revision that results from executing a program
+// that requires finalization and sends it to the host.
+func finalizeProgram(s *streamV3, renterKey types.PrivateKey, rev types.FileContractRevision, valid, missed []types.Currency) error {
+	finalizeReq := rhpv3.RPCFinalizeProgramRequest{
+		Signature:         renterKey.SignHash(hashRevision(rev)),
+		ValidProofValues:  valid,
+		MissedProofValues: missed,
+		RevisionNumber:    rev.RevisionNumber,
+	}
+
+	var finalizeResp rhpv3.RPCFinalizeProgramResponse
+	if err := s.WriteResponse(&finalizeReq); err != nil {
+		return err
+	} else if err := s.ReadResponse(&finalizeResp, 64); err != nil {
+		return err
+	}
+
 	// read one more time to receive a potential error in case finalising the
 	// contract fails after receiving the RPCFinalizeProgramResponse. This also
 	// guarantees that the program is finalised before we return.
@@ -1326,12 +1785,9 @@ func RPCAppendSector(ctx context.Context, t *transportV3, renterKey types.Privat
 		!errors.Is(errFinalise, mux.ErrClosedStream) &&
 		!errors.Is(errFinalise, mux.ErrPeerClosedStream) &&
 		!errors.Is(errFinalise, mux.ErrPeerClosedConn) {
-		err = errFinalise
-		return
+		return errFinalise
 	}
-
-	*rev = newRevision
-	return
+	return nil
 }
 
 func RPCRenew(ctx context.Context, rrr api.RHPRenewRequest, bus Bus, t *transportV3, pt *rhpv3.HostPriceTable, rev types.FileContractRevision, renterKey types.PrivateKey, l *zap.SugaredLogger) (_ rhpv2.ContractRevision, _ []types.Transaction, err error) {
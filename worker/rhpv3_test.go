@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	rhpv3 "go.sia.tech/core/rhp/v3"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+type noopGougingChecker struct{}
+
+func (noopGougingChecker) Check(*rhpv2.HostSettings, *rhpv3.HostPriceTable) api.HostGougingBreakdown {
+	return api.HostGougingBreakdown{}
+}
+
+func (noopGougingChecker) CheckPriceTablePayment(rhpv3.HostPriceTable) error { return nil }
+
+func TestWithdrawalExpiry(t *testing.T) {
+	tests := []struct {
+		bh, hostBH uint64
+		want       uint64
+	}{
+		{100, 100, 100 + defaultWithdrawalExpiryBlocks},                        // in sync
+		{100, 95, 95 + defaultWithdrawalExpiryBlocks},                          // host lags
+		{100, 103, 103 + defaultWithdrawalExpiryBlocks},                        // host is ahead
+		{100, 0, 100 - maxHostHeightOffset + defaultWithdrawalExpiryBlocks},    // host lags too much
+		{100, 1000, 100 + maxHostHeightOffset + defaultWithdrawalExpiryBlocks}, // host is too far ahead
+		{5, 0, defaultWithdrawalExpiryBlocks},                                  // low heights don't underflow
+	}
+	for _, test := range tests {
+		if got := withdrawalExpiry(test.bh, test.hostBH); got != test.want {
+			t.Fatalf("bh %v, host bh %v: expected expiry %v, got %v", test.bh, test.hostBH, test.want, got)
+		}
+	}
+
+	// assert price tables paid by account expire relative to the host's height
+	h := &host{accountKey: types.GeneratePrivateKey()}
+	payment, err := h.preparePriceTableAccountPayment(noopGougingChecker{}, 100)(rhpv3.HostPriceTable{HostBlockHeight: 95})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, ok := payment.(*rhpv3.PayByEphemeralAccountRequest)
+	if !ok {
+		t.Fatalf("unexpected payment type %T", payment)
+	} else if req.Expiry != 95+defaultWithdrawalExpiryBlocks {
+		t.Fatalf("expected expiry %v, got %v", 95+defaultWithdrawalExpiryBlocks, req.Expiry)
+	}
+}
+
+func TestVerifyDeleteSectorsProof(t *testing.T) {
+	roots := make([]types.Hash256, 10)
+	for i := range roots {
+		roots[i] = types.Hash256{byte(i + 1)}
+	}
+
+	// swap two sectors towards the end and trim them, like a DeleteSectors
+	// program would, using proofs built by an honest host
+	actions := []rhpv2.RPCWriteAction{
+		{Type: rhpv2.RPCWriteActionSwap, A: 9, B: 2},
+		{Type: rhpv2.RPCWriteActionSwap, A: 8, B: 5},
+		{Type: rhpv2.RPCWriteActionTrim, A: 2},
+	}
+	hostRoots := append([]types.Hash256(nil), roots...)
+	root := rhpv2.MetaRoot(roots)
+	for _, action := range actions {
+		proof, _ := rhpv2.BuildDiffProof([]rhpv2.RPCWriteAction{action}, hostRoots)
+		if action.Type == rhpv2.RPCWriteActionSwap {
+			hostRoots[action.A], hostRoots[action.B] = hostRoots[action.B], hostRoots[action.A]
+		} else {
+			hostRoots = hostRoots[:uint64(len(hostRoots))-action.A]
+		}
+		newRoot := rhpv2.MetaRoot(hostRoots)
+
+		// assert a root that doesn't match the proof is rejected
+		if _, err := verifyDeleteSectorsProof(append([]types.Hash256(nil), roots...), action, proof, root, types.Hash256{1}); !errors.Is(err, ErrInvalidMerkleProof) {
+			t.Fatal("unexpected error", err)
+		}
+
+		var err error
+		roots, err = verifyDeleteSectorsProof(roots, action, proof, root, newRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root = newRoot
+	}
+
+	// assert the sectors were deleted
+	if len(roots) != 8 {
+		t.Fatal("unexpected number of roots", len(roots))
+	} else if rhpv2.MetaRoot(roots) != root {
+		t.Fatal("unexpected root")
+	}
+	for _, r := range roots {
+		if r == (types.Hash256{3}) || r == (types.Hash256{6}) {
+			t.Fatal("sector wasn't deleted", r)
+		}
+	}
+
+	// assert invalid actions are rejected
+	if _, err := verifyDeleteSectorsProof(roots, rhpv2.RPCWriteAction{Type: rhpv2.RPCWriteActionSwap, A: 8, B: 0}, nil, root, root); err == nil {
+		t.Fatal("expected error")
+	} else if _, err := verifyDeleteSectorsProof(roots, rhpv2.RPCWriteAction{Type: rhpv2.RPCWriteActionTrim, A: 9}, nil, root, root); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,239 @@
+package worker
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// jobSchedulerMaxRunning is the maximum number of jobs the worker runs
+	// concurrently across all job classes.
+	jobSchedulerMaxRunning = 64
+
+	// jobSchedulerReservedDownloads is the number of slots that are reserved
+	// for downloads, background jobs combined never use more than the
+	// remaining slots so downloads can always start right away.
+	jobSchedulerReservedDownloads = 16
+)
+
+const (
+	// job classes, ordered by priority
+	jobClassDownload jobClass = iota
+	jobClassUpload
+	jobClassMigration
+	jobClassScan
+
+	numJobClasses
+)
+
+var (
+	// jobClassLimits holds the maximum number of concurrently running jobs
+	// and the maximum number of queued jobs per job class, migrations are
+	// capped well below the global limit so they can never take all slots
+	// away from user-facing downloads.
+	jobClassLimits = [numJobClasses]struct {
+		running int
+		queued  int
+	}{
+		jobClassDownload:  {running: jobSchedulerMaxRunning, queued: 1024},
+		jobClassUpload:    {running: 32, queued: 1024},
+		jobClassMigration: {running: 8, queued: 256},
+		jobClassScan:      {running: 32, queued: 1024},
+	}
+
+	errJobQueueFull        = errors.New("job queue is full")
+	errJobSchedulerStopped = errors.New("job scheduler was stopped")
+)
+
+type (
+	jobClass int
+
+	// jobScheduler limits the number of jobs the worker runs concurrently,
+	// whenever a slot frees up it's handed to the queued job of the highest
+	// priority class that is still below its own concurrency limit.
+	jobScheduler struct {
+		mu         sync.Mutex
+		running    int
+		queues     [numJobClasses]*list.List
+		numRunning [numJobClasses]int
+		stopped    bool
+	}
+
+	jobTicket struct {
+		ready     chan struct{}
+		scheduled bool
+	}
+)
+
+func (c jobClass) String() string {
+	switch c {
+	case jobClassDownload:
+		return "download"
+	case jobClassUpload:
+		return "upload"
+	case jobClassMigration:
+		return "migration"
+	case jobClassScan:
+		return "scan"
+	default:
+		return "unknown"
+	}
+}
+
+func (w *worker) initJobScheduler() {
+	if w.scheduler != nil {
+		panic("job scheduler already initialized") // developer error
+	}
+	w.scheduler = newJobScheduler()
+}
+
+func newJobScheduler() *jobScheduler {
+	s := &jobScheduler{}
+	for i := range s.queues {
+		s.queues[i] = list.New()
+	}
+	return s
+}
+
+// Acquire blocks until the job is allowed to run, the returned function has
+// to be called when the job is done. An error is returned if the queue of the
+// job's class is full, applying backpressure to the caller.
+func (s *jobScheduler) Acquire(ctx context.Context, class jobClass) (release func(), _ error) {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil, errJobSchedulerStopped
+	}
+
+	// run the job right away if possible, queued jobs of a higher priority
+	// class are always blocked by their own limit since free slots are handed
+	// out as soon as they become available
+	if s.canRun(class) && s.queues[class].Len() == 0 {
+		s.start(class)
+		s.mu.Unlock()
+		return s.releaseFn(class), nil
+	} else if s.queues[class].Len() >= jobClassLimits[class].queued {
+		s.mu.Unlock()
+		return nil, errJobQueueFull
+	}
+
+	// queue the job
+	t := &jobTicket{ready: make(chan struct{})}
+	elem := s.queues[class].PushBack(t)
+	s.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+	case <-t.ready:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-t.ready:
+		// the job might have been scheduled right before the context was
+		// closed, in which case we still hand out the slot
+		if !t.scheduled {
+			return nil, errJobSchedulerStopped
+		}
+		return s.releaseFn(class), nil
+	default:
+	}
+	s.queues[class].Remove(elem)
+	return nil, ctx.Err()
+}
+
+// Stats returns the number of running and queued jobs per job class.
+func (s *jobScheduler) Stats() []api.WorkerJobQueue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queues := make([]api.WorkerJobQueue, numJobClasses)
+	for class := jobClass(0); class < numJobClasses; class++ {
+		queues[class] = api.WorkerJobQueue{
+			Class:   class.String(),
+			Limit:   uint64(jobClassLimits[class].running),
+			Queued:  uint64(s.queues[class].Len()),
+			Running: uint64(s.numRunning[class]),
+		}
+	}
+	return queues
+}
+
+// Stop stops the scheduler, queued jobs are cancelled and no new jobs are
+// accepted.
+func (s *jobScheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	for _, q := range s.queues {
+		for elem := q.Front(); elem != nil; elem = elem.Next() {
+			close(elem.Value.(*jobTicket).ready)
+		}
+		q.Init()
+	}
+}
+
+func (s *jobScheduler) canRun(class jobClass) bool {
+	if s.running >= jobSchedulerMaxRunning || s.numRunning[class] >= jobClassLimits[class].running {
+		return false
+	}
+	return class == jobClassDownload || s.running-s.numRunning[jobClassDownload] < jobSchedulerMaxRunning-jobSchedulerReservedDownloads
+}
+
+func (s *jobScheduler) start(class jobClass) {
+	s.running++
+	s.numRunning[class]++
+}
+
+func (s *jobScheduler) releaseFn(class jobClass) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.running--
+			s.numRunning[class]--
+			s.schedule()
+		})
+	}
+}
+
+// schedule hands out free slots to queued jobs in order of priority, a class
+// that reached its own limit doesn't block jobs of lower priority classes.
+func (s *jobScheduler) schedule() {
+	if s.stopped {
+		return
+	}
+	for class := jobClass(0); class < numJobClasses && s.running < jobSchedulerMaxRunning; class++ {
+		q := s.queues[class]
+		for q.Len() > 0 && s.canRun(class) {
+			t := q.Remove(q.Front()).(*jobTicket)
+			s.start(class)
+			t.scheduled = true
+			close(t.ready)
+		}
+	}
+}
+
+// scheduleJob waits until a job of the given class is allowed to run, it
+// writes an error to the response and returns nil if it's not.
+func (w *worker) scheduleJob(ctx context.Context, jc jape.Context, class jobClass) (release func()) {
+	release, err := w.scheduler.Acquire(ctx, class)
+	if errors.Is(err, errJobQueueFull) {
+		jc.Error(fmt.Errorf("failed to schedule %v job; %w", class, err), http.StatusTooManyRequests)
+		return nil
+	} else if jc.Check(fmt.Sprintf("failed to schedule %v job", class), err) != nil {
+		return nil
+	}
+	return release
+}
@@ -0,0 +1,131 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobScheduler(t *testing.T) {
+	s := newJobScheduler()
+
+	// acquire is a helper that acquires a slot and fails if the job had to
+	// wait
+	acquire := func(class jobClass) func() {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		release, err := s.Acquire(ctx, class)
+		if err != nil {
+			t.Fatalf("failed to acquire %v slot: %v", class, err)
+		}
+		return release
+	}
+
+	// queue is a helper that acquires a slot in a goroutine and returns a
+	// channel that receives the result once the job was scheduled
+	type result struct {
+		release func()
+		err     error
+	}
+	queue := func(ctx context.Context, class jobClass) chan result {
+		t.Helper()
+		before := s.Stats()[class].Queued
+		ch := make(chan result, 1)
+		go func() {
+			release, err := s.Acquire(ctx, class)
+			ch <- result{release, err}
+		}()
+		for i := 0; s.Stats()[class].Queued == before; i++ {
+			if i == 100 {
+				t.Fatalf("%v job wasn't queued", class)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return ch
+	}
+	assertWaiting := func(ch chan result) {
+		t.Helper()
+		select {
+		case <-ch:
+			t.Fatal("job wasn't supposed to be scheduled")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	assertScheduled := func(ch chan result) func() {
+		t.Helper()
+		select {
+		case res := <-ch:
+			if res.err != nil {
+				t.Fatal(res.err)
+			}
+			return res.release
+		case <-time.After(time.Second):
+			t.Fatal("job wasn't scheduled")
+		}
+		return nil
+	}
+
+	// fill up the slots for background jobs
+	var releases []func()
+	for i := 0; i < jobClassLimits[jobClassUpload].running; i++ {
+		releases = append(releases, acquire(jobClassUpload))
+	}
+	for i := 0; i < jobSchedulerMaxRunning-jobSchedulerReservedDownloads-jobClassLimits[jobClassUpload].running; i++ {
+		releases = append(releases, acquire(jobClassScan))
+	}
+
+	// assert background jobs can't take the reserved slots
+	scan := queue(context.Background(), jobClassScan)
+	assertWaiting(scan)
+
+	// assert downloads can use the reserved slots
+	for i := 0; i < jobSchedulerReservedDownloads; i++ {
+		releases = append(releases, acquire(jobClassDownload))
+	}
+	if stats := s.Stats(); stats[jobClassDownload].Running != jobSchedulerReservedDownloads || stats[jobClassScan].Queued != 1 {
+		t.Fatal("unexpected stats", stats)
+	}
+
+	// queue a download, once a slot frees up it's handed to the download
+	// since it has a higher priority
+	download := queue(context.Background(), jobClassDownload)
+	releases[0]()
+	releases[0]() // no-op
+	releases = append(releases, assertScheduled(download))
+	assertWaiting(scan)
+
+	// release the download, now that fewer background jobs are running the
+	// scan takes its slot
+	releases[len(releases)-1]()
+	releases = append(releases, assertScheduled(scan))
+
+	// assert a queued job can be interrupted
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupted := queue(ctx, jobClassMigration)
+	cancel()
+	if res := <-interrupted; !errors.Is(res.err, context.Canceled) {
+		t.Fatal("unexpected error", res.err)
+	} else if stats := s.Stats(); stats[jobClassMigration].Queued != 0 || stats[jobClassMigration].Running != 0 {
+		t.Fatal("unexpected stats", stats)
+	}
+
+	// assert stopping the scheduler interrupts queued jobs and rejects new
+	// ones
+	migration := queue(context.Background(), jobClassMigration)
+	s.Stop()
+	if res := <-migration; !errors.Is(res.err, errJobSchedulerStopped) {
+		t.Fatal("unexpected error", res.err)
+	} else if _, err := s.Acquire(context.Background(), jobClassDownload); !errors.Is(err, errJobSchedulerStopped) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert running jobs can still be released
+	for _, release := range releases {
+		release()
+	}
+	if stats := s.Stats(); stats[jobClassUpload].Running != 0 || stats[jobClassScan].Running != 0 || stats[jobClassDownload].Running != 0 {
+		t.Fatal("unexpected stats", stats)
+	}
+}
@@ -0,0 +1,281 @@
+package worker
+
+import (
+	"container/list"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+type (
+	// sectorCacheStore stores the data of the sectors in the sector cache,
+	// the cache decides what is stored and evicts entries from the store.
+	// Entries are keyed by the cached range, so the data stored for a key
+	// never changes.
+	sectorCacheStore interface {
+		Get(e sectorCacheEntry) ([]byte, error)
+		Put(e sectorCacheEntry, data []byte) error
+		Delete(e sectorCacheEntry)
+	}
+
+	// sectorCache is a bounded read-through LRU cache of sector data keyed by
+	// sector root. Sectors are immutable and their data is verified against
+	// the root when it's downloaded, so entries never have to be invalidated.
+	// The cache only holds the encrypted shard data as it's stored on the
+	// host.
+	sectorCache struct {
+		store   sectorCacheStore
+		maxSize uint64
+
+		mu        sync.Mutex
+		size      uint64
+		lru       *list.List
+		entries   map[types.Hash256]*list.Element
+		hits      uint64
+		misses    uint64
+		evictions uint64
+	}
+
+	// sectorCacheEntry is the range of a sector that is cached, entries are
+	// only served once their data was stored.
+	sectorCacheEntry struct {
+		root   types.Hash256
+		offset uint32
+		length uint32
+		stored bool
+	}
+
+	// memorySectorCacheStore keeps the cached sectors in memory.
+	memorySectorCacheStore struct {
+		mu   sync.Mutex
+		data map[sectorCacheEntry][]byte
+	}
+
+	// diskSectorCacheStore keeps the cached sectors on disk, one file per
+	// sector.
+	diskSectorCacheStore struct {
+		dir string
+	}
+)
+
+// sectorCacheFileExt is the extension of the files the disk store creates,
+// only files with this extension are removed when the cache is created.
+const sectorCacheFileExt = ".sector"
+
+var errSectorCacheMiss = errors.New("sector cache miss")
+
+// newSectorCache creates a sector cache that holds up to maxSize bytes, the
+// sectors are stored on disk in the given directory or in memory if the
+// directory is empty.
+func newSectorCache(dir string, maxSize uint64) (*sectorCache, error) {
+	var store sectorCacheStore
+	if dir == "" {
+		store = &memorySectorCacheStore{data: make(map[sectorCacheEntry][]byte)}
+	} else {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create sector cache dir: %w", err)
+		}
+
+		// the cache doesn't survive restarts, remove the sectors of a
+		// previous run but leave any other files in the directory alone
+		files, err := filepath.Glob(filepath.Join(dir, "*"+sectorCacheFileExt))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sector cache dir: %w", err)
+		}
+		for _, file := range files {
+			if err := os.Remove(file); err != nil {
+				return nil, fmt.Errorf("failed to clear sector cache dir: %w", err)
+			}
+		}
+		store = &diskSectorCacheStore{dir: dir}
+	}
+	return &sectorCache{
+		store:   store,
+		maxSize: maxSize,
+
+		lru:     list.New(),
+		entries: make(map[types.Hash256]*list.Element),
+	}, nil
+}
+
+// Contains returns whether the given range of the sector with given root is
+// cached, unlike Get it doesn't count as a hit or a miss.
+func (c *sectorCache) Contains(root types.Hash256, offset, length uint32) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[root]
+	return ok && el.Value.(*sectorCacheEntry).contains(offset, length)
+}
+
+// Get returns the given range of the sector with given root if it's cached.
+func (c *sectorCache) Get(root types.Hash256, offset, length uint32) ([]byte, bool) {
+	c.mu.Lock()
+	var entry sectorCacheEntry
+	el, ok := c.entries[root]
+	if ok && el.Value.(*sectorCacheEntry).contains(offset, length) {
+		c.lru.MoveToFront(el)
+		entry = *el.Value.(*sectorCacheEntry)
+	} else {
+		ok = false
+		c.misses++
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	// the entry might be evicted while we read it, in which case it's a
+	// miss, since the store is keyed by range the data can't be replaced
+	data, err := c.store.Get(entry.key())
+	start := offset - entry.offset
+	if err != nil || uint64(len(data)) != uint64(entry.length) {
+		c.mu.Lock()
+		c.misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	c.mu.Lock()
+	c.hits++
+	c.mu.Unlock()
+	return data[start : start+length], true
+}
+
+// Add adds the given range of the sector with given root to the cache, data
+// is copied so the caller is free to modify it afterwards.
+func (c *sectorCache) Add(root types.Hash256, offset, length uint32, data []byte) {
+	size := uint64(len(data))
+	if size != uint64(length) || size > c.maxSize {
+		return
+	}
+
+	// reserve space for the entry and collect the entries we evict, the
+	// entry isn't served until its data was stored
+	c.mu.Lock()
+	var evicted []sectorCacheEntry
+	if el, exists := c.entries[root]; exists {
+		if el.Value.(*sectorCacheEntry).covers(offset, length) {
+			c.mu.Unlock()
+			return
+		}
+		evicted = append(evicted, c.removeEntry(el))
+	}
+	for c.size+size > c.maxSize && c.lru.Len() > 0 {
+		evicted = append(evicted, c.removeEntry(c.lru.Back()))
+		c.evictions++
+	}
+	entry := &sectorCacheEntry{
+		root:   root,
+		offset: offset,
+		length: length,
+	}
+	el := c.lru.PushFront(entry)
+	c.entries[root] = el
+	c.size += size
+	c.mu.Unlock()
+
+	// update the store without holding the lock
+	for _, e := range evicted {
+		c.store.Delete(e.key())
+	}
+	err := c.store.Put(entry.key(), data)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if current, exists := c.entries[root]; !exists || current != el {
+		// the entry was replaced or evicted while we stored it
+		c.store.Delete(entry.key())
+	} else if err != nil {
+		c.removeEntry(el) // caching is best effort
+	} else {
+		entry.stored = true
+	}
+}
+
+// Stats returns the sector cache's metrics.
+func (c *sectorCache) Stats() api.SectorCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return api.SectorCacheStats{
+		Entries:   uint64(c.lru.Len()),
+		Size:      c.size,
+		MaxSize:   c.maxSize,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+// removeEntry removes the entry from the cache, it's up to the caller to
+// remove its data from the store.
+func (c *sectorCache) removeEntry(el *list.Element) sectorCacheEntry {
+	entry := c.lru.Remove(el).(*sectorCacheEntry)
+	delete(c.entries, entry.root)
+	c.size -= uint64(entry.length)
+	return *entry
+}
+
+// contains returns whether the given range can be served from the entry.
+func (e *sectorCacheEntry) contains(offset, length uint32) bool {
+	return e.stored && e.covers(offset, length)
+}
+
+// covers returns whether the entry's range contains the given range.
+func (e *sectorCacheEntry) covers(offset, length uint32) bool {
+	return offset >= e.offset && uint64(offset)+uint64(length) <= uint64(e.offset)+uint64(e.length)
+}
+
+// key returns the key of the entry in the store.
+func (e sectorCacheEntry) key() sectorCacheEntry {
+	e.stored = false
+	return e
+}
+
+func (s *memorySectorCacheStore) Get(e sectorCacheEntry) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.data[e]
+	if !ok {
+		return nil, errSectorCacheMiss
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *memorySectorCacheStore) Put(e sectorCacheEntry, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[e] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *memorySectorCacheStore) Delete(e sectorCacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, e)
+}
+
+func (s *diskSectorCacheStore) Get(e sectorCacheEntry) ([]byte, error) {
+	data, err := os.ReadFile(s.path(e))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errSectorCacheMiss
+	}
+	return data, err
+}
+
+func (s *diskSectorCacheStore) Put(e sectorCacheEntry, data []byte) error {
+	return os.WriteFile(s.path(e), data, 0600)
+}
+
+func (s *diskSectorCacheStore) Delete(e sectorCacheEntry) {
+	_ = os.Remove(s.path(e))
+}
+
+func (s *diskSectorCacheStore) path(e sectorCacheEntry) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s-%d-%d%s", hex.EncodeToString(e.root[:]), e.offset, e.length, sectorCacheFileExt))
+}
@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"lukechampine.com/frand"
+)
+
+func TestSectorCache(t *testing.T) {
+	for _, dir := range []string{"", t.TempDir()} {
+		c, err := newSectorCache(dir, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// add a sector range
+		r1 := types.Hash256(frand.Entropy256())
+		d1 := frand.Bytes(40)
+		c.Add(r1, 10, 40, d1)
+
+		// assert ranges within the cached range are served
+		if data, ok := c.Get(r1, 10, 40); !ok || !bytes.Equal(data, d1) {
+			t.Fatal("unexpected data")
+		} else if data, ok := c.Get(r1, 20, 10); !ok || !bytes.Equal(data, d1[10:20]) {
+			t.Fatal("unexpected data")
+		} else if _, ok := c.Get(r1, 0, 20); ok {
+			t.Fatal("expected miss")
+		} else if _, ok := c.Get(r1, 40, 20); ok {
+			t.Fatal("expected miss")
+		}
+
+		// assert a larger range replaces the cached range
+		d1 = frand.Bytes(60)
+		c.Add(r1, 0, 60, d1)
+		if data, ok := c.Get(r1, 10, 40); !ok || !bytes.Equal(data, d1[10:50]) {
+			t.Fatal("unexpected data")
+		}
+
+		// add another sector and assert the least recently used one is
+		// evicted
+		r2 := types.Hash256(frand.Entropy256())
+		d2 := frand.Bytes(50)
+		c.Add(r2, 0, 50, d2)
+		if _, ok := c.Get(r1, 0, 60); ok {
+			t.Fatal("expected miss")
+		} else if data, ok := c.Get(r2, 0, 50); !ok || !bytes.Equal(data, d2) {
+			t.Fatal("unexpected data")
+		}
+
+		// assert data that doesn't match the length or exceeds the max size
+		// is ignored
+		c.Add(r1, 0, 10, frand.Bytes(20))
+		c.Add(r1, 0, 200, frand.Bytes(200))
+		if c.Contains(r1, 0, 10) {
+			t.Fatal("unexpected entry")
+		}
+
+		stats := c.Stats()
+		if stats.Entries != 1 || stats.Size != 50 || stats.MaxSize != 100 || stats.Hits != 4 || stats.Misses != 3 || stats.Evictions != 1 {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+	}
+}
+
+func TestSectorCacheDir(t *testing.T) {
+	dir := t.TempDir()
+
+	// create a file that doesn't belong to the cache
+	other := filepath.Join(dir, "other.txt")
+	if err := os.WriteFile(other, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// add a sector to the cache
+	c, err := newSectorCache(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Add(types.Hash256{1}, 0, 10, frand.Bytes(10))
+	if files, _ := filepath.Glob(filepath.Join(dir, "*"+sectorCacheFileExt)); len(files) != 1 {
+		t.Fatalf("expected 1 sector file, got %v", len(files))
+	}
+
+	// recreate the cache and assert only the sector was removed
+	if _, err := newSectorCache(dir, 100); err != nil {
+		t.Fatal(err)
+	} else if files, _ := filepath.Glob(filepath.Join(dir, "*"+sectorCacheFileExt)); len(files) != 0 {
+		t.Fatalf("expected no sector files, got %v", len(files))
+	} else if _, err := os.Stat(other); err != nil {
+		t.Fatal("file was removed", err)
+	}
+}
+
+func TestSectorCacheConcurrency(t *testing.T) {
+	c, err := newSectorCache(t.TempDir(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the data of every range is derived from the offset, so we can verify
+	// the data that is returned while ranges are replaced concurrently
+	roots := []types.Hash256{{1}, {2}, {3}}
+	rangeData := func(offset, length uint32) []byte {
+		data := make([]byte, length)
+		for i := range data {
+			data[i] = byte(offset + uint32(i))
+		}
+		return data
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				root := roots[frand.Intn(len(roots))]
+				offset, length := uint32(frand.Intn(100)), uint32(frand.Intn(300)+1)
+				if frand.Intn(2) == 0 {
+					c.Add(root, offset, length, rangeData(offset, length))
+				} else if data, ok := c.Get(root, offset, length/2); ok && !bytes.Equal(data, rangeData(offset, length/2)) {
+					t.Error("unexpected data")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
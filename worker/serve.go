@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 
 	"github.com/gotd/contrib/http_range"
@@ -24,6 +25,21 @@ type (
 		seekOffset  int64
 		dataOffset  int64
 	}
+
+	// trailerWriter wraps a http.ResponseWriter and declares the given
+	// trailers, it drops the Content-Length header to ensure the response is
+	// chunked since trailers can't be sent otherwise
+	trailerWriter struct {
+		http.ResponseWriter
+	}
+
+	// flushWriter wraps a http.ResponseWriter and flushes after every write,
+	// ensuring the client receives the object's data as soon as it was
+	// downloaded rather than when the server's buffers are full
+	flushWriter struct {
+		http.ResponseWriter
+		f http.Flusher
+	}
 )
 
 var errMultiRangeNotSupported = errors.New("multipart ranges are not supported")
@@ -60,6 +76,40 @@ func (cr *contentReader) Read(p []byte) (int, error) {
 	return cr.r.Read(p)
 }
 
+func newTrailerWriter(rw http.ResponseWriter, trailers ...string) http.ResponseWriter {
+	for _, trailer := range trailers {
+		rw.Header().Add("Trailer", trailer)
+	}
+	return &trailerWriter{ResponseWriter: rw}
+}
+
+func (tw *trailerWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (tw *trailerWriter) WriteHeader(statusCode int) {
+	tw.Header().Del("Content-Length")
+	tw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func newFlushWriter(rw http.ResponseWriter) http.ResponseWriter {
+	f, ok := rw.(http.Flusher)
+	if !ok {
+		return rw
+	}
+	return &flushWriter{ResponseWriter: rw, f: f}
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.ResponseWriter.Write(p)
+	if err == nil {
+		fw.f.Flush()
+	}
+	return n, err
+}
+
 func serveContent(rw http.ResponseWriter, req *http.Request, obj api.Object, downloadFn func(w io.Writer, offset, length int64) error) (int, error) {
 	// parse offset and length from the request range header
 	offset, length, err := parseRangeHeader(req, obj)
@@ -93,11 +143,40 @@ func serveContent(rw http.ResponseWriter, req *http.Request, obj api.Object, dow
 	// serveContent does that for us
 	rw.Header().Set("ETag", api.FormatETag(buildETag(req, obj.ETag)))
 	rw.Header().Set("Content-Type", contentType)
+	obj.Metadata.ApplyHeaders(rw.Header())
 
-	http.ServeContent(rw, req, obj.Name, obj.ModTime, rs)
+	http.ServeContent(newFlushWriter(rw), req, obj.Name, obj.ModTime, rs)
 	return http.StatusOK, nil
 }
 
+// requestMimeType returns the media type of the request's body as specified by
+// its Content-Type header. Invalid headers and the generic octet-stream type,
+// which clients tend to send by default, are ignored so the mime type is
+// detected from the object's path or content instead.
+func requestMimeType(req *http.Request) string {
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mediaType == "application/octet-stream" {
+		return ""
+	}
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// serveMetadata writes the headers describing the given object without
+// serving its content, it's used for HEAD requests and empty objects.
+func serveMetadata(rw http.ResponseWriter, req *http.Request, obj api.Object) {
+	om := obj.ObjectMetadata
+	contentType := om.ContentType()
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	rw.Header().Set("Content-Length", fmt.Sprint(om.Size))
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("ETag", api.FormatETag(buildETag(req, om.ETag)))
+	rw.Header().Set("Last-Modified", om.LastModified())
+	obj.Metadata.ApplyHeaders(rw.Header())
+	rw.WriteHeader(http.StatusOK)
+}
+
 func parseRangeHeader(req *http.Request, obj api.Object) (int64, int64, error) {
 	// parse the request range
 	ranges, err := http_range.ParseRange(req.Header.Get("Range"), obj.Size)
@@ -67,14 +67,14 @@ func (sr *contractSpendingRecorder) Record(fcid types.FileContractID, revisionNu
 	// Otherwise we schedule a flush.
 	sr.contractSpendingsFlushTimer = time.AfterFunc(sr.flushInterval, func() {
 		sr.mu.Lock()
-		sr.flush()
+		sr.flush(context.Background())
 		sr.mu.Unlock()
 	})
 }
 
-func (sr *contractSpendingRecorder) flush() {
+func (sr *contractSpendingRecorder) flush(ctx context.Context) {
 	if len(sr.contractSpendings) > 0 {
-		ctx, span := tracing.Tracer.Start(context.Background(), "worker: flushContractSpending")
+		ctx, span := tracing.Tracer.Start(ctx, "worker: flushContractSpending")
 		defer span.End()
 		records := make([]api.ContractSpendingRecord, 0, len(sr.contractSpendings))
 		for _, cs := range sr.contractSpendings {
@@ -89,12 +89,14 @@ func (sr *contractSpendingRecorder) flush() {
 	sr.contractSpendingsFlushTimer = nil
 }
 
-// Stop stops the flush timer.
-func (sr *contractSpendingRecorder) Stop() {
+// Stop stops the flush timer and flushes the buffered records, it returns the
+// number of records that could not be flushed.
+func (sr *contractSpendingRecorder) Stop(ctx context.Context) int {
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 	if sr.contractSpendingsFlushTimer != nil {
 		sr.contractSpendingsFlushTimer.Stop()
-		sr.flush()
 	}
+	sr.flush(ctx)
+	return len(sr.contractSpendings)
 }
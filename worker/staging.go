@@ -0,0 +1,531 @@
+package worker
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/alerts"
+	"go.sia.tech/renterd/api"
+	"lukechampine.com/frand"
+)
+
+const (
+	// stagedUploadAlertAttempts is the number of failed attempts after which
+	// an alert is registered for a staged upload.
+	stagedUploadAlertAttempts = 3
+
+	// stagedUploadRetryMinInterval and stagedUploadRetryMaxInterval bound
+	// the interval at which failed staged uploads are retried, the interval
+	// doubles with every failed attempt.
+	stagedUploadRetryMinInterval = 30 * time.Second
+	stagedUploadRetryMaxInterval = time.Hour
+
+	stagedUploadDataExt = ".data"
+	stagedUploadMetaExt = ".json"
+	stagedUploadTmpExt  = ".tmp"
+)
+
+var alertStagedUploadID = types.HashBytes([]byte("stagedupload")) // constant across restarts
+
+type (
+	// uploadStager stages uploads on disk and uploads them to the hosts in
+	// the background. Staged uploads are fsynced before they're
+	// acknowledged, so they survive crashes and restarts, and they're
+	// retried until they succeed. Uploading or staging an object
+	// supersedes the uploads that were staged to the same path before, so
+	// a retried upload never overwrites a more recent one.
+	uploadStager struct {
+		w        *worker
+		dir      string
+		stopChan chan struct{}
+		wakeChan chan struct{}
+		wg       sync.WaitGroup
+
+		mu             sync.Mutex
+		uploads        map[string]*stagedUpload
+		inflight       *stagedUpload // upload that is being uploaded
+		inflightCancel context.CancelFunc
+	}
+
+	// stagedUpload is the metadata of a staged upload, it's persisted next to
+	// the staged data.
+	stagedUpload struct {
+		api.StagedUpload
+
+		ContractSet string                 `json:"contractSet"`
+		MimeType    string                 `json:"mimeType"`
+		Metadata    api.ObjectUserMetadata `json:"metadata"`
+		MinShards   int                    `json:"minShards"`
+		TotalShards int                    `json:"totalShards"`
+
+		// pausedUntil is the time until which the upload is paused because
+		// it was rejected by the maintenance mode
+		pausedUntil time.Time
+	}
+)
+
+func (w *worker) initUploadStager(dir string) error {
+	if w.uploadStager != nil {
+		panic("upload stager already initialized") // developer error
+	} else if dir == "" {
+		return nil
+	}
+	s, err := newUploadStager(w, dir)
+	if err != nil {
+		return err
+	}
+	w.uploadStager = s
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.threadedUpload()
+	}()
+	return nil
+}
+
+// newUploadStager creates a stager that stages uploads in the given directory,
+// uploads that were staged before the worker restarted are restored.
+func newUploadStager(w *worker, dir string) (*uploadStager, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create upload staging dir: %w", err)
+	}
+	s := &uploadStager{
+		w:        w,
+		dir:      dir,
+		stopChan: make(chan struct{}),
+		wakeChan: make(chan struct{}, 1),
+		uploads:  make(map[string]*stagedUpload),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload staging dir: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasSuffix(name, stagedUploadTmpExt):
+			// uploads that weren't acknowledged are removed
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return nil, fmt.Errorf("failed to remove incomplete staged upload: %w", err)
+			}
+		case strings.HasSuffix(name, stagedUploadMetaExt):
+			b, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read staged upload: %w", err)
+			}
+			var su stagedUpload
+			if err := json.Unmarshal(b, &su); err != nil {
+				return nil, fmt.Errorf("failed to decode staged upload %v: %w", name, err)
+			}
+			s.uploads[su.ID] = &su
+		}
+	}
+
+	// data without metadata belongs to uploads that weren't acknowledged
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), stagedUploadDataExt)
+		if _, staged := s.uploads[id]; ok && !staged {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return nil, fmt.Errorf("failed to remove incomplete staged upload: %w", err)
+			}
+		}
+	}
+
+	// only the most recent upload to a path is restored
+	for _, su := range s.uploads {
+		if latest := s.latest(su.Bucket, su.Path); latest != su {
+			delete(s.uploads, su.ID)
+			if err := s.remove(su.ID); err != nil {
+				return nil, fmt.Errorf("failed to remove superseded staged upload: %w", err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// Stop stops uploading the staged uploads and waits for the upload in
+// progress to be interrupted, the uploads are resumed when the worker
+// restarts.
+func (s *uploadStager) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+// Uploads returns the staged uploads that weren't uploaded yet, sorted by the
+// time they were staged.
+func (s *uploadStager) Uploads() []api.StagedUpload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uploads := make([]api.StagedUpload, 0, len(s.uploads))
+	for _, su := range s.uploads {
+		uploads = append(uploads, su.StagedUpload)
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].StagedAt.Before(uploads[j].StagedAt)
+	})
+	return uploads
+}
+
+// Stage writes the data read from r to disk and queues it for upload. The
+// upload is only returned once both its data and metadata were fsynced.
+func (s *uploadStager) Stage(r io.Reader, su stagedUpload) (api.StagedUpload, error) {
+	su.ID = hex.EncodeToString(frand.Bytes(16))
+	su.StagedAt = time.Now().UTC()
+
+	// write the data
+	dataPath := filepath.Join(s.dir, su.ID+stagedUploadDataExt)
+	size, err := writeFileSync(dataPath, func(f *os.File) (int64, error) {
+		return io.Copy(f, r)
+	})
+	if err != nil {
+		return api.StagedUpload{}, err
+	}
+	su.Size = size
+
+	// write the metadata, its presence marks the upload as staged
+	if err := s.persist(&su); err != nil {
+		os.Remove(dataPath)
+		return api.StagedUpload{}, err
+	} else if err := syncDir(s.dir); err != nil {
+		os.Remove(dataPath)
+		os.Remove(filepath.Join(s.dir, su.ID+stagedUploadMetaExt))
+		return api.StagedUpload{}, err
+	}
+
+	s.Supersede(su.Bucket, su.Path)
+	s.mu.Lock()
+	s.uploads[su.ID] = &su
+	s.mu.Unlock()
+	s.wake()
+	return su.StagedUpload, nil
+}
+
+// Supersede removes the uploads that were staged to the given path, it's
+// called before the object at that path is overwritten. An upload that is in
+// progress is interrupted and removed once it returns.
+func (s *uploadStager) Supersede(bucket, path string) {
+	var superseded []string
+	s.mu.Lock()
+	for id, su := range s.uploads {
+		if su.Bucket != bucket || su.Path != path {
+			continue
+		}
+		delete(s.uploads, id)
+		if s.inflight != nil && s.inflight.ID == id {
+			s.inflightCancel()
+		} else {
+			superseded = append(superseded, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, id := range superseded {
+		if err := s.remove(id); err != nil {
+			s.w.logger.Errorw("failed to remove superseded staged upload", "id", id, "err", err)
+		}
+	}
+}
+
+// latest returns the most recently staged upload to the given path, the
+// caller must either hold the lock or be the only user of the stager.
+func (s *uploadStager) latest(bucket, path string) (latest *stagedUpload) {
+	for _, su := range s.uploads {
+		if su.Bucket == bucket && su.Path == path && (latest == nil || su.StagedAt.After(latest.StagedAt)) {
+			latest = su
+		}
+	}
+	return
+}
+
+// remove removes the files of a staged upload, the metadata is removed first
+// since data without metadata is ignored.
+func (s *uploadStager) remove(id string) error {
+	if err := os.Remove(filepath.Join(s.dir, id+stagedUploadMetaExt)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	} else if err := os.Remove(filepath.Join(s.dir, id+stagedUploadDataExt)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *uploadStager) wake() {
+	select {
+	case s.wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+func (s *uploadStager) persist(su *stagedUpload) error {
+	b, err := json.Marshal(su)
+	if err != nil {
+		return err
+	}
+	_, err = writeFileSync(filepath.Join(s.dir, su.ID+stagedUploadMetaExt), func(f *os.File) (int64, error) {
+		n, err := f.Write(b)
+		return int64(n), err
+	})
+	return err
+}
+
+// next returns the staged upload that is due next and the time it's due at,
+// uploads are processed in the order they were staged.
+func (s *uploadStager) next() (*stagedUpload, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next *stagedUpload
+	var nextAt time.Time
+	for _, su := range s.uploads {
+		dueAt := su.LastAttempt.Add(stagedUploadRetryInterval(su.Attempts))
+		if su.pausedUntil.After(dueAt) {
+			dueAt = su.pausedUntil
+		}
+		if next == nil || dueAt.Before(nextAt) || (dueAt.Equal(nextAt) && su.StagedAt.Before(next.StagedAt)) {
+			next, nextAt = su, dueAt
+		}
+	}
+	return next, nextAt
+}
+
+// stagedUploadRetryInterval returns the amount of time to wait before retrying
+// an upload that failed the given number of times.
+func stagedUploadRetryInterval(attempts int) time.Duration {
+	if attempts == 0 {
+		return 0
+	}
+	interval := stagedUploadRetryMinInterval
+	for i := 1; i < attempts && interval < stagedUploadRetryMaxInterval; i++ {
+		interval *= 2
+	}
+	if interval > stagedUploadRetryMaxInterval {
+		interval = stagedUploadRetryMaxInterval
+	}
+	return interval
+}
+
+func (s *uploadStager) threadedUpload() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.stopChan
+		cancel()
+	}()
+
+	for {
+		// wait for the next upload to be due
+		next, dueAt := s.next()
+		var timer <-chan time.Time
+		if next != nil {
+			timer = time.After(time.Until(dueAt))
+		}
+		select {
+		case <-s.stopChan:
+			return
+		case <-s.wakeChan:
+			continue
+		case <-timer:
+		}
+
+		// the upload might have been superseded while we were waiting
+		uploadCtx, uploadCancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		_, exists := s.uploads[next.ID]
+		if exists {
+			s.inflight, s.inflightCancel = next, uploadCancel
+		}
+		s.mu.Unlock()
+		if !exists {
+			uploadCancel()
+			continue
+		}
+
+		err := s.upload(uploadCtx, next)
+		uploadCancel()
+		if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+			return // shutdown
+		}
+		s.finish(ctx, next, err)
+	}
+}
+
+// upload uploads a staged upload to the hosts using the settings at the time
+// of the upload, the redundancy and contract set overrides of the original
+// upload are applied.
+func (s *uploadStager) upload(ctx context.Context, su *stagedUpload) error {
+	w := s.w
+	up, err := w.uploadParams(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch upload parameters from bus: %w", err)
+	}
+	b, err := w.bus.Bucket(ctx, su.Bucket)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch bucket from bus: %w", err)
+	}
+	up.GougingParams = b.Policy.Apply(up.GougingParams)
+	if su.ContractSet != "" {
+		up.ContractSet = su.ContractSet
+	}
+	if up.ContractSet == "" {
+		return api.ErrContractSetNotSpecified
+	} else if !up.ConsensusState.Synced {
+		return api.ErrConsensusNotSynced
+	} else if up.Maintenance.Active(time.Now()) {
+		return api.ErrMaintenanceMode
+	}
+
+	rs := up.RedundancySettings
+	if su.MinShards != 0 {
+		rs.MinShards = su.MinShards
+	}
+	if su.TotalShards != 0 {
+		rs.TotalShards = su.TotalShards
+	}
+	if err := rs.Validate(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, su.ID+stagedUploadDataExt))
+	if err != nil {
+		return fmt.Errorf("failed to open staged data: %w", err)
+	}
+	defer f.Close()
+
+	ctx = WithGougingChecker(ctx, w.consensus, up.GougingParams)
+	if _, err := w.upload(ctx, f, su.Bucket, su.Path,
+		WithBlockHeight(up.CurrentHeight),
+		WithContractSet(up.ContractSet),
+		WithCustomMetadata(su.Metadata),
+		WithMimeType(su.MimeType),
+		WithPacking(up.UploadPacking),
+		WithRedundancySettings(rs),
+	); err != nil {
+		return err
+	}
+
+	// invalidate cached ranges of the overwritten object
+	if w.downloadCache != nil {
+		w.downloadCache.Invalidate(su.Bucket, su.Path)
+	}
+	return nil
+}
+
+// finish removes a staged upload that succeeded and records the failure of one
+// that failed. An alert is registered for uploads that keep failing, it's
+// dismissed once the upload succeeds. Uploads that were superseded while
+// they were in progress are removed either way.
+func (s *uploadStager) finish(ctx context.Context, su *stagedUpload, err error) {
+	alertID := alertIDForStagedUpload(su.ID)
+	s.mu.Lock()
+	s.inflight, s.inflightCancel = nil, nil
+	_, exists := s.uploads[su.ID]
+	s.mu.Unlock()
+	if err == nil || !exists {
+		s.mu.Lock()
+		delete(s.uploads, su.ID)
+		attempts := su.Attempts
+		s.mu.Unlock()
+
+		if err := s.remove(su.ID); err != nil {
+			s.w.logger.Errorw("failed to remove staged upload", "id", su.ID, "err", err)
+		}
+		if attempts >= stagedUploadAlertAttempts {
+			if err := s.w.alerts.DismissAlerts(ctx, alertID); err != nil {
+				s.w.logger.Errorf("failed to dismiss staged upload alert: %v", err)
+			}
+		}
+		return
+	}
+
+	// uploads that were rejected by the maintenance mode are retried after
+	// the minimum interval, the rejection doesn't count as a failed attempt
+	if errors.Is(err, api.ErrMaintenanceMode) {
+		s.mu.Lock()
+		su.pausedUntil = time.Now().Add(stagedUploadRetryMinInterval)
+		s.mu.Unlock()
+		return
+	}
+
+	s.w.logger.Errorw("failed to upload staged upload", "id", su.ID, "bucket", su.Bucket, "path", su.Path, "err", err)
+	s.mu.Lock()
+	su.Attempts++
+	su.LastAttempt = time.Now().UTC()
+	su.LastError = err.Error()
+	updated := *su
+	s.mu.Unlock()
+	if err := s.persist(&updated); err != nil {
+		s.w.logger.Errorw("failed to persist staged upload", "id", su.ID, "err", err)
+	}
+
+	if updated.Attempts >= stagedUploadAlertAttempts {
+		if err := s.w.alerts.RegisterAlert(ctx, newStagedUploadFailedAlert(alertID, updated.StagedUpload)); err != nil {
+			s.w.logger.Errorf("failed to register staged upload alert: %v", err)
+		}
+	}
+}
+
+func alertIDForStagedUpload(id string) types.Hash256 {
+	return types.HashBytes(append(alertStagedUploadID[:], []byte(id)...))
+}
+
+func newStagedUploadFailedAlert(id types.Hash256, su api.StagedUpload) alerts.Alert {
+	return alerts.Alert{
+		ID:       id,
+		Severity: alerts.SeverityError,
+		Message:  "failed to upload staged upload",
+		Data: map[string]interface{}{
+			"stagedUploadID": su.ID,
+			"bucket":         su.Bucket,
+			"path":           su.Path,
+			"size":           su.Size,
+			"attempts":       su.Attempts,
+			"error":          su.LastError,
+		},
+		Timestamp: time.Now(),
+	}
+}
+
+// writeFileSync atomically writes a file by writing it to a temporary file
+// that is fsynced and renamed once the given function returns.
+func writeFileSync(path string, write func(*os.File) (int64, error)) (int64, error) {
+	tmp := path + stagedUploadTmpExt
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	n, err := write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return n, nil
+}
+
+// syncDir fsyncs a directory, which ensures the files that were renamed into
+// it are persisted.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
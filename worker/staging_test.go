@@ -0,0 +1,188 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+func newTestUploadStager(t *testing.T, dir string) *uploadStager {
+	t.Helper()
+	s, err := newUploadStager(&worker{logger: zap.NewNop().Sugar()}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func stagedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, entry := range entries {
+		files = append(files, entry.Name())
+	}
+	return files
+}
+
+func TestUploadStagerRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestUploadStager(t, dir)
+
+	// stage two uploads
+	data := frand.Bytes(100)
+	su1, err := s.Stage(bytes.NewReader(data), stagedUpload{StagedUpload: api.StagedUpload{Bucket: "default", Path: "foo"}, MimeType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	} else if su1.Size != 100 {
+		t.Fatal("unexpected size", su1.Size)
+	}
+	su2, err := s.Stage(bytes.NewReader(nil), stagedUpload{StagedUpload: api.StagedUpload{Bucket: "default", Path: "bar"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert an upload that fails while staging leaves no files behind
+	if _, err := s.Stage(io.MultiReader(bytes.NewReader(data), iotest.ErrReader(errors.New("read failed"))), stagedUpload{StagedUpload: api.StagedUpload{Bucket: "default", Path: "baz"}}); err == nil {
+		t.Fatal("expected error")
+	} else if files := stagedFiles(t, dir); len(files) != 4 {
+		t.Fatal("unexpected files", files)
+	}
+
+	// simulate a crash while staging by adding a temporary file and data
+	// without metadata
+	for _, name := range []string{"crashed" + stagedUploadDataExt + stagedUploadTmpExt, "crashed" + stagedUploadDataExt} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// simulate a crash after an upload was superseded by persisting an
+	// older upload to the same path
+	old := stagedUpload{StagedUpload: api.StagedUpload{ID: "old", Bucket: "default", Path: "foo", StagedAt: su1.StagedAt.Add(-time.Second)}}
+	if err := s.persist(&old); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(filepath.Join(dir, old.ID+stagedUploadDataExt), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// restore the stager and assert only the acknowledged uploads remain
+	s = newTestUploadStager(t, dir)
+	if uploads := s.Uploads(); len(uploads) != 2 || uploads[0].ID != su1.ID || uploads[1].ID != su2.ID {
+		t.Fatal("unexpected uploads", uploads)
+	} else if files := stagedFiles(t, dir); len(files) != 4 {
+		t.Fatal("unexpected files", files)
+	} else if s.uploads[su1.ID].MimeType != "text/plain" {
+		t.Fatal("metadata wasn't restored")
+	} else if b, err := os.ReadFile(filepath.Join(dir, su1.ID+stagedUploadDataExt)); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(b, data) {
+		t.Fatal("unexpected data")
+	}
+
+	// assert stopping the stager returns
+	w := &worker{logger: zap.NewNop().Sugar()}
+	if err := w.initUploadStager(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		w.uploadStager.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("stager didn't stop")
+	}
+}
+
+func TestUploadStagerSupersede(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestUploadStager(t, dir)
+
+	stage := func(path string) api.StagedUpload {
+		t.Helper()
+		su, err := s.Stage(bytes.NewReader(frand.Bytes(10)), stagedUpload{StagedUpload: api.StagedUpload{Bucket: "default", Path: path}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return su
+	}
+
+	// assert staging an upload to the same path supersedes the older one
+	stage("foo")
+	su2 := stage("foo")
+	su3 := stage("bar")
+	if uploads := s.Uploads(); len(uploads) != 2 || uploads[0].ID != su2.ID || uploads[1].ID != su3.ID {
+		t.Fatal("unexpected uploads", uploads)
+	} else if files := stagedFiles(t, dir); len(files) != 4 {
+		t.Fatal("unexpected files", files)
+	}
+
+	// assert an upload that is in progress is interrupted and only removed
+	// once it returns
+	var cancelled bool
+	s.mu.Lock()
+	s.inflight, s.inflightCancel = s.uploads[su2.ID], func() { cancelled = true }
+	s.mu.Unlock()
+	s.Supersede("default", "foo")
+	if !cancelled {
+		t.Fatal("upload wasn't interrupted")
+	} else if uploads := s.Uploads(); len(uploads) != 1 || uploads[0].ID != su3.ID {
+		t.Fatal("unexpected uploads", uploads)
+	} else if files := stagedFiles(t, dir); len(files) != 4 {
+		t.Fatal("unexpected files", files)
+	}
+
+	// assert the failed upload is removed rather than retried
+	s.finish(context.Background(), &stagedUpload{StagedUpload: su2}, context.Canceled)
+	if files := stagedFiles(t, dir); len(files) != 2 {
+		t.Fatal("unexpected files", files)
+	} else if s.inflight != nil {
+		t.Fatal("upload still in progress")
+	}
+}
+
+func TestUploadStagerMaintenance(t *testing.T) {
+	s := newTestUploadStager(t, t.TempDir())
+	staged, err := s.Stage(bytes.NewReader(frand.Bytes(10)), stagedUpload{StagedUpload: api.StagedUpload{Bucket: "default", Path: "foo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	su := s.uploads[staged.ID]
+	s.mu.Unlock()
+
+	// assert an upload that is rejected by the maintenance mode is paused
+	// but the rejection doesn't count as a failed attempt
+	s.finish(context.Background(), su, fmt.Errorf("%w: foo", api.ErrMaintenanceMode))
+	next, dueAt := s.next()
+	if next != su {
+		t.Fatal("unexpected upload")
+	} else if uploads := s.Uploads(); len(uploads) != 1 || uploads[0].Attempts != 0 || uploads[0].LastError != "" {
+		t.Fatal("unexpected uploads", uploads)
+	} else if until := time.Until(dueAt); until <= stagedUploadRetryMinInterval-time.Second || until > stagedUploadRetryMinInterval {
+		t.Fatal("unexpected due time", until)
+	}
+
+	// assert other errors do count as failed attempts
+	s.finish(context.Background(), su, errors.New("failed"))
+	if uploads := s.Uploads(); len(uploads) != 1 || uploads[0].Attempts != 1 || uploads[0].LastError != "failed" {
+		t.Fatal("unexpected uploads", uploads)
+	}
+}
@@ -9,9 +9,11 @@ import (
 	"io"
 	"math"
 	"mime"
+	"os"
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gabriel-vasile/mimetype"
@@ -22,6 +24,7 @@ import (
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/build"
+	"go.sia.tech/renterd/hostdb"
 	"go.sia.tech/renterd/object"
 	"go.sia.tech/renterd/tracing"
 	"go.uber.org/zap"
@@ -33,6 +36,10 @@ const (
 	statsDecayThreshold       = 5 * time.Minute
 	statsRecomputeMinInterval = 3 * time.Second
 
+	// uploadStatsRecordInterval is the interval at which a snapshot of the
+	// upload stats is stored in the bus.
+	uploadStatsRecordInterval = 5 * time.Minute
+
 	defaultPackedSlabsLockDuration  = 10 * time.Minute
 	defaultPackedSlabsUploadTimeout = 10 * time.Minute
 	defaultPackedSlabsLimit         = 1
@@ -41,17 +48,30 @@ const (
 var (
 	errNoCandidateUploader = errors.New("no candidate uploader found")
 	errNotEnoughContracts  = errors.New("not enough contracts to support requested redundancy")
+	errUploadIdleTimeout   = errors.New("upload idle timeout exceeded, no data was received")
+	errUploadUnverified    = errors.New("couldn't verify upload")
 )
 
 type uploadParameters struct {
 	ec               object.EncryptionKey
 	encryptionOffset uint64
 	mimeType         string
+	metadata         api.ObjectUserMetadata
 
 	rs          api.RedundancySettings
 	bh          uint64
 	contractSet string
 	packing     bool
+
+	verify func(size int64, eTag string) error
+
+	checkpoint       bool
+	checkpointBucket string
+	checkpointPath   string
+
+	// uploadID is the id of the upload the uploaded sectors are tracked
+	// under, if it's not set the upload manager tracks the upload itself
+	uploadID api.UploadID
 }
 
 func defaultParameters() uploadParameters {
@@ -70,6 +90,17 @@ func WithBlockHeight(bh uint64) UploadOption {
 	}
 }
 
+// WithCheckpoint enables checkpointing the upload to the bus, if a previous
+// upload to the same path failed midway, the slabs it uploaded are reused
+// for as long as the data matches.
+func WithCheckpoint(bucket, path string) UploadOption {
+	return func(up *uploadParameters) {
+		up.checkpoint = true
+		up.checkpointBucket = bucket
+		up.checkpointPath = path
+	}
+}
+
 func WithContractSet(contractSet string) UploadOption {
 	return func(up *uploadParameters) {
 		up.contractSet = contractSet
@@ -94,6 +125,12 @@ func WithMimeType(mimeType string) UploadOption {
 	}
 }
 
+func WithCustomMetadata(metadata api.ObjectUserMetadata) UploadOption {
+	return func(up *uploadParameters) {
+		up.metadata = metadata
+	}
+}
+
 func WithPacking(packing bool) UploadOption {
 	return func(up *uploadParameters) {
 		up.packing = packing
@@ -106,6 +143,17 @@ func WithRedundancySettings(rs api.RedundancySettings) UploadOption {
 	}
 }
 
+// WithVerification registers a function that is called with the size and
+// ETag of the uploaded data once it was read in full, if it returns an error
+// the upload fails. The data is verified before the trailing slabs are
+// uploaded, that way we don't pay to upload the remainder of data that turns
+// out to be invalid.
+func WithVerification(fn func(size int64, eTag string) error) UploadOption {
+	return func(up *uploadParameters) {
+		up.verify = fn
+	}
+}
+
 type (
 	slabID [8]byte
 
@@ -115,13 +163,39 @@ type (
 		rl     revisionLocker
 		logger *zap.SugaredLogger
 
+		// peers are the workers the upload manager stripes the slabs of an
+		// upload across, next to uploading slabs itself
+		peers []UploadPeer
+
 		maxOverdrive     uint64
 		overdriveTimeout time.Duration
 
+		// maxConcurrentSectorsPerHost is the number of sectors an uploader
+		// uploads to its host in parallel
+		maxConcurrentSectorsPerHost uint64
+
+		// maxSlabsAhead is the number of older slabs that may still be
+		// uploading when an uploader is selected for a slab, if it's 0 the
+		// window adapts to the number of healthy uploaders
+		maxSlabsAhead uint64
+
+		// autoTune is set if the max overdrive and the number of sectors
+		// uploaded to a host in parallel are tuned, the overdrive tuner is
+		// shared by all uploads while every uploader has its own tuner
+		autoTune       bool
+		overdriveTuner *uploadTuner
+
 		statsOverdrivePct              *dataPoints
 		statsSlabUploadSpeedBytesPerMS *dataPoints
 		stopChan                       chan struct{}
 
+		// pipeline gauges, they help diagnosing stalls in the upload pipeline
+		pendingSectorResponses atomic.Int64
+		pendingSlabResponses   atomic.Int64
+		waitingForParents      atomic.Int64
+		statsNextSlabWaitInMS  *dataPoints
+		statsParentsWaitInMS   *dataPoints
+
 		mu            sync.Mutex
 		uploaders     []*uploader
 		lastRecompute time.Time
@@ -135,6 +209,7 @@ type (
 
 		statsSectorUploadEstimateInMS    *dataPoints
 		statsSectorUploadSpeedBytesPerMS *dataPoints // keep track of this separately for stats (no decay is applied)
+		metrics                          transferMetrics
 		signalNewUpload                  chan struct{}
 		stopChan                         chan struct{}
 
@@ -145,7 +220,17 @@ type (
 		endHeight           uint64
 		bh                  uint64
 		consecutiveFailures uint64
+		inflight            uint64
 		queue               []*sectorUploadReq
+
+		// renterFunds are the renter funds of the most recent revision
+		// the uploader used, they are unknown until it uploaded a sector
+		renterFunds      types.Currency
+		renterFundsKnown bool
+
+		// tuner adjusts the number of sectors uploaded to the host in
+		// parallel, it's nil if auto-tuning is disabled
+		tuner *uploadTuner
 	}
 
 	upload struct {
@@ -155,10 +240,21 @@ type (
 		allowed          map[types.FileContractID]struct{}
 		doneShardTrigger chan struct{}
 		lockPriority     int
+		totalShards      int
+
+		hostTags  map[types.PublicKey][]string
+		tagLimits map[string]int
 
-		mu      sync.Mutex
-		ongoing []slabID
-		used    map[slabID]map[types.FileContractID]struct{}
+		// storageLimits holds the redundancy settings that limit the amount
+		// of data stored on a single host
+		storageLimits *api.RedundancySettings
+
+		mu          sync.Mutex
+		ongoing     []slabID
+		used        map[slabID]map[types.FileContractID]struct{}
+		usedTags    map[slabID]map[string]int
+		hostStorage map[types.PublicKey]uint64
+		totalStored uint64
 	}
 
 	slabUpload struct {
@@ -182,6 +278,7 @@ type (
 
 	slabUploadResponse struct {
 		slab  object.SlabSlice
+		used  map[types.PublicKey]types.FileContractID
 		index int
 		err   error
 	}
@@ -218,6 +315,14 @@ type (
 		healthyUploaders       uint64
 		numUploaders           uint64
 		uploadSpeedsMBPS       map[types.PublicKey]float64
+		uploadLatenciesP90MS   map[types.PublicKey]float64
+		queueLengths           map[types.PublicKey]uint64
+		pipeline               api.UploadPipelineStats
+
+		autoTuned         bool
+		maxOverdrive      uint64
+		maxSectorsPerHost uint64
+		sectorsPerHost    map[types.PublicKey]uint64
 	}
 
 	dataPoints struct {
@@ -233,12 +338,49 @@ type (
 	}
 )
 
-func (w *worker) initUploadManager(maxOverdrive uint64, overdriveTimeout time.Duration, logger *zap.SugaredLogger) {
+func (w *worker) initUploadManager(maxOverdrive, maxConcurrentSectorsPerHost, maxSlabsAhead uint64, overdriveTimeout time.Duration, autoTune bool, peers []UploadPeer, logger *zap.SugaredLogger) {
 	if w.uploadManager != nil {
 		panic("upload manager already initialized") // developer error
 	}
 
-	w.uploadManager = newUploadManager(w.bus, w, w, maxOverdrive, overdriveTimeout, logger)
+	w.uploadManager = newUploadManager(w.bus, w, w, maxOverdrive, maxConcurrentSectorsPerHost, maxSlabsAhead, overdriveTimeout, autoTune, peers, logger)
+	go w.uploadManager.threadedRecordStats(w.id, uploadStatsRecordInterval)
+}
+
+// threadedRecordStats periodically stores a snapshot of the upload stats in
+// the bus, so the upload performance can be compared over time.
+func (mgr *uploadManager) threadedRecordStats(workerID string, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-mgr.stopChan:
+			return
+		case <-t.C:
+		}
+
+		// skip snapshots of idle workers
+		stats := mgr.Stats()
+		if stats.numUploaders == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := mgr.b.RecordUploadStatsMetric(ctx, api.UploadStatsMetric{
+			Timestamp:              api.TimeRFC3339(time.Now()),
+			Worker:                 workerID,
+			Version:                build.Version(),
+			AvgSlabUploadSpeedMBPS: stats.avgSlabUploadSpeedMBPS,
+			AvgOverdrivePct:        stats.avgOverdrivePct,
+			HealthyUploaders:       stats.healthyUploaders,
+			NumUploaders:           stats.numUploaders,
+		})
+		cancel()
+		if err != nil {
+			mgr.logger.Errorf("failed to record upload stats, err: %v", err)
+		}
+	}
 }
 
 func (w *worker) upload(ctx context.Context, r io.Reader, bucket, path string, opts ...UploadOption) (string, error) {
@@ -263,8 +405,20 @@ func (w *worker) upload(ctx context.Context, r io.Reader, bucket, path string, o
 		}
 	}
 
+	// track the upload until the object was added to the bus, otherwise its
+	// sectors could be pruned in the meantime
+	var finishFn func()
+	up.uploadID, finishFn = w.uploadManager.trackUpload(ctx)
+	defer finishFn()
+
 	// perform the upload
 	obj, partialSlabData, used, eTag, err := w.uploadManager.Upload(ctx, r, up, lockingPriorityUpload)
+	if errors.Is(err, errUploadUnverified) && up.checkpoint {
+		// the uploaded data doesn't match, no point in resuming from it
+		if err := w.bus.DeletePartialObject(ctx, bucket, path); err != nil {
+			w.logger.Errorf("couldn't delete checkpoint for '%v', err: %v", path, err)
+		}
+	}
 	if err != nil {
 		return "", fmt.Errorf("couldn't upload object: %w", err)
 	}
@@ -279,7 +433,7 @@ func (w *worker) upload(ctx context.Context, r io.Reader, bucket, path string, o
 	}
 
 	// persist the object
-	err = w.bus.AddObject(ctx, bucket, path, up.contractSet, obj, used, api.AddObjectOptions{MimeType: mimeType, ETag: eTag})
+	err = w.bus.AddObject(ctx, bucket, path, up.contractSet, obj, used, api.AddObjectOptions{MimeType: mimeType, ETag: eTag, Metadata: up.metadata})
 	if err != nil {
 		return "", fmt.Errorf("couldn't add object: %w", err)
 	}
@@ -300,6 +454,12 @@ func (w *worker) uploadMultiPart(ctx context.Context, r io.Reader, bucket, path,
 		opt(&up)
 	}
 
+	// track the upload until the part was added to the bus, otherwise its
+	// sectors could be pruned in the meantime
+	var finishFn func()
+	up.uploadID, finishFn = w.uploadManager.trackUpload(ctx)
+	defer finishFn()
+
 	// upload the part
 	obj, partialSlabData, used, eTag, err := w.uploadManager.Upload(ctx, r, up, lockingPriorityUpload)
 	if err != nil {
@@ -403,17 +563,17 @@ func (w *worker) uploadPackedSlab(ctx context.Context, ps api.PackedSlab, rs api
 	}
 
 	// fetch upload params
-	up, err := w.bus.UploadParams(ctx)
+	up, err := w.uploadParams(ctx)
 	if err != nil {
 		return fmt.Errorf("couldn't fetch upload params from bus: %v", err)
 	}
 
 	// attach gouging checker to the context
-	ctx = WithGougingChecker(ctx, w.bus, up.GougingParams)
+	ctx = WithGougingChecker(ctx, w.consensus, up.GougingParams)
 
 	// upload packed slab
 	shards := encryptPartialSlab(ps.Data, ps.Key, uint8(rs.MinShards), uint8(rs.TotalShards))
-	sectors, used, err := w.uploadManager.UploadShards(ctx, shards, contracts, up.CurrentHeight, lockPriority)
+	sectors, used, err := w.uploadManager.UploadShards(ctx, shards, rs, contracts, up.CurrentHeight, lockPriority)
 	if err != nil {
 		return fmt.Errorf("couldn't upload packed slab, err: %v", err)
 	}
@@ -437,18 +597,32 @@ func newDataPoints(halfLife time.Duration) *dataPoints {
 	}
 }
 
-func newUploadManager(b Bus, hp hostProvider, rl revisionLocker, maxOverdrive uint64, overdriveTimeout time.Duration, logger *zap.SugaredLogger) *uploadManager {
+func newUploadManager(b Bus, hp hostProvider, rl revisionLocker, maxOverdrive, maxConcurrentSectorsPerHost, maxSlabsAhead uint64, overdriveTimeout time.Duration, autoTune bool, peers []UploadPeer, logger *zap.SugaredLogger) *uploadManager {
+	if maxConcurrentSectorsPerHost == 0 {
+		maxConcurrentSectorsPerHost = 1
+	}
+	var overdriveTuner *uploadTuner
+	if autoTune {
+		overdriveTuner = newUploadTuner(0, maxOverdrive, uploadTunerOverdriveWindow)
+	}
 	return &uploadManager{
 		b:      b,
 		hp:     hp,
 		rl:     rl,
 		logger: logger,
+		peers:  peers,
 
-		maxOverdrive:     maxOverdrive,
-		overdriveTimeout: overdriveTimeout,
+		maxOverdrive:                maxOverdrive,
+		maxConcurrentSectorsPerHost: maxConcurrentSectorsPerHost,
+		maxSlabsAhead:               maxSlabsAhead,
+		overdriveTimeout:            overdriveTimeout,
+		autoTune:                    autoTune,
+		overdriveTuner:              overdriveTuner,
 
 		statsOverdrivePct:              newDataPoints(0),
 		statsSlabUploadSpeedBytesPerMS: newDataPoints(0),
+		statsNextSlabWaitInMS:          newDataPoints(0),
+		statsParentsWaitInMS:           newDataPoints(0),
 
 		stopChan: make(chan struct{}),
 
@@ -457,6 +631,10 @@ func newUploadManager(b Bus, hp hostProvider, rl revisionLocker, maxOverdrive ui
 }
 
 func (mgr *uploadManager) newUploader(c api.ContractMetadata) *uploader {
+	var tuner *uploadTuner
+	if mgr.autoTune {
+		tuner = newUploadTuner(1, mgr.maxConcurrentSectorsPerHost, uploadTunerHostWindow)
+	}
 	return &uploader{
 		mgr:  mgr,
 		host: mgr.hp.newHostV3(c.ID, c.HostKey, c.SiamuxAddr),
@@ -472,6 +650,23 @@ func (mgr *uploadManager) newUploader(c api.ContractMetadata) *uploader {
 		statsSectorUploadEstimateInMS:    newDataPoints(statsDecayHalfTime),
 		statsSectorUploadSpeedBytesPerMS: newDataPoints(0), // no decay for exposed stats
 		stopChan:                         make(chan struct{}),
+
+		tuner: tuner,
+	}
+}
+
+// drainMetrics adds the upload speeds and latencies that were observed since
+// the last call to the given performance snapshot.
+func (mgr *uploadManager) drainMetrics(perfs map[types.PublicKey]hostdb.HostPerformance) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	for _, u := range mgr.uploaders {
+		if mbps, p90 := u.metrics.drain(); mbps > 0 {
+			perf := perfs[u.hk]
+			perf.UploadSpeedMBPS = mbps
+			perf.UploadLatencyP90MS = p90
+			perfs[u.hk] = perf
+		}
 	}
 }
 
@@ -481,14 +676,23 @@ func (mgr *uploadManager) Stats() uploadManagerStats {
 
 	// collect stats
 	mgr.mu.Lock()
-	var numHealthy uint64
+	var numHealthy, queued, inflight uint64
 	speeds := make(map[types.PublicKey]float64)
+	latencies := make(map[types.PublicKey]float64)
+	queues := make(map[types.PublicKey]uint64)
+	sectorsPerHost := make(map[types.PublicKey]uint64)
 	for _, u := range mgr.uploaders {
+		sectorsPerHost[u.hk] = u.sectorsPerHost()
 		healthy, mbps := u.Stats()
 		speeds[u.hk] = mbps
+		latencies[u.hk] = u.statsSectorUploadEstimateInMS.P90()
 		if healthy {
 			numHealthy++
 		}
+		queueLength, numInflight := u.queueStats()
+		queues[u.hk] = queueLength
+		queued += queueLength
+		inflight += numInflight
 	}
 	mgr.mu.Unlock()
 
@@ -499,7 +703,32 @@ func (mgr *uploadManager) Stats() uploadManagerStats {
 		healthyUploaders:       numHealthy,
 		numUploaders:           uint64(len(speeds)),
 		uploadSpeedsMBPS:       speeds,
+		uploadLatenciesP90MS:   latencies,
+		queueLengths:           queues,
+		pipeline: api.UploadPipelineStats{
+			QueuedSectors:          queued,
+			InflightSectors:        inflight,
+			PendingSectorResponses: uint64(mgr.pendingSectorResponses.Load()),
+			PendingSlabResponses:   uint64(mgr.pendingSlabResponses.Load()),
+			WaitingForParents:      uint64(mgr.waitingForParents.Load()),
+			AvgNextSlabWaitMS:      mgr.statsNextSlabWaitInMS.Average(),
+			AvgParentsWaitMS:       mgr.statsParentsWaitInMS.Average(),
+		},
+
+		autoTuned:         mgr.autoTune,
+		maxOverdrive:      mgr.currentMaxOverdrive(),
+		maxSectorsPerHost: mgr.maxConcurrentSectorsPerHost,
+		sectorsPerHost:    sectorsPerHost,
+	}
+}
+
+// currentMaxOverdrive returns the max overdrive, it changes over time if
+// auto-tuning is on.
+func (mgr *uploadManager) currentMaxOverdrive() uint64 {
+	if mgr.overdriveTuner != nil {
+		return mgr.overdriveTuner.Limit()
 	}
+	return mgr.maxOverdrive
 }
 
 func (mgr *uploadManager) Stop() {
@@ -523,14 +752,44 @@ func (mgr *uploadManager) Upload(ctx context.Context, r io.Reader, up uploadPara
 		span.End()
 	}()
 
+	// check whether we can resume a previous upload
+	var resume api.PartialObject
+	if up.checkpoint {
+		resume = mgr.fetchCheckpoint(ctx, up)
+		if len(resume.Slabs) > 0 {
+			up.ec = resume.Key
+		}
+	}
+
 	// create the object
 	o := object.NewObject(up.ec)
 
+	// empty objects don't have any slabs, so we return early without
+	// requiring any contracts
+	empty, r, err := peekEmpty(r)
+	if err != nil {
+		return object.Object{}, nil, nil, "", err
+	} else if empty {
+		eTag := newHashReader(r).Hash()
+		if up.verify != nil {
+			if err := up.verify(0, eTag); err != nil {
+				return object.Object{}, nil, nil, "", fmt.Errorf("%w: %w", errUploadUnverified, err)
+			}
+		}
+		return o, nil, make(map[types.PublicKey]types.FileContractID), eTag, nil
+	}
+
 	// create the hash reader
 	hr := newHashReader(r)
 
+	// verify the data once it was read in full
+	var dr io.Reader = hr
+	if up.verify != nil {
+		dr = &verifyReader{r: hr, verify: func(n int64) error { return up.verify(n, hr.Hash()) }}
+	}
+
 	// create the cipher reader
-	cr, err := o.Encrypt(hr, up.encryptionOffset)
+	cr, err := o.Encrypt(dr, up.encryptionOffset)
 	if err != nil {
 		return object.Object{}, nil, nil, "", err
 	}
@@ -542,11 +801,30 @@ func (mgr *uploadManager) Upload(ctx context.Context, r io.Reader, up uploadPara
 	}
 
 	// create the upload
-	u, finishFn, err := mgr.newUpload(ctx, up.rs.TotalShards, contracts, up.bh, lockPriority)
+	var u *upload
+	if up.uploadID == (api.UploadID{}) {
+		var finishFn func()
+		u, finishFn, err = mgr.newUpload(ctx, up.rs.TotalShards, contracts, up.bh, lockPriority)
+		defer finishFn()
+	} else {
+		u, err = mgr.newUploadWithID(up.uploadID, up.rs.TotalShards, contracts, up.bh, lockPriority)
+	}
 	if err != nil {
 		return object.Object{}, nil, nil, "", err
 	}
-	defer finishFn()
+
+	// limit the number of shards per tag value
+	if len(up.rs.MaxShardsPerTagValue) > 0 {
+		hostTags, err := mgr.hostTags(ctx, contracts)
+		if err != nil {
+			return object.Object{}, nil, nil, "", fmt.Errorf("couldn't fetch host tags from bus: %w", err)
+		}
+		u.hostTags = hostTags
+		u.tagLimits = up.rs.MaxShardsPerTagValue
+	}
+
+	// limit the amount of data stored per host
+	u.limitHostStorage(up.rs, contracts)
 
 	// create the next slab channel
 	nextSlabChan := make(chan struct{}, 1)
@@ -560,8 +838,24 @@ func (mgr *uploadManager) Upload(ctx context.Context, r io.Reader, up uploadPara
 	var slabIndex int
 	numSlabs := -1
 
+	// keep track of the contracts that were used by a previous attempt or
+	// by our peers, they might not be part of our contract set anymore
+	known := make(map[types.PublicKey]types.FileContractID)
+	for hk, fcid := range resume.UsedContracts {
+		known[hk] = fcid
+	}
+
+	// keep track of the slabs that can be checkpointed
+	var diverged bool
+	var checkpointed int
+	completed := make(map[int]object.SlabSlice)
+	hashes := make(map[int]types.Hash256)
+
 	// prepare slab size
 	size := int64(up.rs.MinShards) * rhpv2.SectorSize
+
+	// keep track of how long we wait to be triggered to read the next slab
+	waitStart := time.Now()
 loop:
 	for {
 		select {
@@ -570,6 +864,7 @@ loop:
 		case <-ctx.Done():
 			return object.Object{}, nil, nil, "", errors.New("upload timed out")
 		case nextSlabChan <- struct{}{}:
+			mgr.statsNextSlabWaitInMS.Track(float64(time.Since(waitStart).Milliseconds()))
 			// read next slab's data
 			data := make([]byte, size)
 			length, err := io.ReadFull(io.LimitReader(cr, size), data)
@@ -588,28 +883,59 @@ loop:
 			} else if err != nil && err != io.ErrUnexpectedEOF {
 				return object.Object{}, nil, nil, "", err
 			}
+			if up.checkpoint {
+				hashes[slabIndex] = types.HashBytes(data[:length])
+			}
 			if up.packing && errors.Is(err, io.ErrUnexpectedEOF) {
 				// If uploadPacking is true, we return the partial slab without
 				// uploading.
 				partialSlab = data[:length]
 				<-nextSlabChan // trigger next iteration
+			} else if !diverged && slabIndex < len(resume.Slabs) && resume.SlabHashes[slabIndex] == hashes[slabIndex] {
+				// If the slab was uploaded by a previous attempt, we reuse it.
+				responses = append(responses, slabUploadResponse{slab: resume.Slabs[slabIndex], index: slabIndex})
+				completed[slabIndex] = resume.Slabs[slabIndex]
+				checkpointed++
+				<-nextSlabChan // trigger next iteration
 			} else {
-				// Otherwise we upload it.
-				go func(rs api.RedundancySettings, data []byte, length, slabIndex int) {
-					u.uploadSlab(ctx, rs, data, length, slabIndex, respChan, nextSlabChan)
-				}(up.rs, data, length, slabIndex)
+				// Once the data diverges from the previous attempt, we
+				// upload all remaining slabs.
+				diverged = true
+				// Otherwise we upload it, striping the slabs across our
+				// peers if we have any.
+				if peer := slabIndex % (len(mgr.peers) + 1); peer > 0 {
+					go func(peer UploadPeer, data []byte, length, slabIndex int) {
+						mgr.uploadSlabWithPeer(ctx, peer, u, up, data, length, slabIndex, respChan, nextSlabChan)
+					}(mgr.peers[peer-1], data, length, slabIndex)
+				} else {
+					go func(rs api.RedundancySettings, data []byte, length, slabIndex int) {
+						u.uploadSlab(ctx, rs, data, length, slabIndex, respChan, nextSlabChan)
+					}(up.rs, data, length, slabIndex)
+				}
 			}
 			slabIndex++
+			waitStart = time.Now()
 		case res := <-respChan:
 			if res.err != nil {
 				return object.Object{}, nil, nil, "", res.err
 			}
 
+			// keep track of the contracts used by our peers
+			for hk, fcid := range res.used {
+				known[hk] = fcid
+			}
+
 			// collect the response and potentially break out of the loop
 			responses = append(responses, res)
 			if len(responses) == numSlabs {
 				break loop
 			}
+
+			// checkpoint the upload
+			if up.checkpoint {
+				completed[res.index] = res.slab
+				checkpointed = mgr.tryCheckpoint(ctx, up, known, contracts, completed, hashes, checkpointed)
+			}
 		}
 	}
 
@@ -623,6 +949,193 @@ loop:
 		o.Slabs = append(o.Slabs, resp.slab)
 	}
 
+	// build used contracts list
+	usedContracts, err := mgr.usedContracts(o.Slabs, contracts, known)
+	if err != nil {
+		return object.Object{}, nil, nil, "", err
+	}
+	return o, partialSlab, usedContracts, hr.Hash(), nil
+}
+
+// UploadSlab uploads a single slab's worth of data read from r. The data is
+// expected to be encrypted already, it's used by peers to upload the slabs of
+// an upload that is coordinated by another worker. If an upload id is given,
+// the sectors are added to the coordinator's upload, which keeps them from
+// being pruned until the coordinator added the object to the bus.
+func (mgr *uploadManager) UploadSlab(ctx context.Context, r io.Reader, rs api.RedundancySettings, contractSet string, uploadID api.UploadID, bh uint64, lockPriority int) (object.SlabSlice, map[types.PublicKey]types.FileContractID, error) {
+	// read the slab's data
+	size := int64(rs.MinShards) * rhpv2.SectorSize
+	data := make([]byte, size)
+	length, err := io.ReadFull(r, data)
+	if err == io.EOF {
+		return object.SlabSlice{}, nil, errors.New("no data to upload")
+	} else if err != nil && err != io.ErrUnexpectedEOF {
+		return object.SlabSlice{}, nil, err
+	} else if n, _ := io.CopyN(io.Discard, r, 1); n > 0 {
+		return object.SlabSlice{}, nil, fmt.Errorf("data exceeds slab size of %v bytes", size)
+	}
+
+	// fetch contracts
+	contracts, err := mgr.b.ContractSetContracts(ctx, contractSet)
+	if err != nil {
+		return object.SlabSlice{}, nil, fmt.Errorf("couldn't fetch contracts from bus: %w", err)
+	}
+
+	// create the upload, if it's not part of a coordinated upload we track
+	// it ourselves
+	var u *upload
+	if uploadID == (api.UploadID{}) {
+		var finishFn func()
+		u, finishFn, err = mgr.newUpload(ctx, rs.TotalShards, contracts, bh, lockPriority)
+		defer finishFn()
+	} else {
+		u, err = mgr.newUploadWithID(uploadID, rs.TotalShards, contracts, bh, lockPriority)
+	}
+	if err != nil {
+		return object.SlabSlice{}, nil, err
+	}
+
+	// limit the amount of data stored per host
+	u.limitHostStorage(rs, contracts)
+
+	// upload the slab
+	respChan := make(chan slabUploadResponse, 1)
+	nextSlabChan := make(chan struct{}, 1)
+	u.uploadSlab(ctx, rs, data, length, 0, respChan, nextSlabChan)
+	res := <-respChan
+	if res.err != nil {
+		return object.SlabSlice{}, nil, res.err
+	}
+
+	// build used contracts list
+	used, err := mgr.usedContracts([]object.SlabSlice{res.slab}, contracts, nil)
+	if err != nil {
+		return object.SlabSlice{}, nil, err
+	}
+	return res.slab, used, nil
+}
+
+// uploadSlabWithPeer uploads the given slab using a peer. The next slab is
+// triggered as soon as the peer received the slab's data. If the peer fails to
+// upload the slab, it's uploaded by the given upload instead.
+func (mgr *uploadManager) uploadSlabWithPeer(ctx context.Context, peer UploadPeer, u *upload, up uploadParameters, data []byte, length, index int, respChan chan slabUploadResponse, nextSlabChan chan struct{}) {
+	// add tracing
+	ctx, span := tracing.Tracer.Start(ctx, "uploadSlabWithPeer")
+	defer span.End()
+
+	// trigger the next slab once the data was read
+	var once sync.Once
+	trigger := func() {
+		once.Do(func() {
+			select {
+			case <-nextSlabChan:
+			default:
+			}
+		})
+	}
+	defer trigger()
+
+	// NOTE: the bucket is only known if the upload is checkpointed, without
+	// it the peer doesn't apply the bucket's gouging overrides
+	res, err := peer.UploadSlab(ctx, &notifyReader{r: bytes.NewReader(data[:length]), onEOF: trigger}, api.UploadSlabOptions{
+		Bucket:      up.checkpointBucket,
+		ContractSet: up.contractSet,
+		MinShards:   up.rs.MinShards,
+		TotalShards: up.rs.TotalShards,
+		UploadID:    u.id,
+	})
+	if err != nil && ctx.Err() == nil {
+		// fall back to uploading the slab ourselves, the next slab was
+		// already triggered so we pass a channel that is never read from
+		mgr.logger.Debugf("peer failed to upload slab %v, uploading it ourselves, err: %v", index, err)
+		span.AddEvent("fallback to local upload")
+		trigger()
+		u.uploadSlab(ctx, up.rs, data, length, index, respChan, make(chan struct{}, 1))
+		return
+	}
+
+	resp := slabUploadResponse{slab: res.Slab, used: res.UsedContracts, index: index, err: err}
+	if err != nil {
+		resp.err = fmt.Errorf("peer failed to upload slab %v: %w", index, err)
+	}
+
+	// send the response
+	select {
+	case <-ctx.Done():
+	case respChan <- resp:
+	}
+}
+
+// fetchCheckpoint fetches the checkpoint of a previous upload to the same
+// path, it returns an empty partial object if there is none or if it can't be
+// used to resume the upload.
+func (mgr *uploadManager) fetchCheckpoint(ctx context.Context, up uploadParameters) api.PartialObject {
+	po, err := mgr.b.PartialObject(ctx, up.checkpointBucket, up.checkpointPath)
+	if err != nil {
+		if !errors.Is(api.ParseError(err), api.ErrPartialObjectNotFound) {
+			mgr.logger.Errorf("couldn't fetch checkpoint for '%v', err: %v", up.checkpointPath, err)
+		}
+		return api.PartialObject{}
+	}
+
+	// only resume if the upload parameters match
+	if up.encryptionOffset != 0 ||
+		po.ContractSet != up.contractSet ||
+		int(po.MinShards) != up.rs.MinShards ||
+		int(po.TotalShards) != up.rs.TotalShards ||
+		len(po.SlabHashes) != len(po.Slabs) {
+		return api.PartialObject{}
+	}
+	return po
+}
+
+// tryCheckpoint adds the slabs that completed without a gap since the last
+// checkpoint to the bus, it returns the number of slabs that are checkpointed.
+func (mgr *uploadManager) tryCheckpoint(ctx context.Context, up uploadParameters, known map[types.PublicKey]types.FileContractID, contracts []api.ContractMetadata, completed map[int]object.SlabSlice, hashes map[int]types.Hash256, checkpointed int) int {
+	n := checkpointed
+	for {
+		if _, exists := completed[n]; !exists {
+			break
+		}
+		n++
+	}
+	if n == checkpointed {
+		return checkpointed
+	}
+
+	po := api.PartialObject{
+		Key:         up.ec,
+		ContractSet: up.contractSet,
+		MinShards:   uint8(up.rs.MinShards),
+		TotalShards: uint8(up.rs.TotalShards),
+	}
+	for i := checkpointed; i < n; i++ {
+		po.Slabs = append(po.Slabs, completed[i])
+		po.SlabHashes = append(po.SlabHashes, hashes[i])
+	}
+	used, err := mgr.usedContracts(po.Slabs, contracts, known)
+	if err != nil {
+		mgr.logger.Errorf("couldn't checkpoint upload to '%v', err: %v", up.checkpointPath, err)
+		return checkpointed
+	}
+	po.UsedContracts = used
+
+	if err := mgr.b.AddPartialObjectSlabs(ctx, up.checkpointBucket, up.checkpointPath, checkpointed, po); errors.Is(api.ParseError(err), api.ErrPartialObjectConflict) {
+		// the checkpoint was changed by someone else, we start over so the
+		// next checkpoint replaces it
+		mgr.logger.Debugf("checkpoint of '%v' conflicts, err: %v", up.checkpointPath, err)
+		return 0
+	} else if err != nil {
+		mgr.logger.Errorf("couldn't checkpoint upload to '%v', err: %v", up.checkpointPath, err)
+		return checkpointed
+	}
+	return n
+}
+
+// usedContracts returns the contracts used by the sectors of the given slabs,
+// known contains the contracts used by slabs of a previous upload attempt,
+// whose hosts might no longer be part of the given contracts.
+func (mgr *uploadManager) usedContracts(slabs []object.SlabSlice, contracts []api.ContractMetadata, known map[types.PublicKey]types.FileContractID) (map[types.PublicKey]types.FileContractID, error) {
 	// build host to contract map
 	h2c := make(map[types.PublicKey]types.FileContractID)
 	for _, contract := range contracts {
@@ -634,11 +1147,14 @@ loop:
 
 	// build used contracts list
 	usedContracts := make(map[types.PublicKey]types.FileContractID)
-	for _, slab := range o.Slabs {
+	for _, slab := range slabs {
 		for _, sector := range slab.Shards {
 			fcid, exists := h2c[sector.Host]
 			if !exists {
-				return object.Object{}, nil, nil, "", fmt.Errorf("couldn't find contract for host %v", sector.Host)
+				fcid, exists = known[sector.Host]
+			}
+			if !exists {
+				return nil, fmt.Errorf("couldn't find contract for host %v", sector.Host)
 			}
 			if renewed, exists := c2r[fcid]; exists {
 				usedContracts[sector.Host] = renewed
@@ -647,10 +1163,10 @@ loop:
 			}
 		}
 	}
-	return o, partialSlab, usedContracts, hr.Hash(), nil
+	return usedContracts, nil
 }
 
-func (mgr *uploadManager) UploadShards(ctx context.Context, shards [][]byte, contracts []api.ContractMetadata, bh uint64, lockPriority int) ([]object.Sector, map[types.PublicKey]types.FileContractID, error) {
+func (mgr *uploadManager) UploadShards(ctx context.Context, shards [][]byte, rs api.RedundancySettings, contracts []api.ContractMetadata, bh uint64, lockPriority int) ([]object.Sector, map[types.PublicKey]types.FileContractID, error) {
 	// initiate the upload
 	upload, finishFn, err := mgr.newUpload(ctx, len(shards), contracts, bh, lockPriority)
 	if err != nil {
@@ -658,6 +1174,9 @@ func (mgr *uploadManager) UploadShards(ctx context.Context, shards [][]byte, con
 	}
 	defer finishFn()
 
+	// limit the amount of data stored per host
+	upload.limitHostStorage(rs, contracts)
+
 	// upload the shards
 	sectors, err := upload.uploadShards(ctx, shards, nil)
 	if err != nil {
@@ -703,6 +1222,38 @@ func (mgr *uploadManager) launch(req *sectorUploadReq) error {
 }
 
 func (mgr *uploadManager) newUpload(ctx context.Context, totalShards int, contracts []api.ContractMetadata, bh uint64, lockPriority int) (*upload, func(), error) {
+	u, err := mgr.newUploadWithID(api.UploadID{}, totalShards, contracts, bh, lockPriority)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	var finishFn func()
+	u.id, finishFn = mgr.trackUpload(ctx)
+	return u, finishFn, nil
+}
+
+// trackUpload tracks a new upload in the bus, the bus keeps the sectors that
+// are added to the upload from being pruned until the returned function is
+// called.
+func (mgr *uploadManager) trackUpload(ctx context.Context) (api.UploadID, func()) {
+	id := api.NewUploadID()
+	if err := mgr.b.TrackUpload(ctx, id); err != nil {
+		mgr.logger.Errorf("failed to track upload '%v', err: %v", id, err)
+	}
+
+	// create a finish function to finish the upload
+	return id, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := mgr.b.FinishUpload(ctx, id); err != nil {
+			mgr.logger.Errorf("failed to mark upload %v as finished: %v", id, err)
+		}
+	}
+}
+
+// newUploadWithID creates an upload whose sectors are added to the uploading
+// sectors of the upload with the given id, the upload has to be tracked by the
+// caller.
+func (mgr *uploadManager) newUploadWithID(id api.UploadID, totalShards int, contracts []api.ContractMetadata, bh uint64, lockPriority int) (*upload, error) {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 
@@ -711,27 +1262,20 @@ func (mgr *uploadManager) newUpload(ctx context.Context, totalShards int, contra
 
 	// check if we have enough contracts
 	if len(contracts) < totalShards {
-		return nil, func() {}, fmt.Errorf("%v < %v: %w", len(contracts), totalShards, errNotEnoughContracts)
+		return nil, fmt.Errorf("%v < %v: %w", len(contracts), totalShards, errNotEnoughContracts)
 	}
 
-	// create allowed map
+	// create allowed map, denied hosts are only used if we'd otherwise not
+	// have enough contracts
 	allowed := make(map[types.FileContractID]struct{})
 	for _, c := range contracts {
-		allowed[c.ID] = struct{}{}
-	}
-
-	// track the upload in the bus
-	id := api.NewUploadID()
-	if err := mgr.b.TrackUpload(ctx, id); err != nil {
-		mgr.logger.Errorf("failed to track upload '%v', err: %v", id, err)
+		if !mgr.hp.isDenied(c.HostKey) {
+			allowed[c.ID] = struct{}{}
+		}
 	}
-
-	// create a finish function to finish the upload
-	finishFn := func() {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-		defer cancel()
-		if err := mgr.b.FinishUpload(ctx, id); err != nil {
-			mgr.logger.Errorf("failed to mark upload %v as finished: %v", id, err)
+	if len(allowed) < totalShards {
+		for _, c := range contracts {
+			allowed[c.ID] = struct{}{}
 		}
 	}
 
@@ -743,10 +1287,49 @@ func (mgr *uploadManager) newUpload(ctx context.Context, totalShards int, contra
 		allowed:          allowed,
 		doneShardTrigger: make(chan struct{}, 1),
 		lockPriority:     lockPriority,
+		totalShards:      totalShards,
+
+		ongoing:  make([]slabID, 0),
+		used:     make(map[slabID]map[types.FileContractID]struct{}),
+		usedTags: make(map[slabID]map[string]int),
+	}, nil
+}
 
-		ongoing: make([]slabID, 0),
-		used:    make(map[slabID]map[types.FileContractID]struct{}),
-	}, finishFn, nil
+// hostTags returns the tags of the hosts of the given contracts.
+func (mgr *uploadManager) hostTags(ctx context.Context, contracts []api.ContractMetadata) (map[types.PublicKey][]string, error) {
+	hks := make([]types.PublicKey, len(contracts))
+	for i, c := range contracts {
+		hks[i] = c.HostKey
+	}
+	hosts, err := mgr.b.SearchHosts(ctx, api.SearchHostOptions{
+		FilterMode: api.HostFilterModeAll,
+		KeyIn:      hks,
+		Limit:      -1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[types.PublicKey][]string)
+	for _, h := range hosts {
+		tags[h.PublicKey] = h.Tags
+	}
+	return tags, nil
+}
+
+// renterFunds returns the renter funds of the given contract as observed by
+// its uploader, it returns false if they are unknown.
+func (mgr *uploadManager) renterFunds(fcid types.FileContractID) (types.Currency, bool) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	for _, u := range mgr.uploaders {
+		u.mu.Lock()
+		funds, known, match := u.renterFunds, u.renterFundsKnown, u.fcid == fcid
+		u.mu.Unlock()
+		if match {
+			return funds, known
+		}
+	}
+	return types.ZeroCurrency, false
 }
 
 func (mgr *uploadManager) numUploaders() int {
@@ -784,13 +1367,27 @@ func (mgr *uploadManager) candidate(req *sectorUploadReq) *uploader {
 		return nil
 	}
 
+	// keep track of sector uploads that are waiting for their parents
+	var waiting bool
+	start := time.Now()
+	defer func() {
+		if waiting {
+			mgr.waitingForParents.Add(-1)
+			mgr.statsParentsWaitInMS.Track(float64(time.Since(start).Milliseconds()))
+		}
+	}()
+
 loop:
 	for {
-		// if this slab does not have more than 1 parent, we return the best
-		// candidate
-		if len(req.upload.parents(req.sID)) <= 1 {
+		// if this slab is within the window of slabs that may be uploaded
+		// ahead of their parents, we return the best candidate
+		if len(req.upload.parents(req.sID)) <= mgr.slabsAhead(req.upload.totalShards) {
 			return candidates[0]
 		}
+		if !waiting {
+			waiting = true
+			mgr.waitingForParents.Add(1)
+		}
 
 		// otherwise we wait, allowing the parents to complete, after which we
 		// re-sort the candidates
@@ -808,6 +1405,35 @@ loop:
 	return nil
 }
 
+// slabsAhead returns the number of older slabs that may still be uploading
+// when a slab selects its uploaders. Unless configured, the window grows with
+// the number of healthy uploaders since every slab in it can be served by a
+// distinct set of hosts without competing with its parents.
+func (mgr *uploadManager) slabsAhead(totalShards int) int {
+	if mgr.maxSlabsAhead > 0 {
+		return int(mgr.maxSlabsAhead)
+	}
+	return adaptiveSlabsAhead(mgr.numHealthyUploaders(), totalShards)
+}
+
+func adaptiveSlabsAhead(healthy, totalShards int) int {
+	if totalShards <= 0 || healthy/totalShards < 1 {
+		return 1
+	}
+	return healthy / totalShards
+}
+
+func (mgr *uploadManager) numHealthyUploaders() (n int) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	for _, u := range mgr.uploaders {
+		if healthy, _ := u.Stats(); healthy {
+			n++
+		}
+	}
+	return
+}
+
 func (mgr *uploadManager) renewUploader(u *uploader) {
 	// fetch renewed contract
 	fcid, _, _ := u.contractInfo()
@@ -837,6 +1463,8 @@ func (mgr *uploadManager) renewUploader(u *uploader) {
 	u.fcid = renewed.ID
 	u.renewedFrom = renewed.RenewedFrom
 	u.endHeight = renewed.WindowEnd
+	u.renterFunds = types.ZeroCurrency
+	u.renterFundsKnown = false
 	u.mu.Unlock()
 
 	u.SignalWork()
@@ -892,6 +1520,15 @@ func (mgr *uploadManager) refreshUploaders(contracts []api.ContractMetadata, bh
 	mgr.uploaders = refreshed
 }
 
+// updateBlockHeight updates the block height of all uploaders.
+func (mgr *uploadManager) updateBlockHeight(bh uint64) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	for _, u := range mgr.uploaders {
+		u.updateBlockHeight(bh)
+	}
+}
+
 func (mgr *uploadManager) tryRecomputeStats() {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
@@ -1011,7 +1648,44 @@ func (u *upload) canUseUploader(sID slabID, ul *uploader) bool {
 	if !used {
 		_, used = u.used[sID][renewedFrom]
 	}
-	return !used
+	if used {
+		return false
+	}
+
+	// check whether the host exceeds the limit of shards per tag value
+	for _, tag := range u.hostTags[ul.hk] {
+		key, _ := hostdb.SplitTag(tag)
+		if limit, ok := u.tagLimits[key]; ok && u.usedTags[sID][tag] >= limit {
+			return false
+		}
+	}
+
+	// check whether the host would exceed the limit of data stored per host
+	if u.storageLimits != nil {
+		limit := u.storageLimits.HostStorageLimit(u.totalStored, len(u.hostStorage))
+		if limit > 0 && u.hostStorage[ul.hk]+rhpv2.SectorSize > limit {
+			return false
+		}
+	}
+	return true
+}
+
+// limitHostStorage keeps the upload from placing shards on hosts that store
+// more data than the given redundancy settings allow, the data stored per host
+// is taken from the size of the given contracts.
+func (u *upload) limitHostStorage(rs api.RedundancySettings, contracts []api.ContractMetadata) {
+	if rs.MaxHostStorage == 0 && rs.MaxHostStoragePct == 0 {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.storageLimits = &rs
+	u.hostStorage = make(map[types.PublicKey]uint64)
+	for _, c := range contracts {
+		u.hostStorage[c.HostKey] += c.Size
+		u.totalStored += c.Size
+	}
 }
 
 func (u *upload) uploadSlab(ctx context.Context, rs api.RedundancySettings, data []byte, length, index int, respChan chan slabUploadResponse, nextSlabChan chan struct{}) {
@@ -1042,13 +1716,15 @@ func (u *upload) uploadSlab(ctx context.Context, rs api.RedundancySettings, data
 	resp.slab.Slab.Shards, resp.err = u.uploadShards(ctx, shards, nextSlabChan)
 
 	// send the response
+	u.mgr.pendingSlabResponses.Add(1)
+	defer u.mgr.pendingSlabResponses.Add(-1)
 	select {
 	case <-ctx.Done():
 	case respChan <- resp:
 	}
 }
 
-func (u *upload) markUsed(sID slabID, fcid types.FileContractID) {
+func (u *upload) markUsed(sID slabID, hk types.PublicKey, fcid types.FileContractID) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
@@ -1057,6 +1733,20 @@ func (u *upload) markUsed(sID slabID, fcid types.FileContractID) {
 		u.used[sID] = make(map[types.FileContractID]struct{})
 	}
 	u.used[sID][fcid] = struct{}{}
+
+	if len(u.tagLimits) > 0 {
+		if _, exists := u.usedTags[sID]; !exists {
+			u.usedTags[sID] = make(map[string]int)
+		}
+		for _, tag := range u.hostTags[hk] {
+			u.usedTags[sID][tag]++
+		}
+	}
+
+	if u.storageLimits != nil {
+		u.hostStorage[hk] += rhpv2.SectorSize
+		u.totalStored += rhpv2.SectorSize
+	}
 }
 
 func (u *upload) uploadShards(ctx context.Context, shards [][]byte, nextSlabChan chan struct{}) ([]object.Sector, error) {
@@ -1066,7 +1756,7 @@ func (u *upload) uploadShards(ctx context.Context, shards [][]byte, nextSlabChan
 
 	// prepare the upload
 	slab, requests, respChan := u.newSlabUpload(ctx, shards)
-	span.SetAttributes(attribute.Stringer("id", slab.sID))
+	tracing.SetDetailedAttributes(ctx, span, attribute.Stringer("id", slab.sID))
 	defer u.finishSlabUpload(slab)
 
 	// launch all shard uploads
@@ -1157,6 +1847,23 @@ func (u *uploader) SignalWork() {
 }
 
 func (u *uploader) Start(hp hostProvider, rl revisionLocker) {
+	var wg sync.WaitGroup
+	for i := uint64(0); i < u.mgr.maxConcurrentSectorsPerHost; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u.processQueue(rl)
+		}()
+	}
+	wg.Wait()
+}
+
+// processQueue uploads the sectors in the uploader's queue until the uploader
+// is stopped, the uploader runs one of these per sector it uploads in
+// parallel. Appending a sector requires the contract's revision so only one
+// sector is appended at a time, the revision is only held while appending so
+// the others can prepare their sector in the meantime.
+func (u *uploader) processQueue(rl revisionLocker) {
 outer:
 	for {
 		// wait for work
@@ -1174,14 +1881,16 @@ outer:
 			default:
 			}
 
-			// pop the next upload req
-			req := u.pop()
+			// pop the next upload req, unless we're uploading as many
+			// sectors to the host as we're allowed to
+			req := u.popInflight(u.sectorsPerHost())
 			if req == nil {
 				continue outer
 			}
 
 			// skip if upload is done
 			if req.done() {
+				u.trackInflight(-1)
 				continue
 			}
 
@@ -1189,15 +1898,22 @@ outer:
 			var root types.Hash256
 			start := time.Now()
 			fcid, _, _ := u.contractInfo()
-			err := rl.withRevision(req.ctx, defaultRevisionFetchTimeout, fcid, u.hk, u.siamuxAddr, req.upload.lockPriority, u.blockHeight(), func(rev types.FileContractRevision) error {
-				if rev.RevisionNumber == math.MaxUint64 {
-					return errMaxRevisionReached
-				}
+			err := u.prepare(req, fcid)
+			if err == nil {
+				err = rl.withRevision(req.ctx, defaultRevisionFetchTimeout, fcid, u.hk, u.siamuxAddr, req.upload.lockPriority, u.blockHeight(), func(rev types.FileContractRevision) error {
+					if rev.RevisionNumber == math.MaxUint64 {
+						return errMaxRevisionReached
+					}
 
-				var err error
-				root, err = u.execute(req, rev)
-				return err
-			})
+					// track the renter funds after the upload, execute
+					// updates the revision to reflect the payment
+					var err error
+					root, err = u.execute(req, &rev)
+					u.trackRenterFunds(rev.ValidRenterPayout())
+					return err
+				})
+			}
+			u.trackInflight(-1)
 
 			// the uploader's contract got renewed, requeue the request, try and refresh the contract
 			if errors.Is(err, errMaxRevisionReached) {
@@ -1217,6 +1933,10 @@ outer:
 			canceledOverdrive := req.done() && req.overdrive && err != nil
 			if !canceledOverdrive && !isClosedStream(err) {
 				u.trackSectorUpload(err, time.Since(start))
+				if u.tuner != nil {
+					u.tuner.Track(err)
+					u.mgr.overdriveTuner.Track(err)
+				}
 			}
 		}
 	}
@@ -1245,21 +1965,32 @@ func (u *uploader) Stats() (healthy bool, mbps float64) {
 	return
 }
 
-func (u *uploader) execute(req *sectorUploadReq, rev types.FileContractRevision) (types.Hash256, error) {
+// queueStats returns the number of sectors in the uploader's queue and the
+// number of sectors it is currently uploading.
+func (u *uploader) queueStats() (queued, inflight uint64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return uint64(len(u.queue)), u.inflight
+}
+
+// prepare registers the sector of the request as uploading to the contract
+// with the given id with the bus, this doesn't require the contract's revision.
+func (u *uploader) prepare(req *sectorUploadReq, fcid types.FileContractID) error {
+	if err := u.mgr.b.AddUploadingSector(req.ctx, req.upload.id, fcid, rhpv2.SectorRoot(req.sector)); err != nil {
+		return fmt.Errorf("failed to add uploading sector to contract %v, err: %v", fcid, err)
+	}
+	return nil
+}
+
+func (u *uploader) execute(req *sectorUploadReq, rev *types.FileContractRevision) (types.Hash256, error) {
 	u.mu.Lock()
 	host := u.host
-	fcid := u.fcid
 	u.mu.Unlock()
 
 	// fetch span from context
 	span := trace.SpanFromContext(req.ctx)
 	span.AddEvent("execute")
 
-	// update the bus
-	if err := u.mgr.b.AddUploadingSector(req.ctx, req.upload.id, fcid, rhpv2.SectorRoot(req.sector)); err != nil {
-		return types.Hash256{}, fmt.Errorf("failed to add uploading sector to contract %v, err: %v", fcid, err)
-	}
-
 	// upload the sector
 	start := time.Now()
 	root, err := host.UploadSector(req.ctx, req.sector, rev)
@@ -1292,11 +2023,21 @@ func (u *uploader) estimate() float64 {
 		estimateP90 = 1
 	}
 
-	// calculate estimated time
-	numSectors := float64(len(u.queue) + 1)
+	// calculate estimated time, taking into account the sectors that are
+	// being uploaded and the number of sectors we upload in parallel
+	numSectors := float64(len(u.queue)+int(u.inflight)+1) / float64(u.sectorsPerHost())
 	return numSectors * estimateP90
 }
 
+// sectorsPerHost returns the number of sectors the uploader uploads to its host
+// in parallel, it changes over time if auto-tuning is on.
+func (u *uploader) sectorsPerHost() uint64 {
+	if u.tuner != nil {
+		return u.tuner.Limit()
+	}
+	return u.mgr.maxConcurrentSectorsPerHost
+}
+
 func (u *uploader) requeue(req *sectorUploadReq) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
@@ -1306,7 +2047,7 @@ func (u *uploader) requeue(req *sectorUploadReq) {
 func (u *uploader) enqueue(req *sectorUploadReq) {
 	// trace the request
 	span := trace.SpanFromContext(req.ctx)
-	span.SetAttributes(attribute.Stringer("hk", u.hk))
+	tracing.SetDetailedAttributes(req.ctx, span, attribute.Stringer("hk", u.hk))
 	span.AddEvent("enqueued")
 
 	// set the host key and enqueue the request
@@ -1317,7 +2058,7 @@ func (u *uploader) enqueue(req *sectorUploadReq) {
 
 	// mark as used
 	fcid, _, _ := u.contractInfo()
-	req.upload.markUsed(req.sID, fcid)
+	req.upload.markUsed(req.sID, u.hk, fcid)
 
 	// signal there's work
 	u.SignalWork()
@@ -1327,6 +2068,7 @@ func (u *uploader) trackSectorUpload(err error, d time.Duration) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 	if err != nil {
+		u.mgr.hp.trackHostError(u.hk, err)
 		u.consecutiveFailures++
 		u.statsSectorUploadEstimateInMS.Track(float64(time.Hour.Milliseconds()))
 	} else {
@@ -1334,15 +2076,50 @@ func (u *uploader) trackSectorUpload(err error, d time.Duration) {
 		u.consecutiveFailures = 0
 		u.statsSectorUploadEstimateInMS.Track(float64(ms))                       // duration in ms
 		u.statsSectorUploadSpeedBytesPerMS.Track(float64(rhpv2.SectorSize / ms)) // bytes per ms
+		u.metrics.track(rhpv2.SectorSize, d)
 	}
 }
 
+func (u *uploader) trackRenterFunds(funds types.Currency) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.renterFunds = funds
+	u.renterFundsKnown = true
+}
+
+func (u *uploader) trackInflight(delta int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.inflight = uint64(int(u.inflight) + delta)
+}
+
 func (u *uploader) updateBlockHeight(bh uint64) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 	u.bh = bh
 }
 
+// popInflight pops the next request and marks it as inflight, unless the
+// number of inflight requests reached the given limit.
+func (u *uploader) popInflight(limit uint64) *sectorUploadReq {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if len(u.queue) > 0 && u.inflight < limit {
+		j := u.queue[0]
+		u.queue[0] = nil
+		u.queue = u.queue[1:]
+		u.inflight++
+
+		// wake up another thread if there's more work
+		if len(u.queue) > 0 {
+			u.SignalWork()
+		}
+		return j
+	}
+	return nil
+}
+
 func (u *uploader) pop() *sectorUploadReq {
 	u.mu.Lock()
 	defer u.mu.Unlock()
@@ -1351,28 +2128,36 @@ func (u *uploader) pop() *sectorUploadReq {
 		j := u.queue[0]
 		u.queue[0] = nil
 		u.queue = u.queue[1:]
+
+		// wake up another thread if there's more work
+		if len(u.queue) > 0 {
+			u.SignalWork()
+		}
 		return j
 	}
 	return nil
 }
 
 func (req *sectorUploadReq) succeed(root types.Hash256) {
-	select {
-	case <-req.ctx.Done():
-	case req.responseChan <- sectorUploadResp{
+	req.respond(sectorUploadResp{
 		req:  req,
 		root: root,
-	}:
-	}
+	})
 }
 
 func (req *sectorUploadReq) fail(err error) {
-	select {
-	case <-req.ctx.Done():
-	case req.responseChan <- sectorUploadResp{
+	req.respond(sectorUploadResp{
 		req: req,
 		err: err,
-	}:
+	})
+}
+
+func (req *sectorUploadReq) respond(resp sectorUploadResp) {
+	req.upload.mgr.pendingSectorResponses.Add(1)
+	defer req.upload.mgr.pendingSectorResponses.Add(-1)
+	select {
+	case <-req.ctx.Done():
+	case req.responseChan <- resp:
 	}
 }
 
@@ -1457,9 +2242,10 @@ func (s *slabUpload) overdrive(ctx context.Context, respChan chan sectorUploadRe
 	canOverdrive := func() bool {
 		s.mu.Lock()
 		defer s.mu.Unlock()
+		maxOverdrive := s.mgr.currentMaxOverdrive()
 
 		// overdrive is not kicking in yet
-		if uint64(len(s.remaining)) >= s.mgr.maxOverdrive {
+		if uint64(len(s.remaining)) >= maxOverdrive {
 			return false
 		}
 
@@ -1469,7 +2255,7 @@ func (s *slabUpload) overdrive(ctx context.Context, respChan chan sectorUploadRe
 		}
 
 		// overdrive is maxed out
-		if s.numInflight-uint64(len(s.remaining)) >= s.mgr.maxOverdrive {
+		if s.numInflight-uint64(len(s.remaining)) >= maxOverdrive {
 			return false
 		}
 
@@ -1570,7 +2356,8 @@ func (s *slabUpload) receive(resp sectorUploadResp) (finished bool, next bool) {
 	// update remaining sectors
 	delete(s.remaining, resp.req.sectorIndex)
 	finished = len(s.remaining) == 0
-	next = len(s.remaining) <= int(s.mgr.maxOverdrive)
+	maxOverdrive := s.mgr.currentMaxOverdrive()
+	next = len(s.remaining) <= int(maxOverdrive)
 	return
 }
 
@@ -1664,6 +2451,59 @@ type hashReader struct {
 	h *types.Hasher
 }
 
+// verifyReader calls verify with the number of bytes read once the underlying
+// reader is exhausted, if verification fails the error is returned instead of
+// io.EOF.
+type verifyReader struct {
+	r      io.Reader
+	n      int64
+	verify func(n int64) error
+	err    error
+}
+
+func (vr *verifyReader) Read(p []byte) (int, error) {
+	if vr.err != nil {
+		return 0, vr.err
+	}
+	n, err := vr.r.Read(p)
+	vr.n += int64(n)
+	if errors.Is(err, io.EOF) {
+		if vErr := vr.verify(vr.n); vErr != nil {
+			vr.err = fmt.Errorf("%w: %w", errUploadUnverified, vErr)
+			return n, vr.err
+		}
+		vr.err = io.EOF
+	}
+	return n, err
+}
+
+// notifyReader calls onEOF once the underlying reader is exhausted.
+type notifyReader struct {
+	r     io.Reader
+	onEOF func()
+}
+
+func (nr *notifyReader) Read(p []byte) (int, error) {
+	n, err := nr.r.Read(p)
+	if err == io.EOF {
+		nr.onEOF()
+	}
+	return n, err
+}
+
+// peekEmpty returns whether r is empty, the returned reader yields the same
+// data as r.
+func peekEmpty(r io.Reader) (bool, io.Reader, error) {
+	var b [1]byte
+	n, err := io.ReadFull(r, b[:])
+	if errors.Is(err, io.EOF) {
+		return true, r, nil
+	} else if err != nil {
+		return false, nil, err
+	}
+	return false, io.MultiReader(bytes.NewReader(b[:n]), r), nil
+}
+
 func newHashReader(r io.Reader) *hashReader {
 	return &hashReader{
 		r: r,
@@ -1683,3 +2523,138 @@ func (e *hashReader) Hash() string {
 	sum := e.h.Sum()
 	return hex.EncodeToString(sum[:])
 }
+
+// hashWriter hashes and counts the bytes written to it.
+type hashWriter struct {
+	h *types.Hasher
+	n int64
+}
+
+func (hw *hashWriter) Write(p []byte) (int, error) {
+	n, err := hw.h.E.Write(p)
+	hw.n += int64(n)
+	return n, err
+}
+
+// idleTimeoutReader wraps the body of an upload and fails once the producer
+// stalls for longer than the idle timeout, or once the upload's context
+// expires. Rather than timing every read, it pushes the connection's read
+// deadline back whenever data was received, which makes a stalled read fail.
+// If the connection doesn't support read deadlines, a single watchdog timer
+// that is reset on progress cancels the upload instead.
+type idleTimeoutReader struct {
+	ctx             context.Context
+	r               io.Reader
+	timeout         time.Duration
+	setReadDeadline func(time.Time) error
+
+	watchdog *time.Timer
+	timedOut atomic.Bool
+	err      error
+}
+
+// newIdleTimeoutReader wraps the given reader with a reader that fails if no
+// data was read within the given timeout, or if the context is closed. The
+// given function sets the read deadline of the underlying connection, cancel
+// cancels the upload if the connection doesn't support deadlines. The reader
+// must be closed to release its timer and clear the connection's deadline.
+func newIdleTimeoutReader(ctx context.Context, r io.Reader, timeout time.Duration, setReadDeadline func(time.Time) error, cancel context.CancelFunc) *idleTimeoutReader {
+	itr := &idleTimeoutReader{
+		ctx:             ctx,
+		r:               r,
+		timeout:         timeout,
+		setReadDeadline: setReadDeadline,
+	}
+	if setReadDeadline == nil || itr.extend() != nil {
+		itr.setReadDeadline = nil
+		if timeout > 0 {
+			itr.watchdog = time.AfterFunc(timeout, func() {
+				itr.timedOut.Store(true)
+				cancel()
+			})
+		}
+	}
+	return itr
+}
+
+// extend pushes the read deadline back by the idle timeout, without exceeding
+// the deadline of the upload's context.
+func (r *idleTimeoutReader) extend() error {
+	deadline, ok := r.ctx.Deadline()
+	if r.timeout > 0 && (!ok || time.Until(deadline) > r.timeout) {
+		deadline = time.Now().Add(r.timeout)
+	}
+	return r.setReadDeadline(deadline)
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	} else if err := r.timeoutErr(); err != nil {
+		r.err = err
+		return 0, r.err
+	}
+
+	n, err := r.r.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// the deadline is capped by the context's deadline, closing the
+		// connection might have cancelled the context in the meantime
+		r.err = errUploadIdleTimeout
+		if errors.Is(r.ctx.Err(), context.DeadlineExceeded) {
+			r.err = context.DeadlineExceeded
+		}
+		return 0, r.err
+	} else if err := r.timeoutErr(); err != nil {
+		r.err = err
+		return 0, r.err
+	} else if n > 0 && r.watchdog != nil {
+		r.watchdog.Reset(r.timeout)
+	} else if n > 0 && r.setReadDeadline != nil {
+		r.extend()
+	}
+	return n, err
+}
+
+// timeoutErr returns the error the reader fails with once the watchdog fired
+// or the upload's context was closed.
+func (r *idleTimeoutReader) timeoutErr() error {
+	if r.timedOut.Load() {
+		return errUploadIdleTimeout
+	}
+	return r.ctx.Err()
+}
+
+// Close stops the watchdog and clears the read deadline, that way it doesn't
+// affect the next request on the same connection.
+func (r *idleTimeoutReader) Close() error {
+	if r.watchdog != nil {
+		r.watchdog.Stop()
+	}
+	if r.setReadDeadline != nil {
+		return r.setReadDeadline(time.Time{})
+	}
+	return nil
+}
+
+// limitReader is like io.LimitReader but returns an error instead of io.EOF if
+// the underlying reader holds more than n bytes.
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	// read one byte more than allowed to detect that the limit was exceeded
+	if int64(len(p)) > r.n+1 {
+		p = p[:r.n+1]
+	}
+	n, err := r.r.Read(p)
+	if int64(n) > r.n {
+		n = int(r.n)
+		r.n = 0
+		return n, r.err
+	}
+	r.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,383 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+func newTestUploadManager(b *mockBus, hp *mockHostProvider, peers []UploadPeer) *uploadManager {
+	return newUploadManager(b, hp, newMockRevisionLocker(), 0, 1, 0, time.Second, false, peers, zap.NewNop().Sugar())
+}
+
+func newTestUploadParameters() uploadParameters {
+	up := defaultParameters()
+	up.rs = api.RedundancySettings{MinShards: 1, TotalShards: 2}
+	up.contractSet = "test"
+	return up
+}
+
+func TestUploadWithPeers(t *testing.T) {
+	b := newMockBus()
+	hp := newMockHostProvider()
+	b.addHosts(hp, 4)
+
+	// create a coordinator with a peer
+	peer := newTestUploadManager(b, hp, nil)
+	defer peer.Stop()
+	mgr := newTestUploadManager(b, hp, []UploadPeer{&mockPeer{mgr: peer}})
+	defer mgr.Stop()
+
+	// track the upload like the worker does
+	up := newTestUploadParameters()
+	var finishFn func()
+	up.uploadID, finishFn = mgr.trackUpload(context.Background())
+
+	// upload 4 slabs, every other slab is uploaded by the peer
+	data := frand.Bytes(4 * rhpv2.SectorSize)
+	o, _, used, _, err := mgr.Upload(context.Background(), bytes.NewReader(data), up, lockingPriorityUpload)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(o.Slabs) != 4 {
+		t.Fatalf("expected 4 slabs, got %v", len(o.Slabs))
+	} else if len(used) == 0 {
+		t.Fatal("expected used contracts")
+	}
+
+	// assert the sectors of the peer were added to the coordinator's upload
+	// and the upload is only finished by the coordinator
+	b.mu.Lock()
+	numTracked, uploading, finished := len(b.uploads), len(b.uploading[up.uploadID]), b.uploads[up.uploadID]
+	b.mu.Unlock()
+	if numTracked != 1 {
+		t.Fatalf("expected 1 tracked upload, got %v", numTracked)
+	} else if uploading < 8 {
+		t.Fatalf("expected at least 8 uploading sectors, got %v", uploading)
+	} else if finished {
+		t.Fatal("upload shouldn't be finished")
+	}
+	finishFn()
+	b.mu.Lock()
+	finished = b.uploads[up.uploadID]
+	b.mu.Unlock()
+	if !finished {
+		t.Fatal("upload should be finished")
+	}
+}
+
+func TestUploadWithPeersFallback(t *testing.T) {
+	b := newMockBus()
+	hp := newMockHostProvider()
+	b.addHosts(hp, 2)
+
+	// create a coordinator with a peer that always fails
+	mgr := newTestUploadManager(b, hp, []UploadPeer{&mockPeer{err: errors.New("peer unavailable")}})
+	defer mgr.Stop()
+
+	// upload 2 slabs, the one of the peer is uploaded by the coordinator
+	up := newTestUploadParameters()
+	data := frand.Bytes(2 * rhpv2.SectorSize)
+	o, _, _, _, err := mgr.Upload(context.Background(), bytes.NewReader(data), up, lockingPriorityUpload)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(o.Slabs) != 2 {
+		t.Fatalf("expected 2 slabs, got %v", len(o.Slabs))
+	}
+	for i, slab := range o.Slabs {
+		if slab.Length != rhpv2.SectorSize {
+			t.Fatalf("slab %d: unexpected length %v", i, slab.Length)
+		}
+	}
+
+	// assert both hosts store a sector of every slab
+	for _, h := range hp.hosts {
+		if n := h.numSectors(); n != 2 {
+			t.Fatalf("expected host to store 2 sectors, got %v", n)
+		}
+	}
+}
+
+func TestUploaderRevisionLocking(t *testing.T) {
+	b := newMockBus()
+	hp := newMockHostProvider()
+	b.addHosts(hp, 1)
+	for _, h := range hp.hosts {
+		h.delay = 10 * time.Millisecond
+	}
+
+	// assert the sectors are registered with the bus without holding the
+	// contract's revision
+	rl := newMockRevisionLocker()
+	var mu sync.Mutex
+	var registeredWhileLocked int
+	b.onAddUploadingSector = func(fcid types.FileContractID) {
+		if rl.isHeld(fcid) {
+			mu.Lock()
+			registeredWhileLocked++
+			mu.Unlock()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// upload to a single host using multiple goroutines
+	mgr := newUploadManager(b, hp, rl, 0, 3, 0, time.Second, false, nil, zap.NewNop().Sugar())
+	defer mgr.Stop()
+	up := newTestUploadParameters()
+	up.rs = api.RedundancySettings{MinShards: 1, TotalShards: 1}
+	var finishFn func()
+	up.uploadID, finishFn = mgr.trackUpload(context.Background())
+	defer finishFn()
+
+	data := frand.Bytes(6 * rhpv2.SectorSize)
+	if _, _, _, _, err := mgr.Upload(context.Background(), bytes.NewReader(data), up, lockingPriorityUpload); err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range hp.hosts {
+		if n := h.numSectors(); n != 6 {
+			t.Fatalf("expected host to store 6 sectors, got %v", n)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if registeredWhileLocked > 0 {
+		t.Fatalf("%v sectors were registered while holding the revision", registeredWhileLocked)
+	}
+}
+
+func TestUploadVerification(t *testing.T) {
+	b := newMockBus()
+	hp := newMockHostProvider()
+	b.addHosts(hp, 2)
+	mgr := newTestUploadManager(b, hp, nil)
+	defer mgr.Stop()
+
+	// assert the data is verified once it was read in full, we upload data
+	// that ends on a slab boundary, a partial slab and an empty object
+	for _, size := range []int{2 * rhpv2.SectorSize, rhpv2.SectorSize + 10, 0} {
+		var verifiedSize int64
+		var verifiedETag string
+		up := newTestUploadParameters()
+		up.verify = func(size int64, eTag string) error {
+			verifiedSize, verifiedETag = size, eTag
+			return nil
+		}
+		_, _, _, eTag, err := mgr.Upload(context.Background(), bytes.NewReader(frand.Bytes(size)), up, lockingPriorityUpload)
+		if err != nil {
+			t.Fatal(err)
+		} else if verifiedSize != int64(size) {
+			t.Fatalf("expected size %v to be verified, got %v", size, verifiedSize)
+		} else if verifiedETag != eTag {
+			t.Fatalf("expected ETag %v to be verified, got %v", eTag, verifiedETag)
+		}
+
+		// assert the upload fails if the verification fails
+		up.verify = func(int64, string) error { return api.ErrObjectTrailerMismatch }
+		_, _, _, _, err = mgr.Upload(context.Background(), bytes.NewReader(frand.Bytes(size)), up, lockingPriorityUpload)
+		if !errors.Is(err, errUploadUnverified) || !errors.Is(err, api.ErrObjectTrailerMismatch) {
+			t.Fatal("unexpected error", err)
+		}
+	}
+}
+
+func TestIdleTimeoutReader(t *testing.T) {
+	// serve a handler that reads the request body through the reader, the
+	// read deadline of the connection is extended on progress
+	errs := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		r := newIdleTimeoutReader(ctx, req.Body, 100*time.Millisecond, http.NewResponseController(w).SetReadDeadline, cancel)
+		defer r.Close()
+		if r.watchdog != nil {
+			errs <- errors.New("expected the connection to support read deadlines")
+			return
+		}
+		buf := make([]byte, 3)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			errs <- err
+			return
+		} else if string(buf) != "foo" {
+			errs <- fmt.Errorf("unexpected data %q", buf)
+			return
+		}
+		_, err := r.Read(buf)
+		errs <- err
+	}))
+	defer srv.Close()
+
+	// send data slower than the timeout but with progress, then stall
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		for _, b := range []byte("foo") {
+			time.Sleep(50 * time.Millisecond)
+			pw.Write([]byte{b})
+		}
+	}()
+	go http.Post(srv.URL, "application/octet-stream", pr)
+	if err := <-errs; !errors.Is(err, errUploadIdleTimeout) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert the watchdog cancels the upload if the reader doesn't support
+	// deadlines, and the reader keeps failing
+	pr, pw = io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := newIdleTimeoutReader(ctx, pr, 10*time.Millisecond, nil, cancel)
+	defer r.Close()
+	go func() {
+		<-ctx.Done()
+		pw.Write([]byte("bar"))
+	}()
+	buf := make([]byte, 10)
+	if _, err := r.Read(buf); !errors.Is(err, errUploadIdleTimeout) {
+		t.Fatal("unexpected error", err)
+	} else if _, err := r.Read(buf); !errors.Is(err, errUploadIdleTimeout) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert the read fails if the context is closed
+	ctx, cancel = context.WithCancel(context.Background())
+	r = newIdleTimeoutReader(ctx, pr, 0, nil, cancel)
+	cancel()
+	if _, err := r.Read(buf); !errors.Is(err, context.Canceled) {
+		t.Fatal("unexpected error", err)
+	}
+	pw.Close()
+}
+
+func TestAdaptiveSlabsAhead(t *testing.T) {
+	tests := []struct {
+		healthy     int
+		totalShards int
+		want        int
+	}{
+		{0, 2, 1},
+		{3, 2, 1},
+		{8, 2, 4},
+		{9, 2, 4},
+		{30, 30, 1},
+		{90, 30, 3},
+		{10, 0, 1},
+	}
+	for _, test := range tests {
+		if got := adaptiveSlabsAhead(test.healthy, test.totalShards); got != test.want {
+			t.Errorf("healthy %v total shards %v: got %v, want %v", test.healthy, test.totalShards, got, test.want)
+		}
+	}
+}
+
+func TestUploadSlabsAhead(t *testing.T) {
+	tests := []struct {
+		name          string
+		hosts         int
+		maxSlabsAhead uint64
+		window        int
+	}{
+		{"small set", 2, 0, 1},
+		{"large set with a fixed window", 8, 1, 1},
+		{"large set", 8, 0, 4},
+	}
+	for _, test := range tests {
+		b := newMockBus()
+		hp := newMockHostProvider()
+		b.addHosts(hp, test.hosts)
+		mgr := newUploadManager(b, hp, newMockRevisionLocker(), 1, 1, test.maxSlabsAhead, time.Minute, false, nil, zap.NewNop().Sugar())
+
+		// create an upload of slabs with 2 shards each
+		u, err := mgr.newUploadWithID(api.UploadID{}, 2, b.contracts, 0, lockingPriorityUpload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// add enough ongoing slabs to exceed the window, none of them finish
+		// uploading until we say so
+		sIDs := make([]slabID, test.window+2)
+		for i := range sIDs {
+			frand.Read(sIDs[i][:])
+			u.ongoing = append(u.ongoing, sIDs[i])
+		}
+
+		// assert the slabs within the window are uploaded ahead of their
+		// parents
+		for i, sID := range sIDs[:test.window+1] {
+			if mgr.candidate(&sectorUploadReq{upload: u, sID: sID, ctx: context.Background()}) == nil {
+				t.Fatalf("%v: slab %v has no candidate", test.name, i)
+			}
+		}
+
+		// assert the next slab waits for its parents
+		candidateChan := make(chan *uploader, 1)
+		go func() {
+			candidateChan <- mgr.candidate(&sectorUploadReq{upload: u, sID: sIDs[len(sIDs)-1], ctx: context.Background()})
+		}()
+		for mgr.waitingForParents.Load() != 1 {
+			select {
+			case <-candidateChan:
+				t.Fatalf("%v: slab outside of the window wasn't held back", test.name)
+			default:
+				runtime.Gosched()
+			}
+		}
+
+		// finish the oldest slab, which moves the slab into the window
+		u.mu.Lock()
+		u.ongoing = u.ongoing[1:]
+		u.mu.Unlock()
+		u.doneShardTrigger <- struct{}{}
+		if <-candidateChan == nil {
+			t.Fatalf("%v: slab has no candidate", test.name)
+		} else if n := mgr.waitingForParents.Load(); n != 0 {
+			t.Fatalf("%v: expected no slabs to wait for their parents, got %v", test.name, n)
+		}
+		mgr.Stop()
+	}
+}
+
+func TestUploadDeniedHosts(t *testing.T) {
+	b := newMockBus()
+	hp := newMockHostProvider()
+	b.addHosts(hp, 3)
+	mgr := newTestUploadManager(b, hp, nil)
+	defer mgr.Stop()
+
+	// deny one of the hosts
+	var denied *mockHost
+	for _, h := range hp.hosts {
+		denied = h
+		break
+	}
+	hp.denyList.Deny(denied.hk, api.DenyReasonCorruptData, ErrInvalidMerkleProof, time.Now().Add(time.Minute))
+
+	// assert the denied host isn't used as long as there are enough other
+	// hosts
+	data := frand.Bytes(2 * rhpv2.SectorSize)
+	if _, _, _, _, err := mgr.Upload(context.Background(), bytes.NewReader(data), newTestUploadParameters(), lockingPriorityUpload); err != nil {
+		t.Fatal(err)
+	} else if n := denied.numSectors(); n != 0 {
+		t.Fatalf("expected denied host to store no sectors, got %v", n)
+	}
+
+	// assert it's used if we'd otherwise not have enough hosts
+	up := newTestUploadParameters()
+	up.rs = api.RedundancySettings{MinShards: 1, TotalShards: 3}
+	if _, _, _, _, err := mgr.Upload(context.Background(), bytes.NewReader(data), up, lockingPriorityUpload); err != nil {
+		t.Fatal(err)
+	} else if n := denied.numSectors(); n != 2 {
+		t.Fatalf("expected denied host to store 2 sectors, got %v", n)
+	}
+}
@@ -0,0 +1,129 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	rhpv3 "go.sia.tech/core/rhp/v3"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+// checkUploadFunds projects whether the remaining funds of the given contracts
+// and the balances of the accounts with their hosts suffice to upload an
+// object of the given size to the given contract set. Hosts for which the
+// worker doesn't know the remaining funds or the price of uploading a sector
+// are assumed to be able to store all of the upload's sectors, that way we
+// only reject uploads we know would fail.
+func (w *worker) checkUploadFunds(ctx context.Context, contractSet string, rs api.RedundancySettings, size int64, packing bool) error {
+	// calculate the number of slabs, if packing is enabled the trailing
+	// partial slab isn't uploaded right away
+	slabSize := int64(rs.MinShards) * rhpv2.SectorSize
+	if slabSize <= 0 || size <= 0 {
+		return nil
+	}
+	numSlabs := uint64(size / slabSize)
+	if !packing && size%slabSize != 0 {
+		numSlabs++
+	}
+	if numSlabs == 0 {
+		return nil
+	}
+
+	// fetch the contracts and account balances
+	contracts, err := w.bus.ContractSetContracts(ctx, contractSet)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch contracts from bus: %w", err)
+	}
+	accounts, err := w.bus.Accounts(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch accounts from bus: %w", err)
+	}
+	balances := make(map[rhpv3.Account]*big.Int)
+	for _, acc := range accounts {
+		balances[acc.ID] = acc.Balance
+	}
+
+	// calculate how many sectors every contract can pay for
+	capacities := make([]uint64, 0, len(contracts))
+	for _, c := range contracts {
+		capacities = append(capacities, w.contractUploadCapacity(c, balances, numSlabs))
+	}
+
+	// assert the upload can be completed
+	if completed := uploadableSlabs(capacities, uint64(rs.TotalShards), numSlabs); completed < numSlabs {
+		return fmt.Errorf("%w: only %v out of %v slabs (%.0f%%) can be uploaded", api.ErrUploadFundsExhausted, completed, numSlabs, float64(completed)/float64(numSlabs)*100)
+	}
+	return nil
+}
+
+// contractUploadCapacity returns the number of sectors we can afford to upload
+// to the given contract, capped at the given limit.
+func (w *worker) contractUploadCapacity(c api.ContractMetadata, balances map[rhpv3.Account]*big.Int, limit uint64) uint64 {
+	funds, known := w.uploadManager.renterFunds(c.ID)
+	if !known {
+		return limit
+	}
+	pt, ok := w.priceTables.cached(c.HostKey)
+	if !ok {
+		return limit
+	}
+	accID := rhpv3.Account(w.accounts.deriveAccountKey(c.HostKey).PublicKey())
+	return uploadCapacity(funds, balances[accID], pt.HostPriceTable, c.WindowEnd, limit)
+}
+
+// uploadCapacity returns the number of sectors that can be paid for using the
+// given contract funds and account balance, capped at the given limit. If the
+// cost of uploading a sector can't be determined the limit is returned.
+func uploadCapacity(funds types.Currency, balance *big.Int, pt rhpv3.HostPriceTable, windowEnd, limit uint64) uint64 {
+	if windowEnd < pt.HostBlockHeight {
+		return limit
+	}
+	cost, _, _, err := uploadSectorCost(pt, windowEnd)
+	if err != nil || cost.IsZero() {
+		return limit
+	}
+
+	// add the balance of the account with the host, uploads are paid for
+	// using the account before falling back to the contract
+	if balance != nil && balance.Sign() > 0 {
+		funds = funds.Add(types.NewCurrency(balance.Uint64(), new(big.Int).Rsh(balance, 64).Uint64()))
+	}
+
+	n := funds.Div(cost)
+	if n.Hi > 0 || n.Lo >= limit {
+		return limit
+	}
+	return n.Lo
+}
+
+// uploadableSlabs returns the number of slabs, capped at the given limit, that
+// can be uploaded to hosts that can store the given number of sectors. Every
+// sector of a slab has to be stored on a different host, so n slabs fit if the
+// hosts can store n*totalShards sectors when every host stores at most n.
+func uploadableSlabs(capacities []uint64, totalShards, limit uint64) uint64 {
+	fits := func(n uint64) bool {
+		var total uint64
+		for _, c := range capacities {
+			if c > n {
+				c = n
+			}
+			total += c
+		}
+		return total >= n*totalShards
+	}
+
+	// the function is monotonic, so we binary search the largest n that fits
+	lo, hi := uint64(0), limit
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"math/big"
+	"testing"
+
+	rhpv3 "go.sia.tech/core/rhp/v3"
+	"go.sia.tech/core/types"
+)
+
+func TestUploadCapacity(t *testing.T) {
+	pt := rhpv3.HostPriceTable{
+		HostBlockHeight: 100,
+		InitBaseCost:    types.Siacoins(1),
+	}
+	cost, _, _, err := uploadSectorCost(pt, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		funds     types.Currency
+		balance   *big.Int
+		pt        rhpv3.HostPriceTable
+		windowEnd uint64
+		limit     uint64
+		want      uint64
+	}{
+		// no funds
+		{types.ZeroCurrency, nil, pt, 200, 10, 0},
+		// contract funds only
+		{cost.Mul64(3), nil, pt, 200, 10, 3},
+		// contract funds and account balance
+		{cost.Mul64(3), cost.Mul64(2).Big(), pt, 200, 10, 5},
+		// negative balances are ignored
+		{cost.Mul64(3), big.NewInt(-1), pt, 200, 10, 3},
+		// capped at the limit
+		{cost.Mul64(20), nil, pt, 200, 10, 10},
+		// window end before the host's block height
+		{types.ZeroCurrency, nil, pt, 50, 10, 10},
+		// unknown cost
+		{types.ZeroCurrency, nil, rhpv3.HostPriceTable{}, 200, 10, 10},
+	}
+	for i, test := range tests {
+		if got := uploadCapacity(test.funds, test.balance, test.pt, test.windowEnd, test.limit); got != test.want {
+			t.Errorf("%d: expected %v sectors, got %v", i, test.want, got)
+		}
+	}
+}
+
+func TestUploadableSlabs(t *testing.T) {
+	tests := []struct {
+		capacities  []uint64
+		totalShards uint64
+		limit       uint64
+		want        uint64
+	}{
+		// no hosts
+		{nil, 3, 10, 0},
+		// not enough hosts for a single slab
+		{[]uint64{10, 10}, 3, 10, 0},
+		// every host can store every sector
+		{[]uint64{10, 10, 10}, 3, 10, 10},
+		// the weakest host limits the number of slabs
+		{[]uint64{10, 10, 4}, 3, 10, 4},
+		// a spare host makes up for the weak host
+		{[]uint64{10, 10, 4, 6}, 3, 10, 10},
+		// two weak hosts combined can't make up for a missing host
+		{[]uint64{10, 10, 2, 2}, 3, 10, 4},
+		// capped at the limit
+		{[]uint64{100, 100, 100}, 3, 10, 10},
+	}
+	for i, test := range tests {
+		if got := uploadableSlabs(test.capacities, test.totalShards, test.limit); got != test.want {
+			t.Errorf("%d: expected %v slabs, got %v", i, test.want, got)
+		}
+	}
+}
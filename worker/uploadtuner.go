@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"sync"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+)
+
+const (
+	// uploadTunerOverdriveWindow is the number of sector uploads the
+	// overdrive tuner observes before it adjusts the max overdrive, it
+	// observes the sector uploads to all hosts.
+	uploadTunerOverdriveWindow = 64
+
+	// uploadTunerHostWindow is the number of sector uploads the tuner of an
+	// uploader observes before it adjusts the number of sectors uploaded to
+	// its host in parallel.
+	uploadTunerHostWindow = 16
+
+	// uploadTunerMaxErrorRate is the rate of failed sector uploads within a
+	// window above which the tuner backs off.
+	uploadTunerMaxErrorRate = 0.05
+
+	// uploadTunerThroughputTolerance is the fraction of the previous window's
+	// throughput the current window has to reach for the tuner to keep
+	// increasing the concurrency.
+	uploadTunerThroughputTolerance = 0.95
+)
+
+type (
+	// uploadTuner adjusts an upload concurrency limit based on the observed
+	// throughput and error rate in an AIMD fashion. The limit is increased
+	// additively as long as the throughput doesn't drop, and decreased
+	// multiplicatively when too many sector uploads fail. The upload manager
+	// uses one to tune the max overdrive, every uploader uses its own to tune
+	// the number of sectors uploaded to its host in parallel, that way a
+	// misbehaving host doesn't throttle the uploads to all other hosts.
+	uploadTuner struct {
+		min    uint64
+		max    uint64
+		window uint64
+
+		mu             sync.Mutex
+		limit          uint64
+		lastThroughput float64
+		windowStart    time.Time
+		windowUploads  uint64
+		windowFailures uint64
+	}
+)
+
+// newUploadTuner creates a tuner that starts at the given minimum, never
+// exceeds the given maximum and adjusts the limit after every window of
+// sector uploads.
+func newUploadTuner(min, max, window uint64) *uploadTuner {
+	if max < min {
+		max = min
+	}
+	return &uploadTuner{
+		min:    min,
+		max:    max,
+		window: window,
+
+		limit:       min,
+		windowStart: time.Now(),
+	}
+}
+
+// Limit returns the current limit.
+func (t *uploadTuner) Limit() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+// Track records the outcome of a sector upload and adjusts the limit once a
+// full window of uploads was observed.
+func (t *uploadTuner) Track(err error) {
+	t.track(err, time.Now())
+}
+
+func (t *uploadTuner) track(err error, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.windowUploads++
+	if err != nil {
+		t.windowFailures++
+	}
+	if t.windowUploads < t.window {
+		return
+	}
+
+	elapsed := now.Sub(t.windowStart)
+	if elapsed <= 0 {
+		elapsed = time.Millisecond
+	}
+	succeeded := t.windowUploads - t.windowFailures
+	throughput := float64(succeeded*rhpv2.SectorSize) / elapsed.Seconds()
+	errorRate := float64(t.windowFailures) / float64(t.windowUploads)
+
+	if errorRate > uploadTunerMaxErrorRate {
+		// multiplicative decrease
+		t.limit /= 2
+		if t.limit < t.min {
+			t.limit = t.min
+		}
+	} else if throughput >= t.lastThroughput*uploadTunerThroughputTolerance && t.limit < t.max {
+		// additive increase
+		t.limit++
+	}
+
+	t.lastThroughput = throughput
+	t.windowStart = now
+	t.windowUploads = 0
+	t.windowFailures = 0
+}
@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestUploadTuner(t *testing.T) {
+	tuner := newUploadTuner(1, 3, 4)
+	now := tuner.windowStart
+	errUpload := errors.New("upload failed")
+
+	// trackWindow tracks a full window of uploads that took the given time,
+	// of which the given number failed
+	trackWindow := func(d time.Duration, failures int) {
+		t.Helper()
+		now = now.Add(d)
+		for i := 0; i < 4; i++ {
+			var err error
+			if i < failures {
+				err = errUpload
+			}
+			tuner.track(err, now)
+		}
+	}
+
+	// assert the tuner starts at the minimum
+	if limit := tuner.Limit(); limit != 1 {
+		t.Fatalf("expected limit 1, got %v", limit)
+	}
+
+	// assert the limit isn't adjusted before a full window was observed
+	now = now.Add(time.Second)
+	for i := 0; i < 3; i++ {
+		tuner.track(nil, now)
+	}
+	if limit := tuner.Limit(); limit != 1 {
+		t.Fatalf("expected limit 1, got %v", limit)
+	}
+	tuner.track(nil, now)
+	if limit := tuner.Limit(); limit != 2 {
+		t.Fatalf("expected limit 2, got %v", limit)
+	}
+
+	// assert the limit increases additively as long as the throughput doesn't
+	// drop and never exceeds the maximum
+	for _, want := range []uint64{3, 3} {
+		trackWindow(time.Second, 0)
+		if limit := tuner.Limit(); limit != want {
+			t.Fatalf("expected limit %v, got %v", want, limit)
+		}
+	}
+
+	// assert the limit isn't increased if the throughput drops
+	tuner.limit = 2
+	trackWindow(2*time.Second, 0)
+	if limit := tuner.Limit(); limit != 2 {
+		t.Fatalf("expected limit 2, got %v", limit)
+	}
+
+	// assert the limit decreases multiplicatively if too many uploads fail
+	// and never drops below the minimum
+	tuner.limit = 3
+	for _, want := range []uint64{1, 1} {
+		trackWindow(time.Second, 1)
+		if limit := tuner.Limit(); limit != want {
+			t.Fatalf("expected limit %v, got %v", want, limit)
+		}
+	}
+}
+
+func TestUploaderTuners(t *testing.T) {
+	b := newMockBus()
+	hp := newMockHostProvider()
+	b.addHosts(hp, 2)
+	mgr := newUploadManager(b, hp, newMockRevisionLocker(), 2, 4, 0, time.Second, true, nil, zap.NewNop().Sugar())
+	defer mgr.Stop()
+
+	// assert every uploader is tuned independently
+	u1, u2 := mgr.newUploader(b.contracts[0]), mgr.newUploader(b.contracts[1])
+	if u1.tuner == nil || u1.tuner == u2.tuner {
+		t.Fatal("expected uploaders to have their own tuner")
+	}
+	for i := uint64(0); i < uploadTunerHostWindow; i++ {
+		u1.tuner.Track(errors.New("upload failed"))
+		u2.tuner.Track(nil)
+	}
+	if u1.sectorsPerHost() != 1 || u2.sectorsPerHost() != 2 {
+		t.Fatalf("unexpected sectors per host %v %v", u1.sectorsPerHost(), u2.sectorsPerHost())
+	} else if mgr.currentMaxOverdrive() != 0 {
+		t.Fatalf("expected max overdrive to start at 0, got %v", mgr.currentMaxOverdrive())
+	}
+
+	// assert the configured limits are used if auto-tuning is off
+	mgr.autoTune, mgr.overdriveTuner = false, nil
+	u := mgr.newUploader(b.contracts[0])
+	if u.tuner != nil || u.sectorsPerHost() != 4 || mgr.currentMaxOverdrive() != 2 {
+		t.Fatal("expected configured limits to be used")
+	}
+}
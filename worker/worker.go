@@ -2,6 +2,8 @@ package worker
 
 import (
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,11 +13,14 @@ import (
 	"net/http"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gotd/contrib/http_range"
+	"github.com/julienschmidt/httprouter"
 	"go.opentelemetry.io/otel/trace"
 	rhpv2 "go.sia.tech/core/rhp/v2"
 	rhpv3 "go.sia.tech/core/rhp/v3"
@@ -39,8 +44,17 @@ const (
 	batchSizeDeleteSectors = uint64(500000) // ~16MiB of roots
 	batchSizeFetchSectors  = uint64(130000) // ~4MiB of roots
 
-	defaultLockTimeout          = time.Minute
-	defaultRevisionFetchTimeout = 30 * time.Second
+	defaultLockTimeout            = time.Minute
+	defaultPriceTableFetchTimeout = 30 * time.Second
+	defaultRevisionFetchTimeout   = 30 * time.Second
+
+	// maxPriceTableFetchHosts is the maximum number of hosts the worker
+	// fetches a price table from in a single batch.
+	maxPriceTableFetchHosts = 1000
+
+	// priceTableFetchThreads is the number of price tables the worker fetches
+	// in parallel.
+	priceTableFetchThreads = 20
 
 	lockingPriorityActiveContractRevision = 100
 	lockingPriorityRenew                  = 80
@@ -48,6 +62,7 @@ const (
 	lockingPriorityFunding                = 40
 	lockingPrioritySyncing                = 30
 	lockingPriorityPruning                = 20
+	lockingPriorityDownload               = 18
 
 	lockingPriorityBlockedUpload    = 15
 	lockingPriorityUpload           = 10
@@ -99,6 +114,10 @@ type (
 		ConsensusState(ctx context.Context) (api.ConsensusState, error)
 	}
 
+	consensusEvents interface {
+		ConsensusEvent(ctx context.Context, after types.BlockID, timeout time.Duration) (api.ConsensusEvent, error)
+	}
+
 	revisionUnlocker interface {
 		Release(context.Context) error
 	}
@@ -114,9 +133,16 @@ type ContractLocker interface {
 	ReleaseContract(ctx context.Context, fcid types.FileContractID, lockID uint64) (err error)
 }
 
+// An UploadPeer is a worker that uploads slabs on behalf of a coordinating
+// worker, it has to share the coordinator's bus and seed.
+type UploadPeer interface {
+	UploadSlab(ctx context.Context, r io.Reader, opts api.UploadSlabOptions) (api.UploadSlabResponse, error)
+}
+
 // A Bus is the source of truth within a renterd system.
 type Bus interface {
 	alerts.Alerter
+	consensusEvents
 	consensusState
 	webhooks.Broadcaster
 
@@ -126,6 +152,7 @@ type Bus interface {
 	SyncerPeers(ctx context.Context) (resp []string, err error)
 
 	BroadcastTransaction(ctx context.Context, txns []types.Transaction) error
+	TransactionPool(ctx context.Context) ([]types.Transaction, error)
 
 	Contract(ctx context.Context, id types.FileContractID) (api.ContractMetadata, error)
 	ContractSize(ctx context.Context, id types.FileContractID) (api.ContractSize, error)
@@ -135,9 +162,12 @@ type Bus interface {
 	RecordHostScans(ctx context.Context, scans []hostdb.HostScan) error
 	RecordPriceTables(ctx context.Context, priceTableUpdate []hostdb.PriceTableUpdate) error
 	RecordContractSpending(ctx context.Context, records []api.ContractSpendingRecord) error
+	RecordUploadStatsMetric(ctx context.Context, metric api.UploadStatsMetric) error
+	RecordHostMetrics(ctx context.Context, metrics []api.HostMetric) error
 	RenewedContract(ctx context.Context, renewedFrom types.FileContractID) (api.ContractMetadata, error)
 
 	Host(ctx context.Context, hostKey types.PublicKey) (hostdb.HostInfo, error)
+	SearchHosts(ctx context.Context, opts api.SearchHostOptions) ([]hostdb.Host, error)
 
 	GougingParams(ctx context.Context) (api.GougingParams, error)
 	UploadParams(ctx context.Context) (api.UploadParams, error)
@@ -146,7 +176,14 @@ type Bus interface {
 	AddObject(ctx context.Context, bucket, path, contractSet string, o object.Object, usedContracts map[types.PublicKey]types.FileContractID, opts api.AddObjectOptions) error
 	DeleteObject(ctx context.Context, bucket, path string, opts api.DeleteObjectOptions) error
 
+	PartialObject(ctx context.Context, bucket, path string) (api.PartialObject, error)
+	AddPartialObjectSlabs(ctx context.Context, bucket, path string, offset int, po api.PartialObject) error
+	DeletePartialObject(ctx context.Context, bucket, path string) error
+
+	AbortMultipartUpload(ctx context.Context, bucket, path string, uploadID string) (err error)
 	AddMultipartPart(ctx context.Context, bucket, path, contractSet, ETag, uploadID string, partNumber int, slices []object.SlabSlice, partialSlabs []object.PartialSlab, usedContracts map[types.PublicKey]types.FileContractID) (err error)
+	CompleteMultipartUpload(ctx context.Context, bucket, path, uploadID string, parts []api.MultipartCompletedPart) (resp api.MultipartCompleteResponse, err error)
+	CreateMultipartUpload(ctx context.Context, bucket, path string, opts api.CreateMultipartOptions) (resp api.MultipartCreateResponse, err error)
 	MultipartUpload(ctx context.Context, uploadID string) (resp api.MultipartUpload, err error)
 
 	AddPartialSlab(ctx context.Context, data []byte, minShards, totalShards uint8, contractSet string) (slabs []object.PartialSlab, slabBufferMaxSizeSoftReached bool, err error)
@@ -215,17 +252,26 @@ type hostV2 interface {
 type hostV3 interface {
 	hostV2
 
+	DeleteSectors(ctx context.Context, roots []types.Hash256, indices []uint64, rev types.FileContractRevision) error
 	DownloadSector(ctx context.Context, w io.Writer, root types.Hash256, offset, length uint32) error
 	FetchPriceTable(ctx context.Context, rev *types.FileContractRevision) (hpt hostdb.HostPriceTable, err error)
 	FetchRevision(ctx context.Context, fetchTimeout time.Duration, blockHeight uint64) (types.FileContractRevision, error)
 	FundAccount(ctx context.Context, balance types.Currency, rev *types.FileContractRevision) error
 	Renew(ctx context.Context, rrr api.RHPRenewRequest) (_ rhpv2.ContractRevision, _ []types.Transaction, err error)
 	SyncAccount(ctx context.Context, rev *types.FileContractRevision) error
-	UploadSector(ctx context.Context, sector *[rhpv2.SectorSize]byte, rev types.FileContractRevision) (types.Hash256, error)
+	UploadSector(ctx context.Context, sector *[rhpv2.SectorSize]byte, rev *types.FileContractRevision) (types.Hash256, error)
 }
 
 type hostProvider interface {
 	newHostV3(types.FileContractID, types.PublicKey, string) hostV3
+
+	// isDenied returns true if the host is temporarily not used because it
+	// misbehaved recently.
+	isDenied(types.PublicKey) bool
+
+	// trackHostError denies the host if the error indicates that it
+	// misbehaved.
+	trackHostError(types.PublicKey, error)
 }
 
 type partialSlabStore interface {
@@ -242,14 +288,39 @@ type worker struct {
 	masterKey       [32]byte
 	startTime       time.Time
 
+	downloadCache   *downloadCache
 	downloadManager *downloadManager
 	uploadManager   *uploadManager
+	uploadStager    *uploadStager
+
+	// verifyManager is a download manager without a sector cache that is
+	// used to verify objects, it doesn't share any state with the download
+	// manager so verifications can't be served from data that was cached
+	// by regular downloads.
+	verifyManager *downloadManager
+
+	// denyList holds the hosts that are temporarily not used because they
+	// misbehaved, it's shared by the upload and download managers.
+	denyList *hostDenyList
+
+	accounts        *accounts
+	consensus       *consensusSubscriber
+	accountRefiller *accountRefiller
+	priceTables     *priceTables
 
-	accounts    *accounts
-	priceTables *priceTables
+	hostMetricsRecorder *hostMetricsRecorder
+	packedSlabsUploader *packedSlabsUploader
+	scheduler           *jobScheduler
 
 	busFlushInterval time.Duration
 
+	// settingsVersion is the version of the bus' settings that were last
+	// fetched by the worker
+	settingsVersion atomic.Uint64
+
+	uploadIdleTimeout time.Duration
+	uploadMaxDuration time.Duration
+
 	uploadsMu            sync.Mutex
 	uploadingPackedSlabs map[string]bool
 
@@ -306,6 +377,7 @@ func (w *worker) newHostV3(contractID types.FileContractID, hostKey types.Public
 	return &host{
 		acc:                      w.accounts.ForHost(hostKey),
 		bus:                      w.bus,
+		cs:                       w.consensus,
 		contractSpendingRecorder: w.contractSpendingRecorder,
 		mr:                       &ephemeralMetricsRecorder{},
 		logger:                   w.logger.Named(hostKey.String()[:4]),
@@ -366,6 +438,13 @@ func (w *worker) rhpScanHandler(jc jape.Context) {
 		return
 	}
 
+	// wait for our turn
+	release := w.scheduleJob(ctx, jc, jobClassScan)
+	if release == nil {
+		return
+	}
+	defer release()
+
 	// scan host
 	var errStr string
 	settings, priceTable, elapsed, err := w.scanHost(ctx, rsr.HostKey, rsr.HostIP)
@@ -481,6 +560,128 @@ func (w *worker) rhpPriceTableHandler(jc jape.Context) {
 	})
 }
 
+func (w *worker) hostsPriceTablesHandlerPOST(jc jape.Context) {
+	var req api.FetchPriceTablesRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if len(req.HostKeys) > maxPriceTableFetchHosts {
+		jc.Error(fmt.Errorf("%w: %d > %d", api.ErrTooManyHostKeys, len(req.HostKeys), maxPriceTableFetchHosts), http.StatusBadRequest)
+		return
+	}
+
+	timeout := time.Duration(req.Timeout)
+	if timeout == 0 {
+		timeout = defaultPriceTableFetchTimeout
+	}
+	jc.Encode(w.fetchPriceTables(jc.Request.Context(), req.HostKeys, timeout))
+}
+
+// fetchPriceTables fetches the price tables of the given hosts in parallel
+// without paying for them. The results are returned in the order of the given
+// host keys.
+func (w *worker) fetchPriceTables(ctx context.Context, hks []types.PublicKey, timeout time.Duration) []api.HostPriceTableResult {
+	results := make([]api.HostPriceTableResult, len(hks))
+	fetch := func(hk types.PublicKey) (*hostdb.HostPriceTable, time.Duration, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		host, err := w.bus.Host(ctx, hk)
+		if err != nil {
+			return nil, 0, fmt.Errorf("couldn't fetch host from bus: %w", err)
+		}
+
+		start := time.Now()
+		var pt rhpv3.HostPriceTable
+		err = w.transportPoolV3.withTransportV3(ctx, hk, host.Settings.SiamuxAddr(), func(ctx context.Context, t *transportV3) (err error) {
+			pt, err = RPCPriceTable(ctx, t, func(pt rhpv3.HostPriceTable) (rhpv3.PaymentMethod, error) { return nil, nil })
+			return
+		})
+		if err != nil {
+			return nil, time.Since(start), err
+		}
+		return &hostdb.HostPriceTable{
+			HostPriceTable: pt,
+			Expiry:         time.Now().Add(pt.Validity),
+		}, time.Since(start), nil
+	}
+
+	// fetch the price tables in parallel
+	reqs := make(chan int)
+	var wg sync.WaitGroup
+	for t := 0; t < priceTableFetchThreads && t < len(hks); t++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range reqs {
+				pt, latency, err := fetch(hks[i])
+				results[i] = api.HostPriceTableResult{
+					HostKey:    hks[i],
+					PriceTable: pt,
+					Latency:    api.DurationMS(latency),
+				}
+				if err != nil {
+					results[i].Error = err.Error()
+				}
+			}
+		}()
+	}
+	for i := range hks {
+		reqs <- i
+	}
+	close(reqs)
+	wg.Wait()
+	return results
+}
+
+func (w *worker) hostGougingHandlerGET(jc jape.Context) {
+	ctx := jc.Request.Context()
+	var hk types.PublicKey
+	if jc.DecodeParam("hostkey", &hk) != nil {
+		return
+	}
+
+	// fetch the host and the gouging parameters
+	host, err := w.bus.Host(ctx, hk)
+	if jc.Check("couldn't fetch host from bus", err) != nil {
+		return
+	}
+	gp, err := w.gougingParams(ctx)
+	if jc.Check("couldn't fetch gouging parameters from bus", err) != nil {
+		return
+	}
+
+	// fetch the host's live price table, we don't pay for it since we only
+	// need it to compare its prices to the gouging settings
+	var pt rhpv3.HostPriceTable
+	if jc.Check("could not get price table", w.transportPoolV3.withTransportV3(ctx, hk, host.Settings.SiamuxAddr(), func(ctx context.Context, t *transportV3) (err error) {
+		pt, err = RPCPriceTable(ctx, t, func(pt rhpv3.HostPriceTable) (rhpv3.PaymentMethod, error) { return nil, nil })
+		return
+	})) != nil {
+		return
+	}
+
+	// check the host, the settings are only checked if the host was scanned
+	// since we don't fetch them from the host
+	var hs *rhpv2.HostSettings
+	if host.Scanned {
+		hs = &host.Settings
+	}
+	gc := gougingChecker{
+		consensusState: gp.ConsensusState,
+		settings:       gp.GougingSettings,
+		txFee:          gp.TransactionFee,
+	}
+	breakdown := gc.Check(hs, &pt)
+
+	jc.Encode(api.HostGougingResponse{
+		HostKey:    hk,
+		PriceTable: pt,
+		Fields:     explainPriceGougingPT(gp.GougingSettings, gp.ConsensusState, gp.TransactionFee, pt),
+		Breakdown:  breakdown,
+		Gouging:    breakdown.Gouging(),
+	})
+}
+
 func (w *worker) discardTxnOnErr(ctx context.Context, txn types.Transaction, errContext string, err *error) {
 	discardTxnOnErr(ctx, w.bus, w.logger, txn, errContext, err)
 }
@@ -502,7 +703,7 @@ func (w *worker) rhpFormHandler(jc jape.Context) {
 	ctx, cancel := context.WithTimeout(ctx, 15*time.Minute)
 	defer cancel()
 
-	gp, err := w.bus.GougingParams(ctx)
+	gp, err := w.gougingParams(ctx)
 	if jc.Check("could not get gouging parameters", err) != nil {
 		return
 	}
@@ -513,7 +714,7 @@ func (w *worker) rhpFormHandler(jc jape.Context) {
 
 	var contract rhpv2.ContractRevision
 	var txnSet []types.Transaction
-	ctx = WithGougingChecker(ctx, w.bus, gp)
+	ctx = WithGougingChecker(ctx, w.consensus, gp)
 	err = w.withTransportV2(ctx, rfr.HostKey, hostIP, func(t *rhpv2.Transport) (err error) {
 		hostSettings, err := RPCSettings(ctx, t)
 		if err != nil {
@@ -635,15 +836,15 @@ func (w *worker) rhpPruneContractHandlerPOST(jc jape.Context) {
 	}
 
 	// attach gouging checker
-	gp, err := w.bus.GougingParams(ctx)
+	gp, err := w.gougingParams(ctx)
 	if jc.Check("could not get gouging parameters", err) != nil {
 		return
 	}
-	ctx = WithGougingChecker(ctx, w.bus, gp)
+	ctx = WithGougingChecker(ctx, w.consensus, gp)
 
 	// fetch the contract from the bus
 	contract, err := w.bus.Contract(ctx, fcid)
-	if errors.Is(err, api.ErrContractNotFound) {
+	if errors.Is(api.ParseError(err), api.ErrContractNotFound) {
 		jc.Error(err, http.StatusNotFound)
 		return
 	} else if jc.Check("couldn't fetch contract", err) != nil {
@@ -676,6 +877,106 @@ func (w *worker) rhpPruneContractHandlerPOST(jc jape.Context) {
 	}
 }
 
+func (w *worker) rhpDeleteSectorsHandlerPOST(jc jape.Context) {
+	ctx := jc.Request.Context()
+
+	// decode the request
+	var id types.FileContractID
+	var req api.RHPDeleteSectorsRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+
+	// fetch the upload params
+	up, err := w.uploadParams(ctx)
+	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
+		return
+	}
+
+	// attach gouging checker to the context
+	ctx = WithGougingChecker(ctx, w.consensus, up.GougingParams)
+
+	// fetch the contract from the bus
+	c, err := w.bus.Contract(ctx, id)
+	if errors.Is(api.ParseError(err), api.ErrContractNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't fetch contract", err) != nil {
+		return
+	}
+
+	// delete the sectors
+	deleted, skipped, err := w.DeleteContractSectors(ctx, c, up.CurrentHeight, req.Roots)
+	if jc.Check("couldn't delete sectors", err) == nil {
+		jc.Encode(api.RHPDeleteSectorsResponse{
+			Deleted: deleted,
+			Skipped: skipped,
+		})
+	}
+}
+
+// DeleteContractSectors deletes the sectors with the given roots from the
+// contract. Sectors that are still referenced by the bus, e.g. because the
+// same data was uploaded again, or that the host doesn't store are skipped.
+func (w *worker) DeleteContractSectors(ctx context.Context, c api.ContractMetadata, bh uint64, roots []types.Hash256) (deleted, skipped uint64, err error) {
+	err = w.withContractLock(ctx, c.ID, lockingPriorityPruning, func() error {
+		// fetch the roots from the host
+		got, err := w.FetchContractRoots(ctx, c.HostIP, c.HostKey, c.ID, c.RevisionNumber)
+		if err != nil {
+			return err
+		}
+
+		// fetch the roots from the bus
+		want, pending, err := w.bus.ContractRoots(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+
+		// collect the indices of the sectors we want to delete
+		indices := sectorDeletionIndices(got, append(want, pending...), roots)
+		skipped = uint64(len(roots) - len(indices))
+		if len(indices) == 0 {
+			return nil
+		}
+
+		// delete the sectors
+		h := w.newHostV3(c.ID, c.HostKey, c.SiamuxAddr)
+		rev, err := h.FetchRevision(ctx, defaultRevisionFetchTimeout, bh)
+		if err != nil {
+			return err
+		}
+		if err := h.DeleteSectors(ctx, got, indices, rev); err != nil {
+			return err
+		}
+		deleted = uint64(len(indices))
+		return nil
+	})
+	return
+}
+
+// sectorDeletionIndices returns the indices of the given roots in the roots of
+// a contract as reported by the host, roots that are still referenced or that
+// the host doesn't store are skipped.
+func sectorDeletionIndices(hostRoots, referenced, roots []types.Hash256) (indices []uint64) {
+	keep := make(map[types.Hash256]struct{})
+	for _, root := range referenced {
+		keep[root] = struct{}{}
+	}
+	toDelete := make(map[types.Hash256]struct{})
+	for _, root := range roots {
+		if _, wanted := keep[root]; !wanted {
+			toDelete[root] = struct{}{}
+		}
+	}
+	for i, root := range hostRoots {
+		if _, ok := toDelete[root]; ok {
+			delete(toDelete, root) // prevent duplicates
+			indices = append(indices, uint64(i))
+		}
+	}
+	return
+}
+
 func (w *worker) rhpContractRootsHandlerGET(jc jape.Context) {
 	// decode fcid
 	var id types.FileContractID
@@ -686,7 +987,7 @@ func (w *worker) rhpContractRootsHandlerGET(jc jape.Context) {
 	// fetch the contract from the bus
 	ctx := jc.Request.Context()
 	c, err := w.bus.Contract(ctx, id)
-	if errors.Is(err, api.ErrContractNotFound) {
+	if errors.Is(api.ParseError(err), api.ErrContractNotFound) {
 		jc.Error(err, http.StatusNotFound)
 		return
 	} else if jc.Check("couldn't fetch contract", err) != nil {
@@ -716,15 +1017,15 @@ func (w *worker) rhpRenewHandler(jc jape.Context) {
 	}
 
 	// attach gouging checker
-	gp, err := w.bus.GougingParams(ctx)
+	gp, err := w.gougingParams(ctx)
 	if jc.Check("could not get gouging parameters", err) != nil {
 		return
 	}
-	cs, err := w.bus.ConsensusState(ctx)
+	cs, err := w.consensus.ConsensusState(ctx)
 	if jc.Check("could not get consensus state", err) != nil {
 		return
 	}
-	ctx = WithGougingChecker(ctx, w.bus, gp)
+	ctx = WithGougingChecker(ctx, w.consensus, gp)
 
 	// renew the contract
 	var renewed rhpv2.ContractRevision
@@ -761,32 +1062,39 @@ func (w *worker) rhpFundHandler(jc jape.Context) {
 	}
 
 	// attach gouging checker
-	gp, err := w.bus.GougingParams(ctx)
+	gp, err := w.gougingParams(ctx)
 	if jc.Check("could not get gouging parameters", err) != nil {
 		return
 	}
-	ctx = WithGougingChecker(ctx, w.bus, gp)
+	ctx = WithGougingChecker(ctx, w.consensus, gp)
 
 	// fund the account
-	jc.Check("couldn't fund account", w.withRevision(ctx, defaultRevisionFetchTimeout, rfr.ContractID, rfr.HostKey, rfr.SiamuxAddr, lockingPriorityFunding, gp.ConsensusState.BlockHeight, func(rev types.FileContractRevision) (err error) {
-		h := w.newHostV3(rev.ParentID, rfr.HostKey, rfr.SiamuxAddr)
-		err = h.FundAccount(ctx, rfr.Balance, &rev)
+	jc.Check("couldn't fund account", w.fundAccount(ctx, rfr.ContractID, rfr.HostKey, rfr.SiamuxAddr, rfr.Balance, gp.ConsensusState.BlockHeight))
+}
+
+// fundAccount funds the worker's account with the given host up to the given
+// balance using the given contract. If the host reports the account's max
+// balance was exceeded, the account is synced before trying again.
+func (w *worker) fundAccount(ctx context.Context, fcid types.FileContractID, hk types.PublicKey, siamuxAddr string, balance types.Currency, bh uint64) error {
+	return w.withRevision(ctx, defaultRevisionFetchTimeout, fcid, hk, siamuxAddr, lockingPriorityFunding, bh, func(rev types.FileContractRevision) (err error) {
+		h := w.newHostV3(rev.ParentID, hk, siamuxAddr)
+		err = h.FundAccount(ctx, balance, &rev)
 		if isBalanceMaxExceeded(err) {
 			// sync the account
 			err = h.SyncAccount(ctx, &rev)
 			if err != nil {
-				w.logger.Debugf(fmt.Sprintf("failed to sync account: %v", err), "host", rfr.HostKey)
+				w.logger.Debugf(fmt.Sprintf("failed to sync account: %v", err), "host", hk)
 				return
 			}
 
 			// try funding the account again
-			err = h.FundAccount(ctx, rfr.Balance, &rev)
+			err = h.FundAccount(ctx, balance, &rev)
 			if err != nil {
-				w.logger.Errorw(fmt.Sprintf("failed to fund account after syncing: %v", err), "host", rfr.HostKey, "balance", rfr.Balance)
+				w.logger.Errorw(fmt.Sprintf("failed to fund account after syncing: %v", err), "host", hk, "balance", balance)
 			}
 		}
 		return
-	}))
+	})
 }
 
 func (w *worker) rhpRegistryReadHandler(jc jape.Context) {
@@ -833,13 +1141,13 @@ func (w *worker) rhpSyncHandler(jc jape.Context) {
 	}
 
 	// fetch gouging params
-	up, err := w.bus.UploadParams(ctx)
+	up, err := w.uploadParams(ctx)
 	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
 		return
 	}
 
 	// attach gouging checker to the context
-	ctx = WithGougingChecker(ctx, w.bus, up.GougingParams)
+	ctx = WithGougingChecker(ctx, w.consensus, up.GougingParams)
 
 	// sync the account
 	h := w.newHostV3(rsr.ContractID, rsr.HostKey, rsr.SiamuxAddr)
@@ -848,6 +1156,33 @@ func (w *worker) rhpSyncHandler(jc jape.Context) {
 	}))
 }
 
+func (w *worker) rhpPriceTablesRefreshHandler(jc jape.Context) {
+	ctx := jc.Request.Context()
+
+	// decode the request
+	var req api.RHPPriceTablesRefreshRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if len(req.HostKeys) > maxPriceTableFetchHosts {
+		jc.Error(fmt.Errorf("%w: %d > %d", api.ErrTooManyHostKeys, len(req.HostKeys), maxPriceTableFetchHosts), http.StatusBadRequest)
+		return
+	}
+
+	// attach gouging checker to the context
+	gp, err := w.gougingParams(ctx)
+	if jc.Check("couldn't fetch gouging parameters from bus", err) != nil {
+		return
+	}
+	ctx = WithGougingChecker(ctx, w.consensus, gp)
+
+	// renew the cached price tables that are no longer valid
+	refreshed := w.priceTables.renew(ctx, req.HostKeys, time.Now())
+	jc.Encode(api.RHPPriceTablesRefreshResponse{
+		Refreshed: refreshed,
+		Failed:    len(req.HostKeys) - refreshed,
+	})
+}
+
 func (w *worker) slabMigrateHandler(jc jape.Context) {
 	ctx := jc.Request.Context()
 
@@ -858,11 +1193,17 @@ func (w *worker) slabMigrateHandler(jc jape.Context) {
 	}
 
 	// fetch the upload parameters
-	up, err := w.bus.UploadParams(ctx)
+	up, err := w.uploadParams(ctx)
 	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
 		return
 	}
 
+	// reject the migration while the maintenance mode is active
+	if up.Maintenance.Active(time.Now()) {
+		jc.Error(api.ErrMaintenanceMode, http.StatusServiceUnavailable)
+		return
+	}
+
 	// NOTE: migrations do not use the default contract set but instead require
 	// the user to specify the contract set through the query string parameter,
 	// this to avoid accidentally migration to the default set if the autopilot
@@ -883,6 +1224,20 @@ func (w *worker) slabMigrateHandler(jc jape.Context) {
 		return
 	}
 
+	// apply the gouging overrides of the bucket the slab belongs to, the
+	// redundancy of a slab is fixed so the redundancy overrides don't apply
+	var bucket string
+	if jc.DecodeForm("bucket", &bucket) != nil {
+		return
+	} else if bucket != "" {
+		b, err := w.bus.Bucket(ctx, bucket)
+		if jc.Check("couldn't fetch bucket from bus", err) != nil {
+			return
+		} else if b.Policy.GougingOverrides != nil {
+			up.GougingSettings = b.Policy.GougingOverrides.Apply(up.GougingSettings)
+		}
+	}
+
 	// cancel the upload if consensus is not synced
 	if !up.ConsensusState.Synced {
 		w.logger.Errorf("migration cancelled, err: %v", api.ErrConsensusNotSynced)
@@ -891,7 +1246,7 @@ func (w *worker) slabMigrateHandler(jc jape.Context) {
 	}
 
 	// attach gouging checker to the context
-	ctx = WithGougingChecker(ctx, w.bus, up.GougingParams)
+	ctx = WithGougingChecker(ctx, w.consensus, up.GougingParams)
 
 	// fetch all contracts
 	dlContracts, err := w.bus.Contracts(ctx)
@@ -905,8 +1260,32 @@ func (w *worker) slabMigrateHandler(jc jape.Context) {
 		return
 	}
 
+	// when evicting a host, its shards are migrated to hosts that store less
+	// data than it does, this is used to rebalance the data across the set
+	var evict types.PublicKey
+	if jc.DecodeForm("evict", &evict) != nil {
+		return
+	} else if evict != (types.PublicKey{}) {
+		var filtered []api.ContractMetadata
+		for _, c := range ulContracts {
+			if c.HostKey != evict {
+				filtered = append(filtered, c)
+			} else if up.RedundancySettings.MaxHostStorage == 0 || c.Size < up.RedundancySettings.MaxHostStorage {
+				up.RedundancySettings.MaxHostStorage = c.Size
+			}
+		}
+		ulContracts = filtered
+	}
+
+	// wait for our turn, migrations yield to user-facing jobs
+	release := w.scheduleJob(ctx, jc, jobClassMigration)
+	if release == nil {
+		return
+	}
+	defer release()
+
 	// migrate the slab
-	used, numShardsMigrated, err := migrateSlab(ctx, w.downloadManager, w.uploadManager, &slab, dlContracts, ulContracts, up.CurrentHeight, w.logger)
+	used, numShardsMigrated, err := migrateSlab(ctx, w.downloadManager, w.uploadManager, &slab, up.RedundancySettings, dlContracts, ulContracts, up.CurrentHeight, w.logger)
 	if jc.Check("couldn't migrate slabs", err) != nil {
 		return
 	}
@@ -919,6 +1298,87 @@ func (w *worker) slabMigrateHandler(jc jape.Context) {
 	jc.Encode(api.MigrateSlabResponse{NumShardsMigrated: numShardsMigrated})
 }
 
+func (w *worker) slabUploadHandler(jc jape.Context) {
+	ctx := jc.Request.Context()
+
+	// fetch the upload parameters
+	up, err := w.uploadParams(ctx)
+	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
+		return
+	}
+
+	// reject the upload while the maintenance mode is active
+	if up.Maintenance.Active(time.Now()) {
+		jc.Error(api.ErrMaintenanceMode, http.StatusServiceUnavailable)
+		return
+	}
+
+	// decode the contract set from the query string
+	var contractset string
+	if jc.DecodeForm("contractset", &contractset) != nil {
+		return
+	} else if contractset != "" {
+		up.ContractSet = contractset
+	}
+
+	// apply the bucket's gouging overrides
+	var bucket string
+	if jc.DecodeForm("bucket", &bucket) != nil {
+		return
+	} else if bucket != "" {
+		b, err := w.bus.Bucket(ctx, bucket)
+		if jc.Check("couldn't fetch bucket from bus", err) != nil {
+			return
+		}
+		up.GougingParams = b.Policy.Apply(up.GougingParams)
+	}
+
+	// cancel the upload if no contract set is specified
+	if up.ContractSet == "" {
+		jc.Error(api.ErrContractSetNotSpecified, http.StatusBadRequest)
+		return
+	}
+
+	// cancel the upload if consensus is not synced
+	if !up.ConsensusState.Synced {
+		w.logger.Errorf("upload cancelled, err: %v", api.ErrConsensusNotSynced)
+		jc.Error(api.ErrConsensusNotSynced, http.StatusServiceUnavailable)
+		return
+	}
+
+	// allow overriding the redundancy settings
+	rs := up.RedundancySettings
+	if jc.DecodeForm("minshards", &rs.MinShards) != nil {
+		return
+	}
+	if jc.DecodeForm("totalshards", &rs.TotalShards) != nil {
+		return
+	}
+	if jc.Check("invalid redundancy settings", rs.Validate()) != nil {
+		return
+	}
+
+	// the sectors are added to the coordinator's upload if given
+	var uploadID api.UploadID
+	if jc.DecodeForm("uploadid", &uploadID) != nil {
+		return
+	}
+
+	// attach gouging checker to the context
+	ctx = WithGougingChecker(ctx, w.consensus, up.GougingParams)
+
+	// upload the slab
+	slab, used, err := w.uploadManager.UploadSlab(ctx, jc.Request.Body, rs, up.ContractSet, uploadID, up.CurrentHeight, lockingPriorityUpload)
+	if err != nil {
+		jc.Error(fmt.Errorf("couldn't upload slab: %w", err), uploadErrorStatus(err))
+		return
+	}
+	jc.Encode(api.UploadSlabResponse{
+		Slab:          slab,
+		UsedContracts: used,
+	})
+}
+
 func (w *worker) downloadsStatsHandlerGET(jc jape.Context) {
 	stats := w.downloadManager.Stats()
 
@@ -933,6 +1393,8 @@ func (w *worker) downloadsStatsHandlerGET(jc jape.Context) {
 			HostKey:                    hk,
 			AvgSectorDownloadSpeedMBPS: stat.avgSpeedMBPS,
 			NumDownloads:               stat.numDownloads,
+			NumFallbacks:               stat.numFallbacks,
+			QueueLength:                stat.queueLength,
 		})
 	}
 	sort.SliceStable(dss, func(i, j int) bool {
@@ -946,6 +1408,7 @@ func (w *worker) downloadsStatsHandlerGET(jc jape.Context) {
 		HealthyDownloaders:   healthy,
 		NumDownloaders:       uint64(len(stats.downloaders)),
 		DownloadersStats:     dss,
+		SectorCache:          stats.sectorCache,
 	})
 }
 
@@ -958,6 +1421,8 @@ func (w *worker) uploadsStatsHandlerGET(jc jape.Context) {
 		uss = append(uss, api.UploaderStats{
 			HostKey:                  hk,
 			AvgSectorUploadSpeedMBPS: mbps,
+			QueueLength:              stats.queueLengths[hk],
+			MaxConcurrentSectors:     stats.sectorsPerHost[hk],
 		})
 	}
 	sort.SliceStable(uss, func(i, j int) bool {
@@ -971,9 +1436,25 @@ func (w *worker) uploadsStatsHandlerGET(jc jape.Context) {
 		HealthyUploaders:       stats.healthyUploaders,
 		NumUploaders:           stats.numUploaders,
 		UploadersStats:         uss,
+
+		AutoTuned:                   stats.autoTuned,
+		MaxOverdrive:                stats.maxOverdrive,
+		MaxConcurrentSectorsPerHost: stats.maxSectorsPerHost,
+
+		Pipeline: stats.pipeline,
 	})
 }
 
+// downloadContracts returns the contracts to download from. Downloads use all
+// contracts by default since data might still be stored on contracts that were
+// removed from the set, passing a set restricts them to the contracts in it.
+func (w *worker) downloadContracts(ctx context.Context, set string) ([]api.ContractMetadata, error) {
+	if set == "" {
+		return w.bus.Contracts(ctx)
+	}
+	return w.bus.ContractSetContracts(ctx, set)
+}
+
 func (w *worker) objectsHandlerGET(jc jape.Context) {
 	ctx := jc.Request.Context()
 	jc.Custom(nil, []api.ObjectMetadata{})
@@ -1006,9 +1487,21 @@ func (w *worker) objectsHandlerGET(jc jape.Context) {
 		Limit:  limit,
 	}
 
+	var cost, costBreakdown bool
+	if jc.DecodeForm("cost", &cost) != nil {
+		return
+	}
+	if jc.DecodeForm("costbreakdown", &costBreakdown) != nil {
+		return
+	}
+	var contractset string
+	if jc.DecodeForm("contractset", &contractset) != nil {
+		return
+	}
+
 	path := jc.PathParam("path")
 	res, err := w.bus.Object(ctx, bucket, path, opts)
-	if err != nil && strings.Contains(err.Error(), api.ErrObjectNotFound.Error()) {
+	if err != nil && errors.Is(api.ParseError(err), api.ErrObjectNotFound) {
 		jc.Error(err, http.StatusNotFound)
 		return
 	} else if jc.Check("couldn't get object or entries", err) != nil {
@@ -1021,30 +1514,50 @@ func (w *worker) objectsHandlerGET(jc jape.Context) {
 
 	// return early if the object is empty
 	if len(res.Object.Slabs) == 0 && len(res.Object.PartialSlabs) == 0 {
+		serveMetadata(jc.ResponseWriter, jc.Request, *res.Object)
 		return
 	}
 
+	// wait for our turn
+	release := w.scheduleJob(ctx, jc, jobClassDownload)
+	if release == nil {
+		return
+	}
+	defer release()
+
 	// fetch gouging params
-	gp, err := w.bus.GougingParams(ctx)
+	gp, err := w.gougingParams(ctx)
 	if jc.Check("couldn't fetch gouging parameters from bus", err) != nil {
 		return
 	}
 
-	// fetch all contracts
-	contracts, err := w.bus.Contracts(ctx)
-	if err != nil {
+	// fetch the contracts to download from
+	contracts, err := w.downloadContracts(ctx, contractset)
+	if err != nil && errors.Is(api.ParseError(err), api.ErrContractSetNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if err != nil {
 		jc.Error(err, http.StatusInternalServerError)
 		return
 	}
 
+	// keep track of the cost of the download if requested, since the cost is
+	// only known once all data was sent it's returned as a trailer
+	rw := jc.ResponseWriter
+	var rc *requestCost
+	if cost || costBreakdown {
+		ctx, rc = withRequestCost(ctx)
+		rw = newTrailerWriter(rw, api.ObjectCostHeader, api.ObjectCostBreakdownHeader)
+		defer rc.writeHeaders(rw.Header(), costBreakdown)
+	}
+
 	// create a download function
 	downloadFn := func(wr io.Writer, offset, length int64) error {
-		ctx = WithGougingChecker(ctx, w.bus, gp)
-		return w.downloadManager.DownloadObject(ctx, wr, res.Object.Object, uint64(offset), uint64(length), contracts)
+		return w.DownloadObject(WithGougingChecker(ctx, w.consensus, gp), wr, bucket, path, *res.Object, offset, length, contracts)
 	}
 
 	// serve the content
-	status, err := serveContent(jc.ResponseWriter, jc.Request, *res.Object, downloadFn)
+	status, err := serveContent(rw, jc.Request, *res.Object, downloadFn)
 	if errors.Is(err, http_range.ErrInvalid) || errors.Is(err, errMultiRangeNotSupported) {
 		jc.Error(err, http.StatusBadRequest)
 	} else if errors.Is(err, http_range.ErrNoOverlap) {
@@ -1054,16 +1567,83 @@ func (w *worker) objectsHandlerGET(jc jape.Context) {
 	}
 }
 
+func (w *worker) objectsVerifyHandlerPOST(jc jape.Context) {
+	ctx := jc.Request.Context()
+	var req api.VerifyObjectRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if req.Bucket == "" {
+		req.Bucket = api.DefaultBucketName
+	}
+
+	res, err := w.bus.Object(ctx, req.Bucket, req.Path, api.GetObjectOptions{})
+	if err != nil && errors.Is(api.ParseError(err), api.ErrObjectNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't get object", err) != nil {
+		return
+	} else if res.Object == nil {
+		jc.Error(errors.New("can't verify a directory"), http.StatusBadRequest)
+		return
+	}
+
+	// fetch gouging params
+	gp, err := w.gougingParams(ctx)
+	if jc.Check("couldn't fetch gouging parameters from bus", err) != nil {
+		return
+	}
+
+	// fetch all contracts
+	contracts, err := w.bus.Contracts(ctx)
+	if jc.Check("couldn't fetch contracts from bus", err) != nil {
+		return
+	}
+
+	resp, err := w.VerifyObject(WithGougingChecker(ctx, w.consensus, gp), *res.Object, contracts)
+	if jc.Check("couldn't verify object", err) != nil {
+		return
+	}
+	jc.Encode(resp)
+}
+
+func (w *worker) objectsHandlerHEAD(jc jape.Context) {
+	bucket := api.DefaultBucketName
+	if jc.DecodeForm("bucket", &bucket) != nil {
+		return
+	}
+
+	path := jc.PathParam("path")
+	if path == "" || strings.HasSuffix(path, "/") {
+		jc.Error(errors.New("HEAD requests are not supported on directories"), http.StatusBadRequest)
+		return
+	}
+
+	res, err := w.bus.Object(jc.Request.Context(), bucket, path, api.GetObjectOptions{OnlyMetadata: true})
+	if err != nil && errors.Is(api.ParseError(err), api.ErrObjectNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't get object", err) != nil {
+		return
+	}
+	serveMetadata(jc.ResponseWriter, jc.Request, *res.Object)
+}
+
 func (w *worker) objectsHandlerPUT(jc jape.Context) {
 	jc.Custom((*[]byte)(nil), nil)
 	ctx := jc.Request.Context()
 
 	// fetch the upload parameters
-	up, err := w.bus.UploadParams(ctx)
+	up, err := w.uploadParams(ctx)
 	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
 		return
 	}
 
+	// reject the upload while the maintenance mode is active
+	if up.Maintenance.Active(time.Now()) {
+		jc.Error(api.ErrMaintenanceMode, http.StatusServiceUnavailable)
+		return
+	}
+
 	// decode the contract set from the query string
 	var contractset string
 	if jc.DecodeForm("contractset", &contractset) != nil {
@@ -1076,6 +1656,15 @@ func (w *worker) objectsHandlerPUT(jc jape.Context) {
 	var mimeType string
 	if jc.DecodeForm("mimetype", &mimeType) != nil {
 		return
+	} else if mimeType == "" {
+		mimeType = requestMimeType(jc.Request)
+	}
+
+	// extract the user metadata from the headers
+	metadata := api.ObjectUserMetadataFromHeaders(jc.Request.Header)
+	if err := metadata.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
 	}
 
 	// decode the bucket from the query string
@@ -1085,20 +1674,35 @@ func (w *worker) objectsHandlerPUT(jc jape.Context) {
 	}
 
 	// return early if the bucket does not exist
-	_, err = w.bus.Bucket(ctx, bucket)
-	if err != nil && strings.Contains(err.Error(), api.ErrBucketNotFound.Error()) {
+	b, err := w.bus.Bucket(ctx, bucket)
+	if err != nil && errors.Is(api.ParseError(err), api.ErrBucketNotFound) {
 		jc.Error(fmt.Errorf("bucket '%s' not found; %w", bucket, err), http.StatusNotFound)
 		return
+	} else if jc.Check("couldn't fetch bucket from bus", err) != nil {
+		return
 	}
 
+	// apply the bucket's redundancy and gouging overrides
+	up.GougingParams = b.Policy.Apply(up.GougingParams)
+
 	// cancel the upload if no contract set is specified
 	if up.ContractSet == "" {
 		jc.Error(api.ErrContractSetNotSpecified, http.StatusBadRequest)
 		return
 	}
 
-	// cancel the upload if consensus is not synced
-	if !up.ConsensusState.Synced {
+	// decode whether the upload should be staged
+	var staged bool
+	if jc.DecodeForm("staged", &staged) != nil {
+		return
+	} else if staged && w.uploadStager == nil {
+		jc.Error(api.ErrUploadStagingDisabled, http.StatusBadRequest)
+		return
+	}
+
+	// cancel the upload if consensus is not synced, staged uploads are
+	// uploaded once it is
+	if !up.ConsensusState.Synced && !staged {
 		w.logger.Errorf("upload cancelled, err: %v", api.ErrConsensusNotSynced)
 		jc.Error(api.ErrConsensusNotSynced, http.StatusServiceUnavailable)
 		return
@@ -1120,22 +1724,175 @@ func (w *worker) objectsHandlerPUT(jc jape.Context) {
 	opts := []UploadOption{
 		WithBlockHeight(up.CurrentHeight),
 		WithContractSet(up.ContractSet),
+		WithCustomMetadata(metadata),
 		WithMimeType(mimeType),
 		WithPacking(up.UploadPacking),
-		WithRedundancySettings(up.RedundancySettings),
+		WithRedundancySettings(rs),
+		WithVerification(verifyUploadTrailer(jc.Request)),
+		WithCheckpoint(bucket, jc.PathParam("path")),
+	}
+
+	// decode whether the client wants a per-host breakdown of the cost
+	var costBreakdown bool
+	if jc.DecodeForm("costbreakdown", &costBreakdown) != nil {
+		return
+	}
+
+	// decode whether the upload should be started regardless of the funds
+	var force bool
+	if jc.DecodeForm("force", &force) != nil {
+		return
 	}
 
 	// attach gouging checker to the context
-	ctx = WithGougingChecker(ctx, w.bus, up.GougingParams)
+	ctx = WithGougingChecker(ctx, w.consensus, up.GougingParams)
+
+	// keep track of the cost of the upload
+	ctx, rc := withRequestCost(ctx)
+
+	// enforce the bucket's upload limits
+	body, err := w.limitUpload(b, jc.Request.ContentLength, jc.Request.Body)
+	if err != nil {
+		jc.Error(err, uploadErrorStatus(err))
+		return
+	}
+
+	// stage the upload and acknowledge it, the data is uploaded to the hosts
+	// in the background
+	if staged {
+		_, r, cancel := w.uploadStream(ctx, jc.ResponseWriter, body)
+		defer cancel()
+		su, err := w.uploadStager.Stage(r, stagedUpload{
+			StagedUpload: api.StagedUpload{Bucket: bucket, Path: jc.PathParam("path")},
+			ContractSet:  contractset,
+			MimeType:     mimeType,
+			Metadata:     metadata,
+			MinShards:    rs.MinShards,
+			TotalShards:  rs.TotalShards,
+		})
+		if err != nil {
+			jc.Error(fmt.Errorf("couldn't stage upload: %w", err), uploadErrorStatus(err))
+			return
+		}
+		jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+		jc.ResponseWriter.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(jc.ResponseWriter).Encode(su)
+		return
+	}
+
+	// fail fast if the upload is projected to exhaust the contract funds
+	// before it completes, unless the client forces it
+	if err := w.checkUploadFunds(ctx, up.ContractSet, rs, jc.Request.ContentLength, up.UploadPacking); errors.Is(err, api.ErrUploadFundsExhausted) && !force {
+		jc.Error(err, uploadErrorStatus(err))
+		return
+	} else if err != nil {
+		w.logger.Warnf("upload of '%v' might not complete, err: %v", jc.PathParam("path"), err)
+	}
+
+	// wait for our turn
+	release := w.scheduleJob(ctx, jc, jobClassUpload)
+	if release == nil {
+		return
+	}
+	defer release()
+
+	// protect the upload against slow producers
+	ctx, r, cancel := w.uploadStream(ctx, jc.ResponseWriter, body)
+	defer cancel()
 
 	// upload the object
-	eTag, err := w.upload(ctx, jc.Request.Body, bucket, jc.PathParam("path"), opts...)
-	if jc.Check("couldn't upload object", err) != nil {
+	eTag, err := w.upload(ctx, r, bucket, jc.PathParam("path"), opts...)
+	if err != nil {
+		writeUploadError(jc, fmt.Errorf("couldn't upload object: %w", err))
 		return
 	}
 
-	// set etag header
+	// uploads that were staged to the same path are outdated
+	if w.uploadStager != nil {
+		w.uploadStager.Supersede(bucket, jc.PathParam("path"))
+	}
+
+	// invalidate cached ranges of the overwritten object
+	if w.downloadCache != nil {
+		w.downloadCache.Invalidate(bucket, jc.PathParam("path"))
+	}
+
+	// set etag and cost headers
 	jc.ResponseWriter.Header().Set("ETag", api.FormatETag(eTag))
+	rc.writeHeaders(jc.ResponseWriter.Header(), costBreakdown)
+}
+
+func (w *worker) uploadsStagedHandlerGET(jc jape.Context) {
+	if w.uploadStager == nil {
+		jc.Encode([]api.StagedUpload{})
+		return
+	}
+	jc.Encode(w.uploadStager.Uploads())
+}
+
+func (w *worker) multipartCreateHandlerPOST(jc jape.Context) {
+	var req api.MultipartCreateRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	if req.Bucket == "" {
+		req.Bucket = api.DefaultBucketName
+	}
+	if err := req.Metadata.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	// parts are encrypted by the worker unless the client provides a key,
+	// clients that encrypt their data themselves should pass the no-op key
+	key := req.Key
+	if key == (object.EncryptionKey{}) {
+		key = object.GenerateEncryptionKey()
+	}
+
+	resp, err := w.bus.CreateMultipartUpload(jc.Request.Context(), req.Bucket, req.Path, api.CreateMultipartOptions{
+		Key:      key,
+		MimeType: req.MimeType,
+		Metadata: req.Metadata,
+	})
+	if jc.Check("couldn't create multipart upload", err) != nil {
+		return
+	}
+	jc.Encode(resp)
+}
+
+func (w *worker) multipartAbortHandlerPOST(jc jape.Context) {
+	var req api.MultipartAbortRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	if req.Bucket == "" {
+		req.Bucket = api.DefaultBucketName
+	}
+	err := w.bus.AbortMultipartUpload(jc.Request.Context(), req.Bucket, req.Path, req.UploadID)
+	if jc.Check("couldn't abort multipart upload", err) != nil {
+		return
+	}
+}
+
+func (w *worker) multipartCompleteHandlerPOST(jc jape.Context) {
+	var req api.MultipartCompleteRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	if req.Bucket == "" {
+		req.Bucket = api.DefaultBucketName
+	}
+	resp, err := w.bus.CompleteMultipartUpload(jc.Request.Context(), req.Bucket, req.Path, req.UploadID, req.Parts)
+	if jc.Check("couldn't complete multipart upload", err) != nil {
+		return
+	}
+
+	// invalidate cached ranges of the overwritten object
+	if w.downloadCache != nil {
+		w.downloadCache.Invalidate(req.Bucket, req.Path)
+	}
+	jc.Encode(resp)
 }
 
 func (w *worker) multipartUploadHandlerPUT(jc jape.Context) {
@@ -1143,11 +1900,17 @@ func (w *worker) multipartUploadHandlerPUT(jc jape.Context) {
 	ctx := jc.Request.Context()
 
 	// fetch the upload parameters
-	up, err := w.bus.UploadParams(ctx)
+	up, err := w.uploadParams(ctx)
 	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
 		return
 	}
 
+	// reject the upload while the maintenance mode is active
+	if up.Maintenance.Active(time.Now()) {
+		jc.Error(api.ErrMaintenanceMode, http.StatusServiceUnavailable)
+		return
+	}
+
 	// cancel the upload if no contract set is specified
 	if up.ContractSet == "" {
 		jc.Error(api.ErrContractSetNotSpecified, http.StatusBadRequest)
@@ -1176,12 +1939,17 @@ func (w *worker) multipartUploadHandlerPUT(jc jape.Context) {
 	}
 
 	// return early if the bucket does not exist
-	_, err = w.bus.Bucket(ctx, bucket)
-	if err != nil && strings.Contains(err.Error(), api.ErrBucketNotFound.Error()) {
+	b, err := w.bus.Bucket(ctx, bucket)
+	if err != nil && errors.Is(api.ParseError(err), api.ErrBucketNotFound) {
 		jc.Error(fmt.Errorf("bucket '%s' not found; %w", bucket, err), http.StatusNotFound)
 		return
+	} else if jc.Check("couldn't fetch bucket from bus", err) != nil {
+		return
 	}
 
+	// apply the bucket's redundancy and gouging overrides
+	up.GougingParams = b.Policy.Apply(up.GougingParams)
+
 	// decode the upload id
 	var uploadID string
 	if jc.DecodeForm("uploadid", &uploadID) != nil {
@@ -1231,7 +1999,8 @@ func (w *worker) multipartUploadHandlerPUT(jc jape.Context) {
 		WithBlockHeight(up.CurrentHeight),
 		WithContractSet(up.ContractSet),
 		WithPacking(up.UploadPacking),
-		WithRedundancySettings(up.RedundancySettings),
+		WithRedundancySettings(rs),
+		WithVerification(verifyUploadTrailer(jc.Request)),
 	}
 	if disablePreshardingEncryption {
 		opts = append(opts, WithCustomKey(object.NoOpKey))
@@ -1245,17 +2014,156 @@ func (w *worker) multipartUploadHandlerPUT(jc jape.Context) {
 		opts = append(opts, WithCustomKey(upload.Key))
 	}
 
+	// decode whether the client wants a per-host breakdown of the cost
+	var costBreakdown bool
+	if jc.DecodeForm("costbreakdown", &costBreakdown) != nil {
+		return
+	}
+
+	// decode whether the upload should be started regardless of the funds
+	var force bool
+	if jc.DecodeForm("force", &force) != nil {
+		return
+	}
+
 	// attach gouging checker to the context
-	ctx = WithGougingChecker(ctx, w.bus, up.GougingParams)
+	ctx = WithGougingChecker(ctx, w.consensus, up.GougingParams)
+
+	// keep track of the cost of the upload
+	ctx, rc := withRequestCost(ctx)
+
+	// enforce the bucket's upload limits
+	body, err := w.limitUpload(b, jc.Request.ContentLength, jc.Request.Body)
+	if err != nil {
+		jc.Error(err, uploadErrorStatus(err))
+		return
+	}
+
+	// fail fast if the upload is projected to exhaust the contract funds
+	// before it completes, unless the client forces it
+	if err := w.checkUploadFunds(ctx, up.ContractSet, rs, jc.Request.ContentLength, up.UploadPacking); errors.Is(err, api.ErrUploadFundsExhausted) && !force {
+		jc.Error(err, uploadErrorStatus(err))
+		return
+	} else if err != nil {
+		w.logger.Warnf("upload of '%v' might not complete, err: %v", jc.PathParam("path"), err)
+	}
+
+	// wait for our turn
+	release := w.scheduleJob(ctx, jc, jobClassUpload)
+	if release == nil {
+		return
+	}
+	defer release()
+
+	// protect the upload against slow producers
+	ctx, r, cancel := w.uploadStream(ctx, jc.ResponseWriter, body)
+	defer cancel()
 
 	// upload the multipart
-	eTag, err := w.uploadMultiPart(ctx, jc.Request.Body, bucket, jc.PathParam("path"), uploadID, partNumber, opts...)
-	if jc.Check("couldn't upload object", err) != nil {
+	eTag, err := w.uploadMultiPart(ctx, r, bucket, jc.PathParam("path"), uploadID, partNumber, opts...)
+	if err != nil {
+		writeUploadError(jc, fmt.Errorf("couldn't upload object: %w", err))
 		return
 	}
 
-	// set etag header
+	// set etag and cost headers
 	jc.ResponseWriter.Header().Set("ETag", api.FormatETag(eTag))
+	rc.writeHeaders(jc.ResponseWriter.Header(), costBreakdown)
+}
+
+// uploadStream applies the worker's maximum upload duration to the given
+// context and wraps the body in a reader that fails if the producer stalls for
+// longer than the upload idle timeout.
+func (w *worker) uploadStream(ctx context.Context, rw http.ResponseWriter, body io.Reader) (context.Context, io.Reader, context.CancelFunc) {
+	if w.uploadIdleTimeout == 0 && w.uploadMaxDuration == 0 {
+		return ctx, body, func() {}
+	}
+	var cancel context.CancelFunc
+	if w.uploadMaxDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, w.uploadMaxDuration)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	r := newIdleTimeoutReader(ctx, body, w.uploadIdleTimeout, http.NewResponseController(rw).SetReadDeadline, cancel)
+	return ctx, r, func() {
+		r.Close()
+		cancel()
+	}
+}
+
+// limitUpload wraps the given reader in a reader that fails once the upload
+// exceeds the bucket's max object size. The bucket's max stored bytes are
+// enforced by the bus when the object is added, that way concurrent uploads
+// can't exceed it.
+func (w *worker) limitUpload(b api.Bucket, size int64, r io.Reader) (io.Reader, error) {
+	limit := b.Policy.MaxObjectSize
+	if limit == 0 {
+		return r, nil
+	}
+
+	// fail early if the client told us the size of the upload
+	if size > 0 && uint64(size) > limit {
+		return nil, fmt.Errorf("%w: upload of %d bytes exceeds the limit of %d bytes", api.ErrObjectTooLarge, size, limit)
+	}
+	return &limitReader{
+		r:   r,
+		n:   int64(limit),
+		err: fmt.Errorf("%w: upload exceeds the limit of %d bytes", api.ErrObjectTooLarge, limit),
+	}, nil
+}
+
+// uploadErrorStatus returns the HTTP status code for the given upload error.
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, api.ErrObjectTrailerMismatch):
+		return http.StatusBadRequest
+	case errors.Is(err, errUploadIdleTimeout), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusRequestTimeout
+	case errors.Is(err, api.ErrObjectTooLarge), errors.Is(api.ParseError(err), api.ErrBucketQuotaExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, api.ErrUploadFundsExhausted):
+		return http.StatusPaymentRequired
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeUploadError writes the error of a failed upload. If the upload failed
+// because of errors returned by hosts, the response is a JSON encoded
+// api.UploadError that lists the failing hosts.
+func writeUploadError(jc jape.Context, err error) {
+	var hes HostErrorSet
+	if !errors.As(err, &hes) || len(hes) == 0 {
+		jc.Error(err, uploadErrorStatus(err))
+		return
+	}
+	jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+	jc.ResponseWriter.WriteHeader(uploadErrorStatus(err))
+	_ = json.NewEncoder(jc.ResponseWriter).Encode(api.UploadError{
+		Message: err.Error(),
+		Hosts:   hes.uploadHostErrors(),
+	})
+}
+
+// verifyUploadTrailer returns a function that verifies the size and checksum
+// of an upload against the object size and checksum trailers of the request.
+// Trailers are only available after the body was read in full, which allows
+// clients streaming data of unknown length to finalize the object afterwards.
+func verifyUploadTrailer(req *http.Request) func(int64, string) error {
+	return func(size int64, eTag string) error {
+		if s := req.Trailer.Get(api.ObjectTrailerSize); s != "" {
+			expected, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: invalid size '%s'", api.ErrObjectTrailerMismatch, s)
+			} else if expected != size {
+				return fmt.Errorf("%w: expected size %d, uploaded %d bytes", api.ErrObjectTrailerMismatch, expected, size)
+			}
+		}
+		if checksum := req.Trailer.Get(api.ObjectTrailerChecksum); checksum != "" && checksum != eTag {
+			return fmt.Errorf("%w: expected checksum %s, got %s", api.ErrObjectTrailerMismatch, checksum, eTag)
+		}
+		return nil
+	}
 }
 
 func encryptPartialSlab(data []byte, key object.EncryptionKey, minShards, totalShards uint8) [][]byte {
@@ -1279,12 +2187,23 @@ func (w *worker) objectsHandlerDELETE(jc jape.Context) {
 	if jc.DecodeForm("bucket", &bucket) != nil {
 		return
 	}
-	err := w.bus.DeleteObject(jc.Request.Context(), bucket, jc.PathParam("path"), api.DeleteObjectOptions{Batch: batch})
-	if err != nil && strings.Contains(err.Error(), api.ErrObjectNotFound.Error()) {
+	path := jc.PathParam("path")
+	err := w.bus.DeleteObject(jc.Request.Context(), bucket, path, api.DeleteObjectOptions{Batch: batch})
+	if err != nil && errors.Is(api.ParseError(err), api.ErrObjectNotFound) {
 		jc.Error(err, http.StatusNotFound)
 		return
+	} else if jc.Check("couldn't delete object", err) != nil {
+		return
+	}
+
+	// invalidate cached ranges of the deleted object(s)
+	if w.downloadCache != nil {
+		if batch {
+			w.downloadCache.InvalidatePrefix(bucket, path)
+		} else {
+			w.downloadCache.Invalidate(bucket, path)
+		}
 	}
-	jc.Check("couldn't delete object", err)
 }
 
 func (w *worker) rhpContractsHandlerGET(jc jape.Context) {
@@ -1303,11 +2222,11 @@ func (w *worker) rhpContractsHandlerGET(jc jape.Context) {
 		return
 	}
 
-	gp, err := w.bus.GougingParams(ctx)
+	gp, err := w.gougingParams(ctx)
 	if jc.Check("could not get gouging parameters", err) != nil {
 		return
 	}
-	ctx = WithGougingChecker(ctx, w.bus, gp)
+	ctx = WithGougingChecker(ctx, w.consensus, gp)
 
 	contracts, errs := w.fetchContracts(ctx, busContracts, hosttimeout, gp.ConsensusState.BlockHeight)
 	resp := api.ContractsResponse{Contracts: contracts}
@@ -1334,10 +2253,53 @@ func (w *worker) accountHandlerGET(jc jape.Context) {
 	jc.Encode(account)
 }
 
+// gougingParams fetches the gouging parameters from the bus and keeps track of
+// the version of the settings they were derived from.
+func (w *worker) gougingParams(ctx context.Context) (api.GougingParams, error) {
+	gp, err := w.bus.GougingParams(ctx)
+	if err == nil {
+		w.trackSettingsVersion(gp.SettingsVersion)
+		w.applyDownloadSettings(gp.DownloadSettings)
+	}
+	return gp, err
+}
+
+// uploadParams fetches the upload parameters from the bus and keeps track of
+// the version of the settings they were derived from.
+func (w *worker) uploadParams(ctx context.Context) (api.UploadParams, error) {
+	up, err := w.bus.UploadParams(ctx)
+	if err == nil {
+		w.trackSettingsVersion(up.SettingsVersion)
+		w.applyDownloadSettings(up.DownloadSettings)
+	}
+	return up, err
+}
+
+// applyDownloadSettings updates the download managers with the given download
+// settings.
+func (w *worker) applyDownloadSettings(ds api.DownloadSettings) {
+	w.downloadManager.costSaver.Store(ds.CostSaver)
+	w.verifyManager.costSaver.Store(ds.CostSaver)
+}
+
+// trackSettingsVersion updates the version of the settings the worker fetched
+// last, concurrent requests might return out of order so older versions are
+// ignored.
+func (w *worker) trackSettingsVersion(version uint64) {
+	for {
+		curr := w.settingsVersion.Load()
+		if version <= curr || w.settingsVersion.CompareAndSwap(curr, version) {
+			return
+		}
+	}
+}
+
 func (w *worker) stateHandlerGET(jc jape.Context) {
 	jc.Encode(api.WorkerStateResponse{
-		ID:        w.id,
-		StartTime: w.startTime,
+		ID:              w.id,
+		StartTime:       w.startTime,
+		SettingsVersion: w.settingsVersion.Load(),
+		JobQueues:       w.scheduler.Stats(),
 		BuildState: api.BuildState{
 			Network:   build.NetworkName(),
 			Version:   build.Version(),
@@ -1348,92 +2310,208 @@ func (w *worker) stateHandlerGET(jc jape.Context) {
 	})
 }
 
+// Config contains the configuration of a worker.
+type Config struct {
+	ID              string
+	AllowPrivateIPs bool
+
+	BusFlushInterval    time.Duration
+	ContractLockTimeout time.Duration
+
+	DownloadOverdriveTimeout time.Duration
+	DownloadMaxOverdrive     uint64
+	DownloadCacheDir         string
+	DownloadCacheMaxSize     uint64
+	SectorCacheDir           string
+	SectorCacheMaxSize       uint64
+
+	UploadOverdriveTimeout            time.Duration
+	UploadIdleTimeout                 time.Duration
+	UploadMaxDuration                 time.Duration
+	UploadMaxOverdrive                uint64
+	UploadMaxConcurrentSectorsPerHost uint64
+	UploadMaxSlabsAhead               uint64
+	UploadAutoTune                    bool
+	UploadStagingDir                  string
+	UploadPeers                       []UploadPeer
+
+	PriceTablePrefetchInterval time.Duration
+	AccountsRefillInterval     time.Duration
+	AccountsRefillTarget       types.Currency
+	AccountsRefillThreshold    types.Currency
+}
+
 // New returns an HTTP handler that serves the worker API.
-func New(masterKey [32]byte, id string, b Bus, contractLockingDuration, busFlushInterval, downloadOverdriveTimeout, uploadOverdriveTimeout time.Duration, downloadMaxOverdrive, uploadMaxOverdrive uint64, allowPrivateIPs bool, l *zap.Logger) (*worker, error) {
-	if contractLockingDuration == 0 {
+func New(masterKey [32]byte, b Bus, cfg Config, l *zap.Logger) (*worker, error) {
+	if cfg.ContractLockTimeout == 0 {
 		return nil, errors.New("contract lock duration must be positive")
 	}
-	if busFlushInterval == 0 {
+	if cfg.BusFlushInterval == 0 {
 		return nil, errors.New("bus flush interval must be positive")
 	}
-	if downloadOverdriveTimeout == 0 {
+	if cfg.DownloadOverdriveTimeout == 0 {
 		return nil, errors.New("download overdrive timeout must be positive")
 	}
-	if uploadOverdriveTimeout == 0 {
+	if cfg.UploadOverdriveTimeout == 0 {
 		return nil, errors.New("upload overdrive timeout must be positive")
 	}
 
 	w := &worker{
-		alerts:                  alerts.WithOrigin(b, fmt.Sprintf("worker.%s", id)),
-		allowPrivateIPs:         allowPrivateIPs,
-		contractLockingDuration: contractLockingDuration,
-		id:                      id,
+		alerts:                  alerts.WithOrigin(b, fmt.Sprintf("worker.%s", cfg.ID)),
+		allowPrivateIPs:         cfg.AllowPrivateIPs,
+		contractLockingDuration: cfg.ContractLockTimeout,
+		id:                      cfg.ID,
 		bus:                     b,
 		masterKey:               masterKey,
-		busFlushInterval:        busFlushInterval,
-		logger:                  l.Sugar().Named("worker").Named(id),
+		busFlushInterval:        cfg.BusFlushInterval,
+		logger:                  l.Sugar().Named("worker").Named(cfg.ID),
 		startTime:               time.Now(),
+		uploadIdleTimeout:       cfg.UploadIdleTimeout,
+		uploadMaxDuration:       cfg.UploadMaxDuration,
 		uploadingPackedSlabs:    make(map[string]bool),
 	}
 	w.initTransportPool()
+	w.initJobScheduler()
+	w.initHostDenyList()
+	w.initConsensusSubscriber()
 	w.initAccounts(b)
 	w.initContractSpendingRecorder()
-	w.initPriceTables()
-	w.initDownloadManager(downloadMaxOverdrive, downloadOverdriveTimeout, l.Sugar().Named("downloadmanager"))
-	w.initUploadManager(uploadMaxOverdrive, uploadOverdriveTimeout, l.Sugar().Named("uploadmanager"))
+	w.initPriceTables(cfg.PriceTablePrefetchInterval)
+	if err := w.initAccountRefiller(cfg.AccountsRefillInterval, cfg.AccountsRefillTarget, cfg.AccountsRefillThreshold); err != nil {
+		return nil, err
+	}
+	var sc *sectorCache
+	if cfg.SectorCacheMaxSize > 0 {
+		var err error
+		sc, err = newSectorCache(cfg.SectorCacheDir, cfg.SectorCacheMaxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.initDownloadManager(cfg.DownloadMaxOverdrive, cfg.DownloadOverdriveTimeout, sc, l.Sugar().Named("downloadmanager"))
+	if cfg.DownloadCacheMaxSize > 0 {
+		cache, err := newDownloadCache(cfg.DownloadCacheDir, cfg.DownloadCacheMaxSize, w.deriveSubKey("downloadcache"))
+		if err != nil {
+			return nil, err
+		}
+		w.downloadCache = cache
+	}
+	w.initUploadManager(cfg.UploadMaxOverdrive, cfg.UploadMaxConcurrentSectorsPerHost, cfg.UploadMaxSlabsAhead, cfg.UploadOverdriveTimeout, cfg.UploadAutoTune, cfg.UploadPeers, l.Sugar().Named("uploadmanager"))
+	if err := w.initUploadStager(cfg.UploadStagingDir); err != nil {
+		return nil, err
+	}
+	w.initHostMetricsRecorder(hostMetricsRecordInterval)
+	w.initPackedSlabsUploader(packedSlabsUploadInterval)
+
+	// start the consensus subscription only once the upload manager is
+	// initialized since it updates the block height of the uploaders
+	go w.consensus.threadedSubscribe()
 	return w, nil
 }
 
 // Handler returns an HTTP handler that serves the worker API.
 func (w *worker) Handler() http.Handler {
-	return jape.Mux(tracing.TracedRoutes("worker", map[string]jape.Handler{
+	mux := jape.Mux(tracing.TracedRoutes("worker", map[string]jape.Handler{
 		"GET    /account/:hostkey": w.accountHandlerGET,
 		"GET    /id":               w.idHandlerGET,
 
-		"GET    /rhp/contracts":              w.rhpContractsHandlerGET,
-		"POST   /rhp/contract/:id/broadcast": w.rhpBroadcastHandler,
-		"POST   /rhp/contract/:id/prune":     w.rhpPruneContractHandlerPOST,
-		"GET    /rhp/contract/:id/roots":     w.rhpContractRootsHandlerGET,
-		"POST   /rhp/scan":                   w.rhpScanHandler,
-		"POST   /rhp/form":                   w.rhpFormHandler,
-		"POST   /rhp/renew":                  w.rhpRenewHandler,
-		"POST   /rhp/fund":                   w.rhpFundHandler,
-		"POST   /rhp/sync":                   w.rhpSyncHandler,
-		"POST   /rhp/pricetable":             w.rhpPriceTableHandler,
-		"POST   /rhp/registry/read":          w.rhpRegistryReadHandler,
-		"POST   /rhp/registry/update":        w.rhpRegistryUpdateHandler,
+		"GET    /denylist":          w.denyListHandlerGET,
+		"DELETE /denylist":          w.denyListHandlerDELETE,
+		"DELETE /denylist/:hostkey": w.denyListHostHandlerDELETE,
+
+		"GET    /host/:hostkey/gouging": w.hostGougingHandlerGET,
+		"POST   /hosts/pricetables":     w.hostsPriceTablesHandlerPOST,
+
+		"GET    /rhp/contracts":                  w.rhpContractsHandlerGET,
+		"POST   /rhp/contract/:id/broadcast":     w.rhpBroadcastHandler,
+		"POST   /rhp/contract/:id/prune":         w.rhpPruneContractHandlerPOST,
+		"POST   /rhp/contract/:id/deletesectors": w.rhpDeleteSectorsHandlerPOST,
+		"GET    /rhp/contract/:id/roots":         w.rhpContractRootsHandlerGET,
+		"POST   /rhp/scan":                       w.rhpScanHandler,
+		"POST   /rhp/form":                       w.rhpFormHandler,
+		"POST   /rhp/renew":                      w.rhpRenewHandler,
+		"POST   /rhp/fund":                       w.rhpFundHandler,
+		"POST   /rhp/pricetables/refresh":        w.rhpPriceTablesRefreshHandler,
+		"POST   /rhp/sync":                       w.rhpSyncHandler,
+		"POST   /rhp/pricetable":                 w.rhpPriceTableHandler,
+		"POST   /rhp/registry/read":              w.rhpRegistryReadHandler,
+		"POST   /rhp/registry/update":            w.rhpRegistryUpdateHandler,
 
 		"GET    /stats/downloads": w.downloadsStatsHandlerGET,
 		"GET    /stats/uploads":   w.uploadsStatsHandlerGET,
+		"GET    /uploads/staged":  w.uploadsStagedHandlerGET,
 		"POST   /slab/migrate":    w.slabMigrateHandler,
+		"POST   /slab/upload":     w.slabUploadHandler,
 
-		"GET    /objects/*path": w.objectsHandlerGET,
-		"PUT    /objects/*path": w.objectsHandlerPUT,
-		"DELETE /objects/*path": w.objectsHandlerDELETE,
+		"GET    /objects/*path":  w.objectsHandlerGET,
+		"PUT    /objects/*path":  w.objectsHandlerPUT,
+		"DELETE /objects/*path":  w.objectsHandlerDELETE,
+		"POST   /objects/verify": w.objectsVerifyHandlerPOST,
 
-		"PUT    /multipart/*path": w.multipartUploadHandlerPUT,
+		"POST   /multipart/create":   w.multipartCreateHandlerPOST,
+		"POST   /multipart/abort":    w.multipartAbortHandlerPOST,
+		"POST   /multipart/complete": w.multipartCompleteHandlerPOST,
+		"PUT    /multipart/*path":    w.multipartUploadHandlerPUT,
 
 		"GET    /state": w.stateHandlerGET,
 	}))
+
+	// jape doesn't support HEAD routes, so we register it on the router
+	headRoutes := tracing.TracedRoutes("worker", map[string]jape.Handler{
+		"HEAD   /objects/*path": w.objectsHandlerHEAD,
+	})
+	mux.HEAD("/objects/*path", func(rw http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		headRoutes["HEAD   /objects/*path"](jape.Context{ResponseWriter: rw, Request: req, PathParams: ps})
+	})
+	return api.WithErrorEnvelope(mux)
 }
 
 // Shutdown shuts down the worker.
-func (w *worker) Shutdown(_ context.Context) error {
+func (w *worker) Shutdown(ctx context.Context) error {
+	// Stop the job scheduler.
+	w.scheduler.Stop()
+
+	// Stop the account refiller.
+	w.accountRefiller.Stop()
+
+	// Stop the price table prefetcher.
+	w.priceTables.Stop()
+
+	// Stop the consensus subscription.
+	w.consensus.Stop()
+
+	// Stop the host metrics recorder.
+	w.hostMetricsRecorder.Stop()
+
+	// Stop the packed slabs uploader.
+	w.packedSlabsUploader.Stop()
+
+	// Stop the downloaders.
+	w.downloadManager.Stop()
+	w.verifyManager.Stop()
+
+	// Stop the uploader.
+	if w.uploadStager != nil {
+		w.uploadStager.Stop()
+	}
+	w.uploadManager.Stop()
+
+	// Flush the interactions and contract spending only after stopping the
+	// managers, otherwise anything they record while shutting down is lost.
 	w.interactionsMu.Lock()
 	if w.interactionsFlushTimer != nil {
 		w.interactionsFlushTimer.Stop()
-		w.flushInteractions()
 	}
+	w.flushInteractions(ctx)
+	scans, updates := len(w.interactionsScans), len(w.interactionsPriceTableUpdates)
 	w.interactionsMu.Unlock()
 
 	// Stop contract spending recorder.
-	w.contractSpendingRecorder.Stop()
-
-	// Stop the downloader.
-	w.downloadManager.Stop()
+	spendings := w.contractSpendingRecorder.Stop(ctx)
 
-	// Stop the uploader.
-	w.uploadManager.Stop()
+	if scans > 0 || updates > 0 || spendings > 0 {
+		return fmt.Errorf("failed to flush %d host scans, %d price table updates and %d contract spending records to the bus", scans, updates, spendings)
+	}
 	return nil
 }
 
@@ -1564,12 +2642,44 @@ func (w *worker) scanHost(ctx context.Context, hostKey types.PublicKey, hostIP s
 	return settings, pt, elapsed, err
 }
 
+// DownloadObject streams the given range of the object to wr. The data of
+// every slab is written as soon as it's recovered and decrypted, so the caller
+// can start consuming the object before it was fully downloaded.
+func (w *worker) DownloadObject(ctx context.Context, wr io.Writer, bucket, path string, obj api.Object, offset, length int64, contracts []api.ContractMetadata) error {
+	download := func(wr io.Writer) error {
+		return w.downloadManager.DownloadObject(ctx, wr, obj.Object, uint64(offset), uint64(length), contracts)
+	}
+	if w.downloadCache == nil {
+		return download(wr)
+	}
+	return w.downloadCache.Download(wr, bucket, path, obj.ETag, offset, length, download)
+}
+
+// VerifyObject downloads the given object in full using the verify manager,
+// bypassing the sector and download caches, and hashes its plaintext. The
+// integrity of every sector is verified by the download itself.
+func (w *worker) VerifyObject(ctx context.Context, obj api.Object, contracts []api.ContractMetadata) (api.VerifyObjectResponse, error) {
+	hw := &hashWriter{h: types.NewHasher()}
+	start := time.Now()
+	if err := w.verifyManager.DownloadObject(ctx, hw, obj.Object, 0, uint64(obj.Size), contracts); err != nil {
+		return api.VerifyObjectResponse{}, err
+	}
+	sum := hw.h.Sum()
+	hash := hex.EncodeToString(sum[:])
+	return api.VerifyObjectResponse{
+		Duration:  api.DurationMS(time.Since(start)),
+		ETagMatch: hash == obj.ETag,
+		Hash:      hash,
+		Size:      hw.n,
+	}, nil
+}
+
 // PartialSlab fetches the data of a partial slab from the bus. It will fall
 // back to ask the bus for the slab metadata in case the slab wasn't found in
 // the partial slab buffer.
 func (w *worker) PartialSlab(ctx context.Context, key object.EncryptionKey, offset, length uint32) ([]byte, *object.Slab, error) {
 	data, err := w.bus.FetchPartialSlab(ctx, key, offset, length)
-	if err != nil && strings.Contains(err.Error(), api.ErrObjectNotFound.Error()) {
+	if err != nil && errors.Is(api.ParseError(err), api.ErrObjectNotFound) {
 		// Check if slab was already uploaded.
 		slab, err := w.bus.Slab(ctx, key)
 		if err != nil {
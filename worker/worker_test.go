@@ -0,0 +1,300 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.sia.tech/core/types"
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+)
+
+func TestDeleteContractSectors(t *testing.T) {
+	r := func(i byte) types.Hash256 { return types.Hash256{i} }
+	hostRoots := []types.Hash256{r(1), r(2), r(3), r(2), r(4)}
+
+	tests := []struct {
+		referenced []types.Hash256
+		roots      []types.Hash256
+		indices    []uint64
+	}{
+		// nothing to delete
+		{nil, nil, nil},
+		// delete a single sector
+		{nil, []types.Hash256{r(3)}, []uint64{2}},
+		// roots are deleted in the order they are stored on the host
+		{nil, []types.Hash256{r(4), r(1)}, []uint64{0, 4}},
+		// referenced sectors are kept
+		{[]types.Hash256{r(1)}, []types.Hash256{r(1), r(3)}, []uint64{2}},
+		// sectors the host doesn't store are skipped
+		{nil, []types.Hash256{r(5)}, nil},
+		// duplicate sectors are only deleted once
+		{nil, []types.Hash256{r(2), r(2)}, []uint64{1}},
+	}
+	for i, test := range tests {
+		if indices := sectorDeletionIndices(hostRoots, test.referenced, test.roots); !reflect.DeepEqual(indices, test.indices) {
+			t.Fatalf("%d: unexpected indices %v, expected %v", i, indices, test.indices)
+		}
+	}
+}
+
+func TestVerifyUploadTrailer(t *testing.T) {
+	tests := []struct {
+		size     string
+		checksum string
+		valid    bool
+	}{
+		{"", "", true},
+		{"10", "", true},
+		{"", "foo", true},
+		{"10", "foo", true},
+		{"11", "foo", false},
+		{"10", "bar", false},
+		{"ten", "", false},
+	}
+	for i, test := range tests {
+		req := &http.Request{Trailer: make(http.Header)}
+		if test.size != "" {
+			req.Trailer.Set(api.ObjectTrailerSize, test.size)
+		}
+		if test.checksum != "" {
+			req.Trailer.Set(api.ObjectTrailerChecksum, test.checksum)
+		}
+		err := verifyUploadTrailer(req)(10, "foo")
+		if test.valid && err != nil {
+			t.Errorf("%d: unexpected error %v", i, err)
+		} else if !test.valid && !errors.Is(err, api.ErrObjectTrailerMismatch) {
+			t.Errorf("%d: expected trailer mismatch, got %v", i, err)
+		}
+	}
+}
+
+func TestLimitUpload(t *testing.T) {
+	w := &worker{}
+	data := bytes.Repeat([]byte{1}, 10)
+
+	// assert uploads are unlimited by default
+	r, err := w.limitUpload(api.Bucket{}, -1, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	} else if got, err := io.ReadAll(r); err != nil || len(got) != len(data) {
+		t.Fatal("unexpected read", len(got), err)
+	}
+
+	// assert uploads of a known size fail early
+	b := api.Bucket{Policy: api.BucketPolicy{MaxObjectSize: 9}}
+	if _, err := w.limitUpload(b, 10, bytes.NewReader(data)); !errors.Is(err, api.ErrObjectTooLarge) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert uploads of an unknown size fail once they exceed the limit
+	r, err = w.limitUpload(b, -1, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := io.ReadAll(r); !errors.Is(err, api.ErrObjectTooLarge) {
+		t.Fatal("unexpected error", err)
+	} else if status := uploadErrorStatus(err); status != http.StatusRequestEntityTooLarge {
+		t.Fatal("unexpected status", status)
+	}
+
+	// assert uploads that don't exceed the limit succeed
+	b.Policy.MaxObjectSize = 10
+	r, err = w.limitUpload(b, -1, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	} else if got, err := io.ReadAll(r); err != nil || len(got) != len(data) {
+		t.Fatal("unexpected read", len(got), err)
+	}
+
+	// assert quota errors returned by the bus are recognised
+	if status := uploadErrorStatus(errors.New(api.ErrBucketQuotaExceeded.Error())); status != http.StatusRequestEntityTooLarge {
+		t.Fatal("unexpected status", status)
+	}
+}
+
+func TestWriteUploadError(t *testing.T) {
+	// assert errors are categorized, errors returned by hosts are strings
+	// so they are matched by their message too
+	tests := []struct {
+		err      error
+		category string
+	}{
+		{fmt.Errorf("foo: %w", context.DeadlineExceeded), api.UploadErrorCategoryTimeout},
+		{os.ErrDeadlineExceeded, api.UploadErrorCategoryTimeout},
+		{fmt.Errorf("%w: foo", errPriceTableGouging), api.UploadErrorCategoryGouging},
+		{errors.New(ErrInsufficientFunds.Error()), api.UploadErrorCategoryFunds},
+		{errors.New(errBalanceInsufficient.Error()), api.UploadErrorCategoryFunds},
+		{fmt.Errorf("%w: foo", errDialTransportV3), api.UploadErrorCategoryConnection},
+		{net.ErrClosed, api.UploadErrorCategoryConnection},
+		{errors.New(errMaxRevisionReached.Error()), api.UploadErrorCategoryContract},
+		{ErrContractFinalized, api.UploadErrorCategoryContract},
+		{ErrContractLocked, api.UploadErrorCategoryContract},
+		{errors.New("foo"), api.UploadErrorCategoryUnknown},
+	}
+	for _, test := range tests {
+		if category := uploadErrorCategory(test.err); category != test.category {
+			t.Fatalf("unexpected category for '%v', %v != %v", test.err, category, test.category)
+		}
+	}
+
+	// assert the errors of a host are aggregated and the most recent one is
+	// reported, hosts are listed in the order in which they first failed
+	hk1, hk2 := types.PublicKey{1}, types.PublicKey{2}
+	hes := HostErrorSet{
+		{HostKey: hk1, Err: errDialTransportV3},
+		{HostKey: hk2, Err: ErrContractLocked},
+		{HostKey: hk1, Err: context.DeadlineExceeded},
+	}
+	rec := httptest.NewRecorder()
+	writeUploadError(jape.Context{ResponseWriter: rec, Request: httptest.NewRequest(http.MethodPut, "/objects/foo", nil)}, fmt.Errorf("couldn't upload object: %w", hes))
+	var ue api.UploadError
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatal("unexpected status", rec.Code)
+	} else if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatal("unexpected content type", ct)
+	} else if err := json.NewDecoder(rec.Body).Decode(&ue); err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(ue.Message, "couldn't upload object") {
+		t.Fatal("unexpected message", ue.Message)
+	} else if !reflect.DeepEqual(ue.Hosts, []api.UploadHostError{
+		{HostKey: hk1, Category: api.UploadErrorCategoryTimeout, Attempts: 2, Error: context.DeadlineExceeded.Error()},
+		{HostKey: hk2, Category: api.UploadErrorCategoryContract, Attempts: 1, Error: ErrContractLocked.Error()},
+	}) {
+		t.Fatal("unexpected hosts", ue.Hosts)
+	}
+
+	// assert other errors are written as plain text
+	rec = httptest.NewRecorder()
+	writeUploadError(jape.Context{ResponseWriter: rec, Request: httptest.NewRequest(http.MethodPut, "/objects/foo", nil)}, api.ErrObjectTooLarge)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatal("unexpected status", rec.Code)
+	} else if body := strings.TrimSpace(rec.Body.String()); body != api.ErrObjectTooLarge.Error() {
+		t.Fatal("unexpected body", body)
+	}
+}
+
+func TestTrackSettingsVersion(t *testing.T) {
+	w := &worker{}
+	w.trackSettingsVersion(2)
+	if v := w.settingsVersion.Load(); v != 2 {
+		t.Fatal("unexpected version", v)
+	}
+
+	// older versions are ignored
+	w.trackSettingsVersion(1)
+	if v := w.settingsVersion.Load(); v != 2 {
+		t.Fatal("unexpected version", v)
+	}
+
+	// concurrent updates settle on the highest version
+	var wg sync.WaitGroup
+	for i := uint64(1); i <= 100; i++ {
+		wg.Add(1)
+		go func(v uint64) {
+			defer wg.Done()
+			w.trackSettingsVersion(v)
+		}(i)
+	}
+	wg.Wait()
+	if v := w.settingsVersion.Load(); v != 100 {
+		t.Fatal("unexpected version", v)
+	}
+}
+
+func TestRequestMimeType(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"application/octet-stream", ""},
+		{"invalid/", ""},
+		{"text/plain", "text/plain"},
+		{"Text/HTML; charset=UTF-8", "text/html; charset=UTF-8"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodPut, "/objects/foo", nil)
+		req.Header.Set("Content-Type", test.header)
+		if got := requestMimeType(req); got != test.want {
+			t.Fatalf("unexpected mime type for '%v', %v != %v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestServeEmptyObject(t *testing.T) {
+	b := newMockBus()
+	b.objects["/empty"] = api.Object{
+		ObjectMetadata: api.ObjectMetadata{
+			ETag:     "d41d8cd98f00b204e9800998ecf8427e",
+			MimeType: "text/plain",
+			ModTime:  time.Now().UTC().Truncate(time.Second),
+			Name:     "/empty",
+		},
+	}
+	w := &worker{bus: b}
+
+	serve := func(method, rangeHeader string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/objects/empty", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		jc := jape.Context{ResponseWriter: rec, Request: req, PathParams: httprouter.Params{{Key: "path", Value: "/empty"}}}
+		if method == http.MethodHead {
+			w.objectsHandlerHEAD(jc)
+		} else {
+			w.objectsHandlerGET(jc)
+		}
+		return rec
+	}
+
+	// assert GET and HEAD requests serve the empty object's metadata, ranges
+	// are ignored since there's no content to serve a part of
+	for _, test := range []struct {
+		method string
+		header string
+	}{
+		{http.MethodGet, ""},
+		{http.MethodGet, "bytes=0-"},
+		{http.MethodGet, "bytes=0-99"},
+		{http.MethodHead, ""},
+	} {
+		rec := serve(test.method, test.header)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%v %q: unexpected status %v", test.method, test.header, rec.Code)
+		} else if rec.Body.Len() != 0 {
+			t.Fatalf("%v %q: unexpected body %q", test.method, test.header, rec.Body.String())
+		} else if cl := rec.Header().Get("Content-Length"); cl != "0" {
+			t.Fatalf("%v %q: unexpected content length %q", test.method, test.header, cl)
+		} else if ct := rec.Header().Get("Content-Type"); ct != "text/plain" {
+			t.Fatalf("%v %q: unexpected content type %q", test.method, test.header, ct)
+		} else if lm := rec.Header().Get("Last-Modified"); lm != b.objects["/empty"].LastModified() {
+			t.Fatalf("%v %q: unexpected last modified %q", test.method, test.header, lm)
+		} else if test.header == "" && rec.Header().Get("ETag") != api.FormatETag(b.objects["/empty"].ETag) {
+			t.Fatalf("%v %q: unexpected etag %q", test.method, test.header, rec.Header().Get("ETag"))
+		}
+	}
+
+	// assert unknown objects are not found
+	req := httptest.NewRequest(http.MethodHead, "/objects/unknown", nil)
+	rec := httptest.NewRecorder()
+	w.objectsHandlerHEAD(jape.Context{ResponseWriter: rec, Request: req, PathParams: httprouter.Params{{Key: "path", Value: "/unknown"}}})
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status %v", rec.Code)
+	}
+}